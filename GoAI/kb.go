@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Chunk struct {
+	Text      string
+	Hash      string
+	Embedding []float64
+}
+
+type DocumentVersion struct {
+	Version     int
+	ContentHash string
+	ChunkCount  int
+	Embedded    int // 本次实际重新向量化的分块数
+	UpdatedAt   time.Time
+}
+
+type Document struct {
+	ID       string
+	KB       string
+	Content  string
+	Version  int
+	Chunks   []*Chunk
+	Versions []DocumentVersion
+}
+
+type KnowledgeBase struct {
+	Name      string
+	Documents map[string]*Document
+}
+
+// KnowledgeBaseManager 管理多个知识库的文档上传、版本和检索
+type KnowledgeBaseManager struct {
+	Embedder  Embedder
+	ChunkSize int
+	kbs       map[string]*KnowledgeBase
+	sessions  map[string][]string
+	mu        sync.RWMutex
+}
+
+func NewKnowledgeBaseManager(embedder Embedder, chunkSize int) *KnowledgeBaseManager {
+	return &KnowledgeBaseManager{
+		Embedder:  embedder,
+		ChunkSize: chunkSize,
+		kbs:       make(map[string]*KnowledgeBase),
+		sessions:  make(map[string][]string),
+	}
+}
+
+func hashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// embed 调用Embedder并校验返回的向量数与输入一致
+func (m *KnowledgeBaseManager) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors, err := m.Embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
+
+func (m *KnowledgeBaseManager) CreateKB(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.kbs[name]; ok {
+		return fmt.Errorf("knowledge base %s already exists", name)
+	}
+	m.kbs[name] = &KnowledgeBase{Name: name, Documents: make(map[string]*Document)}
+	return nil
+}
+
+func (m *KnowledgeBaseManager) DeleteKB(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.kbs[name]; !ok {
+		return fmt.Errorf("knowledge base %s not found", name)
+	}
+	delete(m.kbs, name)
+	return nil
+}
+
+// UpsertDocument 上传或替换文档，只对内容变化的分块重新向量化
+func (m *KnowledgeBaseManager) UpsertDocument(ctx context.Context, kbName, docID, content string) (DocumentVersion, error) {
+	contentHash := hashText(content)
+
+	// 1. 复用旧版本中相同分块的向量
+	m.mu.RLock()
+	kb, ok := m.kbs[kbName]
+	if !ok {
+		m.mu.RUnlock()
+		return DocumentVersion{}, fmt.Errorf("knowledge base %s not found", kbName)
+	}
+	cached := make(map[string][]float64)
+	if old, exists := kb.Documents[docID]; exists {
+		if old.Versions[len(old.Versions)-1].ContentHash == contentHash {
+			current := old.Versions[len(old.Versions)-1]
+			m.mu.RUnlock()
+			return current, nil
+		}
+		for _, c := range old.Chunks {
+			cached[c.Hash] = c.Embedding
+		}
+	}
+	m.mu.RUnlock()
+
+	chunks := make([]*Chunk, 0)
+	pending := make([]string, 0)
+	pendingIdx := make([]int, 0)
+	for i, text := range SplitChunks(content, m.ChunkSize) {
+		h := hashText(text)
+		chunk := &Chunk{Text: text, Hash: h}
+		if emb, hit := cached[h]; hit {
+			chunk.Embedding = emb
+		} else {
+			pending = append(pending, text)
+			pendingIdx = append(pendingIdx, i)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	// 2. 只对新增或变化的分块调用向量化
+	if len(pending) > 0 {
+		vectors, err := m.embed(ctx, pending)
+		if err != nil {
+			return DocumentVersion{}, fmt.Errorf("embed document %s/%s: %w", kbName, docID, err)
+		}
+		for i, idx := range pendingIdx {
+			chunks[idx].Embedding = vectors[i]
+		}
+	}
+
+	// 3. 写入新版本
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kb, ok = m.kbs[kbName]
+	if !ok {
+		return DocumentVersion{}, fmt.Errorf("knowledge base %s not found", kbName)
+	}
+	doc, exists := kb.Documents[docID]
+	if !exists {
+		doc = &Document{ID: docID, KB: kbName}
+		kb.Documents[docID] = doc
+	}
+	doc.Version++
+	doc.Content = content
+	doc.Chunks = chunks
+	version := DocumentVersion{
+		Version:     doc.Version,
+		ContentHash: contentHash,
+		ChunkCount:  len(chunks),
+		Embedded:    len(pending),
+		UpdatedAt:   time.Now(),
+	}
+	doc.Versions = append(doc.Versions, version)
+	return version, nil
+}
+
+func (m *KnowledgeBaseManager) DeleteDocument(kbName, docID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kb, ok := m.kbs[kbName]
+	if !ok {
+		return fmt.Errorf("knowledge base %s not found", kbName)
+	}
+	if _, exists := kb.Documents[docID]; !exists {
+		return fmt.Errorf("document %s/%s not found", kbName, docID)
+	}
+	delete(kb.Documents, docID)
+	return nil
+}
+
+func (m *KnowledgeBaseManager) ListDocuments(kbName string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	kb, ok := m.kbs[kbName]
+	if !ok {
+		return nil, fmt.Errorf("knowledge base %s not found", kbName)
+	}
+	ids := make([]string, 0, len(kb.Documents))
+	for id := range kb.Documents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (m *KnowledgeBaseManager) Versions(kbName, docID string) ([]DocumentVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	kb, ok := m.kbs[kbName]
+	if !ok {
+		return nil, fmt.Errorf("knowledge base %s not found", kbName)
+	}
+	doc, exists := kb.Documents[docID]
+	if !exists {
+		return nil, fmt.Errorf("document %s/%s not found", kbName, docID)
+	}
+	return append([]DocumentVersion(nil), doc.Versions...), nil
+}
+
+// Reindex 对知识库全部分块重新向量化（例如更换了Embedder）。
+// 向量化在锁外进行，全部成功后才一次性替换；期间被更新或删除的文档保留其新内容
+func (m *KnowledgeBaseManager) Reindex(ctx context.Context, kbName string) error {
+	type snapshot struct {
+		doc     *Document
+		version int
+		chunks  []*Chunk
+	}
+
+	m.mu.RLock()
+	kb, ok := m.kbs[kbName]
+	if !ok {
+		m.mu.RUnlock()
+		return fmt.Errorf("knowledge base %s not found", kbName)
+	}
+	docs := make([]snapshot, 0, len(kb.Documents))
+	for _, doc := range kb.Documents {
+		docs = append(docs, snapshot{doc: doc, version: doc.Version, chunks: doc.Chunks})
+	}
+	m.mu.RUnlock()
+
+	reindexed := make([][]*Chunk, len(docs))
+	for i, s := range docs {
+		texts := make([]string, len(s.chunks))
+		for j, c := range s.chunks {
+			texts[j] = c.Text
+		}
+		vectors, err := m.embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("reindex %s/%s: %w", kbName, s.doc.ID, err)
+		}
+		chunks := make([]*Chunk, len(s.chunks))
+		for j, c := range s.chunks {
+			chunks[j] = &Chunk{Text: c.Text, Hash: c.Hash, Embedding: vectors[j]}
+		}
+		reindexed[i] = chunks
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.kbs[kbName] != kb {
+		return fmt.Errorf("knowledge base %s was deleted during reindex", kbName)
+	}
+	for i, s := range docs {
+		if kb.Documents[s.doc.ID] == s.doc && s.doc.Version == s.version {
+			s.doc.Chunks = reindexed[i]
+		}
+	}
+	return nil
+}
+
+// SetSessionKBs 限定会话可检索的知识库，不设置时检索全部知识库
+func (m *KnowledgeBaseManager) SetSessionKBs(sessionID string, kbNames ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[sessionID] = kbNames
+}
+
+func (m *KnowledgeBaseManager) Search(ctx context.Context, query string, kbNames []string, topK int) ([]SearchResult, error) {
+	vectors, err := m.embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	queryVec := vectors[0]
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(kbNames) == 0 {
+		for name := range m.kbs {
+			kbNames = append(kbNames, name)
+		}
+	}
+	results := make([]SearchResult, 0)
+	for _, name := range kbNames {
+		kb, ok := m.kbs[name]
+		if !ok {
+			continue
+		}
+		for _, doc := range kb.Documents {
+			for _, c := range doc.Chunks {
+				results = append(results, SearchResult{
+					KB:      name,
+					DocID:   doc.ID,
+					Version: doc.Version,
+					Chunk:   c.Text,
+					Score:   cosine(queryVec, c.Embedding),
+				})
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if topK > 0 && len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+func (m *KnowledgeBaseManager) SearchSession(ctx context.Context, sessionID, query string, topK int) ([]SearchResult, error) {
+	m.mu.RLock()
+	kbNames := append([]string(nil), m.sessions[sessionID]...)
+	m.mu.RUnlock()
+	return m.Search(ctx, query, kbNames, topK)
+}
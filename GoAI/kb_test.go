@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestKnowledgeBaseVersioning(t *testing.T) {
+	ctx := context.Background()
+	m := NewKnowledgeBaseManager(NewHashEmbedder(128), 100)
+	if err := m.CreateKB("golang"); err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := m.UpsertDocument(ctx, "golang", "intro", "Go is a compiled language.\n\nGoroutines are lightweight threads.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Version != 1 || v1.Embedded != 2 {
+		t.Fatalf("unexpected v1: %+v", v1)
+	}
+
+	// 只修改第二段，只应重新向量化一个分块
+	v2, err := m.UpsertDocument(ctx, "golang", "intro", "Go is a compiled language.\n\nChannels connect goroutines.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version != 2 || v2.Embedded != 1 {
+		t.Fatalf("unexpected v2: %+v", v2)
+	}
+
+	// 内容不变不产生新版本
+	v3, _ := m.UpsertDocument(ctx, "golang", "intro", "Go is a compiled language.\n\nChannels connect goroutines.")
+	if v3.Version != 2 {
+		t.Fatalf("unchanged content should keep version 2, got %d", v3.Version)
+	}
+
+	versions, _ := m.Versions("golang", "intro")
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(versions))
+	}
+
+	if err := m.DeleteDocument("golang", "intro"); err != nil {
+		t.Fatal(err)
+	}
+	docs, _ := m.ListDocuments("golang")
+	if len(docs) != 0 {
+		t.Fatalf("document not deleted: %v", docs)
+	}
+}
+
+func TestKnowledgeBaseSessionScope(t *testing.T) {
+	ctx := context.Background()
+	m := NewKnowledgeBaseManager(NewHashEmbedder(128), 100)
+	m.CreateKB("golang")
+	m.CreateKB("cooking")
+	m.UpsertDocument(ctx, "golang", "chan", "Channels connect goroutines in Go.")
+	m.UpsertDocument(ctx, "cooking", "noodle", "Boil the noodles for five minutes.")
+
+	m.SetSessionKBs("s1", "cooking")
+	results, err := m.SearchSession(ctx, "s1", "goroutines channels", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.KB != "cooking" {
+			t.Fatalf("session scoped search returned kb %s", r.KB)
+		}
+	}
+
+	results, _ = m.Search(ctx, "goroutines channels", nil, 1)
+	if len(results) != 1 || results[0].DocID != "chan" {
+		t.Fatalf("unexpected top result: %+v", results)
+	}
+	if BuildRAGContext(results) == "" {
+		t.Fatal("empty rag context")
+	}
+}
+
+// countEmbedder 返回固定数量的向量，可在向量化时执行回调
+type countEmbedder struct {
+	count   int
+	onEmbed func()
+}
+
+func (e *countEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if e.onEmbed != nil {
+		e.onEmbed()
+	}
+	n := e.count
+	if n < 0 {
+		n = len(texts)
+	}
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		vectors[i] = []float64{1}
+	}
+	return vectors, nil
+}
+
+func TestKnowledgeBaseRejectsMismatchedVectors(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countEmbedder{count: -1}
+	m := NewKnowledgeBaseManager(embedder, 100)
+	m.CreateKB("golang")
+	if _, err := m.UpsertDocument(ctx, "golang", "intro", "Go is a compiled language.\n\nGoroutines are lightweight threads."); err != nil {
+		t.Fatal(err)
+	}
+
+	embedder.count = 1
+	if _, err := m.UpsertDocument(ctx, "golang", "other", "First paragraph.\n\nSecond paragraph."); err == nil {
+		t.Fatal("upsert should fail when the embedder returns too few vectors")
+	}
+	if err := m.Reindex(ctx, "golang"); err == nil {
+		t.Fatal("reindex should fail when the embedder returns too few vectors")
+	}
+	docs, _ := m.ListDocuments("golang")
+	if len(docs) != 1 {
+		t.Fatalf("failed upsert should not add a document: %v", docs)
+	}
+}
+
+func TestKnowledgeBaseReindexEmbedsOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	embedder := &countEmbedder{count: -1}
+	m := NewKnowledgeBaseManager(embedder, 100)
+	m.CreateKB("golang")
+	m.UpsertDocument(ctx, "golang", "intro", "Go is a compiled language.")
+	m.UpsertDocument(ctx, "golang", "chan", "Channels connect goroutines.")
+
+	// 向量化期间读写知识库不应被阻塞，期间更新的文档保留新内容
+	embedder.onEmbed = func() {
+		embedder.onEmbed = nil
+		done := make(chan error, 1)
+		go func() {
+			_, err := m.UpsertDocument(ctx, "golang", "chan", "Select waits on channels.")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Error(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("upsert blocked while reindexing")
+		}
+	}
+	if err := m.Reindex(ctx, "golang"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, _ := m.Search(ctx, "select", []string{"golang"}, 0)
+	for _, r := range results {
+		if r.DocID == "chan" && r.Chunk != "Select waits on channels." {
+			t.Fatalf("reindex overwrote a concurrent update: %q", r.Chunk)
+		}
+	}
+}
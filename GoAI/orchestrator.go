@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+// 子agent角色
+const (
+	RolePlanner    = "planner"    // 把任务拆成按角色分配的步骤
+	RoleResearcher = "researcher" // 基于知识库检索(RAG)收集资料
+	RoleExecutor   = "executor"   // 调用MCP工具完成操作
+)
+
+var ErrBudgetExceeded = errors.New("agent budget exceeded")
+
+// ModelMessage 子agent与模型之间的一条消息，Role取值 system/user/assistant/tool
+type ModelMessage struct {
+	Role       string
+	Content    string
+	ToolCallID string
+	ToolCalls  []ModelToolCall
+}
+
+type ModelToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+type ModelReply struct {
+	Content   string
+	ToolCalls []ModelToolCall
+	Tokens    int
+
+	// 经ModelRouter调用时记录实际使用的路由和之前被跳过或失败的路由
+	Route     string
+	Fallbacks []RouteAttempt
+}
+
+// ChatModel 子agent使用的对话模型，每次调用传入完整消息历史，便于按agent独立计量和替换
+type ChatModel interface {
+	Complete(ctx context.Context, messages []ModelMessage, tools []mcp.Tool) (ModelReply, error)
+}
+
+// OpenAIChatModel 基于OpenAI chat completions的ChatModel
+type OpenAIChatModel struct {
+	Client openai.Client
+	Model  string
+}
+
+func NewOpenAIChatModel(model string) *OpenAIChatModel {
+	options := []option.RequestOption{
+		option.WithAPIKey(os.Getenv(ChatGPTOpenAPIKEY)),
+	}
+	if baseURL := os.Getenv(ChatGPTBaseURL); baseURL != "" {
+		options = append(options, option.WithBaseURL(baseURL))
+	}
+	return &OpenAIChatModel{
+		Client: openai.NewClient(options...),
+		Model:  model,
+	}
+}
+
+func (m *OpenAIChatModel) Complete(ctx context.Context, messages []ModelMessage, tools []mcp.Tool) (ModelReply, error) {
+	params := openai.ChatCompletionNewParams{
+		Messages: toOpenAIMessages(messages),
+		Model:    m.Model,
+	}
+	if toolsParam := MCPTool2OpenAITool(tools); len(toolsParam) > 0 {
+		params.Tools = toolsParam
+	}
+	resp, err := m.Client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return ModelReply{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return ModelReply{}, fmt.Errorf("empty completion")
+	}
+	msg := resp.Choices[0].Message
+	reply := ModelReply{Content: msg.Content, Tokens: int(resp.Usage.TotalTokens)}
+	for _, call := range msg.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, ModelToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return reply, nil
+}
+
+func toOpenAIMessages(messages []ModelMessage) []openai.ChatCompletionMessageParamUnion {
+	result := make([]openai.ChatCompletionMessageParamUnion, 0, len(messages))
+	for _, msg := range messages {
+		switch msg.Role {
+		case "system":
+			result = append(result, openai.SystemMessage(msg.Content))
+		case "tool":
+			result = append(result, openai.ToolMessage(msg.Content, msg.ToolCallID))
+		case "assistant":
+			assistant := openai.ChatCompletionAssistantMessageParam{}
+			if msg.Content != "" {
+				assistant.Content.OfString = openai.String(msg.Content)
+			}
+			for _, call := range msg.ToolCalls {
+				assistant.ToolCalls = append(assistant.ToolCalls, openai.ChatCompletionMessageToolCallUnionParam{
+					OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+						ID: call.ID,
+						Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+							Name:      call.Name,
+							Arguments: call.Arguments,
+						},
+					},
+				})
+			}
+			result = append(result, openai.ChatCompletionMessageParamUnion{OfAssistant: &assistant})
+		default:
+			result = append(result, openai.UserMessage(msg.Content))
+		}
+	}
+	return result
+}
+
+// ToolProvider 执行者可调用的工具来源，*MCPClient 实现了该接口
+type ToolProvider interface {
+	GetTool() []mcp.Tool
+	CallTool(name string, args any) (string, error)
+}
+
+// Budget 单个子agent在一次编排中的资源上限，0表示不限制
+type Budget struct {
+	MaxTokens     int
+	MaxModelCalls int
+	MaxToolCalls  int
+}
+
+type BudgetUsage struct {
+	Tokens     int
+	ModelCalls int
+	ToolCalls  int
+}
+
+// MemoryEntry 共享记忆中的一条记录
+type MemoryEntry struct {
+	Key   string
+	Agent string
+	Value string
+	Time  time.Time
+}
+
+// SharedMemory 子agent之间共享的记忆，按写入顺序保存，同一key覆盖旧值
+type SharedMemory struct {
+	entries []MemoryEntry
+	index   map[string]int
+	mu      sync.RWMutex
+}
+
+func NewSharedMemory() *SharedMemory {
+	return &SharedMemory{index: make(map[string]int)}
+}
+
+func (m *SharedMemory) Put(agent, key, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := MemoryEntry{Key: key, Agent: agent, Value: value, Time: time.Now()}
+	if i, ok := m.index[key]; ok {
+		m.entries[i] = entry
+		return
+	}
+	m.index[key] = len(m.entries)
+	m.entries = append(m.entries, entry)
+}
+
+func (m *SharedMemory) Get(key string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i, ok := m.index[key]
+	if !ok {
+		return "", false
+	}
+	return m.entries[i].Value, true
+}
+
+func (m *SharedMemory) Entries() []MemoryEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]MemoryEntry(nil), m.entries...)
+}
+
+// Render 将共享记忆拼接为提示词
+func (m *SharedMemory) Render() string {
+	entries := m.Entries()
+	if len(entries) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("共享记忆（其他agent的产出）：\n")
+	for _, e := range entries {
+		sb.WriteString(fmt.Sprintf("- %s (by %s): %s\n", e.Key, e.Agent, e.Value))
+	}
+	return sb.String()
+}
+
+// 协作轨迹事件类型
+const (
+	TracePlan   = "plan"
+	TraceStep   = "step"
+	TraceModel  = "model"
+	TraceTool   = "tool"
+	TraceSearch = "search"
+	TraceMemory = "memory"
+	TraceRoute  = "route"
+	TraceError  = "error"
+)
+
+type TraceEvent struct {
+	Seq    int
+	Time   time.Time
+	Agent  string
+	Kind   string
+	Detail string
+	Tokens int
+}
+
+// Trace 所有子agent共用的协作轨迹
+type Trace struct {
+	events []TraceEvent
+	mu     sync.Mutex
+}
+
+func (t *Trace) add(agent, kind, detail string, tokens int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, TraceEvent{
+		Seq:    len(t.events) + 1,
+		Time:   time.Now(),
+		Agent:  agent,
+		Kind:   kind,
+		Detail: detail,
+		Tokens: tokens,
+	})
+}
+
+func (t *Trace) Events() []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEvent(nil), t.events...)
+}
+
+func (t *Trace) String() string {
+	var sb strings.Builder
+	for _, e := range t.Events() {
+		sb.WriteString(fmt.Sprintf("#%d [%s] %-6s %s", e.Seq, e.Agent, e.Kind, e.Detail))
+		if e.Tokens > 0 {
+			sb.WriteString(fmt.Sprintf(" (%d tokens)", e.Tokens))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// SubAgent 具有特定角色的子agent
+type SubAgent struct {
+	Name         string
+	Role         string
+	SystemPrompt string
+	Model        ChatModel
+	Budget       Budget
+	MaxSteps     int // 单次任务内模型调用轮数上限
+
+	// researcher 使用的知识库
+	KB    *KnowledgeBaseManager
+	KBs   []string
+	TopK  int
+	Tools []ToolProvider // executor 使用的MCP工具
+
+	usage BudgetUsage
+}
+
+const (
+	plannerPrompt = `你是任务规划者。把用户任务拆成按顺序执行的步骤，每行一个，格式为：
+[researcher] 需要从知识库查询的问题
+[executor] 需要调用工具完成的操作
+只输出步骤列表。`
+	researcherPrompt = `你是研究员。根据提供的知识库内容回答问题，只总结与问题相关的事实，不要编造。`
+	executorPrompt   = `你是执行者。使用提供的工具完成指定操作，完成后简要说明结果。`
+)
+
+func NewPlanner(model ChatModel, budget Budget) *SubAgent {
+	return &SubAgent{Name: RolePlanner, Role: RolePlanner, SystemPrompt: plannerPrompt, Model: model, Budget: budget}
+}
+
+func NewResearcher(model ChatModel, kb *KnowledgeBaseManager, budget Budget, kbs ...string) *SubAgent {
+	return &SubAgent{Name: RoleResearcher, Role: RoleResearcher, SystemPrompt: researcherPrompt, Model: model, Budget: budget, KB: kb, KBs: kbs, TopK: 3}
+}
+
+func NewExecutor(model ChatModel, tools []ToolProvider, budget Budget) *SubAgent {
+	return &SubAgent{Name: RoleExecutor, Role: RoleExecutor, SystemPrompt: executorPrompt, Model: model, Budget: budget, Tools: tools}
+}
+
+func (a *SubAgent) Usage() BudgetUsage {
+	return a.usage
+}
+
+func (a *SubAgent) tools() []mcp.Tool {
+	tools := make([]mcp.Tool, 0)
+	for _, provider := range a.Tools {
+		tools = append(tools, provider.GetTool()...)
+	}
+	return tools
+}
+
+func (a *SubAgent) callTool(call ModelToolCall) (string, error) {
+	for _, provider := range a.Tools {
+		for _, tool := range provider.GetTool() {
+			if tool.Name == call.Name {
+				return provider.CallTool(call.Name, call.Arguments)
+			}
+		}
+	}
+	return "", fmt.Errorf("tool %s not found", call.Name)
+}
+
+func (a *SubAgent) overBudget() error {
+	b, u := a.Budget, a.usage
+	switch {
+	case b.MaxTokens > 0 && u.Tokens > b.MaxTokens:
+		return fmt.Errorf("%w: %s used %d/%d tokens", ErrBudgetExceeded, a.Name, u.Tokens, b.MaxTokens)
+	case b.MaxModelCalls > 0 && u.ModelCalls > b.MaxModelCalls:
+		return fmt.Errorf("%w: %s used %d/%d model calls", ErrBudgetExceeded, a.Name, u.ModelCalls, b.MaxModelCalls)
+	case b.MaxToolCalls > 0 && u.ToolCalls > b.MaxToolCalls:
+		return fmt.Errorf("%w: %s used %d/%d tool calls", ErrBudgetExceeded, a.Name, u.ToolCalls, b.MaxToolCalls)
+	}
+	return nil
+}
+
+// Run 执行一项指令：researcher先检索知识库，executor可多轮调用工具，结果由调用方写入共享记忆
+func (a *SubAgent) Run(ctx context.Context, instruction string, memory *SharedMemory, trace *Trace) (string, error) {
+	prompt := instruction
+	if rendered := memory.Render(); rendered != "" {
+		prompt = rendered + "\n当前任务：" + instruction
+	}
+
+	if a.KB != nil {
+		results, err := a.KB.Search(ctx, instruction, a.KBs, a.TopK)
+		if err != nil {
+			trace.add(a.Name, TraceError, err.Error(), 0)
+			return "", err
+		}
+		trace.add(a.Name, TraceSearch, fmt.Sprintf("%d chunks for %q", len(results), instruction), 0)
+		if ragCtx := BuildRAGContext(results); ragCtx != "" {
+			prompt = ragCtx + "\n" + prompt
+		}
+	}
+
+	messages := []ModelMessage{{Role: "system", Content: a.SystemPrompt}, {Role: "user", Content: prompt}}
+	tools := a.tools()
+	maxSteps := a.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = 8
+	}
+
+	for step := 0; step < maxSteps; step++ {
+		a.usage.ModelCalls++
+		if err := a.overBudget(); err != nil {
+			trace.add(a.Name, TraceError, err.Error(), 0)
+			return "", err
+		}
+		reply, err := a.Model.Complete(ctx, messages, tools)
+		if len(reply.Fallbacks) > 0 {
+			trace.add(a.Name, TraceRoute, "fallback: "+describeFallbacks(reply.Fallbacks), 0)
+		}
+		if err != nil {
+			trace.add(a.Name, TraceError, err.Error(), 0)
+			return "", err
+		}
+		a.usage.Tokens += reply.Tokens
+		detail := fmt.Sprintf("%d tool calls", len(reply.ToolCalls))
+		if reply.Route != "" {
+			detail += " via " + reply.Route
+		}
+		trace.add(a.Name, TraceModel, detail, reply.Tokens)
+		if err := a.overBudget(); err != nil {
+			trace.add(a.Name, TraceError, err.Error(), 0)
+			return reply.Content, err
+		}
+		if len(reply.ToolCalls) == 0 || len(a.Tools) == 0 {
+			return reply.Content, nil
+		}
+
+		messages = append(messages, ModelMessage{Role: "assistant", Content: reply.Content, ToolCalls: reply.ToolCalls})
+		for _, call := range reply.ToolCalls {
+			a.usage.ToolCalls++
+			if err := a.overBudget(); err != nil {
+				trace.add(a.Name, TraceError, err.Error(), 0)
+				return "", err
+			}
+			result, err := a.callTool(call)
+			if err != nil {
+				result = "error: " + err.Error()
+			}
+			trace.add(a.Name, TraceTool, fmt.Sprintf("%s(%s) -> %s", call.Name, call.Arguments, result), 0)
+			messages = append(messages, ModelMessage{Role: "tool", Content: result, ToolCallID: call.ID})
+		}
+	}
+	err := fmt.Errorf("%s reached max steps %d", a.Name, maxSteps)
+	trace.add(a.Name, TraceError, err.Error(), 0)
+	return "", err
+}
+
+type PlanStep struct {
+	Role        string
+	Instruction string
+}
+
+var planLine = regexp.MustCompile(`(?i)^\s*(?:[-*]|\d+[.)、])?\s*\[?(planner|researcher|executor)\]?\s*[:：]?\s*(.+)$`)
+
+// ParsePlan 解析规划者输出的步骤列表，无法识别的行忽略
+func ParsePlan(text string) []PlanStep {
+	steps := make([]PlanStep, 0)
+	for _, line := range strings.Split(text, "\n") {
+		m := planLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		steps = append(steps, PlanStep{Role: strings.ToLower(m[1]), Instruction: strings.TrimSpace(m[2])})
+	}
+	return steps
+}
+
+type OrchestrationResult struct {
+	Output string
+	Plan   []PlanStep
+	Usage  map[string]BudgetUsage
+	Memory []MemoryEntry
+	Trace  []TraceEvent
+}
+
+// Orchestrator 先由planner拆解任务，再把每个步骤路由给对应角色的子agent，
+// 子agent通过共享记忆读取前序产出，所有交互记录在同一条轨迹中
+type Orchestrator struct {
+	Agents map[string]*SubAgent
+	Memory *SharedMemory
+	Trace  *Trace
+}
+
+func NewOrchestrator(agents ...*SubAgent) *Orchestrator {
+	o := &Orchestrator{Agents: make(map[string]*SubAgent), Memory: NewSharedMemory(), Trace: &Trace{}}
+	for _, agent := range agents {
+		o.Agents[agent.Role] = agent
+	}
+	return o
+}
+
+// Run 执行一次编排。预算超出或子agent出错时返回已完成部分的结果和错误
+func (o *Orchestrator) Run(ctx context.Context, task string) (*OrchestrationResult, error) {
+	for _, agent := range o.Agents {
+		agent.usage = BudgetUsage{}
+	}
+	result := &OrchestrationResult{}
+	o.Memory.Put("user", "task", task)
+
+	err := o.run(ctx, task, result)
+
+	result.Usage = make(map[string]BudgetUsage, len(o.Agents))
+	for _, agent := range o.Agents {
+		result.Usage[agent.Name] = agent.Usage()
+	}
+	result.Memory = o.Memory.Entries()
+	result.Trace = o.Trace.Events()
+	return result, err
+}
+
+func (o *Orchestrator) run(ctx context.Context, task string, result *OrchestrationResult) error {
+	if planner, ok := o.Agents[RolePlanner]; ok {
+		output, err := planner.Run(ctx, task, o.Memory, o.Trace)
+		if err != nil {
+			return err
+		}
+		result.Plan = ParsePlan(output)
+		o.Memory.Put(planner.Name, "plan", output)
+		trace := make([]string, 0, len(result.Plan))
+		for _, step := range result.Plan {
+			trace = append(trace, step.Role)
+		}
+		o.Trace.add(planner.Name, TracePlan, strings.Join(trace, " -> "), 0)
+	}
+	if len(result.Plan) == 0 {
+		result.Plan = []PlanStep{{Role: RoleExecutor, Instruction: task}}
+	}
+
+	for i, step := range result.Plan {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		agent, ok := o.Agents[step.Role]
+		if !ok {
+			err := fmt.Errorf("no agent for role %s", step.Role)
+			o.Trace.add("orchestrator", TraceError, err.Error(), 0)
+			return err
+		}
+		o.Trace.add(agent.Name, TraceStep, fmt.Sprintf("step %d: %s", i+1, step.Instruction), 0)
+		output, err := agent.Run(ctx, step.Instruction, o.Memory, o.Trace)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("step%d.%s", i+1, step.Role)
+		o.Memory.Put(agent.Name, key, output)
+		o.Trace.add(agent.Name, TraceMemory, key, 0)
+		result.Output = output
+	}
+	return nil
+}
+
+// UsageSummary 按agent名称排序输出资源使用情况
+func (r *OrchestrationResult) UsageSummary() string {
+	names := make([]string, 0, len(r.Usage))
+	for name := range r.Usage {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		u := r.Usage[name]
+		sb.WriteString(fmt.Sprintf("%s: %d tokens, %d model calls, %d tool calls\n", name, u.Tokens, u.ModelCalls, u.ToolCalls))
+	}
+	return sb.String()
+}
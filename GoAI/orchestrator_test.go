@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// scriptedModel 按顺序返回预设回复，并记录收到的消息
+type scriptedModel struct {
+	replies []ModelReply
+	calls   [][]ModelMessage
+}
+
+func (m *scriptedModel) Complete(_ context.Context, messages []ModelMessage, _ []mcp.Tool) (ModelReply, error) {
+	m.calls = append(m.calls, messages)
+	if len(m.calls) > len(m.replies) {
+		return ModelReply{}, errors.New("no more scripted replies")
+	}
+	return m.replies[len(m.calls)-1], nil
+}
+
+type fakeTools struct {
+	calls []string
+}
+
+func (f *fakeTools) GetTool() []mcp.Tool {
+	return []mcp.Tool{{Name: "write_file"}}
+}
+
+func (f *fakeTools) CallTool(name string, args any) (string, error) {
+	f.calls = append(f.calls, name+" "+args.(string))
+	return "ok", nil
+}
+
+func TestParsePlan(t *testing.T) {
+	steps := ParsePlan("计划如下：\n1. [researcher] goroutine 是什么\n- executor: 写入 notes.md\n[Executor] 通知用户")
+	if len(steps) != 3 {
+		t.Fatalf("expected 3 steps, got %+v", steps)
+	}
+	if steps[0].Role != RoleResearcher || steps[0].Instruction != "goroutine 是什么" {
+		t.Fatalf("unexpected first step: %+v", steps[0])
+	}
+	if steps[1].Role != RoleExecutor || steps[2].Role != RoleExecutor {
+		t.Fatalf("unexpected roles: %+v", steps)
+	}
+}
+
+func TestOrchestratorCollaboration(t *testing.T) {
+	ctx := context.Background()
+	kb := NewKnowledgeBaseManager(NewHashEmbedder(128), 100)
+	kb.CreateKB("golang")
+	kb.UpsertDocument(ctx, "golang", "chan", "Channels connect goroutines in Go.")
+
+	planner := &scriptedModel{replies: []ModelReply{{Content: "[researcher] what connects goroutines\n[executor] write the answer to notes.md", Tokens: 10}}}
+	researcher := &scriptedModel{replies: []ModelReply{{Content: "Channels connect goroutines.", Tokens: 20}}}
+	executor := &scriptedModel{replies: []ModelReply{
+		{ToolCalls: []ModelToolCall{{ID: "c1", Name: "write_file", Arguments: `{"path":"notes.md"}`}}, Tokens: 15},
+		{Content: "notes.md written", Tokens: 5},
+	}}
+	tools := &fakeTools{}
+
+	o := NewOrchestrator(
+		NewPlanner(planner, Budget{}),
+		NewResearcher(researcher, kb, Budget{}, "golang"),
+		NewExecutor(executor, []ToolProvider{tools}, Budget{}),
+	)
+	result, err := o.Run(ctx, "find out what connects goroutines and save it")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Output != "notes.md written" || len(result.Plan) != 2 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(tools.calls) != 1 || !strings.Contains(tools.calls[0], "notes.md") {
+		t.Fatalf("unexpected tool calls: %v", tools.calls)
+	}
+
+	// researcher 拿到了知识库内容，executor 通过共享记忆看到了 researcher 的结论
+	if !strings.Contains(researcher.calls[0][1].Content, "Channels connect goroutines in Go.") {
+		t.Fatalf("researcher prompt missing rag context: %s", researcher.calls[0][1].Content)
+	}
+	if !strings.Contains(executor.calls[0][1].Content, "step1.researcher") {
+		t.Fatalf("executor prompt missing shared memory: %s", executor.calls[0][1].Content)
+	}
+	if last := executor.calls[1]; last[len(last)-1].Role != "tool" || last[len(last)-1].ToolCallID != "c1" {
+		t.Fatalf("tool result not fed back: %+v", last)
+	}
+	if v, ok := o.Memory.Get("step2.executor"); !ok || v != "notes.md written" {
+		t.Fatalf("executor output not in memory: %q", v)
+	}
+
+	if u := result.Usage[RoleExecutor]; u.Tokens != 20 || u.ModelCalls != 2 || u.ToolCalls != 1 {
+		t.Fatalf("unexpected executor usage: %+v", u)
+	}
+	kinds := make([]string, 0)
+	for _, e := range result.Trace {
+		kinds = append(kinds, e.Agent+":"+e.Kind)
+	}
+	joined := strings.Join(kinds, " ")
+	if !strings.HasPrefix(joined, "planner:model planner:plan researcher:step researcher:search researcher:model researcher:memory executor:step") {
+		t.Fatalf("unexpected trace: %s", joined)
+	}
+	if !strings.Contains(o.Trace.String(), "write_file") {
+		t.Fatalf("trace missing tool call:\n%s", o.Trace.String())
+	}
+}
+
+func TestOrchestratorBudget(t *testing.T) {
+	executor := &scriptedModel{replies: []ModelReply{
+		{ToolCalls: []ModelToolCall{{ID: "c1", Name: "write_file", Arguments: "{}"}}, Tokens: 30},
+		{ToolCalls: []ModelToolCall{{ID: "c2", Name: "write_file", Arguments: "{}"}}, Tokens: 30},
+		{Content: "done", Tokens: 30},
+	}}
+	tools := &fakeTools{}
+	o := NewOrchestrator(NewExecutor(executor, []ToolProvider{tools}, Budget{MaxTokens: 50}))
+
+	result, err := o.Run(context.Background(), "write files")
+	if !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("expected budget error, got %v", err)
+	}
+	if len(tools.calls) != 1 {
+		t.Fatalf("executor should stop after exceeding budget, tool calls: %v", tools.calls)
+	}
+	if result.Usage[RoleExecutor].Tokens != 60 {
+		t.Fatalf("unexpected usage: %+v", result.Usage)
+	}
+	last := result.Trace[len(result.Trace)-1]
+	if last.Kind != TraceError || !strings.Contains(last.Detail, "tokens") {
+		t.Fatalf("budget error not traced: %+v", last)
+	}
+}
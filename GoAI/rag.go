@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// OpenAIEmbedder 使用OpenAI embeddings接口
+type OpenAIEmbedder struct {
+	Client openai.Client
+	Model  string
+}
+
+func NewOpenAIEmbedder(model string) *OpenAIEmbedder {
+	if model == "" {
+		model = openai.EmbeddingModelTextEmbedding3Small
+	}
+	options := []option.RequestOption{
+		option.WithAPIKey(os.Getenv(ChatGPTOpenAPIKEY)),
+	}
+	if baseURL := os.Getenv(ChatGPTBaseURL); baseURL != "" {
+		options = append(options, option.WithBaseURL(baseURL))
+	}
+	return &OpenAIEmbedder{
+		Client: openai.NewClient(options...),
+		Model:  model,
+	}
+}
+
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	resp, err := e.Client.Embeddings.New(ctx, openai.EmbeddingNewParams{
+		Input: openai.EmbeddingNewParamsInputUnion{OfArrayOfStrings: texts},
+		Model: e.Model,
+	})
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([][]float64, len(texts))
+	for _, item := range resp.Data {
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// HashEmbedder 本地词袋哈希向量，不依赖外部服务，适合离线和测试
+type HashEmbedder struct {
+	Dim int
+}
+
+func NewHashEmbedder(dim int) *HashEmbedder {
+	if dim <= 0 {
+		dim = 256
+	}
+	return &HashEmbedder{Dim: dim}
+}
+
+func (e *HashEmbedder) Embed(_ context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vec := make([]float64, e.Dim)
+		for _, token := range tokenize(text) {
+			h := fnv.New32a()
+			h.Write([]byte(token))
+			vec[int(h.Sum32())%e.Dim]++
+		}
+		vectors[i] = normalize(vec)
+	}
+	return vectors, nil
+}
+
+// tokenize 英文按单词切分，中文按单字切分
+func tokenize(text string) []string {
+	tokens := make([]string, 0)
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, strings.ToLower(word.String()))
+			word.Reset()
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+func normalize(vec []float64) []float64 {
+	norm := 0.0
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return vec
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	dot, na, nb := 0.0, 0.0, 0.0
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// SplitChunks 按段落切分文本，超过size个字符的段落再按长度切分
+func SplitChunks(text string, size int) []string {
+	if size <= 0 {
+		size = 500
+	}
+	chunks := make([]string, 0)
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		runes := []rune(para)
+		for start := 0; start < len(runes); start += size {
+			end := start + size
+			if end > len(runes) {
+				end = len(runes)
+			}
+			chunks = append(chunks, string(runes[start:end]))
+		}
+	}
+	return chunks
+}
+
+type SearchResult struct {
+	KB      string
+	DocID   string
+	Version int
+	Chunk   string
+	Score   float64
+}
+
+// BuildRAGContext 将检索结果拼接为可传给 WithRagContext 的上下文
+func BuildRAGContext(results []SearchResult) string {
+	if len(results) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("以下是与问题相关的知识库内容，请参考回答：\n")
+	for i, r := range results {
+		sb.WriteString(fmt.Sprintf("[%d] (%s/%s v%d) %s\n", i+1, r.KB, r.DocID, r.Version, r.Chunk))
+	}
+	return sb.String()
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+)
+
+var ErrNoRouteAvailable = errors.New("no model route available")
+
+// 路由失败原因
+const (
+	RouteFailError   = "error"
+	RouteFailTimeout = "timeout"
+	RouteFailQuota   = "quota"
+	RouteSkipOpen    = "unhealthy"
+)
+
+// ModelRoute 路由表中的一个(provider, model)，按在路由表中的顺序作为主用和备用
+type ModelRoute struct {
+	Provider string
+	Model    string
+	Client   ChatModel
+
+	Timeout     time.Duration // 单次调用超时，0表示只受调用方ctx限制
+	TokenQuota  int           // QuotaWindow内可用的token数，0表示不限制
+	QuotaWindow time.Duration // 额度重置周期，0表示不重置
+}
+
+func (r *ModelRoute) Name() string {
+	return r.Provider + "/" + r.Model
+}
+
+// NewProviderChatModel 创建指向任意OpenAI兼容服务的ChatModel，用于在路由表中配置不同的provider
+func NewProviderChatModel(baseURL, apiKey, model string) *OpenAIChatModel {
+	options := []option.RequestOption{option.WithAPIKey(apiKey)}
+	if baseURL != "" {
+		options = append(options, option.WithBaseURL(baseURL))
+	}
+	return &OpenAIChatModel{Client: openai.NewClient(options...), Model: model}
+}
+
+// RouteAttempt 一次调用中被跳过或失败的路由
+type RouteAttempt struct {
+	Route  string
+	Reason string
+	Error  string
+}
+
+// RouteHealth 路由的健康状态
+type RouteHealth struct {
+	Route               string
+	Healthy             bool
+	ConsecutiveFailures int
+	OpenUntil           time.Time
+	TokensUsed          int
+	LastError           string
+}
+
+type routeState struct {
+	failures    int
+	openUntil   time.Time
+	tokens      int
+	windowStart time.Time
+	lastError   string
+}
+
+// ModelRouter 按顺序尝试路由表中的模型：主用失败、超时或额度耗尽时自动切换到下一个，
+// 连续失败达到阈值的路由在冷却期内被跳过。ModelRouter 本身实现 ChatModel，可直接交给子agent
+type ModelRouter struct {
+	Routes           []*ModelRoute
+	FailureThreshold int           // 连续失败多少次后暂停使用该路由，默认3
+	Cooldown         time.Duration // 暂停时长，默认30秒
+
+	states map[*ModelRoute]*routeState
+	mu     sync.Mutex
+	now    func() time.Time
+}
+
+func NewModelRouter(routes ...*ModelRoute) *ModelRouter {
+	return &ModelRouter{
+		Routes:           routes,
+		FailureThreshold: 3,
+		Cooldown:         30 * time.Second,
+		states:           make(map[*ModelRoute]*routeState),
+		now:              time.Now,
+	}
+}
+
+func (r *ModelRouter) state(route *ModelRoute) *routeState {
+	s, ok := r.states[route]
+	if !ok {
+		s = &routeState{windowStart: r.now()}
+		r.states[route] = s
+	}
+	return s
+}
+
+// available 判断路由当前能否使用，不能使用时返回原因
+func (r *ModelRouter) available(route *ModelRoute) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, now := r.state(route), r.now()
+	if route.QuotaWindow > 0 && now.Sub(s.windowStart) >= route.QuotaWindow {
+		s.tokens, s.windowStart = 0, now
+	}
+	if now.Before(s.openUntil) {
+		return RouteSkipOpen, false
+	}
+	if route.TokenQuota > 0 && s.tokens >= route.TokenQuota {
+		return RouteFailQuota, false
+	}
+	return "", true
+}
+
+func (r *ModelRouter) recordSuccess(route *ModelRoute, tokens int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.state(route)
+	s.failures = 0
+	s.tokens += tokens
+}
+
+func (r *ModelRouter) recordFailure(route *ModelRoute, reason string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.state(route)
+	s.lastError = err.Error()
+	if reason == RouteFailQuota {
+		// provider额度耗尽，直接冷却，不必等连续失败
+		s.openUntil = r.now().Add(r.Cooldown)
+		return
+	}
+	s.failures++
+	if s.failures >= r.FailureThreshold {
+		s.openUntil = r.now().Add(r.Cooldown)
+	}
+}
+
+// classifyRouteError 区分超时、额度耗尽(HTTP 429或insufficient_quota)和其他错误
+func classifyRouteError(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return RouteFailTimeout
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.Code == "insufficient_quota") {
+		return RouteFailQuota
+	}
+	if strings.Contains(err.Error(), "insufficient_quota") {
+		return RouteFailQuota
+	}
+	return RouteFailError
+}
+
+func (r *ModelRouter) Complete(ctx context.Context, messages []ModelMessage, tools []mcp.Tool) (ModelReply, error) {
+	var attempts []RouteAttempt
+	var lastErr error
+
+	for _, route := range r.Routes {
+		if reason, ok := r.available(route); !ok {
+			attempts = append(attempts, RouteAttempt{Route: route.Name(), Reason: reason})
+			continue
+		}
+
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if route.Timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, route.Timeout)
+		}
+		reply, err := route.Client.Complete(callCtx, messages, tools)
+		cancel()
+
+		if err == nil {
+			r.recordSuccess(route, reply.Tokens)
+			reply.Route = route.Name()
+			reply.Fallbacks = attempts
+			return reply, nil
+		}
+		// 调用方取消或超时不是路由的问题，不再尝试备用路由
+		if ctx.Err() != nil {
+			return ModelReply{Fallbacks: attempts}, ctx.Err()
+		}
+
+		reason := classifyRouteError(err)
+		r.recordFailure(route, reason, err)
+		attempts = append(attempts, RouteAttempt{Route: route.Name(), Reason: reason, Error: err.Error()})
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		return ModelReply{Fallbacks: attempts}, fmt.Errorf("%w: all %d routes skipped", ErrNoRouteAvailable, len(r.Routes))
+	}
+	return ModelReply{Fallbacks: attempts}, fmt.Errorf("%w: last error: %v", ErrNoRouteAvailable, lastErr)
+}
+
+// Health 按路由表顺序返回各路由的健康状态
+func (r *ModelRouter) Health() []RouteHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	result := make([]RouteHealth, 0, len(r.Routes))
+	for _, route := range r.Routes {
+		s := r.state(route)
+		result = append(result, RouteHealth{
+			Route:               route.Name(),
+			Healthy:             !now.Before(s.openUntil) && (route.TokenQuota == 0 || s.tokens < route.TokenQuota),
+			ConsecutiveFailures: s.failures,
+			OpenUntil:           s.openUntil,
+			TokensUsed:          s.tokens,
+			LastError:           s.lastError,
+		})
+	}
+	return result
+}
+
+// describeFallbacks 把被跳过或失败的路由格式化为轨迹信息
+func describeFallbacks(attempts []RouteAttempt) string {
+	parts := make([]string, 0, len(attempts))
+	for _, a := range attempts {
+		if a.Error != "" {
+			parts = append(parts, fmt.Sprintf("%s %s (%s)", a.Route, a.Reason, a.Error))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %s", a.Route, a.Reason))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
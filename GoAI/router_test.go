@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// flakyModel 返回预设错误，err为nil时正常回复；delay模拟慢响应
+type flakyModel struct {
+	err   error
+	delay time.Duration
+	reply ModelReply
+	calls int
+}
+
+func (m *flakyModel) Complete(ctx context.Context, _ []ModelMessage, _ []mcp.Tool) (ModelReply, error) {
+	m.calls++
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return ModelReply{}, ctx.Err()
+		}
+	}
+	if m.err != nil {
+		return ModelReply{}, m.err
+	}
+	return m.reply, nil
+}
+
+func TestModelRouterFallback(t *testing.T) {
+	primary := &flakyModel{err: errors.New("503 service unavailable")}
+	slow := &flakyModel{delay: time.Second}
+	backup := &flakyModel{reply: ModelReply{Content: "ok", Tokens: 7}}
+
+	router := NewModelRouter(
+		&ModelRoute{Provider: "openai", Model: "gpt-4o", Client: primary},
+		&ModelRoute{Provider: "azure", Model: "gpt-4o", Client: slow, Timeout: 10 * time.Millisecond},
+		&ModelRoute{Provider: "local", Model: "qwen", Client: backup},
+	)
+	router.FailureThreshold = 2
+
+	reply, err := router.Complete(context.Background(), nil, nil)
+	if err != nil || reply.Content != "ok" || reply.Route != "local/qwen" {
+		t.Fatalf("expected fallback to local/qwen, got %+v %v", reply, err)
+	}
+	if len(reply.Fallbacks) != 2 || reply.Fallbacks[0].Reason != RouteFailError || reply.Fallbacks[1].Reason != RouteFailTimeout {
+		t.Fatalf("unexpected fallbacks: %+v", reply.Fallbacks)
+	}
+
+	// 连续失败达到阈值后主用路由在冷却期内被跳过，不再调用
+	router.Complete(context.Background(), nil, nil)
+	reply, _ = router.Complete(context.Background(), nil, nil)
+	if primary.calls != 2 || reply.Fallbacks[0].Reason != RouteSkipOpen {
+		t.Fatalf("expected primary to be skipped after 2 failures, calls=%d fallbacks=%+v", primary.calls, reply.Fallbacks)
+	}
+	health := router.Health()
+	if health[0].Healthy || health[0].ConsecutiveFailures != 2 || !health[2].Healthy || health[2].TokensUsed != 21 {
+		t.Fatalf("unexpected health: %+v", health)
+	}
+
+	// 冷却期过后主用路由恢复，成功一次即清零失败计数
+	base := time.Now()
+	router.now = func() time.Time { return base.Add(time.Minute) }
+	primary.err = nil
+	primary.reply = ModelReply{Content: "primary"}
+	reply, _ = router.Complete(context.Background(), nil, nil)
+	if reply.Route != "openai/gpt-4o" || router.Health()[0].ConsecutiveFailures != 0 {
+		t.Fatalf("expected primary to recover, got %+v", reply)
+	}
+}
+
+func TestModelRouterQuota(t *testing.T) {
+	primary := &flakyModel{reply: ModelReply{Content: "primary", Tokens: 60}}
+	backup := &flakyModel{reply: ModelReply{Content: "backup", Tokens: 1}}
+	now := time.Now()
+
+	router := NewModelRouter(
+		&ModelRoute{Provider: "openai", Model: "gpt-4o", Client: primary, TokenQuota: 100, QuotaWindow: time.Hour},
+		&ModelRoute{Provider: "local", Model: "qwen", Client: backup},
+	)
+	router.now = func() time.Time { return now }
+
+	router.Complete(context.Background(), nil, nil)
+	router.Complete(context.Background(), nil, nil)
+	reply, _ := router.Complete(context.Background(), nil, nil)
+	if reply.Route != "local/qwen" || reply.Fallbacks[0].Reason != RouteFailQuota {
+		t.Fatalf("expected quota fallback, got %+v", reply)
+	}
+
+	// 额度窗口重置后回到主用路由
+	now = now.Add(time.Hour)
+	reply, _ = router.Complete(context.Background(), nil, nil)
+	if reply.Route != "openai/gpt-4o" {
+		t.Fatalf("expected primary after quota window reset, got %s", reply.Route)
+	}
+
+	// provider返回额度耗尽时立即冷却
+	primary.err = errors.New(`429 Too Many Requests {"code": "insufficient_quota"}`)
+	reply, _ = router.Complete(context.Background(), nil, nil)
+	if reply.Fallbacks[0].Reason != RouteFailQuota || router.Health()[0].Healthy {
+		t.Fatalf("expected provider quota error to open the route, got %+v", reply.Fallbacks)
+	}
+
+	backup.err = errors.New("down")
+	if _, err := router.Complete(context.Background(), nil, nil); !errors.Is(err, ErrNoRouteAvailable) {
+		t.Fatalf("expected ErrNoRouteAvailable, got %v", err)
+	}
+}
+
+func TestModelRouterInTrace(t *testing.T) {
+	router := NewModelRouter(
+		&ModelRoute{Provider: "openai", Model: "gpt-4o", Client: &flakyModel{err: errors.New("boom")}},
+		&ModelRoute{Provider: "local", Model: "qwen", Client: &flakyModel{reply: ModelReply{Content: "done", Tokens: 3}}},
+	)
+	o := NewOrchestrator(NewExecutor(router, nil, Budget{}))
+	result, err := o.Run(context.Background(), "say done")
+	if err != nil || result.Output != "done" {
+		t.Fatalf("unexpected result: %+v %v", result, err)
+	}
+
+	var route, model string
+	for _, e := range result.Trace {
+		switch e.Kind {
+		case TraceRoute:
+			route = e.Detail
+		case TraceModel:
+			model = e.Detail
+		}
+	}
+	if !strings.Contains(route, "openai/gpt-4o error (boom)") || !strings.Contains(model, "via local/qwen") {
+		t.Fatalf("route not recorded in trace: route=%q model=%q", route, model)
+	}
+}
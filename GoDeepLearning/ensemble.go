@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// CombineMethod 集成预测的合并方式
+type CombineMethod int
+
+const (
+	CombineMean     CombineMethod = iota // 各成员输出取平均
+	CombineWeighted                      // 按成员权重加权平均
+	CombineVote                          // 分类多数投票，每个成员投给自己输出最大的类别
+)
+
+// Ensemble 由多个训练好的网络组成的集成模型
+type Ensemble struct {
+	Members []*NeuralNetwork
+	Weights []float64
+	Method  CombineMethod
+}
+
+// NewEnsemble 创建集成模型
+func NewEnsemble(method CombineMethod, members ...*NeuralNetwork) *Ensemble {
+	return &Ensemble{Members: members, Method: method}
+}
+
+// AddMember 添加成员及其权重，权重只在CombineWeighted和CombineVote下使用
+func (e *Ensemble) AddMember(network *NeuralNetwork, weight float64) {
+	e.Members = append(e.Members, network)
+	for len(e.Weights) < len(e.Members)-1 {
+		e.Weights = append(e.Weights, 1)
+	}
+	e.Weights = append(e.Weights, weight)
+}
+
+// weight 第i个成员的权重，未设置时为1
+func (e *Ensemble) weight(i int) float64 {
+	if i < len(e.Weights) {
+		return e.Weights[i]
+	}
+	return 1
+}
+
+// ForwardAll 并行计算每个成员的输出；各成员的层保存各自的前向状态，互不干扰
+func (e *Ensemble) ForwardAll(input *Tensor) []*Tensor {
+	outputs := make([]*Tensor, len(e.Members))
+	var wg sync.WaitGroup
+	for i, member := range e.Members {
+		wg.Add(1)
+		go func(i int, member *NeuralNetwork) {
+			defer wg.Done()
+			outputs[i] = member.Forward(input)
+		}(i, member)
+	}
+	wg.Wait()
+	return outputs
+}
+
+// Predict 按合并方式组合成员输出。CombineVote返回按行的one-hot投票结果（平票取较小类别）
+func (e *Ensemble) Predict(input *Tensor) (*Tensor, error) {
+	if len(e.Members) == 0 {
+		return nil, fmt.Errorf("集成模型没有成员")
+	}
+
+	outputs := e.ForwardAll(input)
+	shape := outputs[0].Shape
+	for i, output := range outputs[1:] {
+		if len(output.Data) != len(outputs[0].Data) {
+			return nil, fmt.Errorf("成员%d的输出形状%v与成员0的%v不一致", i+1, output.Shape, shape)
+		}
+	}
+
+	switch e.Method {
+	case CombineVote:
+		return e.vote(outputs), nil
+	case CombineWeighted:
+		return e.average(outputs, e.weight)
+	default:
+		return e.average(outputs, func(int) float64 { return 1 })
+	}
+}
+
+// average 加权平均
+func (e *Ensemble) average(outputs []*Tensor, weight func(int) float64) (*Tensor, error) {
+	total := 0.0
+	result := make([]float64, len(outputs[0].Data))
+	for i, output := range outputs {
+		w := weight(i)
+		total += w
+		for j, v := range output.Data {
+			result[j] += w * v
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("成员权重之和为0")
+	}
+	for j := range result {
+		result[j] /= total
+	}
+	return NewTensor(result, append([]int(nil), outputs[0].Shape...)), nil
+}
+
+// vote 按行多数投票
+func (e *Ensemble) vote(outputs []*Tensor) *Tensor {
+	rows, cols := 1, len(outputs[0].Data)
+	if len(outputs[0].Shape) == 2 {
+		rows, cols = outputs[0].Shape[0], outputs[0].Shape[1]
+	}
+
+	result := make([]float64, rows*cols)
+	for r := 0; r < rows; r++ {
+		votes := make([]float64, cols)
+		for i, output := range outputs {
+			votes[argmax(output.Data[r*cols:(r+1)*cols])] += e.weight(i)
+		}
+		result[r*cols+argmax(votes)] = 1
+	}
+	return NewTensor(result, append([]int(nil), outputs[0].Shape...))
+}
+
+// PredictClass 返回每行的预测类别下标
+func (e *Ensemble) PredictClass(input *Tensor) ([]int, error) {
+	prediction, err := e.Predict(input)
+	if err != nil {
+		return nil, err
+	}
+	rows, cols := 1, len(prediction.Data)
+	if len(prediction.Shape) == 2 {
+		rows, cols = prediction.Shape[0], prediction.Shape[1]
+	}
+
+	classes := make([]int, rows)
+	for r := range classes {
+		classes[r] = argmax(prediction.Data[r*cols : (r+1)*cols])
+	}
+	return classes, nil
+}
+
+// argmax 最大值下标，相同时取较小下标
+func argmax(values []float64) int {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// constantNetwork 输出固定为bias的单层网络
+func constantNetwork(bias ...float64) *NeuralNetwork {
+	network := NewNeuralNetwork()
+	layer := NewLinear(2, len(bias))
+	for i := range layer.Weight.Data {
+		layer.Weight.Data[i] = 0
+	}
+	copy(layer.Bias.Data, bias)
+	network.AddLayer(layer)
+	return network
+}
+
+var ensembleInput = NewTensor([]float64{1, 2}, []int{1, 2})
+
+func TestEnsembleMean(t *testing.T) {
+	ensemble := NewEnsemble(CombineMean, constantNetwork(1), constantNetwork(2), constantNetwork(6))
+	prediction, err := ensemble.Predict(ensembleInput)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if math.Abs(prediction.Data[0]-3) > 1e-9 {
+		t.Errorf("期望平均值3，实际%v", prediction.Data[0])
+	}
+}
+
+func TestEnsembleWeighted(t *testing.T) {
+	ensemble := NewEnsemble(CombineWeighted)
+	ensemble.AddMember(constantNetwork(1), 3)
+	ensemble.AddMember(constantNetwork(5), 1)
+
+	prediction, err := ensemble.Predict(ensembleInput)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if math.Abs(prediction.Data[0]-2) > 1e-9 {
+		t.Errorf("期望加权平均2，实际%v", prediction.Data[0])
+	}
+}
+
+func TestEnsembleVote(t *testing.T) {
+	ensemble := NewEnsemble(CombineVote,
+		constantNetwork(0.9, 0.1, 0),
+		constantNetwork(0.2, 0.7, 0.1),
+		constantNetwork(0.1, 0.6, 0.3),
+	)
+
+	classes, err := ensemble.PredictClass(ensembleInput)
+	if err != nil {
+		t.Fatalf("预测失败: %v", err)
+	}
+	if classes[0] != 1 {
+		t.Errorf("期望多数投票结果为类别1，实际%d", classes[0])
+	}
+
+	// 加权后第一个成员的票数超过其余两个
+	ensemble.Weights = []float64{3, 1, 1}
+	classes, _ = ensemble.PredictClass(ensembleInput)
+	if classes[0] != 0 {
+		t.Errorf("期望加权投票结果为类别0，实际%d", classes[0])
+	}
+}
+
+func TestEnsembleErrors(t *testing.T) {
+	if _, err := NewEnsemble(CombineMean).Predict(ensembleInput); err == nil {
+		t.Error("没有成员时应返回错误")
+	}
+
+	mismatched := NewEnsemble(CombineMean, constantNetwork(1), constantNetwork(1, 2))
+	if _, err := mismatched.Predict(ensembleInput); err == nil {
+		t.Error("成员输出形状不一致时应返回错误")
+	}
+}
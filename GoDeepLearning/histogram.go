@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultHistogramBuckets 权重直方图默认的桶数
+const DefaultHistogramBuckets = 30
+
+// Histogram 一组数值的分布，Buckets[i]统计落在(Limits[i-1], Limits[i]]内的个数
+type Histogram struct {
+	Tag        string    `json:"tag"`
+	Min        float64   `json:"min"`
+	Max        float64   `json:"max"`
+	Num        float64   `json:"num"`
+	Sum        float64   `json:"sum"`
+	SumSquares float64   `json:"sum_squares"`
+	Limits     []float64 `json:"limits"`
+	Buckets    []float64 `json:"buckets"`
+}
+
+// HistogramLogger 能记录直方图的Logger，Trainer在每个epoch结束时写出各层权重分布
+type HistogramLogger interface {
+	Histograms(step int, histograms []Histogram)
+}
+
+// NewHistogram 按等宽桶统计values的分布
+func NewHistogram(tag string, values []float64, buckets int) Histogram {
+	h := Histogram{Tag: tag, Num: float64(len(values))}
+	if len(values) == 0 || buckets <= 0 {
+		return h
+	}
+
+	h.Min, h.Max = math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		h.Min = math.Min(h.Min, v)
+		h.Max = math.Max(h.Max, v)
+		h.Sum += v
+		h.SumSquares += v * v
+	}
+
+	width := (h.Max - h.Min) / float64(buckets)
+	if width == 0 {
+		h.Limits = []float64{h.Max}
+		h.Buckets = []float64{h.Num}
+		return h
+	}
+
+	h.Limits = make([]float64, buckets)
+	h.Buckets = make([]float64, buckets)
+	for i := range h.Limits {
+		h.Limits[i] = h.Min + width*float64(i+1)
+	}
+	h.Limits[buckets-1] = h.Max
+	for _, v := range values {
+		i := int((v - h.Min) / width)
+		if i >= buckets {
+			i = buckets - 1
+		}
+		h.Buckets[i]++
+	}
+	return h
+}
+
+// NetworkHistograms 统计网络中每个参数张量的分布，标签形如 layer0/weight
+func NetworkHistograms(network *NeuralNetwork, buckets int) []Histogram {
+	var histograms []Histogram
+	for i, layer := range network.Layers {
+		linear, ok := layer.(*Linear)
+		if !ok {
+			continue
+		}
+		weight, bias := linear.weightData()
+		histograms = append(histograms,
+			NewHistogram(fmt.Sprintf("layer%d/weight", i), weight, buckets),
+			NewHistogram(fmt.Sprintf("layer%d/bias", i), bias, buckets),
+		)
+	}
+	return histograms
+}
+
+// GradientNorm 所有参数梯度的整体L2范数
+func GradientNorm(params []*Tensor) float64 {
+	sum := 0.0
+	for _, param := range params {
+		for _, g := range param.Grad {
+			sum += g * g
+		}
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TrainingEvent 一个epoch结束时的训练指标
+type TrainingEvent struct {
+	Epoch        int                `json:"epoch"` // 从1开始
+	Loss         float64            `json:"loss"`
+	LearningRate float64            `json:"lr,omitempty"`
+	Metrics      map[string]float64 `json:"metrics,omitempty"`
+}
+
+// Logger 训练过程日志接口
+type Logger interface {
+	Message(msg string)
+	Epoch(event TrainingEvent)
+	Close() error
+}
+
+// ConsoleLogger 以文本形式输出，每Interval个epoch打印一次损失
+type ConsoleLogger struct {
+	Out      io.Writer
+	Interval int
+}
+
+// NewConsoleLogger 创建控制台日志
+func NewConsoleLogger(out io.Writer, interval int) *ConsoleLogger {
+	if interval <= 0 {
+		interval = 1
+	}
+	return &ConsoleLogger{Out: out, Interval: interval}
+}
+
+// Message 输出文本信息
+func (l *ConsoleLogger) Message(msg string) {
+	fmt.Fprintln(l.Out, msg)
+}
+
+// Epoch 输出epoch损失
+func (l *ConsoleLogger) Epoch(event TrainingEvent) {
+	if event.Epoch%l.Interval == 0 {
+		fmt.Fprintf(l.Out, "Epoch %d, Loss: %.6f\n", event.Epoch, event.Loss)
+	}
+}
+
+// Close 关闭日志
+func (l *ConsoleLogger) Close() error {
+	return nil
+}
+
+// JSONLogger 结构化日志，每行一个JSON对象
+type JSONLogger struct {
+	encoder *json.Encoder
+	now     func() time.Time
+}
+
+// NewJSONLogger 创建结构化日志
+func NewJSONLogger(out io.Writer) *JSONLogger {
+	return &JSONLogger{encoder: json.NewEncoder(out), now: time.Now}
+}
+
+// Message 输出文本信息
+func (l *JSONLogger) Message(msg string) {
+	l.encoder.Encode(map[string]interface{}{
+		"time": l.now().Format(time.RFC3339Nano),
+		"msg":  msg,
+	})
+}
+
+// Epoch 输出epoch指标
+func (l *JSONLogger) Epoch(event TrainingEvent) {
+	l.encoder.Encode(struct {
+		Time string `json:"time"`
+		Msg  string `json:"msg"`
+		TrainingEvent
+	}{l.now().Format(time.RFC3339Nano), "epoch", event})
+}
+
+// Close 关闭日志
+func (l *JSONLogger) Close() error {
+	return nil
+}
+
+// scalars 将epoch指标展开为(tag, value)对，顺序固定
+func (e TrainingEvent) scalars() ([]string, []float64) {
+	tags := []string{"loss"}
+	values := []float64{e.Loss}
+	if e.LearningRate != 0 {
+		tags = append(tags, "lr")
+		values = append(values, e.LearningRate)
+	}
+	for _, name := range sortedKeys(e.Metrics) {
+		tags = append(tags, name)
+		values = append(values, e.Metrics[name])
+	}
+	return tags, values
+}
+
+// CSVLogger 以step,tag,value格式写出标量，可直接导入表格或绘图工具
+type CSVLogger struct {
+	file   *os.File
+	writer *csv.Writer
+	mutex  sync.Mutex
+}
+
+// NewCSVLogger 创建CSV日志文件
+func NewCSVLogger(path string) (*CSVLogger, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &CSVLogger{file: file, writer: csv.NewWriter(file)}
+	l.writer.Write([]string{"step", "tag", "value"})
+	return l, nil
+}
+
+// Message CSV只记录标量，忽略文本信息
+func (l *CSVLogger) Message(msg string) {}
+
+// Epoch 写出epoch指标
+func (l *CSVLogger) Epoch(event TrainingEvent) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	tags, values := event.scalars()
+	for i, tag := range tags {
+		l.writer.Write([]string{
+			strconv.Itoa(event.Epoch),
+			tag,
+			strconv.FormatFloat(values[i], 'g', -1, 64),
+		})
+	}
+	l.writer.Flush()
+}
+
+// Close 刷新并关闭文件
+func (l *CSVLogger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.writer.Flush()
+	if err := l.writer.Error(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// MultiLogger 将日志同时写到多个Logger
+type MultiLogger []Logger
+
+// Message 输出文本信息
+func (m MultiLogger) Message(msg string) {
+	for _, l := range m {
+		l.Message(msg)
+	}
+}
+
+// Epoch 输出epoch指标
+func (m MultiLogger) Epoch(event TrainingEvent) {
+	for _, l := range m {
+		l.Epoch(event)
+	}
+}
+
+// Histograms 转发给支持直方图的Logger
+func (m MultiLogger) Histograms(step int, histograms []Histogram) {
+	for _, l := range m {
+		if h, ok := l.(HistogramLogger); ok {
+			h.Histograms(step, histograms)
+		}
+	}
+}
+
+// Close 关闭所有Logger，返回第一个错误
+func (m MultiLogger) Close() error {
+	var first error
+	for _, l := range m {
+		if err := l.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// sortedKeys 返回按字典序排列的键
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// epochEvent 汇总一个epoch的训练指标
+func (t *Trainer) epochEvent(epoch int, loss, penalty float64) TrainingEvent {
+	event := TrainingEvent{Epoch: epoch, Loss: loss, Metrics: make(map[string]float64)}
+	if provider, ok := t.Optimizer.(learningRateProvider); ok {
+		event.LearningRate = provider.GetLearningRate()
+	}
+	if t.Regularizer != nil && t.Regularizer.Mode == PenaltyInLoss {
+		event.Metrics["penalty"] = penalty
+	}
+	if t.Pruning != nil {
+		event.Metrics["sparsity"] = NetworkSparsity(t.Network)
+	}
+	if t.steps > 0 {
+		event.Metrics["grad_norm"] = t.gradNormSum / float64(t.steps)
+		t.gradNormSum, t.steps = 0, 0
+	}
+	return event
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingLogger 记录收到的epoch事件
+type recordingLogger struct {
+	messages []string
+	events   []TrainingEvent
+}
+
+func (l *recordingLogger) Message(msg string)        { l.messages = append(l.messages, msg) }
+func (l *recordingLogger) Epoch(event TrainingEvent) { l.events = append(l.events, event) }
+func (l *recordingLogger) Close() error              { return nil }
+
+func loggingTrainer(logger Logger) *Trainer {
+	config := Config{Seed: 5}
+	rng := config.NewRand()
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinearRand(2, 4, rng))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinearRand(4, 1, rng))
+
+	trainer := NewTrainerWithConfig(network, NewSGD(0.05), 5, config)
+	trainer.Logger = logger
+	return trainer
+}
+
+var loggingInputs = []*Tensor{NewTensor([]float64{1, 0}, []int{1, 2})}
+var loggingTargets = []*Tensor{NewTensor([]float64{1}, []int{1, 1})}
+
+func TestTrainerLogger(t *testing.T) {
+	recorder := &recordingLogger{}
+	var buf bytes.Buffer
+	trainer := loggingTrainer(MultiLogger{recorder, NewJSONLogger(&buf)})
+	trainer.Train(loggingInputs, loggingTargets)
+
+	if len(recorder.events) != 5 || len(recorder.messages) != 2 {
+		t.Fatalf("期望5个epoch事件和2条消息，实际%d和%d", len(recorder.events), len(recorder.messages))
+	}
+	for i, event := range recorder.events {
+		if event.Epoch != i+1 || event.Loss != trainer.Losses[i] || event.LearningRate != 0.05 {
+			t.Errorf("第%d个事件不正确: %+v", i, event)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("期望7行JSON日志，实际%d行", len(lines))
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("JSON日志格式错误: %v", err)
+	}
+	if entry["msg"] != "epoch" || entry["epoch"] != float64(1) || entry["lr"] != 0.05 {
+		t.Errorf("JSON日志字段不正确: %v", entry)
+	}
+}
+
+func TestCSVLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "train.csv")
+	logger, err := NewCSVLogger(path)
+	if err != nil {
+		t.Fatalf("创建CSV日志失败: %v", err)
+	}
+	logger.Epoch(TrainingEvent{Epoch: 1, Loss: 0.5, LearningRate: 0.1, Metrics: map[string]float64{"sparsity": 0.2}})
+	if err := logger.Close(); err != nil {
+		t.Fatalf("关闭CSV日志失败: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	expected := "step,tag,value\n1,loss,0.5\n1,lr,0.1\n1,sparsity,0.2\n"
+	if string(data) != expected {
+		t.Errorf("期望\n%s实际\n%s", expected, data)
+	}
+}
+
+// readRecords 解析TFRecord文件并校验CRC
+func readRecords(t *testing.T, data []byte) [][]byte {
+	var records [][]byte
+	for len(data) > 0 {
+		length := binary.LittleEndian.Uint64(data[:8])
+		if binary.LittleEndian.Uint32(data[8:12]) != maskedCRC(data[:8]) {
+			t.Fatal("长度校验失败")
+		}
+		record := data[12 : 12+length]
+		if binary.LittleEndian.Uint32(data[12+length:16+length]) != maskedCRC(record) {
+			t.Fatal("数据校验失败")
+		}
+		records = append(records, record)
+		data = data[16+length:]
+	}
+	return records
+}
+
+func TestTensorBoardLogger(t *testing.T) {
+	logger, err := NewTensorBoardLogger(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建事件文件失败: %v", err)
+	}
+	trainer := loggingTrainer(logger)
+	trainer.Train(loggingInputs, loggingTargets)
+	if err := logger.Close(); err != nil {
+		t.Fatalf("关闭事件文件失败: %v", err)
+	}
+
+	if !strings.HasPrefix(filepath.Base(logger.Path()), "events.out.tfevents.") {
+		t.Errorf("事件文件名不符合TensorBoard约定: %s", logger.Path())
+	}
+
+	data, _ := os.ReadFile(logger.Path())
+	records := readRecords(t, data)
+	// 文件版本 + 每个epoch的loss、lr、grad_norm三个标量和两层权重、偏置的四个直方图
+	if len(records) != 1+5*(3+4) {
+		t.Fatalf("期望36条记录，实际%d条", len(records))
+	}
+	if !bytes.Contains(records[0], []byte("brain.Event:2")) {
+		t.Error("第一条记录应声明文件版本")
+	}
+	if !bytes.Contains(records[1], []byte("loss")) || !bytes.Contains(records[2], []byte("lr")) ||
+		!bytes.Contains(records[3], []byte("grad_norm")) {
+		t.Error("标量记录应包含loss、lr和grad_norm标签")
+	}
+	if !bytes.Contains(records[4], []byte("layer0/weight")) || !bytes.Contains(records[7], []byte("layer2/bias")) {
+		t.Error("直方图记录应包含各层参数标签")
+	}
+}
+
+func TestTrainingViewer(t *testing.T) {
+	viewer := NewTrainingViewer()
+	trainer := loggingTrainer(MultiLogger{viewer})
+	trainer.Train(loggingInputs, loggingTargets)
+
+	rec := httptest.NewRecorder()
+	viewer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/scalars", nil))
+	var scalars struct {
+		Scalars map[string][]ScalarPoint `json:"scalars"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &scalars)
+	for _, tag := range []string{"loss", "lr", "grad_norm"} {
+		if len(scalars.Scalars[tag]) != 5 {
+			t.Errorf("期望%s有5个点，实际%d", tag, len(scalars.Scalars[tag]))
+		}
+	}
+	if scalars.Scalars["grad_norm"][0].Value <= 0 {
+		t.Error("梯度范数应大于0")
+	}
+
+	rec = httptest.NewRecorder()
+	viewer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/histograms", nil))
+	var histograms struct {
+		Step       int         `json:"step"`
+		Histograms []Histogram `json:"histograms"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &histograms)
+	if histograms.Step != 5 || len(histograms.Histograms) != 4 {
+		t.Errorf("期望第5个epoch的4个直方图，实际%d个（epoch %d）", len(histograms.Histograms), histograms.Step)
+	}
+
+	rec = httptest.NewRecorder()
+	viewer.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), "<canvas") {
+		t.Error("首页应包含可视化页面")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("w", []float64{0, 1, 2, 3, 4}, 4)
+	if h.Min != 0 || h.Max != 4 || h.Num != 5 || h.Sum != 10 || h.SumSquares != 30 {
+		t.Errorf("统计量不正确: %+v", h)
+	}
+	expected := []float64{1, 1, 1, 2}
+	for i := range expected {
+		if h.Buckets[i] != expected[i] {
+			t.Errorf("期望桶计数%v，实际%v", expected, h.Buckets)
+			break
+		}
+	}
+
+	constant := NewHistogram("c", []float64{2, 2}, 4)
+	if len(constant.Buckets) != 1 || constant.Buckets[0] != 2 {
+		t.Errorf("常数值应落在单个桶中: %+v", constant)
+	}
+}
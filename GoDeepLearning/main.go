@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"os"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type Tensor struct {
 	Shape  []int
 	Grad   []float64
 	RequiresGrad bool
+	Mask   []float64 // 剪枝掩码，0表示该位置已被剪掉；nil表示稠密
 }
 
 // NewTensor 创建新张量
@@ -106,16 +108,29 @@ type Linear struct {
 	Weight *Tensor
 	Bias   *Tensor
 	Input  *Tensor
+
+	// float32精度下的参数，非nil时Weight/Bias只保留形状
+	Weight32 *Tensor32
+	Bias32   *Tensor32
+
+	// 稀疏推理时的CSR权重和偏置副本，非nil时前向传播跳过为0的权重
+	Sparse     *CSRMatrix
+	sparseBias []float64
 }
 
 // NewLinear 创建全连接层
 func NewLinear(inFeatures, outFeatures int) *Linear {
+	return newLinear(inFeatures, outFeatures, rand.NormFloat64)
+}
+
+// newLinear 使用给定的正态分布采样函数初始化全连接层
+func newLinear(inFeatures, outFeatures int, normFloat64 func() float64) *Linear {
 	// Xavier初始化
 	scale := math.Sqrt(2.0 / float64(inFeatures))
 
 	weightData := make([]float64, inFeatures*outFeatures)
 	for i := range weightData {
-		weightData[i] = rand.NormFloat64() * scale
+		weightData[i] = normFloat64() * scale
 	}
 
 	biasData := make([]float64, outFeatures)
@@ -132,12 +147,30 @@ func NewLinear(inFeatures, outFeatures int) *Linear {
 // Forward 前向传播
 func (l *Linear) Forward(input *Tensor) *Tensor {
 	l.Input = input
-	// y = x * W + b
-	return input.MatMul(l.Weight).Add(l.Bias)
+	if l.Sparse != nil {
+		return l.forwardSparse(input)
+	}
+	if l.Weight32 != nil {
+		return l.forward32(input)
+	}
+
+	// y = x * W + b，偏置按行广播以支持批量输入
+	output := input.MatMul(l.Weight)
+	cols := output.Shape[1]
+	for i := range output.Data {
+		output.Data[i] += l.Bias.Data[i%cols]
+	}
+	return output
 }
 
-// Backward 反向传播
+// Backward 反向传播，float32精度的层先切换回float64再计算梯度。
+// 参数即将更新，稀疏权重副本随之失效并被释放
 func (l *Linear) Backward(grad *Tensor) *Tensor {
+	if l.Weight32 != nil {
+		l.setPrecision(Float64)
+	}
+	l.Sparse, l.sparseBias = nil, nil
+
 	// dL/dx = dL/dy * W^T
 	weightT := transpose(l.Weight)
 	dx := grad.MatMul(weightT)
@@ -242,8 +275,10 @@ func (m *MSELoss) Backward(pred, target *Tensor) *Tensor {
 
 // NeuralNetwork 神经网络
 type NeuralNetwork struct {
-	Layers []Layer
-	Loss   *MSELoss
+	Layers          []Layer
+	Loss            *MSELoss
+	Precision       Precision
+	SparseInference bool // 是否使用CSR稀疏权重进行前向传播
 }
 
 // NewNeuralNetwork 创建神经网络
@@ -268,8 +303,15 @@ func (nn *NeuralNetwork) Forward(input *Tensor) *Tensor {
 	return output
 }
 
-// Backward 反向传播
+// Backward 反向传播，float32精度的网络先切换回float64，稀疏推理自动关闭
 func (nn *NeuralNetwork) Backward(pred, target *Tensor) {
+	if nn.Precision != Float64 {
+		nn.SetPrecision(Float64)
+	}
+	if nn.SparseInference {
+		nn.DisableSparseInference()
+	}
+
 	// 计算损失梯度
 	lossGrad := nn.Loss.Backward(pred, target)
 
@@ -319,6 +361,18 @@ type Trainer struct {
 	Network  *NeuralNetwork
 	Optimizer Optimizer
 	Epochs   int
+	Pruning  *PruningSchedule // 渐进式剪枝计划，nil表示不剪枝
+	Regularizer *Regularizer  // L1/L2正则化，nil表示不正则化
+	Logger   Logger           // 训练日志，默认每10个epoch输出到控制台
+	BatchSize int             // 每个mini-batch的样本数，0表示整个epoch更新一次
+	Config   Config
+	Losses   []float64 // 每个epoch的平均损失
+
+	rng *rand.Rand
+
+	// 当前epoch内各优化步骤梯度L2范数之和及步数
+	gradNormSum float64
+	steps       int
 }
 
 // NewTrainer 创建训练器
@@ -327,17 +381,40 @@ func NewTrainer(network *NeuralNetwork, optimizer Optimizer, epochs int) *Traine
 		Network:  network,
 		Optimizer: optimizer,
 		Epochs:   epochs,
+		Logger:   NewConsoleLogger(os.Stdout, 10),
 	}
 }
 
 // Train 训练网络
 func (t *Trainer) Train(inputs, targets []*Tensor) {
-	fmt.Printf("开始训练 %d 个epoch\n", t.Epochs)
+	logger := t.Logger
+	if logger == nil {
+		logger = NewConsoleLogger(os.Stdout, 10)
+	}
+	logger.Message(fmt.Sprintf("开始训练 %d 个epoch", t.Epochs))
+
+	// float32模型以float64主权重训练，结束后恢复原精度
+	if precision := t.Network.Precision; precision != Float64 {
+		t.Network.SetPrecision(Float64)
+		defer t.Network.SetPrecision(precision)
+	}
+	// 稀疏推理的权重副本在训练中失效，结束后按训练后的参数重新构建
+	if t.Network.SparseInference {
+		t.Network.DisableSparseInference()
+		defer t.Network.EnableSparseInference()
+	}
+
+	t.Network.SetTraining(true)
+	defer t.Network.SetTraining(false)
 
 	for epoch := 0; epoch < t.Epochs; epoch++ {
 		totalLoss := 0.0
+		penalty := 0.0
+
+		order := t.sampleOrder(len(inputs))
+		for n, i := range order {
+			input := inputs[i]
 
-		for i, input := range inputs {
 			// 前向传播
 			pred := t.Network.Forward(input)
 
@@ -347,17 +424,48 @@ func (t *Trainer) Train(inputs, targets []*Tensor) {
 
 			// 反向传播
 			t.Network.Backward(pred, targets[i])
+
+			// 每个mini-batch结束时更新参数
+			if n == len(order)-1 || (t.BatchSize > 0 && (n+1)%t.BatchSize == 0) {
+				penalty += t.step()
+			}
 		}
 
-		// 优化步骤
-		t.Optimizer.Step(t.Network.GetParameters())
+		if t.Pruning != nil {
+			t.Pruning.Apply(t.Network, epoch)
+		}
 
-		if (epoch+1)%10 == 0 {
-			fmt.Printf("Epoch %d, Loss: %.6f\n", epoch+1, totalLoss/float64(len(inputs)))
+		avgLoss := (totalLoss + penalty) / float64(len(inputs))
+		t.Losses = append(t.Losses, avgLoss)
+		logger.Epoch(t.epochEvent(epoch+1, avgLoss, penalty))
+		if histograms, ok := logger.(HistogramLogger); ok {
+			histograms.Histograms(epoch+1, NetworkHistograms(t.Network, DefaultHistogramBuckets))
 		}
 	}
 
-	fmt.Println("训练完成")
+	logger.Message("训练完成")
+}
+
+// step 执行一次优化步骤，返回计入损失的正则惩罚项（每个mini-batch一次，与梯度累加方式一致）
+func (t *Trainer) step() float64 {
+	penalty := 0.0
+	if t.Regularizer != nil {
+		penalty = t.Regularizer.beforeStep(t.Network)
+	}
+
+	params := t.Network.GetParameters()
+	t.gradNormSum += GradientNorm(params)
+	t.steps++
+	t.Optimizer.Step(params)
+	if t.Regularizer != nil {
+		t.Regularizer.afterStep(t.Network, t.Optimizer)
+	}
+
+	// 稀疏感知训练：被剪掉的权重保持为0
+	for _, param := range params {
+		param.ApplyMask()
+	}
+	return penalty
 }
 
 // Predict 预测
@@ -384,19 +492,22 @@ func transpose(tensor *Tensor) *Tensor {
 }
 
 func main() {
-	rand.Seed(time.Now().UnixNano())
+	// 所有随机性都来自同一个种子，固定Seed即可复现训练过程
+	config := Config{Seed: time.Now().UnixNano(), Shuffle: true}
+	rng := config.NewRand()
+	fmt.Printf("随机种子: %d\n", config.Seed)
 
 	// 创建神经网络
 	network := NewNeuralNetwork()
-	network.AddLayer(NewLinear(2, 4))  // 输入2维，隐藏层4维
-	network.AddLayer(NewReLU())        // ReLU激活函数
-	network.AddLayer(NewLinear(4, 1))  // 输出1维
+	network.AddLayer(NewLinearRand(2, 4, rng)) // 输入2维，隐藏层4维
+	network.AddLayer(NewReLU())                // ReLU激活函数
+	network.AddLayer(NewLinearRand(4, 1, rng)) // 输出1维
 
 	// 创建优化器
 	optimizer := NewSGD(0.01)
 
 	// 创建训练器
-	trainer := NewTrainer(network, optimizer, 100)
+	trainer := NewTrainerWithConfig(network, optimizer, 100, config)
 
 	// 生成训练数据 (XOR问题)
 	inputs := []*Tensor{
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// savedLayer 模型文件中的单层
+type savedLayer struct {
+	Type   string    `json:"type"`
+	In     int       `json:"in,omitempty"`
+	Out    int       `json:"out,omitempty"`
+	Weight []float64 `json:"weight,omitempty"`
+	Bias   []float64 `json:"bias,omitempty"`
+	Mask   []float64 `json:"mask,omitempty"`
+}
+
+// savedModel 模型文件格式
+type savedModel struct {
+	Precision string       `json:"precision,omitempty"`
+	Layers    []savedLayer `json:"layers"`
+}
+
+// SaveModel 将网络结构和参数保存为JSON文件
+func SaveModel(network *NeuralNetwork, path string) error {
+	model := savedModel{
+		Precision: network.Precision.String(),
+		Layers:    make([]savedLayer, 0, len(network.Layers)),
+	}
+
+	for _, layer := range network.Layers {
+		switch l := layer.(type) {
+		case *Linear:
+			weight, bias := l.weightData()
+			model.Layers = append(model.Layers, savedLayer{
+				Type:   "linear",
+				In:     l.Weight.Shape[0],
+				Out:    l.Weight.Shape[1],
+				Weight: weight,
+				Bias:   bias,
+				Mask:   l.Weight.Mask,
+			})
+		case *ReLU:
+			model.Layers = append(model.Layers, savedLayer{Type: "relu"})
+		default:
+			return fmt.Errorf("不支持保存的层类型: %T", layer)
+		}
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadModel 从JSON文件加载网络
+func LoadModel(path string) (*NeuralNetwork, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var model savedModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, fmt.Errorf("解析模型文件失败: %v", err)
+	}
+
+	network := NewNeuralNetwork()
+	for i, saved := range model.Layers {
+		switch saved.Type {
+		case "linear":
+			if len(saved.Weight) != saved.In*saved.Out || len(saved.Bias) != saved.Out {
+				return nil, fmt.Errorf("第%d层参数维度不匹配", i)
+			}
+			weight := NewTensor(saved.Weight, []int{saved.In, saved.Out})
+			weight.Mask = saved.Mask
+			network.AddLayer(&Linear{
+				Weight: weight,
+				Bias:   NewTensor(saved.Bias, []int{saved.Out}),
+			})
+		case "relu":
+			network.AddLayer(NewReLU())
+		default:
+			return nil, fmt.Errorf("第%d层类型未知: %s", i, saved.Type)
+		}
+	}
+
+	if model.Precision == Float32.String() {
+		network.SetPrecision(Float32)
+	}
+
+	return network, nil
+}
+
+// InputDim 网络输入维度，即第一个全连接层的输入维度；没有全连接层时返回0
+func (nn *NeuralNetwork) InputDim() int {
+	for _, layer := range nn.Layers {
+		if linear, ok := layer.(*Linear); ok {
+			return linear.Weight.Shape[0]
+		}
+	}
+	return 0
+}
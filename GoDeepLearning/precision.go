@@ -0,0 +1,148 @@
+package main
+
+// Precision 参数存储精度
+type Precision int
+
+const (
+	Float64 Precision = iota
+	Float32
+)
+
+func (p Precision) String() string {
+	if p == Float32 {
+		return "float32"
+	}
+	return "float64"
+}
+
+// Tensor32 float32存储的张量，内存占用是Tensor的一半
+type Tensor32 struct {
+	Data  []float32
+	Shape []int
+}
+
+// NewTensor32 创建float32张量
+func NewTensor32(data []float32, shape []int) *Tensor32 {
+	return &Tensor32{Data: data, Shape: shape}
+}
+
+// ToFloat32 将float64张量转换为float32张量
+func ToFloat32(t *Tensor) *Tensor32 {
+	data := make([]float32, len(t.Data))
+	for i, v := range t.Data {
+		data[i] = float32(v)
+	}
+	return NewTensor32(data, append([]int(nil), t.Shape...))
+}
+
+// ToFloat64 将float32张量转换为float64张量
+func (t *Tensor32) ToFloat64() *Tensor {
+	data := make([]float64, len(t.Data))
+	for i, v := range t.Data {
+		data[i] = float64(v)
+	}
+	return NewTensor(data, append([]int(nil), t.Shape...))
+}
+
+// MatMul float32矩阵乘法，按i-k-j顺序遍历以顺序访问内存
+func (t *Tensor32) MatMul(other *Tensor32) *Tensor32 {
+	if len(t.Shape) != 2 || len(other.Shape) != 2 {
+		panic("矩阵乘法需要二维张量")
+	}
+	if t.Shape[1] != other.Shape[0] {
+		panic("矩阵维度不匹配")
+	}
+
+	rows := t.Shape[0]
+	cols := other.Shape[1]
+	inner := t.Shape[1]
+
+	result := make([]float32, rows*cols)
+	for i := 0; i < rows; i++ {
+		out := result[i*cols : (i+1)*cols]
+		for k := 0; k < inner; k++ {
+			a := t.Data[i*inner+k]
+			if a == 0 {
+				continue
+			}
+			row := other.Data[k*cols : (k+1)*cols]
+			for j, b := range row {
+				out[j] += a * b
+			}
+		}
+	}
+
+	return NewTensor32(result, []int{rows, cols})
+}
+
+// setPrecision 切换全连接层参数的存储精度，float32模式下释放float64参数和梯度
+func (l *Linear) setPrecision(p Precision) {
+	switch p {
+	case Float32:
+		if l.Weight32 != nil {
+			return
+		}
+		l.Weight32 = ToFloat32(l.Weight)
+		l.Bias32 = ToFloat32(l.Bias)
+		l.Weight.Data, l.Weight.Grad = nil, nil
+		l.Bias.Data, l.Bias.Grad = nil, nil
+	case Float64:
+		if l.Weight32 == nil {
+			return
+		}
+		weight := l.Weight32.ToFloat64()
+		bias := l.Bias32.ToFloat64()
+		l.Weight.Data, l.Weight.Grad = weight.Data, weight.Grad
+		l.Bias.Data, l.Bias.Grad = bias.Data, bias.Grad
+		l.Weight32, l.Bias32 = nil, nil
+	}
+	if l.Sparse != nil {
+		l.buildSparse()
+	}
+}
+
+// forward32 float32精度的前向传播，输入输出仍为float64张量
+func (l *Linear) forward32(input *Tensor) *Tensor {
+	output := ToFloat32(input).MatMul(l.Weight32)
+	cols := output.Shape[1]
+	for i := range output.Data {
+		output.Data[i] += l.Bias32.Data[i%cols]
+	}
+	return output.ToFloat64()
+}
+
+// weightData 以float64返回权重和偏置，不修改层的存储精度
+func (l *Linear) weightData() ([]float64, []float64) {
+	if l.Weight32 != nil {
+		return l.Weight32.ToFloat64().Data, l.Bias32.ToFloat64().Data
+	}
+	return l.Weight.Data, l.Bias.Data
+}
+
+// SetPrecision 切换整个网络的参数存储精度。float32只用于推理：反向传播时网络（或单独调用
+// Linear.Backward的层）会自动切换回float64，Trainer在训练期间临时切换并在结束后恢复原精度
+func (nn *NeuralNetwork) SetPrecision(p Precision) {
+	for _, layer := range nn.Layers {
+		if linear, ok := layer.(*Linear); ok {
+			linear.setPrecision(p)
+		}
+	}
+	nn.Precision = p
+}
+
+// ParameterBytes 网络参数占用的字节数（不含梯度）
+func ParameterBytes(network *NeuralNetwork) int {
+	total := 0
+	for _, layer := range network.Layers {
+		linear, ok := layer.(*Linear)
+		if !ok {
+			continue
+		}
+		if linear.Weight32 != nil {
+			total += 4 * (len(linear.Weight32.Data) + len(linear.Bias32.Data))
+		} else {
+			total += 8 * (len(linear.Weight.Data) + len(linear.Bias.Data))
+		}
+	}
+	return total
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestTensor32MatMul(t *testing.T) {
+	a := NewTensor([]float64{1, 2, 3, 4}, []int{2, 2})
+	b := NewTensor([]float64{5, 6, 7, 8}, []int{2, 2})
+
+	result := ToFloat32(a).MatMul(ToFloat32(b)).ToFloat64()
+	expected := a.MatMul(b)
+	for i := range expected.Data {
+		if result.Data[i] != expected.Data[i] {
+			t.Errorf("期望%v，实际%v", expected.Data, result.Data)
+			break
+		}
+	}
+}
+
+func TestNetworkPrecision(t *testing.T) {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(4, 8))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinear(8, 1))
+
+	input := NewTensor([]float64{0.1, 0.2, 0.3, 0.4}, []int{1, 4})
+	expected := network.Forward(input).Data[0]
+	bytes64 := ParameterBytes(network)
+
+	network.SetPrecision(Float32)
+	if ParameterBytes(network)*2 != bytes64 {
+		t.Errorf("float32参数内存应减半，float64=%d float32=%d", bytes64, ParameterBytes(network))
+	}
+	actual := network.Forward(input).Data[0]
+	if math.Abs(actual-expected) > 1e-5 {
+		t.Errorf("float32预测偏差过大，期望%v，实际%v", expected, actual)
+	}
+
+	// 保存加载保留精度
+	path := filepath.Join(t.TempDir(), "model32.json")
+	if err := SaveModel(network, path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadModel(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Precision != Float32 {
+		t.Errorf("加载后精度应为float32，实际%v", loaded.Precision)
+	}
+
+	network.SetPrecision(Float64)
+	if ParameterBytes(network) != bytes64 {
+		t.Error("切换回float64后参数内存不正确")
+	}
+}
+
+func TestTrainFloat32Network(t *testing.T) {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(1, 1))
+	network.SetPrecision(Float32)
+
+	trainer := NewTrainer(network, NewSGD(0.01), 5)
+	trainer.Train(
+		[]*Tensor{NewTensor([]float64{1}, []int{1, 1})},
+		[]*Tensor{NewTensor([]float64{2}, []int{1, 1})},
+	)
+
+	if network.Precision != Float32 {
+		t.Error("训练结束后应恢复float32精度")
+	}
+}
+
+func TestBackwardFloat32Network(t *testing.T) {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(2, 3))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinear(3, 1))
+	network.SetPrecision(Float32)
+
+	input := NewTensor([]float64{0.5, -0.5}, []int{1, 2})
+	pred := network.Forward(input)
+	network.Backward(pred, NewTensor([]float64{1}, []int{1, 1}))
+	if network.Precision != Float64 {
+		t.Error("反向传播后网络应切换回float64")
+	}
+
+	layer := NewLinear(2, 1)
+	layer.setPrecision(Float32)
+	layer.Forward(input)
+	layer.Backward(NewTensor([]float64{1}, []int{1, 1}))
+	if layer.Weight32 != nil || layer.Weight.Grad[0] != 0.5 {
+		t.Errorf("单独反向传播float32层应切换回float64并计算梯度，实际梯度%v", layer.Weight.Grad)
+	}
+}
+
+// benchmarkMatrices 基准测试用的两个size×size随机矩阵
+func benchmarkMatrices(size int) (*Tensor, *Tensor) {
+	rng := rand.New(rand.NewSource(1))
+	a := make([]float64, size*size)
+	b := make([]float64, size*size)
+	for i := range a {
+		a[i] = rng.NormFloat64()
+		b[i] = rng.NormFloat64()
+	}
+	return NewTensor(a, []int{size, size}), NewTensor(b, []int{size, size})
+}
+
+func BenchmarkMatMul64(b *testing.B) {
+	x, y := benchmarkMatrices(128)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.MatMul(y)
+	}
+}
+
+func BenchmarkMatMul32(b *testing.B) {
+	x, y := benchmarkMatrices(128)
+	x32, y32 := ToFloat32(x), ToFloat32(y)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x32.MatMul(y32)
+	}
+}
+
+func BenchmarkForward(b *testing.B) {
+	for _, precision := range []Precision{Float64, Float32} {
+		b.Run(precision.String(), func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			network := NewNeuralNetwork()
+			network.AddLayer(NewLinearRand(256, 256, rng))
+			network.AddLayer(NewReLU())
+			network.AddLayer(NewLinearRand(256, 10, rng))
+			network.SetPrecision(precision)
+			input, _ := benchmarkMatrices(256)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				network.Forward(input)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// ApplyMask 将被剪枝的位置置零，Mask为nil时为稠密张量
+func (t *Tensor) ApplyMask() {
+	if t.Mask == nil {
+		return
+	}
+	for i := range t.Data {
+		t.Data[i] *= t.Mask[i]
+		t.Grad[i] *= t.Mask[i]
+	}
+}
+
+// Sparsity 张量中被剪枝（值为0的掩码位）所占比例
+func (t *Tensor) Sparsity() float64 {
+	if t.Mask == nil || len(t.Mask) == 0 {
+		return 0
+	}
+	pruned := 0
+	for _, m := range t.Mask {
+		if m == 0 {
+			pruned++
+		}
+	}
+	return float64(pruned) / float64(len(t.Mask))
+}
+
+// MagnitudePruner 按权重绝对值大小剪枝
+type MagnitudePruner struct{}
+
+// NewMagnitudePruner 创建幅值剪枝器
+func NewMagnitudePruner() *MagnitudePruner {
+	return &MagnitudePruner{}
+}
+
+// PruneTensor 将张量中绝对值最小的sparsity比例的元素剪掉，已剪掉的元素不会恢复
+func (p *MagnitudePruner) PruneTensor(t *Tensor, sparsity float64) {
+	if sparsity <= 0 {
+		return
+	}
+	if sparsity > 1 {
+		sparsity = 1
+	}
+
+	if t.Mask == nil {
+		t.Mask = make([]float64, len(t.Data))
+		for i := range t.Mask {
+			t.Mask[i] = 1
+		}
+	}
+
+	indices := make([]int, len(t.Data))
+	for i := range indices {
+		indices[i] = i
+	}
+	// 已剪掉的元素排在最前，其余按绝对值升序
+	sort.SliceStable(indices, func(a, b int) bool {
+		ia, ib := indices[a], indices[b]
+		if (t.Mask[ia] == 0) != (t.Mask[ib] == 0) {
+			return t.Mask[ia] == 0
+		}
+		return math.Abs(t.Data[ia]) < math.Abs(t.Data[ib])
+	})
+
+	numPruned := int(math.Round(sparsity * float64(len(t.Data))))
+	for _, idx := range indices[:numPruned] {
+		t.Mask[idx] = 0
+	}
+	t.ApplyMask()
+}
+
+// Prune 对网络中所有全连接层的权重逐层剪枝，偏置保持稠密。
+// float32精度的层临时转换为float64剪枝后再转换回来（float32值转换为float64无损），
+// 开启了稀疏推理的层按剪枝后的权重重建CSR
+func (p *MagnitudePruner) Prune(network *NeuralNetwork, sparsity float64) {
+	for _, layer := range network.Layers {
+		linear, ok := layer.(*Linear)
+		if !ok {
+			continue
+		}
+		if linear.Weight32 != nil {
+			linear.setPrecision(Float64)
+			p.PruneTensor(linear.Weight, sparsity)
+			linear.setPrecision(Float32)
+		} else {
+			p.PruneTensor(linear.Weight, sparsity)
+			if linear.Sparse != nil {
+				linear.buildSparse()
+			}
+		}
+	}
+}
+
+// NetworkSparsity 网络中全连接层权重的整体稀疏度，按权重形状计数，float32精度的层同样统计
+func NetworkSparsity(network *NeuralNetwork) float64 {
+	total, pruned := 0, 0
+	for _, layer := range network.Layers {
+		if linear, ok := layer.(*Linear); ok {
+			size := linear.Weight.Shape[0] * linear.Weight.Shape[1]
+			total += size
+			pruned += int(math.Round(linear.Weight.Sparsity() * float64(size)))
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(pruned) / float64(total)
+}
+
+// PruningSchedule 渐进式剪枝计划：稀疏度在[StartEpoch, EndEpoch]内按三次多项式从0增长到TargetSparsity
+type PruningSchedule struct {
+	Pruner         *MagnitudePruner
+	TargetSparsity float64
+	StartEpoch     int
+	EndEpoch       int
+	Frequency      int // 每隔多少个epoch剪枝一次
+}
+
+// NewPruningSchedule 创建渐进式剪枝计划
+func NewPruningSchedule(targetSparsity float64, startEpoch, endEpoch, frequency int) *PruningSchedule {
+	if frequency <= 0 {
+		frequency = 1
+	}
+	return &PruningSchedule{
+		Pruner:         NewMagnitudePruner(),
+		TargetSparsity: targetSparsity,
+		StartEpoch:     startEpoch,
+		EndEpoch:       endEpoch,
+		Frequency:      frequency,
+	}
+}
+
+// SparsityAt 第epoch个epoch（从0开始）结束时应达到的稀疏度
+func (ps *PruningSchedule) SparsityAt(epoch int) float64 {
+	if epoch < ps.StartEpoch {
+		return 0
+	}
+	if epoch >= ps.EndEpoch || ps.EndEpoch <= ps.StartEpoch {
+		return ps.TargetSparsity
+	}
+	progress := float64(epoch-ps.StartEpoch) / float64(ps.EndEpoch-ps.StartEpoch)
+	return ps.TargetSparsity * (1 - math.Pow(1-progress, 3))
+}
+
+// Apply 在epoch结束时按计划剪枝
+func (ps *PruningSchedule) Apply(network *NeuralNetwork, epoch int) {
+	if epoch < ps.StartEpoch {
+		return
+	}
+	if epoch < ps.EndEpoch && (epoch-ps.StartEpoch)%ps.Frequency != 0 {
+		return
+	}
+	ps.Pruner.Prune(network, ps.SparsityAt(epoch))
+}
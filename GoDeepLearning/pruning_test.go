@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMagnitudePruner(t *testing.T) {
+	tensor := NewTensor([]float64{0.1, -0.5, 0.05, 2.0}, []int{2, 2})
+
+	pruner := NewMagnitudePruner()
+	pruner.PruneTensor(tensor, 0.5)
+
+	expected := []float64{0, -0.5, 0, 2.0}
+	for i, v := range tensor.Data {
+		if v != expected[i] {
+			t.Errorf("期望%v，实际%v", expected, tensor.Data)
+			break
+		}
+	}
+
+	if tensor.Sparsity() != 0.5 {
+		t.Errorf("期望稀疏度0.5，实际%v", tensor.Sparsity())
+	}
+}
+
+func TestPruningSchedule(t *testing.T) {
+	schedule := NewPruningSchedule(0.8, 2, 10, 2)
+
+	if schedule.SparsityAt(0) != 0 {
+		t.Error("开始剪枝前稀疏度应为0")
+	}
+	if math.Abs(schedule.SparsityAt(10)-0.8) > 1e-9 {
+		t.Errorf("结束时稀疏度应为0.8，实际%v", schedule.SparsityAt(10))
+	}
+	if schedule.SparsityAt(4) <= schedule.SparsityAt(3) {
+		t.Error("稀疏度应随epoch单调增长")
+	}
+}
+
+func TestSparsityAwareTraining(t *testing.T) {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(2, 4))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinear(4, 1))
+
+	trainer := NewTrainer(network, NewSGD(0.01), 20)
+	trainer.Pruning = NewPruningSchedule(0.5, 0, 10, 1)
+
+	inputs := []*Tensor{
+		NewTensor([]float64{0, 1}, []int{1, 2}),
+		NewTensor([]float64{1, 0}, []int{1, 2}),
+	}
+	targets := []*Tensor{
+		NewTensor([]float64{1}, []int{1, 1}),
+		NewTensor([]float64{1}, []int{1, 1}),
+	}
+
+	trainer.Train(inputs, targets)
+
+	if math.Abs(NetworkSparsity(network)-0.5) > 1e-9 {
+		t.Errorf("期望网络稀疏度0.5，实际%v", NetworkSparsity(network))
+	}
+
+	// 被剪掉的权重在训练后仍为0
+	for _, layer := range network.Layers {
+		if linear, ok := layer.(*Linear); ok {
+			for i, m := range linear.Weight.Mask {
+				if m == 0 && linear.Weight.Data[i] != 0 {
+					t.Fatal("被剪掉的权重在训练中被更新")
+				}
+			}
+		}
+	}
+}
+
+func TestPruneFloat32Network(t *testing.T) {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(4, 4))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinear(4, 2))
+	network.SetPrecision(Float32)
+
+	NewMagnitudePruner().Prune(network, 0.5)
+
+	if network.Precision != Float32 {
+		t.Error("剪枝不应改变网络精度")
+	}
+	if math.Abs(NetworkSparsity(network)-0.5) > 1e-9 {
+		t.Errorf("期望float32网络稀疏度0.5，实际%v", NetworkSparsity(network))
+	}
+	for _, layer := range network.Layers {
+		linear, ok := layer.(*Linear)
+		if !ok {
+			continue
+		}
+		if linear.Weight32 == nil {
+			t.Fatal("剪枝后层应保持float32精度")
+		}
+		for i, m := range linear.Weight.Mask {
+			if m == 0 && linear.Weight32.Data[i] != 0 {
+				t.Fatal("被剪掉的float32权重应为0")
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import "math"
+
+// RegularizationMode 正则项的施加方式
+type RegularizationMode int
+
+const (
+	// PenaltyInLoss 将L1/L2惩罚项加入损失，其梯度在优化步骤前累加到参数梯度上
+	PenaltyInLoss RegularizationMode = iota
+	// DecoupledWeightDecay 在优化步骤之后直接按学习率衰减权重，不经过梯度（AdamW风格）
+	DecoupledWeightDecay
+)
+
+// Regularizer L1/L2正则化配置
+type Regularizer struct {
+	L1            float64
+	L2            float64
+	Mode          RegularizationMode
+	ExcludeBiases bool         // 不对偏置正则化
+	ExcludeLayers map[int]bool // 按层下标排除
+}
+
+// NewRegularizer 创建正则化器，默认不对偏置正则化
+func NewRegularizer(l1, l2 float64, mode RegularizationMode) *Regularizer {
+	return &Regularizer{
+		L1:            l1,
+		L2:            l2,
+		Mode:          mode,
+		ExcludeBiases: true,
+		ExcludeLayers: make(map[int]bool),
+	}
+}
+
+// ExcludeLayer 排除第index层的参数
+func (r *Regularizer) ExcludeLayer(index int) *Regularizer {
+	if r.ExcludeLayers == nil {
+		r.ExcludeLayers = make(map[int]bool)
+	}
+	r.ExcludeLayers[index] = true
+	return r
+}
+
+// Targets 返回需要正则化的参数
+func (r *Regularizer) Targets(network *NeuralNetwork) []*Tensor {
+	var targets []*Tensor
+	for i, layer := range network.Layers {
+		if r.ExcludeLayers[i] {
+			continue
+		}
+		if linear, ok := layer.(*Linear); ok && r.ExcludeBiases {
+			targets = append(targets, linear.Weight)
+			continue
+		}
+		targets = append(targets, layer.GetParameters()...)
+	}
+	return targets
+}
+
+// Penalty 计算惩罚项 L1*Σ|w| + L2/2*Σw²
+func (r *Regularizer) Penalty(network *NeuralNetwork) float64 {
+	penalty := 0.0
+	for _, param := range r.Targets(network) {
+		for _, w := range param.Data {
+			penalty += r.L1*math.Abs(w) + 0.5*r.L2*w*w
+		}
+	}
+	return penalty
+}
+
+// gradient 惩罚项对单个权重的梯度
+func (r *Regularizer) gradient(w float64) float64 {
+	sign := 0.0
+	if w > 0 {
+		sign = 1
+	} else if w < 0 {
+		sign = -1
+	}
+	return r.L1*sign + r.L2*w
+}
+
+// AddGradients 将惩罚项梯度累加到参数梯度，用于PenaltyInLoss模式
+func (r *Regularizer) AddGradients(network *NeuralNetwork) {
+	for _, param := range r.Targets(network) {
+		for i, w := range param.Data {
+			param.Grad[i] += r.gradient(w)
+		}
+	}
+}
+
+// Decay 按学习率直接衰减权重，用于DecoupledWeightDecay模式；L1衰减不会让权重越过0
+func (r *Regularizer) Decay(network *NeuralNetwork, learningRate float64) {
+	for _, param := range r.Targets(network) {
+		for i, w := range param.Data {
+			decayed := w - learningRate*r.gradient(w)
+			if w*decayed < 0 {
+				decayed = 0
+			}
+			param.Data[i] = decayed
+		}
+	}
+}
+
+// learningRateProvider 能报告学习率的优化器，解耦权重衰减按该学习率缩放
+type learningRateProvider interface {
+	GetLearningRate() float64
+}
+
+// GetLearningRate 返回学习率
+func (s *SGD) GetLearningRate() float64 {
+	return s.LearningRate
+}
+
+// beforeStep 在优化步骤之前施加正则化，返回计入损失的惩罚项
+func (r *Regularizer) beforeStep(network *NeuralNetwork) float64 {
+	if r.Mode != PenaltyInLoss {
+		return 0
+	}
+	r.AddGradients(network)
+	return r.Penalty(network)
+}
+
+// afterStep 在优化步骤之后施加解耦权重衰减
+func (r *Regularizer) afterStep(network *NeuralNetwork, optimizer Optimizer) {
+	if r.Mode != DecoupledWeightDecay {
+		return
+	}
+	learningRate := 1.0
+	if provider, ok := optimizer.(learningRateProvider); ok {
+		learningRate = provider.GetLearningRate()
+	}
+	r.Decay(network, learningRate)
+}
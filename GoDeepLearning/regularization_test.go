@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func regularizationNetwork() *NeuralNetwork {
+	network := NewNeuralNetwork()
+	first := NewLinear(2, 2)
+	first.Weight.Data = []float64{1, -2, 0.5, 0}
+	first.Bias.Data = []float64{3, 3}
+	second := NewLinear(2, 1)
+	second.Weight.Data = []float64{4, -4}
+	network.AddLayer(first)
+	network.AddLayer(NewReLU())
+	network.AddLayer(second)
+	return network
+}
+
+func TestRegularizerPenalty(t *testing.T) {
+	network := regularizationNetwork()
+
+	l1 := NewRegularizer(0.1, 0, PenaltyInLoss)
+	if penalty := l1.Penalty(network); math.Abs(penalty-0.1*11.5) > 1e-9 {
+		t.Errorf("L1惩罚项期望%v，实际%v", 0.1*11.5, penalty)
+	}
+
+	l2 := NewRegularizer(0, 0.1, PenaltyInLoss).ExcludeLayer(2)
+	if penalty := l2.Penalty(network); math.Abs(penalty-0.05*5.25) > 1e-9 {
+		t.Errorf("排除第2层后L2惩罚项期望%v，实际%v", 0.05*5.25, penalty)
+	}
+
+	withBias := NewRegularizer(0, 0.1, PenaltyInLoss).ExcludeLayer(2)
+	withBias.ExcludeBiases = false
+	if penalty := withBias.Penalty(network); math.Abs(penalty-0.05*23.25) > 1e-9 {
+		t.Errorf("包含偏置的L2惩罚项期望%v，实际%v", 0.05*23.25, penalty)
+	}
+}
+
+func TestRegularizerAddGradients(t *testing.T) {
+	network := regularizationNetwork()
+	NewRegularizer(0.1, 0.5, PenaltyInLoss).AddGradients(network)
+
+	first := network.Layers[0].(*Linear)
+	expected := []float64{0.6, -1.1, 0.35, 0}
+	for i, g := range first.Weight.Grad {
+		if math.Abs(g-expected[i]) > 1e-9 {
+			t.Errorf("权重梯度期望%v，实际%v", expected, first.Weight.Grad)
+			break
+		}
+	}
+	for _, g := range first.Bias.Grad {
+		if g != 0 {
+			t.Errorf("偏置不应被正则化，实际梯度%v", first.Bias.Grad)
+			break
+		}
+	}
+}
+
+func TestDecoupledWeightDecay(t *testing.T) {
+	network := regularizationNetwork()
+	optimizer := NewSGD(0.1)
+
+	NewRegularizer(0, 0.5, DecoupledWeightDecay).afterStep(network, optimizer)
+	second := network.Layers[2].(*Linear)
+	if math.Abs(second.Weight.Data[0]-3.8) > 1e-9 || math.Abs(second.Weight.Data[1]+3.8) > 1e-9 {
+		t.Errorf("权重衰减后期望[3.8 -3.8]，实际%v", second.Weight.Data)
+	}
+
+	// L1衰减不会让权重越过0
+	NewRegularizer(100, 0, DecoupledWeightDecay).afterStep(network, optimizer)
+	for _, w := range second.Weight.Data {
+		if w != 0 {
+			t.Errorf("L1衰减应截断到0，实际%v", second.Weight.Data)
+			break
+		}
+	}
+}
+
+func TestTrainWithRegularization(t *testing.T) {
+	inputs := []*Tensor{NewTensor([]float64{1, 1}, []int{1, 2})}
+	targets := []*Tensor{NewTensor([]float64{1}, []int{1, 1})}
+
+	norm := func(mode RegularizationMode, l2 float64) float64 {
+		config := Config{Seed: 3}
+		rng := config.NewRand()
+		network := NewNeuralNetwork()
+		network.AddLayer(NewLinearRand(2, 8, rng))
+		network.AddLayer(NewReLU())
+		network.AddLayer(NewLinearRand(8, 1, rng))
+
+		trainer := NewTrainerWithConfig(network, NewSGD(0.01), 50, config)
+		trainer.Regularizer = NewRegularizer(0, l2, mode)
+		trainer.Train(inputs, targets)
+		return NewRegularizer(0, 1, mode).Penalty(network)
+	}
+
+	plain := norm(PenaltyInLoss, 0)
+	if regularized := norm(PenaltyInLoss, 1); regularized >= plain {
+		t.Errorf("L2正则化应减小权重范数，无正则%v，正则%v", plain, regularized)
+	}
+	if decayed := norm(DecoupledWeightDecay, 1); decayed >= plain {
+		t.Errorf("权重衰减应减小权重范数，无正则%v，衰减%v", plain, decayed)
+	}
+}
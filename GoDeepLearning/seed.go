@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// Config 训练配置，Seed决定权重初始化、Dropout和数据打乱的全部随机性
+type Config struct {
+	Seed    int64
+	Shuffle bool // 每个epoch打乱样本顺序
+}
+
+// NewRand 根据种子创建独立的随机数生成器
+func (c Config) NewRand() *rand.Rand {
+	return rand.New(rand.NewSource(c.Seed))
+}
+
+// NewLinearRand 使用指定随机数生成器初始化全连接层
+func NewLinearRand(inFeatures, outFeatures int, rng *rand.Rand) *Linear {
+	return newLinear(inFeatures, outFeatures, rng.NormFloat64)
+}
+
+// Dropout 随机失活层，训练时以概率P将输入置零并按1/(1-P)缩放，推理时直接透传
+type Dropout struct {
+	P        float64
+	Training bool
+	rng      *rand.Rand
+	mask     []float64
+}
+
+// NewDropout 创建Dropout层
+func NewDropout(p float64, rng *rand.Rand) *Dropout {
+	return &Dropout{P: p, rng: rng}
+}
+
+// SetTraining 切换训练/推理模式
+func (d *Dropout) SetTraining(training bool) {
+	d.Training = training
+}
+
+// Forward 前向传播
+func (d *Dropout) Forward(input *Tensor) *Tensor {
+	if !d.Training || d.P <= 0 {
+		d.mask = nil
+		return input
+	}
+
+	scale := 1 / (1 - d.P)
+	d.mask = make([]float64, len(input.Data))
+	result := make([]float64, len(input.Data))
+	for i, v := range input.Data {
+		if d.rng.Float64() >= d.P {
+			d.mask[i] = scale
+			result[i] = v * scale
+		}
+	}
+	return NewTensor(result, input.Shape)
+}
+
+// Backward 反向传播
+func (d *Dropout) Backward(grad *Tensor) *Tensor {
+	if d.mask == nil {
+		return grad
+	}
+
+	result := make([]float64, len(grad.Data))
+	for i, g := range grad.Data {
+		result[i] = g * d.mask[i]
+	}
+	return NewTensor(result, grad.Shape)
+}
+
+// GetParameters 获取参数
+func (d *Dropout) GetParameters() []*Tensor {
+	return []*Tensor{}
+}
+
+// trainingModeSetter 区分训练和推理行为的层
+type trainingModeSetter interface {
+	SetTraining(training bool)
+}
+
+// SetTraining 切换网络中所有层的训练/推理模式
+func (nn *NeuralNetwork) SetTraining(training bool) {
+	for _, layer := range nn.Layers {
+		if setter, ok := layer.(trainingModeSetter); ok {
+			setter.SetTraining(training)
+		}
+	}
+}
+
+// NewTrainerWithConfig 创建使用独立随机数生成器的训练器，相同Seed的两次训练得到相同的损失
+func NewTrainerWithConfig(network *NeuralNetwork, optimizer Optimizer, epochs int, config Config) *Trainer {
+	trainer := NewTrainer(network, optimizer, epochs)
+	trainer.Config = config
+	trainer.rng = config.NewRand()
+	return trainer
+}
+
+// sampleOrder 返回本epoch的样本顺序
+func (t *Trainer) sampleOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if t.Config.Shuffle && t.rng != nil {
+		t.rng.Shuffle(n, func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+	return order
+}
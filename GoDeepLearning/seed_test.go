@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+)
+
+func seededRun(seed int64) []float64 {
+	config := Config{Seed: seed, Shuffle: true}
+	rng := config.NewRand()
+
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinearRand(2, 8, rng))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewDropout(0.2, rng))
+	network.AddLayer(NewLinearRand(8, 1, rng))
+
+	inputs := []*Tensor{
+		NewTensor([]float64{0, 0}, []int{1, 2}),
+		NewTensor([]float64{0, 1}, []int{1, 2}),
+		NewTensor([]float64{1, 0}, []int{1, 2}),
+		NewTensor([]float64{1, 1}, []int{1, 2}),
+	}
+	targets := []*Tensor{
+		NewTensor([]float64{0}, []int{1, 1}),
+		NewTensor([]float64{1}, []int{1, 1}),
+		NewTensor([]float64{1}, []int{1, 1}),
+		NewTensor([]float64{0}, []int{1, 1}),
+	}
+
+	trainer := NewTrainerWithConfig(network, NewSGD(0.05), 20, config)
+	trainer.Train(inputs, targets)
+	return trainer.Losses
+}
+
+func TestSeededTrainingReproducible(t *testing.T) {
+	first := seededRun(42)
+	second := seededRun(42)
+
+	if len(first) != 20 || len(second) != 20 {
+		t.Fatalf("期望记录20个epoch的损失，实际%d和%d", len(first), len(second))
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("相同种子的第%d个epoch损失不一致: %v != %v", i, first[i], second[i])
+		}
+	}
+
+	other := seededRun(7)
+	same := true
+	for i := range first {
+		if first[i] != other[i] {
+			same = false
+			break
+		}
+	}
+	if same {
+		t.Error("不同种子的训练损失不应完全相同")
+	}
+}
+
+func TestDropout(t *testing.T) {
+	dropout := NewDropout(0.5, Config{Seed: 1}.NewRand())
+	input := NewTensor([]float64{1, 1, 1, 1, 1, 1, 1, 1}, []int{1, 8})
+
+	if output := dropout.Forward(input); output != input {
+		t.Error("推理模式下Dropout应直接透传输入")
+	}
+
+	dropout.SetTraining(true)
+	output := dropout.Forward(input)
+	for _, v := range output.Data {
+		if v != 0 && v != 2 {
+			t.Errorf("训练模式下输出应为0或1/(1-P)，实际%v", v)
+		}
+	}
+
+	grad := dropout.Backward(NewTensor([]float64{1, 1, 1, 1, 1, 1, 1, 1}, []int{1, 8}))
+	for i := range grad.Data {
+		if grad.Data[i] != output.Data[i] {
+			t.Errorf("反向传播应使用与前向相同的掩码")
+			break
+		}
+	}
+}
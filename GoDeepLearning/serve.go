@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxPredictBodyBytes POST /predict 请求体的大小上限
+const maxPredictBodyBytes = 8 << 20
+
+var (
+	// ErrServerStopped 推理服务已停止，HTTP接口返回503
+	ErrServerStopped = errors.New("推理服务已停止")
+	// ErrInference 前向传播失败（如模型panic），HTTP接口返回500
+	ErrInference = errors.New("推理失败")
+)
+
+// ServedFeature GoFeaturePlatform导出格式中的单个特征
+type ServedFeature struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ServedFeatureSet GoFeaturePlatform导出格式中的特征集合
+type ServedFeatureSet struct {
+	UserID   string                   `json:"user_id"`
+	Features map[string]ServedFeature `json:"features"`
+}
+
+// PredictRequest POST /predict 请求体，inputs和feature_sets二选一
+type PredictRequest struct {
+	Inputs      [][]float64        `json:"inputs"`
+	FeatureSets []ServedFeatureSet `json:"feature_sets"`
+}
+
+// PredictResponse POST /predict 响应体
+type PredictResponse struct {
+	Scores    [][]float64 `json:"scores"`
+	BatchSize int         `json:"batch_size"` // 本次请求所在微批次的总行数
+	LatencyMs float64     `json:"latency_ms"`
+}
+
+// ServingStats 推理服务统计
+type ServingStats struct {
+	Requests     int     `json:"requests"`
+	Rows         int     `json:"rows"`
+	Batches      int     `json:"batches"`
+	AvgBatchSize float64 `json:"avg_batch_size"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+}
+
+// predictJob 等待微批处理的请求
+type predictJob struct {
+	rows   [][]float64
+	result chan predictResult
+}
+
+type predictResult struct {
+	scores    [][]float64
+	batchSize int
+	err       error
+}
+
+// InferenceServer 推理服务，将并发请求合并为微批次执行前向传播
+type InferenceServer struct {
+	network      *NeuralNetwork
+	inputDim     int
+	featureOrder []string
+	maxBatch     int
+	maxWait      time.Duration
+	jobs         chan *predictJob
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+	mux          *http.ServeMux
+
+	statsMutex   sync.Mutex
+	stats        ServingStats
+	totalLatency float64
+	batchedRows  int
+}
+
+// NewInferenceServer 创建推理服务，featureOrder指定特征集合展开为输入向量的顺序
+func NewInferenceServer(network *NeuralNetwork, featureOrder []string, maxBatch int, maxWait time.Duration) *InferenceServer {
+	if maxBatch <= 0 {
+		maxBatch = 32
+	}
+	s := &InferenceServer{
+		network:      network,
+		inputDim:     network.InputDim(),
+		featureOrder: featureOrder,
+		maxBatch:     maxBatch,
+		maxWait:      maxWait,
+		jobs:         make(chan *predictJob, maxBatch*4),
+		stopChan:     make(chan struct{}),
+		mux:          http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/predict", s.handlePredict)
+	s.mux.HandleFunc("/stats", s.handleStats)
+	return s
+}
+
+// NewInferenceServerFromFile 加载已保存的模型并创建推理服务
+func NewInferenceServerFromFile(path string, featureOrder []string, maxBatch int, maxWait time.Duration) (*InferenceServer, error) {
+	network, err := LoadModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewInferenceServer(network, featureOrder, maxBatch, maxWait), nil
+}
+
+// Start 启动微批处理协程
+func (s *InferenceServer) Start() {
+	s.wg.Add(1)
+	go s.batchLoop()
+}
+
+// Stop 停止微批处理协程
+func (s *InferenceServer) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// ServeHTTP 实现http.Handler接口
+func (s *InferenceServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Predict 提交一组输入并等待所在微批次完成
+func (s *InferenceServer) Predict(rows [][]float64) ([][]float64, int, error) {
+	for i, row := range rows {
+		if len(row) != s.inputDim {
+			return nil, 0, fmt.Errorf("第%d行维度为%d，期望%d", i, len(row), s.inputDim)
+		}
+	}
+
+	job := &predictJob{rows: rows, result: make(chan predictResult, 1)}
+	select {
+	case s.jobs <- job:
+	case <-s.stopChan:
+		return nil, 0, ErrServerStopped
+	}
+
+	select {
+	case result := <-job.result:
+		return result.scores, result.batchSize, result.err
+	case <-s.stopChan:
+		return nil, 0, ErrServerStopped
+	}
+}
+
+// batchLoop 收集请求直到达到maxBatch行或等待超过maxWait，然后一次性前向传播
+func (s *InferenceServer) batchLoop() {
+	defer s.wg.Done()
+
+	for {
+		var first *predictJob
+		select {
+		case first = <-s.jobs:
+		case <-s.stopChan:
+			return
+		}
+
+		batch := []*predictJob{first}
+		rows := len(first.rows)
+		timer := time.NewTimer(s.maxWait)
+	collect:
+		for rows < s.maxBatch {
+			select {
+			case job := <-s.jobs:
+				batch = append(batch, job)
+				rows += len(job.rows)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+
+		s.runBatch(batch, rows)
+	}
+}
+
+// runBatch 执行一个微批次并把结果分发回各请求。前向传播panic时批次内的请求都收到错误，
+// 微批处理协程继续运行
+func (s *InferenceServer) runBatch(batch []*predictJob, rows int) {
+	scores, err := s.forwardBatch(batch, rows)
+	for i, job := range batch {
+		if err != nil {
+			job.result <- predictResult{err: err}
+		} else {
+			job.result <- predictResult{scores: scores[i], batchSize: rows}
+		}
+	}
+
+	s.statsMutex.Lock()
+	s.stats.Batches++
+	s.batchedRows += rows
+	s.statsMutex.Unlock()
+}
+
+// forwardBatch 合并批次内的输入执行一次前向传播，按请求拆分结果，panic转换为ErrInference
+func (s *InferenceServer) forwardBatch(batch []*predictJob, rows int) (scores [][][]float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			scores, err = nil, fmt.Errorf("%w: %v", ErrInference, r)
+		}
+	}()
+
+	data := make([]float64, 0, rows*s.inputDim)
+	for _, job := range batch {
+		for _, row := range job.rows {
+			data = append(data, row...)
+		}
+	}
+
+	output := s.network.Forward(NewTensor(data, []int{rows, s.inputDim}))
+	outDim := output.Shape[len(output.Shape)-1]
+
+	scores = make([][][]float64, len(batch))
+	offset := 0
+	for j, job := range batch {
+		scores[j] = make([][]float64, len(job.rows))
+		for i := range job.rows {
+			start := (offset + i) * outDim
+			scores[j][i] = append([]float64(nil), output.Data[start:start+outDim]...)
+		}
+		offset += len(job.rows)
+	}
+	return scores, nil
+}
+
+// flatten 按featureOrder把特征集合展开为输入向量
+func (s *InferenceServer) flatten(fs ServedFeatureSet) ([]float64, error) {
+	row := make([]float64, 0, s.inputDim)
+	for _, name := range s.featureOrder {
+		feature, exists := fs.Features[name]
+		if !exists {
+			return nil, fmt.Errorf("用户 %s 缺少特征 %s", fs.UserID, name)
+		}
+		switch feature.Type {
+		case "numeric":
+			var v float64
+			if err := json.Unmarshal(feature.Value, &v); err != nil {
+				return nil, fmt.Errorf("特征 %s 不是数值: %v", name, err)
+			}
+			row = append(row, v)
+		case "vector":
+			var v []float64
+			if err := json.Unmarshal(feature.Value, &v); err != nil {
+				return nil, fmt.Errorf("特征 %s 不是向量: %v", name, err)
+			}
+			row = append(row, v...)
+		default:
+			return nil, fmt.Errorf("特征 %s 的类型 %s 无法直接作为模型输入", name, feature.Type)
+		}
+	}
+	return row, nil
+}
+
+// handlePredict 处理 POST /predict
+func (s *InferenceServer) handlePredict(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "仅支持POST")
+		return
+	}
+
+	var req PredictRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPredictBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体超过%d字节", tooLarge.Limit))
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+		return
+	}
+
+	rows := req.Inputs
+	for _, fs := range req.FeatureSets {
+		row, err := s.flatten(fs)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "请求中没有输入")
+		return
+	}
+
+	scores, batchSize, err := s.Predict(rows)
+	switch {
+	case errors.Is(err, ErrServerStopped):
+		writeJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	case errors.Is(err, ErrInference):
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	s.recordRequest(len(rows), latency)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PredictResponse{
+		Scores:    scores,
+		BatchSize: batchSize,
+		LatencyMs: latency,
+	})
+}
+
+// handleStats 处理 GET /stats
+func (s *InferenceServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Stats())
+}
+
+// recordRequest 记录请求延迟
+func (s *InferenceServer) recordRequest(rows int, latencyMs float64) {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	s.stats.Requests++
+	s.stats.Rows += rows
+	s.totalLatency += latencyMs
+	if latencyMs > s.stats.MaxLatencyMs {
+		s.stats.MaxLatencyMs = latencyMs
+	}
+}
+
+// Stats 获取服务统计
+func (s *InferenceServer) Stats() ServingStats {
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+
+	stats := s.stats
+	if stats.Batches > 0 {
+		stats.AvgBatchSize = float64(s.batchedRows) / float64(stats.Batches)
+	}
+	if stats.Requests > 0 {
+		stats.AvgLatencyMs = s.totalLatency / float64(stats.Requests)
+	}
+	return stats
+}
+
+// writeJSONError 输出错误响应
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestNetwork() *NeuralNetwork {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(2, 3))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinear(3, 1))
+	return network
+}
+
+func TestSaveAndLoadModel(t *testing.T) {
+	network := newTestNetwork()
+	path := filepath.Join(t.TempDir(), "model.json")
+
+	if err := SaveModel(network, path); err != nil {
+		t.Fatal("保存模型失败:", err)
+	}
+	loaded, err := LoadModel(path)
+	if err != nil {
+		t.Fatal("加载模型失败:", err)
+	}
+
+	input := NewTensor([]float64{0.5, -1}, []int{1, 2})
+	expected := network.Forward(input).Data[0]
+	actual := loaded.Forward(input).Data[0]
+	if math.Abs(expected-actual) > 1e-12 {
+		t.Errorf("加载后预测不一致，期望%v，实际%v", expected, actual)
+	}
+
+	os.WriteFile(path, []byte(`{"layers":[{"type":"conv"}]}`), 0644)
+	if _, err := LoadModel(path); err == nil {
+		t.Error("未知层类型应加载失败")
+	}
+}
+
+func TestBatchedPrediction(t *testing.T) {
+	network := newTestNetwork()
+	server := NewInferenceServer(network, nil, 8, 20*time.Millisecond)
+	server.Start()
+	defer server.Stop()
+
+	inputs := [][]float64{{0, 1}, {1, 0}, {1, 1}, {0.5, 0.5}}
+	results := make([][]float64, len(inputs))
+
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input []float64) {
+			defer wg.Done()
+			scores, _, err := server.Predict([][]float64{input})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results[i] = scores[0]
+		}(i, input)
+	}
+	wg.Wait()
+
+	// 微批结果与逐条前向传播一致
+	for i, input := range inputs {
+		expected := network.Forward(NewTensor(input, []int{1, 2})).Data[0]
+		if math.Abs(results[i][0]-expected) > 1e-12 {
+			t.Errorf("第%d条预测不一致，期望%v，实际%v", i, expected, results[i][0])
+		}
+	}
+
+	if stats := server.Stats(); stats.Batches >= len(inputs) {
+		t.Errorf("并发请求未被合并，批次数%d", stats.Batches)
+	}
+}
+
+func TestPredictEndpoint(t *testing.T) {
+	// 3维输入：age + 2维embedding
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(3, 1))
+	server := NewInferenceServer(network, []string{"age", "embedding"}, 4, time.Millisecond)
+	server.Start()
+	defer server.Stop()
+
+	body := []byte(`{"feature_sets":[{"user_id":"u1","features":{
+		"age":{"type":"numeric","value":28},
+		"embedding":{"type":"vector","value":[0.1,0.2]}}}]}`)
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望状态码200，实际%d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp PredictResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Scores) != 1 || len(resp.Scores[0]) != 1 {
+		t.Errorf("响应分数维度错误: %+v", resp)
+	}
+
+	// 维度错误
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewReader([]byte(`{"inputs":[[1]]}`))))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("期望状态码400，实际%d", rec.Code)
+	}
+}
+
+// panicLayer 输入第一个值为负数时panic，模拟模型内部错误
+type panicLayer struct{}
+
+func (panicLayer) Forward(input *Tensor) *Tensor {
+	if input.Data[0] < 0 {
+		panic("模拟模型错误")
+	}
+	return input
+}
+
+func (panicLayer) Backward(grad *Tensor) *Tensor { return grad }
+
+func (panicLayer) GetParameters() []*Tensor { return nil }
+
+func TestPredictEndpointErrors(t *testing.T) {
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinear(2, 1))
+	network.AddLayer(panicLayer{})
+	server := NewInferenceServer(network, nil, 4, time.Millisecond)
+	server.Start()
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/predict", bytes.NewReader(body)))
+		return rec
+	}
+
+	// 前向传播panic返回500，微批处理协程继续服务后续请求
+	network.Layers[0].(*Linear).Bias.Data[0] = -100
+	if rec := post([]byte(`{"inputs":[[0,0]]}`)); rec.Code != http.StatusInternalServerError {
+		t.Errorf("模型panic期望状态码500，实际%d: %s", rec.Code, rec.Body.String())
+	}
+	network.Layers[0].(*Linear).Bias.Data[0] = 100
+	if rec := post([]byte(`{"inputs":[[0,0]]}`)); rec.Code != http.StatusOK {
+		t.Errorf("panic后的请求期望状态码200，实际%d: %s", rec.Code, rec.Body.String())
+	}
+
+	// 请求体过大
+	large := append([]byte(`{"inputs":[[`), bytes.Repeat([]byte("0,"), maxPredictBodyBytes)...)
+	if rec := post(large); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("请求体过大期望状态码413，实际%d", rec.Code)
+	}
+
+	// 服务停止后返回503
+	server.Stop()
+	if rec := post([]byte(`{"inputs":[[0,0]]}`)); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("服务停止后期望状态码503，实际%d: %s", rec.Code, rec.Body.String())
+	}
+}
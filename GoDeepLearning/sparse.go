@@ -0,0 +1,174 @@
+package main
+
+import "time"
+
+// CSRMatrix 按行压缩存储（CSR）的稀疏矩阵，只保存非零元素。
+// 第r行的非零元素为ColIdx/Values[RowPtr[r]:RowPtr[r+1]]
+type CSRMatrix struct {
+	Rows   int
+	Cols   int
+	RowPtr []int32
+	ColIdx []int32
+	Values []float64
+}
+
+// NewCSRMatrix 从二维数据构建稀疏矩阵，跳过值为0的元素（包括被剪枝的权重）
+func NewCSRMatrix(data []float64, rows, cols int) *CSRMatrix {
+	m := &CSRMatrix{Rows: rows, Cols: cols, RowPtr: make([]int32, rows+1)}
+	for r := 0; r < rows; r++ {
+		for c, v := range data[r*cols : (r+1)*cols] {
+			if v != 0 {
+				m.ColIdx = append(m.ColIdx, int32(c))
+				m.Values = append(m.Values, v)
+			}
+		}
+		m.RowPtr[r+1] = int32(len(m.Values))
+	}
+	return m
+}
+
+// NNZ 非零元素个数
+func (m *CSRMatrix) NNZ() int {
+	return len(m.Values)
+}
+
+// Bytes 稀疏矩阵占用的字节数：行指针和列下标各4字节，非零值8字节
+func (m *CSRMatrix) Bytes() int {
+	return 4*len(m.RowPtr) + 4*len(m.ColIdx) + 8*len(m.Values)
+}
+
+// MulDense 计算 input * m，input为[batch, Rows]的稠密张量。
+// 对每个样本只遍历输入非零且权重非零的位置，计算量与非零权重数成正比
+func (m *CSRMatrix) MulDense(input *Tensor) *Tensor {
+	if len(input.Shape) != 2 || input.Shape[1] != m.Rows {
+		panic("矩阵维度不匹配")
+	}
+
+	batch := input.Shape[0]
+	result := make([]float64, batch*m.Cols)
+	for i := 0; i < batch; i++ {
+		out := result[i*m.Cols : (i+1)*m.Cols]
+		for r, a := range input.Data[i*m.Rows : (i+1)*m.Rows] {
+			if a == 0 {
+				continue
+			}
+			for p := m.RowPtr[r]; p < m.RowPtr[r+1]; p++ {
+				out[m.ColIdx[p]] += a * m.Values[p]
+			}
+		}
+	}
+	return NewTensor(result, []int{batch, m.Cols})
+}
+
+// buildSparse 按当前权重（任一精度）构建稀疏权重和偏置
+func (l *Linear) buildSparse() {
+	weight, bias := l.weightData()
+	l.Sparse = NewCSRMatrix(weight, l.Weight.Shape[0], l.Weight.Shape[1])
+	l.sparseBias = append([]float64(nil), bias...)
+}
+
+// forwardSparse 使用稀疏权重的前向传播
+func (l *Linear) forwardSparse(input *Tensor) *Tensor {
+	output := l.Sparse.MulDense(input)
+	cols := output.Shape[1]
+	for i := range output.Data {
+		output.Data[i] += l.sparseBias[i%cols]
+	}
+	return output
+}
+
+// EnableSparseInference 为全连接层构建CSR权重，之后的前向传播跳过为0的权重。
+// 稀疏权重是当前参数的只读副本：剪枝或切换精度时会重建，反向传播时自动关闭，
+// Trainer训练期间临时关闭并在结束后重新构建
+func (nn *NeuralNetwork) EnableSparseInference() {
+	for _, layer := range nn.Layers {
+		if linear, ok := layer.(*Linear); ok {
+			linear.buildSparse()
+		}
+	}
+	nn.SparseInference = true
+}
+
+// DisableSparseInference 释放稀疏权重，恢复稠密前向传播
+func (nn *NeuralNetwork) DisableSparseInference() {
+	for _, layer := range nn.Layers {
+		if linear, ok := layer.(*Linear); ok {
+			linear.Sparse, linear.sparseBias = nil, nil
+		}
+	}
+	nn.SparseInference = false
+}
+
+// SparseParameterBytes 稀疏推理时全连接层参数占用的字节数（CSR权重加float64偏置）
+func SparseParameterBytes(network *NeuralNetwork) int {
+	total := 0
+	for _, layer := range network.Layers {
+		linear, ok := layer.(*Linear)
+		if !ok {
+			continue
+		}
+		if linear.Sparse != nil {
+			total += linear.Sparse.Bytes() + 8*len(linear.sparseBias)
+			continue
+		}
+		weight, bias := linear.weightData()
+		total += NewCSRMatrix(weight, linear.Weight.Shape[0], linear.Weight.Shape[1]).Bytes() + 8*len(bias)
+	}
+	return total
+}
+
+// SparseReport 稠密与稀疏推理的模型大小和延迟对比
+type SparseReport struct {
+	Sparsity      float64       `json:"sparsity"`
+	DenseBytes    int           `json:"dense_bytes"`
+	SparseBytes   int           `json:"sparse_bytes"`
+	DenseLatency  time.Duration `json:"dense_latency"`  // 单次前向传播的平均耗时
+	SparseLatency time.Duration `json:"sparse_latency"` // 单次前向传播的平均耗时
+}
+
+// SizeRatio 稀疏模型大小与稠密模型大小之比
+func (r SparseReport) SizeRatio() float64 {
+	if r.DenseBytes == 0 {
+		return 0
+	}
+	return float64(r.SparseBytes) / float64(r.DenseBytes)
+}
+
+// Speedup 稠密延迟与稀疏延迟之比，大于1表示稀疏推理更快
+func (r SparseReport) Speedup() float64 {
+	if r.SparseLatency == 0 {
+		return 0
+	}
+	return float64(r.DenseLatency) / float64(r.SparseLatency)
+}
+
+// CompareSparseInference 用input分别进行iterations次稠密和稀疏前向传播，报告模型大小和平均延迟。
+// 结束后恢复网络原来的推理模式
+func CompareSparseInference(network *NeuralNetwork, input *Tensor, iterations int) SparseReport {
+	if iterations <= 0 {
+		iterations = 1
+	}
+	sparse := network.SparseInference
+
+	network.DisableSparseInference()
+	report := SparseReport{Sparsity: NetworkSparsity(network), DenseBytes: ParameterBytes(network)}
+	report.DenseLatency = timeForward(network, input, iterations)
+
+	network.EnableSparseInference()
+	report.SparseBytes = SparseParameterBytes(network)
+	report.SparseLatency = timeForward(network, input, iterations)
+
+	if !sparse {
+		network.DisableSparseInference()
+	}
+	return report
+}
+
+// timeForward 前向传播的平均耗时
+func timeForward(network *NeuralNetwork, input *Tensor, iterations int) time.Duration {
+	start := time.Now()
+	for i := 0; i < iterations; i++ {
+		network.Forward(input)
+	}
+	return time.Since(start) / time.Duration(iterations)
+}
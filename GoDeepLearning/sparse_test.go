@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// newPrunedNetwork 创建按sparsity剪枝的两层网络
+func newPrunedNetwork(sparsity float64) *NeuralNetwork {
+	rng := rand.New(rand.NewSource(1))
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinearRand(64, 32, rng))
+	network.AddLayer(NewReLU())
+	network.AddLayer(NewLinearRand(32, 4, rng))
+	NewMagnitudePruner().Prune(network, sparsity)
+	return network
+}
+
+func TestCSRMatrix(t *testing.T) {
+	m := NewCSRMatrix([]float64{0, 2, 0, 1, 0, 3}, 3, 2)
+	if m.NNZ() != 3 {
+		t.Fatalf("期望3个非零元素，实际%d", m.NNZ())
+	}
+
+	input := NewTensor([]float64{1, 2, 3, 0, 1, 0}, []int{2, 3})
+	got := m.MulDense(input)
+	want := input.MatMul(NewTensor([]float64{0, 2, 0, 1, 0, 3}, []int{3, 2}))
+	for i := range want.Data {
+		if got.Data[i] != want.Data[i] {
+			t.Fatalf("稀疏乘法结果%v与稠密结果%v不一致", got.Data, want.Data)
+		}
+	}
+}
+
+func TestSparseInference(t *testing.T) {
+	network := newPrunedNetwork(0.9)
+	input := NewTensor(make([]float64, 8*64), []int{8, 64})
+	for i := range input.Data {
+		input.Data[i] = float64(i%7) - 3
+	}
+
+	dense := network.Forward(input)
+	network.EnableSparseInference()
+	sparse := network.Forward(input)
+	for i := range dense.Data {
+		if math.Abs(dense.Data[i]-sparse.Data[i]) > 1e-9 {
+			t.Fatalf("稀疏推理结果与稠密推理不一致: %v vs %v", sparse.Data[i], dense.Data[i])
+		}
+	}
+
+	if SparseParameterBytes(network) >= ParameterBytes(network) {
+		t.Errorf("90%%稀疏度下CSR权重(%d字节)应小于稠密权重(%d字节)", SparseParameterBytes(network), ParameterBytes(network))
+	}
+
+	// 反向传播后稀疏权重失效并自动关闭
+	network.Backward(sparse, NewTensor(make([]float64, 8*4), []int{8, 4}))
+	if network.SparseInference {
+		t.Error("反向传播后应关闭稀疏推理")
+	}
+	for _, layer := range network.Layers {
+		if linear, ok := layer.(*Linear); ok && linear.Sparse != nil {
+			t.Error("反向传播后应释放稀疏权重")
+		}
+	}
+}
+
+func TestSparseInferenceFollowsPruning(t *testing.T) {
+	network := newPrunedNetwork(0.5)
+	network.EnableSparseInference()
+	NewMagnitudePruner().Prune(network, 0.8)
+
+	first := network.Layers[0].(*Linear)
+	if want := int(math.Round(0.2 * 64 * 32)); first.Sparse.NNZ() > want {
+		t.Errorf("剪枝后应重建CSR权重，期望不超过%d个非零元素，实际%d", want, first.Sparse.NNZ())
+	}
+}
+
+func TestCompareSparseInference(t *testing.T) {
+	network := newPrunedNetwork(0.9)
+	input := NewTensor(make([]float64, 16*64), []int{16, 64})
+	for i := range input.Data {
+		input.Data[i] = 1
+	}
+
+	report := CompareSparseInference(network, input, 5)
+	if math.Abs(report.Sparsity-0.9) > 0.01 {
+		t.Errorf("期望稀疏度0.9，实际%v", report.Sparsity)
+	}
+	if report.SizeRatio() <= 0 || report.SizeRatio() >= 1 {
+		t.Errorf("稀疏模型应小于稠密模型，大小比%v", report.SizeRatio())
+	}
+	if report.DenseLatency <= 0 || report.SparseLatency <= 0 {
+		t.Errorf("延迟应大于0: %+v", report)
+	}
+	if network.SparseInference {
+		t.Error("对比结束后应恢复网络原来的推理模式")
+	}
+}
+
+func BenchmarkSparseForward(b *testing.B) {
+	for _, sparse := range []bool{false, true} {
+		name := "dense"
+		if sparse {
+			name = "sparse"
+		}
+		b.Run(name, func(b *testing.B) {
+			rng := rand.New(rand.NewSource(1))
+			network := NewNeuralNetwork()
+			network.AddLayer(NewLinearRand(256, 256, rng))
+			network.AddLayer(NewReLU())
+			network.AddLayer(NewLinearRand(256, 10, rng))
+			NewMagnitudePruner().Prune(network, 0.9)
+			if sparse {
+				network.EnableSparseInference()
+			}
+			input, _ := benchmarkMatrices(256)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				network.Forward(input)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// TensorBoardLogger 将标量写入TensorBoard事件文件(events.out.tfevents.*)，
+// 使用 tensorboard --logdir <dir> 即可查看训练曲线
+type TensorBoardLogger struct {
+	file   *os.File
+	writer *bufio.Writer
+	mutex  sync.Mutex
+	now    func() time.Time
+}
+
+// NewTensorBoardLogger 在dir下创建事件文件
+func NewTensorBoardLogger(dir string) (*TensorBoardLogger, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	name := fmt.Sprintf("events.out.tfevents.%d.%s", time.Now().Unix(), hostname)
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	l := &TensorBoardLogger{file: file, writer: bufio.NewWriter(file), now: time.Now}
+	// 第一条记录声明文件版本
+	l.writeRecord(encodeEvent(l.wallTime(), 0, "brain.Event:2", nil))
+	l.writer.Flush()
+	return l, nil
+}
+
+// Path 事件文件路径
+func (l *TensorBoardLogger) Path() string {
+	return l.file.Name()
+}
+
+// Message 事件文件只记录标量，忽略文本信息
+func (l *TensorBoardLogger) Message(msg string) {}
+
+// Epoch 写出epoch指标，每个epoch刷新一次以便TensorBoard实时读取
+func (l *TensorBoardLogger) Epoch(event TrainingEvent) {
+	tags, values := event.scalars()
+	for i, tag := range tags {
+		l.WriteScalar(tag, event.Epoch, values[i])
+	}
+
+	l.mutex.Lock()
+	l.writer.Flush()
+	l.mutex.Unlock()
+}
+
+// WriteScalar 写出单个标量
+func (l *TensorBoardLogger) WriteScalar(tag string, step int, value float64) error {
+	summary := encodeSummaryValue(tag, float32(value))
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.writeRecord(encodeEvent(l.wallTime(), int64(step), "", summary))
+}
+
+// Histograms 写出直方图，TensorBoard的HISTOGRAMS/DISTRIBUTIONS页面可查看权重分布随训练的变化
+func (l *TensorBoardLogger) Histograms(step int, histograms []Histogram) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, h := range histograms {
+		l.writeRecord(encodeEvent(l.wallTime(), int64(step), "", encodeSummaryHistogram(h)))
+	}
+	l.writer.Flush()
+}
+
+// Close 刷新并关闭文件
+func (l *TensorBoardLogger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+func (l *TensorBoardLogger) wallTime() float64 {
+	return float64(l.now().UnixNano()) / 1e9
+}
+
+// writeRecord 按TFRecord格式写出一条记录：长度、长度校验、数据、数据校验
+func (l *TensorBoardLogger) writeRecord(data []byte) error {
+	header := make([]byte, 12)
+	binary.LittleEndian.PutUint64(header[:8], uint64(len(data)))
+	binary.LittleEndian.PutUint32(header[8:], maskedCRC(header[:8]))
+
+	footer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(footer, maskedCRC(data))
+
+	for _, chunk := range [][]byte{header, data, footer} {
+		if _, err := l.writer.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// maskedCRC TFRecord使用的掩码CRC32C
+func maskedCRC(data []byte) uint32 {
+	crc := crc32.Checksum(data, castagnoli)
+	return ((crc >> 15) | (crc << 17)) + 0xa282ead8
+}
+
+// 以下为Event/Summary protobuf消息的手工编码，只包含用到的字段
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendTag(buf []byte, field, wireType int) []byte {
+	return appendVarint(buf, uint64(field<<3|wireType))
+}
+
+func appendBytesField(buf []byte, field int, data []byte) []byte {
+	buf = appendTag(buf, field, 2)
+	buf = appendVarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// encodeSummaryValue 编码 Summary{value: [{tag, simple_value}]}
+func encodeSummaryValue(tag string, value float32) []byte {
+	var v []byte
+	v = appendBytesField(v, 1, []byte(tag))
+	v = appendTag(v, 2, 5)
+	v = binary.LittleEndian.AppendUint32(v, math.Float32bits(value))
+
+	return appendBytesField(nil, 1, v)
+}
+
+// appendPackedDoubles 编码packed repeated double字段
+func appendPackedDoubles(buf []byte, field int, values []float64) []byte {
+	packed := make([]byte, 0, 8*len(values))
+	for _, v := range values {
+		packed = binary.LittleEndian.AppendUint64(packed, math.Float64bits(v))
+	}
+	return appendBytesField(buf, field, packed)
+}
+
+func appendDoubleField(buf []byte, field int, v float64) []byte {
+	buf = appendTag(buf, field, 1)
+	return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+}
+
+// encodeSummaryHistogram 编码 Summary{value: [{tag, histo: HistogramProto}]}
+func encodeSummaryHistogram(h Histogram) []byte {
+	var histo []byte
+	histo = appendDoubleField(histo, 1, h.Min)
+	histo = appendDoubleField(histo, 2, h.Max)
+	histo = appendDoubleField(histo, 3, h.Num)
+	histo = appendDoubleField(histo, 4, h.Sum)
+	histo = appendDoubleField(histo, 5, h.SumSquares)
+	histo = appendPackedDoubles(histo, 6, h.Limits)
+	histo = appendPackedDoubles(histo, 7, h.Buckets)
+
+	var v []byte
+	v = appendBytesField(v, 1, []byte(h.Tag))
+	v = appendBytesField(v, 5, histo)
+	return appendBytesField(nil, 1, v)
+}
+
+// encodeEvent 编码 Event{wall_time, step, file_version | summary}
+func encodeEvent(wallTime float64, step int64, fileVersion string, summary []byte) []byte {
+	var buf []byte
+	buf = appendTag(buf, 1, 1)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(wallTime))
+	if step != 0 {
+		buf = appendTag(buf, 2, 0)
+		buf = appendVarint(buf, uint64(step))
+	}
+	if fileVersion != "" {
+		buf = appendBytesField(buf, 3, []byte(fileVersion))
+	}
+	if summary != nil {
+		buf = appendBytesField(buf, 5, summary)
+	}
+	return buf
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SearchStrategy 超参数搜索策略
+type SearchStrategy int
+
+const (
+	GridSearch   SearchStrategy = iota // 遍历所有组合
+	RandomSearch                       // 随机抽取Trials个组合
+)
+
+// SearchSpace 超参数搜索空间
+type SearchSpace struct {
+	LearningRates []float64
+	HiddenSizes   [][]int // 每个元素是一组隐藏层宽度，如[]int{16, 8}
+	BatchSizes    []int   // 0表示整个epoch更新一次
+}
+
+// TrialConfig 一次试验的超参数
+type TrialConfig struct {
+	LearningRate float64
+	HiddenSizes  []int
+	BatchSize    int
+}
+
+func (c TrialConfig) String() string {
+	hidden := make([]string, len(c.HiddenSizes))
+	for i, h := range c.HiddenSizes {
+		hidden[i] = fmt.Sprint(h)
+	}
+	return fmt.Sprintf("lr=%g hidden=[%s] batch=%d", c.LearningRate, strings.Join(hidden, ","), c.BatchSize)
+}
+
+// TrialResult 一次试验的结果
+type TrialResult struct {
+	Trial     int
+	Config    TrialConfig
+	TrainLoss float64 // 最后一个epoch的训练损失
+	Objective float64 // 验证集目标值，越小越好
+	Duration  time.Duration
+	Network   *NeuralNetwork
+}
+
+// TuningReport 搜索结果，Results按目标值从小到大排序
+type TuningReport struct {
+	Best    TrialResult
+	Results []TrialResult
+}
+
+// Table 以文本表格输出全部试验结果
+func (r *TuningReport) Table() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %-40s %-12s %-12s %s\n", "trial", "config", "train_loss", "objective", "duration")
+	for _, result := range r.Results {
+		fmt.Fprintf(&b, "%-6d %-40s %-12.6f %-12.6f %v\n",
+			result.Trial, result.Config, result.TrainLoss, result.Objective, result.Duration.Round(time.Microsecond))
+	}
+	return b.String()
+}
+
+// Tuner 超参数搜索器：为每组超参数构建MLP（Linear-ReLU-...-Linear），训练后在验证集上计算目标值
+type Tuner struct {
+	Space       SearchSpace
+	Strategy    SearchStrategy
+	Trials      int // RandomSearch的试验次数
+	Parallelism int // 并行试验数
+	Epochs      int
+	Seed        int64 // 第i次试验使用Seed+i，结果可复现
+	InputDim    int
+	OutputDim   int
+
+	// Objective 验证集目标值，默认为验证集平均损失
+	Objective func(network *NeuralNetwork, inputs, targets []*Tensor) float64
+}
+
+// NewTuner 创建网格搜索的超参数搜索器
+func NewTuner(space SearchSpace, inputDim, outputDim, epochs int) *Tuner {
+	return &Tuner{
+		Space:       space,
+		Strategy:    GridSearch,
+		Parallelism: 1,
+		Epochs:      epochs,
+		InputDim:    inputDim,
+		OutputDim:   outputDim,
+		Objective:   ValidationLoss,
+	}
+}
+
+// ValidationLoss 验证集上的平均损失
+func ValidationLoss(network *NeuralNetwork, inputs, targets []*Tensor) float64 {
+	total := 0.0
+	for i, input := range inputs {
+		total += network.Loss.Forward(network.Forward(input), targets[i]).Sum()
+	}
+	return total / float64(len(inputs))
+}
+
+// configs 按搜索策略生成试验超参数
+func (t *Tuner) configs() []TrialConfig {
+	lrs := t.Space.LearningRates
+	hiddens := t.Space.HiddenSizes
+	batches := t.Space.BatchSizes
+	if len(hiddens) == 0 {
+		hiddens = [][]int{nil}
+	}
+	if len(batches) == 0 {
+		batches = []int{0}
+	}
+
+	var grid []TrialConfig
+	for _, lr := range lrs {
+		for _, hidden := range hiddens {
+			for _, batch := range batches {
+				grid = append(grid, TrialConfig{LearningRate: lr, HiddenSizes: hidden, BatchSize: batch})
+			}
+		}
+	}
+	if t.Strategy != RandomSearch {
+		return grid
+	}
+
+	rng := rand.New(rand.NewSource(t.Seed))
+	configs := make([]TrialConfig, t.Trials)
+	for i := range configs {
+		configs[i] = TrialConfig{
+			LearningRate: lrs[rng.Intn(len(lrs))],
+			HiddenSizes:  hiddens[rng.Intn(len(hiddens))],
+			BatchSize:    batches[rng.Intn(len(batches))],
+		}
+	}
+	return configs
+}
+
+// buildNetwork 按超参数构建网络
+func (t *Tuner) buildNetwork(config TrialConfig, rng *rand.Rand) *NeuralNetwork {
+	network := NewNeuralNetwork()
+	in := t.InputDim
+	for _, hidden := range config.HiddenSizes {
+		network.AddLayer(NewLinearRand(in, hidden, rng))
+		network.AddLayer(NewReLU())
+		in = hidden
+	}
+	network.AddLayer(NewLinearRand(in, t.OutputDim, rng))
+	return network
+}
+
+// runTrial 执行一次试验
+func (t *Tuner) runTrial(trial int, config TrialConfig, trainX, trainY, valX, valY []*Tensor) TrialResult {
+	start := time.Now()
+	seed := Config{Seed: t.Seed + int64(trial), Shuffle: true}
+	network := t.buildNetwork(config, seed.NewRand())
+
+	trainer := NewTrainerWithConfig(network, NewSGD(config.LearningRate), t.Epochs, seed)
+	trainer.BatchSize = config.BatchSize
+	trainer.Logger = MultiLogger{}
+	trainer.Train(trainX, trainY)
+
+	objective := t.Objective(network, valX, valY)
+	if math.IsNaN(objective) {
+		objective = math.Inf(1)
+	}
+	return TrialResult{
+		Trial:     trial,
+		Config:    config,
+		TrainLoss: trainer.Losses[len(trainer.Losses)-1],
+		Objective: objective,
+		Duration:  time.Since(start),
+		Network:   network,
+	}
+}
+
+// Run 执行搜索，Parallelism个试验并发运行，返回按目标值排序的结果
+func (t *Tuner) Run(trainX, trainY, valX, valY []*Tensor) (*TuningReport, error) {
+	if len(t.Space.LearningRates) == 0 {
+		return nil, fmt.Errorf("搜索空间缺少学习率")
+	}
+	if t.Strategy == RandomSearch && t.Trials <= 0 {
+		return nil, fmt.Errorf("随机搜索需要设置Trials")
+	}
+	if len(trainX) == 0 || len(valX) == 0 {
+		return nil, fmt.Errorf("训练集和验证集不能为空")
+	}
+
+	configs := t.configs()
+	results := make([]TrialResult, len(configs))
+
+	parallelism := t.Parallelism
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+	trials := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallelism; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for trial := range trials {
+				results[trial] = t.runTrial(trial, configs[trial], trainX, trainY, valX, valY)
+			}
+		}()
+	}
+	for trial := range configs {
+		trials <- trial
+	}
+	close(trials)
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Objective < results[j].Objective
+	})
+	return &TuningReport{Best: results[0], Results: results}, nil
+}
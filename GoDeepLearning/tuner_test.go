@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func tunerData(n int) ([]*Tensor, []*Tensor) {
+	inputs := make([]*Tensor, n)
+	targets := make([]*Tensor, n)
+	for i := 0; i < n; i++ {
+		x1, x2 := float64(i%5)/5, float64(i%3)/3
+		inputs[i] = NewTensor([]float64{x1, x2}, []int{1, 2})
+		targets[i] = NewTensor([]float64{2*x1 - x2}, []int{1, 1})
+	}
+	return inputs, targets
+}
+
+func TestTunerGridSearch(t *testing.T) {
+	trainX, trainY := tunerData(30)
+	valX, valY := tunerData(10)
+
+	space := SearchSpace{
+		LearningRates: []float64{1e-6, 0.01},
+		HiddenSizes:   [][]int{{4}, {8, 4}},
+		BatchSizes:    []int{0, 5},
+	}
+	tuner := NewTuner(space, 2, 1, 30)
+	tuner.Parallelism = 4
+	tuner.Seed = 11
+
+	report, err := tuner.Run(trainX, trainY, valX, valY)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(report.Results) != 8 {
+		t.Fatalf("网格搜索期望8次试验，实际%d", len(report.Results))
+	}
+	for i := 1; i < len(report.Results); i++ {
+		if report.Results[i].Objective < report.Results[i-1].Objective {
+			t.Fatal("结果应按目标值从小到大排序")
+		}
+	}
+	if report.Best.Config.LearningRate != 0.01 {
+		t.Errorf("期望最佳学习率0.01，实际%v", report.Best.Config)
+	}
+	if report.Best.Network == nil {
+		t.Error("最佳结果应包含训练好的网络")
+	}
+
+	table := report.Table()
+	if !strings.Contains(table, "objective") || strings.Count(table, "\n") != 9 {
+		t.Errorf("结果表格格式不正确:\n%s", table)
+	}
+
+	// 并行试验也应可复现
+	again, _ := tuner.Run(trainX, trainY, valX, valY)
+	if again.Best.Trial != report.Best.Trial || again.Best.Objective != report.Best.Objective {
+		t.Errorf("相同种子的搜索结果应一致: %v != %v", again.Best, report.Best)
+	}
+}
+
+func TestTunerRandomSearch(t *testing.T) {
+	trainX, trainY := tunerData(10)
+
+	tuner := NewTuner(SearchSpace{LearningRates: []float64{0.01, 0.05}, HiddenSizes: [][]int{{4}}}, 2, 1, 5)
+	tuner.Strategy = RandomSearch
+	if _, err := tuner.Run(trainX, trainY, trainX, trainY); err == nil {
+		t.Error("未设置Trials时应返回错误")
+	}
+
+	tuner.Trials = 3
+	report, err := tuner.Run(trainX, trainY, trainX, trainY)
+	if err != nil {
+		t.Fatalf("搜索失败: %v", err)
+	}
+	if len(report.Results) != 3 {
+		t.Errorf("期望3次试验，实际%d", len(report.Results))
+	}
+}
+
+func TestTrainerMiniBatch(t *testing.T) {
+	inputs, targets := tunerData(10)
+	counter := &countingOptimizer{SGD: NewSGD(0.01)}
+
+	config := Config{Seed: 1}
+	network := NewNeuralNetwork()
+	network.AddLayer(NewLinearRand(2, 1, config.NewRand()))
+	trainer := NewTrainerWithConfig(network, counter, 2, config)
+	trainer.BatchSize = 4
+	trainer.Logger = MultiLogger{}
+	trainer.Train(inputs, targets)
+
+	// 每个epoch 10个样本分为4+4+2三个batch
+	if counter.steps != 6 {
+		t.Errorf("期望6次优化步骤，实际%d", counter.steps)
+	}
+}
+
+// countingOptimizer 记录优化步骤次数
+type countingOptimizer struct {
+	*SGD
+	steps int
+}
+
+func (c *countingOptimizer) Step(params []*Tensor) {
+	c.steps++
+	c.SGD.Step(params)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// ScalarPoint 标量曲线上的一个点
+type ScalarPoint struct {
+	Step  int     `json:"step"`
+	Value float64 `json:"value"`
+}
+
+// TrainingViewer 轻量级训练可视化服务：作为Logger记录训练过程中的标量和直方图，
+// 并通过HTTP提供实时刷新的网页，无需安装TensorBoard
+type TrainingViewer struct {
+	scalars       map[string][]ScalarPoint
+	histograms    []Histogram
+	histogramStep int
+	messages      []string
+	mutex         sync.RWMutex
+	mux           *http.ServeMux
+}
+
+// NewTrainingViewer 创建可视化服务
+func NewTrainingViewer() *TrainingViewer {
+	v := &TrainingViewer{scalars: make(map[string][]ScalarPoint)}
+	v.mux = http.NewServeMux()
+	v.mux.HandleFunc("/", v.handleIndex)
+	v.mux.HandleFunc("/scalars", v.handleScalars)
+	v.mux.HandleFunc("/histograms", v.handleHistograms)
+	return v
+}
+
+// Message 记录文本信息
+func (v *TrainingViewer) Message(msg string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.messages = append(v.messages, msg)
+}
+
+// Epoch 记录epoch指标
+func (v *TrainingViewer) Epoch(event TrainingEvent) {
+	tags, values := event.scalars()
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	for i, tag := range tags {
+		v.scalars[tag] = append(v.scalars[tag], ScalarPoint{Step: event.Epoch, Value: values[i]})
+	}
+}
+
+// Histograms 保留最新一个epoch的直方图
+func (v *TrainingViewer) Histograms(step int, histograms []Histogram) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.histograms = histograms
+	v.histogramStep = step
+}
+
+// Close 关闭日志，已记录的数据仍可查看
+func (v *TrainingViewer) Close() error {
+	return nil
+}
+
+// ServeHTTP 实现http.Handler
+func (v *TrainingViewer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mux.ServeHTTP(w, r)
+}
+
+func (v *TrainingViewer) handleScalars(w http.ResponseWriter, r *http.Request) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"scalars":  v.scalars,
+		"messages": v.messages,
+	})
+}
+
+func (v *TrainingViewer) handleHistograms(w http.ResponseWriter, r *http.Request) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"step":       v.histogramStep,
+		"histograms": v.histograms,
+	})
+}
+
+func (v *TrainingViewer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(viewerPage))
+}
+
+// viewerPage 每2秒拉取一次数据，用canvas绘制标量曲线和最新的权重直方图
+const viewerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>训练可视化</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+.chart { display: inline-block; margin: 10px; }
+canvas { border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h2>标量</h2>
+<div id="scalars"></div>
+<h2>权重直方图 <span id="step"></span></h2>
+<div id="histograms"></div>
+<script>
+function chart(container, title, xs, ys, bars) {
+  let div = document.getElementById(container + '-' + title);
+  if (!div) {
+    div = document.createElement('div');
+    div.className = 'chart';
+    div.id = container + '-' + title;
+    div.innerHTML = '<div>' + title + '</div><canvas width="360" height="200"></canvas>';
+    document.getElementById(container).appendChild(div);
+  }
+  const canvas = div.querySelector('canvas');
+  const ctx = canvas.getContext('2d');
+  ctx.clearRect(0, 0, canvas.width, canvas.height);
+  if (ys.length === 0) return;
+  const minY = Math.min(0, ...ys), maxY = Math.max(...ys) || 1;
+  const minX = Math.min(...xs), maxX = Math.max(...xs);
+  const px = x => 30 + (maxX === minX ? 0.5 : (x - minX) / (maxX - minX)) * (canvas.width - 40);
+  const py = y => canvas.height - 20 - (y - minY) / (maxY - minY || 1) * (canvas.height - 30);
+  ctx.fillStyle = ctx.strokeStyle = '#1f77b4';
+  if (bars) {
+    const w = (canvas.width - 40) / ys.length;
+    ys.forEach((y, i) => ctx.fillRect(30 + i * w, py(y), w - 1, py(minY) - py(y)));
+  } else {
+    ctx.beginPath();
+    xs.forEach((x, i) => i ? ctx.lineTo(px(x), py(ys[i])) : ctx.moveTo(px(x), py(ys[i])));
+    ctx.stroke();
+  }
+  ctx.fillStyle = '#333';
+  ctx.fillText(maxY.toPrecision(4), 2, 12);
+  ctx.fillText(ys[ys.length - 1].toPrecision(4), canvas.width - 60, 12);
+}
+
+async function refresh() {
+  const scalars = (await (await fetch('scalars')).json()).scalars || {};
+  Object.keys(scalars).sort().forEach(tag => {
+    const points = scalars[tag];
+    chart('scalars', tag, points.map(p => p.step), points.map(p => p.value), false);
+  });
+  const hist = await (await fetch('histograms')).json();
+  document.getElementById('step').textContent = hist.step ? '(epoch ' + hist.step + ')' : '';
+  (hist.histograms || []).forEach(h => chart('histograms', h.tag, h.limits || [], h.buckets || [], true));
+}
+
+refresh();
+setInterval(refresh, 2000);
+</script>
+</body>
+</html>
+`
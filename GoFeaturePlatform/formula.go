@@ -0,0 +1,372 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 公式DSL：支持数值常量、数值特征引用、+ - * /、一元负号、括号和内置函数，
+// 例如 "income / max(age, 1)"、"log1p(clicks_7d)"
+
+// formulaFunc 内置函数
+type formulaFunc struct {
+	minArgs int
+	maxArgs int // -1表示不限
+	apply   func(args []float64) float64
+}
+
+var formulaFuncs = map[string]formulaFunc{
+	"abs":   {1, 1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"sqrt":  {1, 1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"log":   {1, 1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log1p": {1, 1, func(a []float64) float64 { return math.Log1p(a[0]) }},
+	"exp":   {1, 1, func(a []float64) float64 { return math.Exp(a[0]) }},
+	"pow":   {2, 2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"clip":  {3, 3, func(a []float64) float64 { return math.Max(a[1], math.Min(a[2], a[0])) }},
+	"min": {1, -1, func(a []float64) float64 {
+		result := a[0]
+		for _, v := range a[1:] {
+			result = math.Min(result, v)
+		}
+		return result
+	}},
+	"max": {1, -1, func(a []float64) float64 {
+		result := a[0]
+		for _, v := range a[1:] {
+			result = math.Max(result, v)
+		}
+		return result
+	}},
+}
+
+// formulaNode 表达式语法树节点
+type formulaNode interface {
+	eval(values map[string]float64) float64
+}
+
+type numberNode float64
+
+func (n numberNode) eval(map[string]float64) float64 { return float64(n) }
+
+type featureNode string
+
+func (n featureNode) eval(values map[string]float64) float64 { return values[string(n)] }
+
+type unaryNode struct{ operand formulaNode }
+
+func (n unaryNode) eval(values map[string]float64) float64 { return -n.operand.eval(values) }
+
+type binaryNode struct {
+	op          byte
+	left, right formulaNode
+}
+
+func (n binaryNode) eval(values map[string]float64) float64 {
+	left, right := n.left.eval(values), n.right.eval(values)
+	switch n.op {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	default:
+		return left / right
+	}
+}
+
+type callNode struct {
+	fn   formulaFunc
+	args []formulaNode
+}
+
+func (n callNode) eval(values map[string]float64) float64 {
+	args := make([]float64, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(values)
+	}
+	return n.fn.apply(args)
+}
+
+// formulaToken 词法单元
+type formulaToken struct {
+	kind  byte // 'n'数字 'i'标识符 其余为运算符或括号本身，0表示结束
+	text  string
+	pos   int
+	value float64
+}
+
+func tokenizeFormula(expr string) ([]formulaToken, error) {
+	var tokens []formulaToken
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			start := i
+			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.' || expr[i] == 'e' || expr[i] == 'E' ||
+				((expr[i] == '+' || expr[i] == '-') && (expr[i-1] == 'e' || expr[i-1] == 'E'))) {
+				i++
+			}
+			value, err := strconv.ParseFloat(expr[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("位置%d: 无效的数字 %q", start, expr[start:i])
+			}
+			tokens = append(tokens, formulaToken{kind: 'n', text: expr[start:i], pos: start, value: value})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(expr) && (expr[i] == '_' || unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i]))) {
+				i++
+			}
+			tokens = append(tokens, formulaToken{kind: 'i', text: expr[start:i], pos: start})
+		case strings.ContainsRune("+-*/(),", c):
+			tokens = append(tokens, formulaToken{kind: byte(c), text: string(c), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("位置%d: 无法识别的字符 %q", i, c)
+		}
+	}
+	return append(tokens, formulaToken{pos: len(expr)}), nil
+}
+
+// formulaParser 递归下降解析器，解析时按模式注册表校验特征引用
+type formulaParser struct {
+	tokens []formulaToken
+	pos    int
+	schema *SchemaRegistry
+	inputs map[string]bool
+}
+
+func (p *formulaParser) peek() formulaToken { return p.tokens[p.pos] }
+
+func (p *formulaParser) next() formulaToken {
+	token := p.tokens[p.pos]
+	if token.kind != 0 {
+		p.pos++
+	}
+	return token
+}
+
+func (p *formulaParser) expect(kind byte) error {
+	if token := p.next(); token.kind != kind {
+		return fmt.Errorf("位置%d: 期望 %q", token.pos, kind)
+	}
+	return nil
+}
+
+// expression := term (('+'|'-') term)*
+func (p *formulaParser) expression() (formulaNode, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == '+' || p.peek().kind == '-' {
+		op := p.next().kind
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// term := unary (('*'|'/') unary)*
+func (p *formulaParser) term() (formulaNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == '*' || p.peek().kind == '/' {
+		op := p.next().kind
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *formulaParser) unary() (formulaNode, error) {
+	if p.peek().kind == '-' {
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+// primary := number | feature | func '(' args ')' | '(' expression ')'
+func (p *formulaParser) primary() (formulaNode, error) {
+	token := p.next()
+	switch token.kind {
+	case 'n':
+		return numberNode(token.value), nil
+	case '(':
+		node, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(')')
+	case 'i':
+		if p.peek().kind == '(' {
+			return p.call(token)
+		}
+		return p.feature(token)
+	case 0:
+		return nil, fmt.Errorf("位置%d: 表达式不完整", token.pos)
+	default:
+		return nil, fmt.Errorf("位置%d: 意外的 %q", token.pos, token.text)
+	}
+}
+
+func (p *formulaParser) call(name formulaToken) (formulaNode, error) {
+	fn, exists := formulaFuncs[name.text]
+	if !exists {
+		return nil, fmt.Errorf("位置%d: 未知函数 %s", name.pos, name.text)
+	}
+	p.next() // '('
+
+	var args []formulaNode
+	if p.peek().kind != ')' {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != ',' {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("位置%d: 函数 %s 的参数个数错误: %d", name.pos, name.text, len(args))
+	}
+	return callNode{fn: fn, args: args}, nil
+}
+
+func (p *formulaParser) feature(name formulaToken) (formulaNode, error) {
+	featureType, exists := p.schema.Lookup(name.text)
+	if !exists {
+		return nil, fmt.Errorf("位置%d: 特征 %s 未在模式中注册", name.pos, name.text)
+	}
+	if featureType != FeatureTypeNumeric {
+		return nil, fmt.Errorf("位置%d: 特征 %s 是 %s 类型，公式只支持数值特征", name.pos, name.text, featureType)
+	}
+	p.inputs[name.text] = true
+	return featureNode(name.text), nil
+}
+
+// DerivedFeature 由公式计算的派生特征，作为特征引擎的一个转换阶段
+type DerivedFeature struct {
+	Name    string
+	Formula string
+	Inputs  []string
+	root    formulaNode
+}
+
+// CompileFormula 解析公式并按模式注册表校验，成功后将派生特征注册为数值类型
+func CompileFormula(name, expr string, schema *SchemaRegistry) (*DerivedFeature, error) {
+	tokens, err := tokenizeFormula(expr)
+	if err != nil {
+		return nil, fmt.Errorf("公式 %s: %v", name, err)
+	}
+
+	parser := &formulaParser{tokens: tokens, schema: schema, inputs: make(map[string]bool)}
+	root, err := parser.expression()
+	if err == nil && parser.peek().kind != 0 {
+		err = fmt.Errorf("位置%d: 多余的 %q", parser.peek().pos, parser.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("公式 %s: %v", name, err)
+	}
+	if parser.inputs[name] {
+		return nil, fmt.Errorf("公式 %s: 不能引用自身", name)
+	}
+	if err := schema.Register(name, FeatureTypeNumeric); err != nil {
+		return nil, fmt.Errorf("公式 %s: %v", name, err)
+	}
+
+	inputs := make([]string, 0, len(parser.inputs))
+	for input := range parser.inputs {
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+	return &DerivedFeature{Name: name, Formula: expr, Inputs: inputs, root: root}, nil
+}
+
+// Evaluate 在特征集合上计算公式，缺少输入特征或结果不是有限数时返回错误
+func (df *DerivedFeature) Evaluate(featureSet *FeatureSet) (float64, error) {
+	values := make(map[string]float64, len(df.Inputs))
+	for _, input := range df.Inputs {
+		feature, exists := featureSet.GetFeature(input)
+		if !exists {
+			return 0, fmt.Errorf("缺少特征 %s", input)
+		}
+		value, ok := feature.Value().(float64)
+		if !ok {
+			return 0, fmt.Errorf("特征 %s 不是数值", input)
+		}
+		values[input] = value
+	}
+
+	result := df.root.eval(values)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("公式 %s 的结果不是有限数", df.Name)
+	}
+	return result, nil
+}
+
+// TransformSet 计算派生特征，无法计算时不生成该特征
+func (df *DerivedFeature) TransformSet(featureSet *FeatureSet) (Feature, bool) {
+	value, err := df.Evaluate(featureSet)
+	if err != nil {
+		return nil, false
+	}
+	return NewNumericFeature(df.Name, value), true
+}
+
+// AddDerivedFeature 添加派生特征阶段，按添加顺序在转换器之后执行，后定义的公式可以引用先定义的派生特征
+func (fe *FeatureEngine) AddDerivedFeature(derived *DerivedFeature) {
+	fe.derived = append(fe.derived, derived)
+}
+
+// applyDerived 依次计算派生特征
+func (fe *FeatureEngine) applyDerived(featureSet *FeatureSet) {
+	for _, derived := range fe.derived {
+		if feature, ok := derived.TransformSet(featureSet); ok {
+			featureSet.AddFeature(feature)
+		}
+	}
+}
+
+// Schema 返回管道的特征模式注册表
+func (fp *FeaturePipeline) Schema() *SchemaRegistry {
+	return fp.schema
+}
+
+// DefineDerivedFeature 编译公式并注册为管道的派生特征
+func (fp *FeaturePipeline) DefineDerivedFeature(name, expr string) (*DerivedFeature, error) {
+	derived, err := CompileFormula(name, expr, fp.schema)
+	if err != nil {
+		return nil, err
+	}
+	fp.engine.AddDerivedFeature(derived)
+	return derived, nil
+}
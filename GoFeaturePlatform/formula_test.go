@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func formulaSchema() *SchemaRegistry {
+	schema := NewSchemaRegistry()
+	schema.Register("income", FeatureTypeNumeric)
+	schema.Register("age", FeatureTypeNumeric)
+	schema.Register("clicks_7d", FeatureTypeNumeric)
+	schema.Register("city", FeatureTypeCategorical)
+	return schema
+}
+
+func formulaFeatureSet() *FeatureSet {
+	featureSet := NewFeatureSet("user1")
+	featureSet.AddFeature(NewNumericFeature("income", 5000))
+	featureSet.AddFeature(NewNumericFeature("age", 0))
+	featureSet.AddFeature(NewNumericFeature("clicks_7d", math.E-1))
+	featureSet.AddFeature(NewCategoricalFeature("city", "北京"))
+	return featureSet
+}
+
+func TestCompileFormula(t *testing.T) {
+	cases := []struct {
+		expr     string
+		expected float64
+	}{
+		{"income / max(age, 1)", 5000},
+		{"log1p(clicks_7d)", 1},
+		{"-income + 2 * (age + 3) - 1e3", -5994},
+		{"clip(income / 100, 0, 10)", 10},
+		{"min(1, 2, -3) + abs(-2) + pow(2, 3)", 7},
+	}
+
+	for _, c := range cases {
+		derived, err := CompileFormula("derived", c.expr, formulaSchema())
+		if err != nil {
+			t.Errorf("编译%q失败: %v", c.expr, err)
+			continue
+		}
+		value, err := derived.Evaluate(formulaFeatureSet())
+		if err != nil {
+			t.Errorf("计算%q失败: %v", c.expr, err)
+			continue
+		}
+		if math.Abs(value-c.expected) > 1e-9 {
+			t.Errorf("%q期望%v，实际%v", c.expr, c.expected, value)
+		}
+	}
+}
+
+func TestCompileFormulaValidation(t *testing.T) {
+	cases := map[string]string{
+		"income / unknown":  "未在模式中注册",
+		"log1p(city)":       "公式只支持数值特征",
+		"sqrt(income, age)": "参数个数错误",
+		"median(income)":    "未知函数",
+		"income * (age + 1": "期望",
+		"income age":        "多余的",
+		"income $ 2":        "无法识别的字符",
+		"derived + 1":       "不能引用自身",
+	}
+
+	for expr, message := range cases {
+		schema := formulaSchema()
+		schema.Register("derived", FeatureTypeNumeric)
+		_, err := CompileFormula("derived", expr, schema)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q期望错误包含%q，实际%v", expr, message, err)
+		}
+	}
+
+	if _, err := CompileFormula("city", "income * 2", formulaSchema()); err == nil {
+		t.Error("派生特征不能覆盖已注册的非数值特征")
+	}
+}
+
+func TestDerivedFeaturesInPipeline(t *testing.T) {
+	pipeline := NewFeaturePipeline()
+	pipeline.Schema().Register("income", FeatureTypeNumeric)
+	pipeline.Schema().Register("age", FeatureTypeNumeric)
+
+	if _, err := pipeline.DefineDerivedFeature("income_per_year", "income / max(age, 1)"); err != nil {
+		t.Fatalf("定义派生特征失败: %v", err)
+	}
+	// 后定义的公式可以引用先定义的派生特征
+	if _, err := pipeline.DefineDerivedFeature("log_income_per_year", "log(income_per_year)"); err != nil {
+		t.Fatalf("定义派生特征失败: %v", err)
+	}
+
+	featureSet := NewFeatureSet("user1")
+	featureSet.AddFeature(NewNumericFeature("income", 100))
+	featureSet.AddFeature(NewNumericFeature("age", 25))
+	pipeline.ProcessAndStore(featureSet)
+
+	processed, _ := pipeline.GetProcessedFeatures("user1")
+	perYear, exists := processed.GetFeature("income_per_year")
+	if !exists || perYear.Value() != 4.0 {
+		t.Fatalf("期望income_per_year为4，实际%v", perYear)
+	}
+	logPerYear, exists := processed.GetFeature("log_income_per_year")
+	if !exists || math.Abs(logPerYear.Value().(float64)-math.Log(4)) > 1e-9 {
+		t.Errorf("期望log_income_per_year为ln4，实际%v", logPerYear)
+	}
+
+	// 缺少输入特征时不生成派生特征
+	missing := NewFeatureSet("user2")
+	missing.AddFeature(NewNumericFeature("age", 30))
+	pipeline.ProcessAndStore(missing)
+	processed, _ = pipeline.GetProcessedFeatures("user2")
+	if _, exists := processed.GetFeature("income_per_year"); exists {
+		t.Error("缺少输入特征时不应生成派生特征")
+	}
+}
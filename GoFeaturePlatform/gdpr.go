@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EntityDataSource 持有实体数据的组件，合规删除和导出时会逐一处理
+type EntityDataSource interface {
+	SourceName() string
+	ExportEntity(entityID string) (interface{}, error)
+	DeleteEntity(entityID string) (int, error)
+}
+
+// ExportedFeature 导出的单个特征
+type ExportedFeature struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// SourceName 数据源名称
+func (fs *FeatureStore) SourceName() string { return "feature_store" }
+
+// ExportEntity 导出实体在特征存储中的全部特征
+func (fs *FeatureStore) ExportEntity(entityID string) (interface{}, error) {
+	featureSet, exists := fs.Get(entityID)
+	if !exists {
+		return nil, nil
+	}
+
+	features := make(map[string]ExportedFeature, len(featureSet.features))
+	for name, feature := range featureSet.features {
+		features[name] = ExportedFeature{Type: feature.Type(), Value: feature.Value()}
+	}
+	return map[string]interface{}{
+		"timestamp": featureSet.timestamp,
+		"features":  features,
+	}, nil
+}
+
+// DeleteEntity 删除实体在特征存储中的数据，返回删除的记录数
+func (fs *FeatureStore) DeleteEntity(entityID string) (int, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if !fs.removeLocked(entityID) {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// EntityExport 实体数据的完整导出
+type EntityExport struct {
+	EntityID   string                 `json:"entity_id"`
+	ExportedAt time.Time              `json:"exported_at"`
+	Sources    map[string]interface{} `json:"sources"`
+}
+
+// ComplianceCertificate 合规操作完成证明
+type ComplianceCertificate struct {
+	EntityID    string         `json:"entity_id"`
+	Action      string         `json:"action"`
+	CompletedAt time.Time      `json:"completed_at"`
+	Records     map[string]int `json:"records,omitempty"`
+	Digest      string         `json:"digest"`
+	Signature   string         `json:"signature"`
+}
+
+// certificateDigest 计算证明其余字段及导出内容的SHA-256摘要
+func certificateDigest(cert *ComplianceCertificate, payload []byte) ([]byte, error) {
+	unsigned := *cert
+	unsigned.Digest = ""
+	unsigned.Signature = ""
+	body, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	hash.Write(body)
+	hash.Write(payload)
+	return hash.Sum(nil), nil
+}
+
+// newCertificate 生成证明，摘要覆盖证明的全部字段，并用ed25519私钥对摘要签名，
+// 没有私钥的一方无法伪造证明
+func newCertificate(key ed25519.PrivateKey, entityID, action string, records map[string]int, payload []byte) (*ComplianceCertificate, error) {
+	cert := &ComplianceCertificate{
+		EntityID:    entityID,
+		Action:      action,
+		CompletedAt: time.Now().UTC(),
+		Records:     records,
+	}
+
+	digest, err := certificateDigest(cert, payload)
+	if err != nil {
+		return nil, err
+	}
+	cert.Digest = hex.EncodeToString(digest)
+	cert.Signature = hex.EncodeToString(ed25519.Sign(key, digest))
+	return cert, nil
+}
+
+// VerifyCertificate 用签发方的公钥校验证明，导出证明需同时提供导出内容的JSON
+func VerifyCertificate(cert *ComplianceCertificate, payload []byte, publicKey ed25519.PublicKey) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("公钥长度无效: %d", len(publicKey))
+	}
+	digest, err := certificateDigest(cert, payload)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(digest) != cert.Digest {
+		return errors.New("证明摘要不匹配")
+	}
+	signature, err := hex.DecodeString(cert.Signature)
+	if err != nil || !ed25519.Verify(publicKey, digest, signature) {
+		return errors.New("证明签名无效")
+	}
+	return nil
+}
+
+// SetCertificateKey 设置签发证明的ed25519私钥，未设置时首次签发前随机生成
+func (fp *FeaturePipeline) SetCertificateKey(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("私钥长度无效: %d", len(key))
+	}
+	fp.keyMutex.Lock()
+	defer fp.keyMutex.Unlock()
+	fp.certKey = key
+	return nil
+}
+
+// CertificatePublicKey 返回校验证明所需的公钥
+func (fp *FeaturePipeline) CertificatePublicKey() (ed25519.PublicKey, error) {
+	key, err := fp.certificateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+// certificateKey 返回签发证明的私钥，必要时生成
+func (fp *FeaturePipeline) certificateKey() (ed25519.PrivateKey, error) {
+	fp.keyMutex.Lock()
+	defer fp.keyMutex.Unlock()
+
+	if fp.certKey == nil {
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, fmt.Errorf("生成证明签名私钥失败: %v", err)
+		}
+		fp.certKey = key
+	}
+	return fp.certKey, nil
+}
+
+// certificate 用当前私钥签发证明
+func (fp *FeaturePipeline) certificate(entityID, action string, records map[string]int, payload []byte) (*ComplianceCertificate, error) {
+	key, err := fp.certificateKey()
+	if err != nil {
+		return nil, err
+	}
+	return newCertificate(key, entityID, action, records, payload)
+}
+
+// ComplianceJob 异步合规任务
+type ComplianceJob struct {
+	ID          string                 `json:"id"`
+	EntityID    string                 `json:"entity_id"`
+	Action      string                 `json:"action"`
+	Status      string                 `json:"status"`
+	Error       string                 `json:"error,omitempty"`
+	Export      *EntityExport          `json:"export,omitempty"`
+	Certificate *ComplianceCertificate `json:"certificate,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	FinishedAt  time.Time              `json:"finished_at,omitempty"`
+}
+
+const (
+	ComplianceActionDelete = "delete"
+	ComplianceActionExport = "export"
+
+	JobStatusPending   = "pending"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+
+	// DefaultJobRetention 已结束任务（含导出的实体数据）的默认保留时间
+	DefaultJobRetention = 24 * time.Hour
+)
+
+// complianceJobs 异步合规任务表
+type complianceJobs struct {
+	jobs      map[string]*ComplianceJob
+	seq       int
+	retention time.Duration
+	mutex     sync.Mutex
+}
+
+// expireLocked 清除结束时间超过保留时间的任务，调用方需持有锁
+func (cj *complianceJobs) expireLocked(now time.Time) {
+	for id, job := range cj.jobs {
+		if !job.FinishedAt.IsZero() && now.Sub(job.FinishedAt) > cj.retention {
+			delete(cj.jobs, id)
+		}
+	}
+}
+
+// purgeEntity 清除实体的全部导出任务，未完成的导出任务结束后也不会保存结果
+func (cj *complianceJobs) purgeEntity(entityID string) {
+	cj.mutex.Lock()
+	defer cj.mutex.Unlock()
+
+	for id, job := range cj.jobs {
+		if job.EntityID == entityID && job.Action == ComplianceActionExport {
+			delete(cj.jobs, id)
+		}
+	}
+}
+
+// SetJobRetention 设置已结束任务的保留时间，超时的任务及其导出数据会被清除
+func (fp *FeaturePipeline) SetJobRetention(retention time.Duration) {
+	fp.jobs.mutex.Lock()
+	defer fp.jobs.mutex.Unlock()
+	fp.jobs.retention = retention
+}
+
+// RegisterDataSource 注册额外的实体数据源（如血缘、备份、快照）
+func (fp *FeaturePipeline) RegisterDataSource(source EntityDataSource) {
+	fp.sourcesMutex.Lock()
+	defer fp.sourcesMutex.Unlock()
+	fp.sources = append(fp.sources, source)
+}
+
+// dataSources 返回按名称排序的数据源
+func (fp *FeaturePipeline) dataSources() []EntityDataSource {
+	fp.sourcesMutex.RLock()
+	defer fp.sourcesMutex.RUnlock()
+
+	sources := append([]EntityDataSource{fp.store}, fp.sources...)
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].SourceName() < sources[j].SourceName()
+	})
+	return sources
+}
+
+// DeleteEntityEverywhere 从所有数据源中清除实体数据并返回完成证明
+func (fp *FeaturePipeline) DeleteEntityEverywhere(entityID string) (*ComplianceCertificate, error) {
+	records := make(map[string]int)
+	for _, source := range fp.dataSources() {
+		count, err := source.DeleteEntity(entityID)
+		if err != nil {
+			return nil, fmt.Errorf("从 %s 删除实体 %s 失败: %v", source.SourceName(), entityID, err)
+		}
+		records[source.SourceName()] = count
+	}
+
+	// 导出任务的结果同样是实体数据
+	fp.jobs.purgeEntity(entityID)
+
+	return fp.certificate(entityID, ComplianceActionDelete, records, nil)
+}
+
+// ExportEntityData 导出实体在所有数据源中的数据
+func (fp *FeaturePipeline) ExportEntityData(entityID string) (*EntityExport, error) {
+	export := &EntityExport{
+		EntityID:   entityID,
+		ExportedAt: time.Now().UTC(),
+		Sources:    make(map[string]interface{}),
+	}
+
+	for _, source := range fp.dataSources() {
+		data, err := source.ExportEntity(entityID)
+		if err != nil {
+			return nil, fmt.Errorf("从 %s 导出实体 %s 失败: %v", source.SourceName(), entityID, err)
+		}
+		if data != nil {
+			export.Sources[source.SourceName()] = data
+		}
+	}
+
+	return export, nil
+}
+
+// SubmitDeletionJob 异步提交删除任务，返回任务ID
+func (fp *FeaturePipeline) SubmitDeletionJob(entityID string) string {
+	return fp.submitJob(entityID, ComplianceActionDelete)
+}
+
+// SubmitExportJob 异步提交导出任务，返回任务ID
+func (fp *FeaturePipeline) SubmitExportJob(entityID string) string {
+	return fp.submitJob(entityID, ComplianceActionExport)
+}
+
+// GetJob 查询异步合规任务
+func (fp *FeaturePipeline) GetJob(jobID string) (*ComplianceJob, bool) {
+	fp.jobs.mutex.Lock()
+	defer fp.jobs.mutex.Unlock()
+
+	fp.jobs.expireLocked(time.Now())
+	job, exists := fp.jobs.jobs[jobID]
+	if !exists {
+		return nil, false
+	}
+	snapshot := *job
+	return &snapshot, true
+}
+
+// submitJob 创建任务并在后台执行
+func (fp *FeaturePipeline) submitJob(entityID, action string) string {
+	fp.jobs.mutex.Lock()
+	fp.jobs.expireLocked(time.Now())
+	fp.jobs.seq++
+	job := &ComplianceJob{
+		ID:        fmt.Sprintf("%s-%d", action, fp.jobs.seq),
+		EntityID:  entityID,
+		Action:    action,
+		Status:    JobStatusPending,
+		CreatedAt: time.Now(),
+	}
+	fp.jobs.jobs[job.ID] = job
+	fp.jobs.mutex.Unlock()
+
+	go fp.runJob(job)
+	return job.ID
+}
+
+// runJob 执行合规任务并记录结果
+func (fp *FeaturePipeline) runJob(job *ComplianceJob) {
+	var (
+		export *EntityExport
+		cert   *ComplianceCertificate
+		err    error
+	)
+
+	switch job.Action {
+	case ComplianceActionDelete:
+		cert, err = fp.DeleteEntityEverywhere(job.EntityID)
+	case ComplianceActionExport:
+		export, err = fp.ExportEntityData(job.EntityID)
+		if err == nil {
+			var payload []byte
+			if payload, err = json.Marshal(export); err == nil {
+				cert, err = fp.certificate(job.EntityID, ComplianceActionExport, nil, payload)
+			}
+		}
+	}
+
+	fp.jobs.mutex.Lock()
+	defer fp.jobs.mutex.Unlock()
+
+	// 执行期间实体已被删除，丢弃导出结果
+	if fp.jobs.jobs[job.ID] != job {
+		return
+	}
+	job.FinishedAt = time.Now()
+	if err != nil {
+		job.Status = JobStatusFailed
+		job.Error = err.Error()
+		return
+	}
+	job.Status = JobStatusCompleted
+	job.Export = export
+	job.Certificate = cert
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// memorySource 测试用数据源
+type memorySource struct {
+	name string
+	data map[string][]string
+}
+
+func (ms *memorySource) SourceName() string { return ms.name }
+
+func (ms *memorySource) ExportEntity(entityID string) (interface{}, error) {
+	records, exists := ms.data[entityID]
+	if !exists {
+		return nil, nil
+	}
+	return records, nil
+}
+
+func (ms *memorySource) DeleteEntity(entityID string) (int, error) {
+	count := len(ms.data[entityID])
+	delete(ms.data, entityID)
+	return count, nil
+}
+
+func TestExportAndDeleteEntity(t *testing.T) {
+	pipeline := NewFeaturePipeline()
+	backups := &memorySource{name: "backups", data: map[string][]string{"user1": {"b1", "b2"}}}
+	pipeline.RegisterDataSource(backups)
+
+	fs := NewFeatureSet("user1")
+	fs.AddFeature(NewNumericFeature("age", 30))
+	pipeline.ProcessAndStore(fs)
+
+	export, err := pipeline.ExportEntityData("user1")
+	if err != nil {
+		t.Fatal("导出失败:", err)
+	}
+	if len(export.Sources) != 2 {
+		t.Errorf("期望导出2个数据源，实际%d个", len(export.Sources))
+	}
+
+	cert, err := pipeline.DeleteEntityEverywhere("user1")
+	if err != nil {
+		t.Fatal("删除失败:", err)
+	}
+	if cert.Records["feature_store"] != 1 || cert.Records["backups"] != 2 {
+		t.Errorf("删除记录数不正确: %v", cert.Records)
+	}
+	if cert.Digest == "" || cert.Signature == "" {
+		t.Error("证明缺少摘要或签名")
+	}
+	publicKey, err := pipeline.CertificatePublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCertificate(cert, nil, publicKey); err != nil {
+		t.Errorf("证明校验失败: %v", err)
+	}
+	forged := *cert
+	forged.Records = map[string]int{"feature_store": 0}
+	if err := VerifyCertificate(&forged, nil, publicKey); err == nil {
+		t.Error("篡改后的证明应校验失败")
+	}
+
+	if _, exists := pipeline.GetProcessedFeatures("user1"); exists {
+		t.Error("特征存储中的数据未被删除")
+	}
+	if _, exists := backups.data["user1"]; exists {
+		t.Error("备份中的数据未被删除")
+	}
+}
+
+func TestComplianceJobs(t *testing.T) {
+	pipeline := NewFeaturePipeline()
+
+	fs := NewFeatureSet("user2")
+	fs.AddFeature(NewCategoricalFeature("city", "北京"))
+	pipeline.ProcessAndStore(fs)
+
+	exportID := pipeline.SubmitExportJob("user2")
+	job := waitForJob(t, pipeline, exportID)
+	if job.Status != JobStatusCompleted || job.Export == nil || job.Certificate == nil {
+		t.Fatalf("导出任务结果不正确: %+v", job)
+	}
+
+	deleteID := pipeline.SubmitDeletionJob("user2")
+	job = waitForJob(t, pipeline, deleteID)
+	if job.Status != JobStatusCompleted || job.Certificate.Action != ComplianceActionDelete {
+		t.Fatalf("删除任务结果不正确: %+v", job)
+	}
+
+	if _, exists := pipeline.GetProcessedFeatures("user2"); exists {
+		t.Error("异步删除后数据仍存在")
+	}
+}
+
+func TestDeleteEntityPurgesExportJobs(t *testing.T) {
+	pipeline := NewFeaturePipeline()
+
+	fs := NewFeatureSet("user3")
+	fs.AddFeature(NewNumericFeature("age", 40))
+	pipeline.ProcessAndStore(fs)
+
+	exportID := pipeline.SubmitExportJob("user3")
+	job := waitForJob(t, pipeline, exportID)
+	payload, _ := json.Marshal(job.Export)
+	publicKey, _ := pipeline.CertificatePublicKey()
+	if err := VerifyCertificate(job.Certificate, payload, publicKey); err != nil {
+		t.Fatalf("导出证明校验失败: %v", err)
+	}
+
+	if _, err := pipeline.DeleteEntityEverywhere("user3"); err != nil {
+		t.Fatal("删除失败:", err)
+	}
+	if _, exists := pipeline.GetJob(exportID); exists {
+		t.Error("删除实体后导出任务中的数据仍存在")
+	}
+}
+
+func TestComplianceJobRetention(t *testing.T) {
+	pipeline := NewFeaturePipeline()
+	pipeline.SetJobRetention(50 * time.Millisecond)
+
+	exportID := pipeline.SubmitExportJob("user4")
+	waitForJob(t, pipeline, exportID)
+
+	time.Sleep(100 * time.Millisecond)
+	if _, exists := pipeline.GetJob(exportID); exists {
+		t.Error("超过保留时间的任务应被清除")
+	}
+}
+
+func waitForJob(t *testing.T, pipeline *FeaturePipeline, jobID string) *ComplianceJob {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		job, exists := pipeline.GetJob(jobID)
+		if !exists {
+			t.Fatalf("任务 %s 不存在", jobID)
+		}
+		if job.Status != JobStatusPending {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("任务 %s 超时", jobID)
+	return nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// numericIndexEntry 数值索引条目
+type numericIndexEntry struct {
+	value    float64
+	entityID string
+}
+
+// featureIndex 单个特征的二级索引：类别取值分桶，数值按值升序排列，
+// 在特征集合写入存储时更新，写入后再修改特征集合不会反映到索引中
+type featureIndex struct {
+	feature string
+	buckets map[string]map[string]bool
+	numeric []numericIndexEntry
+}
+
+func newFeatureIndex(feature string) *featureIndex {
+	return &featureIndex{feature: feature, buckets: make(map[string]map[string]bool)}
+}
+
+// numericPos 返回第一个不小于(value, entityID)的位置
+func (idx *featureIndex) numericPos(value float64, entityID string) int {
+	return sort.Search(len(idx.numeric), func(i int) bool {
+		entry := idx.numeric[i]
+		return entry.value > value || (entry.value == value && entry.entityID >= entityID)
+	})
+}
+
+func (idx *featureIndex) add(featureSet *FeatureSet) {
+	feature, exists := featureSet.features[idx.feature]
+	if !exists {
+		return
+	}
+	switch value := feature.Value().(type) {
+	case string:
+		bucket := idx.buckets[value]
+		if bucket == nil {
+			bucket = make(map[string]bool)
+			idx.buckets[value] = bucket
+		}
+		bucket[featureSet.userID] = true
+	case float64:
+		pos := idx.numericPos(value, featureSet.userID)
+		idx.numeric = append(idx.numeric, numericIndexEntry{})
+		copy(idx.numeric[pos+1:], idx.numeric[pos:])
+		idx.numeric[pos] = numericIndexEntry{value: value, entityID: featureSet.userID}
+	}
+}
+
+func (idx *featureIndex) remove(featureSet *FeatureSet) {
+	feature, exists := featureSet.features[idx.feature]
+	if !exists {
+		return
+	}
+	switch value := feature.Value().(type) {
+	case string:
+		if bucket := idx.buckets[value]; bucket != nil {
+			delete(bucket, featureSet.userID)
+			if len(bucket) == 0 {
+				delete(idx.buckets, value)
+			}
+		}
+	case float64:
+		pos := idx.numericPos(value, featureSet.userID)
+		if pos < len(idx.numeric) && idx.numeric[pos].entityID == featureSet.userID {
+			idx.numeric = append(idx.numeric[:pos], idx.numeric[pos+1:]...)
+		}
+	}
+}
+
+// lookupCategory 返回类别取值等于value的实体
+func (idx *featureIndex) lookupCategory(value string) map[string]bool {
+	result := make(map[string]bool, len(idx.buckets[value]))
+	for entityID := range idx.buckets[value] {
+		result[entityID] = true
+	}
+	return result
+}
+
+// lookupRange 返回数值满足 op bound 的实体，op为 = < <= > >=
+func (idx *featureIndex) lookupRange(op string, bound float64) map[string]bool {
+	lower := sort.Search(len(idx.numeric), func(i int) bool { return idx.numeric[i].value >= bound })
+	upper := sort.Search(len(idx.numeric), func(i int) bool { return idx.numeric[i].value > bound })
+
+	start, end := 0, len(idx.numeric)
+	switch op {
+	case "=":
+		start, end = lower, upper
+	case "<":
+		end = lower
+	case "<=":
+		end = upper
+	case ">":
+		start = upper
+	case ">=":
+		start = lower
+	}
+
+	result := make(map[string]bool, end-start)
+	for _, entry := range idx.numeric[start:end] {
+		result[entry.entityID] = true
+	}
+	return result
+}
+
+// CreateIndex 为特征创建二级索引并用已有数据填充，查询中该特征的等值、范围和IN条件会走索引
+func (fs *FeatureStore) CreateIndex(feature string) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	if _, exists := fs.indexes[feature]; exists {
+		return fmt.Errorf("特征 %s 的索引已存在", feature)
+	}
+	idx := newFeatureIndex(feature)
+	for _, featureSet := range fs.data {
+		idx.add(featureSet)
+	}
+	if fs.indexes == nil {
+		fs.indexes = make(map[string]*featureIndex)
+	}
+	fs.indexes[feature] = idx
+	return nil
+}
+
+// DropIndex 删除特征索引
+func (fs *FeatureStore) DropIndex(feature string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	delete(fs.indexes, feature)
+}
+
+// Indexes 按字典序返回已建索引的特征名
+func (fs *FeatureStore) Indexes() []string {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	names := make([]string, 0, len(fs.indexes))
+	for name := range fs.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// putLocked 写入特征集合并维护索引，调用方需持有写锁
+func (fs *FeatureStore) putLocked(featureSet *FeatureSet) {
+	fs.removeLocked(featureSet.userID)
+	fs.data[featureSet.userID] = featureSet
+	for _, idx := range fs.indexes {
+		idx.add(featureSet)
+	}
+}
+
+// removeLocked 删除特征集合并维护索引，调用方需持有写锁
+func (fs *FeatureStore) removeLocked(userID string) bool {
+	existing, exists := fs.data[userID]
+	if !exists {
+		return false
+	}
+	for _, idx := range fs.indexes {
+		idx.remove(existing)
+	}
+	delete(fs.data, userID)
+	return true
+}
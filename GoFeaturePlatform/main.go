@@ -1,12 +1,11 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"hash/fnv"
 	"math"
 	"sort"
-	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
@@ -199,9 +198,10 @@ func (ohe *OneHotEncoder) Transform(feature Feature) Feature {
 
 // FeatureStore 特征存储
 type FeatureStore struct {
-	data   map[string]*FeatureSet
-	mutex  sync.RWMutex
-	ttl    time.Duration
+	data    map[string]*FeatureSet
+	mutex   sync.RWMutex
+	ttl     time.Duration
+	indexes map[string]*featureIndex
 }
 
 // NewFeatureStore 创建特征存储
@@ -221,7 +221,7 @@ func NewFeatureStore(ttl time.Duration) *FeatureStore {
 func (fs *FeatureStore) Store(featureSet *FeatureSet) {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-	fs.data[featureSet.userID] = featureSet
+	fs.putLocked(featureSet)
 }
 
 // Get 获取特征集合
@@ -236,7 +236,7 @@ func (fs *FeatureStore) Get(userID string) (*FeatureSet, bool) {
 func (fs *FeatureStore) Delete(userID string) {
 	fs.mutex.Lock()
 	defer fs.mutex.Unlock()
-	delete(fs.data, userID)
+	fs.removeLocked(userID)
 }
 
 // cleanup 清理过期数据
@@ -248,7 +248,7 @@ func (fs *FeatureStore) cleanup() {
 		fs.mutex.Lock()
 		for userID, featureSet := range fs.data {
 			if time.Since(featureSet.timestamp) > fs.ttl {
-				delete(fs.data, userID)
+				fs.removeLocked(userID)
 			}
 		}
 		fs.mutex.Unlock()
@@ -258,6 +258,7 @@ func (fs *FeatureStore) cleanup() {
 // FeatureEngine 特征计算引擎
 type FeatureEngine struct {
 	transformers []FeatureTransformer
+	derived      []*DerivedFeature
 	store        *FeatureStore
 }
 
@@ -297,13 +298,22 @@ func (fe *FeatureEngine) ProcessFeatureSet(featureSet *FeatureSet) *FeatureSet {
 		}
 	}
 
+	// 计算公式定义的派生特征
+	fe.applyDerived(processed)
+
 	return processed
 }
 
 // FeaturePipeline 特征处理管道
 type FeaturePipeline struct {
-	engine *FeatureEngine
-	store  *FeatureStore
+	engine       *FeatureEngine
+	store        *FeatureStore
+	schema       *SchemaRegistry
+	sources      []EntityDataSource
+	sourcesMutex sync.RWMutex
+	jobs         complianceJobs
+	certKey      ed25519.PrivateKey
+	keyMutex     sync.Mutex
 }
 
 // NewFeaturePipeline 创建特征处理管道
@@ -314,6 +324,8 @@ func NewFeaturePipeline() *FeaturePipeline {
 	return &FeaturePipeline{
 		engine: engine,
 		store:  store,
+		schema: NewSchemaRegistry(),
+		jobs:   complianceJobs{jobs: make(map[string]*ComplianceJob), retention: DefaultJobRetention},
 	}
 }
 
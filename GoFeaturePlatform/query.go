@@ -0,0 +1,753 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 查询语言：SELECT 特征列表|* FROM 存储 [WHERE 条件] [ORDER BY 特征 [ASC|DESC]] [LIMIT n]，
+// 条件支持 = != <> < <= > >=、[NOT] IN (...)、IS [NOT] NULL、AND/OR/NOT 和括号，例如
+// "SELECT age, income FROM features WHERE city IN ('北京', '上海') AND age >= 30 ORDER BY income DESC LIMIT 10"
+
+// QueryStoreName 管道特征存储在查询中的名称
+const QueryStoreName = "features"
+
+// QueryEntityColumn 实体ID伪列，可用于ORDER BY
+const QueryEntityColumn = "entity_id"
+
+// queryPredicate WHERE条件语法树节点。实体缺少条件引用的特征时比较结果为假
+type queryPredicate interface {
+	match(featureSet *FeatureSet) bool
+}
+
+// queryLiteral 字面量，数值特征只能与数字比较，类别特征只能与字符串比较
+type queryLiteral struct {
+	isNumber bool
+	number   float64
+	text     string
+}
+
+func (l queryLiteral) String() string {
+	if l.isNumber {
+		return strconv.FormatFloat(l.number, 'g', -1, 64)
+	}
+	return strconv.Quote(l.text)
+}
+
+// compare 返回特征值与字面量的比较结果，类型不符或缺少特征时ok为false
+func (l queryLiteral) compare(featureSet *FeatureSet, feature string) (int, bool) {
+	f, exists := featureSet.features[feature]
+	if !exists {
+		return 0, false
+	}
+	switch value := f.Value().(type) {
+	case float64:
+		if !l.isNumber {
+			return 0, false
+		}
+		switch {
+		case value < l.number:
+			return -1, true
+		case value > l.number:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		if l.isNumber {
+			return 0, false
+		}
+		return strings.Compare(value, l.text), true
+	}
+	return 0, false
+}
+
+type queryCompare struct {
+	feature string
+	op      string
+	value   queryLiteral
+}
+
+func (n queryCompare) match(featureSet *FeatureSet) bool {
+	cmp, ok := n.value.compare(featureSet, n.feature)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+type queryIn struct {
+	feature string
+	values  []queryLiteral
+	negate  bool
+}
+
+func (n queryIn) match(featureSet *FeatureSet) bool {
+	if _, exists := featureSet.features[n.feature]; !exists {
+		return false
+	}
+	for _, value := range n.values {
+		if cmp, ok := value.compare(featureSet, n.feature); ok && cmp == 0 {
+			return !n.negate
+		}
+	}
+	return n.negate
+}
+
+type queryIsNull struct {
+	feature string
+	negate  bool
+}
+
+func (n queryIsNull) match(featureSet *FeatureSet) bool {
+	_, exists := featureSet.features[n.feature]
+	return exists == n.negate
+}
+
+type queryNot struct{ operand queryPredicate }
+
+func (n queryNot) match(featureSet *FeatureSet) bool { return !n.operand.match(featureSet) }
+
+type queryLogical struct {
+	and      bool
+	operands []queryPredicate
+}
+
+func (n queryLogical) match(featureSet *FeatureSet) bool {
+	for _, operand := range n.operands {
+		if operand.match(featureSet) != n.and {
+			return !n.and
+		}
+	}
+	return n.and
+}
+
+// queryToken 词法单元
+type queryToken struct {
+	kind byte // 'n'数字 's'字符串 'i'标识符 'o'比较运算符 其余为标点本身，0表示结束
+	text string
+	pos  int
+}
+
+func tokenizeQuery(sql string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(sql)
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.' || (c == '-' && i+1 < len(runes) && (unicode.IsDigit(runes[i+1]) || runes[i+1] == '.')):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: 'n', text: string(runes[start:i]), pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: 'i', text: string(runes[start:i]), pos: start})
+		case c == '\'':
+			start := i
+			var text strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("位置%d: 字符串未结束", start)
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						text.WriteRune('\'')
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				text.WriteRune(runes[i])
+			}
+			tokens = append(tokens, queryToken{kind: 's', text: text.String(), pos: start})
+		case strings.ContainsRune("=<>!", c):
+			start := i
+			i++
+			if i < len(runes) && (runes[i] == '=' || (c == '<' && runes[i] == '>')) {
+				i++
+			}
+			op := string(runes[start:i])
+			switch op {
+			case "<>":
+				op = "!="
+			case "!":
+				return nil, fmt.Errorf("位置%d: 无法识别的运算符 !", start)
+			case "==":
+				op = "="
+			}
+			tokens = append(tokens, queryToken{kind: 'o', text: op, pos: start})
+		case strings.ContainsRune("(),*", c):
+			tokens = append(tokens, queryToken{kind: byte(c), text: string(c), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("位置%d: 无法识别的字符 %q", i, c)
+		}
+	}
+	return append(tokens, queryToken{pos: len(runes)}), nil
+}
+
+// queryParser 递归下降解析器，解析时按模式注册表校验特征引用和字面量类型
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	schema *SchemaRegistry
+}
+
+func (p *queryParser) peek() queryToken { return p.tokens[p.pos] }
+
+func (p *queryParser) next() queryToken {
+	token := p.tokens[p.pos]
+	if token.kind != 0 {
+		p.pos++
+	}
+	return token
+}
+
+// keyword 当前词法单元是指定关键字（不区分大小写）时消费它
+func (p *queryParser) keyword(word string) bool {
+	token := p.peek()
+	if token.kind == 'i' && strings.EqualFold(token.text, word) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expectKeyword(word string) error {
+	if !p.keyword(word) {
+		return fmt.Errorf("位置%d: 期望 %s", p.peek().pos, word)
+	}
+	return nil
+}
+
+func (p *queryParser) expect(kind byte) error {
+	if token := p.next(); token.kind != kind {
+		return fmt.Errorf("位置%d: 期望 %q", token.pos, kind)
+	}
+	return nil
+}
+
+var queryKeywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true, "NOT": true, "IN": true,
+	"IS": true, "NULL": true, "ORDER": true, "BY": true, "ASC": true, "DESC": true, "LIMIT": true,
+}
+
+func (p *queryParser) identifier() (queryToken, error) {
+	token := p.next()
+	if token.kind != 'i' || queryKeywords[strings.ToUpper(token.text)] {
+		if token.kind == 0 {
+			return token, fmt.Errorf("位置%d: 查询不完整", token.pos)
+		}
+		return token, fmt.Errorf("位置%d: 期望特征名，得到 %q", token.pos, token.text)
+	}
+	return token, nil
+}
+
+// feature 读取特征名并返回其注册类型
+func (p *queryParser) feature() (queryToken, string, error) {
+	token, err := p.identifier()
+	if err != nil {
+		return token, "", err
+	}
+	featureType, exists := p.schema.Lookup(token.text)
+	if !exists {
+		return token, "", fmt.Errorf("位置%d: 特征 %s 未在模式中注册", token.pos, token.text)
+	}
+	return token, featureType, nil
+}
+
+func (p *queryParser) literal(name queryToken, featureType string) (queryLiteral, error) {
+	token := p.next()
+	switch token.kind {
+	case 'n':
+		value, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return queryLiteral{}, fmt.Errorf("位置%d: 无效的数字 %q", token.pos, token.text)
+		}
+		if featureType != FeatureTypeNumeric {
+			return queryLiteral{}, fmt.Errorf("位置%d: 特征 %s 是 %s 类型，不能与数字比较", token.pos, name.text, featureType)
+		}
+		return queryLiteral{isNumber: true, number: value}, nil
+	case 's':
+		if featureType != FeatureTypeCategorical {
+			return queryLiteral{}, fmt.Errorf("位置%d: 特征 %s 是 %s 类型，不能与字符串比较", token.pos, name.text, featureType)
+		}
+		return queryLiteral{text: token.text}, nil
+	case 0:
+		return queryLiteral{}, fmt.Errorf("位置%d: 查询不完整", token.pos)
+	default:
+		return queryLiteral{}, fmt.Errorf("位置%d: 期望字面量，得到 %q", token.pos, token.text)
+	}
+}
+
+// or := and (OR and)*
+func (p *queryParser) or() (queryPredicate, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	operands := []queryPredicate{left}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, right)
+	}
+	if len(operands) == 1 {
+		return left, nil
+	}
+	return queryLogical{operands: operands}, nil
+}
+
+// and := unary (AND unary)*
+func (p *queryParser) and() (queryPredicate, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	operands := []queryPredicate{left}
+	for p.keyword("AND") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, right)
+	}
+	if len(operands) == 1 {
+		return left, nil
+	}
+	return queryLogical{and: true, operands: operands}, nil
+}
+
+// unary := NOT unary | '(' or ')' | condition
+func (p *queryParser) unary() (queryPredicate, error) {
+	if p.keyword("NOT") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return queryNot{operand: operand}, nil
+	}
+	if p.peek().kind == '(' {
+		p.next()
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return node, p.expect(')')
+	}
+	return p.condition()
+}
+
+// condition := feature (op literal | [NOT] IN '(' literal (',' literal)* ')' | IS [NOT] NULL)
+func (p *queryParser) condition() (queryPredicate, error) {
+	name, featureType, err := p.feature()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.keyword("IS") {
+		negate := p.keyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return queryIsNull{feature: name.text, negate: negate}, nil
+	}
+	if featureType == FeatureTypeVector {
+		return nil, fmt.Errorf("位置%d: 向量特征 %s 只支持 IS [NOT] NULL 条件", name.pos, name.text)
+	}
+
+	negate := p.keyword("NOT")
+	if negate || p.peek().kind == 'i' {
+		if err := p.expectKeyword("IN"); err != nil {
+			return nil, err
+		}
+		if err := p.expect('('); err != nil {
+			return nil, err
+		}
+		node := queryIn{feature: name.text, negate: negate}
+		for {
+			value, err := p.literal(name, featureType)
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, value)
+			if p.peek().kind != ',' {
+				break
+			}
+			p.next()
+		}
+		return node, p.expect(')')
+	}
+
+	op := p.next()
+	if op.kind != 'o' {
+		return nil, fmt.Errorf("位置%d: 期望比较运算符", op.pos)
+	}
+	value, err := p.literal(name, featureType)
+	if err != nil {
+		return nil, err
+	}
+	return queryCompare{feature: name.text, op: op.text, value: value}, nil
+}
+
+// Query 编译后的查询
+type Query struct {
+	SQL     string
+	Columns []string // 为空表示SELECT *
+	Source  string
+	OrderBy string
+	Desc    bool
+	Limit   int // 小于0表示不限
+	where   queryPredicate
+}
+
+// CompileQuery 解析查询并按模式注册表校验：引用的特征必须已注册，字面量类型必须与特征类型一致
+func CompileQuery(sql string, schema *SchemaRegistry) (*Query, error) {
+	tokens, err := tokenizeQuery(sql)
+	if err != nil {
+		return nil, fmt.Errorf("查询: %v", err)
+	}
+	p := &queryParser{tokens: tokens, schema: schema}
+	query, err := p.query()
+	if err != nil {
+		return nil, fmt.Errorf("查询: %v", err)
+	}
+	query.SQL = sql
+	return query, nil
+}
+
+func (p *queryParser) query() (*Query, error) {
+	query := &Query{Limit: -1}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	if p.peek().kind == '*' {
+		p.next()
+	} else {
+		for {
+			name, _, err := p.feature()
+			if err != nil {
+				return nil, err
+			}
+			query.Columns = append(query.Columns, name.text)
+			if p.peek().kind != ',' {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	source, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	query.Source = source.text
+
+	if p.keyword("WHERE") {
+		if query.where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.keyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if p.peek().kind == 'i' && p.peek().text == QueryEntityColumn {
+			query.OrderBy = p.next().text
+		} else {
+			name, featureType, err := p.feature()
+			if err != nil {
+				return nil, err
+			}
+			if featureType == FeatureTypeVector {
+				return nil, fmt.Errorf("位置%d: 不能按向量特征 %s 排序", name.pos, name.text)
+			}
+			query.OrderBy = name.text
+		}
+		if p.keyword("DESC") {
+			query.Desc = true
+		} else {
+			p.keyword("ASC")
+		}
+	}
+
+	if p.keyword("LIMIT") {
+		token := p.next()
+		limit, err := strconv.Atoi(token.text)
+		if token.kind != 'n' || err != nil || limit < 0 {
+			return nil, fmt.Errorf("位置%d: 无效的LIMIT %q", token.pos, token.text)
+		}
+		query.Limit = limit
+	}
+
+	if token := p.peek(); token.kind != 0 {
+		return nil, fmt.Errorf("位置%d: 多余的 %q", token.pos, token.text)
+	}
+	return query, nil
+}
+
+// QueryRow 查询结果的一行，缺少的特征不出现在Values中
+type QueryRow struct {
+	EntityID string                 `json:"entity_id"`
+	Values   map[string]interface{} `json:"values"`
+}
+
+// QueryResult 查询结果
+type QueryResult struct {
+	Columns []string   `json:"columns"`
+	Rows    []QueryRow `json:"rows"`
+	Plan    string     `json:"plan"`    // 执行计划，例如 "index(city)" 或 "full scan"
+	Scanned int        `json:"scanned"` // 实际检查的实体数
+}
+
+// candidatesLocked 用索引计算可能满足条件的实体集合，无法使用索引时ok为false。调用方需持有读锁
+func (fs *FeatureStore) candidatesLocked(where queryPredicate) (map[string]bool, []string, bool) {
+	switch node := where.(type) {
+	case queryCompare:
+		idx, exists := fs.indexes[node.feature]
+		if !exists || node.op == "!=" {
+			return nil, nil, false
+		}
+		if node.value.isNumber {
+			return idx.lookupRange(node.op, node.value.number), []string{node.feature}, true
+		}
+		if node.op != "=" {
+			return nil, nil, false
+		}
+		return idx.lookupCategory(node.value.text), []string{node.feature}, true
+	case queryIn:
+		idx, exists := fs.indexes[node.feature]
+		if !exists || node.negate {
+			return nil, nil, false
+		}
+		result := make(map[string]bool)
+		for _, value := range node.values {
+			var matched map[string]bool
+			if value.isNumber {
+				matched = idx.lookupRange("=", value.number)
+			} else {
+				matched = idx.lookupCategory(value.text)
+			}
+			for entityID := range matched {
+				result[entityID] = true
+			}
+		}
+		return result, []string{node.feature}, true
+	case queryLogical:
+		if node.and {
+			// 合取：取所有可用索引结果的交集
+			var result map[string]bool
+			var used []string
+			for _, operand := range node.operands {
+				set, features, ok := fs.candidatesLocked(operand)
+				if !ok {
+					continue
+				}
+				used = append(used, features...)
+				if result == nil {
+					result = set
+					continue
+				}
+				for entityID := range result {
+					if !set[entityID] {
+						delete(result, entityID)
+					}
+				}
+			}
+			return result, used, result != nil
+		}
+		// 析取：所有分支都能用索引时取并集
+		result := make(map[string]bool)
+		var used []string
+		for _, operand := range node.operands {
+			set, features, ok := fs.candidatesLocked(operand)
+			if !ok {
+				return nil, nil, false
+			}
+			used = append(used, features...)
+			for entityID := range set {
+				result[entityID] = true
+			}
+		}
+		return result, used, true
+	}
+	return nil, nil, false
+}
+
+// Execute 在特征存储上执行查询：先用索引缩小候选实体，再逐个检查完整条件
+func (fs *FeatureStore) Execute(query *Query) *QueryResult {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	result := &QueryResult{Plan: "full scan"}
+	var candidates []*FeatureSet
+	if query.where != nil {
+		if set, used, ok := fs.candidatesLocked(query.where); ok {
+			result.Plan = fmt.Sprintf("index(%s)", strings.Join(dedupStrings(used), ", "))
+			for entityID := range set {
+				if featureSet, exists := fs.data[entityID]; exists {
+					candidates = append(candidates, featureSet)
+				}
+			}
+		}
+	}
+	if result.Plan == "full scan" {
+		for _, featureSet := range fs.data {
+			candidates = append(candidates, featureSet)
+		}
+	}
+	result.Scanned = len(candidates)
+
+	var matched []*FeatureSet
+	for _, featureSet := range candidates {
+		if query.where == nil || query.where.match(featureSet) {
+			matched = append(matched, featureSet)
+		}
+	}
+	sortQueryRows(matched, query.OrderBy, query.Desc)
+	if query.Limit >= 0 && len(matched) > query.Limit {
+		matched = matched[:query.Limit]
+	}
+
+	result.Columns = query.Columns
+	if len(result.Columns) == 0 {
+		columns := make(map[string]bool)
+		for _, featureSet := range matched {
+			for name := range featureSet.features {
+				columns[name] = true
+			}
+		}
+		for name := range columns {
+			result.Columns = append(result.Columns, name)
+		}
+		sort.Strings(result.Columns)
+	}
+
+	result.Rows = make([]QueryRow, 0, len(matched))
+	for _, featureSet := range matched {
+		row := QueryRow{EntityID: featureSet.userID, Values: make(map[string]interface{}, len(result.Columns))}
+		for _, column := range result.Columns {
+			if feature, exists := featureSet.features[column]; exists {
+				row.Values[column] = feature.Value()
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result
+}
+
+// sortQueryRows 按排序特征排序，缺少该特征的实体排在最后；未指定排序或取值相同时按实体ID排序
+func sortQueryRows(rows []*FeatureSet, orderBy string, desc bool) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if orderBy != "" && orderBy != QueryEntityColumn {
+			fa, okA := a.features[orderBy]
+			fb, okB := b.features[orderBy]
+			if okA != okB {
+				return okA
+			}
+			if okA {
+				cmp := compareFeatureValues(fa.Value(), fb.Value())
+				if cmp != 0 {
+					return (cmp < 0) != desc
+				}
+			}
+		}
+		if orderBy == QueryEntityColumn && desc {
+			return a.userID > b.userID
+		}
+		return a.userID < b.userID
+	})
+}
+
+// compareFeatureValues 比较两个同类型的特征值，类型不同时数值排在前面
+func compareFeatureValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return -1
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 1
+		}
+		return strings.Compare(x, y)
+	}
+	return 0
+}
+
+func dedupStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Query 编译并在管道特征存储上执行查询，FROM子句必须是 features
+func (fp *FeaturePipeline) Query(sql string) (*QueryResult, error) {
+	query, err := CompileQuery(sql, fp.schema)
+	if err != nil {
+		return nil, err
+	}
+	if query.Source != QueryStoreName {
+		return nil, fmt.Errorf("查询: 未知的数据源 %s", query.Source)
+	}
+	return fp.store.Execute(query), nil
+}
+
+// CreateIndex 为管道特征存储中的特征创建索引，特征必须已在模式中注册
+func (fp *FeaturePipeline) CreateIndex(feature string) error {
+	featureType, exists := fp.schema.Lookup(feature)
+	if !exists {
+		return fmt.Errorf("特征 %s 未在模式中注册", feature)
+	}
+	if featureType == FeatureTypeVector {
+		return fmt.Errorf("不能为向量特征 %s 创建索引", feature)
+	}
+	return fp.store.CreateIndex(feature)
+}
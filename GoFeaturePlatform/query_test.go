@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func queryPipeline() *FeaturePipeline {
+	pipeline := NewFeaturePipeline()
+	pipeline.Schema().Register("age", FeatureTypeNumeric)
+	pipeline.Schema().Register("income", FeatureTypeNumeric)
+	pipeline.Schema().Register("city", FeatureTypeCategorical)
+	pipeline.Schema().Register("embedding", FeatureTypeVector)
+
+	users := []struct {
+		id     string
+		age    float64
+		income float64
+		city   string
+	}{
+		{"u1", 25, 5000, "北京"},
+		{"u2", 32, 9000, "上海"},
+		{"u3", 41, 12000, "北京"},
+		{"u4", 36, 7000, "深圳"},
+	}
+	for _, u := range users {
+		featureSet := NewFeatureSet(u.id)
+		featureSet.AddFeature(NewNumericFeature("age", u.age))
+		featureSet.AddFeature(NewNumericFeature("income", u.income))
+		featureSet.AddFeature(NewCategoricalFeature("city", u.city))
+		pipeline.store.Store(featureSet)
+	}
+	// u5缺少income
+	partial := NewFeatureSet("u5")
+	partial.AddFeature(NewNumericFeature("age", 29))
+	partial.AddFeature(NewCategoricalFeature("city", "上海"))
+	pipeline.store.Store(partial)
+	return pipeline
+}
+
+func rowIDs(result *QueryResult) string {
+	ids := make([]string, len(result.Rows))
+	for i, row := range result.Rows {
+		ids[i] = row.EntityID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestQuery(t *testing.T) {
+	pipeline := queryPipeline()
+
+	cases := []struct {
+		sql      string
+		expected string
+	}{
+		{"SELECT * FROM features", "u1,u2,u3,u4,u5"},
+		{"select age from features where city = '北京'", "u1,u3"},
+		{"SELECT age FROM features WHERE age >= 30 AND city != '深圳' ORDER BY age DESC", "u3,u2"},
+		{"SELECT income FROM features WHERE city IN ('上海', '深圳') OR age < 26 ORDER BY income", "u1,u4,u2,u5"},
+		{"SELECT age FROM features WHERE NOT (age > 30) ORDER BY age DESC LIMIT 2", "u5,u1"},
+		{"SELECT age FROM features WHERE income IS NULL", "u5"},
+		{"SELECT age FROM features WHERE city NOT IN ('北京') AND income IS NOT NULL", "u2,u4"},
+		{"SELECT age FROM features ORDER BY entity_id DESC LIMIT 1", "u5"},
+	}
+	for _, c := range cases {
+		result, err := pipeline.Query(c.sql)
+		if err != nil {
+			t.Fatalf("%s: %v", c.sql, err)
+		}
+		if got := rowIDs(result); got != c.expected {
+			t.Errorf("%s: 期望 %s，得到 %s", c.sql, c.expected, got)
+		}
+	}
+
+	result, _ := pipeline.Query("SELECT age, city FROM features WHERE age = 25")
+	if len(result.Columns) != 2 || result.Rows[0].Values["city"] != "北京" || result.Rows[0].Values["age"] != 25.0 {
+		t.Errorf("查询结果列不正确: %+v", result)
+	}
+	result, _ = pipeline.Query("SELECT * FROM features WHERE age <= 29")
+	if len(result.Columns) != 3 || len(result.Rows[1].Values) != 2 {
+		t.Errorf("SELECT * 应返回所有列且缺失值不出现: %+v", result)
+	}
+}
+
+func TestQueryValidation(t *testing.T) {
+	pipeline := queryPipeline()
+
+	invalid := []string{
+		"SELECT age FROM features WHERE unknown = 1",
+		"SELECT age FROM features WHERE city > 3",
+		"SELECT age FROM features WHERE age = 'old'",
+		"SELECT age FROM features WHERE embedding = 1",
+		"SELECT age FROM features ORDER BY embedding",
+		"SELECT age FROM features LIMIT -1",
+		"SELECT age FROM features WHERE city = '北京",
+		"SELECT age FROM features WHERE (age > 1",
+		"SELECT age FROM features extra",
+		"SELECT age FROM other",
+		"SELECT FROM features",
+	}
+	for _, sql := range invalid {
+		if _, err := pipeline.Query(sql); err == nil {
+			t.Errorf("期望查询无效: %s", sql)
+		}
+	}
+
+	if _, err := pipeline.Query("SELECT embedding FROM features WHERE embedding IS NULL"); err != nil {
+		t.Errorf("向量特征应支持IS NULL: %v", err)
+	}
+	if err := pipeline.CreateIndex("embedding"); err == nil {
+		t.Error("不应允许为向量特征建索引")
+	}
+	if err := pipeline.CreateIndex("unknown"); err == nil {
+		t.Error("不应允许为未注册特征建索引")
+	}
+}
+
+func TestQueryIndex(t *testing.T) {
+	pipeline := queryPipeline()
+	if err := pipeline.CreateIndex("city"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pipeline.CreateIndex("age"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pipeline.CreateIndex("age"); err == nil {
+		t.Error("重复建索引应返回错误")
+	}
+
+	// 索引查询的结果必须与全表扫描一致
+	queries := []string{
+		"SELECT age FROM features WHERE city = '北京'",
+		"SELECT age FROM features WHERE age > 30 AND age <= 36",
+		"SELECT age FROM features WHERE city IN ('上海', '深圳') AND age < 35",
+		"SELECT age FROM features WHERE city = '北京' OR age = 36",
+	}
+	for _, sql := range queries {
+		indexed, err := pipeline.Query(sql)
+		if err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+		query, _ := CompileQuery(sql, pipeline.Schema())
+		plain := NewFeatureStore(time.Hour)
+		for _, id := range []string{"u1", "u2", "u3", "u4", "u5"} {
+			featureSet, _ := pipeline.store.Get(id)
+			plain.Store(featureSet)
+		}
+		scanned := plain.Execute(query)
+		if !strings.HasPrefix(indexed.Plan, "index(") || scanned.Plan != "full scan" {
+			t.Errorf("%s: 执行计划不正确 %s / %s", sql, indexed.Plan, scanned.Plan)
+		}
+		if rowIDs(indexed) != rowIDs(scanned) {
+			t.Errorf("%s: 索引结果 %s 与全表扫描 %s 不一致", sql, rowIDs(indexed), rowIDs(scanned))
+		}
+		if indexed.Scanned >= scanned.Scanned {
+			t.Errorf("%s: 索引应减少扫描的实体数 %d >= %d", sql, indexed.Scanned, scanned.Scanned)
+		}
+	}
+
+	result, _ := pipeline.Query("SELECT age FROM features WHERE city != '北京'")
+	if result.Plan != "full scan" {
+		t.Errorf("不等条件不应使用索引: %s", result.Plan)
+	}
+
+	// 覆盖写入和删除需要同步维护索引
+	moved := NewFeatureSet("u1")
+	moved.AddFeature(NewNumericFeature("age", 26))
+	moved.AddFeature(NewCategoricalFeature("city", "深圳"))
+	pipeline.store.Store(moved)
+	pipeline.store.Delete("u3")
+	if _, err := pipeline.store.DeleteEntity("u4"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ = pipeline.Query("SELECT age FROM features WHERE city = '北京'")
+	if len(result.Rows) != 0 {
+		t.Errorf("索引未随写入删除更新: %s", rowIDs(result))
+	}
+	result, _ = pipeline.Query("SELECT age FROM features WHERE city = '深圳' AND age = 26")
+	if rowIDs(result) != "u1" || result.Scanned != 1 {
+		t.Errorf("期望命中u1，得到 %s (scanned %d)", rowIDs(result), result.Scanned)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 特征类型，与Feature.Type()的返回值一致
+const (
+	FeatureTypeNumeric     = "numeric"
+	FeatureTypeCategorical = "categorical"
+	FeatureTypeVector      = "vector"
+)
+
+// SchemaRegistry 特征模式注册表，记录每个特征名对应的类型
+type SchemaRegistry struct {
+	types map[string]string
+	mutex sync.RWMutex
+}
+
+// NewSchemaRegistry 创建模式注册表
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{types: make(map[string]string)}
+}
+
+// Register 注册特征类型，同名特征不能改变类型
+func (sr *SchemaRegistry) Register(name, featureType string) error {
+	switch featureType {
+	case FeatureTypeNumeric, FeatureTypeCategorical, FeatureTypeVector:
+	default:
+		return fmt.Errorf("未知的特征类型: %s", featureType)
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	if existing, exists := sr.types[name]; exists && existing != featureType {
+		return fmt.Errorf("特征 %s 已注册为 %s 类型", name, existing)
+	}
+	sr.types[name] = featureType
+	return nil
+}
+
+// Lookup 查询特征类型
+func (sr *SchemaRegistry) Lookup(name string) (string, bool) {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	featureType, exists := sr.types[name]
+	return featureType, exists
+}
+
+// Names 按字典序返回所有已注册的特征名
+func (sr *SchemaRegistry) Names() []string {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	names := make([]string, 0, len(sr.types))
+	for name := range sr.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// archiveEntry 本次同步新写入归档的文件，内容已压缩到临时文件
+type archiveEntry struct {
+	header *zip.FileHeader
+	tmp    string
+}
+
+// archiveBuilder 以zip归档作为目标时收集本次同步的变更，最后一次性写出新归档。
+// 未变化的文件从旧归档原样复制，不重新压缩
+type archiveBuilder struct {
+	path    string
+	old     *zip.ReadCloser
+	mutex   sync.Mutex
+	added   map[string]*archiveEntry
+	removed map[string]bool
+}
+
+// readArchive 打开归档并按相对路径（系统分隔符）索引其中的文件，归档不存在时返回nil
+func readArchive(archivePath string) (*zip.ReadCloser, map[string]*zip.File, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if os.IsNotExist(err) {
+		return nil, map[string]*zip.File{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取归档失败 %s: %v", archivePath, err)
+	}
+	entries := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() {
+			entries[filepath.FromSlash(file.Name)] = file
+		}
+	}
+	return reader, entries, nil
+}
+
+// planArchive 对比源目录和归档中的文件，归档条目的注释保存内容的哈希
+func (fs *FileSync) planArchive() ([]SyncAction, map[string]*FileInfo, *zip.ReadCloser, error) {
+	if err := fs.compression().validate(); err != nil {
+		return nil, nil, nil, err
+	}
+	srcFiles, err := fs.scanDirectory(fs.config.SourceDir)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("扫描源目录失败: %v", err)
+	}
+	reader, entries, err := readArchive(fs.config.Archive)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var copies, deletes []SyncAction
+	for relPath, srcInfo := range srcFiles {
+		entry, exists := entries[relPath]
+		if !exists || entry.Comment != srcInfo.Hash {
+			copies = append(copies, SyncAction{Op: ActionCopy, Path: relPath, Size: srcInfo.Size})
+		}
+	}
+	if fs.config.DeleteExtra {
+		for relPath, entry := range entries {
+			if _, exists := srcFiles[relPath]; !exists {
+				deletes = append(deletes, SyncAction{Op: ActionDelete, Path: relPath, Size: int64(entry.UncompressedSize64)})
+			}
+		}
+	}
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Path < copies[j].Path })
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path < deletes[j].Path })
+	return append(copies, deletes...), srcFiles, reader, nil
+}
+
+// compression 归档和压缩存储使用的压缩配置
+func (fs *FileSync) compression() *CompressionConfig {
+	if fs.config.Compression != nil {
+		return fs.config.Compression
+	}
+	return &CompressionConfig{}
+}
+
+// runArchive 把源目录同步到zip归档：变化的文件并发压缩到临时文件，之后写出新归档并替换旧归档
+func (fs *FileSync) runArchive(result *RunResult) error {
+	actions, srcFiles, reader, err := fs.planArchive()
+	if err != nil {
+		return err
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+	if len(actions) == 0 {
+		fmt.Printf("归档已是最新，源目录%d个文件\n", len(srcFiles))
+		return nil
+	}
+	if err := fs.applyArchive(actions, srcFiles, reader, result); err != nil {
+		return err
+	}
+	fmt.Printf("归档同步完成，源目录%d个文件\n", len(srcFiles))
+	return nil
+}
+
+// applyArchive 执行归档的同步操作，reader为旧归档（不存在时为nil）
+func (fs *FileSync) applyArchive(actions []SyncAction, srcFiles map[string]*FileInfo, reader *zip.ReadCloser, result *RunResult) error {
+	fs.archive = &archiveBuilder{path: fs.config.Archive, old: reader, added: make(map[string]*archiveEntry), removed: make(map[string]bool)}
+	defer func() {
+		fs.archive.cleanup()
+		fs.archive = nil
+	}()
+	fs.execute(actions, srcFiles, result)
+	return fs.archive.commit()
+}
+
+// addToArchive 压缩源文件到临时文件，计算CRC32和内容哈希，返回压缩后的字节数
+func (fs *FileSync) addToArchive(relPath string, fileInfo *FileInfo) (int64, error) {
+	srcPath := filepath.Join(fs.config.SourceDir, relPath)
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, fmt.Errorf("打开源文件失败 %s: %v", srcPath, err)
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp("", "filesync-archive-*")
+	if err != nil {
+		return 0, err
+	}
+	keep := false
+	defer func() {
+		tmp.Close()
+		if !keep {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	header := &zip.FileHeader{Name: filepath.ToSlash(relPath), Modified: fileInfo.ModTime, Method: zip.Store}
+	header.SetMode(fileInfo.Mode.Perm())
+	var out io.Writer = tmp
+	var compressor *flate.Writer
+	if fs.compression().compresses(relPath) {
+		header.Method = zip.Deflate
+		if compressor, err = flate.NewWriter(tmp, fs.compression().level()); err != nil {
+			return 0, err
+		}
+		out = compressor
+	}
+
+	checksum, hash := crc32.NewIEEE(), fs.newHash()
+	size, err := io.Copy(io.MultiWriter(out, checksum, hash), fs.track(fs.throttle(src), fileInfo))
+	if err != nil {
+		return 0, fmt.Errorf("压缩文件失败 %s: %v", srcPath, err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return 0, err
+		}
+	}
+	compressed, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	// 注释记录实际写入的内容的哈希，复制过程中源文件被修改时下次同步会重新压缩
+	header.CRC32 = checksum.Sum32()
+	header.UncompressedSize64 = uint64(size)
+	header.CompressedSize64 = uint64(compressed)
+	header.Comment = fmt.Sprintf("%x", hash.Sum(nil))
+
+	fs.archive.mutex.Lock()
+	fs.archive.added[relPath] = &archiveEntry{header: header, tmp: tmp.Name()}
+	fs.archive.mutex.Unlock()
+	keep = true
+	fmt.Printf("已归档: %s\n", relPath)
+	return compressed, nil
+}
+
+// removeFromArchive 从新归档中去掉文件
+func (fs *FileSync) removeFromArchive(relPath string) error {
+	fs.archive.mutex.Lock()
+	defer fs.archive.mutex.Unlock()
+	fs.archive.removed[relPath] = true
+	fmt.Printf("已从归档删除: %s\n", relPath)
+	return nil
+}
+
+// commit 按路径顺序写出新归档：新压缩的文件使用临时文件，其余文件从旧归档原样复制
+// （包括压缩失败的文件的旧版本），写完后替换旧归档
+func (b *archiveBuilder) commit() error {
+	entries := make(map[string]*zip.File)
+	if b.old != nil {
+		for _, file := range b.old.File {
+			entries[filepath.FromSlash(file.Name)] = file
+		}
+	}
+	var names []string
+	for relPath := range entries {
+		if _, added := b.added[relPath]; !added && !b.removed[relPath] {
+			names = append(names, relPath)
+		}
+	}
+	for relPath := range b.added {
+		names = append(names, relPath)
+	}
+	sort.Strings(names)
+
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return fmt.Errorf("创建归档目录失败: %v", err)
+	}
+	part := partPath(b.path, "")
+	file, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("创建归档失败 %s: %v", part, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			file.Close()
+			os.Remove(part)
+		}
+	}()
+
+	writer := zip.NewWriter(file)
+	for _, relPath := range names {
+		if entry, added := b.added[relPath]; added {
+			err = writeRawEntry(writer, entry)
+		} else {
+			err = writer.Copy(entries[relPath])
+		}
+		if err != nil {
+			return fmt.Errorf("写入归档失败 %s: %v", relPath, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("写入归档失败: %v", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("写入归档失败: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("写入归档失败: %v", err)
+	}
+	if err := os.Rename(part, b.path); err != nil {
+		return fmt.Errorf("替换归档失败 %s: %v", b.path, err)
+	}
+	committed = true
+	return nil
+}
+
+// writeRawEntry 写入已压缩好的条目
+func writeRawEntry(writer *zip.Writer, entry *archiveEntry) error {
+	tmp, err := os.Open(entry.tmp)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+	w, err := writer.CreateRaw(entry.header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, tmp)
+	return err
+}
+
+// cleanup 删除临时文件
+func (b *archiveBuilder) cleanup() {
+	for _, entry := range b.added {
+		os.Remove(entry.tmp)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// partSuffix 复制过程中临时文件的后缀，扫描时跳过
+const partSuffix = ".filesync-part"
+
+// partPath 复制过程中的临时文件路径，与目标文件在同一目录以便原子重命名。
+// 名称中带有源文件哈希的前缀，源文件变化后旧版本的部分文件不会被续传
+func partPath(destPath, hash string) string {
+	version := hash
+	if len(version) > 16 {
+		version = version[:16]
+	}
+	if version == "" {
+		version = "copy"
+	}
+	return filepath.Join(filepath.Dir(destPath), "."+filepath.Base(destPath)+"."+version+partSuffix)
+}
+
+// isTempFile 是否为复制或增量传输过程中的临时文件
+func isTempFile(name string) bool {
+	return strings.HasSuffix(name, partSuffix) || strings.HasSuffix(name, deltaTempSuffix)
+}
+
+// removeStaleParts 删除同一目标文件其他版本中断后留下的部分文件
+func removeStaleParts(destPath, keep string) {
+	dir := filepath.Dir(destPath)
+	prefix := "." + filepath.Base(destPath) + "."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if path != keep && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, partSuffix) {
+			os.Remove(path)
+		}
+	}
+}
+
+// transfer 把源文件写入临时文件，校验哈希并同步到磁盘后重命名为目标文件，返回实际传输的字节数和写入过程中计算的哈希。
+// 不小于ResumeThreshold的文件中断时保留临时文件，下次复制同一版本时从已写入的位置继续；
+// 续传结果的哈希不一致时丢弃临时文件，allowResume为true时重新完整复制一次
+func (fs *FileSync) transfer(srcPath, destPath string, fileInfo *FileInfo, allowResume bool) (int64, string, error) {
+	// 确保目标目录存在
+	destDir := filepath.Dir(destPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return 0, "", fmt.Errorf("创建目标目录失败 %s: %v", destDir, err)
+	}
+
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("打开源文件失败 %s: %v", srcPath, err)
+	}
+	defer srcFile.Close()
+
+	part := partPath(destPath, fileInfo.Hash)
+	removeStaleParts(destPath, part)
+	resumable := fs.config.ResumeThreshold > 0 && fileInfo.Size >= fs.config.ResumeThreshold && fileInfo.Hash != ""
+
+	// 续传时先计算已写入部分的哈希，再从相同位置读取源文件
+	hash := fs.newHash()
+	var offset int64
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resumable && allowResume {
+		if existing, err := os.Open(part); err == nil {
+			offset, err = io.Copy(hash, existing)
+			existing.Close()
+			if err != nil || offset > fileInfo.Size {
+				offset = 0
+				hash.Reset()
+			}
+		}
+		if offset > 0 {
+			if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+				return 0, "", fmt.Errorf("定位源文件失败 %s: %v", srcPath, err)
+			}
+			flags = os.O_WRONLY | os.O_APPEND
+		}
+	}
+
+	destFile, err := os.OpenFile(part, flags, 0666)
+	if err != nil {
+		return 0, "", fmt.Errorf("创建目标文件失败 %s: %v", part, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			destFile.Close()
+			if !resumable {
+				os.Remove(part)
+			}
+		}
+	}()
+
+	written, err := io.Copy(io.MultiWriter(destFile, hash), fs.track(fs.throttle(srcFile), fileInfo))
+	if err != nil {
+		return written, "", fmt.Errorf("复制文件失败 %s -> %s: %v", srcPath, destPath, err)
+	}
+	if err := destFile.Sync(); err != nil {
+		return written, "", fmt.Errorf("写入目标文件失败 %s: %v", part, err)
+	}
+	if err := destFile.Close(); err != nil {
+		return written, "", fmt.Errorf("写入目标文件失败 %s: %v", part, err)
+	}
+
+	// 复制过程中源文件被修改，或续传的部分文件内容不对
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if fileInfo.Hash != "" && sum != fileInfo.Hash {
+		os.Remove(part)
+		if offset > 0 {
+			log.Printf("续传结果校验失败，重新复制 %s", fileInfo.Path)
+			n, sum, err := fs.transfer(srcPath, destPath, fileInfo, false)
+			return written + n, sum, err
+		}
+		return written, "", fmt.Errorf("复制后哈希不一致，源文件可能正在被修改 %s", srcPath)
+	}
+
+	if err := os.Rename(part, destPath); err != nil {
+		return written, "", fmt.Errorf("替换目标文件失败 %s: %v", destPath, err)
+	}
+	committed = true
+
+	// 设置修改时间
+	if err := os.Chtimes(destPath, time.Now(), fileInfo.ModTime); err != nil {
+		log.Printf("设置文件时间失败 %s: %v", destPath, err)
+	}
+
+	if offset > 0 {
+		fmt.Printf("已同步: %s（从%d字节处续传）\n", fileInfo.Path, offset)
+	} else {
+		fmt.Printf("已同步: %s\n", fileInfo.Path)
+	}
+	return written, sum, nil
+}
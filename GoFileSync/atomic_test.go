@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAtomicCopyKeepsOldVersionOnFailure(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	srcPath := filepath.Join(sourceDir, "data.txt")
+	destPath := filepath.Join(destDir, "data.txt")
+	os.WriteFile(srcPath, []byte("new content"), 0644)
+	os.WriteFile(destPath, []byte("old content"), 0644)
+
+	// 扫描后源文件被修改：哈希与扫描结果不一致，目标文件保持旧版本
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir})
+	info := &FileInfo{Path: "data.txt", Size: 11, ModTime: time.Now(), Hash: "0123456789abcdef0123456789abcdef"}
+	if err := fs.syncFile(srcPath, destPath, info); err == nil {
+		t.Fatal("哈希不一致时应返回错误")
+	}
+	if got := readFile(t, destPath); got != "old content" {
+		t.Errorf("复制失败时目标文件应保持不变，实际为%q", got)
+	}
+	entries, _ := os.ReadDir(destDir)
+	if len(entries) != 1 {
+		t.Errorf("复制失败后不应留下临时文件: %v", entries)
+	}
+
+	// 正常同步后内容替换，同样不留临时文件
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, destPath); got != "new content" {
+		t.Errorf("同步后目标文件内容不正确: %q", got)
+	}
+	entries, _ = os.ReadDir(destDir)
+	if len(entries) != 1 {
+		t.Errorf("同步后不应留下临时文件: %v", entries)
+	}
+}
+
+func TestResumeInterruptedCopy(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	data := randomBytes(6, 100<<10)
+	os.WriteFile(filepath.Join(sourceDir, "large.bin"), data, 0644)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, ResumeThreshold: 1 << 10})
+	hash, _ := fs.calculateHash(filepath.Join(sourceDir, "large.bin"))
+
+	// 模拟上次复制到一半时进程被终止
+	destPath := filepath.Join(destDir, "large.bin")
+	part := partPath(destPath, hash)
+	os.WriteFile(part, data[:60<<10], 0644)
+
+	// 中断留下的部分文件不会被当作已同步的文件
+	actions, err := fs.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Path != "large.bin" {
+		t.Fatalf("部分文件应被跳过: %+v", actions)
+	}
+
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, destPath); got != string(data) {
+		t.Fatal("续传后的文件内容不正确")
+	}
+	if result.BytesTransferred != 40<<10 {
+		t.Errorf("应只传输剩余的%d字节，实际传输%d字节", 40<<10, result.BytesTransferred)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Error("完成后部分文件应被重命名")
+	}
+}
+
+func TestResumeDiscardsInvalidPartial(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	data := randomBytes(7, 32<<10)
+	os.WriteFile(filepath.Join(sourceDir, "large.bin"), data, 0644)
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, ResumeThreshold: 1 << 10})
+	hash, _ := fs.calculateHash(filepath.Join(sourceDir, "large.bin"))
+	destPath := filepath.Join(destDir, "large.bin")
+
+	// 其他版本的部分文件被删除，同一版本但内容损坏的部分文件续传后校验失败，重新完整复制
+	stale := partPath(destPath, "ffffffffffffffffffffffffffffffff")
+	os.WriteFile(stale, data[:1000], 0644)
+	os.WriteFile(partPath(destPath, hash), []byte("corrupted prefix"), 0644)
+
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 0 {
+		t.Fatalf("损坏的部分文件不应导致同步失败: %v", result.Errors)
+	}
+	if got := readFile(t, destPath); got != string(data) {
+		t.Fatal("重新复制后的文件内容不正确")
+	}
+	entries, _ := os.ReadDir(destDir)
+	if len(entries) != 1 {
+		t.Errorf("旧版本和损坏的部分文件应被删除: %v", entries)
+	}
+}
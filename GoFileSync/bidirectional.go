@@ -0,0 +1,407 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 冲突处理策略
+const (
+	ConflictNewerWins = "newer-wins" // 修改时间较新的一侧覆盖另一侧
+	ConflictKeepBoth  = "keep-both"  // 较新的一侧保留原文件名，另一侧的版本重命名后两侧都保留
+	ConflictManual    = "manual"     // 两侧都不修改，加入冲突队列等待ResolveConflict
+)
+
+// ResolveConflict保留的一侧
+const (
+	KeepSource = "source"
+	KeepDest   = "dest"
+)
+
+// DirectionToSource 双向同步中从目标目录同步到源目录的操作
+const DirectionToSource = "to-source"
+
+// StateFileName 双向同步状态文件的默认文件名，扫描时总是跳过
+const StateFileName = ".filesync-state.json"
+
+// Conflict 两侧自上次同步后都发生变化的文件，哈希为空表示该侧已删除
+type Conflict struct {
+	Path          string    `json:"path"`
+	SourceHash    string    `json:"source_hash,omitempty"`
+	DestHash      string    `json:"dest_hash,omitempty"`
+	SourceModTime time.Time `json:"source_mod_time,omitempty"`
+	DestModTime   time.Time `json:"dest_mod_time,omitempty"`
+	DetectedAt    time.Time `json:"detected_at"`
+}
+
+// syncState 双向同步的状态：上次同步完成时两侧一致的文件哈希，以及等待手动处理的冲突
+type syncState struct {
+	Algorithm string            `json:"algorithm,omitempty"` // Files中哈希的算法，为空表示HashMD5
+	Files     map[string]string `json:"files"`
+	Conflicts []Conflict        `json:"conflicts,omitempty"`
+}
+
+// preservedCopy keep-both策略下冲突中落后一侧的版本，覆盖前先另存为conflictPath
+type preservedCopy struct {
+	path         string
+	conflictPath string
+	info         *FileInfo
+	fromSource   bool
+}
+
+// bidirectionalPlan 一次双向同步的计划
+type bidirectionalPlan struct {
+	actions   []SyncAction
+	origins   map[string]*FileInfo // 被复制文件的信息
+	hashes    map[string]string    // 操作成功后两侧一致的哈希，为空表示两侧都已删除
+	preserve  []preservedCopy
+	conflicts []Conflict
+	state     *syncState
+}
+
+// statePath 状态文件路径
+func (fs *FileSync) statePath() string {
+	if fs.config.StateFile != "" {
+		return fs.config.StateFile
+	}
+	return filepath.Join(fs.config.DestDir, StateFileName)
+}
+
+// loadState 读取双向同步状态，文件不存在时返回空状态（首次同步）
+func (fs *FileSync) loadState() (*syncState, error) {
+	state := &syncState{Files: make(map[string]string)}
+	data, err := os.ReadFile(fs.statePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取同步状态失败: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("解析同步状态失败: %v", err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]string)
+	}
+	return state, nil
+}
+
+// checkStateAlgorithm 状态中的哈希与当前HashAlgorithm不同时无法判断哪一侧有变化，
+// 需要换回原来的算法，或删除状态文件后按首次同步处理
+func (fs *FileSync) checkStateAlgorithm(state *syncState) error {
+	if len(state.Files) > 0 && state.Algorithm != cacheAlgo(fs.hashAlgorithm()) {
+		recorded := state.Algorithm
+		if recorded == "" {
+			recorded = HashMD5
+		}
+		return fmt.Errorf("同步状态使用%s哈希，与HashAlgorithm %s不一致", recorded, fs.hashAlgorithm())
+	}
+	return nil
+}
+
+// saveState 写入临时文件后重命名，中途失败不会留下损坏的状态文件
+func (fs *FileSync) saveState(state *syncState) error {
+	state.Algorithm = cacheAlgo(fs.hashAlgorithm())
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := fs.statePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("写入同步状态失败: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入同步状态失败: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("写入同步状态失败: %v", err)
+	}
+	return nil
+}
+
+// Conflicts 返回等待手动处理的冲突
+func (fs *FileSync) Conflicts() ([]Conflict, error) {
+	state, err := fs.loadState()
+	if err != nil {
+		return nil, err
+	}
+	return state.Conflicts, nil
+}
+
+// planBidirectional 对比两侧与上次同步的状态：只有一侧变化的文件同步到另一侧，
+// 两侧都变化的文件按ConflictPolicy处理
+func (fs *FileSync) planBidirectional() (*bidirectionalPlan, error) {
+	policy := fs.config.ConflictPolicy
+	if policy == "" {
+		policy = ConflictNewerWins
+	}
+	if policy != ConflictNewerWins && policy != ConflictKeepBoth && policy != ConflictManual {
+		return nil, fmt.Errorf("未知的冲突处理策略: %s", policy)
+	}
+
+	srcFiles, err := fs.scanDirectory(fs.config.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("扫描源目录失败: %v", err)
+	}
+	destFiles, err := fs.scanDirectory(fs.config.DestDir)
+	if err != nil {
+		return nil, fmt.Errorf("扫描目标目录失败: %v", err)
+	}
+	state, err := fs.loadState()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.checkStateAlgorithm(state); err != nil {
+		return nil, err
+	}
+	detectedAt := make(map[string]time.Time, len(state.Conflicts))
+	for _, conflict := range state.Conflicts {
+		detectedAt[conflict.Path] = conflict.DetectedAt
+	}
+
+	plan := &bidirectionalPlan{
+		origins: make(map[string]*FileInfo),
+		hashes:  make(map[string]string),
+		state:   state,
+	}
+	paths := make(map[string]bool, len(srcFiles)+len(state.Files))
+	for relPath := range srcFiles {
+		paths[relPath] = true
+	}
+	for relPath := range destFiles {
+		paths[relPath] = true
+	}
+	for relPath := range state.Files {
+		paths[relPath] = true
+	}
+
+	now := time.Now()
+	for relPath := range paths {
+		src, dest := srcFiles[relPath], destFiles[relPath]
+		srcHash, destHash := fileHash(src), fileHash(dest)
+		if srcHash == destHash {
+			plan.hashes[relPath] = srcHash
+			continue
+		}
+
+		base := state.Files[relPath]
+		toDest := srcHash != base
+		if srcHash != base && destHash != base {
+			conflict := Conflict{Path: relPath, SourceHash: srcHash, DestHash: destHash, DetectedAt: now}
+			if src != nil {
+				conflict.SourceModTime = src.ModTime
+			}
+			if dest != nil {
+				conflict.DestModTime = dest.ModTime
+			}
+			if t, exists := detectedAt[relPath]; exists {
+				conflict.DetectedAt = t
+			}
+
+			if policy == ConflictManual {
+				log.Printf("冲突等待手动处理: %s", relPath)
+				plan.conflicts = append(plan.conflicts, conflict)
+				continue
+			}
+			toDest = sourceWins(src, dest)
+			if policy == ConflictKeepBoth && src != nil && dest != nil {
+				loser, side := dest, KeepDest
+				if !toDest {
+					loser, side = src, KeepSource
+				}
+				plan.preserve = append(plan.preserve, preservedCopy{
+					path:         relPath,
+					conflictPath: conflictPath(relPath, side, now),
+					info:         loser,
+					fromSource:   !toDest,
+				})
+			}
+			log.Printf("冲突按%s策略处理: %s", policy, relPath)
+		}
+		plan.propagate(relPath, src, dest, toDest)
+	}
+
+	sort.Slice(plan.actions, func(i, j int) bool {
+		a, b := plan.actions[i], plan.actions[j]
+		if a.Op != b.Op {
+			return a.Op == ActionCopy
+		}
+		return a.Path < b.Path
+	})
+	sort.Slice(plan.conflicts, func(i, j int) bool { return plan.conflicts[i].Path < plan.conflicts[j].Path })
+	return plan, nil
+}
+
+// propagate 把一侧的版本同步到另一侧，版本为nil表示删除
+func (plan *bidirectionalPlan) propagate(relPath string, src, dest *FileInfo, toDest bool) {
+	from, to, direction := src, dest, ""
+	if !toDest {
+		from, to, direction = dest, src, DirectionToSource
+	}
+	if from == nil {
+		plan.actions = append(plan.actions, SyncAction{Op: ActionDelete, Path: relPath, Size: to.Size, Direction: direction})
+		plan.hashes[relPath] = ""
+		return
+	}
+	plan.actions = append(plan.actions, SyncAction{Op: ActionCopy, Path: relPath, Size: from.Size, Direction: direction})
+	plan.origins[relPath] = from
+	plan.hashes[relPath] = from.Hash
+}
+
+// fileHash 返回文件哈希，文件不存在时为空
+func fileHash(info *FileInfo) string {
+	if info == nil {
+		return ""
+	}
+	return info.Hash
+}
+
+// sourceWins 冲突时源目录一侧是否胜出：修改优先于删除，两侧都修改时较新的胜出，时间相同时源目录胜出
+func sourceWins(src, dest *FileInfo) bool {
+	if dest == nil {
+		return true
+	}
+	if src == nil {
+		return false
+	}
+	return !dest.ModTime.After(src.ModTime)
+}
+
+// conflictPath 冲突副本的文件名，如 report.conflict-dest-20240102-150405.txt
+func conflictPath(relPath, side string, t time.Time) string {
+	ext := filepath.Ext(relPath)
+	return fmt.Sprintf("%s.conflict-%s-%s%s", strings.TrimSuffix(relPath, ext), side, t.Format("20060102-150405"), ext)
+}
+
+// runBidirectional 执行双向同步并更新状态文件
+func (fs *FileSync) runBidirectional(result *RunResult) error {
+	plan, err := fs.planBidirectional()
+	if err != nil {
+		return err
+	}
+
+	// keep-both: 先把落后一侧的版本另存到两侧，失败时不覆盖该文件
+	skipped := make(map[string]bool)
+	for _, p := range plan.preserve {
+		from, other := fs.config.DestDir, fs.config.SourceDir
+		if p.fromSource {
+			from, other = other, from
+		}
+		loserPath := filepath.Join(from, p.path)
+		info := &FileInfo{Path: p.conflictPath, ModTime: p.info.ModTime}
+		err := fs.syncFile(loserPath, filepath.Join(from, p.conflictPath), info)
+		if err == nil {
+			err = fs.syncFile(loserPath, filepath.Join(other, p.conflictPath), info)
+		}
+		if err != nil {
+			log.Printf("保存冲突副本失败 %s: %v", p.path, err)
+			result.Errors = append(result.Errors, err.Error())
+			result.Files = append(result.Files, FileResult{Path: p.conflictPath, Op: ActionCopy, Status: FileFailed, Size: p.info.Size, Error: err.Error()})
+			skipped[p.path] = true
+			continue
+		}
+		plan.hashes[p.conflictPath] = p.info.Hash
+	}
+
+	actions := plan.actions[:0:0]
+	for _, action := range plan.actions {
+		if !skipped[action.Path] {
+			actions = append(actions, action)
+		}
+	}
+	failed := fs.execute(actions, plan.origins, result)
+
+	// 只记录成功同步的文件，失败的文件下次重新比较
+	for relPath, hash := range plan.hashes {
+		if failed[relPath] || skipped[relPath] {
+			continue
+		}
+		if hash == "" {
+			delete(plan.state.Files, relPath)
+		} else {
+			plan.state.Files[relPath] = hash
+		}
+	}
+	plan.state.Conflicts = plan.conflicts
+	result.Conflicts = len(plan.conflicts)
+	for _, conflict := range plan.conflicts {
+		result.Files = append(result.Files, FileResult{Path: conflict.Path, Status: FileConflict})
+	}
+	if err := fs.saveState(plan.state); err != nil {
+		return err
+	}
+
+	if fs.config.WriteManifest {
+		files := make(map[string]*FileInfo, len(plan.state.Files))
+		for relPath := range plan.state.Files {
+			files[relPath] = &FileInfo{Path: relPath}
+		}
+		if err := fs.writeManifest(files); err != nil {
+			return fmt.Errorf("写入清单失败: %v", err)
+		}
+	}
+
+	fmt.Printf("双向同步完成，%d个文件一致，%d个冲突待处理\n", len(plan.state.Files), len(plan.conflicts))
+	return nil
+}
+
+// ResolveConflict 手动处理冲突：keep为KeepSource或KeepDest，保留的一侧覆盖另一侧（已删除则删除另一侧）
+func (fs *FileSync) ResolveConflict(relPath, keep string) error {
+	if keep != KeepSource && keep != KeepDest {
+		return fmt.Errorf("无效的保留方: %s", keep)
+	}
+
+	fs.syncMutex.Lock()
+	defer fs.syncMutex.Unlock()
+
+	state, err := fs.loadState()
+	if err != nil {
+		return err
+	}
+	if err := fs.checkStateAlgorithm(state); err != nil {
+		return err
+	}
+	index := -1
+	for i, conflict := range state.Conflicts {
+		if conflict.Path == relPath {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("冲突 %s 不存在", relPath)
+	}
+
+	from, to := fs.config.SourceDir, fs.config.DestDir
+	if keep == KeepDest {
+		from, to = to, from
+	}
+	fromPath, toPath := filepath.Join(from, relPath), filepath.Join(to, relPath)
+	info, err := os.Stat(fromPath)
+	switch {
+	case os.IsNotExist(err):
+		if err := os.Remove(toPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除文件失败 %s: %v", toPath, err)
+		}
+		delete(state.Files, relPath)
+	case err != nil:
+		return err
+	default:
+		// 复制时计算的哈希即为两侧一致的版本，不必再读取一遍
+		_, hash, err := fs.transfer(fromPath, toPath, &FileInfo{Path: relPath, ModTime: info.ModTime()}, true)
+		if err != nil {
+			return err
+		}
+		state.Files[relPath] = hash
+	}
+
+	state.Conflicts = append(state.Conflicts[:index], state.Conflicts[index+1:]...)
+	return fs.saveState(state)
+}
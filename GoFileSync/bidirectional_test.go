@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取 %s 失败: %v", path, err)
+	}
+	return string(data)
+}
+
+// writeWithTime 写入文件并设置修改时间，避免同一秒内的修改无法区分先后
+func writeWithTime(path, content string, modTime time.Time) {
+	os.WriteFile(path, []byte(content), 0644)
+	os.Chtimes(path, modTime, modTime)
+}
+
+func TestBidirectionalPropagatesBothWays(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(destDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(destDir, "sub", "b.txt"), []byte("b"), 0644)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, filepath.Join(destDir, "a.txt")) != "a" || readFile(t, filepath.Join(sourceDir, "sub", "b.txt")) != "b" {
+		t.Fatal("首次同步应把两侧的文件合并")
+	}
+	if _, err := os.Stat(filepath.Join(sourceDir, StateFileName)); !os.IsNotExist(err) {
+		t.Error("状态文件不应被同步到源目录")
+	}
+
+	// 目标目录的修改同步回源目录，源目录的删除同步到目标目录
+	os.WriteFile(filepath.Join(destDir, "a.txt"), []byte("a from dest"), 0644)
+	os.Remove(filepath.Join(sourceDir, "sub", "b.txt"))
+	actions, err := fs.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions[0].Direction != DirectionToSource || actions[1].Op != ActionDelete || actions[1].Direction != "" {
+		t.Errorf("双向同步计划不正确: %+v", actions)
+	}
+	fs.Sync()
+	if readFile(t, filepath.Join(sourceDir, "a.txt")) != "a from dest" {
+		t.Error("目标目录的修改应同步到源目录")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "sub", "b.txt")); !os.IsNotExist(err) {
+		t.Error("源目录的删除应同步到目标目录")
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("两侧一致后不应有操作: %+v", actions)
+	}
+}
+
+func TestBidirectionalConflictPolicies(t *testing.T) {
+	for _, policy := range []string{ConflictNewerWins, ConflictKeepBoth} {
+		t.Run(policy, func(t *testing.T) {
+			sourceDir, destDir, cleanup := setupTestDirs(t)
+			defer cleanup()
+
+			base := time.Now().Add(-time.Hour).Truncate(time.Second)
+			writeWithTime(filepath.Join(sourceDir, "doc.txt"), "v1", base)
+			writeWithTime(filepath.Join(sourceDir, "gone.txt"), "v1", base)
+			fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true, ConflictPolicy: policy})
+			fs.Sync()
+
+			// 两侧都修改doc.txt，目标目录较新；gone.txt一侧删除一侧修改
+			writeWithTime(filepath.Join(sourceDir, "doc.txt"), "source edit", base.Add(time.Minute))
+			writeWithTime(filepath.Join(destDir, "doc.txt"), "dest edit", base.Add(2*time.Minute))
+			os.Remove(filepath.Join(sourceDir, "gone.txt"))
+			writeWithTime(filepath.Join(destDir, "gone.txt"), "kept", base.Add(time.Minute))
+
+			var result *RunResult
+			fs.onResult = func(r *RunResult) { result = r }
+			if err := fs.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			if readFile(t, filepath.Join(sourceDir, "doc.txt")) != "dest edit" {
+				t.Error("较新的一侧应胜出")
+			}
+			if readFile(t, filepath.Join(sourceDir, "gone.txt")) != "kept" {
+				t.Error("修改应优先于删除")
+			}
+			if result.Conflicts != 0 {
+				t.Errorf("自动处理的冲突不应计入待处理冲突: %+v", result)
+			}
+
+			copies, _ := filepath.Glob(filepath.Join(sourceDir, "doc.conflict-source-*.txt"))
+			destCopies, _ := filepath.Glob(filepath.Join(destDir, "doc.conflict-source-*.txt"))
+			if policy == ConflictKeepBoth {
+				if len(copies) != 1 || len(destCopies) != 1 || readFile(t, destCopies[0]) != "source edit" {
+					t.Fatalf("keep-both应在两侧保留落后版本的副本: %v %v", copies, destCopies)
+				}
+			} else if len(copies)+len(destCopies) != 0 {
+				t.Errorf("newer-wins不应生成冲突副本: %v %v", copies, destCopies)
+			}
+			if actions, _ := fs.Plan(); len(actions) != 0 {
+				t.Errorf("处理冲突后不应有操作: %+v", actions)
+			}
+		})
+	}
+}
+
+func TestBidirectionalManualConflict(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "doc.txt"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "other.txt"), []byte("v1"), 0644)
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true, ConflictPolicy: ConflictManual})
+	fs.Sync()
+
+	os.WriteFile(filepath.Join(sourceDir, "doc.txt"), []byte("source edit"), 0644)
+	os.WriteFile(filepath.Join(destDir, "doc.txt"), []byte("dest edit"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "other.txt"), []byte("v2"), 0644)
+
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	fs.Sync()
+	if result.Conflicts != 1 || result.Copied != 1 {
+		t.Errorf("冲突文件应加入队列，其余文件正常同步: %+v", result)
+	}
+	if readFile(t, filepath.Join(sourceDir, "doc.txt")) != "source edit" || readFile(t, filepath.Join(destDir, "doc.txt")) != "dest edit" {
+		t.Error("manual策略不应修改冲突文件")
+	}
+
+	// 重复同步保留最初的检测时间
+	conflicts, _ := fs.Conflicts()
+	fs.Sync()
+	again, _ := fs.Conflicts()
+	if len(conflicts) != 1 || len(again) != 1 || conflicts[0].Path != "doc.txt" || !again[0].DetectedAt.Equal(conflicts[0].DetectedAt) {
+		t.Fatalf("冲突队列不正确: %+v %+v", conflicts, again)
+	}
+
+	if err := fs.ResolveConflict("doc.txt", "both"); err == nil {
+		t.Error("无效的保留方应返回错误")
+	}
+	if err := fs.ResolveConflict("missing.txt", KeepDest); err == nil {
+		t.Error("不存在的冲突应返回错误")
+	}
+	if err := fs.ResolveConflict("doc.txt", KeepDest); err != nil {
+		t.Fatal(err)
+	}
+	if readFile(t, filepath.Join(sourceDir, "doc.txt")) != "dest edit" {
+		t.Error("应保留目标目录的版本")
+	}
+	if conflicts, _ := fs.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("处理后冲突应移出队列: %+v", conflicts)
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("处理冲突后不应有操作: %+v", actions)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// 压缩算法
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd" // 标准库没有实现，配置后返回错误
+)
+
+// compressedSuffix 压缩存储的文件在目标中的后缀，可以直接用gunzip解压
+const compressedSuffix = ".gz"
+
+// gzipExtraID 压缩文件gzip头的扩展字段中保存原始大小的子字段标识，
+// 用于区分同步时压缩的文件和源目录中本来就是.gz的文件
+var gzipExtraID = [2]byte{'F', 'S'}
+
+// DefaultSkipExtensions 本身已经压缩、再压缩收益很小的格式
+var DefaultSkipExtensions = []string{
+	".gz", ".tgz", ".zip", ".7z", ".rar", ".bz2", ".xz", ".zst", ".lz4",
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic",
+	".mp3", ".aac", ".ogg", ".flac", ".mp4", ".mkv", ".mov", ".avi", ".webm",
+	".pdf", ".docx", ".xlsx", ".pptx", ".jar", ".apk",
+}
+
+// CompressionConfig 压缩写入目标的文件内容
+type CompressionConfig struct {
+	Algorithm      string   // 压缩算法，为空时使用CompressionGzip
+	Level          int      // 压缩级别（gzip为1-9），为0时使用默认级别
+	SkipExtensions []string // 不压缩的扩展名，不区分大小写；为nil时使用DefaultSkipExtensions
+}
+
+// validate 检查算法和级别
+func (c *CompressionConfig) validate() error {
+	switch c.Algorithm {
+	case "", CompressionGzip:
+	case CompressionZstd:
+		return fmt.Errorf("不支持zstd压缩：本目录没有依赖清单，标准库未提供zstd实现")
+	default:
+		return fmt.Errorf("未知的压缩算法: %s", c.Algorithm)
+	}
+	if c.Level < 0 || c.Level > gzip.BestCompression {
+		return fmt.Errorf("无效的压缩级别: %d", c.Level)
+	}
+	return nil
+}
+
+// level 生效的压缩级别
+func (c *CompressionConfig) level() int {
+	if c.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return c.Level
+}
+
+// compresses 是否压缩该文件
+func (c *CompressionConfig) compresses(relPath string) bool {
+	skip := c.SkipExtensions
+	if skip == nil {
+		skip = DefaultSkipExtensions
+	}
+	ext := strings.ToLower(path.Ext(relPath))
+	for _, s := range skip {
+		if strings.ToLower(s) == ext {
+			return false
+		}
+	}
+	return true
+}
+
+// compressedProvider 写入底层存储前用gzip压缩文件内容，文件名加上compressedSuffix，
+// 跳过的扩展名原样存储。列出的大小为原始大小，取自gzip头的扩展字段
+type compressedProvider struct {
+	inner  StorageProvider
+	config *CompressionConfig
+}
+
+func newCompressedProvider(inner StorageProvider, config *CompressionConfig) *compressedProvider {
+	return &compressedProvider{inner: inner, config: config}
+}
+
+// gzipExtra 记录原始大小的gzip扩展字段
+func gzipExtra(size int64) []byte {
+	extra := make([]byte, 12)
+	copy(extra, gzipExtraID[:])
+	binary.LittleEndian.PutUint16(extra[2:], 8)
+	binary.LittleEndian.PutUint64(extra[4:], uint64(size))
+	return extra
+}
+
+// parseGzipExtra 从gzip扩展字段中找出原始大小
+func parseGzipExtra(extra []byte) (int64, bool) {
+	for len(extra) >= 4 {
+		length := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+length {
+			break
+		}
+		if extra[0] == gzipExtraID[0] && extra[1] == gzipExtraID[1] && length == 8 {
+			return int64(binary.LittleEndian.Uint64(extra[4:])), true
+		}
+		extra = extra[4+length:]
+	}
+	return 0, false
+}
+
+// originalSize 读取压缩文件的gzip头，不是同步时压缩的文件返回false
+func (p *compressedProvider) originalSize(storedPath string) (int64, bool) {
+	reader, err := p.inner.Read(storedPath)
+	if err != nil {
+		return 0, false
+	}
+	defer reader.Close()
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, false
+	}
+	return parseGzipExtra(gz.Header.Extra)
+}
+
+// List 同一文件同时有压缩和未压缩的版本（修改过跳过列表）时，列出与当前配置一致的版本
+func (p *compressedProvider) List() ([]ObjectInfo, error) {
+	if err := p.config.validate(); err != nil {
+		return nil, err
+	}
+	objects, err := p.inner.List()
+	if err != nil {
+		return nil, err
+	}
+	byPath := make(map[string]ObjectInfo, len(objects))
+	var order []string
+	for _, object := range objects {
+		compressed := false
+		if strings.HasSuffix(object.Path, compressedSuffix) {
+			if size, ok := p.originalSize(object.Path); ok {
+				object = ObjectInfo{Path: strings.TrimSuffix(object.Path, compressedSuffix), Size: size, ModTime: object.ModTime}
+				compressed = true
+			}
+		}
+		if _, exists := byPath[object.Path]; !exists {
+			order = append(order, object.Path)
+		} else if compressed != p.config.compresses(object.Path) {
+			continue
+		}
+		byPath[object.Path] = object
+	}
+	result := make([]ObjectInfo, 0, len(order))
+	for _, relPath := range order {
+		result = append(result, byPath[relPath])
+	}
+	return result, nil
+}
+
+// storedPaths 按当前配置优先的存储路径和另一种版本的路径
+func (p *compressedProvider) storedPaths(relPath string) (string, string) {
+	if p.config.compresses(relPath) {
+		return relPath + compressedSuffix, relPath
+	}
+	return relPath, relPath + compressedSuffix
+}
+
+func (p *compressedProvider) Stat(relPath string) (*ObjectInfo, error) {
+	for _, stored := range p.candidates(relPath) {
+		object, err := p.inner.Stat(stored)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stored != relPath {
+			size, ok := p.originalSize(stored)
+			if !ok {
+				continue
+			}
+			object.Size = size
+		}
+		object.Path = relPath
+		return object, nil
+	}
+	return nil, notExist("stat", relPath)
+}
+
+// candidates 读取时依次尝试的存储路径
+func (p *compressedProvider) candidates(relPath string) []string {
+	preferred, other := p.storedPaths(relPath)
+	return []string{preferred, other}
+}
+
+// gzipReadCloser 关闭时同时关闭底层存储的reader
+type gzipReadCloser struct {
+	*gzip.Reader
+	source io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.source.Close()
+}
+
+func (p *compressedProvider) Read(relPath string) (io.ReadCloser, error) {
+	for _, stored := range p.candidates(relPath) {
+		reader, err := p.inner.Read(stored)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || stored == relPath {
+			return reader, err
+		}
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("解压失败 %s: %v", stored, err)
+		}
+		if _, ok := parseGzipExtra(gz.Header.Extra); !ok {
+			reader.Close()
+			continue
+		}
+		return &gzipReadCloser{Reader: gz, source: reader}, nil
+	}
+	return nil, notExist("read", relPath)
+}
+
+// Write 压缩后的大小事先未知，先压缩到临时文件再写入底层存储，之后删除另一种版本
+func (p *compressedProvider) Write(relPath string, r io.Reader, size int64) error {
+	if err := p.config.validate(); err != nil {
+		return err
+	}
+	stored, other := p.storedPaths(relPath)
+	if stored == relPath {
+		if err := p.inner.Write(relPath, r, size); err != nil {
+			return err
+		}
+		p.inner.Delete(other)
+		return nil
+	}
+
+	tmp, err := os.CreateTemp("", "filesync-gzip-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	gz, err := gzip.NewWriterLevel(tmp, p.config.level())
+	if err != nil {
+		return err
+	}
+	gz.Header.Name = path.Base(relPath)
+	gz.Header.Extra = gzipExtra(size)
+	written, err := io.Copy(gz, r)
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("文件大小在读取过程中变化: %s", relPath)
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	compressedSize, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := p.inner.Write(stored, tmp, compressedSize); err != nil {
+		return err
+	}
+	p.inner.Delete(other)
+	return nil
+}
+
+// Delete 删除两种版本，都不存在时返回不存在错误
+func (p *compressedProvider) Delete(relPath string) error {
+	deleted := false
+	for _, stored := range p.candidates(relPath) {
+		err := p.inner.Delete(stored)
+		if err == nil {
+			deleted = true
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !deleted {
+		return notExist("delete", relPath)
+	}
+	return nil
+}
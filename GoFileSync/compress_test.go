@@ -0,0 +1,192 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressedTarget(t *testing.T) {
+	sourceDir, remoteDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	text := []byte(strings.Repeat("log line repeated many times\n", 2000))
+	os.MkdirAll(filepath.Join(sourceDir, "logs"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "logs", "app.log"), text, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "photo.JPG"), []byte("jpeg data"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "backup.gz"), []byte("not really gzip"), 0644)
+
+	target := &LocalProvider{Root: remoteDir}
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, Target: target, DeleteExtra: true, Compression: &CompressionConfig{Level: 9}})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 压缩的文件可以直接用gzip解压
+	stored, err := os.ReadFile(filepath.Join(remoteDir, "logs", "app.log.gz"))
+	if err != nil || len(stored) >= len(text)/10 {
+		t.Fatalf("文本文件应压缩存储: %d %v", len(stored), err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(gz); !bytes.Equal(data, text) {
+		t.Error("解压后的内容与源文件不一致")
+	}
+	// 跳过列表中的扩展名原样存储，不区分大小写
+	if data, _ := os.ReadFile(filepath.Join(remoteDir, "photo.JPG")); string(data) != "jpeg data" {
+		t.Error("已压缩格式的文件应原样存储")
+	}
+	if data, _ := os.ReadFile(filepath.Join(remoteDir, "backup.gz")); string(data) != "not really gzip" {
+		t.Error("源目录中的.gz文件应原样存储")
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+	if info, err := fs.storage.Stat("logs/app.log"); err != nil || info.Size != int64(len(text)) {
+		t.Errorf("Stat应返回原始大小: %+v %v", info, err)
+	}
+
+	// 修改跳过列表后文件改为压缩存储，旧版本被删除
+	fs = NewFileSync(&SyncConfig{SourceDir: sourceDir, Target: target, DeleteExtra: true, Compression: &CompressionConfig{SkipExtensions: []string{}}})
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(sourceDir, "photo.JPG"), later, later)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(remoteDir, "photo.JPG")); !os.IsNotExist(err) {
+		t.Error("改为压缩存储后应删除未压缩的版本")
+	}
+	reader, err := fs.storage.Read("photo.JPG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "jpeg data" {
+		t.Errorf("读取压缩文件的内容不正确: %q", data)
+	}
+
+	if _, err := NewFileSync(&SyncConfig{SourceDir: sourceDir, Target: target, Compression: &CompressionConfig{Algorithm: CompressionZstd}}).Plan(); err == nil {
+		t.Error("不支持的压缩算法应返回错误")
+	}
+}
+
+func TestCompressedEncryptedDestDir(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	text := []byte(strings.Repeat("compress me before encrypting ", 5000))
+	os.WriteFile(filepath.Join(sourceDir, "doc.txt"), text, 0644)
+
+	config := &SyncConfig{
+		SourceDir:   sourceDir,
+		DestDir:     destDir,
+		Encryption:  &EncryptionConfig{Key: bytes.Repeat([]byte{3}, encKeySize)},
+		Compression: &CompressionConfig{},
+	}
+	fs := NewFileSync(config)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 先压缩再加密，加密后的文件仍远小于原文件
+	stored, err := os.ReadFile(filepath.Join(destDir, "doc.txt.gz"))
+	if err != nil || len(stored) >= len(text)/10 || bytes.Contains(stored, []byte("compress me")) {
+		t.Fatalf("应先压缩再加密: %d %v", len(stored), err)
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	restoreDir := t.TempDir()
+	if restored, err := fs.Restore(restoreDir); err != nil || restored != 1 {
+		t.Fatalf("恢复结果不正确: %d %v", restored, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restoreDir, "doc.txt")); !bytes.Equal(data, text) {
+		t.Error("恢复的内容与源文件不一致")
+	}
+}
+
+func TestArchiveDestination(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	text := []byte(strings.Repeat("archive text ", 1000))
+	os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "a.txt"), text, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.png"), []byte("png"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "c.txt"), []byte("c"), 0644)
+
+	archivePath := filepath.Join(destDir, "backup.zip")
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, Archive: archivePath, DeleteExtra: true, Workers: 2})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	readEntries := func() map[string]*zip.File {
+		reader, err := zip.OpenReader(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { reader.Close() })
+		entries := make(map[string]*zip.File)
+		for _, file := range reader.File {
+			entries[file.Name] = file
+		}
+		return entries
+	}
+	entries := readEntries()
+	if len(entries) != 3 {
+		t.Fatalf("归档应包含3个文件: %d", len(entries))
+	}
+	if entries["sub/a.txt"].Method != zip.Deflate || entries["sub/a.txt"].CompressedSize64 >= uint64(len(text))/10 {
+		t.Error("文本文件应压缩")
+	}
+	if entries["b.png"].Method != zip.Store {
+		t.Error("跳过列表中的文件应不压缩存储")
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	// 修改和删除后只重新压缩变化的文件
+	os.WriteFile(filepath.Join(sourceDir, "c.txt"), []byte("changed"), 0644)
+	os.Remove(filepath.Join(sourceDir, "b.png"))
+	result := &RunResult{}
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 1 || result.Deleted != 1 {
+		t.Errorf("应更新1个文件并删除1个文件: %+v", result)
+	}
+	entries = readEntries()
+	if _, exists := entries["b.png"]; exists || len(entries) != 2 {
+		t.Errorf("删除的文件应从归档中移除: %d", len(entries))
+	}
+	file, err := entries["c.txt"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != "changed" {
+		t.Errorf("归档中的内容未更新: %q", data)
+	}
+	if file, err := entries["sub/a.txt"].Open(); err != nil {
+		t.Fatal(err)
+	} else if data, _ := io.ReadAll(file); !bytes.Equal(data, text) {
+		t.Error("未变化的文件应原样保留")
+	}
+	if leftovers, _ := os.ReadDir(destDir); len(leftovers) != 1 {
+		t.Errorf("不应留下临时文件: %d", len(leftovers))
+	}
+}
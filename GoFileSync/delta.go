@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultDeltaBlockSize 增量传输默认的块大小
+const DefaultDeltaBlockSize = 8 << 10
+
+// deltaTempSuffix 增量传输重建文件时使用的临时文件后缀，扫描时跳过
+const deltaTempSuffix = ".filesync-delta"
+
+// deltaLiteralFlush 未匹配的数据积累到该大小时写出，限制内存占用
+const deltaLiteralFlush = 64 << 10
+
+// rollingChecksum rsync的弱校验和，窗口滑动一个字节时O(1)更新
+type rollingChecksum struct {
+	a, b uint32
+	n    uint32
+}
+
+func newRollingChecksum(window []byte) rollingChecksum {
+	r := rollingChecksum{n: uint32(len(window))}
+	for i, c := range window {
+		r.a += uint32(c)
+		r.b += uint32(len(window)-i) * uint32(c)
+	}
+	return r
+}
+
+// roll 窗口移出out、移入in
+func (r *rollingChecksum) roll(out, in byte) {
+	r.a += uint32(in) - uint32(out)
+	r.b += r.a - r.n*uint32(out)
+}
+
+func (r rollingChecksum) sum() uint32 {
+	return r.a&0xffff | r.b<<16
+}
+
+// blockSignature 基准文件中一个块的强校验和
+type blockSignature struct {
+	index  int
+	strong [md5.Size]byte
+}
+
+// signature 基准文件（目标文件的旧版本）的块校验和。弱校验和用于快速查找，
+// 命中后再用强校验和确认；末尾不足一块的数据单独记录
+type signature struct {
+	blockSize int
+	blocks    map[uint32][]blockSignature
+	tailIndex int
+	tailLen   int
+	tail      [md5.Size]byte
+}
+
+// computeSignature 按块计算基准文件的校验和
+func computeSignature(basis io.Reader, blockSize int) (*signature, error) {
+	sig := &signature{blockSize: blockSize, blocks: make(map[uint32][]blockSignature)}
+	block := make([]byte, blockSize)
+	for index := 0; ; index++ {
+		n, err := io.ReadFull(basis, block)
+		if n == blockSize {
+			weak := newRollingChecksum(block).sum()
+			sig.blocks[weak] = append(sig.blocks[weak], blockSignature{index: index, strong: md5.Sum(block)})
+		} else if n > 0 {
+			sig.tailIndex, sig.tailLen, sig.tail = index, n, md5.Sum(block[:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// match 查找与窗口内容相同的完整块
+func (sig *signature) match(weak uint32, window []byte) (int, bool) {
+	candidates := sig.blocks[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	strong := md5.Sum(window)
+	for _, candidate := range candidates {
+		if candidate.strong == strong {
+			return candidate.index, true
+		}
+	}
+	return 0, false
+}
+
+// deltaWriter 按源文件的顺序写出未匹配的数据和基准文件中的块，重建新文件
+type deltaWriter struct {
+	fs          *FileSync
+	out         io.Writer
+	basis       io.ReaderAt
+	blockSize   int
+	transferred int64
+}
+
+// literal 写出未匹配的数据，这部分计入传输量并受限速约束
+func (w *deltaWriter) literal(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if w.fs.limiter != nil {
+		w.fs.limiter.wait(len(data))
+	}
+	w.transferred += int64(len(data))
+	_, err := w.out.Write(data)
+	return err
+}
+
+// block 从基准文件复制一个块
+func (w *deltaWriter) block(index, length int) error {
+	_, err := io.Copy(w.out, io.NewSectionReader(w.basis, int64(index)*int64(w.blockSize), int64(length)))
+	return err
+}
+
+// apply 滚动扫描源文件，能在基准文件中找到的块直接复制，其余数据作为未匹配数据写出
+func (w *deltaWriter) apply(src io.Reader, sig *signature) error {
+	reader := bufio.NewReaderSize(src, deltaLiteralFlush)
+	blockSize := sig.blockSize
+	// buf 为尚未写出的未匹配数据加上末尾的当前窗口
+	buf := make([]byte, blockSize, deltaLiteralFlush+blockSize)
+	n, err := io.ReadFull(reader, buf)
+	buf = buf[:n]
+	eof := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !eof {
+		return err
+	}
+
+	var rolling rollingChecksum
+	if !eof {
+		rolling = newRollingChecksum(buf)
+	}
+	for !eof {
+		start := len(buf) - blockSize
+		if index, ok := sig.match(rolling.sum(), buf[start:]); ok {
+			if err := w.literal(buf[:start]); err != nil {
+				return err
+			}
+			if err := w.block(index, blockSize); err != nil {
+				return err
+			}
+			buf = buf[:blockSize]
+			n, err := io.ReadFull(reader, buf)
+			buf = buf[:n]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			rolling = newRollingChecksum(buf)
+			continue
+		}
+
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		rolling.roll(buf[start], c)
+		buf = append(buf, c)
+		if len(buf) == cap(buf) {
+			if err := w.literal(buf[:len(buf)-blockSize]); err != nil {
+				return err
+			}
+			buf = buf[:copy(buf, buf[len(buf)-blockSize:])]
+		}
+	}
+
+	// 源文件末尾可能与基准文件末尾不足一块的数据相同
+	if sig.tailLen > 0 && len(buf) >= sig.tailLen && md5.Sum(buf[len(buf)-sig.tailLen:]) == sig.tail {
+		if err := w.literal(buf[:len(buf)-sig.tailLen]); err != nil {
+			return err
+		}
+		return w.block(sig.tailIndex, sig.tailLen)
+	}
+	return w.literal(buf)
+}
+
+// copyFile 复制文件到目标路径并按配置保留权限和属主，返回实际传输的字节数和写入内容的哈希（符号链接为空）。
+// 目标文件已存在且源文件不小于DeltaThreshold时使用增量传输，增量传输失败时退回完整复制
+func (fs *FileSync) copyFile(srcPath, destPath string, fileInfo *FileInfo) (int64, string, error) {
+	if fileInfo.Link != "" {
+		return 0, "", fs.copySymlink(destPath, fileInfo)
+	}
+	transferred, sum, err := fs.copyContent(srcPath, destPath, fileInfo)
+	if err != nil {
+		return transferred, "", err
+	}
+	return transferred, sum, fs.applyMetadata(destPath, fileInfo)
+}
+
+// copyContent 复制文件内容，可以时使用增量传输
+func (fs *FileSync) copyContent(srcPath, destPath string, fileInfo *FileInfo) (int64, string, error) {
+	if fs.config.DeltaThreshold > 0 && fileInfo.Size >= fs.config.DeltaThreshold {
+		if _, err := os.Stat(destPath); err == nil {
+			transferred, sum, err := fs.deltaSync(srcPath, destPath, fileInfo)
+			if err == nil {
+				return transferred, sum, nil
+			}
+			log.Printf("增量传输失败，改为完整复制 %s: %v", fileInfo.Path, err)
+		}
+	}
+	return fs.transfer(srcPath, destPath, fileInfo, true)
+}
+
+// deltaSync 以目标文件的旧版本为基准，只写入变化的数据重建文件，完成后替换目标文件
+func (fs *FileSync) deltaSync(srcPath, destPath string, fileInfo *FileInfo) (int64, string, error) {
+	blockSize := fs.config.DeltaBlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultDeltaBlockSize
+	}
+
+	basis, err := os.Open(destPath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer basis.Close()
+	basisInfo, err := basis.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	sig, err := computeSignature(bufio.NewReader(basis), blockSize)
+	if err != nil {
+		return 0, "", fmt.Errorf("计算目标文件校验和失败: %v", err)
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("打开源文件失败 %s: %v", srcPath, err)
+	}
+	defer src.Close()
+
+	tmpPath := filepath.Join(filepath.Dir(destPath), "."+filepath.Base(destPath)+deltaTempSuffix)
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, basisInfo.Mode().Perm())
+	if err != nil {
+		return 0, "", fmt.Errorf("创建临时文件失败 %s: %v", tmpPath, err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	hash := fs.newHash()
+	out := bufio.NewWriter(io.MultiWriter(tmp, hash))
+	writer := &deltaWriter{fs: fs, out: out, basis: basis, blockSize: blockSize}
+	if err := writer.apply(fs.track(src, fileInfo), sig); err != nil {
+		return 0, "", err
+	}
+	if err := out.Flush(); err != nil {
+		return 0, "", err
+	}
+	// 同步过程中源文件被修改时重建结果与扫描时的哈希不一致
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if fileInfo.Hash != "" && sum != fileInfo.Hash {
+		return 0, "", fmt.Errorf("重建的文件与源文件哈希不一致")
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, "", err
+	}
+	basis.Close()
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		return 0, "", fmt.Errorf("替换目标文件失败 %s: %v", destPath, err)
+	}
+	committed = true
+
+	if err := os.Chtimes(destPath, time.Now(), fileInfo.ModTime); err != nil {
+		log.Printf("设置文件时间失败 %s: %v", destPath, err)
+	}
+	fmt.Printf("已同步: %s（增量，传输%d/%d字节）\n", fileInfo.Path, writer.transferred, fileInfo.Size)
+	return writer.transferred, sum, nil
+}
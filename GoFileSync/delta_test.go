@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestRollingChecksum(t *testing.T) {
+	data := randomBytes(1, 4096)
+	const window = 64
+	rolling := newRollingChecksum(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		rolling.roll(data[i-1], data[i+window-1])
+		if want := newRollingChecksum(data[i : i+window]).sum(); rolling.sum() != want {
+			t.Fatalf("偏移%d处滚动校验和为%08x，期望%08x", i, rolling.sum(), want)
+		}
+	}
+}
+
+// syncDelta 写入源文件并同步，返回本次实际传输的字节数
+func syncDelta(t *testing.T, fs *FileSync, sourceDir, destDir string, data []byte) int64 {
+	t.Helper()
+	path := filepath.Join(sourceDir, "large.bin")
+	// 修改时间每次递增，避免与上一版本相同
+	writeWithTime(path, string(data), time.Now().Add(-time.Hour).Add(time.Duration(len(data))))
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Failed != 0 {
+		t.Fatalf("同步失败: %v", result.Errors)
+	}
+	got, _ := os.ReadFile(filepath.Join(destDir, "large.bin"))
+	if !bytes.Equal(got, data) {
+		t.Fatalf("目标文件内容与源文件不一致（%d/%d字节）", len(got), len(data))
+	}
+	return result.BytesTransferred
+}
+
+func TestDeltaSyncTransfersChangedBlocks(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	const blockSize = 1024
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeltaThreshold: 1, DeltaBlockSize: blockSize})
+	data := randomBytes(2, 256*blockSize+100)
+	if n := syncDelta(t, fs, sourceDir, destDir, data); n != int64(len(data)) {
+		t.Errorf("目标文件不存在时应完整复制，实际传输%d字节", n)
+	}
+
+	// 修改一个字节只传输所在的块
+	data[100*blockSize+7] ^= 0xff
+	if n := syncDelta(t, fs, sourceDir, destDir, data); n != blockSize {
+		t.Errorf("修改一个字节应传输一个块，实际传输%d字节", n)
+	}
+
+	// 在开头插入数据，后面的块整体偏移后仍能匹配
+	inserted := append([]byte("inserted header"), data...)
+	if n := syncDelta(t, fs, sourceDir, destDir, inserted); n != int64(len("inserted header")) {
+		t.Errorf("插入数据后应只传输插入的%d字节，实际传输%d字节", len("inserted header"), n)
+	}
+
+	entries, _ := os.ReadDir(destDir)
+	if len(entries) != 1 {
+		t.Errorf("目标目录不应留下临时文件: %v", entries)
+	}
+}
+
+func TestDeltaSyncEdgeCases(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	const blockSize = 512
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeltaThreshold: 1, DeltaBlockSize: blockSize})
+	data := randomBytes(3, 20*blockSize+37)
+	syncDelta(t, fs, sourceDir, destDir, data)
+
+	cases := []struct {
+		name string
+		data []byte
+		max  int64
+	}{
+		{"追加数据", append(append([]byte(nil), data...), randomBytes(4, 300)...), 37 + 300},
+		{"截断", data[:10*blockSize+5], 5},
+		{"末尾不足一块的数据不变", append(append([]byte(nil), data[:blockSize]...), data[len(data)-37:]...), 0},
+		{"小于一块", data[:100], 100},
+		{"清空", []byte{}, 0},
+		{"全新内容", randomBytes(5, 3*blockSize), 3 * blockSize},
+	}
+	for _, c := range cases {
+		// 每个用例都以原始数据为基准
+		syncDelta(t, fs, sourceDir, destDir, data)
+		if n := syncDelta(t, fs, sourceDir, destDir, c.data); n > c.max {
+			t.Errorf("%s: 期望最多传输%d字节，实际%d字节", c.name, c.max, n)
+		}
+	}
+
+	// 小于阈值的文件完整复制
+	fs.config.DeltaThreshold = 1 << 20
+	changed := append([]byte(nil), data...)
+	changed[0] ^= 0xff
+	syncDelta(t, fs, sourceDir, destDir, data)
+	if n := syncDelta(t, fs, sourceDir, destDir, changed); n != int64(len(changed)) {
+		t.Errorf("小于阈值的文件应完整复制，实际传输%d字节", n)
+	}
+}
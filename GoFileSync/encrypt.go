@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyFileName 加密目标根目录下保存密钥派生参数和校验值的文件，不含密钥本身
+const KeyFileName = ".filesync-key.json"
+
+// 加密文件格式：encMagic、8字节随机nonce前缀，之后是固定大小的AES-GCM分块。
+// 每块的nonce为前缀加4字节块序号，附加数据包含是否为最后一块和文件路径，
+// 截断、重排或把密文换到其他路径下都会解密失败
+const (
+	encMagic      = "FSYNCEN1"
+	encPrefixSize = 8
+	encHeaderSize = len(encMagic) + encPrefixSize
+	encChunkSize  = 64 * 1024
+	encTagSize    = 16
+	encKeySize    = 32
+
+	// pbkdf2Iterations 由口令派生密钥的迭代次数，写入KeyFileName，以后调整不影响已有目标
+	pbkdf2Iterations = 600000
+)
+
+// errWrongKey 密钥或口令与目标中已有的加密数据不符
+var errWrongKey = errors.New("密钥与目标中已有的加密数据不符")
+
+// EncryptionConfig 目标端加密配置，Key和Passphrase二选一
+type EncryptionConfig struct {
+	Key          []byte // 32字节的AES-256密钥
+	Passphrase   string // 口令，用PBKDF2-SHA256和保存在KeyFileName中的随机盐派生密钥
+	EncryptNames bool   // 同时加密文件和目录名
+}
+
+// keyFile KeyFileName的内容
+type keyFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"` // "pbkdf2-sha256"或"raw"
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Check      string `json:"check"` // 主密钥对固定字符串的HMAC，用于识别错误的密钥
+}
+
+// encryptedProvider 在写入底层存储前加密内容和文件名，读取时解密。
+// 列出的大小为明文大小；存储不提供明文哈希，因此按大小和修改时间比较
+type encryptedProvider struct {
+	inner  StorageProvider
+	config *EncryptionConfig
+
+	once       sync.Once
+	initErr    error
+	contentKey cipher.AEAD
+	nameKey    []byte
+	nameAEAD   cipher.AEAD
+}
+
+func newEncryptedProvider(inner StorageProvider, config *EncryptionConfig) *encryptedProvider {
+	return &encryptedProvider{inner: inner, config: config}
+}
+
+// subkey 由主密钥派生用途不同的子密钥
+func subkey(master []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, master)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// pbkdf2Key 按RFC 8018计算PBKDF2-HMAC-SHA256（标准库的crypto/pbkdf2需要Go 1.24）
+func pbkdf2Key(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	key := make([]byte, 0, keyLen+prf.Size())
+	var index [4]byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(index[:], block)
+		prf.Write(index[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// init 首次使用时读取或创建KeyFileName，派生并校验密钥
+func (p *encryptedProvider) init() error {
+	p.once.Do(func() {
+		p.initErr = p.loadKeys()
+	})
+	return p.initErr
+}
+
+func (p *encryptedProvider) loadKeys() error {
+	if (len(p.config.Key) == 0) == (p.config.Passphrase == "") {
+		return fmt.Errorf("加密配置需要Key或Passphrase之一")
+	}
+	if len(p.config.Key) > 0 && len(p.config.Key) != encKeySize {
+		return fmt.Errorf("加密密钥长度应为%d字节", encKeySize)
+	}
+
+	var stored *keyFile
+	reader, err := p.inner.Read(KeyFileName)
+	switch {
+	case err == nil:
+		stored = &keyFile{}
+		err = json.NewDecoder(reader).Decode(stored)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("读取%s失败: %v", KeyFileName, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("读取%s失败: %v", KeyFileName, err)
+	}
+
+	created := stored == nil
+	if created {
+		stored = &keyFile{Version: 1, KDF: "raw"}
+		if p.config.Passphrase != "" {
+			stored.KDF, stored.Iterations = "pbkdf2-sha256", pbkdf2Iterations
+			stored.Salt = make([]byte, 16)
+			if _, err := rand.Read(stored.Salt); err != nil {
+				return err
+			}
+		}
+	}
+
+	master := p.config.Key
+	switch {
+	case stored.KDF == "pbkdf2-sha256" && p.config.Passphrase != "":
+		if stored.Iterations <= 0 {
+			return fmt.Errorf("%s中的迭代次数无效: %d", KeyFileName, stored.Iterations)
+		}
+		master = pbkdf2Key([]byte(p.config.Passphrase), stored.Salt, stored.Iterations, encKeySize)
+	case stored.KDF == "raw" && len(p.config.Key) > 0:
+	default:
+		return fmt.Errorf("目标使用%s方式的密钥，与配置不符", stored.KDF)
+	}
+
+	check := hex.EncodeToString(subkey(master, "filesync key check"))
+	if created {
+		stored.Check = check
+		data, err := json.MarshalIndent(stored, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := p.inner.Write(KeyFileName, bytes.NewReader(data), int64(len(data))); err != nil {
+			return fmt.Errorf("写入%s失败: %v", KeyFileName, err)
+		}
+	} else if !hmac.Equal([]byte(check), []byte(stored.Check)) {
+		return errWrongKey
+	}
+
+	if p.contentKey, err = newGCM(subkey(master, "filesync content")); err != nil {
+		return err
+	}
+	p.nameKey = subkey(master, "filesync names")
+	p.nameAEAD, err = newGCM(p.nameKey)
+	return err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nameEncoding 加密后的文件名，小写且不含"/"和"."开头
+var nameEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// encryptName 逐级加密路径。nonce由名称的HMAC得到，同一名称总是加密为相同结果，
+// 增量比较和删除时不需要先列出全部文件
+func (p *encryptedProvider) encryptName(relPath string) string {
+	if !p.config.EncryptNames {
+		return relPath
+	}
+	segments := strings.Split(relPath, "/")
+	for i, segment := range segments {
+		mac := hmac.New(sha256.New, p.nameKey)
+		mac.Write([]byte(segment))
+		nonce := mac.Sum(nil)[:p.nameAEAD.NonceSize()]
+		segments[i] = nameEncoding.EncodeToString(p.nameAEAD.Seal(nonce, nonce, []byte(segment), nil))
+	}
+	return strings.Join(segments, "/")
+}
+
+// decryptName encryptName的逆操作
+func (p *encryptedProvider) decryptName(encPath string) (string, error) {
+	if !p.config.EncryptNames {
+		return encPath, nil
+	}
+	segments := strings.Split(encPath, "/")
+	nonceSize := p.nameAEAD.NonceSize()
+	for i, segment := range segments {
+		data, err := nameEncoding.DecodeString(segment)
+		if err != nil || len(data) < nonceSize {
+			return "", fmt.Errorf("无法解密文件名: %s", encPath)
+		}
+		plain, err := p.nameAEAD.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+		if err != nil {
+			return "", fmt.Errorf("无法解密文件名: %s", encPath)
+		}
+		segments[i] = string(plain)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// encryptedSize 明文大小为size的文件加密后的大小，空文件也有一个分块
+func encryptedSize(size int64) int64 {
+	chunks := (size + encChunkSize - 1) / encChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return int64(encHeaderSize) + size + chunks*encTagSize
+}
+
+// plainSize encryptedSize的逆运算，大小不可能是加密文件时返回false
+func plainSize(size int64) (int64, bool) {
+	payload := size - int64(encHeaderSize)
+	if payload < encTagSize {
+		return 0, false
+	}
+	full, rem := payload/(encChunkSize+encTagSize), payload%(encChunkSize+encTagSize)
+	switch {
+	case rem == 0:
+		return full * encChunkSize, true
+	case rem < encTagSize || (rem == encTagSize && full > 0):
+		return 0, false
+	default:
+		return full*encChunkSize + rem - encTagSize, true
+	}
+}
+
+// chunkNonce 分块的nonce：文件的随机前缀加块序号
+func chunkNonce(prefix []byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encPrefixSize:], index)
+	return nonce
+}
+
+// chunkAAD 分块的附加数据
+func chunkAAD(relPath string, final bool) []byte {
+	flag := byte(0)
+	if final {
+		flag = 1
+	}
+	return append([]byte{flag}, relPath...)
+}
+
+// encryptStream 把大小为size的明文加密写入w，读到的数据与size不符时返回错误
+func (p *encryptedProvider) encryptStream(w io.Writer, r io.Reader, relPath string, size int64) error {
+	header := make([]byte, encHeaderSize)
+	copy(header, encMagic)
+	if _, err := rand.Read(header[len(encMagic):]); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	prefix := header[len(encMagic):]
+
+	chunks := (size + encChunkSize - 1) / encChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	buf := make([]byte, encChunkSize, encChunkSize+encTagSize)
+	remaining := size
+	for i := int64(0); i < chunks; i++ {
+		n := int64(encChunkSize)
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			return fmt.Errorf("文件大小在读取过程中变化: %v", err)
+		}
+		remaining -= n
+		sealed := p.contentKey.Seal(buf[:0], chunkNonce(prefix, uint32(i)), buf[:n], chunkAAD(relPath, i == chunks-1))
+		if _, err := w.Write(sealed); err != nil {
+			return err
+		}
+	}
+	if n, _ := r.Read(make([]byte, 1)); n > 0 {
+		return fmt.Errorf("文件大小在读取过程中变化")
+	}
+	return nil
+}
+
+// decryptReader 逐块解密，最后一块之后没有数据时才返回EOF，被截断的文件返回错误
+type decryptReader struct {
+	source  io.ReadCloser
+	reader  *bufio.Reader
+	aead    cipher.AEAD
+	relPath string
+	prefix  []byte
+	index   uint32
+	chunk   []byte // 已解密未读取的数据
+	buf     []byte
+	done    bool
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.chunk) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.chunk)
+	d.chunk = d.chunk[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.reader, d.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return fmt.Errorf("加密文件被截断: %s", d.relPath)
+		}
+		return err
+	}
+	final := err == io.ErrUnexpectedEOF
+	if !final {
+		if _, err := d.reader.Peek(1); err == io.EOF {
+			final = true
+		}
+	}
+	plain, err := d.aead.Open(d.buf[:0], chunkNonce(d.prefix, d.index), d.buf[:n], chunkAAD(d.relPath, final))
+	if err != nil {
+		return fmt.Errorf("解密失败，文件已损坏或被篡改: %s", d.relPath)
+	}
+	d.index++
+	d.chunk = plain
+	d.done = final
+	return nil
+}
+
+func (d *decryptReader) Close() error {
+	return d.source.Close()
+}
+
+// decryptStream 读取加密文件头并返回解密后的内容
+func (p *encryptedProvider) decryptStream(source io.ReadCloser, relPath string) (io.ReadCloser, error) {
+	reader := bufio.NewReader(source)
+	header := make([]byte, encHeaderSize)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:len(encMagic)]) != encMagic {
+		source.Close()
+		return nil, fmt.Errorf("不是加密文件: %s", relPath)
+	}
+	return &decryptReader{
+		source:  source,
+		reader:  reader,
+		aead:    p.contentKey,
+		relPath: relPath,
+		prefix:  header[len(encMagic):],
+		buf:     make([]byte, encChunkSize+encTagSize),
+	}, nil
+}
+
+// object 把底层存储的对象转换为明文的路径和大小
+func (p *encryptedProvider) object(object ObjectInfo) (ObjectInfo, error) {
+	relPath, err := p.decryptName(object.Path)
+	if err != nil {
+		return object, err
+	}
+	size, ok := plainSize(object.Size)
+	if !ok {
+		return object, fmt.Errorf("不是加密文件: %s", object.Path)
+	}
+	return ObjectInfo{Path: relPath, Size: size, ModTime: object.ModTime}, nil
+}
+
+func (p *encryptedProvider) List() ([]ObjectInfo, error) {
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	objects, err := p.inner.List()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		if object.Path == KeyFileName || isTempFile(object.Path) {
+			continue
+		}
+		plain, err := p.object(object)
+		if err != nil {
+			log.Printf("跳过无法识别的加密文件: %v", err)
+			continue
+		}
+		result = append(result, plain)
+	}
+	return result, nil
+}
+
+func (p *encryptedProvider) Stat(relPath string) (*ObjectInfo, error) {
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	object, err := p.inner.Stat(p.encryptName(relPath))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := p.object(*object)
+	if err != nil {
+		return nil, err
+	}
+	return &plain, nil
+}
+
+func (p *encryptedProvider) Read(relPath string) (io.ReadCloser, error) {
+	if err := p.init(); err != nil {
+		return nil, err
+	}
+	source, err := p.inner.Read(p.encryptName(relPath))
+	if err != nil {
+		return nil, err
+	}
+	return p.decryptStream(source, relPath)
+}
+
+// Write 边读取边加密，底层存储收到的是已知大小的密文流
+func (p *encryptedProvider) Write(relPath string, r io.Reader, size int64) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(p.encryptStream(pw, r, relPath, size))
+	}()
+	err := p.inner.Write(p.encryptName(relPath), pr, encryptedSize(size))
+	pr.CloseWithError(io.ErrClosedPipe)
+	return err
+}
+
+func (p *encryptedProvider) Delete(relPath string) error {
+	if err := p.init(); err != nil {
+		return err
+	}
+	return p.inner.Delete(p.encryptName(relPath))
+}
+
+// Restore 把同步目标（加密时解密）中的全部文件恢复到本地目录targetDir，返回恢复的文件数。
+// 每个文件先写入临时文件再重命名，已存在的同名文件被覆盖
+func (fs *FileSync) Restore(targetDir string) (int, error) {
+	if fs.storage == nil {
+		return 0, fmt.Errorf("恢复需要配置Target或Encryption")
+	}
+	objects, err := fs.storage.List()
+	if err != nil {
+		return 0, fmt.Errorf("列出远端文件失败: %v", err)
+	}
+
+	var mutex sync.Mutex
+	restored := 0
+	var errs []string
+	parallel(len(objects), fs.config.Workers, func(i int) {
+		err := fs.restoreFile(objects[i], targetDir)
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		restored++
+	})
+	if len(errs) > 0 {
+		return restored, fmt.Errorf("%d个文件恢复失败: %s", len(errs), strings.Join(errs, "; "))
+	}
+	fmt.Printf("恢复完成，共%d个文件\n", restored)
+	return restored, nil
+}
+
+// restoreFile 恢复单个文件
+func (fs *FileSync) restoreFile(object ObjectInfo, targetDir string) error {
+	relPath, err := cleanObjectPath(object.Path)
+	if err != nil {
+		return err
+	}
+	destPath := filepath.Join(targetDir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("创建目录失败 %s: %v", filepath.Dir(destPath), err)
+	}
+
+	reader, err := fs.storage.Read(object.Path)
+	if err != nil {
+		return fmt.Errorf("读取远端文件失败 %s: %v", object.Path, err)
+	}
+	defer reader.Close()
+
+	part := partPath(destPath, "")
+	file, err := os.Create(part)
+	if err != nil {
+		return fmt.Errorf("创建文件失败 %s: %v", part, err)
+	}
+	_, err = io.Copy(file, fs.throttle(reader))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(part)
+		return fmt.Errorf("恢复文件失败 %s: %v", object.Path, err)
+	}
+	if err := os.Rename(part, destPath); err != nil {
+		os.Remove(part)
+		return fmt.Errorf("替换文件失败 %s: %v", destPath, err)
+	}
+	if !object.ModTime.IsZero() {
+		os.Chtimes(destPath, time.Now(), object.ModTime)
+	}
+	return nil
+}
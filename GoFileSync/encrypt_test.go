@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2Vectors(t *testing.T) {
+	cases := []struct {
+		iterations, keyLen int
+		want               string
+	}{
+		{1, 32, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, 32, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{1, 40, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b4dbf3a2f3dad3377"},
+	}
+	for _, c := range cases {
+		if got := hex.EncodeToString(pbkdf2Key([]byte("password"), []byte("salt"), c.iterations, c.keyLen)); got != c.want {
+			t.Errorf("PBKDF2(%d, %d) = %s，期望 %s", c.iterations, c.keyLen, got, c.want)
+		}
+	}
+}
+
+// collectFiles 读取目录中的全部文件，跳过KeyFileName
+func collectFiles(t *testing.T, dir string) map[string][]byte {
+	files := make(map[string][]byte)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() == KeyFileName {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		data, _ := os.ReadFile(path)
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return files
+}
+
+func TestEncryptedLocalSync(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	big := bytes.Repeat([]byte("secret-content "), 2*encChunkSize/15+7)
+	os.MkdirAll(filepath.Join(sourceDir, "private"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "private", "plans.txt"), big, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "empty.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "exact.bin"), bytes.Repeat([]byte{7}, encChunkSize), 0644)
+
+	key := bytes.Repeat([]byte{1}, encKeySize)
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true, Encryption: &EncryptionConfig{Key: key, EncryptNames: true}}
+	fs := NewFileSync(config)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := collectFiles(t, destDir)
+	if len(files) != 3 {
+		t.Fatalf("目标目录应有3个加密文件: %v", len(files))
+	}
+	for name, data := range files {
+		if strings.Contains(name, "private") || strings.Contains(name, "plans") || strings.Contains(name, ".txt") {
+			t.Errorf("文件名未加密: %s", name)
+		}
+		if bytes.Contains(data, []byte("secret-content")) {
+			t.Errorf("文件内容未加密: %s", name)
+		}
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	// 删除源文件后同步删除对应的加密文件
+	os.Remove(filepath.Join(sourceDir, "empty.txt"))
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if files := collectFiles(t, destDir); len(files) != 2 {
+		t.Errorf("多余的加密文件应被删除: %d", len(files))
+	}
+
+	restoreDir := t.TempDir()
+	restored, err := NewFileSync(config).Restore(restoreDir)
+	if err != nil || restored != 2 {
+		t.Fatalf("恢复结果不正确: %d %v", restored, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restoreDir, "private", "plans.txt")); !bytes.Equal(data, big) {
+		t.Error("恢复的内容与源文件不一致")
+	}
+	if data, _ := os.ReadFile(filepath.Join(restoreDir, "exact.bin")); len(data) != encChunkSize {
+		t.Errorf("整块大小的文件恢复后长度不正确: %d", len(data))
+	}
+}
+
+func TestEncryptionPassphraseAndTampering(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("0123456789"), encChunkSize/5)
+	os.WriteFile(filepath.Join(sourceDir, "data.bin"), content, 0644)
+
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, Encryption: &EncryptionConfig{Passphrase: "correct horse"}}
+	if err := NewFileSync(config).Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, KeyFileName)); err != nil {
+		t.Fatalf("应写入密钥参数文件: %v", err)
+	}
+
+	wrong := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, Encryption: &EncryptionConfig{Passphrase: "wrong"}}
+	if _, err := NewFileSync(wrong).Plan(); err == nil || !strings.Contains(err.Error(), errWrongKey.Error()) {
+		t.Errorf("错误的口令应被拒绝: %v", err)
+	}
+	rawKey := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, Encryption: &EncryptionConfig{Key: make([]byte, encKeySize)}}
+	if _, err := NewFileSync(rawKey).Plan(); err == nil {
+		t.Error("密钥方式与目标不符时应返回错误")
+	}
+
+	storage := NewFileSync(config).storage
+	readAll := func() ([]byte, error) {
+		reader, err := storage.Read("data.bin")
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	if data, err := readAll(); err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("解密失败: %v", err)
+	}
+
+	encPath := filepath.Join(destDir, "data.bin")
+	original, _ := os.ReadFile(encPath)
+
+	// 修改一个字节
+	tampered := append([]byte(nil), original...)
+	tampered[encHeaderSize+10] ^= 1
+	os.WriteFile(encPath, tampered, 0644)
+	if _, err := readAll(); err == nil {
+		t.Error("被修改的密文应解密失败")
+	}
+
+	// 在块边界截断
+	os.WriteFile(encPath, original[:encHeaderSize+encChunkSize+encTagSize], 0644)
+	if _, err := readAll(); err == nil {
+		t.Error("在块边界截断的密文应解密失败")
+	}
+
+	// 换到其他路径下
+	os.WriteFile(encPath, original, 0644)
+	os.WriteFile(filepath.Join(destDir, "other.bin"), original, 0644)
+	if reader, err := storage.Read("other.bin"); err == nil {
+		if _, err := io.ReadAll(reader); err == nil {
+			t.Error("移动到其他路径的密文应解密失败")
+		}
+		reader.Close()
+	}
+}
+
+func TestEncryptedRemoteTarget(t *testing.T) {
+	sourceDir, remoteDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "docs"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "docs", "report.txt"), []byte("quarterly report"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+
+	target := &LocalProvider{Root: remoteDir}
+	encryption := &EncryptionConfig{Key: bytes.Repeat([]byte{9}, encKeySize)}
+	config := &SyncConfig{SourceDir: sourceDir, Target: target, DeleteExtra: true, Encryption: encryption}
+	fs := NewFileSync(config)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未加密文件名时路径保持不变，内容加密
+	data, err := os.ReadFile(filepath.Join(remoteDir, "docs", "report.txt"))
+	if err != nil || bytes.Contains(data, []byte("quarterly")) || int64(len(data)) != encryptedSize(16) {
+		t.Errorf("远端文件应为加密内容: %q %v", data, err)
+	}
+	if info, err := fs.storage.Stat("docs/report.txt"); err != nil || info.Size != 16 {
+		t.Errorf("Stat应返回明文大小: %+v %v", info, err)
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	// 无法识别的文件被跳过
+	os.WriteFile(filepath.Join(remoteDir, "x"), []byte("x"), 0644)
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("无法识别的远端文件不应参与同步: %+v", actions)
+	}
+
+	restoreDir := t.TempDir()
+	if restored, err := fs.Restore(restoreDir); err != nil || restored != 2 {
+		t.Fatalf("恢复结果不正确: %d %v", restored, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(restoreDir, "docs", "report.txt")); string(data) != "quarterly report" {
+		t.Errorf("恢复的内容不正确: %q", data)
+	}
+}
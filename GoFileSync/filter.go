@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pathPattern 一条gitignore风格的路径规则：
+//   - 不含"/"的规则匹配任意层级的文件名或目录名，如 "*.tmp"、"node_modules"
+//   - 开头或中间含"/"的规则相对同步根目录匹配，如 "/build"、"docs/*.md"
+//   - 以"/"结尾的规则只匹配目录，如 "build/"
+//   - "**" 匹配任意层目录，如 "**/cache"、"logs/**"、"a/**/b"
+//   - "!" 开头表示取反，如排除规则中的 "!keep.tmp" 重新包含之前被排除的文件
+type pathPattern struct {
+	negate   bool
+	dirOnly  bool
+	anchored bool
+	segments []string
+}
+
+func compilePattern(raw string) (pathPattern, error) {
+	var p pathPattern
+	pattern := strings.TrimSpace(raw)
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		p.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+	if pattern == "" {
+		return p, fmt.Errorf("无效的过滤规则: %q", raw)
+	}
+
+	p.segments = strings.Split(pattern, "/")
+	for _, segment := range p.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return p, fmt.Errorf("无效的过滤规则: %q", raw)
+		}
+	}
+	return p, nil
+}
+
+// match 判断斜杠分隔的相对路径是否匹配规则
+func (p pathPattern) match(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	segments := strings.Split(relPath, "/")
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], segments[len(segments)-1])
+		return ok
+	}
+	return matchSegments(p.segments, segments)
+}
+
+// matchSegments 逐级匹配路径，"**" 可以匹配零个或多个目录
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// pathFilter 由SyncConfig的Include和Exclude编译的过滤器
+type pathFilter struct {
+	include []pathPattern
+	exclude []pathPattern
+}
+
+func newPathFilter(include, exclude []string) (*pathFilter, error) {
+	filter := &pathFilter{}
+	for _, raw := range include {
+		p, err := compilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, p)
+	}
+	for _, raw := range exclude {
+		p, err := compilePattern(raw)
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, p)
+	}
+	return filter, nil
+}
+
+// pathFilter 返回编译后的过滤器，规则无效时返回错误
+func (fs *FileSync) pathFilter() (*pathFilter, error) {
+	fs.filterOnce.Do(func() {
+		fs.filter, fs.filterErr = newPathFilter(fs.config.Include, fs.config.Exclude)
+	})
+	return fs.filter, fs.filterErr
+}
+
+// excluded 按顺序应用排除规则，最后一条匹配的规则决定结果
+func (f *pathFilter) excluded(relPath string, isDir bool) bool {
+	excluded := false
+	for _, p := range f.exclude {
+		if p.match(relPath, isDir) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// allowsDir 判断目录是否需要遍历：目录本身及其上级目录都没有被排除
+func (f *pathFilter) allowsDir(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for i := 0; i <= len(relPath); i++ {
+		if (i == len(relPath) || relPath[i] == '/') && f.excluded(relPath[:i], true) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsFile 判断文件是否需要同步：所在目录没有被排除、文件本身没有被排除，
+// 并且在配置了包含规则时，文件或其上级目录匹配包含规则（同样是最后一条匹配的规则决定结果）
+func (f *pathFilter) allowsFile(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if dir := path.Dir(relPath); dir != "." && !f.allowsDir(dir) {
+		return false
+	}
+	if f.excluded(relPath, false) {
+		return false
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+
+	included := false
+	for _, p := range f.include {
+		if p.matchWithParents(relPath) {
+			included = !p.negate
+		}
+	}
+	return included
+}
+
+// matchWithParents 判断文件本身或其任一上级目录是否匹配规则
+func (p pathPattern) matchWithParents(relPath string) bool {
+	if p.match(relPath, false) {
+		return true
+	}
+	for i := 0; i < len(relPath); i++ {
+		if relPath[i] == '/' && p.match(relPath[:i], true) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathPatternMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{"*.tmp", "a.tmp", false, true},
+		{"*.tmp", "deep/dir/a.tmp", false, true},
+		{"*.tmp", "a.tmp.txt", false, false},
+		{"node_modules", "web/node_modules", true, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"/build", "build", true, true},
+		{"/build", "src/build", true, false},
+		{"docs/*.md", "docs/a.md", false, true},
+		{"docs/*.md", "docs/sub/a.md", false, false},
+		{"**/cache", "cache", true, true},
+		{"**/cache", "a/b/cache", true, true},
+		{"logs/**", "logs/2024/app.log", false, true},
+		{"a/**/b", "a/b", true, true},
+		{"a/**/b", "a/x/y/b", true, true},
+		{"a/**/b", "a/x/c", true, false},
+	}
+	for _, c := range cases {
+		p, err := compilePattern(c.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.match(c.path, c.isDir); got != c.want {
+			t.Errorf("%q 匹配 %q (目录=%v): 期望%v，实际%v", c.pattern, c.path, c.isDir, c.want, got)
+		}
+	}
+
+	for _, invalid := range []string{"", "/", "!", "[a-"} {
+		if _, err := compilePattern(invalid); err == nil {
+			t.Errorf("%q 应为无效规则", invalid)
+		}
+	}
+}
+
+func TestExcludePatterns(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	for _, relPath := range []string{
+		"main.go",
+		"app.tmp",
+		"keep.tmp",
+		"web/node_modules/lib/index.js",
+		"web/index.js",
+		"build/out.bin",
+		"src/build/gen.go",
+	} {
+		path := filepath.Join(sourceDir, relPath)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(relPath), 0644)
+	}
+	// 目标目录中被排除的文件不会被DeleteExtra删除
+	os.WriteFile(filepath.Join(destDir, "local.tmp"), []byte("local"), 0644)
+
+	fs := NewFileSync(&SyncConfig{
+		SourceDir:   sourceDir,
+		DestDir:     destDir,
+		DeleteExtra: true,
+		Exclude:     []string{"node_modules/", "*.tmp", "/build", "!keep.tmp"},
+	})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for relPath, want := range map[string]bool{
+		"main.go":                       true,
+		"keep.tmp":                      true,
+		"web/index.js":                  true,
+		"src/build/gen.go":              true,
+		"app.tmp":                       false,
+		"web/node_modules/lib/index.js": false,
+		"build/out.bin":                 false,
+		"local.tmp":                     true,
+	} {
+		_, err := os.Stat(filepath.Join(destDir, relPath))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s: 期望存在=%v，实际%v", relPath, want, exists)
+		}
+	}
+
+	// 增量同步同样应用过滤规则
+	os.WriteFile(filepath.Join(sourceDir, "web", "node_modules", "new.js"), []byte("x"), 0644)
+	fs.SyncPaths([]string{filepath.Join("web", "node_modules", "new.js"), "app.tmp"})
+	if _, err := os.Stat(filepath.Join(destDir, "web", "node_modules")); !os.IsNotExist(err) {
+		t.Error("增量同步不应复制被排除的目录")
+	}
+}
+
+func TestIncludePatterns(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	for _, relPath := range []string{"a.go", "a_test.go", "README.md", "docs/guide.txt", "docs/old/notes.txt", "img/logo.png"} {
+		path := filepath.Join(sourceDir, relPath)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(relPath), 0644)
+	}
+
+	fs := NewFileSync(&SyncConfig{
+		SourceDir: sourceDir,
+		DestDir:   destDir,
+		Include:   []string{"*.go", "!*_test.go", "docs/"},
+		Exclude:   []string{"old/"},
+	})
+	actions, err := fs.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, action := range actions {
+		got = append(got, filepath.ToSlash(action.Path))
+	}
+	if len(got) != 2 || got[0] != "a.go" || got[1] != "docs/guide.txt" {
+		t.Errorf("包含规则结果不正确: %v", got)
+	}
+
+	invalid := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Exclude: []string{"[a-"}})
+	if err := invalid.Sync(); err == nil {
+		t.Error("无效的过滤规则应返回错误")
+	}
+}
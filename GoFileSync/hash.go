@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/bits"
+)
+
+// 可选的内容哈希算法
+const (
+	HashMD5    = "md5"      // 默认，与S3的ETag和旧版本的哈希缓存、同步状态兼容
+	HashXXH64  = "xxhash64" // 非加密哈希，速度最快，适合检测变化
+	HashSHA256 = "sha256"   // 抗碰撞，适合完整性校验
+)
+
+// hashAlgorithm 实际使用的哈希算法
+func (fs *FileSync) hashAlgorithm() string {
+	if fs.config.HashAlgorithm == "" {
+		return HashMD5
+	}
+	return fs.config.HashAlgorithm
+}
+
+// checkHashAlgorithm 检查HashAlgorithm是否受支持
+func (fs *FileSync) checkHashAlgorithm() error {
+	switch fs.hashAlgorithm() {
+	case HashMD5, HashXXH64, HashSHA256:
+		return nil
+	}
+	return fmt.Errorf("不支持的哈希算法: %s", fs.config.HashAlgorithm)
+}
+
+// newHash 创建HashAlgorithm对应的哈希器，结果以十六进制字符串表示
+func (fs *FileSync) newHash() hash.Hash {
+	switch fs.hashAlgorithm() {
+	case HashXXH64:
+		return newXXH64(0)
+	case HashSHA256:
+		return sha256.New()
+	}
+	return md5.New()
+}
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+// xxh64 流式的XXH64，Sum按大端序输出8字节
+type xxh64 struct {
+	seed  uint64
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int // buf中未处理的字节数
+}
+
+func newXXH64(seed uint64) *xxh64 {
+	h := &xxh64{seed: seed}
+	h.Reset()
+	return h
+}
+
+func (h *xxh64) Reset() {
+	h.v = [4]uint64{h.seed + xxhPrime1 + xxhPrime2, h.seed + xxhPrime2, h.seed, h.seed - xxhPrime1}
+	h.total, h.n = 0, 0
+}
+
+func (h *xxh64) Size() int      { return 8 }
+func (h *xxh64) BlockSize() int { return 32 }
+
+func xxhRound(acc, input uint64) uint64 {
+	acc += input * xxhPrime2
+	return bits.RotateLeft64(acc, 31) * xxhPrime1
+}
+
+func xxhMerge(acc, v uint64) uint64 {
+	acc ^= xxhRound(0, v)
+	return acc*xxhPrime1 + xxhPrime4
+}
+
+// stripes 处理若干个完整的32字节块
+func (h *xxh64) stripes(p []byte) {
+	for ; len(p) >= 32; p = p[32:] {
+		for i := range h.v {
+			h.v[i] = xxhRound(h.v[i], binary.LittleEndian.Uint64(p[i*8:]))
+		}
+	}
+}
+
+func (h *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	h.total += uint64(written)
+	if h.n > 0 {
+		c := copy(h.buf[h.n:], p)
+		h.n += c
+		p = p[c:]
+		if h.n < 32 {
+			return written, nil
+		}
+		h.stripes(h.buf[:])
+		h.n = 0
+	}
+	full := len(p) &^ 31
+	h.stripes(p[:full])
+	h.n = copy(h.buf[:], p[full:])
+	return written, nil
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var acc uint64
+	if h.total >= 32 {
+		acc = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) + bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			acc = xxhMerge(acc, v)
+		}
+	} else {
+		acc = h.seed + xxhPrime5
+	}
+	acc += h.total
+
+	p := h.buf[:h.n]
+	for ; len(p) >= 8; p = p[8:] {
+		acc ^= xxhRound(0, binary.LittleEndian.Uint64(p))
+		acc = bits.RotateLeft64(acc, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(p) >= 4 {
+		acc ^= uint64(binary.LittleEndian.Uint32(p)) * xxhPrime1
+		acc = bits.RotateLeft64(acc, 23)*xxhPrime2 + xxhPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		acc ^= uint64(b) * xxhPrime5
+		acc = bits.RotateLeft64(acc, 11) * xxhPrime1
+	}
+
+	acc ^= acc >> 33
+	acc *= xxhPrime2
+	acc ^= acc >> 29
+	acc *= xxhPrime3
+	acc ^= acc >> 32
+	return acc
+}
+
+func (h *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, h.Sum64())
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestXXH64(t *testing.T) {
+	vectors := map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	}
+	for input, expected := range vectors {
+		h := newXXH64(0)
+		h.Write([]byte(input))
+		if sum := h.Sum64(); sum != expected {
+			t.Errorf("xxh64(%q) = %x，期望 %x", input, sum, expected)
+		}
+	}
+
+	// 任意切分写入的结果与一次写入相同
+	data := bytes.Repeat([]byte("0123456789abcdefghij"), 500)
+	whole := newXXH64(0)
+	whole.Write(data)
+	for _, chunk := range []int{1, 7, 31, 32, 33, 1000} {
+		h := newXXH64(0)
+		for i := 0; i < len(data); i += chunk {
+			h.Write(data[i:min(i+chunk, len(data))])
+		}
+		if h.Sum64() != whole.Sum64() {
+			t.Errorf("按%d字节分块写入的结果不同", chunk)
+		}
+	}
+}
+
+func TestHashAlgorithmSelection(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("hello"), 0644)
+
+	lengths := map[string]int{HashMD5: 32, HashXXH64: 16, HashSHA256: 64}
+	for algorithm, length := range lengths {
+		fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashAlgorithm: algorithm})
+		files, err := fs.scanDirectory(sourceDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash := files["a.txt"].Hash; len(hash) != length {
+			t.Errorf("%s哈希的长度不正确: %s", algorithm, hash)
+		}
+		if err := fs.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(destDir, "a.txt")); string(data) != "hello" {
+			t.Errorf("%s: 同步的内容不正确", algorithm)
+		}
+	}
+
+	if err := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashAlgorithm: "crc32"}).Sync(); err == nil {
+		t.Error("不支持的哈希算法应返回错误")
+	}
+}
+
+func TestStreamedHashCachedAfterCopy(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	srcPath := filepath.Join(sourceDir, "a.txt")
+	os.WriteFile(srcPath, []byte("streamed"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(srcPath, old, old)
+
+	cachePath := filepath.Join(t.TempDir(), "hashes.json")
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashCache: cachePath, HashAlgorithm: HashXXH64})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目标文件的哈希在复制时已写入缓存，下次同步不必读取
+	fs.hashes.hits, fs.hashes.misses = 0, 0
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Fatalf("同步后不应再有操作: %+v", actions)
+	}
+	if fs.hashes.hits != 2 || fs.hashes.misses != 0 {
+		t.Errorf("源文件和目标文件都应命中缓存: %d次命中 %d次未命中", fs.hashes.hits, fs.hashes.misses)
+	}
+	data, _ := os.ReadFile(cachePath)
+	var entries map[string]hashCacheEntry
+	json.Unmarshal(data, &entries)
+	if entry := entries[cacheKey(filepath.Join(destDir, "a.txt"))]; entry.Algo != HashXXH64 || len(entry.Hash) != 16 {
+		t.Errorf("缓存应记录算法: %+v", entry)
+	}
+
+	// 换用其他算法时不使用旧算法的缓存
+	sha := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashCache: cachePath, HashAlgorithm: HashSHA256})
+	files, err := sha.scanDirectory(sourceDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash := files["a.txt"].Hash; len(hash) != 64 || sha.hashes.hits != 0 {
+		t.Errorf("换用算法后应重新计算哈希: %s", hash)
+	}
+
+	// 双向同步的状态与算法不一致时拒绝同步，避免把所有文件当作冲突
+	state := filepath.Join(t.TempDir(), "state.json")
+	bidirectional := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true, StateFile: state})
+	if err := bidirectional.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	bidirectional = NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true, StateFile: state, HashAlgorithm: HashSHA256})
+	if err := bidirectional.Sync(); err == nil {
+		t.Error("状态的哈希算法不一致时应返回错误")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hashCacheRacyWindow 修改时间距计算哈希不足该时长的文件不缓存：
+// 同一时间戳精度内再次写入相同大小的内容时，大小和修改时间都不会变化
+const hashCacheRacyWindow = time.Second
+
+// hashCacheEntry 计算哈希时文件的大小和修改时间
+type hashCacheEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"` // UnixNano
+	Hash    string `json:"hash"`
+	Algo    string `json:"algo,omitempty"` // 为空表示HashMD5
+}
+
+// hashCache 持久化的文件哈希缓存，键为文件的绝对路径，大小或修改时间变化时缓存失效
+type hashCache struct {
+	path    string
+	mutex   sync.Mutex
+	entries map[string]hashCacheEntry
+	dirty   bool
+	hits    int64
+	misses  int64
+}
+
+// loadHashCache 读取缓存文件，文件不存在或损坏时从空缓存开始
+func loadHashCache(path string) *hashCache {
+	cache := &hashCache{path: path, entries: make(map[string]hashCacheEntry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("读取哈希缓存失败 %s: %v", path, err)
+		}
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		log.Printf("哈希缓存已损坏，重新计算 %s: %v", path, err)
+		cache.entries = make(map[string]hashCacheEntry)
+	}
+	return cache
+}
+
+func cacheKey(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filePath
+}
+
+// cacheAlgo 缓存中记录的算法名，MD5记为空以兼容旧的缓存文件
+func cacheAlgo(algorithm string) string {
+	if algorithm == HashMD5 {
+		return ""
+	}
+	return algorithm
+}
+
+// lookup 大小、修改时间和哈希算法都与缓存一致时返回缓存的哈希
+func (c *hashCache) lookup(filePath string, size int64, modTime time.Time, algorithm string) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.entries[cacheKey(filePath)]
+	if exists && entry.Size == size && entry.ModTime == modTime.UnixNano() && entry.Algo == cacheAlgo(algorithm) {
+		c.hits++
+		return entry.Hash, true
+	}
+	c.misses++
+	return "", false
+}
+
+// store 记录文件的哈希，刚修改过的文件不缓存
+func (c *hashCache) store(filePath string, size int64, modTime time.Time, algorithm, hash string) {
+	if time.Since(modTime) < hashCacheRacyWindow {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[cacheKey(filePath)] = hashCacheEntry{Size: size, ModTime: modTime.UnixNano(), Hash: hash, Algo: cacheAlgo(algorithm)}
+	c.dirty = true
+}
+
+// forget 删除已删除文件的缓存
+func (c *hashCache) forget(filePath string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, exists := c.entries[cacheKey(filePath)]; exists {
+		delete(c.entries, cacheKey(filePath))
+		c.dirty = true
+	}
+}
+
+// prune 全量扫描dir后删除其中已不存在的文件的缓存
+func (c *hashCache) prune(dir string, seen map[string]bool) {
+	prefix := cacheKey(dir) + string(filepath.Separator)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) && !seen[key] {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+}
+
+// save 有变化时写入缓存文件，写入临时文件后重命名
+func (c *hashCache) save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("写入哈希缓存失败: %v", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入哈希缓存失败: %v", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("写入哈希缓存失败: %v", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// hashFile 返回文件哈希，配置了HashCache且文件的大小和修改时间未变时使用缓存
+func (fs *FileSync) hashFile(filePath string, size int64, modTime time.Time) (string, error) {
+	if fs.hashes != nil && !fs.config.ForceRehash && !fs.rehash.Load() {
+		if hash, ok := fs.hashes.lookup(filePath, size, modTime, fs.hashAlgorithm()); ok {
+			return hash, nil
+		}
+	}
+	hash, err := fs.calculateHash(filePath)
+	if err != nil {
+		return "", err
+	}
+	if fs.hashes != nil {
+		fs.hashes.store(filePath, size, modTime, fs.hashAlgorithm(), hash)
+	}
+	return hash, nil
+}
+
+// cacheCopied 缓存复制时边写入边计算的目标文件哈希，之后不必再读取目标文件
+func (fs *FileSync) cacheCopied(destPath string, hash string) {
+	if fs.hashes == nil || hash == "" {
+		return
+	}
+	info, err := os.Lstat(destPath)
+	if err != nil || info.Mode()&os.ModeSymlink != 0 {
+		return
+	}
+	fs.hashes.store(destPath, info.Size(), info.ModTime(), fs.hashAlgorithm(), hash)
+}
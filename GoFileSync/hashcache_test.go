@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// resetCounters 清零缓存的命中计数
+func resetCounters(c *hashCache) {
+	c.mutex.Lock()
+	c.hits, c.misses = 0, 0
+	c.mutex.Unlock()
+}
+
+func TestHashCacheSkipsUnchangedFiles(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeWithTime(filepath.Join(sourceDir, name), "content of "+name, old)
+	}
+
+	cachePath := filepath.Join(t.TempDir(), "hashes.json")
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashCache: cachePath})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.hashes.misses != 3 {
+		t.Errorf("首次同步应计算3个源文件的哈希，实际未命中%d次", fs.hashes.misses)
+	}
+
+	// 复制后目标文件的哈希直接写入缓存，再次扫描两侧都命中
+	resetCounters(fs.hashes)
+	if actions, err := fs.Plan(); err != nil || len(actions) != 0 {
+		t.Fatalf("同步后不应再有操作: %+v, %v", actions, err)
+	}
+	if fs.hashes.hits != 6 || fs.hashes.misses != 0 {
+		t.Errorf("期望命中6次、未命中0次，实际命中%d次、未命中%d次", fs.hashes.hits, fs.hashes.misses)
+	}
+}
+
+func TestHashCacheInvalidation(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	old := time.Now().Add(-time.Hour)
+	path := filepath.Join(sourceDir, "data.txt")
+	writeWithTime(path, "version one", old)
+
+	cachePath := filepath.Join(t.TempDir(), "hashes.json")
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashCache: cachePath})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 大小不变但修改时间变化：缓存失效，内容变化被发现
+	writeWithTime(path, "version two", old.Add(time.Minute))
+	resetCounters(fs.hashes)
+	actions, err := fs.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Op != ActionCopy {
+		t.Errorf("修改时间变化后应复制文件: %+v", actions)
+	}
+	if fs.hashes.misses != 1 {
+		t.Errorf("只有修改过的文件需要重新计算哈希，实际未命中%d次", fs.hashes.misses)
+	}
+
+	// 伪造的缓存条目与文件的大小和修改时间一致时会被信任，ForceRehash忽略缓存
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	destPath := filepath.Join(destDir, "data.txt")
+	info, _ := os.Stat(destPath)
+	fs.hashes.store(destPath, info.Size(), info.ModTime(), HashMD5, "stale")
+	if actions, _ := fs.Plan(); len(actions) != 1 {
+		t.Errorf("缓存的哈希不一致时应复制文件: %+v", actions)
+	}
+
+	fs.config.ForceRehash = true
+	resetCounters(fs.hashes)
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("强制校验时应按实际内容比较: %+v", actions)
+	}
+	if fs.hashes.hits != 0 {
+		t.Errorf("强制校验时不应使用缓存，实际命中%d次", fs.hashes.hits)
+	}
+	// 强制校验的结果写回缓存
+	if hash, ok := fs.hashes.lookup(destPath, info.Size(), info.ModTime(), HashMD5); !ok || hash == "stale" {
+		t.Errorf("强制校验后缓存应更新，实际为%q", hash)
+	}
+}
+
+func TestHashCachePersistence(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	old := time.Now().Add(-time.Hour)
+	writeWithTime(filepath.Join(sourceDir, "keep.txt"), "keep", old)
+	writeWithTime(filepath.Join(sourceDir, "drop.txt"), "drop", old)
+
+	cachePath := filepath.Join(t.TempDir(), "cache", "hashes.json")
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true, HashCache: cachePath}
+	if err := NewFileSync(config).Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Fatalf("同步后应写入缓存文件: %v", err)
+	}
+
+	// 新实例从缓存文件加载，删除的文件从缓存中清除
+	os.Remove(filepath.Join(sourceDir, "drop.txt"))
+	fs := NewFileSync(config)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if fs.hashes.misses != 0 {
+		t.Errorf("重新加载的缓存应全部命中，实际未命中%d次", fs.hashes.misses)
+	}
+	reloaded := loadHashCache(cachePath)
+	if len(reloaded.entries) != 2 {
+		t.Errorf("期望缓存两侧的keep.txt，实际: %v", reloaded.entries)
+	}
+	for key := range reloaded.entries {
+		if filepath.Base(key) != "keep.txt" {
+			t.Errorf("已删除的文件仍在缓存中: %s", key)
+		}
+	}
+
+	// 损坏的缓存文件被忽略，同步照常进行
+	os.WriteFile(cachePath, []byte("{not json"), 0644)
+	fs = NewFileSync(config)
+	if len(fs.hashes.entries) != 0 {
+		t.Errorf("损坏的缓存应从空缓存开始")
+	}
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(loadHashCache(cachePath).entries) != 2 {
+		t.Errorf("同步后应重新写入缓存")
+	}
+}
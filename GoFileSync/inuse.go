@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultInUseRetry 有文件因可能正在写入被推迟、且未设置StabilityWindow时，定期同步和监听模式重试的间隔
+const DefaultInUseRetry = 5 * time.Second
+
+// busyReason 源文件是否可能正在被写入，返回原因，为空表示可以同步
+func (fs *FileSync) busyReason(path string, info *FileInfo) string {
+	if window := fs.config.StabilityWindow; window > 0 && time.Since(info.ModTime) < window {
+		return "修改时间在稳定窗口内"
+	}
+	if !fs.config.SkipInUse || info.Link != "" {
+		return ""
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		// 文件已被删除等情况由复制报告错误
+		return ""
+	}
+	if current.Size() != info.Size || !current.ModTime().Equal(info.ModTime) {
+		return "扫描后大小或修改时间发生变化"
+	}
+	if fileLocked(path) {
+		return "文件被其他进程锁定"
+	}
+	return ""
+}
+
+// deferBusy 从计划中去掉可能正在写入的文件的复制操作，这些文件本次不同步，计入result.Deferred并加入failed，
+// 双向同步不会把它们记为已同步
+func (fs *FileSync) deferBusy(actions []SyncAction, srcFiles map[string]*FileInfo, result *RunResult, failed map[string]bool) []SyncAction {
+	if fs.config.StabilityWindow <= 0 && !fs.config.SkipInUse {
+		return actions
+	}
+	kept := actions[:0:0]
+	for _, action := range actions {
+		info := srcFiles[action.Path]
+		if action.Op == ActionCopy && info != nil {
+			from := fs.config.SourceDir
+			if action.Direction == DirectionToSource {
+				from = fs.config.DestDir
+			}
+			if reason := fs.busyReason(filepath.Join(from, action.Path), info); reason != "" {
+				log.Printf("推迟同步 %s: %s", action.Path, reason)
+				result.Deferred++
+				result.Files = append(result.Files, FileResult{Path: action.Path, Op: action.Op, Direction: action.Direction, Status: FileDeferred, Size: action.Size, Error: reason})
+				failed[action.Path] = true
+				continue
+			}
+		}
+		kept = append(kept, action)
+	}
+	return kept
+}
+
+// retryAfter 上次同步有被推迟的文件时返回重试的定时器，否则返回nil
+func (fs *FileSync) retryAfter() <-chan time.Time {
+	if fs.deferred.Load() == 0 {
+		return nil
+	}
+	delay := fs.config.StabilityWindow
+	if delay <= 0 {
+		delay = DefaultInUseRetry
+	}
+	return time.After(delay)
+}
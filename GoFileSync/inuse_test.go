@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStabilityWindowDefersRecentFiles(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	old := time.Now().Add(-time.Hour)
+	os.WriteFile(filepath.Join(sourceDir, "done.txt"), []byte("done"), 0644)
+	os.Chtimes(filepath.Join(sourceDir, "done.txt"), old, old)
+	os.WriteFile(filepath.Join(sourceDir, "uploading.bin"), []byte("half"), 0644)
+	os.WriteFile(filepath.Join(destDir, "uploading.bin"), []byte("previous"), 0644)
+
+	var result *RunResult
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true, StabilityWindow: time.Minute})
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Deferred != 1 || result.Copied != 1 || result.Failed != 0 {
+		t.Errorf("应推迟刚修改的文件: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "done.txt")); err != nil {
+		t.Error("稳定的文件应正常同步")
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "uploading.bin")); string(data) != "previous" {
+		t.Errorf("推迟的文件应保留目标中的旧版本: %q", data)
+	}
+
+	// 超过稳定窗口后同步
+	os.Chtimes(filepath.Join(sourceDir, "uploading.bin"), old, old)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "uploading.bin")); string(data) != "half" || result.Deferred != 0 {
+		t.Errorf("稳定后应同步: %q %+v", data, result)
+	}
+}
+
+func TestSkipInUseDetectsChangesAfterScan(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	path := filepath.Join(sourceDir, "growing.log")
+	os.WriteFile(path, []byte("line1\n"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "static.txt"), []byte("static"), 0644)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, SkipInUse: true})
+	actions, srcFiles, _, err := fs.plan()
+	if err != nil || len(actions) != 2 {
+		t.Fatalf("计划不正确: %+v %v", actions, err)
+	}
+
+	// 扫描之后文件仍在被写入
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString("line2\n")
+	file.Close()
+
+	result := &RunResult{}
+	failed := fs.execute(actions, srcFiles, result)
+	if result.Deferred != 1 || result.Copied != 1 || !failed["growing.log"] {
+		t.Errorf("扫描后大小变化的文件应推迟: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "growing.log")); !os.IsNotExist(err) {
+		t.Error("推迟的文件不应被复制")
+	}
+}
+
+func TestStartRetriesDeferredFiles(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(sourceDir, "new.txt"), []byte("new"), 0644)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, SyncInterval: time.Hour, StabilityWindow: 300 * time.Millisecond})
+	go fs.Start()
+	defer fs.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(destDir, "new.txt")); !os.IsNotExist(err) {
+		t.Fatal("稳定窗口内的文件不应在初始同步中复制")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(filepath.Join(destDir, "new.txt")); err == nil {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("推迟的文件应在稳定窗口后重试同步，而不是等到下一个同步间隔")
+}
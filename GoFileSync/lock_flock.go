@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileLocked 其他进程是否以flock持有文件的排他锁（如正在写入的程序加了锁）。
+// 尝试加非阻塞的共享锁，成功后立即释放
+func fileLocked(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err != nil {
+		return err == syscall.EWOULDBLOCK
+	}
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return false
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSkipInUseDetectsLockedFiles(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	path := filepath.Join(sourceDir, "db.sqlite")
+	os.WriteFile(path, []byte("data"), 0644)
+	writer, err := os.OpenFile(path, os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if err := syscall.Flock(int(writer.Fd()), syscall.LOCK_EX); err != nil {
+		t.Skipf("不支持flock: %v", err)
+	}
+
+	var result *RunResult
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, SkipInUse: true})
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Deferred != 1 {
+		t.Errorf("被锁定的文件应推迟: %+v", result)
+	}
+
+	syscall.Flock(int(writer.Fd()), syscall.LOCK_UN)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Deferred != 0 || result.Copied != 1 {
+		t.Errorf("解锁后应同步: %+v", result)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+// fileLocked 没有flock的平台不检查文件锁，只依赖大小和修改时间的变化
+func fileLocked(path string) bool {
+	return false
+}
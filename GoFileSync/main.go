@@ -1,12 +1,15 @@
 package main
 
 import (
-	"crypto/md5"
+	"crypto/ed25519"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -16,6 +19,10 @@ type FileInfo struct {
 	Size    int64
 	ModTime time.Time
 	Hash    string
+	Mode    os.FileMode // 权限位和文件类型
+	Link    string      // SymlinksPreserve时符号链接的目标
+	UID     int         // 属主和属组，无法获取时为-1
+	GID     int
 }
 
 // SyncConfig 同步配置
@@ -25,23 +32,89 @@ type SyncConfig struct {
 	SyncInterval   time.Duration
 	DeleteExtra    bool
 	IncludeHidden  bool
+	WriteManifest  bool   // 同步后在目标目录写入SHA256SUMS和MANIFEST.json
+	ManifestKey    ed25519.PrivateKey // MANIFEST.json的ed25519签名私钥，为空则不签名
+	Watch          bool          // 监听源目录变更并增量同步，SyncInterval作为全量校验间隔
+	WatchDebounce  time.Duration // 合并文件事件的等待时间，为0时使用DefaultWatchDebounce
+	Workers        int   // 并发计算哈希和复制的文件数，<=1时逐个处理
+	BandwidthLimit int64 // 所有文件复制合计的速率上限（字节/秒），<=0表示不限
+	Include        []string // gitignore风格的包含规则，非空时只同步匹配的文件
+	Exclude        []string // gitignore风格的排除规则，如 "node_modules/"、"*.tmp"，"!"开头表示重新包含
+	Bidirectional  bool   // 双向同步，两侧的新增、修改和删除都会同步到另一侧
+	ConflictPolicy string // 两侧都修改了同一文件时的处理策略，为空时使用ConflictNewerWins
+	StateFile      string // 双向同步的状态文件，为空时使用目标目录下的StateFileName
+	Progress       ProgressReporter // 接收进度事件，为空时不报告
+	Target         StorageProvider // 远端同步目标，设置后代替DestDir，不支持双向同步和校验清单
+	ResumeThreshold int64          // 不小于该大小的文件复制中断后保留已复制的部分，下次从断点继续；为0时不续传
+	DeltaThreshold int64           // 目标文件已存在且不小于该大小的文件使用增量传输，只写入变化的块；为0时总是完整复制
+	DeltaBlockSize int             // 增量传输的块大小，默认DefaultDeltaBlockSize
+	Symlinks          string // 符号链接的处理方式：SymlinksFollow（默认）、SymlinksPreserve或SymlinksSkip
+	PreservePerms     bool   // 目标文件和目录使用与源相同的权限位
+	PreserveOwner     bool   // 保留属主和属组，需要root权限，仅Unix
+	PreserveEmptyDirs bool   // 在目标目录中创建源目录中的空目录并保留目录的修改时间，配合DeleteExtra删除多余的目录
+	HashCache      string          // 哈希缓存文件路径，大小和修改时间未变的文件不再重新计算哈希；为空时不缓存
+	ForceRehash    bool            // 忽略哈希缓存，重新计算所有文件的哈希（结果仍写入缓存）
+	HashAlgorithm  string          // 内容哈希算法：HashMD5（默认）、HashXXH64或HashSHA256
+	Encryption     *EncryptionConfig // 加密目标中的文件内容（和文件名），作用于Target，未设置Target时作用于DestDir
+	Compression    *CompressionConfig // 压缩写入Target（未设置时为DestDir）的文件内容，在加密之前压缩
+	Archive        string             // 以该路径的zip归档作为目标代替DestDir和Target，压缩级别和跳过列表取自Compression
+	StabilityWindow time.Duration     // 修改时间距今不足该时长的文件视为正在写入，推迟到之后的同步；为0时不检查
+	SkipInUse       bool              // 复制前重新检查文件，扫描后大小或修改时间变化、或被其他进程加锁的文件推迟同步
 }
 
 // FileSync 文件同步器
 type FileSync struct {
 	config   *SyncConfig
 	stopChan chan bool
+
+	syncMutex  *sync.Mutex         // 多次同步串行执行，同步同一目录的同步器可共用
+	pause      *pauseGate          // 暂停开关，与syncMutex一样可共用
+	running    atomic.Bool         // 是否有同步正在进行
+	onProgress func(ProgressEvent) // 同步进度回调
+	onResult   func(*RunResult)    // 每次同步结束时的回调
+	limiter    *rateLimiter        // BandwidthLimit>0时限制复制速率，所有工作协程共用
+	tracker    *progressTracker    // 当前同步的整体进度
+	emitMutex  sync.Mutex          // 工作协程依次发送进度事件
+
+	hashes     *hashCache  // 配置了HashCache时的哈希缓存
+	storage    StorageProvider // 实际的同步目标：Target，配置了Encryption或Compression时为包装后的Target或DestDir
+	archive    *archiveBuilder // 同步到归档时本次同步的变更
+	deferred   atomic.Int64    // 上次同步中因可能正在写入而推迟的文件数
+	rehash     atomic.Bool     // 校验期间忽略哈希缓存
+
+	filterOnce sync.Once
+	filter     *pathFilter // 由Include和Exclude编译，首次扫描时生成
+	filterErr  error
 }
 
 // NewFileSync 创建文件同步器
 func NewFileSync(config *SyncConfig) *FileSync {
-	return &FileSync{
-		config:   config,
-		stopChan: make(chan bool),
+	fs := &FileSync{
+		config:    config,
+		stopChan:  make(chan bool),
+		syncMutex: &sync.Mutex{},
+		pause:     newPauseGate(),
+	}
+	if config.BandwidthLimit > 0 {
+		fs.limiter = newRateLimiter(config.BandwidthLimit)
+	}
+	if config.HashCache != "" {
+		fs.hashes = loadHashCache(config.HashCache)
+	}
+	fs.storage = config.Target
+	if (config.Encryption != nil || config.Compression != nil) && fs.storage == nil {
+		fs.storage = &LocalProvider{Root: config.DestDir}
+	}
+	if config.Encryption != nil {
+		fs.storage = newEncryptedProvider(fs.storage, config.Encryption)
 	}
+	if config.Compression != nil {
+		fs.storage = newCompressedProvider(fs.storage, config.Compression)
+	}
+	return fs
 }
 
-// calculateHash 计算文件MD5哈希
+// calculateHash 按HashAlgorithm计算文件哈希
 func (fs *FileSync) calculateHash(filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -49,7 +122,7 @@ func (fs *FileSync) calculateHash(filePath string) (string, error) {
 	}
 	defer file.Close()
 
-	hash := md5.New()
+	hash := fs.newHash()
 	if _, err := io.Copy(hash, file); err != nil {
 		return "", err
 	}
@@ -59,15 +132,119 @@ func (fs *FileSync) calculateHash(filePath string) (string, error) {
 
 // scanDirectory 扫描目录获取文件信息
 func (fs *FileSync) scanDirectory(dir string) (map[string]*FileInfo, error) {
+	if err := fs.checkHashAlgorithm(); err != nil {
+		return nil, err
+	}
 	files := make(map[string]*FileInfo)
+	var pending []*FileInfo
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	err := fs.walkFiles(dir, dir, false, func(relPath string, info os.FileInfo) {
+		fileInfo, err := newFileInfo(filepath.Join(dir, relPath), relPath, info)
 		if err != nil {
+			log.Printf("读取符号链接失败 %s: %v", relPath, err)
+			return
+		}
+		pending = append(pending, fileInfo)
+	})
+	if err != nil {
+		return files, err
+	}
+
+	// 并发计算文件哈希
+	parallel(len(pending), fs.config.Workers, func(i int) {
+		path := filepath.Join(dir, pending[i].Path)
+		hash, err := fs.contentHash(path, pending[i])
+		if err != nil {
+			log.Printf("计算文件哈希失败 %s: %v", path, err)
+			return
+		}
+		pending[i].Hash = hash
+	})
+	for _, info := range pending {
+		if info.Hash != "" {
+			files[info.Path] = info
+		}
+	}
+
+	if fs.hashes != nil {
+		seen := make(map[string]bool, len(pending))
+		for _, info := range pending {
+			seen[cacheKey(filepath.Join(dir, info.Path))] = true
+		}
+		fs.hashes.prune(dir, seen)
+	}
+
+	return files, nil
+}
+
+// walkFiles 遍历dir中root（dir本身或其中的子路径）下需要同步的文件，对每个文件调用fn。
+// 跳过隐藏文件（如果配置了）、被包含/排除规则过滤的路径以及目标目录中的清单文件。
+// ignoreMissing为true时忽略遍历期间已被删除的路径
+func (fs *FileSync) walkFiles(dir, root string, ignoreMissing bool, fn func(relPath string, info os.FileInfo)) error {
+	return fs.walkTree(dir, root, ignoreMissing, nil, fn)
+}
+
+// walkTree 同walkFiles，dirFn不为nil时还对root下未被排除的目录（不含dir本身）调用dirFn。
+// 符号链接按symlinkMode处理：跟随时指向目录的链接像普通目录一样遍历，并跳过形成循环的链接
+func (fs *FileSync) walkTree(dir, root string, ignoreMissing bool, dirFn, fn func(relPath string, info os.FileInfo)) error {
+	filter, err := fs.pathFilter()
+	if err != nil {
+		return err
+	}
+	symlinks := fs.symlinkMode()
+	following := make(map[string]bool) // 正在遍历的链接目录的实际路径
+
+	var walkFn filepath.WalkFunc
+	walkFn = func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if ignoreMissing && os.IsNotExist(err) {
+				return nil
+			}
 			return err
 		}
 
-		// 跳过目录
+		// 获取相对路径
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			switch symlinks {
+			case SymlinksSkip:
+				return nil
+			case SymlinksFollow:
+				target, err := os.Stat(path)
+				if err != nil {
+					log.Printf("跳过无法解析的符号链接 %s: %v", path, err)
+					return nil
+				}
+				if target.IsDir() {
+					real, err := filepath.EvalSymlinks(path)
+					if err != nil || following[real] || isAncestorDir(real, filepath.Dir(path)) {
+						log.Printf("跳过形成循环的符号链接 %s", path)
+						return nil
+					}
+					following[real] = true
+					defer delete(following, real)
+					// 末尾的路径分隔符使Walk在链接指向的目录中遍历
+					return filepath.Walk(path+string(filepath.Separator), walkFn)
+				}
+				info = target
+			}
+		}
+
+		// 被排除的目录整个跳过
 		if info.IsDir() {
+			if relPath == "." {
+				return nil
+			}
+			if !filter.allowsDir(relPath) {
+				return filepath.SkipDir
+			}
+			if dirFn != nil {
+				dirFn(relPath, info)
+			}
 			return nil
 		}
 
@@ -76,64 +253,28 @@ func (fs *FileSync) scanDirectory(dir string) (map[string]*FileInfo, error) {
 			return nil
 		}
 
-		// 获取相对路径
-		relPath, err := filepath.Rel(dir, path)
-		if err != nil {
-			return err
+		// 跳过目标目录中的清单文件
+		if fs.config.WriteManifest && dir == fs.config.DestDir && isManifestFile(relPath) {
+			return nil
 		}
 
-		// 计算文件哈希
-		hash, err := fs.calculateHash(path)
-		if err != nil {
-			log.Printf("计算文件哈希失败 %s: %v", path, err)
+		// 跳过双向同步的状态文件和复制过程中的临时文件
+		if relPath == StateFileName || isTempFile(relPath) {
 			return nil
 		}
 
-		files[relPath] = &FileInfo{
-			Path:    relPath,
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			Hash:    hash,
+		if filter.allowsFile(relPath) {
+			fn(relPath, info)
 		}
-
 		return nil
-	})
-
-	return files, err
+	}
+	return filepath.Walk(root, walkFn)
 }
 
-// syncFile 同步单个文件
+// syncFile 同步单个文件，先写入临时文件再重命名，复制中断不会留下不完整的目标文件
 func (fs *FileSync) syncFile(srcPath, destPath string, fileInfo *FileInfo) error {
-	// 确保目标目录存在
-	destDir := filepath.Dir(destPath)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("创建目标目录失败 %s: %v", destDir, err)
-	}
-
-	// 复制文件
-	srcFile, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("打开源文件失败 %s: %v", srcPath, err)
-	}
-	defer srcFile.Close()
-
-	destFile, err := os.Create(destPath)
-	if err != nil {
-		return fmt.Errorf("创建目标文件失败 %s: %v", destPath, err)
-	}
-	defer destFile.Close()
-
-	if _, err := io.Copy(destFile, srcFile); err != nil {
-		return fmt.Errorf("复制文件失败 %s -> %s: %v", srcPath, destPath, err)
-	}
-
-	// 设置修改时间
-	if err := os.Chtimes(destPath, time.Now(), fileInfo.ModTime); err != nil {
-		log.Printf("设置文件时间失败 %s: %v", destPath, err)
-	}
-
-	fmt.Printf("已同步: %s\n", fileInfo.Path)
-	return nil
+	_, _, err := fs.transfer(srcPath, destPath, fileInfo, true)
+	return err
 }
 
 // deleteFile 删除文件
@@ -145,45 +286,163 @@ func (fs *FileSync) deleteFile(filePath string) error {
 	return nil
 }
 
-// Sync 执行一次同步
-func (fs *FileSync) Sync() error {
-	fmt.Println("开始同步...")
+// Plan 计算同步需要执行的操作但不修改任何文件
+func (fs *FileSync) Plan() ([]SyncAction, error) {
+	if fs.config.Archive != "" {
+		actions, _, reader, err := fs.planArchive()
+		if reader != nil {
+			reader.Close()
+		}
+		return actions, err
+	}
+	if fs.storage != nil {
+		actions, _, err := fs.planRemote()
+		return actions, err
+	}
+	if fs.config.Bidirectional {
+		plan, err := fs.planBidirectional()
+		if err != nil {
+			return nil, err
+		}
+		return plan.actions, nil
+	}
+	actions, _, _, err := fs.plan()
+	return actions, err
+}
 
+// plan 扫描源目录和目标目录并计算同步操作，复制在前、删除在后，各自按路径排序
+func (fs *FileSync) plan() ([]SyncAction, map[string]*FileInfo, map[string]*FileInfo, error) {
 	// 扫描源目录
 	srcFiles, err := fs.scanDirectory(fs.config.SourceDir)
 	if err != nil {
-		return fmt.Errorf("扫描源目录失败: %v", err)
+		return nil, nil, nil, fmt.Errorf("扫描源目录失败: %v", err)
 	}
 
 	// 扫描目标目录
 	destFiles, err := fs.scanDirectory(fs.config.DestDir)
 	if err != nil {
-		return fmt.Errorf("扫描目标目录失败: %v", err)
+		return nil, nil, nil, fmt.Errorf("扫描目标目录失败: %v", err)
 	}
 
-	// 同步文件
-	for relPath, srcInfo := range srcFiles {
-		destPath := filepath.Join(fs.config.DestDir, relPath)
-		srcPath := filepath.Join(fs.config.SourceDir, relPath)
+	var copies, deletes []SyncAction
 
-		// 检查目标文件是否存在或需要更新
+	// 检查目标文件是否存在或需要更新
+	for relPath, srcInfo := range srcFiles {
 		destInfo, exists := destFiles[relPath]
 		if !exists || srcInfo.Hash != destInfo.Hash {
-			if err := fs.syncFile(srcPath, destPath, srcInfo); err != nil {
-				log.Printf("同步文件失败 %s: %v", relPath, err)
-			}
+			copies = append(copies, SyncAction{Op: ActionCopy, Path: relPath, Size: srcInfo.Size})
+		} else if fs.metadataDiffers(srcInfo, destInfo) {
+			copies = append(copies, SyncAction{Op: ActionAttrs, Path: relPath})
 		}
 	}
 
-	// 删除多余的文件
+	// 目标目录中多余的文件
 	if fs.config.DeleteExtra {
-		for relPath := range destFiles {
+		for relPath, destInfo := range destFiles {
 			if _, exists := srcFiles[relPath]; !exists {
-				destPath := filepath.Join(fs.config.DestDir, relPath)
-				if err := fs.deleteFile(destPath); err != nil {
-					log.Printf("删除文件失败 %s: %v", relPath, err)
+				deletes = append(deletes, SyncAction{Op: ActionDelete, Path: relPath, Size: destInfo.Size})
+			}
+		}
+	}
+
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Path < copies[j].Path })
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path < deletes[j].Path })
+	actions := append(copies, deletes...)
+
+	// 目录结构和目录元数据
+	if fs.preservesDirs() {
+		srcDirs, destDirs := make(map[string]*FileInfo), make(map[string]*FileInfo)
+		if err := fs.scanDirs(fs.config.SourceDir, fs.config.SourceDir, srcDirs); err != nil {
+			return nil, nil, nil, fmt.Errorf("扫描源目录失败: %v", err)
+		}
+		if err := fs.scanDirs(fs.config.DestDir, fs.config.DestDir, destDirs); err != nil {
+			return nil, nil, nil, fmt.Errorf("扫描目标目录失败: %v", err)
+		}
+		actions = fs.planDirs(actions, srcDirs, destDirs)
+	}
+	return actions, srcFiles, destFiles, nil
+}
+
+// Sync 执行一次同步
+func (fs *FileSync) Sync() error {
+	_, err := fs.SyncWithResult()
+	return err
+}
+
+// SyncWithResult 执行一次同步并返回统计和每个文件的结果。
+// 返回错误时结果仍包含出错前已执行的操作，同步器已停止时结果为nil
+func (fs *FileSync) SyncWithResult() (*RunResult, error) {
+	fmt.Println("开始同步...")
+	if fs.config.WriteManifest && (fs.config.Archive != "" || fs.storage != nil) {
+		return fs.record(func(*RunResult) error { return errManifestTarget })
+	}
+	if fs.config.Archive != "" {
+		return fs.record(fs.runArchive)
+	}
+	if fs.storage != nil {
+		return fs.record(fs.runRemote)
+	}
+	if fs.config.Bidirectional {
+		return fs.record(fs.runBidirectional)
+	}
+	return fs.record(fs.run)
+}
+
+// record 暂停时先等待恢复，再持有同步锁执行run，统计结果并发送结束事件
+func (fs *FileSync) record(run func(*RunResult) error) (*RunResult, error) {
+	if !fs.waitResumed() {
+		return nil, fmt.Errorf("同步器已停止")
+	}
+	fs.syncMutex.Lock()
+	defer fs.syncMutex.Unlock()
+	fs.running.Store(true)
+	defer fs.running.Store(false)
+
+	fs.tracker = nil
+	result := &RunResult{StartedAt: time.Now()}
+	err := run(result)
+	if fs.hashes != nil {
+		if err := fs.hashes.save(); err != nil {
+			log.Printf("保存哈希缓存失败: %v", err)
+		}
+	}
+	result.FinishedAt = time.Now()
+	result.Duration = result.FinishedAt.Sub(result.StartedAt)
+	sort.SliceStable(result.Files, func(i, j int) bool { return result.Files[i].Path < result.Files[j].Path })
+	if err != nil {
+		result.Error = err.Error()
+	}
+	fs.deferred.Store(int64(result.Deferred))
+
+	done := result.Copied + result.Deleted + result.Updated + result.Failed
+	fs.emit(ProgressEvent{Type: EventDone, Done: done, Total: result.Planned, Error: result.Error})
+	if fs.onResult != nil {
+		fs.onResult(result)
+	}
+	return result, err
+}
+
+// run 按计划执行同步并把统计写入result
+func (fs *FileSync) run(result *RunResult) error {
+	actions, srcFiles, destFiles, err := fs.plan()
+	if err != nil {
+		return err
+	}
+	failed := fs.execute(actions, srcFiles, result)
+
+	// 写入校验清单：推迟或复制失败的文件只有目标中已有旧版本时才列入，清单始终描述目标目录的实际内容
+	if fs.config.WriteManifest {
+		present := make(map[string]*FileInfo, len(srcFiles))
+		for relPath, info := range srcFiles {
+			if failed[relPath] {
+				if _, err := os.Lstat(filepath.Join(fs.config.DestDir, relPath)); err != nil {
+					continue
 				}
 			}
+			present[relPath] = info
+		}
+		if err := fs.writeManifest(present); err != nil {
+			return fmt.Errorf("写入清单失败: %v", err)
 		}
 	}
 
@@ -191,8 +450,149 @@ func (fs *FileSync) Sync() error {
 	return nil
 }
 
+// execute 用Workers个协程并发执行同步操作，报告每个文件的进度并把统计写入result。
+// srcFiles为被复制文件的信息，返回执行失败的路径。目录操作不并发：创建目录最先执行，
+// 删除目录和更新目录元数据在文件操作之后按计划中的顺序（子目录在前）执行
+func (fs *FileSync) execute(actions []SyncAction, srcFiles map[string]*FileInfo, result *RunResult) map[string]bool {
+	failed := make(map[string]bool)
+	actions = fs.deferBusy(actions, srcFiles, result, failed)
+	result.Planned = len(actions)
+	fs.tracker = newProgressTracker(actions)
+	fs.emit(ProgressEvent{Type: EventStart, Total: len(actions)})
+
+	var mutex sync.Mutex
+	done := 0
+	do := func(action SyncAction) {
+		// 暂停中被停止时继续处理剩余的操作，与停止时等待进行中的同步完成一致
+		fs.waitResumed()
+		from, to := fs.config.SourceDir, fs.config.DestDir
+		if action.Direction == DirectionToSource {
+			from, to = to, from
+		}
+		destPath := filepath.Join(to, action.Path)
+		fs.emit(ProgressEvent{Type: EventFileStart, Op: action.Op, Path: action.Path, FileSize: action.Size})
+		started := time.Now()
+
+		var actionErr error
+		transferred := action.Size
+		switch {
+		case action.Op == ActionCopy && fs.archive != nil:
+			transferred, actionErr = fs.addToArchive(action.Path, srcFiles[action.Path])
+		case action.Op == ActionDelete && fs.archive != nil:
+			actionErr = fs.removeFromArchive(action.Path)
+		case action.Op == ActionCopy && fs.storage != nil:
+			actionErr = fs.upload(action.Path, srcFiles[action.Path])
+		case action.Op == ActionDelete && fs.storage != nil:
+			actionErr = fs.deleteRemote(action.Path)
+		case action.Op == ActionCopy:
+			srcPath := filepath.Join(from, action.Path)
+			var sum string
+			transferred, sum, actionErr = fs.copyFile(srcPath, destPath, srcFiles[action.Path])
+			if actionErr == nil {
+				fs.cacheCopied(destPath, sum)
+			}
+		case action.Op == ActionMkdir:
+			if err := os.MkdirAll(destPath, 0755); err != nil {
+				actionErr = fmt.Errorf("创建目录失败 %s: %v", destPath, err)
+			}
+		case action.Op == ActionAttrs && action.Dir:
+			actionErr = fs.applyDirMetadata(filepath.Join(from, action.Path), destPath, action.Path)
+		case action.Op == ActionAttrs:
+			actionErr = fs.applyMetadata(destPath, srcFiles[action.Path])
+		case action.Op == ActionDelete && action.Dir:
+			actionErr = fs.removeDir(destPath)
+		case action.Op == ActionDelete:
+			actionErr = fs.deleteFile(destPath)
+			if actionErr == nil && fs.hashes != nil {
+				fs.hashes.forget(destPath)
+			}
+		}
+
+		// 统计和进度在锁内更新，Done按完成顺序递增
+		mutex.Lock()
+		defer mutex.Unlock()
+		done++
+		fs.tracker.finish(action, done)
+		event := ProgressEvent{Type: EventFile, Op: action.Op, Path: action.Path, Done: done, Total: len(actions), FileSize: action.Size}
+		fileResult := FileResult{Path: action.Path, Op: action.Op, Direction: action.Direction, Status: FileDone, Size: action.Size, Duration: time.Since(started)}
+		if action.Op == ActionCopy {
+			event.FileBytes = action.Size
+		}
+		switch {
+		case actionErr == errDirNotEmpty:
+			log.Printf("目录中还有未同步的文件，保留 %s", action.Path)
+			fileResult.Status = FileKept
+		case actionErr != nil:
+			log.Printf("%s失败 %s: %v", action.Op, action.Path, actionErr)
+			result.Failed++
+			result.Errors = append(result.Errors, actionErr.Error())
+			event.Error = actionErr.Error()
+			failed[action.Path] = true
+			fileResult.Status, fileResult.Error = FileFailed, actionErr.Error()
+		case action.Op == ActionCopy:
+			result.Copied++
+			result.BytesCopied += action.Size
+			result.BytesTransferred += transferred
+			fileResult.Transferred = transferred
+		case action.Op == ActionDelete:
+			result.Deleted++
+		default:
+			result.Updated++
+		}
+		result.Files = append(result.Files, fileResult)
+		fs.emit(event)
+	}
+
+	var mkdirs, files, dirs []SyncAction
+	for _, action := range actions {
+		switch {
+		case action.Op == ActionMkdir:
+			mkdirs = append(mkdirs, action)
+		case action.Dir:
+			dirs = append(dirs, action)
+		default:
+			files = append(files, action)
+		}
+	}
+	for _, action := range mkdirs {
+		do(action)
+	}
+	parallel(len(files), fs.config.Workers, func(i int) { do(files[i]) })
+	for _, action := range dirs {
+		do(action)
+	}
+	sort.Strings(result.Errors)
+	return failed
+}
+
+// emit 填入整体进度后发送进度事件。ProgressReporter接收全部事件，
+// onProgress（API服务的SSE）不接收file-start和bytes事件
+func (fs *FileSync) emit(event ProgressEvent) {
+	if fs.onProgress == nil && fs.config.Progress == nil {
+		return
+	}
+	event.Time = time.Now()
+	if fs.tracker != nil {
+		fs.tracker.fill(&event)
+	}
+
+	fs.emitMutex.Lock()
+	defer fs.emitMutex.Unlock()
+	if fs.config.Progress != nil {
+		fs.config.Progress.Report(event)
+	}
+	if fs.onProgress != nil && event.Type != EventFileStart && event.Type != EventBytes {
+		fs.onProgress(event)
+	}
+}
+
 // Start 开始定期同步
 func (fs *FileSync) Start() {
+	if fs.config.Watch {
+		fs.watch()
+		return
+	}
+
 	fmt.Printf("文件同步器已启动，间隔: %v\n", fs.config.SyncInterval)
 
 	ticker := time.NewTicker(fs.config.SyncInterval)
@@ -202,13 +602,25 @@ func (fs *FileSync) Start() {
 	if err := fs.Sync(); err != nil {
 		log.Printf("初始同步失败: %v", err)
 	}
+	retry := fs.retryAfter()
 
 	for {
 		select {
 		case <-ticker.C:
+			// 暂停期间跳过定期同步
+			if fs.Paused() {
+				continue
+			}
 			if err := fs.Sync(); err != nil {
 				log.Printf("定期同步失败: %v", err)
 			}
+			retry = fs.retryAfter()
+		case <-retry:
+			// 重新同步上次因可能正在写入而推迟的文件
+			if err := fs.Sync(); err != nil {
+				log.Printf("重试同步失败: %v", err)
+			}
+			retry = fs.retryAfter()
 		case <-fs.stopChan:
 			fmt.Println("文件同步器已停止")
 			return
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobStatus 同步任务的状态和累计统计
+type JobStatus struct {
+	Name        string     `json:"name"`
+	SourceDir   string     `json:"source_dir"`
+	DestDir     string     `json:"dest_dir"`
+	Interval    string     `json:"interval"`
+	Watch       bool       `json:"watch,omitempty"`
+	AddedAt     time.Time  `json:"added_at"`
+	Runs        int        `json:"runs"`     // 已完成的同步次数
+	Failures    int        `json:"failures"` // 返回错误或有文件失败的同步次数
+	Copied      int        `json:"copied"`   // 以下为所有同步的累计值
+	Deleted     int        `json:"deleted"`
+	BytesCopied int64      `json:"bytes_copied"`
+	LastResult  *RunResult `json:"last_result,omitempty"`
+}
+
+// managedJob SyncManager中的一个任务
+type managedJob struct {
+	fs     *FileSync
+	done   chan struct{} // Start返回后关闭
+	status JobStatus
+}
+
+// SyncManager 在一个进程中并发运行多个同步任务，每个任务按各自的SyncInterval或监听模式同步，
+// 运行中可以增删任务
+type SyncManager struct {
+	mutex   sync.Mutex
+	jobs    map[string]*managedJob
+	stopped bool
+}
+
+// NewSyncManager 创建任务管理器
+func NewSyncManager() *SyncManager {
+	return &SyncManager{jobs: make(map[string]*managedJob)}
+}
+
+// Add 添加任务并立即开始同步
+func (m *SyncManager) Add(name string, config *SyncConfig) error {
+	if name == "" {
+		return fmt.Errorf("任务名不能为空")
+	}
+	if config.SyncInterval <= 0 && !config.Watch {
+		return fmt.Errorf("任务 %s 需要设置SyncInterval或Watch", name)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stopped {
+		return fmt.Errorf("任务管理器已停止")
+	}
+	if _, exists := m.jobs[name]; exists {
+		return fmt.Errorf("任务 %s 已存在", name)
+	}
+
+	job := &managedJob{
+		fs:   NewFileSync(config),
+		done: make(chan struct{}),
+		status: JobStatus{
+			Name:      name,
+			SourceDir: config.SourceDir,
+			DestDir:   config.DestDir,
+			Interval:  config.SyncInterval.String(),
+			Watch:     config.Watch,
+			AddedAt:   time.Now(),
+		},
+	}
+	job.fs.onResult = func(result *RunResult) {
+		result.Profile = name
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		job.status.Runs++
+		if result.Error != "" || result.Failed > 0 {
+			job.status.Failures++
+		}
+		job.status.Copied += result.Copied
+		job.status.Deleted += result.Deleted
+		job.status.BytesCopied += result.BytesCopied
+		job.status.LastResult = result
+	}
+	m.jobs[name] = job
+
+	go func() {
+		defer close(job.done)
+		job.fs.Start()
+	}()
+	return nil
+}
+
+// Remove 停止并移除任务，等待正在进行的同步结束后返回
+func (m *SyncManager) Remove(name string) error {
+	m.mutex.Lock()
+	job, exists := m.jobs[name]
+	if !exists {
+		m.mutex.Unlock()
+		return fmt.Errorf("任务 %s 不存在", name)
+	}
+	delete(m.jobs, name)
+	m.mutex.Unlock()
+
+	job.fs.Stop()
+	<-job.done
+	return nil
+}
+
+// Status 返回单个任务的状态
+func (m *SyncManager) Status(name string) (JobStatus, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	job, exists := m.jobs[name]
+	if !exists {
+		return JobStatus{}, false
+	}
+	return job.status, true
+}
+
+// Jobs 返回所有任务的状态，按名称排序
+func (m *SyncManager) Jobs() []JobStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	statuses := make([]JobStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		statuses = append(statuses, job.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Stop 停止所有任务，等待正在进行的同步全部结束后返回。之后不能再添加任务
+func (m *SyncManager) Stop() {
+	m.mutex.Lock()
+	m.stopped = true
+	jobs := m.jobs
+	m.jobs = make(map[string]*managedJob)
+	m.mutex.Unlock()
+
+	for _, job := range jobs {
+		job.fs.Stop()
+	}
+	for _, job := range jobs {
+		<-job.done
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitForRuns 等待任务完成至少runs次同步
+func waitForRuns(t *testing.T, manager *SyncManager, name string, runs int) JobStatus {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if status, ok := manager.Status(name); ok && status.Runs >= runs {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("等待任务 %s 完成%d次同步超时", name, runs)
+	return JobStatus{}
+}
+
+func TestSyncManagerRunsJobsIndependently(t *testing.T) {
+	sourceA, destA, cleanupA := setupTestDirs(t)
+	defer cleanupA()
+	sourceB, destB, cleanupB := setupTestDirs(t)
+	defer cleanupB()
+	os.WriteFile(filepath.Join(sourceA, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(sourceB, "b.txt"), []byte("bb"), 0644)
+
+	manager := NewSyncManager()
+	defer manager.Stop()
+	if err := manager.Add("fast", &SyncConfig{SourceDir: sourceA, DestDir: destA, SyncInterval: 20 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Add("slow", &SyncConfig{SourceDir: sourceB, DestDir: destB, SyncInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	fast := waitForRuns(t, manager, "fast", 3)
+	slow := waitForRuns(t, manager, "slow", 1)
+	if fast.Copied != 1 || fast.BytesCopied != 1 || fast.LastResult == nil || fast.LastResult.Profile != "fast" {
+		t.Errorf("fast任务的统计不正确: %+v", fast)
+	}
+	if slow.Runs != 1 || slow.Copied != 1 || slow.BytesCopied != 2 {
+		t.Errorf("slow任务只应在启动时同步一次: %+v", slow)
+	}
+	if _, err := os.Stat(filepath.Join(destA, "a.txt")); err != nil {
+		t.Error("fast任务的文件未同步")
+	}
+	if _, err := os.Stat(filepath.Join(destB, "b.txt")); err != nil {
+		t.Error("slow任务的文件未同步")
+	}
+	if jobs := manager.Jobs(); len(jobs) != 2 || jobs[0].Name != "fast" || jobs[1].Name != "slow" {
+		t.Errorf("任务列表不正确: %+v", jobs)
+	}
+}
+
+func TestSyncManagerAddRemove(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+
+	manager := NewSyncManager()
+	defer manager.Stop()
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, SyncInterval: 20 * time.Millisecond}
+	if err := manager.Add("docs", config); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Add("docs", config); err == nil {
+		t.Error("重复的任务名应返回错误")
+	}
+	if err := manager.Add("bad", &SyncConfig{SourceDir: sourceDir, DestDir: destDir}); err == nil {
+		t.Error("没有同步间隔的任务应返回错误")
+	}
+	waitForRuns(t, manager, "docs", 1)
+
+	if err := manager.Remove("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manager.Status("docs"); ok {
+		t.Error("移除的任务不应再出现")
+	}
+	if err := manager.Remove("docs"); err == nil {
+		t.Error("移除不存在的任务应返回错误")
+	}
+
+	// 移除后不再同步
+	os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte("b"), 0644)
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(destDir, "b.txt")); !os.IsNotExist(err) {
+		t.Error("移除的任务不应继续同步")
+	}
+
+	// 同名任务可以重新添加
+	if err := manager.Add("docs", config); err != nil {
+		t.Fatal(err)
+	}
+	if status := waitForRuns(t, manager, "docs", 1); status.Copied != 1 {
+		t.Errorf("重新添加的任务统计应从零开始: %+v", status)
+	}
+}
+
+func TestSyncManagerStopDrainsJobs(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	data := make([]byte, 200*1024)
+	os.WriteFile(filepath.Join(sourceDir, "big.bin"), data, 0644)
+
+	manager := NewSyncManager()
+	// 限速使同步持续约0.4秒
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, SyncInterval: time.Hour, BandwidthLimit: 500 * 1024}
+	if err := manager.Add("slow", config); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	manager.Stop()
+	info, err := os.Stat(filepath.Join(destDir, "big.bin"))
+	if err != nil || info.Size() != int64(len(data)) {
+		t.Errorf("Stop应等待进行中的同步完成: %v", err)
+	}
+	if jobs := manager.Jobs(); len(jobs) != 0 {
+		t.Errorf("停止后不应再有任务: %+v", jobs)
+	}
+	if err := manager.Add("late", config); err == nil {
+		t.Error("停止后添加任务应返回错误")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ManifestSumsFile sha256sum兼容的清单文件名，可直接用 `sha256sum -c SHA256SUMS` 校验
+	ManifestSumsFile = "SHA256SUMS"
+	// ManifestJSONFile 带签名的JSON清单文件名
+	ManifestJSONFile = "MANIFEST.json"
+)
+
+// errManifestTarget 清单在同步后从目标目录读取文件计算哈希，只能用于本地目标目录
+var errManifestTarget = errors.New("校验清单只支持本地目标目录，不能与远端存储、归档、加密或压缩同时使用")
+
+// ManifestEntry 清单中的单个文件记录
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest 同步完成后写入目标目录的清单
+type Manifest struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Algorithm   string          `json:"algorithm"`
+	Files       []ManifestEntry `json:"files"`
+	Signature   string          `json:"signature,omitempty"`
+}
+
+// isManifestFile 判断相对路径是否为目标目录根下的清单文件
+func isManifestFile(relPath string) bool {
+	return relPath == ManifestSumsFile || relPath == ManifestJSONFile
+}
+
+// sha256File 计算文件SHA-256哈希
+func sha256File(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// manifestPayload 清单内容（不含签名字段）的规范化JSON，作为签名的输入
+func manifestPayload(m *Manifest) ([]byte, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	return json.Marshal(unsigned)
+}
+
+// signManifest 使用ed25519私钥对清单内容签名，持有公钥的第三方即可验证而无法伪造
+func signManifest(m *Manifest, key ed25519.PrivateKey) (string, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("清单签名私钥长度无效: %d，应为%d字节", len(key), ed25519.PrivateKeySize)
+	}
+	payload, err := manifestPayload(m)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(ed25519.Sign(key, payload)), nil
+}
+
+// verifyManifestSignature 使用ed25519公钥校验清单签名
+func verifyManifestSignature(m *Manifest, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("清单签名公钥长度无效: %d，应为%d字节", len(key), ed25519.PublicKeySize)
+	}
+	if m.Signature == "" {
+		return fmt.Errorf("清单未签名")
+	}
+	signature, err := hex.DecodeString(m.Signature)
+	if err != nil {
+		return fmt.Errorf("清单签名格式无效: %v", err)
+	}
+	payload, err := manifestPayload(m)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return fmt.Errorf("清单签名不匹配")
+	}
+	return nil
+}
+
+// buildManifest 根据目标目录中的实际文件生成清单
+func (fs *FileSync) buildManifest(files map[string]*FileInfo) (*Manifest, error) {
+	paths := make([]string, 0, len(files))
+	for relPath, info := range files {
+		// 保留的符号链接没有内容
+		if info.Link == "" {
+			paths = append(paths, relPath)
+		}
+	}
+	sort.Strings(paths)
+
+	manifest := &Manifest{
+		GeneratedAt: time.Now().UTC(),
+		Algorithm:   "sha256",
+		Files:       make([]ManifestEntry, 0, len(paths)),
+	}
+
+	for _, relPath := range paths {
+		destPath := filepath.Join(fs.config.DestDir, relPath)
+		info, err := os.Stat(destPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取目标文件失败 %s: %v", destPath, err)
+		}
+
+		sum, err := sha256File(destPath)
+		if err != nil {
+			return nil, fmt.Errorf("计算SHA-256失败 %s: %v", destPath, err)
+		}
+
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Path:   filepath.ToSlash(relPath),
+			Size:   info.Size(),
+			SHA256: sum,
+		})
+	}
+
+	if len(fs.config.ManifestKey) > 0 {
+		signature, err := signManifest(manifest, fs.config.ManifestKey)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Signature = signature
+	}
+
+	return manifest, nil
+}
+
+// writeManifest 在目标目录写入SHA256SUMS和MANIFEST.json
+func (fs *FileSync) writeManifest(files map[string]*FileInfo) error {
+	manifest, err := fs.buildManifest(files)
+	if err != nil {
+		return err
+	}
+
+	// sha256sum格式：<哈希><两个空格><路径>
+	var sums strings.Builder
+	for _, entry := range manifest.Files {
+		fmt.Fprintf(&sums, "%s  %s\n", entry.SHA256, entry.Path)
+	}
+
+	sumsPath := filepath.Join(fs.config.DestDir, ManifestSumsFile)
+	if err := os.WriteFile(sumsPath, []byte(sums.String()), 0644); err != nil {
+		return fmt.Errorf("写入清单失败 %s: %v", sumsPath, err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	jsonPath := filepath.Join(fs.config.DestDir, ManifestJSONFile)
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return fmt.Errorf("写入清单失败 %s: %v", jsonPath, err)
+	}
+
+	return nil
+}
+
+// VerifyManifest 校验目录中的MANIFEST.json签名及每个文件的大小和哈希，
+// publicKey为空时只校验文件内容
+func VerifyManifest(dir string, publicKey ed25519.PublicKey) error {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestJSONFile))
+	if err != nil {
+		return fmt.Errorf("读取清单失败: %v", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("解析清单失败: %v", err)
+	}
+
+	if len(publicKey) > 0 {
+		if err := verifyManifestSignature(&manifest, publicKey); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range manifest.Files {
+		// 未签名或被篡改的清单不能借路径读取目录以外的文件
+		if !filepath.IsLocal(filepath.FromSlash(entry.Path)) {
+			return fmt.Errorf("清单中的路径无效 %s", entry.Path)
+		}
+		filePath := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return fmt.Errorf("文件缺失 %s: %v", entry.Path, err)
+		}
+		if info.Size() != entry.Size {
+			return fmt.Errorf("文件大小不匹配 %s", entry.Path)
+		}
+
+		sum, err := sha256File(filePath)
+		if err != nil {
+			return fmt.Errorf("计算SHA-256失败 %s: %v", entry.Path, err)
+		}
+		if sum != entry.SHA256 {
+			return fmt.Errorf("文件哈希不匹配 %s", entry.Path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testManifestKey 测试用的固定ed25519私钥
+func testManifestKey() ed25519.PrivateKey {
+	seed := make([]byte, ed25519.SeedSize)
+	copy(seed, "filesync-manifest-test-seed")
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+func TestWriteManifest(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("aaa"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "b.txt"), []byte("bbb"), 0644)
+
+	config := &SyncConfig{
+		SourceDir:     sourceDir,
+		DestDir:       destDir,
+		DeleteExtra:   true,
+		WriteManifest: true,
+		ManifestKey:   testManifestKey(),
+	}
+
+	sync := NewFileSync(config)
+	if err := sync.Sync(); err != nil {
+		t.Fatal("同步失败:", err)
+	}
+
+	// 检查sha256sum格式
+	data, err := os.ReadFile(filepath.Join(destDir, ManifestSumsFile))
+	if err != nil {
+		t.Fatal("读取SHA256SUMS失败:", err)
+	}
+	sum := sha256.Sum256([]byte("aaa"))
+	expected := hex.EncodeToString(sum[:]) + "  a.txt\n"
+	if !strings.HasPrefix(string(data), expected) {
+		t.Errorf("SHA256SUMS格式不正确，实际'%s'", string(data))
+	}
+	if !strings.Contains(string(data), "  sub/b.txt\n") {
+		t.Error("SHA256SUMS缺少子目录文件")
+	}
+
+	if err := VerifyManifest(destDir, testManifestKey().Public().(ed25519.PublicKey)); err != nil {
+		t.Errorf("清单校验失败: %v", err)
+	}
+
+	// 再次同步时清单文件不应被当作多余文件删除
+	if err := sync.Sync(); err != nil {
+		t.Fatal("同步失败:", err)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, ManifestJSONFile)); err != nil {
+		t.Error("清单文件被删除")
+	}
+}
+
+func TestVerifyManifestDetectsTampering(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("aaa"), 0644)
+
+	config := &SyncConfig{
+		SourceDir:     sourceDir,
+		DestDir:       destDir,
+		WriteManifest: true,
+		ManifestKey:   testManifestKey(),
+	}
+
+	sync := NewFileSync(config)
+	if err := sync.Sync(); err != nil {
+		t.Fatal("同步失败:", err)
+	}
+
+	otherKey := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	if err := VerifyManifest(destDir, otherKey.Public().(ed25519.PublicKey)); err == nil {
+		t.Error("错误的公钥应校验失败")
+	}
+
+	os.WriteFile(filepath.Join(destDir, "a.txt"), []byte("aab"), 0644)
+	if err := VerifyManifest(destDir, testManifestKey().Public().(ed25519.PublicKey)); err == nil {
+		t.Error("文件被篡改后应校验失败")
+	}
+}
+
+func TestManifestSkipsDeferredFiles(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	old := time.Now().Add(-time.Hour)
+	os.WriteFile(filepath.Join(sourceDir, "done.txt"), []byte("done"), 0644)
+	os.Chtimes(filepath.Join(sourceDir, "done.txt"), old, old)
+	os.WriteFile(filepath.Join(sourceDir, "uploading.bin"), []byte("half"), 0644)
+
+	config := &SyncConfig{
+		SourceDir:       sourceDir,
+		DestDir:         destDir,
+		WriteManifest:   true,
+		StabilityWindow: time.Minute,
+	}
+
+	sync := NewFileSync(config)
+	if err := sync.Sync(); err != nil {
+		t.Fatal("推迟的文件不应导致写入清单失败:", err)
+	}
+	data, err := os.ReadFile(filepath.Join(destDir, ManifestSumsFile))
+	if err != nil {
+		t.Fatal("读取SHA256SUMS失败:", err)
+	}
+	if !strings.Contains(string(data), "  done.txt\n") || strings.Contains(string(data), "uploading.bin") {
+		t.Errorf("清单应只包含已同步的文件，实际'%s'", string(data))
+	}
+	if err := VerifyManifest(destDir, nil); err != nil {
+		t.Errorf("清单校验失败: %v", err)
+	}
+}
+
+func TestVerifyManifestRejectsEscapingPaths(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(filepath.Dir(dir), "outside.txt")
+	os.WriteFile(outside, []byte("secret"), 0644)
+	defer os.Remove(outside)
+
+	sum, _ := sha256File(outside)
+	for _, path := range []string{"../outside.txt", filepath.ToSlash(outside), ""} {
+		manifest := Manifest{Algorithm: "sha256", Files: []ManifestEntry{{Path: path, Size: 6, SHA256: sum}}}
+		data, _ := json.Marshal(manifest)
+		os.WriteFile(filepath.Join(dir, ManifestJSONFile), data, 0644)
+		if err := VerifyManifest(dir, nil); err == nil {
+			t.Errorf("应拒绝目录以外的路径 %q", path)
+		}
+	}
+}
+
+func TestManifestRequiresLocalTarget(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("aaa"), 0644)
+
+	configs := map[string]*SyncConfig{
+		"远端": {SourceDir: sourceDir, DestDir: destDir, WriteManifest: true, Target: &LocalProvider{Root: destDir}},
+		"归档": {SourceDir: sourceDir, DestDir: destDir, WriteManifest: true, Archive: filepath.Join(destDir, "backup.zip")},
+		"加密": {SourceDir: sourceDir, DestDir: destDir, WriteManifest: true, Encryption: &EncryptionConfig{Passphrase: "pw"}},
+	}
+	for name, config := range configs {
+		if err := NewFileSync(config).Sync(); err == nil {
+			t.Errorf("%s目标启用校验清单应返回错误", name)
+		}
+	}
+	if entries, _ := os.ReadDir(destDir); len(entries) != 0 {
+		t.Errorf("拒绝同步时不应写入目标目录，实际%d个文件", len(entries))
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 符号链接的处理方式
+const (
+	SymlinksFollow   = "follow"   // 同步链接指向的内容，指向目录的链接像普通目录一样遍历
+	SymlinksPreserve = "preserve" // 在目标目录中重建相同目标的链接，不读取指向的内容
+	SymlinksSkip     = "skip"     // 忽略符号链接
+)
+
+// linkHashPrefix 保留的符号链接以目标路径代替内容哈希比较
+const linkHashPrefix = "symlink:"
+
+// errDirNotEmpty 删除多余目录时目录中还有未同步的文件（如被排除的文件）
+var errDirNotEmpty = errors.New("目录不为空")
+
+// mirrorsMetadata 只有单向同步到本地目录时保留符号链接、权限和目录结构；
+// 双向同步、远端目标和归档只同步文件内容
+func (fs *FileSync) mirrorsMetadata() bool {
+	return !fs.config.Bidirectional && fs.storage == nil && fs.config.Archive == ""
+}
+
+// symlinkMode 生效的符号链接处理方式
+func (fs *FileSync) symlinkMode() string {
+	switch {
+	case fs.config.Symlinks == SymlinksSkip:
+		return SymlinksSkip
+	case fs.config.Symlinks == SymlinksPreserve && fs.mirrorsMetadata():
+		return SymlinksPreserve
+	default:
+		return SymlinksFollow
+	}
+}
+
+// preservesDirs 是否需要比较和同步目录
+func (fs *FileSync) preservesDirs() bool {
+	return fs.mirrorsMetadata() && (fs.config.PreserveEmptyDirs || fs.config.PreservePerms || fs.config.PreserveOwner)
+}
+
+// newFileInfo 由遍历得到的元数据生成FileInfo，保留的符号链接记录其目标
+func newFileInfo(path, relPath string, info os.FileInfo) (*FileInfo, error) {
+	fileInfo := &FileInfo{
+		Path:    relPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Mode:    info.Mode(),
+		UID:     -1,
+		GID:     -1,
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		fileInfo.UID, fileInfo.GID = uid, gid
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		fileInfo.Link = target
+	}
+	return fileInfo, nil
+}
+
+// contentHash 文件内容的哈希，保留的符号链接使用其目标路径
+func (fs *FileSync) contentHash(path string, info *FileInfo) (string, error) {
+	if info.Link != "" {
+		return linkHashPrefix + info.Link, nil
+	}
+	return fs.hashFile(path, info.Size, info.ModTime)
+}
+
+// isAncestorDir target是否为parent（解析链接后）本身或其上级目录，链接指向这样的目录会形成循环
+func isAncestorDir(target, parent string) bool {
+	realParent, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return true
+	}
+	sep := string(filepath.Separator)
+	return target == realParent || strings.HasPrefix(realParent+sep, strings.TrimSuffix(target, sep)+sep)
+}
+
+// permBits chmod可以设置的权限位
+func permBits(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
+
+// metadataDiffers 内容相同的文件或目录是否需要更新权限、属主（目录还包括修改时间）
+func (fs *FileSync) metadataDiffers(src, dest *FileInfo) bool {
+	if !fs.mirrorsMetadata() {
+		return false
+	}
+	isLink := src.Mode&os.ModeSymlink != 0
+	if fs.config.PreservePerms && !isLink && permBits(src.Mode) != permBits(dest.Mode) {
+		return true
+	}
+	if fs.config.PreserveOwner && canChown() && src.UID >= 0 && (src.UID != dest.UID || src.GID != dest.GID) {
+		return true
+	}
+	return src.Mode.IsDir() && !src.ModTime.Equal(dest.ModTime)
+}
+
+// applyMetadata 按配置把源文件的权限和属主应用到目标路径，目录还设置修改时间。
+// 没有权限修改属主时忽略
+func (fs *FileSync) applyMetadata(destPath string, info *FileInfo) error {
+	if !fs.mirrorsMetadata() {
+		return nil
+	}
+	isLink := info.Mode&os.ModeSymlink != 0
+	if fs.config.PreservePerms && !isLink {
+		if err := os.Chmod(destPath, permBits(info.Mode)); err != nil {
+			return fmt.Errorf("设置权限失败 %s: %v", destPath, err)
+		}
+	}
+	if fs.config.PreserveOwner && info.UID >= 0 {
+		if err := os.Lchown(destPath, info.UID, info.GID); err != nil && !os.IsPermission(err) {
+			return fmt.Errorf("设置属主失败 %s: %v", destPath, err)
+		}
+	}
+	if info.Mode.IsDir() {
+		if err := os.Chtimes(destPath, time.Now(), info.ModTime); err != nil {
+			return fmt.Errorf("设置目录时间失败 %s: %v", destPath, err)
+		}
+	}
+	return nil
+}
+
+// copySymlink 在目标路径重建符号链接，先创建临时链接再重命名替换原有文件
+func (fs *FileSync) copySymlink(destPath string, info *FileInfo) error {
+	destDir := filepath.Dir(destPath)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("创建目标目录失败 %s: %v", destDir, err)
+	}
+	tmp := partPath(destPath, "symlink")
+	os.Remove(tmp)
+	if err := os.Symlink(info.Link, tmp); err != nil {
+		return fmt.Errorf("创建符号链接失败 %s: %v", destPath, err)
+	}
+	if err := os.Rename(tmp, destPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("替换目标文件失败 %s: %v", destPath, err)
+	}
+	if err := fs.applyMetadata(destPath, info); err != nil {
+		return err
+	}
+	fmt.Printf("已同步: %s -> %s\n", info.Path, info.Link)
+	return nil
+}
+
+// removeDir 删除目标目录中多余的空目录，目录中还有其他文件时保留
+func (fs *FileSync) removeDir(dirPath string) error {
+	entries, err := os.ReadDir(dirPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("删除目录失败 %s: %v", dirPath, err)
+	}
+	if len(entries) > 0 {
+		return errDirNotEmpty
+	}
+	if err := os.Remove(dirPath); err != nil {
+		return fmt.Errorf("删除目录失败 %s: %v", dirPath, err)
+	}
+	fmt.Printf("已删除目录: %s\n", filepath.Base(dirPath))
+	return nil
+}
+
+// applyDirMetadata 目录的元数据，使用执行时源目录的状态
+func (fs *FileSync) applyDirMetadata(srcPath, destPath, relPath string) error {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	// 没有保留空目录时，其中的文件复制失败后目录可能不存在
+	if _, err := os.Stat(destPath); os.IsNotExist(err) {
+		return nil
+	}
+	fileInfo, err := newFileInfo(srcPath, relPath, info)
+	if err != nil {
+		return err
+	}
+	return fs.applyMetadata(destPath, fileInfo)
+}
+
+// scanDirs 收集dir中root下的目录元数据
+func (fs *FileSync) scanDirs(dir, root string, dirs map[string]*FileInfo) error {
+	return fs.walkTree(dir, root, true, func(relPath string, info os.FileInfo) {
+		if fileInfo, err := newFileInfo(filepath.Join(dir, relPath), relPath, info); err == nil {
+			dirs[relPath] = fileInfo
+		}
+	}, func(string, os.FileInfo) {})
+}
+
+// planDirs 在文件操作的基础上加入目录操作：先创建缺少的目录，最后删除多余的目录并更新目录元数据。
+// 本次会在其中新增或删除文件的目录修改时间会变化，同样需要更新元数据
+func (fs *FileSync) planDirs(actions []SyncAction, srcDirs, destDirs map[string]*FileInfo) []SyncAction {
+	var mkdirs, rmdirs []SyncAction
+	attrs := make(map[string]bool)
+	for relPath, srcInfo := range srcDirs {
+		destInfo, exists := destDirs[relPath]
+		switch {
+		case !exists && fs.config.PreserveEmptyDirs:
+			mkdirs = append(mkdirs, SyncAction{Op: ActionMkdir, Path: relPath, Dir: true})
+			attrs[relPath] = true
+		case exists && fs.metadataDiffers(srcInfo, destInfo):
+			attrs[relPath] = true
+		}
+	}
+	if fs.config.DeleteExtra && fs.config.PreserveEmptyDirs {
+		for relPath := range destDirs {
+			if _, exists := srcDirs[relPath]; !exists {
+				rmdirs = append(rmdirs, SyncAction{Op: ActionDelete, Path: relPath, Dir: true})
+			}
+		}
+	}
+
+	changed := append(append([]SyncAction(nil), actions...), rmdirs...)
+	for _, action := range append(changed, mkdirs...) {
+		if action.Op == ActionAttrs && !action.Dir {
+			continue
+		}
+		for parent := filepath.Dir(action.Path); parent != "."; parent = filepath.Dir(parent) {
+			if _, exists := srcDirs[parent]; exists {
+				attrs[parent] = true
+			}
+		}
+	}
+
+	var dirAttrs []SyncAction
+	for relPath := range attrs {
+		dirAttrs = append(dirAttrs, SyncAction{Op: ActionAttrs, Path: relPath, Dir: true})
+	}
+	sort.Slice(mkdirs, func(i, j int) bool { return mkdirs[i].Path < mkdirs[j].Path })
+	// 子目录在上级目录之前删除和更新
+	sort.Slice(rmdirs, func(i, j int) bool { return rmdirs[i].Path > rmdirs[j].Path })
+	sort.Slice(dirAttrs, func(i, j int) bool { return dirAttrs[i].Path > dirAttrs[j].Path })
+
+	result := append(mkdirs, actions...)
+	result = append(result, rmdirs...)
+	return append(result, dirAttrs...)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreservePermissionsAndDirectories(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.MkdirAll(filepath.Join(sourceDir, "private"), 0755)
+	os.MkdirAll(filepath.Join(sourceDir, "empty", "nested"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "private", "key.txt"), []byte("secret"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "run.sh"), []byte("#!/bin/sh"), 0644)
+	os.Chmod(filepath.Join(sourceDir, "private", "key.txt"), 0600)
+	os.Chmod(filepath.Join(sourceDir, "run.sh"), 0755)
+	os.Chmod(filepath.Join(sourceDir, "private"), 0700)
+	for _, dir := range []string{"private", "empty", "empty/nested"} {
+		os.Chtimes(filepath.Join(sourceDir, dir), old, old)
+	}
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true, PreservePerms: true, PreserveEmptyDirs: true})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]os.FileMode{"private/key.txt": 0600, "run.sh": 0755, "private": 0700 | os.ModeDir} {
+		info, err := os.Stat(filepath.Join(destDir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != want {
+			t.Errorf("%s的权限为%v，期望%v", path, info.Mode(), want)
+		}
+	}
+	for _, dir := range []string{"private", "empty", "empty/nested"} {
+		info, err := os.Stat(filepath.Join(destDir, dir))
+		if err != nil {
+			t.Fatalf("目录%s应被创建: %v", dir, err)
+		}
+		if !info.ModTime().Equal(old) {
+			t.Errorf("目录%s的修改时间为%v，期望%v", dir, info.ModTime(), old)
+		}
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	// 只修改权限时不复制内容
+	os.Chmod(filepath.Join(sourceDir, "run.sh"), 0700)
+	actions, _ := fs.Plan()
+	if len(actions) != 1 || actions[0].Op != ActionAttrs || actions[0].Path != "run.sh" {
+		t.Errorf("只修改权限时应只更新元数据: %+v", actions)
+	}
+
+	// 删除源目录中的空目录后目标目录中也删除，子目录先于上级目录删除
+	os.RemoveAll(filepath.Join(sourceDir, "empty"))
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 2 || result.Updated != 1 || result.Failed != 0 {
+		t.Errorf("同步结果不正确: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "empty")); !os.IsNotExist(err) {
+		t.Error("多余的空目录应被删除")
+	}
+	if info, _ := os.Stat(filepath.Join(destDir, "run.sh")); info.Mode().Perm() != 0700 {
+		t.Errorf("权限应更新为0700，实际为%v", info.Mode())
+	}
+}
+
+func TestSymlinkModes(t *testing.T) {
+	sourceDir, _, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "real.txt"), []byte("real"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "inner.txt"), []byte("inner"), 0644)
+	os.Symlink("real.txt", filepath.Join(sourceDir, "link.txt"))
+	os.Symlink("sub", filepath.Join(sourceDir, "dirlink"))
+	os.Symlink("..", filepath.Join(sourceDir, "sub", "loop"))
+	os.Symlink("missing.txt", filepath.Join(sourceDir, "dangling"))
+
+	sync := func(mode string) string {
+		destDir := t.TempDir()
+		fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Symlinks: mode})
+		if err := fs.Sync(); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if actions, _ := fs.Plan(); len(actions) != 0 {
+			t.Errorf("%s: 同步后不应再有操作: %+v", mode, actions)
+		}
+		return destDir
+	}
+
+	// 跟随：链接被替换为指向的内容，指向上级目录的循环链接被跳过
+	dest := sync(SymlinksFollow)
+	if got := readFile(t, filepath.Join(dest, "link.txt")); got != "real" {
+		t.Errorf("跟随链接时应复制指向的内容，实际为%q", got)
+	}
+	if got := readFile(t, filepath.Join(dest, "dirlink", "inner.txt")); got != "inner" {
+		t.Errorf("应遍历指向目录的链接，实际为%q", got)
+	}
+	for _, path := range []string{"sub/loop", "dangling"} {
+		if _, err := os.Lstat(filepath.Join(dest, path)); !os.IsNotExist(err) {
+			t.Errorf("%s应被跳过", path)
+		}
+	}
+
+	// 保留：重建相同目标的链接
+	dest = sync(SymlinksPreserve)
+	for path, want := range map[string]string{"link.txt": "real.txt", "dirlink": "sub", "sub/loop": "..", "dangling": "missing.txt"} {
+		target, err := os.Readlink(filepath.Join(dest, path))
+		if err != nil || target != want {
+			t.Errorf("%s应为指向%s的链接，实际为%q, %v", path, want, target, err)
+		}
+	}
+
+	// 忽略
+	dest = sync(SymlinksSkip)
+	for _, path := range []string{"link.txt", "dirlink", "sub/loop", "dangling"} {
+		if _, err := os.Lstat(filepath.Join(dest, path)); !os.IsNotExist(err) {
+			t.Errorf("%s应被忽略", path)
+		}
+	}
+	if got := readFile(t, filepath.Join(dest, "sub", "inner.txt")); got != "inner" {
+		t.Errorf("普通文件应照常同步，实际为%q", got)
+	}
+}
+
+func TestPreserveOwner(t *testing.T) {
+	if !canChown() {
+		t.Skip("需要root权限")
+	}
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	path := filepath.Join(sourceDir, "owned.txt")
+	os.WriteFile(path, []byte("data"), 0644)
+	os.Chown(path, 1234, 5678)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, PreserveOwner: true})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(filepath.Join(destDir, "owned.txt"))
+	if uid, gid, _ := fileOwner(info); uid != 1234 || gid != 5678 {
+		t.Errorf("属主应为1234:5678，实际为%d:%d", uid, gid)
+	}
+
+	// 只修改属主时更新元数据
+	os.Chown(path, 4321, 5678)
+	actions, _ := fs.Plan()
+	if len(actions) != 1 || actions[0].Op != ActionAttrs {
+		t.Errorf("只修改属主时应只更新元数据: %+v", actions)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileOwner 非Unix平台没有属主和属组
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
+
+func canChown() bool {
+	return false
+}
@@ -0,0 +1,90 @@
+package main
+
+import "sync"
+
+// pauseGate 暂停开关，同步同一目录的同步器可共用。暂停时新的同步在扫描前等待，
+// 进行中的同步在处理完当前文件后等待，恢复后继续
+type pauseGate struct {
+	mutex   sync.Mutex
+	resumed chan struct{} // 未暂停时为已关闭的channel
+}
+
+func newPauseGate() *pauseGate {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &pauseGate{resumed: resumed}
+}
+
+func (g *pauseGate) pause() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	select {
+	case <-g.resumed:
+		g.resumed = make(chan struct{})
+	default:
+	}
+}
+
+func (g *pauseGate) resume() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	select {
+	case <-g.resumed:
+	default:
+		close(g.resumed)
+	}
+}
+
+func (g *pauseGate) paused() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	select {
+	case <-g.resumed:
+		return false
+	default:
+		return true
+	}
+}
+
+// channel 恢复时关闭的channel
+func (g *pauseGate) channel() <-chan struct{} {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.resumed
+}
+
+// Pause 暂停同步：定期同步和监听触发的同步在扫描前等待，进行中的同步处理完当前文件后等待
+func (fs *FileSync) Pause() {
+	fs.pause.pause()
+}
+
+// Resume 恢复暂停的同步
+func (fs *FileSync) Resume() {
+	fs.pause.resume()
+}
+
+// Paused 是否处于暂停状态
+func (fs *FileSync) Paused() bool {
+	return fs.pause.paused()
+}
+
+// Running 是否有同步正在进行
+func (fs *FileSync) Running() bool {
+	return fs.running.Load()
+}
+
+// waitResumed 暂停时等待恢复，同步器在等待中被停止时返回false
+func (fs *FileSync) waitResumed() bool {
+	resumed := fs.pause.channel()
+	select {
+	case <-resumed:
+		return true
+	default:
+	}
+	select {
+	case <-resumed:
+		return true
+	case <-fs.stopChan:
+		return false
+	}
+}
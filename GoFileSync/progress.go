@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// progressInterval 同一文件的字节进度事件的最小间隔
+const progressInterval = 200 * time.Millisecond
+
+// ProgressReporter 接收同步进度事件，供嵌入FileSync的调用方显示进度条。
+// 除start、file、done外还会收到file-start和bytes事件；Report在同步协程中依次调用，不会并发
+type ProgressReporter interface {
+	Report(event ProgressEvent)
+}
+
+// ProgressFunc 把函数用作ProgressReporter
+type ProgressFunc func(event ProgressEvent)
+
+func (f ProgressFunc) Report(event ProgressEvent) {
+	f(event)
+}
+
+// inflightFile 正在复制的文件已读取的字节数
+type inflightFile struct {
+	read int64
+	size int64
+}
+
+// progressTracker 一次同步的整体进度：按字节计算百分比和平均速率
+type progressTracker struct {
+	started    time.Time
+	total      int
+	bytesTotal int64
+
+	mutex     sync.Mutex
+	done      int
+	completed int64 // 已处理完的文件的字节数
+	inflight  map[string]*inflightFile
+}
+
+// newProgressTracker 复制操作的大小之和作为总字节数
+func newProgressTracker(actions []SyncAction) *progressTracker {
+	t := &progressTracker{started: time.Now(), total: len(actions), inflight: make(map[string]*inflightFile)}
+	for _, action := range actions {
+		if action.Op == ActionCopy {
+			t.bytesTotal += action.Size
+		}
+	}
+	return t
+}
+
+// bytesDone 已完成的字节数，读取超过文件大小的部分（如增量传输失败后重新复制）不重复计算
+func (t *progressTracker) bytesDone() int64 {
+	done := t.completed
+	for _, file := range t.inflight {
+		if file.read < file.size {
+			done += file.read
+		} else {
+			done += file.size
+		}
+	}
+	return done
+}
+
+// add 记录读取了path的n个字节，返回该文件已读取的字节数
+func (t *progressTracker) add(path string, size, n int64) int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	file, exists := t.inflight[path]
+	if !exists {
+		file = &inflightFile{size: size}
+		t.inflight[path] = file
+	}
+	file.read += n
+	return file.read
+}
+
+// finish 一个操作结束，复制操作中未读取的部分（如失败）也计为已处理
+func (t *progressTracker) finish(action SyncAction, done int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.done = done
+	if action.Op == ActionCopy {
+		delete(t.inflight, action.Path)
+		t.completed += action.Size
+	}
+}
+
+// fill 在事件中填入整体进度
+func (t *progressTracker) fill(event *ProgressEvent) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if event.Type == EventFileStart || event.Type == EventBytes {
+		event.Done, event.Total = t.done, t.total
+	}
+	event.BytesDone = t.bytesDone()
+	event.BytesTotal = t.bytesTotal
+	switch {
+	case t.bytesTotal > 0:
+		event.Percent = float64(event.BytesDone) * 100 / float64(t.bytesTotal)
+	case t.total > 0:
+		event.Percent = float64(t.done) * 100 / float64(t.total)
+	default:
+		event.Percent = 100
+	}
+	if event.Percent > 100 {
+		event.Percent = 100
+	}
+	if elapsed := time.Since(t.started).Seconds(); elapsed > 0 {
+		event.Throughput = float64(event.BytesDone) / elapsed
+	}
+}
+
+// progressReader 读取源文件时定期发送字节进度事件
+type progressReader struct {
+	reader   io.Reader
+	fs       *FileSync
+	tracker  *progressTracker
+	fileInfo *FileInfo
+	reported time.Time
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		read := r.tracker.add(r.fileInfo.Path, r.fileInfo.Size, int64(n))
+		if time.Since(r.reported) >= progressInterval {
+			r.reported = time.Now()
+			r.fs.emit(ProgressEvent{Type: EventBytes, Op: ActionCopy, Path: r.fileInfo.Path, FileBytes: read, FileSize: r.fileInfo.Size})
+		}
+	}
+	return n, err
+}
+
+// track 配置了Progress时包装读取源文件的reader，报告字节进度
+func (fs *FileSync) track(reader io.Reader, fileInfo *FileInfo) io.Reader {
+	tracker := fs.tracker
+	if tracker == nil || fs.config.Progress == nil {
+		return reader
+	}
+	return &progressReader{reader: reader, fs: fs, tracker: tracker, fileInfo: fileInfo, reported: time.Now()}
+}
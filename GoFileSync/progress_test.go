@@ -0,0 +1,131 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// collectProgress 用ProgressReporter收集全部事件
+func collectProgress(config *SyncConfig) *[]ProgressEvent {
+	var events []ProgressEvent
+	config.Progress = ProgressFunc(func(event ProgressEvent) { events = append(events, event) })
+	return &events
+}
+
+func TestProgressReporterEvents(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	for name, content := range map[string]string{"a.txt": "aaaa", "b.txt": "bbbbbbbb", "c.txt": "cc"} {
+		os.WriteFile(filepath.Join(sourceDir, name), []byte(content), 0644)
+	}
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, Workers: 2}
+	events := collectProgress(config)
+	fs := NewFileSync(config)
+	var coarse []ProgressEvent
+	fs.onProgress = func(event ProgressEvent) { coarse = append(coarse, event) }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, last := (*events)[0], (*events)[len(*events)-1]
+	if first.Type != EventStart || first.BytesTotal != 14 || first.Percent != 0 {
+		t.Errorf("开始事件不正确: %+v", first)
+	}
+	if last.Type != EventDone || last.BytesDone != 14 || last.Percent != 100 || last.Done != 3 {
+		t.Errorf("结束事件不正确: %+v", last)
+	}
+
+	// 每个文件先有file-start再有file，整体进度不回退
+	started := make(map[string]bool)
+	percent := 0.0
+	for _, event := range *events {
+		switch event.Type {
+		case EventFileStart:
+			started[event.Path] = true
+		case EventFile:
+			if !started[event.Path] {
+				t.Errorf("%s的file事件之前没有file-start", event.Path)
+			}
+			if event.FileBytes != event.FileSize {
+				t.Errorf("完成事件的字节数不正确: %+v", event)
+			}
+		}
+		if event.Percent < percent {
+			t.Errorf("进度回退: %.1f -> %.1f", percent, event.Percent)
+		}
+		percent = event.Percent
+	}
+	if len(started) != 3 {
+		t.Errorf("期望3个file-start事件，实际%d", len(started))
+	}
+
+	// onProgress只接收粗粒度的事件
+	if len(coarse) != 5 {
+		t.Errorf("onProgress应只收到start、3个file和done，实际%d个", len(coarse))
+	}
+}
+
+func TestProgressBytesEvents(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	// 限速使复制持续约0.6秒，期间应有多个字节进度事件
+	os.WriteFile(filepath.Join(sourceDir, "large.bin"), randomBytes(8, 600<<10), 0644)
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir, BandwidthLimit: 1 << 20}
+	events := collectProgress(config)
+	if err := NewFileSync(config).Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	var bytesEvents []ProgressEvent
+	for _, event := range *events {
+		if event.Type == EventBytes {
+			bytesEvents = append(bytesEvents, event)
+		}
+	}
+	if len(bytesEvents) < 2 {
+		t.Fatalf("期望多个字节进度事件，实际%d个", len(bytesEvents))
+	}
+	var read int64
+	for _, event := range bytesEvents {
+		if event.Path != "large.bin" || event.FileSize != 600<<10 || event.FileBytes <= read || event.FileBytes > event.FileSize {
+			t.Errorf("字节进度事件不正确: %+v", event)
+		}
+		if event.Throughput <= 0 || event.Percent <= 0 || event.Percent >= 100 {
+			t.Errorf("复制过程中的整体进度不正确: %+v", event)
+		}
+		read = event.FileBytes
+	}
+}
+
+func TestProgressReportsErrors(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "bad"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "bad", "a.txt"), []byte("bad"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "good.txt"), []byte("good"), 0644)
+	os.WriteFile(filepath.Join(destDir, "bad"), []byte("file"), 0644)
+
+	config := &SyncConfig{SourceDir: sourceDir, DestDir: destDir}
+	events := collectProgress(config)
+	NewFileSync(config).Sync()
+
+	var failed []ProgressEvent
+	for _, event := range *events {
+		if event.Type == EventFile && event.Error != "" {
+			failed = append(failed, event)
+		}
+	}
+	if len(failed) != 1 || failed[0].Path != "bad/a.txt" || !strings.Contains(failed[0].Error, "bad") {
+		t.Errorf("应报告失败的文件: %+v", failed)
+	}
+	// 失败的文件也计为已处理，进度最终到达100%
+	last := (*events)[len(*events)-1]
+	if last.Type != EventDone || last.Done != 2 || last.Percent != 100 {
+		t.Errorf("结束事件不正确: %+v", last)
+	}
+}
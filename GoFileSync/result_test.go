@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncWithResultPerFile(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("aaa"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte("bbbbb"), 0644)
+	os.WriteFile(filepath.Join(destDir, "old.txt"), []byte("old"), 0644)
+	// 目标中同名的非空目录使b.txt复制失败
+	os.MkdirAll(filepath.Join(destDir, "b.txt", "blocker"), 0755)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true, Workers: 2})
+	result, err := fs.SyncWithResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 1 || result.Deleted != 1 || result.Failed != 1 || result.BytesTransferred != 3 {
+		t.Errorf("统计不正确: %+v", result)
+	}
+	if result.Duration <= 0 || result.Duration != result.FinishedAt.Sub(result.StartedAt) {
+		t.Errorf("耗时不正确: %v", result.Duration)
+	}
+
+	expected := []struct{ path, op, status string }{
+		{"a.txt", ActionCopy, FileDone},
+		{"b.txt", ActionCopy, FileFailed},
+		{"old.txt", ActionDelete, FileDone},
+	}
+	if len(result.Files) != len(expected) {
+		t.Fatalf("文件结果数量不正确: %+v", result.Files)
+	}
+	for i, file := range result.Files {
+		if file.Path != expected[i].path || file.Op != expected[i].op || file.Status != expected[i].status {
+			t.Errorf("第%d个文件结果不正确: %+v", i, file)
+		}
+	}
+	if a := result.Files[0]; a.Size != 3 || a.Transferred != 3 || a.Error != "" {
+		t.Errorf("复制成功的文件结果不正确: %+v", a)
+	}
+	unfinished := result.Unfinished()
+	if len(unfinished) != 1 || unfinished[0].Path != "b.txt" || unfinished[0].Error == "" {
+		t.Errorf("未完成的文件应只有b.txt: %+v", unfinished)
+	}
+
+	// 修复后重试只需处理未完成的文件
+	os.RemoveAll(filepath.Join(destDir, "b.txt"))
+	result, err = fs.SyncWithResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Path != "b.txt" || len(result.Unfinished()) != 0 {
+		t.Errorf("重试结果不正确: %+v", result.Files)
+	}
+}
+
+func TestSyncWithResultDeferredAndConflicts(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+	os.WriteFile(filepath.Join(sourceDir, "fresh.txt"), []byte("writing"), 0644)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, StabilityWindow: time.Hour})
+	result, err := fs.SyncWithResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Files) != 1 || result.Files[0].Status != FileDeferred || result.Files[0].Error == "" {
+		t.Errorf("刚修改的文件应记为推迟: %+v", result.Files)
+	}
+
+	// 两侧都修改的文件记为冲突
+	os.Remove(filepath.Join(sourceDir, "fresh.txt"))
+	os.WriteFile(filepath.Join(sourceDir, "c.txt"), []byte("base"), 0644)
+	bidirectional := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true, ConflictPolicy: ConflictManual})
+	if err := bidirectional.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(sourceDir, "c.txt"), []byte("source"), 0644)
+	os.WriteFile(filepath.Join(destDir, "c.txt"), []byte("dest"), 0644)
+	result, err = bidirectional.SyncWithResult()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unfinished := result.Unfinished()
+	if result.Conflicts != 1 || len(unfinished) != 1 || unfinished[0].Path != "c.txt" || unfinished[0].Status != FileConflict {
+		t.Errorf("冲突应出现在未完成的文件中: %+v", result.Files)
+	}
+
+	bidirectional.Stop()
+	bidirectional.Pause()
+	if result, err := bidirectional.SyncWithResult(); err == nil || result != nil {
+		t.Error("停止后暂停的同步应返回错误且没有结果")
+	}
+}
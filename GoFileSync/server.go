@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 同步操作类型
+const (
+	ActionCopy   = "copy"
+	ActionDelete = "delete"
+	ActionMkdir  = "mkdir" // 创建空目录
+	ActionAttrs  = "attrs" // 内容不变，只更新权限、属主或目录的修改时间
+)
+
+// 进度事件类型
+const (
+	EventStart     = "start"      // 计划完成，开始执行
+	EventFileStart = "file-start" // 开始处理单个文件，只发给ProgressReporter
+	EventBytes     = "bytes"      // 复制中的字节进度，只发给ProgressReporter
+	EventFile      = "file"       // 单个文件处理完成，失败时带Error
+	EventDone      = "done"       // 本次同步结束
+)
+
+// SyncAction 同步计划中的单个操作
+type SyncAction struct {
+	Op        string `json:"op"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Direction string `json:"direction,omitempty"` // 为空表示源目录到目标目录，双向同步时可为DirectionToSource
+	Dir       bool   `json:"dir,omitempty"`       // 操作对象是目录
+}
+
+// ProgressEvent 同步进度事件
+type ProgressEvent struct {
+	Profile string    `json:"profile,omitempty"`
+	Type    string    `json:"type"`
+	Op      string    `json:"op,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Done    int       `json:"done"`
+	Total   int       `json:"total"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+
+	FileBytes  int64   `json:"file_bytes,omitempty"` // 当前文件已读取的字节数
+	FileSize   int64   `json:"file_size,omitempty"`  // 当前文件的大小
+	BytesDone  int64   `json:"bytes_done"`           // 本次同步已处理的字节数
+	BytesTotal int64   `json:"bytes_total"`          // 本次同步需要复制的总字节数
+	Percent    float64 `json:"percent"`              // 整体进度，有需要复制的数据时按字节计算，否则按操作数
+	Throughput float64 `json:"throughput,omitempty"` // 平均速率（字节/秒）
+}
+
+// RunResult 一次同步的执行结果
+type RunResult struct {
+	Profile          string    `json:"profile,omitempty"`
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	Planned          int       `json:"planned"`
+	Copied           int       `json:"copied"`
+	Deleted          int       `json:"deleted"`
+	Updated          int       `json:"updated,omitempty"` // 创建的目录和只更新元数据的文件、目录数
+	Failed           int       `json:"failed"`
+	BytesCopied      int64     `json:"bytes_copied"`
+	BytesTransferred int64     `json:"bytes_transferred"`   // 实际传输的字节数，增量传输的文件只计算变化的数据
+	Conflicts        int       `json:"conflicts,omitempty"` // 双向同步中等待手动处理的冲突数
+	Deferred         int       `json:"deferred,omitempty"`  // 可能正在写入、推迟到之后同步的文件数
+	Errors           []string  `json:"errors,omitempty"`
+	Error            string    `json:"error,omitempty"`
+
+	Duration time.Duration `json:"duration"`        // 本次同步的耗时（纳秒）
+	Files    []FileResult  `json:"files,omitempty"` // 每个文件和目录操作的结果，按路径排序
+}
+
+// 单个文件操作的结果
+const (
+	FileDone     = "done"     // 操作成功
+	FileFailed   = "failed"   // 操作失败，Error为原因
+	FileDeferred = "deferred" // 文件可能正在写入，推迟到之后的同步
+	FileKept     = "kept"     // 目录中还有未同步的文件，未删除
+	FileConflict = "conflict" // 双向同步的冲突等待手动处理
+)
+
+// FileResult 一次同步中单个文件或目录的执行结果
+type FileResult struct {
+	Path        string        `json:"path"`
+	Op          string        `json:"op,omitempty"`
+	Direction   string        `json:"direction,omitempty"`
+	Status      string        `json:"status"`
+	Size        int64         `json:"size,omitempty"`
+	Transferred int64         `json:"transferred,omitempty"` // 实际传输的字节数
+	Duration    time.Duration `json:"duration,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Unfinished 失败、推迟和冲突的文件，调用方可以据此告警或重试
+func (r *RunResult) Unfinished() []FileResult {
+	var files []FileResult
+	for _, file := range r.Files {
+		if file.Status == FileFailed || file.Status == FileDeferred || file.Status == FileConflict {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// ProfileStatus 同步配置的运行状态
+type ProfileStatus struct {
+	Name       string     `json:"name"`
+	SourceDir  string     `json:"source_dir"`
+	DestDir    string     `json:"dest_dir"`
+	Interval   string     `json:"interval"`
+	Scheduled  bool       `json:"scheduled"` // 是否在定期同步
+	Paused     bool       `json:"paused"`    // 是否已暂停
+	Running    bool       `json:"running"`   // 是否有同步正在进行
+	LastResult *RunResult `json:"last_result,omitempty"`
+}
+
+// profile 服务端管理的一个同步配置
+type profile struct {
+	name        string
+	config      *SyncConfig
+	daemon      *FileSync // 定期同步中的同步器，nil表示未启动
+	oneShot     *FileSync // 手动触发同步使用的同步器
+	lastResult  *RunResult
+	subscribers map[chan ProgressEvent]bool
+}
+
+// SyncServer 通过HTTP API控制多个同步配置
+type SyncServer struct {
+	profiles map[string]*profile
+	mutex    sync.RWMutex
+	mux      *http.ServeMux
+}
+
+// NewSyncServer 创建同步API服务
+func NewSyncServer() *SyncServer {
+	server := &SyncServer{profiles: make(map[string]*profile)}
+
+	server.mux = http.NewServeMux()
+	server.mux.HandleFunc("/profiles", server.handleProfiles)
+	server.mux.HandleFunc("/profiles/", server.handleProfile)
+	return server
+}
+
+// AddProfile 注册同步配置
+func (s *SyncServer) AddProfile(name string, config *SyncConfig) error {
+	if name == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("无效的配置名: %q", name)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, exists := s.profiles[name]; exists {
+		return fmt.Errorf("配置 %s 已存在", name)
+	}
+	p := &profile{name: name, config: config, subscribers: make(map[chan ProgressEvent]bool)}
+	p.oneShot = s.newFileSync(p)
+	s.profiles[name] = p
+	return nil
+}
+
+// newFileSync 创建把进度和结果回报给服务端的同步器
+func (s *SyncServer) newFileSync(p *profile) *FileSync {
+	fs := NewFileSync(p.config)
+	fs.onProgress = func(event ProgressEvent) {
+		event.Profile = p.name
+		s.publish(p, event)
+	}
+	fs.onResult = func(result *RunResult) {
+		result.Profile = p.name
+		s.mutex.Lock()
+		p.lastResult = result
+		s.mutex.Unlock()
+	}
+	return fs
+}
+
+// publish 向订阅者推送进度事件，订阅者处理不过来时丢弃事件
+func (s *SyncServer) publish(p *profile, event ProgressEvent) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for ch := range p.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (s *SyncServer) lookup(name string) (*profile, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	p, exists := s.profiles[name]
+	return p, exists
+}
+
+// StartProfile 开始定期同步
+func (s *SyncServer) StartProfile(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, exists := s.profiles[name]
+	if !exists {
+		return fmt.Errorf("配置 %s 不存在", name)
+	}
+	if p.daemon != nil {
+		return fmt.Errorf("配置 %s 已在运行", name)
+	}
+	// 与手动同步共用锁和暂停开关，避免同一配置的两次同步并发写目标目录
+	p.daemon = s.newFileSync(p)
+	p.daemon.syncMutex = p.oneShot.syncMutex
+	p.daemon.pause = p.oneShot.pause
+	go p.daemon.Start()
+	return nil
+}
+
+// StopProfile 停止定期同步
+func (s *SyncServer) StopProfile(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p, exists := s.profiles[name]
+	if !exists {
+		return fmt.Errorf("配置 %s 不存在", name)
+	}
+	if p.daemon == nil {
+		return fmt.Errorf("配置 %s 未在运行", name)
+	}
+	p.daemon.Stop()
+	p.daemon = nil
+	return nil
+}
+
+// RunProfile 立即在后台执行一次同步，暂停时返回错误
+func (s *SyncServer) RunProfile(name string) error {
+	p, exists := s.lookup(name)
+	if !exists {
+		return fmt.Errorf("配置 %s 不存在", name)
+	}
+	if p.oneShot.Paused() {
+		return fmt.Errorf("配置 %s 已暂停", name)
+	}
+	go p.oneShot.Sync()
+	return nil
+}
+
+// PauseProfile 暂停同步：跳过定期同步，进行中的同步处理完当前文件后等待
+func (s *SyncServer) PauseProfile(name string) error {
+	p, exists := s.lookup(name)
+	if !exists {
+		return fmt.Errorf("配置 %s 不存在", name)
+	}
+	if p.oneShot.Paused() {
+		return fmt.Errorf("配置 %s 已暂停", name)
+	}
+	p.oneShot.Pause()
+	return nil
+}
+
+// ResumeProfile 恢复暂停的同步
+func (s *SyncServer) ResumeProfile(name string) error {
+	p, exists := s.lookup(name)
+	if !exists {
+		return fmt.Errorf("配置 %s 不存在", name)
+	}
+	if !p.oneShot.Paused() {
+		return fmt.Errorf("配置 %s 未暂停", name)
+	}
+	p.oneShot.Resume()
+	return nil
+}
+
+// Status 返回所有配置的状态
+func (s *SyncServer) Status() []ProfileStatus {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	statuses := make([]ProfileStatus, 0, len(s.profiles))
+	for _, p := range s.profiles {
+		statuses = append(statuses, p.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+func (p *profile) status() ProfileStatus {
+	return ProfileStatus{
+		Name:       p.name,
+		SourceDir:  p.config.SourceDir,
+		DestDir:    p.config.DestDir,
+		Interval:   p.config.SyncInterval.String(),
+		Scheduled:  p.daemon != nil,
+		Paused:     p.oneShot.Paused(),
+		Running:    p.oneShot.Running() || (p.daemon != nil && p.daemon.Running()),
+		LastResult: p.lastResult,
+	}
+}
+
+// ServeHTTP 实现http.Handler
+func (s *SyncServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleProfiles GET /profiles
+func (s *SyncServer) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Status())
+}
+
+// handleProfile 处理 /profiles/{name}/{action}
+func (s *SyncServer) handleProfile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/profiles/"), "/")
+	name, action := parts[0], ""
+	if len(parts) == 2 {
+		action = parts[1]
+	} else if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, "未知路径")
+		return
+	}
+
+	p, exists := s.lookup(name)
+	if !exists {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("配置 %s 不存在", name))
+		return
+	}
+
+	method := http.MethodPost
+	if action == "" || action == "plan" || action == "last" || action == "errors" || action == "verify" || action == "events" {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "只支持"+method)
+		return
+	}
+
+	switch action {
+	case "":
+		s.mutex.RLock()
+		status := p.status()
+		s.mutex.RUnlock()
+		writeJSON(w, http.StatusOK, status)
+	case "start":
+		s.respond(w, s.StartProfile(name), http.StatusConflict)
+	case "stop":
+		s.respond(w, s.StopProfile(name), http.StatusConflict)
+	case "run":
+		if err := s.RunProfile(name); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	case "pause":
+		s.respond(w, s.PauseProfile(name), http.StatusConflict)
+	case "resume":
+		s.respond(w, s.ResumeProfile(name), http.StatusConflict)
+	case "plan":
+		actions, err := p.oneShot.Plan()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"profile": name, "actions": actions})
+	case "last":
+		s.mutex.RLock()
+		result := p.lastResult
+		s.mutex.RUnlock()
+		if result == nil {
+			writeError(w, http.StatusNotFound, "尚未执行过同步")
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	case "verify":
+		report, err := p.oneShot.Verify()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	case "errors":
+		// 最近一次同步的错误列表，没有同步过或没有错误时为空列表
+		s.mutex.RLock()
+		result := p.lastResult
+		s.mutex.RUnlock()
+		errors, files := []string{}, []FileResult{}
+		if result != nil {
+			if result.Error != "" {
+				errors = append(errors, result.Error)
+			}
+			errors = append(errors, result.Errors...)
+			files = append(files, result.Unfinished()...)
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"profile": name, "errors": errors, "files": files})
+	case "events":
+		s.streamEvents(w, r, p)
+	default:
+		writeError(w, http.StatusNotFound, "未知操作: "+action)
+	}
+}
+
+// respond 无错误时返回当前状态，否则返回errStatus
+func (s *SyncServer) respond(w http.ResponseWriter, err error, errStatus int) {
+	if err != nil {
+		writeError(w, errStatus, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// streamEvents 以Server-Sent Events推送同步进度，直到客户端断开
+func (s *SyncServer) streamEvents(w http.ResponseWriter, r *http.Request, p *profile) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "不支持流式响应")
+		return
+	}
+
+	ch := make(chan ProgressEvent, 64)
+	s.mutex.Lock()
+	p.subscribers[ch] = true
+	s.mutex.Unlock()
+	defer func() {
+		s.mutex.Lock()
+		delete(p.subscribers, ch)
+		s.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-ch:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
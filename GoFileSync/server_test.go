@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*SyncServer, string, string, func()) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte("bb"), 0644)
+	os.WriteFile(filepath.Join(destDir, "extra.txt"), []byte("x"), 0644)
+
+	server := NewSyncServer()
+	err := server.AddProfile("docs", &SyncConfig{
+		SourceDir:    sourceDir,
+		DestDir:      destDir,
+		SyncInterval: time.Hour,
+		DeleteExtra:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, sourceDir, destDir, cleanup
+}
+
+func waitForResult(t *testing.T, server *SyncServer, name string) *RunResult {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		p, _ := server.lookup(name)
+		server.mutex.RLock()
+		result := p.lastResult
+		server.mutex.RUnlock()
+		if result != nil {
+			return result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("等待同步结果超时")
+	return nil
+}
+
+func TestServerPlan(t *testing.T) {
+	server, _, destDir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profiles/docs/plan", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望200，实际%d: %s", rec.Code, rec.Body.String())
+	}
+
+	var plan struct {
+		Actions []SyncAction `json:"actions"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &plan)
+	expected := []SyncAction{
+		{Op: ActionCopy, Path: "a.txt", Size: 1},
+		{Op: ActionCopy, Path: "b.txt", Size: 2},
+		{Op: ActionDelete, Path: "extra.txt", Size: 1},
+	}
+	if len(plan.Actions) != len(expected) {
+		t.Fatalf("期望%v，实际%v", expected, plan.Actions)
+	}
+	for i := range expected {
+		if plan.Actions[i] != expected[i] {
+			t.Errorf("期望%v，实际%v", expected[i], plan.Actions[i])
+		}
+	}
+
+	// 计划不应修改目标目录
+	if _, err := os.Stat(filepath.Join(destDir, "extra.txt")); err != nil {
+		t.Error("计划不应删除文件")
+	}
+}
+
+func TestServerRunAndLastResult(t *testing.T) {
+	server, _, destDir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profiles/docs/last", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("未执行同步时期望404，实际%d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/profiles/docs/run", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("期望202，实际%d", rec.Code)
+	}
+
+	result := waitForResult(t, server, "docs")
+	if result.Copied != 2 || result.Deleted != 1 || result.Failed != 0 || result.BytesCopied != 3 {
+		t.Errorf("同步结果不正确: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "b.txt")); err != nil {
+		t.Error("文件应已同步")
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/profiles/docs/last", nil))
+	var last RunResult
+	json.Unmarshal(rec.Body.Bytes(), &last)
+	if rec.Code != http.StatusOK || last.Profile != "docs" || last.Copied != 2 {
+		t.Errorf("最近结果不正确: %d %+v", rec.Code, last)
+	}
+}
+
+func TestServerStartStop(t *testing.T) {
+	server, _, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	post := func(path string) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		return rec.Code
+	}
+
+	if code := post("/profiles/docs/start"); code != http.StatusOK {
+		t.Fatalf("启动期望200，实际%d", code)
+	}
+	if code := post("/profiles/docs/start"); code != http.StatusConflict {
+		t.Errorf("重复启动期望409，实际%d", code)
+	}
+	// 启动后立即执行一次同步
+	waitForResult(t, server, "docs")
+
+	if status := server.Status(); len(status) != 1 || !status[0].Scheduled {
+		t.Errorf("期望配置处于定期同步状态: %+v", status)
+	}
+
+	if code := post("/profiles/docs/stop"); code != http.StatusOK {
+		t.Errorf("停止期望200，实际%d", code)
+	}
+	if code := post("/profiles/docs/stop"); code != http.StatusConflict {
+		t.Errorf("重复停止期望409，实际%d", code)
+	}
+	if code := post("/profiles/missing/start"); code != http.StatusNotFound {
+		t.Errorf("未知配置期望404，实际%d", code)
+	}
+}
+
+func TestServerProgressEvents(t *testing.T) {
+	server, _, _, cleanup := newTestServer(t)
+	defer cleanup()
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL + "/profiles/docs/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("期望SSE响应，实际%s", resp.Header.Get("Content-Type"))
+	}
+
+	server.RunProfile("docs")
+
+	var events []ProgressEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event ProgressEvent
+		json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+		events = append(events, event)
+		if event.Type == EventDone {
+			break
+		}
+	}
+
+	// start + 3个文件 + done
+	if len(events) != 5 {
+		t.Fatalf("期望5个事件，实际%d: %+v", len(events), events)
+	}
+	if events[0].Type != EventStart || events[0].Total != 3 || events[0].Profile != "docs" {
+		t.Errorf("开始事件不正确: %+v", events[0])
+	}
+	if events[3].Type != EventFile || events[3].Op != ActionDelete || events[3].Done != 3 {
+		t.Errorf("文件事件不正确: %+v", events[3])
+	}
+}
+
+func TestServerPauseResume(t *testing.T) {
+	server, _, destDir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	post := func(path string) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		return rec.Code
+	}
+
+	if code := post("/profiles/docs/pause"); code != http.StatusOK {
+		t.Fatalf("暂停期望200，实际%d", code)
+	}
+	if code := post("/profiles/docs/pause"); code != http.StatusConflict {
+		t.Errorf("重复暂停期望409，实际%d", code)
+	}
+	if code := post("/profiles/docs/run"); code != http.StatusConflict {
+		t.Errorf("暂停时手动同步期望409，实际%d", code)
+	}
+	if status := server.Status(); !status[0].Paused {
+		t.Errorf("状态应为已暂停: %+v", status[0])
+	}
+
+	// 暂停期间启动的定期同步等待恢复
+	if code := post("/profiles/docs/start"); code != http.StatusOK {
+		t.Fatalf("启动期望200，实际%d", code)
+	}
+	defer server.StopProfile("docs")
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(filepath.Join(destDir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatal("暂停期间不应同步")
+	}
+
+	if code := post("/profiles/docs/resume"); code != http.StatusOK {
+		t.Fatalf("恢复期望200，实际%d", code)
+	}
+	if code := post("/profiles/docs/resume"); code != http.StatusConflict {
+		t.Errorf("未暂停时恢复期望409，实际%d", code)
+	}
+	if result := waitForResult(t, server, "docs"); result.Copied != 2 {
+		t.Errorf("恢复后应完成同步: %+v", result)
+	}
+}
+
+func TestServerErrorsAndVerify(t *testing.T) {
+	server, _, destDir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	get := func(path string, v interface{}) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		json.Unmarshal(rec.Body.Bytes(), v)
+		return rec.Code
+	}
+
+	var errorList struct {
+		Errors []string     `json:"errors"`
+		Files  []FileResult `json:"files"`
+	}
+	if code := get("/profiles/docs/errors", &errorList); code != http.StatusOK || errorList.Errors == nil || len(errorList.Errors) != 0 {
+		t.Errorf("没有同步过时错误列表应为空: %d %+v", code, errorList)
+	}
+
+	// 目标中同名的非空目录使复制失败
+	os.MkdirAll(filepath.Join(destDir, "a.txt", "blocker"), 0755)
+	server.RunProfile("docs")
+	waitForResult(t, server, "docs")
+	if code := get("/profiles/docs/errors", &errorList); code != http.StatusOK || len(errorList.Errors) != 1 || !strings.Contains(errorList.Errors[0], "a.txt") {
+		t.Errorf("错误列表应包含失败的文件: %d %+v", code, errorList)
+	}
+	if len(errorList.Files) != 1 || errorList.Files[0].Path != "a.txt" || errorList.Files[0].Status != FileFailed {
+		t.Errorf("错误列表应包含失败文件的结果: %+v", errorList.Files)
+	}
+
+	var report VerifyReport
+	if code := get("/profiles/docs/verify", &report); code != http.StatusOK || report.Matched != 1 || len(report.Issues) != 1 || report.Issues[0].Path != "a.txt" || report.Issues[0].Kind != VerifyMissing {
+		t.Errorf("校验结果不正确: %d %+v", code, report)
+	}
+}
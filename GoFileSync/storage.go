@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ObjectInfo 远端存储中的一个文件
+type ObjectInfo struct {
+	Path    string    `json:"path"` // 相对同步根目录的路径，以"/"分隔
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash,omitempty"` // 内容的MD5，存储不提供时为空
+}
+
+// StorageProvider 同步目标存储。路径都相对存储的根目录并以"/"分隔，
+// 不存在的文件在Stat和Read中返回满足os.IsNotExist的错误
+type StorageProvider interface {
+	List() ([]ObjectInfo, error)
+	Stat(relPath string) (*ObjectInfo, error)
+	Read(relPath string) (io.ReadCloser, error)
+	Write(relPath string, r io.Reader, size int64) error
+	Delete(relPath string) error
+}
+
+// cleanObjectPath 规范化存储路径，拒绝指向根目录之外的路径
+func cleanObjectPath(relPath string) (string, error) {
+	slashed := filepath.ToSlash(relPath)
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("无效的存储路径: %s", relPath)
+		}
+	}
+	cleaned := strings.TrimPrefix(path.Clean("/"+slashed), "/")
+	if cleaned == "" {
+		return "", fmt.Errorf("无效的存储路径: %s", relPath)
+	}
+	return cleaned, nil
+}
+
+// notExist 构造满足os.IsNotExist的错误
+func notExist(op, relPath string) error {
+	return &os.PathError{Op: op, Path: relPath, Err: os.ErrNotExist}
+}
+
+// LocalProvider 以本地目录作为存储，主要用于测试和与远端存储对照
+type LocalProvider struct {
+	Root string
+}
+
+func (p *LocalProvider) List() ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.Walk(p.Root, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && fullPath == p.Root {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || isTempFile(info.Name()) {
+			return nil
+		}
+		relPath, err := filepath.Rel(p.Root, fullPath)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Path: filepath.ToSlash(relPath), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
+
+func (p *LocalProvider) fullPath(relPath string) (string, error) {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(p.Root, filepath.FromSlash(cleaned)), nil
+}
+
+func (p *LocalProvider) Stat(relPath string) (*ObjectInfo, error) {
+	fullPath, err := p.fullPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{Path: filepath.ToSlash(relPath), Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (p *LocalProvider) Read(relPath string) (io.ReadCloser, error) {
+	fullPath, err := p.fullPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fullPath)
+}
+
+// Write 先写入同目录的临时文件，大小与size一致后再重命名，中断时不留下不完整的文件
+func (p *LocalProvider) Write(relPath string, r io.Reader, size int64) error {
+	fullPath, err := p.fullPath(relPath)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	part := partPath(fullPath, "")
+	file, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("写入%d字节，应为%d字节", written, size)
+	}
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, fullPath)
+}
+
+func (p *LocalProvider) Delete(relPath string) error {
+	fullPath, err := p.fullPath(relPath)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fullPath)
+}
+
+// planRemote 对比源目录和Target中的文件：存储提供MD5且HashAlgorithm为MD5时比较哈希，否则大小不同或远端比源文件旧时复制
+func (fs *FileSync) planRemote() ([]SyncAction, map[string]*FileInfo, error) {
+	srcFiles, err := fs.scanDirectory(fs.config.SourceDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("扫描源目录失败: %v", err)
+	}
+	remote, err := fs.remoteObjects()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var copies, deletes []SyncAction
+	for relPath, srcInfo := range srcFiles {
+		object, exists := remote[relPath]
+		changed := !exists || object.Size != srcInfo.Size
+		if !changed && object.Hash != "" && fs.hashAlgorithm() == HashMD5 {
+			changed = object.Hash != srcInfo.Hash
+		} else if !changed {
+			// 远端时间通常只精确到秒
+			changed = object.ModTime.Before(srcInfo.ModTime.Truncate(time.Second))
+		}
+		if changed {
+			copies = append(copies, SyncAction{Op: ActionCopy, Path: relPath, Size: srcInfo.Size})
+		}
+	}
+	if fs.config.DeleteExtra {
+		for relPath, object := range remote {
+			if _, exists := srcFiles[relPath]; !exists {
+				deletes = append(deletes, SyncAction{Op: ActionDelete, Path: relPath, Size: object.Size})
+			}
+		}
+	}
+
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Path < copies[j].Path })
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path < deletes[j].Path })
+	return append(copies, deletes...), srcFiles, nil
+}
+
+// remoteObjects 列出Target中参与同步的文件，按相对路径（系统分隔符）索引
+func (fs *FileSync) remoteObjects() (map[string]ObjectInfo, error) {
+	objects, err := fs.storage.List()
+	if err != nil {
+		return nil, fmt.Errorf("列出远端文件失败: %v", err)
+	}
+	filter, err := fs.pathFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	remote := make(map[string]ObjectInfo, len(objects))
+	for _, object := range objects {
+		relPath := filepath.FromSlash(object.Path)
+		// 与扫描本地目录使用相同的过滤规则，被过滤的远端文件不会被删除
+		if (!fs.config.IncludeHidden && path.Base(object.Path)[0] == '.') || relPath == StateFileName || !filter.allowsFile(relPath) {
+			continue
+		}
+		remote[relPath] = object
+	}
+	return remote, nil
+}
+
+// runRemote 把源目录同步到Target
+func (fs *FileSync) runRemote(result *RunResult) error {
+	actions, srcFiles, err := fs.planRemote()
+	if err != nil {
+		return err
+	}
+	fs.execute(actions, srcFiles, result)
+	fmt.Printf("远端同步完成，源目录%d个文件\n", len(srcFiles))
+	return nil
+}
+
+// upload 把源目录中的文件写入Target
+func (fs *FileSync) upload(relPath string, fileInfo *FileInfo) error {
+	srcPath := filepath.Join(fs.config.SourceDir, relPath)
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("打开源文件失败 %s: %v", srcPath, err)
+	}
+	defer file.Close()
+
+	// 上传的同时计算哈希，发现上传过程中源文件被修改
+	hash := fs.newHash()
+	reader := io.TeeReader(fs.track(fs.throttle(file), fileInfo), hash)
+	if err := fs.storage.Write(filepath.ToSlash(relPath), reader, fileInfo.Size); err != nil {
+		return fmt.Errorf("上传文件失败 %s: %v", relPath, err)
+	}
+	if fileInfo.Hash != "" && fileInfo.Link == "" && fmt.Sprintf("%x", hash.Sum(nil)) != fileInfo.Hash {
+		return fmt.Errorf("上传后哈希不一致，源文件可能正在被修改 %s", srcPath)
+	}
+	fmt.Printf("已上传: %s\n", relPath)
+	return nil
+}
+
+// deleteRemote 删除Target中的文件
+func (fs *FileSync) deleteRemote(relPath string) error {
+	if err := fs.storage.Delete(filepath.ToSlash(relPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除远端文件失败 %s: %v", relPath, err)
+	}
+	fmt.Printf("已删除远端文件: %s\n", relPath)
+	return nil
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Provider S3兼容的对象存储（AWS S3、MinIO、Ceph RGW等），使用AWS Signature V4签名。
+// 简单上传的ETag就是内容的MD5，同步时据此判断文件是否变化
+type S3Provider struct {
+	Endpoint  string // 如 https://s3.us-east-1.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	Prefix    string // 对象键前缀，相当于远端根目录，如 "backup/docs"
+	AccessKey string
+	SecretKey string
+	PathStyle bool         // 使用 endpoint/bucket/key 形式的地址，MinIO等通常需要
+	Client    *http.Client // 为空时使用http.DefaultClient
+}
+
+// s3ListResult ListObjectsV2的响应
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+func (p *S3Provider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
+
+// prefix 规范化的键前缀，非空时以"/"结尾
+func (p *S3Provider) prefix() string {
+	prefix := strings.Trim(p.Prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// objectURL 对象或存储桶（key为空）的地址
+func (p *S3Provider) objectURL(key string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(p.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("无效的S3地址: %v", err)
+	}
+	objectPath := "/" + key
+	if p.PathStyle {
+		objectPath = "/" + p.Bucket + objectPath
+	} else {
+		u.Host = p.Bucket + "." + u.Host
+	}
+	u.Path = objectPath
+	u.RawPath = awsEscape(objectPath, false)
+	u.RawQuery = canonicalQuery(query)
+	return u, nil
+}
+
+// do 签名并发送请求，非2xx响应转换为错误，404转换为不存在错误
+func (p *S3Provider) do(method, key string, query url.Values, body io.Reader, size int64) (*http.Response, error) {
+	u, err := p.objectURL(key, query)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && size == 0 {
+		// 空文件也要发送Content-Length: 0，S3不接受分块上传的请求体
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	p.sign(req, time.Now())
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notExist(strings.ToLower(method), key)
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("S3 %s %s 返回 %s: %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+}
+
+// sign 按AWS Signature V4签名请求。请求体不参与签名（UNSIGNED-PAYLOAD），上传时不必预先读取文件计算SHA-256
+func (p *S3Provider) sign(req *http.Request, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + p.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+p.SecretKey), date)
+	key = hmacSHA256(key, p.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape 按AWS的规则编码：除 A-Z a-z 0-9 - _ . ~ 外都编码，encodeSlash为false时保留"/"
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery 按键排序并编码的查询字符串，同时用作请求地址和签名
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// etagHash 简单上传的ETag是MD5，分片上传的ETag带"-N"后缀，不是内容哈希
+func etagHash(etag string) string {
+	etag = strings.Trim(etag, `"`)
+	if strings.Contains(etag, "-") {
+		return ""
+	}
+	return strings.ToLower(etag)
+}
+
+func (p *S3Provider) List() ([]ObjectInfo, error) {
+	prefix := p.prefix()
+	var objects []ObjectInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := p.do(http.MethodGet, "", query, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析S3列表失败: %v", err)
+		}
+
+		for _, content := range result.Contents {
+			relPath := strings.TrimPrefix(content.Key, prefix)
+			// 以"/"结尾的是控制台创建的目录占位对象
+			if relPath == "" || strings.HasSuffix(relPath, "/") {
+				continue
+			}
+			objects = append(objects, ObjectInfo{
+				Path:    relPath,
+				Size:    content.Size,
+				ModTime: content.LastModified,
+				Hash:    etagHash(content.ETag),
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (p *S3Provider) key(relPath string) (string, error) {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return "", err
+	}
+	return p.prefix() + cleaned, nil
+}
+
+func (p *S3Provider) Stat(relPath string) (*ObjectInfo, error) {
+	key, err := p.key(relPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.do(http.MethodHead, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &ObjectInfo{
+		Path:    relPath,
+		Size:    resp.ContentLength,
+		ModTime: modTime,
+		Hash:    etagHash(resp.Header.Get("ETag")),
+	}, nil
+}
+
+func (p *S3Provider) Read(relPath string) (io.ReadCloser, error) {
+	key, err := p.key(relPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.do(http.MethodGet, key, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (p *S3Provider) Write(relPath string, r io.Reader, size int64) error {
+	key, err := p.key(relPath)
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(http.MethodPut, key, nil, r, size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *S3Provider) Delete(relPath string) error {
+	key, err := p.key(relPath)
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(http.MethodDelete, key, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
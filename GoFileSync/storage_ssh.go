@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SFTPProvider SSH服务器上的一个目录。本目录没有依赖清单，无法引入golang.org/x/crypto/ssh，
+// 因此通过系统的ssh客户端在远端执行命令，主机、密钥和known_hosts与sftp使用相同的配置。
+// 远端需要POSIX shell和GNU find/stat
+type SFTPProvider struct {
+	Host    string   // 如 backup@nas.local
+	Root    string   // 远端根目录
+	Command []string // 执行远端脚本的命令，脚本作为最后一个参数；为空时使用 ssh -o BatchMode=yes <Host>
+}
+
+// sshMissingExit 远端文件不存在时脚本的退出码
+const sshMissingExit = 3
+
+// shellQuote 把参数放在单引号中传给远端shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (p *SFTPProvider) command(script string) *exec.Cmd {
+	args := p.Command
+	if len(args) == 0 {
+		args = []string{"ssh", "-o", "BatchMode=yes", p.Host}
+	}
+	args = append(append([]string(nil), args...), script)
+	return exec.Command(args[0], args[1:]...)
+}
+
+// run 执行远端脚本，失败时错误中带上远端的标准错误输出
+func (p *SFTPProvider) run(script string, stdin io.Reader) ([]byte, error) {
+	cmd := p.command(script)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("远端命令失败: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// remotePath 远端的完整路径
+func (p *SFTPProvider) remotePath(relPath string) (string, error) {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(p.Root, cleaned), nil
+}
+
+// exitCode 命令的退出码，不是退出错误时返回-1
+func exitCode(err error) int {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func (p *SFTPProvider) List() ([]ObjectInfo, error) {
+	script := fmt.Sprintf(`cd %s 2>/dev/null || exit 0; find . -type f -printf '%%P\t%%s\t%%T@\n'`, shellQuote(p.Root))
+	out, err := p.run(script, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		size, _ := strconv.ParseInt(fields[1], 10, 64)
+		objects = append(objects, ObjectInfo{Path: fields[0], Size: size, ModTime: parseEpoch(fields[2])})
+	}
+	return objects, scanner.Err()
+}
+
+// parseEpoch 解析带小数的Unix时间戳
+func parseEpoch(s string) time.Time {
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func (p *SFTPProvider) Stat(relPath string) (*ObjectInfo, error) {
+	remote, err := p.remotePath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf(`[ -f %[1]s ] || exit %[2]d; stat -c '%%s %%Y' %[1]s`, shellQuote(remote), sshMissingExit)
+	cmd := p.command(script)
+	out, err := cmd.Output()
+	if exitCode(err) == sshMissingExit {
+		return nil, notExist("stat", relPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("远端命令失败: %v", err)
+	}
+	var size, mtime int64
+	if _, err := fmt.Sscanf(string(out), "%d %d", &size, &mtime); err != nil {
+		return nil, fmt.Errorf("解析远端stat输出失败: %q", out)
+	}
+	return &ObjectInfo{Path: relPath, Size: size, ModTime: time.Unix(mtime, 0)}, nil
+}
+
+// sshReader 远端cat的输出，Close时等待命令结束
+type sshReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *sshReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+func (p *SFTPProvider) Read(relPath string) (io.ReadCloser, error) {
+	if _, err := p.Stat(relPath); err != nil {
+		return nil, err
+	}
+	remote, _ := p.remotePath(relPath)
+	cmd := p.command("cat " + shellQuote(remote))
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &sshReader{ReadCloser: stdout, cmd: cmd}, nil
+}
+
+// Write 先写入临时文件再重命名，传输中断不会留下不完整的文件
+func (p *SFTPProvider) Write(relPath string, r io.Reader, size int64) error {
+	remote, err := p.remotePath(relPath)
+	if err != nil {
+		return err
+	}
+	tmp := remote + ".filesync-tmp"
+	script := fmt.Sprintf(`mkdir -p %s && cat > %s && mv -f %s %s`,
+		shellQuote(path.Dir(remote)), shellQuote(tmp), shellQuote(tmp), shellQuote(remote))
+	_, err = p.run(script, r)
+	return err
+}
+
+func (p *SFTPProvider) Delete(relPath string) error {
+	remote, err := p.remotePath(relPath)
+	if err != nil {
+		return err
+	}
+	_, err = p.run("rm -f "+shellQuote(remote), nil)
+	return err
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 内存中的S3，只实现同步用到的接口，并检查请求是否带有签名
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	puts    int
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") || r.Header.Get("x-amz-date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 路径形式的地址：/bucket/key
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket/":
+		prefix := r.URL.Query().Get("prefix")
+		var keys []string
+		for k := range s.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		// 每页2个对象，测试分页
+		start := 0
+		if token := r.URL.Query().Get("continuation-token"); token != "" {
+			fmt.Sscanf(token, "%d", &start)
+		}
+		fmt.Fprint(w, "<ListBucketResult>")
+		end := start + 2
+		if end < len(keys) {
+			fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%d</NextContinuationToken>", end)
+		} else {
+			end = len(keys)
+		}
+		for _, k := range keys[start:end] {
+			fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>2024-01-01T00:00:00.000Z</LastModified><ETag>"%x"</ETag><Size>%d</Size></Contents>`,
+				k, md5.Sum(s.objects[k]), len(s.objects[k]))
+		}
+		fmt.Fprint(w, "</ListBucketResult>")
+	case r.Method == http.MethodPut:
+		if r.ContentLength < 0 {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = data
+		s.puts++
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, exists := s.objects[key]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestSyncToS3(t *testing.T) {
+	sourceDir, _, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "sub dir"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "empty.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "sub dir", "b+c.txt"), []byte("bc"), 0644)
+
+	s3 := &fakeS3{objects: map[string][]byte{
+		"backup/stale.txt": []byte("stale"),
+		"backup/a.txt":     []byte("old"),
+		"other/keep.txt":   []byte("不在前缀下"),
+	}}
+	server := httptest.NewServer(s3)
+	defer server.Close()
+
+	target := &S3Provider{Endpoint: server.URL, Region: "us-east-1", Bucket: "bucket", Prefix: "/backup/", AccessKey: "AK", SecretKey: "SK", PathStyle: true}
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, Target: target, DeleteExtra: true, Workers: 2})
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if result.Copied != 3 || result.Deleted != 1 || result.Failed != 0 {
+		t.Fatalf("S3同步结果不正确: %+v", result)
+	}
+	if string(s3.objects["backup/sub dir/b+c.txt"]) != "bc" || string(s3.objects["backup/a.txt"]) != "a" {
+		t.Errorf("S3中的对象不正确: %v", s3.objects)
+	}
+	if _, exists := s3.objects["backup/stale.txt"]; exists {
+		t.Error("多余的对象应被删除")
+	}
+	if _, exists := s3.objects["other/keep.txt"]; !exists {
+		t.Error("前缀之外的对象不应被删除")
+	}
+
+	// ETag与本地MD5一致时不再上传
+	puts := s3.puts
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+	fs.Sync()
+	if s3.puts != puts {
+		t.Error("未变化的文件不应重新上传")
+	}
+
+	info, err := target.Stat("sub dir/b+c.txt")
+	if err != nil || info.Size != 2 || info.Hash != fmt.Sprintf("%x", md5.Sum([]byte("bc"))) {
+		t.Errorf("Stat结果不正确: %+v %v", info, err)
+	}
+	if _, err := target.Stat("missing.txt"); !os.IsNotExist(err) {
+		t.Errorf("不存在的对象应返回不存在错误: %v", err)
+	}
+	if _, err := target.Stat("../escape"); err == nil {
+		t.Error("根目录之外的路径应被拒绝")
+	}
+}
+
+// fakeWebDAV 以本地目录实现PROPFIND、MKCOL、PUT、GET和DELETE
+func fakeWebDAV(root, prefix string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rel := strings.TrimPrefix(r.URL.Path, prefix)
+		full := filepath.Join(root, filepath.FromSlash(rel))
+		switch r.Method {
+		case "PROPFIND":
+			info, err := os.Stat(full)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			entries := []os.FileInfo{info}
+			names := []string{""}
+			if info.IsDir() && r.Header.Get("Depth") == "1" {
+				children, _ := os.ReadDir(full)
+				for _, child := range children {
+					childInfo, _ := child.Info()
+					entries = append(entries, childInfo)
+					names = append(names, child.Name())
+				}
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			fmt.Fprint(w, `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:">`)
+			for i, entry := range entries {
+				href := strings.TrimSuffix(r.URL.Path, "/")
+				if names[i] != "" {
+					href += "/" + names[i]
+				}
+				resourceType := ""
+				if entry.IsDir() {
+					resourceType = "<D:collection/>"
+					href += "/"
+				}
+				fmt.Fprintf(w, `<D:response><D:href>%s</D:href><D:propstat><D:prop><D:resourcetype>%s</D:resourcetype><D:getcontentlength>%d</D:getcontentlength><D:getlastmodified>%s</D:getlastmodified></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`,
+					href, resourceType, entry.Size(), entry.ModTime().UTC().Format(http.TimeFormat))
+			}
+			fmt.Fprint(w, `</D:multistatus>`)
+		case "MKCOL":
+			if _, err := os.Stat(full); err == nil {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if err := os.Mkdir(full, 0755); err != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			if err := os.WriteFile(full, data, 0644); err != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			http.ServeFile(w, r, full)
+		case http.MethodDelete:
+			if err := os.Remove(full); err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+func TestSyncToWebDAV(t *testing.T) {
+	sourceDir, remoteDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "docs", "2024"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "docs", "2024", "report.txt"), []byte("report"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(remoteDir, "old"), 0755)
+	os.WriteFile(filepath.Join(remoteDir, "old", "stale.txt"), []byte("stale"), 0644)
+
+	server := httptest.NewServer(fakeWebDAV(remoteDir, "/dav/backup/"))
+	defer server.Close()
+	target := &WebDAVProvider{URL: server.URL + "/dav/backup", Username: "alice", Password: "secret"}
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, Target: target, DeleteExtra: true})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(remoteDir, "docs", "2024", "report.txt")); string(data) != "report" {
+		t.Error("应逐级创建目录并上传文件")
+	}
+	if _, err := os.Stat(filepath.Join(remoteDir, "old", "stale.txt")); !os.IsNotExist(err) {
+		t.Error("多余的远端文件应被删除")
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	// 源文件比远端新时重新上传
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(sourceDir, "a.txt"), later, later)
+	if actions, _ := fs.Plan(); len(actions) != 1 || actions[0].Path != "a.txt" {
+		t.Errorf("修改时间较新的文件应重新上传: %+v", actions)
+	}
+
+	reader, err := target.Read("docs/2024/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "report" {
+		t.Errorf("读取内容不正确: %q", data)
+	}
+	if info, err := target.Stat("a.txt"); err != nil || info.Size != 1 {
+		t.Errorf("Stat结果不正确: %+v %v", info, err)
+	}
+	if _, err := target.Stat("missing.txt"); !os.IsNotExist(err) {
+		t.Errorf("不存在的文件应返回不存在错误: %v", err)
+	}
+	if err := (&WebDAVProvider{URL: target.URL, Username: "alice", Password: "wrong"}).Write("x.txt", strings.NewReader("x"), 1); err == nil {
+		t.Error("认证失败应返回错误")
+	}
+}
+
+func TestSyncOverSSH(t *testing.T) {
+	if _, err := exec.LookPath("find"); err != nil {
+		t.Skip("需要find命令")
+	}
+	sourceDir, remoteDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.MkdirAll(filepath.Join(sourceDir, "it's a dir"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "it's a dir", "b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(remoteDir, "stale.txt"), []byte("stale"), 0644)
+
+	// 用本地shell代替ssh执行远端脚本
+	target := &SFTPProvider{Root: remoteDir, Command: []string{"sh", "-c"}}
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, Target: target, DeleteExtra: true})
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(remoteDir, "it's a dir", "b.txt")); string(data) != "b" {
+		t.Error("含引号的路径应正确上传")
+	}
+	if _, err := os.Stat(filepath.Join(remoteDir, "stale.txt")); !os.IsNotExist(err) {
+		t.Error("多余的远端文件应被删除")
+	}
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+
+	info, err := target.Stat("a.txt")
+	if err != nil || info.Size != 1 {
+		t.Errorf("Stat结果不正确: %+v %v", info, err)
+	}
+	if _, err := target.Stat("missing.txt"); !os.IsNotExist(err) {
+		t.Errorf("不存在的文件应返回不存在错误: %v", err)
+	}
+	reader, err := target.Read("it's a dir/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	if err := reader.Close(); err != nil || string(data) != "b" {
+		t.Errorf("读取内容不正确: %q %v", data, err)
+	}
+
+	// 远端根目录不存在时视为空
+	empty := &SFTPProvider{Root: filepath.Join(remoteDir, "missing"), Command: []string{"sh", "-c"}}
+	if objects, err := empty.List(); err != nil || len(objects) != 0 {
+		t.Errorf("不存在的根目录应返回空列表: %v %v", objects, err)
+	}
+}
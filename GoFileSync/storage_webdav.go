@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// WebDAVProvider WebDAV服务器（Nextcloud、Apache mod_dav、nginx-dav等）上的一个目录
+type WebDAVProvider struct {
+	URL      string // 远端根目录，如 https://dav.example.com/remote.php/dav/files/alice/backup
+	Username string
+	Password string
+	Client   *http.Client // 为空时使用http.DefaultClient
+}
+
+// propfindBody 只请求同步需要的属性
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+// davMultistatus PROPFIND的响应
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// davEntry PROPFIND返回的一个文件或目录
+type davEntry struct {
+	relPath string
+	isDir   bool
+	info    ObjectInfo
+}
+
+func (p *WebDAVProvider) client() *http.Client {
+	if p.Client != nil {
+		return p.Client
+	}
+	return http.DefaultClient
+}
+
+// base 解析后的根目录地址，路径以"/"结尾
+func (p *WebDAVProvider) base() (*url.URL, error) {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的WebDAV地址: %v", err)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawPath = ""
+	return u, nil
+}
+
+// do 发送请求，expected之外的状态码转换为错误，404转换为不存在错误
+func (p *WebDAVProvider) do(method, relPath string, header http.Header, body io.Reader, size int64, expected ...int) (*http.Response, error) {
+	u, err := p.base()
+	if err != nil {
+		return nil, err
+	}
+	u.Path += relPath
+	if body != nil && size == 0 {
+		body = http.NoBody
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if p.Username != "" {
+		req.SetBasicAuth(p.Username, p.Password)
+	}
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notExist(strings.ToLower(method), relPath)
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("WebDAV %s %s 返回 %s: %s", method, relPath, resp.Status, strings.TrimSpace(string(message)))
+}
+
+// propfind 查询relPath（目录以"/"结尾）本身（depth为"0"）或其直接子项（depth为"1"）
+func (p *WebDAVProvider) propfind(relPath, depth string) ([]davEntry, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := p.do("PROPFIND", relPath, header, strings.NewReader(propfindBody), int64(len(propfindBody)), http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("解析PROPFIND响应失败: %v", err)
+	}
+	base, err := p.base()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []davEntry
+	for _, response := range result.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			continue
+		}
+		// href可以是绝对地址或绝对路径，只取路径部分与根目录比较
+		rel := ""
+		if href.Path+"/" != base.Path {
+			if !strings.HasPrefix(href.Path, base.Path) {
+				continue
+			}
+			rel = strings.Trim(strings.TrimPrefix(href.Path, base.Path), "/")
+		}
+		entry := davEntry{relPath: rel}
+		for _, propstat := range response.Propstat {
+			if !strings.Contains(propstat.Status, " 200 ") {
+				continue
+			}
+			prop := propstat.Prop
+			entry.isDir = prop.ResourceType.Collection != nil
+			entry.info.Size, _ = strconv.ParseInt(prop.ContentLength, 10, 64)
+			entry.info.ModTime, _ = http.ParseTime(prop.LastModified)
+		}
+		entry.info.Path = entry.relPath
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// List 逐级PROPFIND遍历目录，很多服务器禁止Depth: infinity
+func (p *WebDAVProvider) List() ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	queue := []string{""}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+		dirPath := dir
+		if dirPath != "" {
+			dirPath += "/"
+		}
+		entries, err := p.propfind(dirPath, "1")
+		if err != nil {
+			if dir == "" && os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			// 响应中包含目录自身
+			if entry.relPath == dir {
+				continue
+			}
+			if entry.isDir {
+				queue = append(queue, entry.relPath)
+			} else {
+				objects = append(objects, entry.info)
+			}
+		}
+	}
+	return objects, nil
+}
+
+func (p *WebDAVProvider) Stat(relPath string) (*ObjectInfo, error) {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := p.propfind(cleaned, "0")
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].isDir {
+		return nil, notExist("stat", relPath)
+	}
+	return &entries[0].info, nil
+}
+
+func (p *WebDAVProvider) Read(relPath string) (io.ReadCloser, error) {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.do(http.MethodGet, cleaned, nil, nil, 0, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Write 先逐级创建上级目录（已存在时服务器返回405），再上传文件
+func (p *WebDAVProvider) Write(relPath string, r io.Reader, size int64) error {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return err
+	}
+	if dir := path.Dir(cleaned); dir != "." {
+		segments := strings.Split(dir, "/")
+		for i := range segments {
+			collection := strings.Join(segments[:i+1], "/") + "/"
+			resp, err := p.do("MKCOL", collection, nil, nil, 0, http.StatusCreated, http.StatusMethodNotAllowed)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+	}
+
+	resp, err := p.do(http.MethodPut, cleaned, nil, r, size, http.StatusOK, http.StatusCreated, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *WebDAVProvider) Delete(relPath string) error {
+	cleaned, err := cleanObjectPath(relPath)
+	if err != nil {
+		return err
+	}
+	resp, err := p.do(http.MethodDelete, cleaned, nil, nil, 0, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
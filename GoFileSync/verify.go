@@ -0,0 +1,241 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 校验发现的问题类型
+const (
+	VerifyMissing    = "missing"    // 源文件在目标中不存在
+	VerifyMismatch   = "mismatch"   // 目标中的内容与源文件不同
+	VerifyUnreadable = "unreadable" // 目标中的文件无法读取、解密或解压
+	VerifyExtra      = "extra"      // 目标中多余的文件
+)
+
+// VerifyIssue 校验发现的一处不一致
+type VerifyIssue struct {
+	Path       string `json:"path"`
+	Kind       string `json:"kind"`
+	SourceSize int64  `json:"source_size,omitempty"`
+	DestSize   int64  `json:"dest_size,omitempty"`
+	SourceHash string `json:"source_hash,omitempty"`
+	DestHash   string `json:"dest_hash,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// VerifyReport 校验结果，Issues按路径排序
+type VerifyReport struct {
+	StartedAt   time.Time     `json:"started_at"`
+	FinishedAt  time.Time     `json:"finished_at"`
+	SourceFiles int           `json:"source_files"`
+	DestFiles   int           `json:"dest_files"`
+	Matched     int           `json:"matched"`
+	Issues      []VerifyIssue `json:"issues,omitempty"`
+}
+
+// OK 源目录和目标完全一致
+func (r *VerifyReport) OK() bool {
+	return len(r.Issues) == 0
+}
+
+// Verify 重新读取源目录和目标中的全部文件并比较内容哈希，不复制任何文件。
+// 忽略哈希缓存，可以发现保留修改时间的改写和存储介质损坏，适合作为定期的完整性检查
+func (fs *FileSync) Verify() (*VerifyReport, error) {
+	fs.syncMutex.Lock()
+	defer fs.syncMutex.Unlock()
+	report, _, err := fs.verify()
+	return report, err
+}
+
+// Repair 校验后只修复不一致的文件：重新复制缺失、内容不同和无法读取的文件，DeleteExtra时删除多余的文件。
+// 返回修复前的校验结果，修复的统计与Sync相同地报告给进度回调
+func (fs *FileSync) Repair() (*VerifyReport, error) {
+	if fs.config.Bidirectional {
+		return nil, fmt.Errorf("双向同步无法判断哪一侧的内容正确，不支持Repair")
+	}
+	var report *VerifyReport
+	_, err := fs.record(func(result *RunResult) error {
+		var srcFiles map[string]*FileInfo
+		var err error
+		report, srcFiles, err = fs.verify()
+		if err != nil {
+			return err
+		}
+		var actions []SyncAction
+		for _, issue := range report.Issues {
+			switch {
+			case issue.Kind != VerifyExtra:
+				actions = append(actions, SyncAction{Op: ActionCopy, Path: issue.Path, Size: issue.SourceSize})
+			case fs.config.DeleteExtra:
+				actions = append(actions, SyncAction{Op: ActionDelete, Path: issue.Path, Size: issue.DestSize})
+			}
+		}
+		if len(actions) == 0 {
+			return nil
+		}
+		// 复制在前、删除在后
+		sort.SliceStable(actions, func(i, j int) bool { return actions[i].Op == ActionCopy && actions[j].Op != ActionCopy })
+
+		if fs.config.Archive != "" {
+			reader, _, err := readArchive(fs.config.Archive)
+			if err != nil {
+				return err
+			}
+			if reader != nil {
+				defer reader.Close()
+			}
+			return fs.applyArchive(actions, srcFiles, reader, result)
+		}
+		fs.execute(actions, srcFiles, result)
+		fmt.Printf("修复完成，%d个文件不一致\n", len(actions))
+		return nil
+	})
+	return report, err
+}
+
+// verify 比较源目录和目标，返回校验结果和源文件信息
+func (fs *FileSync) verify() (*VerifyReport, map[string]*FileInfo, error) {
+	fs.rehash.Store(true)
+	defer fs.rehash.Store(false)
+
+	report := &VerifyReport{StartedAt: time.Now()}
+	srcFiles, err := fs.scanDirectory(fs.config.SourceDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("扫描源目录失败: %v", err)
+	}
+	destFiles, unreadable, err := fs.destContents()
+	if err != nil {
+		return nil, nil, err
+	}
+	report.SourceFiles = len(srcFiles)
+	report.DestFiles = len(destFiles) + len(unreadable)
+
+	for relPath, srcInfo := range srcFiles {
+		issue := VerifyIssue{Path: relPath, SourceSize: srcInfo.Size, SourceHash: srcInfo.Hash}
+		destInfo, exists := destFiles[relPath]
+		switch {
+		case unreadable[relPath] != nil:
+			issue.Kind, issue.Error = VerifyUnreadable, unreadable[relPath].Error()
+		case !exists:
+			issue.Kind = VerifyMissing
+		case destInfo.Hash != srcInfo.Hash:
+			issue.Kind, issue.DestSize, issue.DestHash = VerifyMismatch, destInfo.Size, destInfo.Hash
+		default:
+			report.Matched++
+			continue
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	for relPath, destInfo := range destFiles {
+		if _, exists := srcFiles[relPath]; !exists {
+			report.Issues = append(report.Issues, VerifyIssue{Path: relPath, Kind: VerifyExtra, DestSize: destInfo.Size, DestHash: destInfo.Hash})
+		}
+	}
+	for relPath, err := range unreadable {
+		if _, exists := srcFiles[relPath]; !exists {
+			report.Issues = append(report.Issues, VerifyIssue{Path: relPath, Kind: VerifyExtra, Error: err.Error()})
+		}
+	}
+
+	sort.Slice(report.Issues, func(i, j int) bool { return report.Issues[i].Path < report.Issues[j].Path })
+	report.FinishedAt = time.Now()
+	fmt.Printf("校验完成，%d个文件一致，%d处不一致\n", report.Matched, len(report.Issues))
+	return report, srcFiles, nil
+}
+
+// destContents 读取目标中的全部文件并计算哈希，返回能读取的文件和读取失败的文件
+func (fs *FileSync) destContents() (map[string]*FileInfo, map[string]error, error) {
+	switch {
+	case fs.config.Archive != "":
+		return fs.archiveContents()
+	case fs.storage != nil:
+		return fs.remoteContents()
+	}
+	destFiles, err := fs.scanDirectory(fs.config.DestDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("扫描目标目录失败: %v", err)
+	}
+	return destFiles, map[string]error{}, nil
+}
+
+// remoteContents 通过StorageProvider读取全部文件（加密和压缩的目标会解密、解压）并计算哈希
+func (fs *FileSync) remoteContents() (map[string]*FileInfo, map[string]error, error) {
+	remote, err := fs.remoteObjects()
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, 0, len(remote))
+	for relPath := range remote {
+		paths = append(paths, relPath)
+	}
+	files, failed := hashContents(paths, fs.config.Workers, func(relPath string) (*FileInfo, error) {
+		object := remote[relPath]
+		reader, err := fs.storage.Read(object.Path)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return fs.hashReader(relPath, fs.throttle(reader))
+	})
+	return files, failed, nil
+}
+
+// archiveContents 读取归档中的全部条目并计算哈希，zip的CRC32校验失败时记为无法读取
+func (fs *FileSync) archiveContents() (map[string]*FileInfo, map[string]error, error) {
+	reader, entries, err := readArchive(fs.config.Archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reader != nil {
+		defer reader.Close()
+	}
+	paths := make([]string, 0, len(entries))
+	for relPath := range entries {
+		paths = append(paths, relPath)
+	}
+	files, failed := hashContents(paths, fs.config.Workers, func(relPath string) (*FileInfo, error) {
+		file, err := entries[relPath].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return fs.hashReader(relPath, file)
+	})
+	return files, failed, nil
+}
+
+// hashContents 并发读取paths，分别收集成功和失败的结果
+func hashContents(paths []string, workers int, read func(relPath string) (*FileInfo, error)) (map[string]*FileInfo, map[string]error) {
+	files := make(map[string]*FileInfo, len(paths))
+	failed := make(map[string]error)
+	var mutex sync.Mutex
+	parallel(len(paths), workers, func(i int) {
+		info, err := read(paths[i])
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			failed[paths[i]] = err
+			return
+		}
+		files[paths[i]] = info
+	})
+	return files, failed
+}
+
+// hashReader 读取全部内容，返回大小和哈希
+func (fs *FileSync) hashReader(relPath string, reader io.Reader) (*FileInfo, error) {
+	hash := fs.newHash()
+	size, err := io.Copy(hash, reader)
+	if err == zip.ErrChecksum {
+		return nil, fmt.Errorf("归档条目校验失败: %s", relPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{Path: relPath, Size: size, Hash: fmt.Sprintf("%x", hash.Sum(nil))}, nil
+}
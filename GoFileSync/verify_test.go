@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// setupVerifyDirs 同步后制造不一致：b.txt被保留大小和修改时间地改写，c.txt缺失，extra.txt多余
+func setupVerifyDirs(t *testing.T, config *SyncConfig) *FileSync {
+	os.WriteFile(filepath.Join(config.SourceDir, "a.txt"), []byte("aaaa"), 0644)
+	os.WriteFile(filepath.Join(config.SourceDir, "b.txt"), []byte("bbbb"), 0644)
+	os.WriteFile(filepath.Join(config.SourceDir, "c.txt"), []byte("cccc"), 0644)
+	// 修改时间足够早，复制后目标文件的哈希会写入缓存
+	old := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		os.Chtimes(filepath.Join(config.SourceDir, name), old, old)
+	}
+	fs := NewFileSync(config)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	bPath := filepath.Join(config.DestDir, "b.txt")
+	info, _ := os.Stat(bPath)
+	os.WriteFile(bPath, []byte("bXbb"), 0644)
+	os.Chtimes(bPath, info.ModTime(), info.ModTime())
+	os.Remove(filepath.Join(config.DestDir, "c.txt"))
+	os.WriteFile(filepath.Join(config.DestDir, "extra.txt"), []byte("x"), 0644)
+	return fs
+}
+
+func TestVerifyReportsDifferences(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	fs := setupVerifyDirs(t, &SyncConfig{SourceDir: sourceDir, DestDir: destDir, HashCache: filepath.Join(t.TempDir(), "hashes.json")})
+	// 哈希缓存认为b.txt未变化，普通的同步发现不了
+	if actions, _ := fs.Plan(); len(actions) != 1 || actions[0].Path != "c.txt" {
+		t.Fatalf("计划应只包含缺失的文件: %+v", actions)
+	}
+
+	report, err := fs.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() || report.SourceFiles != 3 || report.DestFiles != 3 || report.Matched != 1 || len(report.Issues) != 3 {
+		t.Fatalf("校验结果不正确: %+v", report)
+	}
+	expected := []struct{ path, kind string }{{"b.txt", VerifyMismatch}, {"c.txt", VerifyMissing}, {"extra.txt", VerifyExtra}}
+	for i, issue := range report.Issues {
+		if issue.Path != expected[i].path || issue.Kind != expected[i].kind {
+			t.Errorf("第%d个问题不正确: %+v", i, issue)
+		}
+	}
+	if report.Issues[0].SourceHash == report.Issues[0].DestHash || report.Issues[0].DestHash == "" {
+		t.Errorf("内容不同的文件应带有两侧的哈希: %+v", report.Issues[0])
+	}
+
+	// 校验不修改目标
+	if data, _ := os.ReadFile(filepath.Join(destDir, "b.txt")); string(data) != "bXbb" {
+		t.Error("Verify不应修改目标文件")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "c.txt")); !os.IsNotExist(err) {
+		t.Error("Verify不应复制文件")
+	}
+}
+
+func TestRepairFixesOnlyDifferences(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	fs := setupVerifyDirs(t, &SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true})
+	aInfo, _ := os.Stat(filepath.Join(destDir, "a.txt"))
+
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	report, err := fs.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 3 || result.Copied != 2 || result.Deleted != 1 || result.Failed != 0 {
+		t.Errorf("应复制2个文件并删除1个文件: %+v %+v", report, result)
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "b.txt")); string(data) != "bbbb" {
+		t.Errorf("内容不同的文件应被修复: %q", data)
+	}
+	if info, _ := os.Stat(filepath.Join(destDir, "a.txt")); !os.SameFile(info, aInfo) {
+		t.Error("一致的文件不应被重写")
+	}
+	if report, err := fs.Verify(); err != nil || !report.OK() {
+		t.Errorf("修复后校验应通过: %+v %v", report, err)
+	}
+
+	bidirectional := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Bidirectional: true})
+	if _, err := bidirectional.Repair(); err == nil {
+		t.Error("双向同步不应支持Repair")
+	}
+}
+
+func TestVerifyEncryptedTarget(t *testing.T) {
+	sourceDir, remoteDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("payload"), 1000)
+	os.WriteFile(filepath.Join(sourceDir, "data.bin"), content, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "note.txt"), []byte("note"), 0644)
+
+	config := &SyncConfig{
+		SourceDir:  sourceDir,
+		Target:     &LocalProvider{Root: remoteDir},
+		Encryption: &EncryptionConfig{Key: bytes.Repeat([]byte{5}, encKeySize)},
+	}
+	fs := NewFileSync(config)
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := fs.Verify(); err != nil || !report.OK() || report.Matched != 2 {
+		t.Fatalf("同步后校验应通过: %+v %v", report, err)
+	}
+
+	// 密文被篡改后无法解密
+	encPath := filepath.Join(remoteDir, "data.bin")
+	data, _ := os.ReadFile(encPath)
+	data[len(data)/2] ^= 0xff
+	os.WriteFile(encPath, data, 0644)
+	report, err := fs.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != VerifyUnreadable || report.Issues[0].Error == "" {
+		t.Fatalf("被篡改的文件应报告为无法读取: %+v", report)
+	}
+
+	if _, err := fs.Repair(); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := fs.Verify(); err != nil || !report.OK() {
+		t.Errorf("修复后校验应通过: %+v %v", report, err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultWatchDebounce 监听模式下合并文件事件的默认等待时间，同一文件的连续写入只同步一次
+const DefaultWatchDebounce = 200 * time.Millisecond
+
+// pollWatchInterval 无法使用系统事件通知时，元数据轮询的间隔
+const pollWatchInterval = time.Second
+
+// fileWatcher 源目录的变更通知，Events返回发生变化的文件或目录的绝对路径。
+// 通知丢失（如事件队列溢出）时发送根目录，表示需要全量同步
+type fileWatcher interface {
+	Events() <-chan string
+	Close() error
+}
+
+// watch 监听模式：先全量同步一次，之后只同步发生变化的路径，并按SyncInterval定期全量校验
+func (fs *FileSync) watch() {
+	watcher, err := newFileWatcher(fs.config.SourceDir)
+	if err != nil {
+		log.Printf("启动目录监听失败，改为轮询文件元数据: %v", err)
+		watcher = newPollWatcher(fs.config.SourceDir, pollWatchInterval)
+	}
+	defer watcher.Close()
+	fmt.Printf("文件同步器已启动（监听模式），全量校验间隔: %v\n", fs.config.SyncInterval)
+
+	// 先开始监听再做初始同步，初始同步期间的变更不会丢失
+	if err := fs.Sync(); err != nil {
+		log.Printf("初始同步失败: %v", err)
+	}
+	retry := fs.retryAfter()
+
+	var reconcile <-chan time.Time
+	if fs.config.SyncInterval > 0 {
+		ticker := time.NewTicker(fs.config.SyncInterval)
+		defer ticker.Stop()
+		reconcile = ticker.C
+	}
+	debounce := fs.config.WatchDebounce
+	if debounce <= 0 {
+		debounce = DefaultWatchDebounce
+	}
+
+	events := watcher.Events()
+	pending := make(map[string]bool)
+	var flush <-chan time.Time
+	for {
+		select {
+		case path, ok := <-events:
+			if !ok {
+				log.Printf("目录监听已关闭，改为轮询文件元数据")
+				watcher = newPollWatcher(fs.config.SourceDir, pollWatchInterval)
+				defer watcher.Close()
+				events = watcher.Events()
+				continue
+			}
+			relPath, err := filepath.Rel(fs.config.SourceDir, path)
+			if err != nil {
+				continue
+			}
+			pending[relPath] = true
+			if flush == nil {
+				flush = time.After(debounce)
+			}
+		case <-flush:
+			// 暂停期间保留收到的事件，恢复后再同步
+			if fs.Paused() {
+				flush = time.After(debounce)
+				continue
+			}
+			flush = nil
+			paths := make([]string, 0, len(pending))
+			for relPath := range pending {
+				paths = append(paths, relPath)
+			}
+			pending = make(map[string]bool)
+			if err := fs.SyncPaths(paths); err != nil {
+				log.Printf("增量同步失败: %v", err)
+			}
+			if retry == nil {
+				retry = fs.retryAfter()
+			}
+		case <-reconcile:
+			if fs.Paused() {
+				continue
+			}
+			// 全量同步覆盖了所有尚未处理的事件
+			flush = nil
+			pending = make(map[string]bool)
+			if err := fs.Sync(); err != nil {
+				log.Printf("全量校验失败: %v", err)
+			}
+			retry = fs.retryAfter()
+		case <-retry:
+			// 推迟的文件可能不再产生事件，全量同步一次
+			if err := fs.Sync(); err != nil {
+				log.Printf("重试同步失败: %v", err)
+			}
+			retry = fs.retryAfter()
+		case <-fs.stopChan:
+			fmt.Println("文件同步器已停止")
+			return
+		}
+	}
+}
+
+// SyncPaths 只同步源目录中指定的相对路径，路径可以是文件或目录。
+// 源目录中已不存在的路径按DeleteExtra删除目标目录中的对应文件；包含根目录、双向同步、远端目标或归档时执行全量同步。
+// 增量同步不重写校验清单，清单在下一次全量同步时更新
+func (fs *FileSync) SyncPaths(relPaths []string) error {
+	// 双向同步依赖两侧的完整状态，远端目标需要列出远端文件，归档需要整体重写，都总是全量同步
+	if fs.config.Bidirectional || fs.storage != nil || fs.config.Archive != "" {
+		return fs.Sync()
+	}
+	for _, relPath := range relPaths {
+		if relPath == "." || relPath == "" {
+			return fs.Sync()
+		}
+	}
+
+	_, err := fs.record(func(result *RunResult) error {
+		actions, srcFiles, err := fs.planPaths(relPaths)
+		if err != nil {
+			return err
+		}
+		fs.execute(actions, srcFiles, result)
+		fmt.Printf("增量同步完成，%d个路径有变更\n", len(relPaths))
+		return nil
+	})
+	return err
+}
+
+// planPaths 计算指定路径的同步操作，只计算这些路径下文件的哈希
+func (fs *FileSync) planPaths(relPaths []string) ([]SyncAction, map[string]*FileInfo, error) {
+	srcFiles := make(map[string]*FileInfo)
+	destFiles := make(map[string]*FileInfo)
+	var srcDirs, destDirs map[string]*FileInfo
+	if fs.preservesDirs() {
+		srcDirs, destDirs = make(map[string]*FileInfo), make(map[string]*FileInfo)
+	}
+	for _, relPath := range relPaths {
+		relPath = filepath.Clean(relPath)
+		if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) || filepath.IsAbs(relPath) {
+			return nil, nil, fmt.Errorf("路径不在源目录中: %s", relPath)
+		}
+		if err := fs.statTree(fs.config.SourceDir, relPath, srcFiles, srcDirs); err != nil {
+			return nil, nil, fmt.Errorf("扫描源目录失败: %v", err)
+		}
+		if err := fs.statTree(fs.config.DestDir, relPath, destFiles, destDirs); err != nil {
+			return nil, nil, fmt.Errorf("扫描目标目录失败: %v", err)
+		}
+	}
+
+	var copies, deletes []SyncAction
+	for relPath, srcInfo := range srcFiles {
+		destInfo, exists := destFiles[relPath]
+		if exists && destInfo.Size == srcInfo.Size {
+			// 大小相同时才需要比较内容
+			srcHash, err := fs.contentHash(filepath.Join(fs.config.SourceDir, relPath), srcInfo)
+			if err != nil {
+				log.Printf("计算文件哈希失败 %s: %v", relPath, err)
+				continue
+			}
+			srcInfo.Hash = srcHash
+			destHash, err := fs.contentHash(filepath.Join(fs.config.DestDir, relPath), destInfo)
+			if err == nil && destHash == srcHash {
+				if fs.metadataDiffers(srcInfo, destInfo) {
+					copies = append(copies, SyncAction{Op: ActionAttrs, Path: relPath})
+				}
+				continue
+			}
+		}
+		copies = append(copies, SyncAction{Op: ActionCopy, Path: relPath, Size: srcInfo.Size})
+	}
+	if fs.config.DeleteExtra {
+		for relPath, destInfo := range destFiles {
+			if _, exists := srcFiles[relPath]; !exists {
+				deletes = append(deletes, SyncAction{Op: ActionDelete, Path: relPath, Size: destInfo.Size})
+			}
+		}
+	}
+
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Path < copies[j].Path })
+	sort.Slice(deletes, func(i, j int) bool { return deletes[i].Path < deletes[j].Path })
+	actions := append(copies, deletes...)
+	if srcDirs != nil {
+		actions = fs.planDirs(actions, srcDirs, destDirs)
+	}
+	return actions, srcFiles, nil
+}
+
+// statTree 收集dir下relPath（文件或目录）中的文件元数据，不计算哈希；路径不存在时不返回错误。
+// dirs不为nil时同时收集其中的目录
+func (fs *FileSync) statTree(dir, relPath string, files, dirs map[string]*FileInfo) error {
+	var dirFn func(string, os.FileInfo)
+	if dirs != nil {
+		dirFn = func(rel string, info os.FileInfo) {
+			if dirInfo, err := newFileInfo(filepath.Join(dir, rel), rel, info); err == nil {
+				dirs[rel] = dirInfo
+			}
+		}
+	}
+	return fs.walkTree(dir, filepath.Join(dir, relPath), true, dirFn, func(rel string, info os.FileInfo) {
+		if fileInfo, err := newFileInfo(filepath.Join(dir, rel), rel, info); err == nil {
+			files[rel] = fileInfo
+		}
+	})
+}
+
+// fileStat 轮询监听记录的文件元数据
+type fileStat struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// pollWatcher 定期遍历目录比较大小和修改时间，不读取文件内容。
+// 用于不支持系统事件通知的平台，以及系统监听数达到上限等情况
+type pollWatcher struct {
+	root     string
+	interval time.Duration
+	events   chan string
+	done     chan struct{}
+}
+
+func newPollWatcher(root string, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		root:     root,
+		interval: interval,
+		events:   make(chan string, 256),
+		done:     make(chan struct{}),
+	}
+	snapshot := w.snapshot()
+	go w.loop(snapshot)
+	return w
+}
+
+func (w *pollWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	close(w.done)
+	return nil
+}
+
+// snapshot 记录目录树中所有文件和目录的元数据，读取失败的条目被忽略
+func (w *pollWatcher) snapshot() map[string]fileStat {
+	stats := make(map[string]fileStat)
+	filepath.Walk(w.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		stats[path] = fileStat{size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir()}
+		return nil
+	})
+	return stats
+}
+
+func (w *pollWatcher) loop(previous map[string]fileStat) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+
+		current := w.snapshot()
+		var changed []string
+		for path, stat := range current {
+			old, exists := previous[path]
+			// 目录的修改时间随子项变化，子项本身会单独报告
+			if !exists || old.isDir != stat.isDir || (!stat.isDir && (old.size != stat.size || !old.modTime.Equal(stat.modTime))) {
+				changed = append(changed, path)
+			}
+		}
+		for path := range previous {
+			if _, exists := current[path]; !exists {
+				changed = append(changed, path)
+			}
+		}
+		previous = current
+
+		sort.Strings(changed)
+		for _, path := range changed {
+			select {
+			case w.events <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
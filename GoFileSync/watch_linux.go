@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask 需要关注的inotify事件：创建、写入、删除、移入移出和属性变化
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+// inotifyWatcher 基于Linux inotify的目录树监听。inotify不递归，每个子目录单独添加监听，
+// 新建或移入的目录在收到事件时补充监听
+type inotifyWatcher struct {
+	root   string
+	fd     int
+	file   *os.File // 非阻塞的fd交给运行时轮询，Close可以打断阻塞中的Read
+	mutex  sync.Mutex
+	dirs   map[int]string // 监听描述符 -> 目录
+	events chan string
+	done   chan struct{}
+}
+
+func newFileWatcher(root string) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{
+		root:   root,
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[int]string),
+		events: make(chan string, 256),
+		done:   make(chan struct{}),
+	}
+	if err := w.addTree(root); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.readLoop()
+	return w, nil
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+// addTree 为dir及其所有子目录添加监听
+func (w *inotifyWatcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// 遍历期间被删除的子目录不影响其余目录
+			if os.IsNotExist(err) && path != dir {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, inotifyMask)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch "+path, err)
+		}
+		w.mutex.Lock()
+		w.dirs[wd] = path
+		w.mutex.Unlock()
+		return nil
+	})
+}
+
+// readLoop 读取并解析inotify事件，直到Close
+func (w *inotifyWatcher) readLoop() {
+	defer close(w.events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + syscall.SizeofInotifyEvent
+			offset = start + int(event.Len)
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				// 事件队列溢出，无法知道哪些文件变化了
+				if !w.send(w.root) {
+					return
+				}
+				continue
+			}
+
+			w.mutex.Lock()
+			dir, exists := w.dirs[int(event.Wd)]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.dirs, int(event.Wd))
+			}
+			w.mutex.Unlock()
+			if !exists || name == "" {
+				continue
+			}
+
+			path := filepath.Join(dir, name)
+			if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				// 添加监听前已写入新目录的文件由对该目录的同步覆盖
+				w.addTree(path)
+			}
+			if !w.send(path) {
+				return
+			}
+		}
+	}
+}
+
+// send 发送变更路径，监听已关闭时返回false
+func (w *inotifyWatcher) send(path string) bool {
+	select {
+	case w.events <- path:
+		return true
+	case <-w.done:
+		return false
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// newFileWatcher 非Linux平台上使用元数据轮询代替系统事件通知
+func newFileWatcher(root string) (fileWatcher, error) {
+	return newPollWatcher(root, pollWatchInterval), nil
+}
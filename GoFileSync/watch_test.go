@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// waitForFile 等待目标文件的内容变为want，want为nil表示等待文件被删除
+func waitForFile(t *testing.T, path string, want []byte) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(path)
+		if want == nil && os.IsNotExist(err) {
+			return
+		}
+		if want != nil && err == nil && string(data) == string(want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("等待 %s 同步超时", path)
+}
+
+func TestSyncPaths(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "c.txt"), []byte("c"), 0644)
+
+	var results []*RunResult
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, DeleteExtra: true})
+	fs.onResult = func(result *RunResult) { results = append(results, result) }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改、新建子目录、删除，另有一个未变化的文件和一个不在列表中的修改
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("A"), 0644)
+	os.MkdirAll(filepath.Join(sourceDir, "sub", "deep"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "deep", "d.txt"), []byte("d"), 0644)
+	os.Remove(filepath.Join(sourceDir, "b.txt"))
+	os.WriteFile(filepath.Join(sourceDir, "c.txt"), []byte("C"), 0644)
+
+	if err := fs.SyncPaths([]string{"a.txt", "sub", "b.txt", "missing.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	last := results[len(results)-1]
+	if last.Copied != 2 || last.Deleted != 1 || last.Failed != 0 {
+		t.Errorf("增量同步结果不正确: %+v", last)
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "a.txt")); string(data) != "A" {
+		t.Errorf("a.txt 应被更新: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "sub", "deep", "d.txt")); err != nil {
+		t.Error("新目录中的文件应被复制")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "b.txt")); !os.IsNotExist(err) {
+		t.Error("b.txt 应被删除")
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "c.txt")); string(data) != "c" {
+		t.Error("不在路径列表中的文件不应被同步")
+	}
+
+	// 删除整个目录
+	os.RemoveAll(filepath.Join(sourceDir, "sub"))
+	fs.SyncPaths([]string{"sub"})
+	if _, err := os.Stat(filepath.Join(destDir, "sub", "deep", "d.txt")); !os.IsNotExist(err) {
+		t.Error("已删除目录中的文件应被删除")
+	}
+
+	// 包含根目录时执行全量同步
+	fs.SyncPaths([]string{"."})
+	if data, _ := os.ReadFile(filepath.Join(destDir, "c.txt")); string(data) != "C" {
+		t.Error("根目录应触发全量同步")
+	}
+	if err := fs.SyncPaths([]string{"../outside"}); err == nil {
+		t.Error("源目录之外的路径应返回错误")
+	}
+}
+
+func TestWatchModeSyncsChanges(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)
+
+	fs := NewFileSync(&SyncConfig{
+		SourceDir:     sourceDir,
+		DestDir:       destDir,
+		SyncInterval:  time.Hour,
+		DeleteExtra:   true,
+		Watch:         true,
+		WatchDebounce: 20 * time.Millisecond,
+	})
+	go fs.Start()
+	defer fs.Stop()
+
+	// 初始全量同步
+	waitForFile(t, filepath.Join(destDir, "a.txt"), []byte("a"))
+
+	// 远早于一小时的全量校验间隔，变更应通过事件同步
+	os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("changed"), 0644)
+	waitForFile(t, filepath.Join(destDir, "a.txt"), []byte("changed"))
+
+	os.MkdirAll(filepath.Join(sourceDir, "sub"), 0755)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "b.txt"), []byte("b"), 0644)
+	waitForFile(t, filepath.Join(destDir, "sub", "b.txt"), []byte("b"))
+
+	// 新目录创建后写入的文件同样被监听
+	time.Sleep(50 * time.Millisecond)
+	os.WriteFile(filepath.Join(sourceDir, "sub", "c.txt"), []byte("c"), 0644)
+	waitForFile(t, filepath.Join(destDir, "sub", "c.txt"), []byte("c"))
+
+	os.Remove(filepath.Join(sourceDir, "a.txt"))
+	waitForFile(t, filepath.Join(destDir, "a.txt"), nil)
+}
+
+func TestPollWatcherReportsChanges(t *testing.T) {
+	sourceDir, _, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	os.WriteFile(filepath.Join(sourceDir, "same.txt"), []byte("same"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "old.txt"), []byte("old"), 0644)
+
+	w := newPollWatcher(sourceDir, 20*time.Millisecond)
+	defer w.Close()
+
+	os.WriteFile(filepath.Join(sourceDir, "old.txt"), []byte("modified"), 0644)
+	os.WriteFile(filepath.Join(sourceDir, "new.txt"), []byte("new"), 0644)
+	os.Remove(filepath.Join(sourceDir, "same.txt"))
+	os.WriteFile(filepath.Join(sourceDir, "same.txt"), []byte("same"), 0644)
+	os.Chtimes(filepath.Join(sourceDir, "same.txt"), time.Now(), time.Now().Add(-time.Hour))
+
+	seen := make(map[string]bool)
+	timeout := time.After(2 * time.Second)
+	for len(seen) < 3 {
+		select {
+		case path := <-w.Events():
+			rel, _ := filepath.Rel(sourceDir, path)
+			seen[rel] = true
+		case <-timeout:
+			t.Fatalf("等待变更事件超时: %v", seen)
+		}
+	}
+
+	var got []string
+	for rel := range seen {
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	if len(got) != 3 || got[0] != "new.txt" || got[1] != "old.txt" || got[2] != "same.txt" {
+		t.Errorf("变更事件不正确: %v", got)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// parallel 用最多workers个协程对0..n-1调用fn，全部完成后返回。workers<=1时在当前协程顺序执行
+func parallel(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// rateLimiter 按字节数限速，多个协程共用时限制的是合计速率
+type rateLimiter struct {
+	rate  int64 // 字节/秒
+	mutex sync.Mutex
+	next  time.Time // 已预约的传输在此时刻之前完成
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	return &rateLimiter{rate: bytesPerSecond}
+}
+
+// wait 预约n字节的传输时间，在轮到本次传输之前阻塞
+func (l *rateLimiter) wait(n int) {
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	l.mutex.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// throttledReader 每次读取后按读到的字节数限速
+type throttledReader struct {
+	reader  io.Reader
+	limiter *rateLimiter
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	// 单次读取不超过一秒的配额，避免大缓冲区造成长时间的突发
+	if int64(len(p)) > r.limiter.rate {
+		p = p[:r.limiter.rate]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
+
+// throttle 配置了BandwidthLimit时返回限速的reader
+func (fs *FileSync) throttle(reader io.Reader) io.Reader {
+	if fs.limiter == nil {
+		return reader
+	}
+	return &throttledReader{reader: reader, limiter: fs.limiter}
+}
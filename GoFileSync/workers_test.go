@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParallelSync(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	for i := 0; i < 40; i++ {
+		dir := filepath.Join(sourceDir, fmt.Sprintf("d%d", i%4))
+		os.MkdirAll(dir, 0755)
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%02d.txt", i)), []byte(strings.Repeat("x", i)), 0644)
+	}
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Workers: 8})
+	var events []ProgressEvent
+	var result *RunResult
+	fs.onProgress = func(event ProgressEvent) { events = append(events, event) }
+	fs.onResult = func(r *RunResult) { result = r }
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Copied != 40 || result.Failed != 0 || result.BytesCopied != 780 {
+		t.Errorf("并发同步结果不正确: %+v", result)
+	}
+	// 文件事件的Done按完成顺序递增
+	done := 0
+	for _, event := range events {
+		if event.Type == EventFile {
+			done++
+			if event.Done != done {
+				t.Fatalf("进度计数不连续: 期望%d，实际%d", done, event.Done)
+			}
+		}
+	}
+	if done != 40 {
+		t.Errorf("期望40个文件事件，实际%d", done)
+	}
+
+	// 并发计算哈希后第二次同步没有需要复制的文件
+	if actions, _ := fs.Plan(); len(actions) != 0 {
+		t.Errorf("同步后不应再有操作: %+v", actions)
+	}
+}
+
+func TestParallelCollectsFileErrors(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	// 目标目录中与源目录子目录同名的文件使其中的文件复制失败
+	for _, dir := range []string{"bad1", "bad2", "good"} {
+		os.MkdirAll(filepath.Join(sourceDir, dir), 0755)
+		os.WriteFile(filepath.Join(sourceDir, dir, "a.txt"), []byte(dir), 0644)
+		os.WriteFile(filepath.Join(sourceDir, dir, "b.txt"), []byte(dir), 0644)
+	}
+	os.WriteFile(filepath.Join(destDir, "bad1"), []byte("file"), 0644)
+	os.WriteFile(filepath.Join(destDir, "bad2"), []byte("file"), 0644)
+
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Workers: 4})
+	var result *RunResult
+	fs.onResult = func(r *RunResult) { result = r }
+	fs.Sync()
+
+	if result.Copied != 2 || result.Failed != 4 || len(result.Errors) != 4 {
+		t.Fatalf("应收集每个失败文件的错误: %+v", result)
+	}
+	if !strings.Contains(result.Errors[0], "bad1") || !strings.Contains(result.Errors[3], "bad2") {
+		t.Errorf("错误列表应按内容排序: %v", result.Errors)
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "good", "b.txt")); string(data) != "good" {
+		t.Error("其他文件的复制不应受失败影响")
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	sourceDir, destDir, cleanup := setupTestDirs(t)
+	defer cleanup()
+
+	content := bytes.Repeat([]byte("0123456789"), 10*1024)
+	os.WriteFile(filepath.Join(sourceDir, "a.bin"), content, 0644)
+	os.WriteFile(filepath.Join(sourceDir, "b.bin"), content, 0644)
+
+	// 两个文件共200KB，合计限速500KB/s，两个协程并发也至少需要约0.3秒
+	fs := NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Workers: 2, BandwidthLimit: 500 * 1024})
+	start := time.Now()
+	if err := fs.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("限速未生效，耗时%v", elapsed)
+	}
+	if data, _ := os.ReadFile(filepath.Join(destDir, "b.bin")); !bytes.Equal(data, content) {
+		t.Error("限速复制的内容不正确")
+	}
+
+	// 不限速时很快完成
+	os.RemoveAll(destDir)
+	start = time.Now()
+	NewFileSync(&SyncConfig{SourceDir: sourceDir, DestDir: destDir, Workers: 2}).Sync()
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Errorf("未限速的同步过慢: %v", elapsed)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 聚合的默认配置
+const (
+	DefaultAggregateWindow    = time.Minute
+	DefaultAggregateRetention = 60
+	DefaultMaxGroups          = 1000
+	DefaultTopK               = 10
+)
+
+// AggregateConfig 窗口聚合配置
+type AggregateConfig struct {
+	Window      time.Duration // 窗口长度，如time.Minute、time.Hour，<=0时为DefaultAggregateWindow
+	Retention   int           // 保留最近的多少个窗口，<=0时为DefaultAggregateRetention
+	GroupBy     []string      // 分组字段："tenant"、"level"、"source"或Fields中的字段，为空时按level分组
+	ErrorLevels []string      // 计入错误消息排行的级别，为空时为ERROR
+	MaxGroups   int           // 每个窗口最多的分组数和消息模式数，超出的计入 "_other"，<=0时为DefaultMaxGroups
+}
+
+// GroupCount 一个分组的日志条数
+type GroupCount struct {
+	Labels map[string]string `json:"labels"`
+	Count  int64             `json:"count"`
+}
+
+// MessageCount 一种错误消息的次数，消息中的数字被替换为#后作为模式
+type MessageCount struct {
+	Pattern string `json:"pattern"`
+	Example string `json:"example"` // 第一次出现时的原始消息
+	Count   int64  `json:"count"`
+}
+
+// Summary 一段时间内的汇总
+type Summary struct {
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Total     int64          `json:"total"`
+	Groups    []GroupCount   `json:"groups"`     // 按条数从多到少
+	TopErrors []MessageCount `json:"top_errors"` // 最常见的错误消息
+}
+
+// Text 汇总的可读描述
+func (s Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[汇总] %s ~ %s 共%d条日志\n", s.From.Format("2006-01-02 15:04"), s.To.Format("2006-01-02 15:04"), s.Total)
+	for _, group := range s.Groups {
+		labels := make([]string, 0, len(group.Labels))
+		for name, value := range group.Labels {
+			labels = append(labels, name+"="+value)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(&b, "  %s: %d\n", strings.Join(labels, " "), group.Count)
+	}
+	if len(s.TopErrors) > 0 {
+		b.WriteString("  最常见的错误:\n")
+		for i, message := range s.TopErrors {
+			fmt.Fprintf(&b, "  %d. %s (%d次)\n", i+1, message.Example, message.Count)
+		}
+	}
+	return b.String()
+}
+
+// digitsPattern 消息中的数字，替换后同类的错误归为一种模式
+var digitsPattern = regexp.MustCompile(`\d+`)
+
+// aggregateWindow 一个窗口内的计数
+type aggregateWindow struct {
+	total    int64
+	groups   map[string]int64
+	errors   map[string]int64
+	examples map[string]string
+}
+
+// Aggregator 按时间窗口（以日志时间对齐）统计各分组的日志条数和最常见的错误消息，
+// 只保留最近Retention个窗口，内存不随运行时间增长。实现了Sink接口
+type Aggregator struct {
+	config      AggregateConfig
+	groupBy     []string
+	errorLevels map[string]bool
+	windows     map[time.Time]*aggregateWindow
+	latest      time.Time
+	late        int64
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+// NewAggregator 创建窗口聚合器
+func NewAggregator(config AggregateConfig) *Aggregator {
+	if config.Window <= 0 {
+		config.Window = DefaultAggregateWindow
+	}
+	if config.Retention <= 0 {
+		config.Retention = DefaultAggregateRetention
+	}
+	if config.MaxGroups <= 0 {
+		config.MaxGroups = DefaultMaxGroups
+	}
+	groupBy := config.GroupBy
+	if len(groupBy) == 0 {
+		groupBy = []string{"level"}
+	}
+	levels := config.ErrorLevels
+	if len(levels) == 0 {
+		levels = []string{"ERROR"}
+	}
+	a := &Aggregator{
+		config:      config,
+		groupBy:     groupBy,
+		errorLevels: make(map[string]bool),
+		windows:     make(map[time.Time]*aggregateWindow),
+		now:         time.Now,
+	}
+	for _, level := range levels {
+		a.errorLevels[strings.ToUpper(level)] = true
+	}
+	return a
+}
+
+// Write 实现Sink接口，把日志计入所在的窗口。没有时间的日志按当前时间计，
+// 早于保留范围的日志只计入Late
+func (a *Aggregator) Write(entry LogEntry) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	timestamp := entry.Timestamp
+	if timestamp.IsZero() {
+		timestamp = a.now()
+	}
+	start := timestamp.Truncate(a.config.Window)
+	if start.After(a.latest) {
+		a.latest = start
+		a.expire()
+	}
+	if !start.After(a.latest.Add(-time.Duration(a.config.Retention) * a.config.Window)) {
+		a.late++
+		return nil
+	}
+
+	window, exists := a.windows[start]
+	if !exists {
+		window = &aggregateWindow{groups: make(map[string]int64), errors: make(map[string]int64), examples: make(map[string]string)}
+		a.windows[start] = window
+	}
+	window.total++
+
+	values := make([]string, len(a.groupBy))
+	for i, field := range a.groupBy {
+		values[i] = entryValue(entry, field)
+	}
+	window.groups[a.limitKey(window.groups, strings.Join(values, "\x00"))]++
+
+	if a.errorLevels[strings.ToUpper(entry.Level)] {
+		pattern := a.limitKey(window.errors, digitsPattern.ReplaceAllString(entry.Message, "#"))
+		if _, exists := window.examples[pattern]; !exists {
+			window.examples[pattern] = entry.Message
+		}
+		window.errors[pattern]++
+	}
+	return nil
+}
+
+// limitKey 窗口内的key超过MaxGroups时，新key计入overflowKey
+func (a *Aggregator) limitKey(counts map[string]int64, key string) string {
+	if _, exists := counts[key]; !exists && len(counts) >= a.config.MaxGroups {
+		return overflowKey
+	}
+	return key
+}
+
+// expire 删除超出保留范围的窗口，调用方需持有mutex
+func (a *Aggregator) expire() {
+	cutoff := a.latest.Add(-time.Duration(a.config.Retention) * a.config.Window)
+	for start := range a.windows {
+		if !start.After(cutoff) {
+			delete(a.windows, start)
+		}
+	}
+}
+
+// Late 返回因早于保留范围而没有计入的日志条数
+func (a *Aggregator) Late() int64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.late
+}
+
+// Summary 汇总开始时间在[from, to)内的窗口，零值时间表示不限制，topK<=0时为DefaultTopK
+func (a *Aggregator) Summary(from, to time.Time, topK int) Summary {
+	if topK <= 0 {
+		topK = DefaultTopK
+	}
+	a.mutex.Lock()
+	var starts []time.Time
+	for start := range a.windows {
+		if (from.IsZero() || !start.Before(from)) && (to.IsZero() || start.Before(to)) {
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	summary := Summary{From: from, To: to}
+	groups := make(map[string]int64)
+	errors := make(map[string]int64)
+	examples := make(map[string]string)
+	for _, start := range starts {
+		window := a.windows[start]
+		summary.Total += window.total
+		for key, n := range window.groups {
+			groups[key] += n
+		}
+		for pattern, n := range window.errors {
+			if _, exists := examples[pattern]; !exists {
+				examples[pattern] = window.examples[pattern]
+			}
+			errors[pattern] += n
+		}
+	}
+	a.mutex.Unlock()
+
+	if len(starts) > 0 && summary.From.IsZero() {
+		summary.From = starts[0]
+	}
+	if len(starts) > 0 && summary.To.IsZero() {
+		summary.To = starts[len(starts)-1].Add(a.config.Window)
+	}
+	for key, n := range groups {
+		labels := make(map[string]string, len(a.groupBy))
+		if key == overflowKey {
+			labels[a.groupBy[0]] = overflowKey
+		} else {
+			for i, value := range strings.Split(key, "\x00") {
+				labels[a.groupBy[i]] = value
+			}
+		}
+		summary.Groups = append(summary.Groups, GroupCount{Labels: labels, Count: n})
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		if summary.Groups[i].Count != summary.Groups[j].Count {
+			return summary.Groups[i].Count > summary.Groups[j].Count
+		}
+		return fmt.Sprint(summary.Groups[i].Labels) < fmt.Sprint(summary.Groups[j].Labels)
+	})
+	for pattern, n := range errors {
+		summary.TopErrors = append(summary.TopErrors, MessageCount{Pattern: pattern, Example: examples[pattern], Count: n})
+	}
+	sort.Slice(summary.TopErrors, func(i, j int) bool {
+		if (summary.TopErrors[i].Pattern == overflowKey) != (summary.TopErrors[j].Pattern == overflowKey) {
+			return summary.TopErrors[j].Pattern == overflowKey // 超出上限的合计排在最后
+		}
+		if summary.TopErrors[i].Count != summary.TopErrors[j].Count {
+			return summary.TopErrors[i].Count > summary.TopErrors[j].Count
+		}
+		return summary.TopErrors[i].Pattern < summary.TopErrors[j].Pattern
+	})
+	if len(summary.TopErrors) > topK {
+		summary.TopErrors = summary.TopErrors[:topK]
+	}
+	return summary
+}
+
+// RunSummaries 每隔every汇总一次上一个周期[t-every, t)的窗口并交给emit，直到ctx结束。
+// 周期按every对齐（如每小时整点），every应是Window的整数倍
+func (a *Aggregator) RunSummaries(ctx context.Context, every time.Duration, topK int, emit func(Summary)) {
+	for {
+		now := a.now()
+		next := now.Truncate(every).Add(every)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			emit(a.Summary(next.Add(-every), next, topK))
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAggregatorWindowsAndGroups(t *testing.T) {
+	aggregator := NewAggregator(AggregateConfig{Window: time.Minute, Retention: 3, GroupBy: []string{"level", "source"}})
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	write := func(minute int, level, source string) {
+		aggregator.Write(LogEntry{Timestamp: base.Add(time.Duration(minute)*time.Minute + 30*time.Second), Level: level, Message: "x", Fields: map[string]string{"source": source}})
+	}
+	for _, minute := range []int{0, 0, 1, 1, 1, 2} {
+		write(minute, "INFO", "api")
+	}
+	write(1, "ERROR", "api")
+	write(2, "ERROR", "db")
+
+	summary := aggregator.Summary(base.Add(time.Minute), base.Add(3*time.Minute), 0)
+	if summary.Total != 6 || len(summary.Groups) != 3 {
+		t.Fatalf("第1、2分钟应有6条、3个分组: %+v", summary)
+	}
+	top := summary.Groups[0]
+	if top.Count != 4 || top.Labels["level"] != "INFO" || top.Labels["source"] != "api" {
+		t.Errorf("分组应按条数从多到少: %+v", summary.Groups)
+	}
+
+	// 只保留最近3个窗口，更早的窗口被删除，迟到的日志只计入Late
+	write(3, "INFO", "api")
+	write(0, "INFO", "api")
+	if all := aggregator.Summary(time.Time{}, time.Time{}, 0); all.Total != 7 || !all.From.Equal(base.Add(time.Minute)) || !all.To.Equal(base.Add(4*time.Minute)) {
+		t.Errorf("应只剩第1到3分钟的窗口: %d条 %v ~ %v", all.Total, all.From, all.To)
+	}
+	if aggregator.Late() != 1 {
+		t.Errorf("迟到的日志应计入Late: %d", aggregator.Late())
+	}
+}
+
+func TestAggregatorTopErrors(t *testing.T) {
+	aggregator := NewAggregator(AggregateConfig{Window: time.Hour, MaxGroups: 3})
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	messages := []string{
+		"连接 10.0.0.1:5432 超时", "连接 10.0.0.2:5432 超时", "连接 10.0.0.1:5432 超时",
+		"订单 1001 支付失败", "订单 1002 支付失败",
+		"磁盘已满", "内存不足", "证书过期",
+	}
+	for i, message := range messages {
+		aggregator.Write(LogEntry{Timestamp: base.Add(time.Duration(i) * time.Minute), Level: "error", Message: message})
+	}
+	aggregator.Write(LogEntry{Timestamp: base, Level: "INFO", Message: "连接 10.0.0.3:5432 超时"})
+
+	summary := aggregator.Summary(time.Time{}, time.Time{}, 2)
+	if len(summary.TopErrors) != 2 {
+		t.Fatalf("应只返回前2种错误: %+v", summary.TopErrors)
+	}
+	first, second := summary.TopErrors[0], summary.TopErrors[1]
+	if first.Count != 3 || first.Pattern != "连接 #.#.#.#:# 超时" || first.Example != "连接 10.0.0.1:5432 超时" {
+		t.Errorf("数字不同的同类错误应归为一种: %+v", first)
+	}
+	if second.Count != 2 || second.Example != "订单 1001 支付失败" {
+		t.Errorf("第二多的错误不正确: %+v", second)
+	}
+
+	// 超出MaxGroups的消息模式计入_other
+	all := aggregator.Summary(time.Time{}, time.Time{}, 10)
+	if last := all.TopErrors[len(all.TopErrors)-1]; len(all.TopErrors) != 4 || last.Pattern != overflowKey || last.Count != 2 {
+		t.Errorf("超出上限的消息应计入%s: %+v", overflowKey, all.TopErrors)
+	}
+	if text := summary.Text(); !strings.Contains(text, "共9条日志") || !strings.Contains(text, "1. 连接 10.0.0.1:5432 超时 (3次)") {
+		t.Errorf("汇总文本不正确:\n%s", text)
+	}
+}
+
+func TestAggregatorScheduledSummaries(t *testing.T) {
+	aggregator := NewAggregator(AggregateConfig{Window: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	summaries := make(chan Summary, 100)
+	go aggregator.RunSummaries(ctx, 50*time.Millisecond, 5, func(summary Summary) {
+		summaries <- summary
+	})
+	for i := 0; i < 3; i++ {
+		aggregator.Write(LogEntry{Timestamp: time.Now(), Level: "ERROR", Message: "失败"})
+	}
+
+	var total int64
+	deadline := time.After(2 * time.Second)
+	for total < 3 {
+		select {
+		case summary := <-summaries:
+			if summary.To.Sub(summary.From) != 50*time.Millisecond || summary.To.Truncate(50*time.Millisecond) != summary.To {
+				t.Fatalf("汇总周期应按间隔对齐: %v ~ %v", summary.From, summary.To)
+			}
+			total += summary.Total
+		case <-deadline:
+			t.Fatalf("定时汇总应包含写入的3条日志，实际%d条", total)
+		}
+	}
+	if total != 3 {
+		t.Errorf("每条日志只应出现在一个周期的汇总中: %d", total)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAlertCooldown 同一规则（同一分组）两次通知之间的默认间隔
+const DefaultAlertCooldown = 5 * time.Minute
+
+// AlertRule 告警规则：Window内匹配的日志超过Threshold条时触发。
+// Threshold为0时每条匹配的日志都满足条件，适合"消息匹配某个正则"这类规则
+type AlertRule struct {
+	Name      string
+	Levels    []string      // 匹配任一级别，不区分大小写，为空表示全部级别
+	Pattern   string        // 消息需要匹配的正则表达式，为空表示不限制
+	Threshold int           // 窗口内超过多少条时触发
+	Window    time.Duration // 计数的滑动窗口，Threshold>0时必须设置
+	GroupBy   string        // 按"tenant"、"level"或Fields中的字段分别计数和去重，为空表示不分组
+	Cooldown  time.Duration // 触发后多久内不再通知，0时为DefaultAlertCooldown，<0表示不去重
+}
+
+// Alert 一次触发的告警
+type Alert struct {
+	Rule       string        `json:"rule"`
+	Group      string        `json:"group,omitempty"`
+	Count      int           `json:"count"`  // 触发时窗口内匹配的条数
+	Window     time.Duration `json:"window"` // 规则的窗口
+	FiredAt    time.Time     `json:"fired_at"`
+	Sample     LogEntry      `json:"sample"`     // 触发告警的那条日志
+	Suppressed int           `json:"suppressed"` // 上次通知后因冷却被抑制的触发次数
+}
+
+// Text 告警的可读描述
+func (a Alert) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[告警] %s", a.Rule)
+	if a.Group != "" {
+		fmt.Fprintf(&b, " (%s)", a.Group)
+	}
+	if a.Window > 0 {
+		fmt.Fprintf(&b, ": %v内%d条日志", a.Window, a.Count)
+	}
+	fmt.Fprintf(&b, ", 示例: [%s] %s", a.Sample.Level, a.Sample.Message)
+	if a.Suppressed > 0 {
+		fmt.Fprintf(&b, " (冷却期间抑制%d次)", a.Suppressed)
+	}
+	return b.String()
+}
+
+// Notifier 告警通知渠道
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// alertRule 编译后的规则
+type alertRule struct {
+	AlertRule
+	pattern *regexp.Regexp
+	levels  map[string]bool
+}
+
+func (r *alertRule) matches(entry LogEntry) bool {
+	if len(r.levels) > 0 && !r.levels[strings.ToUpper(entry.Level)] {
+		return false
+	}
+	return r.pattern == nil || r.pattern.MatchString(entry.Message)
+}
+
+// alertKey 规则和分组，计数和冷却按它分别记录
+type alertKey struct {
+	rule  string
+	group string
+}
+
+// alertState 规则在某个分组下的滑动窗口和冷却状态
+type alertState struct {
+	hits       []time.Time
+	lastFired  time.Time
+	suppressed int
+}
+
+// Alerter 按规则检查日志并通知。实现了Sink接口，可以作为Pipeline或租户的输出。
+// 窗口按接收日志的时间计算，回放历史日志时不会按日志时间触发
+type Alerter struct {
+	rules     []*alertRule
+	notifiers []Notifier
+	state     map[alertKey]*alertState
+	mutex     sync.Mutex
+	now       func() time.Time
+}
+
+// NewAlerter 创建告警器，触发的告警发送给所有notifiers
+func NewAlerter(notifiers ...Notifier) *Alerter {
+	return &Alerter{
+		notifiers: notifiers,
+		state:     make(map[alertKey]*alertState),
+		now:       time.Now,
+	}
+}
+
+// AddRule 添加规则，规则名不能重复
+func (a *Alerter) AddRule(rule AlertRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("规则名不能为空")
+	}
+	if rule.Threshold < 0 || (rule.Threshold > 0 && rule.Window <= 0) {
+		return fmt.Errorf("规则 %s 的阈值需要大于0的窗口", rule.Name)
+	}
+	if rule.Cooldown == 0 {
+		rule.Cooldown = DefaultAlertCooldown
+	}
+	compiled := &alertRule{AlertRule: rule, levels: make(map[string]bool)}
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("规则 %s 的正则无效: %v", rule.Name, err)
+		}
+		compiled.pattern = re
+	}
+	for _, level := range rule.Levels {
+		compiled.levels[strings.ToUpper(level)] = true
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, existing := range a.rules {
+		if existing.Name == rule.Name {
+			return fmt.Errorf("规则 %s 已存在", rule.Name)
+		}
+	}
+	a.rules = append(a.rules, compiled)
+	return nil
+}
+
+// Observe 用一条日志检查所有规则，通知并返回这次触发的告警
+func (a *Alerter) Observe(entry LogEntry) ([]Alert, error) {
+	a.mutex.Lock()
+	now := a.now()
+	var alerts []Alert
+	for _, rule := range a.rules {
+		if !rule.matches(entry) {
+			continue
+		}
+		key := alertKey{rule: rule.Name, group: entryValue(entry, rule.GroupBy)}
+		state, exists := a.state[key]
+		if !exists {
+			state = &alertState{}
+			a.state[key] = state
+		}
+
+		// 去掉窗口之外的记录
+		state.hits = append(state.hits, now)
+		if rule.Window > 0 {
+			cutoff := now.Add(-rule.Window)
+			expired := 0
+			for expired < len(state.hits) && !state.hits[expired].After(cutoff) {
+				expired++
+			}
+			state.hits = state.hits[expired:]
+		}
+		if len(state.hits) <= rule.Threshold {
+			continue
+		}
+
+		count := len(state.hits)
+		state.hits = nil
+		if rule.Cooldown > 0 && !state.lastFired.IsZero() && now.Sub(state.lastFired) < rule.Cooldown {
+			state.suppressed++
+			continue
+		}
+		alerts = append(alerts, Alert{
+			Rule:       rule.Name,
+			Group:      key.group,
+			Count:      count,
+			Window:     rule.Window,
+			FiredAt:    now,
+			Sample:     entry,
+			Suppressed: state.suppressed,
+		})
+		state.lastFired = now
+		state.suppressed = 0
+	}
+	a.mutex.Unlock()
+
+	// 在锁外通知，慢的通知渠道不阻塞其他日志的检查
+	var errs []error
+	for _, alert := range alerts {
+		for _, notifier := range a.notifiers {
+			if err := notifier.Notify(alert); err != nil {
+				errs = append(errs, fmt.Errorf("告警 %s 通知失败: %v", alert.Rule, err))
+			}
+		}
+	}
+	return alerts, errors.Join(errs...)
+}
+
+// Write 实现Sink接口，返回通知失败的错误
+func (a *Alerter) Write(entry LogEntry) error {
+	_, err := a.Observe(entry)
+	return err
+}
+
+// entryValue 返回日志中"tenant"、"level"或Fields中对应字段的值，field为空时返回空字符串
+func entryValue(entry LogEntry, field string) string {
+	switch field {
+	case "":
+		return ""
+	case "tenant":
+		return entry.Tenant
+	case "level":
+		return entry.Level
+	default:
+		return entry.Fields[field]
+	}
+}
+
+// StdoutNotifier 把告警打印到Writer，Writer为nil时打印到标准输出
+type StdoutNotifier struct {
+	Writer io.Writer
+}
+
+// Notify 实现Notifier接口
+func (n *StdoutNotifier) Notify(alert Alert) error {
+	w := n.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", alert.FiredAt.Format(time.RFC3339), alert.Text())
+	return err
+}
+
+// WebhookNotifier 以JSON POST告警到URL
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // 为nil时使用http.DefaultClient
+}
+
+// Notify 实现Notifier接口，请求体为Alert的JSON加上可读的text字段
+func (n *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(struct {
+		Alert
+		Text string `json:"text"`
+	}{alert, alert.Text()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = doRequest(n.Client, req)
+	return err
+}
+
+// EmailNotifier 通过SMTP发送告警邮件
+type EmailNotifier struct {
+	Addr string    // SMTP服务器，如 smtp.example.com:587
+	Auth smtp.Auth // 为nil时不认证，如 smtp.PlainAuth("", user, password, host)
+	From string
+	To   []string
+
+	send func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error // 测试时替换smtp.SendMail
+}
+
+// message 生成邮件内容，标题按RFC 2047编码
+func (n *EmailNotifier) message(alert Alert) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(n.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[日志告警] "+alert.Rule))
+	fmt.Fprintf(&b, "Date: %s\r\n", alert.FiredAt.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(alert.Text())
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// Notify 实现Notifier接口
+func (n *EmailNotifier) Notify(alert Alert) error {
+	send := n.send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return send(n.Addr, n.Auth, n.From, n.To, n.message(alert))
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingNotifier 记录收到的告警的测试用通知渠道
+type recordingNotifier struct {
+	alerts []Alert
+	err    error
+}
+
+func (rn *recordingNotifier) Notify(alert Alert) error {
+	rn.alerts = append(rn.alerts, alert)
+	return rn.err
+}
+
+func TestAlertRateRuleAndCooldown(t *testing.T) {
+	notifier := &recordingNotifier{}
+	alerter := NewAlerter(notifier)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	alerter.now = func() time.Time { return now }
+	if err := alerter.AddRule(AlertRule{Name: "error-burst", Levels: []string{"error"}, Threshold: 3, Window: time.Minute, GroupBy: "tenant", Cooldown: 10 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	observe := func(tenant, level string, times int) int {
+		fired := 0
+		for i := 0; i < times; i++ {
+			alerts, _ := alerter.Observe(LogEntry{Level: level, Message: "失败", Tenant: tenant})
+			fired += len(alerts)
+			now = now.Add(time.Second)
+		}
+		return fired
+	}
+
+	// 3条不超过阈值，WARN不计数，滑出窗口的不计数
+	if observe("app-a", "ERROR", 3)+observe("app-a", "WARN", 5) != 0 {
+		t.Fatal("未超过阈值不应触发")
+	}
+	now = now.Add(time.Minute)
+	if observe("app-a", "ERROR", 3) != 0 {
+		t.Fatal("窗口外的日志不应计数")
+	}
+	if observe("app-a", "ERROR", 1) != 1 || notifier.alerts[0].Count != 4 || notifier.alerts[0].Group != "app-a" {
+		t.Fatalf("第4条ERROR应触发告警: %+v", notifier.alerts)
+	}
+
+	// 不同租户分别计数
+	if observe("app-b", "ERROR", 4) != 1 {
+		t.Error("app-b应独立触发")
+	}
+
+	// 冷却期内再次满足条件只计入抑制次数，冷却结束后的告警带上抑制次数
+	if observe("app-a", "ERROR", 8) != 0 {
+		t.Error("冷却期内不应重复通知")
+	}
+	now = now.Add(10 * time.Minute)
+	if observe("app-a", "ERROR", 4) != 1 {
+		t.Fatal("冷却结束后应再次通知")
+	}
+	if last := notifier.alerts[len(notifier.alerts)-1]; last.Suppressed != 2 || !strings.Contains(last.Text(), "抑制2次") {
+		t.Errorf("应记录冷却期间抑制的次数: %+v", last)
+	}
+}
+
+func TestAlertPatternRuleAndValidation(t *testing.T) {
+	notifier := &recordingNotifier{}
+	alerter := NewAlerter(notifier)
+	alerter.AddRule(AlertRule{Name: "oom", Pattern: `(?i)out of memory|OOMKilled`, Cooldown: -1})
+	alerter.AddRule(AlertRule{Name: "payment", Pattern: `支付失败`, GroupBy: "service"})
+
+	for _, entry := range []LogEntry{
+		{Level: "ERROR", Message: "java.lang.OutOfMemoryError"},
+		{Level: "ERROR", Message: "container OOMKilled"},
+		{Level: "WARN", Message: "Out of memory, retrying"},
+		{Level: "ERROR", Message: "支付失败", Fields: map[string]string{"service": "order"}},
+		{Level: "ERROR", Message: "支付失败", Fields: map[string]string{"service": "order"}},
+		{Level: "ERROR", Message: "支付失败", Fields: map[string]string{"service": "refund"}},
+	} {
+		alerter.Write(entry)
+	}
+
+	var got []string
+	for _, alert := range notifier.alerts {
+		got = append(got, alert.Rule+":"+alert.Group)
+	}
+	// 不去重的规则每次匹配都通知，默认冷却按分组去重
+	if strings.Join(got, ",") != "oom:,oom:,payment:order,payment:refund" {
+		t.Errorf("正则规则触发不正确: %v", got)
+	}
+
+	for _, rule := range []AlertRule{
+		{Pattern: "x"},
+		{Name: "oom"},
+		{Name: "bad-regex", Pattern: "("},
+		{Name: "no-window", Threshold: 10},
+	} {
+		if err := alerter.AddRule(rule); err == nil {
+			t.Errorf("规则 %+v 应返回错误", rule)
+		}
+	}
+}
+
+func TestAlertNotifiers(t *testing.T) {
+	alert := Alert{
+		Rule:    "error-burst",
+		Count:   51,
+		Window:  time.Minute,
+		FiredAt: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		Sample:  LogEntry{Level: "ERROR", Message: "数据库连接失败"},
+	}
+
+	var out bytes.Buffer
+	(&StdoutNotifier{Writer: &out}).Notify(alert)
+	if out.String() != "2024-01-15T10:00:00Z [告警] error-burst: 1m0s内51条日志, 示例: [ERROR] 数据库连接失败\n" {
+		t.Errorf("标准输出格式不正确: %q", out.String())
+	}
+
+	var received map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+	if err := (&WebhookNotifier{URL: server.URL}).Notify(alert); err != nil {
+		t.Fatal(err)
+	}
+	if received["rule"] != "error-burst" || received["count"] != float64(51) || !strings.Contains(fmt.Sprint(received["text"]), "数据库连接失败") {
+		t.Errorf("webhook请求体不正确: %v", received)
+	}
+
+	var sent []byte
+	email := &EmailNotifier{Addr: "smtp.example.com:587", From: "alert@example.com", To: []string{"ops@example.com", "dev@example.com"}}
+	email.send = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent = msg
+		return nil
+	}
+	email.Notify(alert)
+	message := string(sent)
+	if !strings.Contains(message, "To: ops@example.com, dev@example.com\r\n") || !strings.Contains(message, "Subject: =?utf-8?q?") || !strings.HasSuffix(message, "数据库连接失败\r\n") {
+		t.Errorf("邮件内容不正确: %q", message)
+	}
+
+	// 作为Pipeline的输出，通知失败计入SinkErrors
+	failing := &recordingNotifier{err: errors.New("webhook不可用")}
+	alerter := NewAlerter(failing)
+	alerter.AddRule(AlertRule{Name: "any-error", Levels: []string{"ERROR"}})
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{alerter}})
+	pipeline.Submit(context.Background(), "2024-01-15 10:30:15 [ERROR] 失败")
+	pipeline.Shutdown(context.Background())
+	if len(failing.alerts) != 1 || pipeline.Stats().SinkErrors != 1 {
+		t.Errorf("通知失败应作为输出错误: %d %+v", len(failing.alerts), pipeline.Stats())
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 异常检测的默认配置
+const (
+	DefaultAnomalyInterval  = time.Minute
+	DefaultAnomalyAlpha     = 0.1
+	DefaultAnomalyThreshold = 3.0
+	DefaultAnomalyWarmup    = 10
+	DefaultAnomalyMinCount  = 20
+)
+
+// maxCatchUp 长时间没有日志后，最多补评估的空周期数
+const maxCatchUp = 1000
+
+// 异常的种类
+const (
+	AnomalyVolume    = "volume"     // 日志量偏离基线（突增或骤降）
+	AnomalyErrorRate = "error_rate" // 错误率高于基线
+)
+
+// AnomalyConfig 异常检测配置
+type AnomalyConfig struct {
+	Interval    time.Duration // 统计周期，每个周期结束时与基线比较，<=0时为DefaultAnomalyInterval
+	GroupBy     string        // 分组字段："tenant"、"level"、"source"或Fields中的字段，为空时为source
+	ErrorLevels []string      // 计入错误率的级别，为空时为ERROR
+	Alpha       float64       // EWMA平滑系数，越大基线跟随越快，(0,1]之外时为DefaultAnomalyAlpha
+	Seasonal    time.Duration // >0时按季节周期（如24*time.Hour）为每个时段分别学习基线，应是Interval的整数倍
+	Threshold   float64       // 偏离超过多少个标准差时触发，<=0时为DefaultAnomalyThreshold
+	Warmup      int           // 基线学习多少个周期后才开始判断，<=0时为DefaultAnomalyWarmup
+	MinCount    int           // 一个周期至少多少条日志才判断错误率，<=0时为DefaultAnomalyMinCount
+	MaxGroups   int           // 最多跟踪的分组数，超出的计入 "_other"，<=0时为DefaultMaxGroups
+	Cooldown    time.Duration // 同一分组同一种异常两次事件之间的间隔，0时为DefaultAlertCooldown，<0表示不去重
+}
+
+// AnomalyEvent 一次检测到的异常
+type AnomalyEvent struct {
+	Kind     string        `json:"kind"` // AnomalyVolume 或 AnomalyErrorRate
+	Group    string        `json:"group"`
+	Start    time.Time     `json:"start"` // 异常周期的开始时间
+	Interval time.Duration `json:"interval"`
+	Value    float64       `json:"value"`    // 周期内的日志条数或错误率
+	Expected float64       `json:"expected"` // 基线的均值
+	StdDev   float64       `json:"std_dev"`  // 基线的标准差
+	Score    float64       `json:"score"`    // 偏离的标准差数，负数表示低于基线
+}
+
+// Text 异常的可读描述
+func (e AnomalyEvent) Text() string {
+	name, format := "日志量", "%.0f"
+	if e.Kind == AnomalyErrorRate {
+		name, format = "错误率", "%.2f%%"
+	}
+	value, expected, stddev := e.Value, e.Expected, e.StdDev
+	if e.Kind == AnomalyErrorRate {
+		value, expected, stddev = value*100, expected*100, stddev*100
+	}
+	return fmt.Sprintf("[异常] %s %s %s: "+format+"，基线 "+format+"±"+format+"（%+.1fσ）",
+		e.Start.Format("2006-01-02 15:04"), e.Group, name, value, expected, stddev, e.Score)
+}
+
+// anomalyBaseline 指数加权的均值和方差
+type anomalyBaseline struct {
+	samples  int
+	mean     float64
+	variance float64
+}
+
+// update 把一个周期的值计入基线
+func (b *anomalyBaseline) update(value, alpha float64) {
+	if b.samples == 0 {
+		b.mean = value
+	} else {
+		diff := value - b.mean
+		increment := alpha * diff
+		b.mean += increment
+		b.variance = (1 - alpha) * (b.variance + diff*increment)
+	}
+	b.samples++
+}
+
+// anomalyKey 基线按分组和季节时段分别学习
+type anomalyKey struct {
+	group string
+	slot  int
+}
+
+// anomalyCount 当前周期内一个分组的计数
+type anomalyCount struct {
+	total  int
+	errors int
+}
+
+// AnomalyDetector 按分组学习日志量和错误率的基线（EWMA，可以按季节时段分别学习），
+// 周期结束时当前值偏离基线超过Threshold个标准差即产生事件。实现了Sink接口。
+// 周期按接收日志的时间计算，见过的分组在没有日志的周期按0条评估，可以发现来源静默
+type AnomalyDetector struct {
+	config      AnomalyConfig
+	emit        func(AnomalyEvent)
+	errorLevels map[string]bool
+
+	current   time.Time // 当前周期的开始
+	counts    map[string]*anomalyCount
+	groups    map[string]bool // 见过的分组
+	volume    map[anomalyKey]*anomalyBaseline
+	errorRate map[anomalyKey]*anomalyBaseline
+	lastEvent map[string]time.Time // 分组和种类 → 上次事件的时间
+
+	mutex sync.Mutex
+	now   func() time.Time
+}
+
+// NewAnomalyDetector 创建异常检测器，检测到的异常交给emit（在锁外调用）
+func NewAnomalyDetector(config AnomalyConfig, emit func(AnomalyEvent)) *AnomalyDetector {
+	if config.Interval <= 0 {
+		config.Interval = DefaultAnomalyInterval
+	}
+	if config.GroupBy == "" {
+		config.GroupBy = "source"
+	}
+	if config.Alpha <= 0 || config.Alpha > 1 {
+		config.Alpha = DefaultAnomalyAlpha
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = DefaultAnomalyThreshold
+	}
+	if config.Warmup <= 0 {
+		config.Warmup = DefaultAnomalyWarmup
+	}
+	if config.MinCount <= 0 {
+		config.MinCount = DefaultAnomalyMinCount
+	}
+	if config.MaxGroups <= 0 {
+		config.MaxGroups = DefaultMaxGroups
+	}
+	if config.Cooldown == 0 {
+		config.Cooldown = DefaultAlertCooldown
+	}
+	levels := config.ErrorLevels
+	if len(levels) == 0 {
+		levels = []string{"ERROR"}
+	}
+	d := &AnomalyDetector{
+		config:      config,
+		emit:        emit,
+		errorLevels: make(map[string]bool),
+		counts:      make(map[string]*anomalyCount),
+		groups:      make(map[string]bool),
+		volume:      make(map[anomalyKey]*anomalyBaseline),
+		errorRate:   make(map[anomalyKey]*anomalyBaseline),
+		lastEvent:   make(map[string]time.Time),
+		now:         time.Now,
+	}
+	for _, level := range levels {
+		d.errorLevels[strings.ToUpper(level)] = true
+	}
+	return d
+}
+
+// Write 实现Sink接口，把日志计入当前周期；进入新周期时先评估已结束的周期
+func (d *AnomalyDetector) Write(entry LogEntry) error {
+	d.mutex.Lock()
+	events := d.advance(d.now())
+	group := entryValue(entry, d.config.GroupBy)
+	if !d.groups[group] && len(d.groups) >= d.config.MaxGroups {
+		group = overflowKey
+	}
+	d.groups[group] = true
+	count, exists := d.counts[group]
+	if !exists {
+		count = &anomalyCount{}
+		d.counts[group] = count
+	}
+	count.total++
+	if d.errorLevels[strings.ToUpper(entry.Level)] {
+		count.errors++
+	}
+	d.mutex.Unlock()
+
+	d.send(events)
+	return nil
+}
+
+// Check 评估now之前已经结束的周期。Run会定时调用，没有日志写入时也能发现来源静默
+func (d *AnomalyDetector) Check(now time.Time) []AnomalyEvent {
+	d.mutex.Lock()
+	events := d.advance(now)
+	d.mutex.Unlock()
+	d.send(events)
+	return events
+}
+
+// Run 每个周期结束时调用Check，直到ctx结束
+func (d *AnomalyDetector) Run(ctx context.Context) {
+	for {
+		now := d.now()
+		next := now.Truncate(d.config.Interval).Add(d.config.Interval)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			d.Check(d.now())
+		}
+	}
+}
+
+// Baseline 返回分组在now所在时段的日志量基线（每周期条数的均值和标准差），还没有样本时ok为false
+func (d *AnomalyDetector) Baseline(group string, now time.Time) (mean, stddev float64, ok bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	baseline, exists := d.volume[anomalyKey{group: group, slot: d.slot(now.Truncate(d.config.Interval))}]
+	if !exists {
+		return 0, 0, false
+	}
+	return baseline.mean, math.Sqrt(baseline.variance), true
+}
+
+func (d *AnomalyDetector) send(events []AnomalyEvent) {
+	if d.emit == nil {
+		return
+	}
+	for _, event := range events {
+		d.emit(event)
+	}
+}
+
+// slot 周期所在的季节时段，没有设置Seasonal时只有一个时段
+func (d *AnomalyDetector) slot(start time.Time) int {
+	if d.config.Seasonal <= 0 {
+		return 0
+	}
+	return int(start.UnixNano() % int64(d.config.Seasonal) / int64(d.config.Interval))
+}
+
+// advance 评估now之前结束的所有周期并开始新的周期，调用方需持有mutex
+func (d *AnomalyDetector) advance(now time.Time) []AnomalyEvent {
+	start := now.Truncate(d.config.Interval)
+	if d.current.IsZero() {
+		d.current = start
+		return nil
+	}
+	var events []AnomalyEvent
+	for n := 0; d.current.Before(start) && n < maxCatchUp; n++ {
+		events = append(events, d.evaluate(d.current)...)
+		d.counts = make(map[string]*anomalyCount)
+		d.current = d.current.Add(d.config.Interval)
+	}
+	d.current = start
+	return events
+}
+
+// evaluate 把周期内各分组的值与基线比较后计入基线，调用方需持有mutex
+func (d *AnomalyDetector) evaluate(start time.Time) []AnomalyEvent {
+	groups := make([]string, 0, len(d.groups))
+	for group := range d.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	var events []AnomalyEvent
+	slot := d.slot(start)
+	for _, group := range groups {
+		count := d.counts[group]
+		if count == nil {
+			count = &anomalyCount{}
+		}
+		key := anomalyKey{group: group, slot: slot}
+
+		// 标准差至少取泊松分布的sqrt(均值)，避免平稳的来源方差接近0时一点波动就触发
+		volume := float64(count.total)
+		baseline := d.baseline(d.volume, key)
+		if baseline.samples >= d.config.Warmup {
+			stddev := math.Max(math.Sqrt(baseline.variance), math.Sqrt(math.Max(baseline.mean, 1)))
+			score := (volume - baseline.mean) / stddev
+			if math.Abs(score) > d.config.Threshold {
+				events = d.appendEvent(events, AnomalyEvent{Kind: AnomalyVolume, Group: group, Start: start, Interval: d.config.Interval,
+					Value: volume, Expected: baseline.mean, StdDev: stddev, Score: score})
+			}
+		}
+		baseline.update(volume, d.config.Alpha)
+
+		// 错误率只在样本足够时判断和学习，只报告升高
+		if count.total < d.config.MinCount {
+			continue
+		}
+		ratio := float64(count.errors) / float64(count.total)
+		baseline = d.baseline(d.errorRate, key)
+		if baseline.samples >= d.config.Warmup {
+			p := math.Min(math.Max(baseline.mean, 0.01), 0.99)
+			stddev := math.Max(math.Sqrt(baseline.variance), math.Sqrt(p*(1-p)/float64(count.total)))
+			score := (ratio - baseline.mean) / stddev
+			if score > d.config.Threshold {
+				events = d.appendEvent(events, AnomalyEvent{Kind: AnomalyErrorRate, Group: group, Start: start, Interval: d.config.Interval,
+					Value: ratio, Expected: baseline.mean, StdDev: stddev, Score: score})
+			}
+		}
+		baseline.update(ratio, d.config.Alpha)
+	}
+	return events
+}
+
+func (d *AnomalyDetector) baseline(baselines map[anomalyKey]*anomalyBaseline, key anomalyKey) *anomalyBaseline {
+	baseline, exists := baselines[key]
+	if !exists {
+		baseline = &anomalyBaseline{}
+		baselines[key] = baseline
+	}
+	return baseline
+}
+
+// appendEvent 冷却期内同一分组同一种异常不再产生事件，调用方需持有mutex
+func (d *AnomalyDetector) appendEvent(events []AnomalyEvent, event AnomalyEvent) []AnomalyEvent {
+	key := event.Group + "\x00" + event.Kind
+	if last, exists := d.lastEvent[key]; exists && d.config.Cooldown > 0 && event.Start.Sub(last) < d.config.Cooldown {
+		return events
+	}
+	d.lastEvent[key] = event.Start
+	return append(events, event)
+}
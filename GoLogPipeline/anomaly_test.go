@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// anomalyClock 用可控的时间驱动检测器，write在第minute分钟写入count条日志
+type anomalyClock struct {
+	detector *AnomalyDetector
+	base     time.Time
+	now      time.Time
+}
+
+func newAnomalyClock(config AnomalyConfig) (*anomalyClock, *[]AnomalyEvent) {
+	var events []AnomalyEvent
+	clock := &anomalyClock{base: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}
+	clock.now = clock.base
+	clock.detector = NewAnomalyDetector(config, func(event AnomalyEvent) {
+		events = append(events, event)
+	})
+	clock.detector.now = func() time.Time { return clock.now }
+	return clock, &events
+}
+
+func (c *anomalyClock) write(minute int, source string, count, errors int) {
+	c.now = c.base.Add(time.Duration(minute)*time.Minute + time.Second)
+	for i := 0; i < count; i++ {
+		level := "INFO"
+		if i < errors {
+			level = "ERROR"
+		}
+		c.detector.Write(LogEntry{Level: level, Message: "x", Fields: map[string]string{"source": source}})
+	}
+}
+
+func TestAnomalyVolumeSpikeAndDrop(t *testing.T) {
+	clock, events := newAnomalyClock(AnomalyConfig{Warmup: 5, Cooldown: -1})
+	for minute := 0; minute < 10; minute++ {
+		clock.write(minute, "api", 100+minute%3*5, 0)
+		clock.write(minute, "db", 50, 0)
+	}
+	if len(*events) != 0 {
+		t.Fatalf("平稳的流量不应触发: %+v", *events)
+	}
+	mean, _, ok := clock.detector.Baseline("api", clock.now)
+	if !ok || mean < 95 || mean > 115 {
+		t.Errorf("api的基线应在100左右: %.1f", mean)
+	}
+
+	// 第10分钟api突增，db没有任何日志，第11分钟开始时评估
+	clock.write(10, "api", 400, 0)
+	clock.detector.Check(clock.base.Add(11 * time.Minute))
+	if len(*events) != 2 {
+		t.Fatalf("应检测到突增和静默: %+v", *events)
+	}
+	spike, drop := (*events)[0], (*events)[1]
+	if spike.Kind != AnomalyVolume || spike.Group != "api" || spike.Value != 400 || spike.Score <= 3 {
+		t.Errorf("api突增的事件不正确: %+v", spike)
+	}
+	if drop.Group != "db" || drop.Value != 0 || drop.Score >= -3 || !drop.Start.Equal(clock.base.Add(10*time.Minute)) {
+		t.Errorf("db静默的事件不正确: %+v", drop)
+	}
+	if text := spike.Text(); !strings.Contains(text, "api 日志量: 400") || !strings.Contains(text, "σ") {
+		t.Errorf("事件描述不正确: %s", text)
+	}
+}
+
+func TestAnomalyErrorRate(t *testing.T) {
+	clock, events := newAnomalyClock(AnomalyConfig{Warmup: 5})
+	for minute := 0; minute < 8; minute++ {
+		clock.write(minute, "api", 100, 2)
+		clock.write(minute, "cron", 5, 0)
+	}
+	clock.write(8, "api", 100, 30)
+	clock.write(8, "cron", 5, 5) // 样本太少，不判断错误率
+	clock.write(9, "api", 100, 30)
+	clock.detector.Check(clock.base.Add(10 * time.Minute))
+
+	if len(*events) != 1 {
+		t.Fatalf("应只有一次错误率异常（冷却期内不重复）: %+v", *events)
+	}
+	event := (*events)[0]
+	if event.Kind != AnomalyErrorRate || event.Group != "api" || event.Value != 0.3 || event.Expected > 0.03 {
+		t.Errorf("错误率事件不正确: %+v", event)
+	}
+	if !strings.Contains(event.Text(), "错误率: 30.00%") {
+		t.Errorf("错误率应以百分比描述: %s", event.Text())
+	}
+}
+
+func TestAnomalySeasonalBaseline(t *testing.T) {
+	// 偶数分钟是高峰，奇数分钟是低谷：按时段学习的基线不会把正常的高峰当作异常
+	run := func(seasonal time.Duration) []AnomalyEvent {
+		clock, events := newAnomalyClock(AnomalyConfig{Seasonal: seasonal, Warmup: 4, Cooldown: -1})
+		for minute := 0; minute < 13; minute++ {
+			count := 100
+			if minute%2 == 1 {
+				count = 10
+			}
+			clock.write(minute, "api", count, 0)
+		}
+		clock.write(13, "api", 100, 0) // 低谷时段出现高峰的量
+		clock.detector.Check(clock.base.Add(14 * time.Minute))
+		return *events
+	}
+
+	seasonal := run(2 * time.Minute)
+	if len(seasonal) != 1 || !seasonal[0].Start.Equal(time.Date(2024, 1, 15, 0, 13, 0, 0, time.UTC)) || seasonal[0].Expected > 20 {
+		t.Errorf("按时段的基线应只在低谷时段的高峰触发: %+v", seasonal)
+	}
+	// 不按时段时交替的流量让基线的方差很大，发现不了这次异常
+	if flat := run(0); len(flat) != 0 {
+		t.Errorf("不按时段的基线不应触发: %+v", flat)
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 压缩格式的文件头
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// compressedSuffixes 压缩文件的扩展名，去掉后得到原始文件名
+var compressedSuffixes = []string{".gz", ".zst"}
+
+// OpenLogFile 打开日志文件，按文件头识别gzip和zstd压缩并透明解压，其余按纯文本读取。
+// 项目只依赖标准库，zstd通过外部的 zstd 命令解压，需要事先安装
+func OpenLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取 %s 失败: %v", path, err)
+	}
+	return reader, nil
+}
+
+// decompress 按文件头选择解压方式，返回的ReadCloser关闭时同时关闭file
+func decompress(file io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(file)
+	header, err := buffered.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		return &stackedReader{Reader: gz, closers: []io.Closer{gz, file}}, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return zstdReader(buffered, file)
+	default:
+		return &stackedReader{Reader: buffered, closers: []io.Closer{file}}, nil
+	}
+}
+
+// zstdReader 用 zstd -dc 解压，关闭时等待命令退出并报告解压错误
+func zstdReader(compressed io.Reader, file io.Closer) (io.ReadCloser, error) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		return nil, errors.New("读取zstd压缩的日志需要安装 zstd 命令")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "zstd", "-dc")
+	cmd.Stdin = compressed
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return &zstdProcess{Reader: stdout, cmd: cmd, cancel: cancel, stderr: &stderr, file: file}, nil
+}
+
+type zstdProcess struct {
+	io.Reader
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stderr *bytes.Buffer
+	file   io.Closer
+	eof    bool
+}
+
+func (z *zstdProcess) Read(p []byte) (int, error) {
+	n, err := z.Reader.Read(p)
+	if err == io.EOF {
+		z.eof = true
+	}
+	return n, err
+}
+
+// Close 读完时报告zstd的退出错误（如文件损坏）；没读完就关闭时终止命令
+func (z *zstdProcess) Close() error {
+	if !z.eof {
+		z.cancel()
+	}
+	err := z.cmd.Wait()
+	z.cancel()
+	z.file.Close()
+	if err != nil && z.eof {
+		return fmt.Errorf("zstd解压失败: %v %s", err, strings.TrimSpace(z.stderr.String()))
+	}
+	return nil
+}
+
+// stackedReader 关闭时依次关闭解压器和文件
+type stackedReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (s *stackedReader) Close() error {
+	var errs []error
+	for _, closer := range s.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// trimCompressedSuffix 去掉 .gz、.zst 扩展名
+func trimCompressedSuffix(name string) string {
+	for _, suffix := range compressedSuffixes {
+		if trimmed, found := strings.CutSuffix(name, suffix); found {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// LogFile 目录中的一个日志文件
+type LogFile struct {
+	Path  string
+	Start time.Time // 第一条能解析的日志的时间，没有时为文件的修改时间
+}
+
+// ListLogFiles 列出dir中匹配pattern（filepath.Match语法，为空时为全部文件）的日志文件，包括压缩的文件，
+// 按第一条日志的时间排序，用parser识别时间。轮转后的文件名（app.log.2.gz、app.log.1.gz、app.log）
+// 和复制后的修改时间都不可靠，按内容排序才能保证按时间顺序读取
+func ListLogFiles(dir, pattern string, parser Parser) ([]LogFile, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	if parser == nil {
+		parser = lineParser{}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []LogFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if matched, err := filepath.Match(pattern, entry.Name()); err != nil {
+			return nil, err
+		} else if !matched {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		start, err := firstTimestamp(path, parser)
+		if err != nil {
+			return nil, err
+		}
+		if start.IsZero() {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			start = info.ModTime()
+		}
+		files = append(files, LogFile{Path: path, Start: start})
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].Start.Equal(files[j].Start) {
+			return files[i].Start.Before(files[j].Start)
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// firstTimestampLines 查找第一条日志的时间时最多读取的行数
+const firstTimestampLines = 1000
+
+// firstTimestamp 返回文件中第一条带时间的日志的时间
+func firstTimestamp(path string, parser Parser) (time.Time, error) {
+	reader, err := OpenLogFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for i := 0; i < firstTimestampLines && scanner.Scan(); i++ {
+		if entry, ok := parser.Parse(scanner.Text()); ok && !entry.Timestamp.IsZero() {
+			return entry.Timestamp, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+// BackfillConfig 把历史日志目录送入管道的配置
+type BackfillConfig struct {
+	Dir     string
+	Pattern string    // 文件名匹配，如 "app.log*"，为空时为全部文件
+	Source  string    // 来源名，使用该来源的解析器和标签，为空时为目录名
+	From    time.Time // 跳过在From之前就已结束的文件（按下一个文件的开始时间判断），零值表示不限制
+	To      time.Time // 跳过在To之后才开始的文件，零值表示不限制
+}
+
+// Backfill 按时间顺序把目录中的日志文件（包括gzip和zstd压缩的）逐个送入管道，
+// 与实时日志经过同样的解析、处理和输出。返回读取的文件数
+func (p *Pipeline) Backfill(ctx context.Context, config BackfillConfig) (int, error) {
+	source := config.Source
+	if source == "" {
+		source = filepath.Base(config.Dir)
+	}
+	parser, _ := p.sourceConfig(source)
+	files, err := ListLogFiles(config.Dir, config.Pattern, parser)
+	if err != nil {
+		return 0, err
+	}
+
+	read := 0
+	for i, file := range files {
+		if !config.To.IsZero() && !file.Start.Before(config.To) {
+			break
+		}
+		if !config.From.IsZero() && i+1 < len(files) && !files[i+1].Start.After(config.From) {
+			continue
+		}
+		reader, err := OpenLogFile(file.Path)
+		if err != nil {
+			return read, err
+		}
+		err = p.Consume(ctx, source, reader)
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return read, fmt.Errorf("回填 %s 失败: %v", file.Path, err)
+		}
+		read++
+	}
+	return read, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeLogFile 按扩展名写入纯文本、gzip或zstd压缩的文件，没有zstd命令时跳过测试
+func writeLogFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	switch filepath.Ext(path) {
+	case ".gz":
+		var buffer bytes.Buffer
+		gz := gzip.NewWriter(&buffer)
+		gz.Write(content)
+		gz.Close()
+		content = buffer.Bytes()
+	case ".zst":
+		if _, err := exec.LookPath("zstd"); err != nil {
+			t.Skip("没有安装zstd命令")
+		}
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdin = bytes.NewReader(content)
+		compressed, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = compressed
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenLogFileCompressed(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"plain.log", "app.log.gz", "app.log.zst"} {
+		path := filepath.Join(dir, name)
+		writeLogFile(t, path, "2024-01-15 10:30:15 [INFO] "+name, "2024-01-15 10:30:16 [ERROR] 第二行")
+
+		reader, err := OpenLogFile(path)
+		if err != nil {
+			t.Fatalf("打开 %s 失败: %v", name, err)
+		}
+		data, err := io.ReadAll(reader)
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil || !strings.HasPrefix(string(data), "2024-01-15 10:30:15 [INFO] "+name+"\n") {
+			t.Errorf("%s 应透明解压: %q %v", name, data, err)
+		}
+
+		processor := NewLogProcessor()
+		if err := NewFileReader(processor).ReadFromFile(path); err != nil || len(processor.Entries()) != 2 {
+			t.Errorf("FileReader应能读取 %s: %d %v", name, len(processor.Entries()), err)
+		}
+	}
+
+	// 损坏的压缩文件报错
+	broken := filepath.Join(dir, "broken.gz")
+	os.WriteFile(broken, []byte{0x1f, 0x8b, 0x08, 0x00, 0x01}, 0o644)
+	reader, err := OpenLogFile(broken)
+	if err == nil {
+		_, err = io.ReadAll(reader)
+		reader.Close()
+	}
+	if err == nil {
+		t.Error("损坏的gzip文件应报错")
+	}
+
+	// 压缩后的归档同样可以回放
+	archive, _ := NewArchive(filepath.Join(dir, "archive"))
+	writeLogFile(t, filepath.Join(dir, "archive", "2024-01-15.jsonl.gz"), `{"tenant":"app","line":"2024-01-15 10:00:00 [INFO] 压缩的归档","received_at":"2024-01-15T10:00:00Z"}`)
+	var lines []string
+	if err := archive.Read(time.Time{}, time.Time{}, func(record ArchiveRecord) error {
+		lines = append(lines, record.Line)
+		return nil
+	}); err != nil || len(lines) != 1 {
+		t.Errorf("应读取压缩的归档: %v %v", lines, err)
+	}
+}
+
+func TestListLogFilesInTimeOrder(t *testing.T) {
+	dir := t.TempDir()
+	// 文件名和修改时间都不代表日志的先后：轮转编号越大越旧
+	writeLogFile(t, filepath.Join(dir, "app.log"), "2024-01-17 00:00:01 [INFO] 今天")
+	writeLogFile(t, filepath.Join(dir, "app.log.1.gz"), "2024-01-16 00:00:01 [INFO] 昨天")
+	writeLogFile(t, filepath.Join(dir, "app.log.2.gz"), "无法解析的开头", "2024-01-15 00:00:01 [INFO] 前天")
+	writeLogFile(t, filepath.Join(dir, "other.txt"), "2024-01-01 00:00:00 [INFO] 不匹配")
+	writeLogFile(t, filepath.Join(dir, "app.log.notime"), "没有时间")
+	os.Chtimes(filepath.Join(dir, "app.log.notime"), time.Now(), time.Date(2024, 1, 16, 12, 0, 0, 0, time.UTC))
+
+	files, err := ListLogFiles(dir, "app.log*", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file.Path))
+	}
+	if strings.Join(names, ",") != "app.log.2.gz,app.log.1.gz,app.log.notime,app.log" {
+		t.Errorf("应按第一条日志的时间排序，没有时间的按修改时间: %v", names)
+	}
+	if !files[0].Start.Equal(time.Date(2024, 1, 15, 0, 0, 1, 0, time.UTC)) {
+		t.Errorf("开始时间应取第一条能解析的日志: %v", files[0].Start)
+	}
+	if _, err := ListLogFiles(dir, "[", nil); err == nil {
+		t.Error("无效的匹配模式应报错")
+	}
+}
+
+func TestBackfillThroughPipeline(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, filepath.Join(dir, "api.log.3.gz"), "2024-01-13 08:00:00 [INFO] 太早")
+	writeLogFile(t, filepath.Join(dir, "api.log.2.gz"), "2024-01-14 08:00:00 [INFO] 一", "2024-01-14 09:00:00 [ERROR] 二", "    at Main.run")
+	writeLogFile(t, filepath.Join(dir, "api.log.1"), "2024-01-15 08:00:00 [INFO] 三")
+	writeLogFile(t, filepath.Join(dir, "api.log"), "2024-01-16 08:00:00 [INFO] 太晚")
+
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}})
+	multiline, _ := NewMultilineParser(lineParser{}, "")
+	pipeline.SetSource("history", SourceConfig{Parser: multiline, Labels: map[string]string{"source": "history"}})
+
+	ctx := context.Background()
+	count, err := pipeline.Backfill(ctx, BackfillConfig{
+		Dir:    dir,
+		Source: "history",
+		From:   time.Date(2024, 1, 14, 12, 0, 0, 0, time.UTC),
+		To:     time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil || count != 2 {
+		t.Fatalf("应回填时间范围内的2个文件: %d %v", count, err)
+	}
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := messagesOf(sink.entries); got != "一,二\n    at Main.run,三" {
+		t.Errorf("应按时间顺序经过管道，多行日志在文件末尾完成: %q", got)
+	}
+	if sink.entries[0].Fields["source"] != "history" {
+		t.Errorf("应使用来源的标签: %v", sink.entries[0].Fields)
+	}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultReloadInterval 检查配置文件变化的默认间隔
+const DefaultReloadInterval = 2 * time.Second
+
+// Config 管道配置文件（YAML或JSON）的结构：来源、处理步骤和输出
+type Config struct {
+	BufferSize  int             `json:"buffer_size"` // 只在启动时生效
+	Sources     []SourceSpec    `json:"sources"`
+	Processors  []ProcessorSpec `json:"processors"`
+	Sinks       []SinkSpec      `json:"sinks"`
+	DeadLetters string          `json:"dead_letters"` // 死信文件路径，为空时无法解析的行只计数
+}
+
+// SourceSpec 来源配置
+type SourceSpec struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`    // file、dir、stdin、syslog、http
+	Path    string            `json:"path"`    // file：文件路径，可以是gzip或zstd压缩的；dir：目录；http：挂载路径，默认 /ingest
+	Pattern string            `json:"pattern"` // dir：文件名匹配，如 "app.log*"
+	UDP     string            `json:"udp"`     // syslog：UDP地址，如 ":5514"
+	TCP     string            `json:"tcp"`     // syslog：TCP地址
+	Listen  string            `json:"listen"`  // http：监听地址，如 ":8080"
+	Parser  *ParserSpec       `json:"parser"`  // 为空时file、dir和stdin按 "日期 时间 [级别] 消息"、syslog按syslog、http按JSON解析
+	Labels  map[string]string `json:"labels"`
+}
+
+// ParserSpec 解析器配置
+type ParserSpec struct {
+	Type           string            `json:"type"` // line、json、logfmt、regex、syslog
+	Pattern        string            `json:"pattern"`
+	Multiline      bool              `json:"multiline"`       // 不能解析的行作为续行合并到上一条
+	MultilineStart string            `json:"multiline_start"` // 新日志开始的正则，设置后即开启多行
+	TimeLayouts    []string          `json:"time_layouts"`    // Go时间格式，或 rfc3339、datetime、nginx、unix、unix_ms、unix_ns
+	Timezone       string            `json:"timezone"`        // 如 Asia/Shanghai
+	Levels         map[string]string `json:"levels"`          // 级别别名
+}
+
+// ProcessorSpec 处理步骤配置，按Type使用对应的字段
+type ProcessorSpec struct {
+	Type string `json:"type"` // filter、normalize_levels、redact、sample、rate_limit、correlation
+
+	Levels  []string `json:"levels"`  // filter：只保留这些级别；sample：参与采样的级别
+	Match   string   `json:"match"`   // filter：只保留消息匹配该正则的日志
+	Exclude string   `json:"exclude"` // filter：丢弃消息匹配该正则的日志
+
+	Aliases map[string]string `json:"aliases"` // normalize_levels：级别别名
+
+	Rules      []string            `json:"rules"`       // redact：内置规则 email、phone、card，default表示全部
+	Patterns   []RedactPatternSpec `json:"patterns"`    // redact：自定义规则
+	MaskFields []string            `json:"mask_fields"` // redact：整个屏蔽的字段
+
+	Rate      int     `json:"rate"`       // sample
+	KeyField  string  `json:"key_field"`  // sample、rate_limit
+	PerSecond float64 `json:"per_second"` // rate_limit
+	Burst     int     `json:"burst"`      // rate_limit
+	MaxKeys   int     `json:"max_keys"`   // rate_limit
+
+	Fields      []string `json:"fields"`       // correlation：依次查找关联ID的字段
+	FromMessage bool     `json:"from_message"` // correlation：字段中没有时从消息中提取
+}
+
+// RedactPatternSpec 自定义脱敏规则
+type RedactPatternSpec struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern"`
+	Replacement string   `json:"replacement"`
+	Fields      []string `json:"fields"`
+}
+
+// SinkSpec 输出配置
+type SinkSpec struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"` // stdout、file、elasticsearch、kafka
+	Path          string   `json:"path"` // file
+	MaxBytes      int64    `json:"max_bytes"`
+	MaxFiles      int      `json:"max_files"`
+	URL           string   `json:"url"` // elasticsearch、kafka（REST Proxy）
+	Index         string   `json:"index"`
+	Username      string   `json:"username"`
+	Password      string   `json:"password"`
+	Topic         string   `json:"topic"`
+	KeyField      string   `json:"key_field"`
+	BatchSize     int      `json:"batch_size"`
+	FlushInterval Duration `json:"flush_interval"`
+	MaxRetries    int      `json:"max_retries"`
+}
+
+// Duration 配置中的时长，写作 "5s"、"1m" 或秒数
+type Duration time.Duration
+
+// UnmarshalJSON 解析 "5s" 或秒数
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("无法解析时长 %s", data)
+	}
+	return nil
+}
+
+// ParseConfig 解析YAML或JSON（以 { 开头）格式的配置
+func ParseConfig(data []byte) (*Config, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		value, err := parseYAML(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("配置格式错误: %v", err)
+		}
+		if data, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var config Config
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("配置格式错误: %v", err)
+	}
+	return &config, nil
+}
+
+// LoadConfig 读取并解析配置文件
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// timeLayoutNames 配置文件中可以用名称代替的时间格式
+var timeLayoutNames = map[string]string{
+	"rfc3339":  time.RFC3339Nano,
+	"datetime": "2006-01-02 15:04:05.999999999",
+	"nginx":    LayoutNginx,
+}
+
+// buildParser 按配置创建解析器，spec为空或未指定类型时使用defaultType
+func buildParser(spec *ParserSpec, defaultType string) (Parser, error) {
+	if spec == nil {
+		spec = &ParserSpec{}
+	}
+	mapping := EntryMapping{Levels: LevelTable(spec.Levels)}
+	for _, layout := range spec.TimeLayouts {
+		if named, exists := timeLayoutNames[layout]; exists {
+			layout = named
+		}
+		mapping.TimeLayouts = append(mapping.TimeLayouts, layout)
+	}
+	if spec.Timezone != "" {
+		location, err := time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("时区 %q 无效: %v", spec.Timezone, err)
+		}
+		mapping.Location = location
+	}
+
+	kind := spec.Type
+	if kind == "" {
+		kind = defaultType
+	}
+	var parser Parser
+	switch kind {
+	case "line":
+		parser = lineParser{}
+	case "json":
+		parser = &JSONParser{Mapping: mapping}
+	case "logfmt":
+		parser = &LogfmtParser{Mapping: mapping}
+	case "regex":
+		regex, err := NewRegexParser(spec.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		regex.Mapping = mapping
+		parser = regex
+	case "syslog":
+		parser = NewSyslogParser()
+	default:
+		return nil, fmt.Errorf("未知的解析器类型 %q", kind)
+	}
+	if (kind == "line" || kind == "syslog") && len(spec.Levels) > 0 {
+		inner, levels := parser, LevelTable(spec.Levels)
+		parser = ParserFunc(func(line string) (LogEntry, bool) {
+			entry, ok := inner.Parse(line)
+			entry.Level = levels.Normalize(entry.Level)
+			return entry, ok
+		})
+	}
+	if spec.Multiline || spec.MultilineStart != "" {
+		return NewMultilineParser(parser, spec.MultilineStart)
+	}
+	return parser, nil
+}
+
+// buildProcessor 按配置创建处理步骤
+func buildProcessor(spec ProcessorSpec) (Processor, error) {
+	switch spec.Type {
+	case "filter":
+		return buildFilter(spec)
+	case "normalize_levels":
+		return LevelTable(spec.Aliases), nil
+	case "redact":
+		var rules []RedactionRule
+		for _, name := range spec.Rules {
+			switch name {
+			case "default":
+				rules = append(rules, DefaultRedactionRules()...)
+			case "email":
+				rules = append(rules, EmailRule())
+			case "phone":
+				rules = append(rules, PhoneRule())
+			case "card":
+				rules = append(rules, CardNumberRule())
+			default:
+				return nil, fmt.Errorf("未知的内置脱敏规则 %q", name)
+			}
+		}
+		for _, pattern := range spec.Patterns {
+			rules = append(rules, RedactionRule{Name: pattern.Name, Pattern: pattern.Pattern, Replacement: pattern.Replacement, Fields: pattern.Fields})
+		}
+		if len(spec.MaskFields) > 0 {
+			rules = append(rules, MaskFields("mask_fields", spec.MaskFields...))
+		}
+		return NewRedactor(rules...)
+	case "sample":
+		return NewSampler(SamplingRule{Rate: spec.Rate, Levels: spec.Levels, KeyField: spec.KeyField}), nil
+	case "rate_limit":
+		if spec.PerSecond <= 0 {
+			return nil, fmt.Errorf("rate_limit需要per_second")
+		}
+		return NewRateLimiter(RateLimit{PerSecond: spec.PerSecond, Burst: spec.Burst, KeyField: spec.KeyField, MaxKeys: spec.MaxKeys}), nil
+	case "correlation":
+		return CorrelationExtractor{Fields: spec.Fields, FromMessage: spec.FromMessage}, nil
+	default:
+		return nil, fmt.Errorf("未知的处理步骤类型 %q", spec.Type)
+	}
+}
+
+// buildFilter 按级别和消息正则过滤
+func buildFilter(spec ProcessorSpec) (Processor, error) {
+	var match, exclude *regexp.Regexp
+	var err error
+	if spec.Match != "" {
+		if match, err = regexp.Compile(spec.Match); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Exclude != "" {
+		if exclude, err = regexp.Compile(spec.Exclude); err != nil {
+			return nil, err
+		}
+	}
+	levels := make(map[string]bool)
+	for _, level := range spec.Levels {
+		levels[strings.ToUpper(level)] = true
+	}
+	return ProcessorFunc(func(entry LogEntry) (LogEntry, bool) {
+		if len(levels) > 0 && !levels[strings.ToUpper(entry.Level)] {
+			return entry, false
+		}
+		if match != nil && !match.MatchString(entry.Message) {
+			return entry, false
+		}
+		if exclude != nil && exclude.MatchString(entry.Message) {
+			return entry, false
+		}
+		return entry, true
+	}), nil
+}
+
+// writerSink 把日志以JSON行写入Writer
+type writerSink struct {
+	writer io.Writer
+	mutex  sync.Mutex
+}
+
+func (s *writerSink) Write(entry LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.writer.Write(append(data, '\n'))
+	return err
+}
+
+// buildSink 按配置创建输出，外部系统的输出用BatchingSink包装
+func buildSink(spec SinkSpec) (Sink, error) {
+	var writer BatchWriter
+	switch spec.Type {
+	case "stdout":
+		return &writerSink{writer: os.Stdout}, nil
+	case "file":
+		if spec.Path == "" {
+			return nil, fmt.Errorf("输出 %s 需要path", spec.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(spec.Path), 0755); err != nil {
+			return nil, err
+		}
+		file, err := NewRotatingFileWriter(spec.Path, spec.MaxBytes, spec.MaxFiles)
+		if err != nil {
+			return nil, err
+		}
+		writer = file
+	case "elasticsearch":
+		if spec.URL == "" || spec.Index == "" {
+			return nil, fmt.Errorf("输出 %s 需要url和index", spec.Name)
+		}
+		writer = &ElasticsearchWriter{URL: spec.URL, Index: spec.Index, Username: spec.Username, Password: spec.Password}
+	case "kafka":
+		if spec.URL == "" || spec.Topic == "" {
+			return nil, fmt.Errorf("输出 %s 需要url和topic", spec.Name)
+		}
+		writer = &KafkaWriter{Topic: spec.Topic, KeyField: spec.KeyField, Producer: &KafkaRESTProducer{URL: spec.URL}}
+	default:
+		return nil, fmt.Errorf("未知的输出类型 %q", spec.Type)
+	}
+	return NewBatchingSink(spec.Name, writer, BatchConfig{
+		BatchSize:     spec.BatchSize,
+		FlushInterval: time.Duration(spec.FlushInterval),
+		MaxRetries:    spec.MaxRetries,
+	}), nil
+}
+
+// runningSource 正在运行的来源，restartKey变化时需要重启，只有解析器和标签变化时不需要
+type runningSource struct {
+	restartKey string
+	close      func() error
+}
+
+func sourceRestartKey(spec SourceSpec) string {
+	return strings.Join([]string{spec.Type, spec.Path, spec.Pattern, spec.UDP, spec.TCP, spec.Listen}, "\x00")
+}
+
+// ConfiguredPipeline 按配置文件运行的管道，配置文件变化时热加载：
+// 处理步骤和输出整体替换，地址不变的来源继续运行，管道中的日志不会丢失
+type ConfiguredPipeline struct {
+	path       string
+	pipeline   *Pipeline
+	extraSinks []Sink
+	sources    map[string]*runningSource
+	sinks      []Sink // 按配置创建的输出，替换后关闭
+	dead       *DeadLetterFile
+	applied    []byte
+	mutex      sync.Mutex // 保证同一时间只有一次加载
+}
+
+// StartConfiguredPipeline 加载配置文件并启动管道和来源，extraSinks（如LogProcessor）
+// 不来自配置，每次加载后都追加在配置的输出之后
+func StartConfiguredPipeline(path string, extraSinks ...Sink) (*ConfiguredPipeline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	cp := &ConfiguredPipeline{
+		path:       path,
+		pipeline:   NewPipeline(PipelineConfig{BufferSize: config.BufferSize, Sinks: extraSinks}),
+		extraSinks: extraSinks,
+		sources:    make(map[string]*runningSource),
+	}
+	if err := cp.apply(config, data); err != nil {
+		cp.Shutdown(context.Background())
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Pipeline 返回底层的管道，热加载不会替换它
+func (cp *ConfiguredPipeline) Pipeline() *Pipeline {
+	return cp.pipeline
+}
+
+// Reload 重新读取配置文件，内容没有变化时返回false。配置无效时返回错误并保留当前配置；
+// 来源监听失败时返回错误，其余配置照常生效
+func (cp *ConfiguredPipeline) Reload() (bool, error) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	data, err := os.ReadFile(cp.path)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(data, cp.applied) {
+		return false, nil
+	}
+	config, err := ParseConfig(data)
+	if err != nil {
+		return false, err
+	}
+	return true, cp.apply(config, data)
+}
+
+// Watch 每隔interval检查配置文件，变化时热加载，直到ctx结束。失败时打印错误并保留当前配置
+func (cp *ConfiguredPipeline) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := cp.Reload()
+			if err != nil {
+				log.Printf("加载配置 %s 失败: %v", cp.path, err)
+			} else if changed {
+				log.Printf("已重新加载配置 %s", cp.path)
+			}
+		}
+	}
+}
+
+// apply 先创建所有解析器、处理步骤和输出，全部成功后再替换来源和管道配置。调用方需持有mutex
+func (cp *ConfiguredPipeline) apply(config *Config, data []byte) error {
+	names := make(map[string]bool)
+	parsers := make(map[string]Parser)
+	for _, spec := range config.Sources {
+		if spec.Name == "" || names[spec.Name] {
+			return fmt.Errorf("来源名 %q 为空或重复", spec.Name)
+		}
+		names[spec.Name] = true
+		defaultParser := map[string]string{"file": "line", "dir": "line", "stdin": "line", "syslog": "syslog", "http": "json"}[spec.Type]
+		switch {
+		case defaultParser == "":
+			return fmt.Errorf("来源 %s 的类型 %q 未知", spec.Name, spec.Type)
+		case (spec.Type == "file" || spec.Type == "dir") && spec.Path == "":
+			return fmt.Errorf("来源 %s 需要path", spec.Name)
+		case spec.Type == "syslog" && spec.UDP == "" && spec.TCP == "":
+			return fmt.Errorf("来源 %s 需要udp或tcp地址", spec.Name)
+		case spec.Type == "http" && spec.Listen == "":
+			return fmt.Errorf("来源 %s 需要listen地址", spec.Name)
+		}
+		parser, err := buildParser(spec.Parser, defaultParser)
+		if err != nil {
+			return fmt.Errorf("来源 %s: %v", spec.Name, err)
+		}
+		parsers[spec.Name] = parser
+	}
+
+	var processors []Processor
+	for i, spec := range config.Processors {
+		processor, err := buildProcessor(spec)
+		if err != nil {
+			return fmt.Errorf("第%d个处理步骤: %v", i+1, err)
+		}
+		processors = append(processors, processor)
+	}
+
+	var sinks []Sink
+	closeSinks := func(sinks []Sink) {
+		for _, sink := range sinks {
+			if closer, ok := sink.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}
+	for _, spec := range config.Sinks {
+		sink, err := buildSink(spec)
+		if err != nil {
+			closeSinks(sinks)
+			return fmt.Errorf("输出 %s: %v", spec.Name, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	var dead *DeadLetterFile
+	if config.DeadLetters != "" {
+		var err error
+		if dead, err = OpenDeadLetterFile(config.DeadLetters); err != nil {
+			closeSinks(sinks)
+			return fmt.Errorf("死信: %v", err)
+		}
+	}
+
+	// 先关闭删除的和地址变化的来源
+	var errs []error
+	for name, running := range cp.sources {
+		if spec, exists := findSource(config.Sources, name); !exists || sourceRestartKey(spec) != running.restartKey {
+			if err := running.close(); err != nil {
+				errs = append(errs, fmt.Errorf("关闭来源 %s: %v", name, err))
+			}
+			delete(cp.sources, name)
+		}
+	}
+
+	pipelineConfig := PipelineConfig{Processors: processors, Sinks: append(sinks, cp.extraSinks...)}
+	if dead != nil {
+		pipelineConfig.DeadLetters = dead
+	}
+	cp.pipeline.Reconfigure(pipelineConfig)
+	closeSinks(cp.sinks) // 旧的输出已不再被写入，关闭时写出剩余的批次
+	if cp.dead != nil {
+		cp.dead.Close()
+	}
+	cp.sinks = sinks
+	cp.dead = dead
+
+	// 新的配置生效后再启动来源，来源的第一行就使用新的解析器、处理步骤和输出
+	for _, spec := range config.Sources {
+		cp.pipeline.SetSource(spec.Name, SourceConfig{Parser: parsers[spec.Name], Labels: sourceLabels(spec.Name, spec.Labels)})
+		if _, exists := cp.sources[spec.Name]; !exists {
+			running, err := cp.startSource(spec)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("启动来源 %s: %v", spec.Name, err))
+				continue
+			}
+			cp.sources[spec.Name] = running
+		}
+	}
+	cp.applied = data
+	return errors.Join(errs...)
+}
+
+func findSource(specs []SourceSpec, name string) (SourceSpec, bool) {
+	for _, spec := range specs {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return SourceSpec{}, false
+}
+
+// startSource 启动来源。file和stdin在后台读到结尾（文件只读一遍），dir按时间顺序读一遍目录中的文件，
+// syslog和http开始监听
+func (cp *ConfiguredPipeline) startSource(spec SourceSpec) (*runningSource, error) {
+	running := &runningSource{restartKey: sourceRestartKey(spec)}
+	switch spec.Type {
+	case "file", "stdin":
+		var reader io.ReadCloser = io.NopCloser(os.Stdin)
+		if spec.Type == "file" {
+			file, err := OpenLogFile(spec.Path)
+			if err != nil {
+				return nil, err
+			}
+			reader = file
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			defer reader.Close()
+			if err := cp.pipeline.Consume(ctx, spec.Name, reader); err != nil && ctx.Err() == nil {
+				log.Printf("读取来源 %s 失败: %v", spec.Name, err)
+			}
+		}()
+		running.close = func() error {
+			cancel()
+			return nil
+		}
+	case "dir":
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			config := BackfillConfig{Dir: spec.Path, Pattern: spec.Pattern, Source: spec.Name}
+			if _, err := cp.pipeline.Backfill(ctx, config); err != nil && ctx.Err() == nil {
+				log.Printf("读取来源 %s 失败: %v", spec.Name, err)
+			}
+		}()
+		running.close = func() error {
+			cancel()
+			return nil
+		}
+	case "syslog":
+		server, err := ListenSyslog(cp.pipeline, SyslogConfig{Name: spec.Name, UDPAddr: spec.UDP, TCPAddr: spec.TCP, Labels: spec.Labels})
+		if err != nil {
+			return nil, err
+		}
+		running.close = server.Close
+	case "http":
+		listener, err := net.Listen("tcp", spec.Listen)
+		if err != nil {
+			return nil, err
+		}
+		path := spec.Path
+		if path == "" {
+			path = "/ingest"
+		}
+		mux := http.NewServeMux()
+		mux.Handle(path, NewIngestHandler(cp.pipeline, IngestConfig{Name: spec.Name, Labels: spec.Labels}))
+		server := &http.Server{Handler: mux}
+		go server.Serve(listener)
+		running.close = server.Close
+	}
+	return running, nil
+}
+
+// Shutdown 关闭所有来源，排空管道后关闭按配置创建的输出
+func (cp *ConfiguredPipeline) Shutdown(ctx context.Context) error {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	for name, running := range cp.sources {
+		running.close()
+		delete(cp.sources, name)
+	}
+	err := cp.pipeline.Shutdown(ctx)
+	for _, sink := range cp.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	cp.sinks = nil
+	if cp.dead != nil {
+		cp.dead.Close()
+		cp.dead = nil
+	}
+	return err
+}
+
+// ReplayDeadLetters 把配置的死信文件中的行重新提交给管道，通常在修复解析器配置并热加载后调用
+func (cp *ConfiguredPipeline) ReplayDeadLetters(ctx context.Context) (int, error) {
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+	if cp.dead == nil {
+		return 0, fmt.Errorf("没有配置dead_letters")
+	}
+	return cp.pipeline.ReplayDeadLetters(ctx, cp.dead)
+}
+
+// runConfig 实现 run 子命令，按配置文件运行管道，收到SIGHUP或配置文件变化时热加载，
+// 收到SIGUSR1时重放死信，收到Ctrl+C或SIGTERM时排空后退出。指定 -tail 时在该地址提供
+// /tail 实时跟踪：
+//
+//	go run . run -config pipeline.yaml -reload 2s -tail :9090
+func runConfig(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	path := flags.String("config", "pipeline.yaml", "配置文件（YAML或JSON）")
+	interval := flags.Duration("reload", DefaultReloadInterval, "检查配置文件变化的间隔，0表示只在收到SIGHUP时重新加载")
+	tailAddr := flags.String("tail", "", "实时跟踪（WebSocket /tail）的监听地址，为空时不启用")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// 实时跟踪的连接在热加载之间保持，所以作为额外的Sink而不是配置中的输出
+	var extraSinks []Sink
+	if *tailAddr != "" {
+		hub := NewTailHub(0)
+		defer hub.Close()
+		mux := http.NewServeMux()
+		mux.Handle("/tail", hub)
+		server := &http.Server{Addr: *tailAddr, Handler: mux}
+		defer server.Close()
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("实时跟踪服务失败: %v", err)
+			}
+		}()
+		extraSinks = append(extraSinks, hub)
+	}
+
+	cp, err := StartConfiguredPipeline(*path, extraSinks...)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *interval > 0 {
+		go cp.Watch(ctx, *interval)
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+
+	for {
+		select {
+		case <-hup:
+			if _, err := cp.Reload(); err != nil {
+				log.Printf("加载配置 %s 失败: %v", *path, err)
+			}
+		case <-usr1:
+			count, err := cp.ReplayDeadLetters(ctx)
+			if err != nil {
+				log.Printf("重放死信失败: %v", err)
+			} else {
+				log.Printf("已重放%d条死信", count)
+			}
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return cp.Shutdown(shutdownCtx)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseYAMLSubset(t *testing.T) {
+	value, err := parseYAML(`
+# 注释
+name: "demo # 不是注释"
+count: 3
+ratio: 0.5
+enabled: true
+empty:
+tags: [a, 'b c', 1]
+labels: {env: prod, "team": ops}
+items:
+  - name: first
+    levels:
+      - ERROR
+      - WARN
+  - plain
+nested:
+  key: value   # 行尾注释
+`)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	expected := map[string]any{
+		"name":    "demo # 不是注释",
+		"count":   int64(3),
+		"ratio":   0.5,
+		"enabled": true,
+		"empty":   nil,
+		"tags":    []any{"a", "b c", int64(1)},
+		"labels":  map[string]any{"env": "prod", "team": "ops"},
+		"items": []any{
+			map[string]any{"name": "first", "levels": []any{"ERROR", "WARN"}},
+			"plain",
+		},
+		"nested": map[string]any{"key": "value"},
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("解析结果不正确:\n%#v", value)
+	}
+
+	for _, invalid := range []string{
+		"a: 1\na: 2",
+		"a:\n\tb: 1",
+		"a: |\n  text",
+		"a: [1, 2",
+		"a: 1\n  b: 2",
+	} {
+		if _, err := parseYAML(invalid); err == nil {
+			t.Errorf("应拒绝 %q", invalid)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`
+buffer_size: 10
+sources:
+  - name: app
+    type: file
+    path: app.log
+    parser: {type: json, time_layouts: [rfc3339, unix_ms], timezone: Asia/Shanghai}
+processors:
+  - type: filter
+    levels: [ERROR, WARN]
+sinks:
+  - name: out
+    type: file
+    path: out.jsonl
+    flush_interval: 500ms
+`))
+	if err != nil {
+		t.Fatalf("解析配置失败: %v", err)
+	}
+	if config.BufferSize != 10 || len(config.Sources) != 1 || config.Sources[0].Parser.Timezone != "Asia/Shanghai" {
+		t.Errorf("来源配置不正确: %+v", config)
+	}
+	if len(config.Processors) != 1 || !reflect.DeepEqual(config.Processors[0].Levels, []string{"ERROR", "WARN"}) {
+		t.Errorf("处理步骤配置不正确: %+v", config.Processors)
+	}
+	if time.Duration(config.Sinks[0].FlushInterval) != 500*time.Millisecond {
+		t.Errorf("时长应按字符串解析: %v", time.Duration(config.Sinks[0].FlushInterval))
+	}
+
+	// JSON格式同样可用，时长可以写成秒数
+	config, err = ParseConfig([]byte(`{"sinks": [{"name": "out", "type": "stdout", "flush_interval": 2}]}`))
+	if err != nil || time.Duration(config.Sinks[0].FlushInterval) != 2*time.Second {
+		t.Errorf("JSON配置解析不正确: %+v %v", config, err)
+	}
+
+	// 拼错的字段名应报错，而不是被静默忽略
+	if _, err := ParseConfig([]byte("sinks:\n  - name: out\n    typ: stdout\n")); err == nil {
+		t.Error("未知字段应报错")
+	}
+	if _, err := buildProcessor(ProcessorSpec{Type: "unknown"}); err == nil {
+		t.Error("未知的处理步骤类型应报错")
+	}
+}
+
+func TestConfiguredPipelineReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	first := writeFile("first.log", "2024-01-15 10:00:00 [INFO] 启动\n2024-01-15 10:00:01 [ERROR] 连接失败\n")
+	second := writeFile("second.log", "2024-01-15 10:00:02 [INFO] 用户 a@example.com 登录\n2024-01-15 10:00:03 [ERROR] 超时\n")
+	configPath := writeFile("pipeline.yaml", `
+sources:
+  - name: first
+    type: file
+    path: `+first+`
+processors:
+  - type: filter
+    levels: [ERROR]
+`)
+
+	sink := &memorySink{}
+	cp, err := StartConfiguredPipeline(configPath, sink)
+	if err != nil {
+		t.Fatalf("启动失败: %v", err)
+	}
+	// 等待count条日志流经filter阶段，atomic计数保证之后读取sink.entries没有数据竞争
+	waitProcessed := func(count int64) {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			stats := cp.Pipeline().Stats()
+			if stats.Written+stats.Dropped >= count {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("等待日志超时: %+v", stats)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitProcessed(2)
+	if got := messagesOf(sink.entries); got != "连接失败" {
+		t.Fatalf("只应保留ERROR: %s", got)
+	}
+
+	// 新增来源并替换处理步骤，已有的来源不会重新读取
+	writeFile("pipeline.yaml", `
+sources:
+  - name: first
+    type: file
+    path: `+first+`
+  - name: second
+    type: file
+    path: `+second+`
+    labels: {team: web}
+processors:
+  - type: filter
+    levels: [INFO]
+  - type: redact
+    rules: [email]
+`)
+	if changed, err := cp.Reload(); !changed || err != nil {
+		t.Fatalf("配置变化后应重新加载: %v %v", changed, err)
+	}
+	if changed, err := cp.Reload(); changed || err != nil {
+		t.Errorf("配置没有变化时不应重新加载: %v %v", changed, err)
+	}
+	waitProcessed(4)
+	if got := messagesOf(sink.entries); got != "连接失败,用户 [email] 登录" {
+		t.Errorf("新的处理步骤应对之后的日志生效: %s", got)
+	}
+	if last := sink.entries[len(sink.entries)-1]; last.Fields["team"] != "web" || last.Fields["source"] != "second" {
+		t.Errorf("新来源的标签不正确: %v", last.Fields)
+	}
+
+	// 无效的配置不生效，当前配置保持不变
+	writeFile("pipeline.yaml", "processors:\n  - type: filter\n    match: \"(\"\n")
+	if _, err := cp.Reload(); err == nil {
+		t.Error("无效的配置应返回错误")
+	}
+	if len(cp.sources) != 2 {
+		t.Errorf("加载失败时来源不应变化: %d", len(cp.sources))
+	}
+	if err := cp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if stats := cp.Pipeline().Stats(); stats.Written != 2 || stats.Dropped != 2 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+	if !strings.Contains(messagesOf(sink.entries), "连接失败") {
+		t.Error("关闭后已写入的日志应保留")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CorrelationField 提取出的关联ID统一保存到的字段
+const CorrelationField = "correlation_id"
+
+// DefaultCorrelationFields 默认依次查找关联ID的字段
+var DefaultCorrelationFields = []string{
+	CorrelationField, "trace_id", "traceId", "trace.id", "traceparent",
+	"request_id", "requestId", "req_id", "x_request_id", "x-request-id",
+}
+
+// correlationPattern 消息中 "trace_id=abc"、"requestId: abc"、"correlation-id=\"abc\"" 形式的ID
+var correlationPattern = regexp.MustCompile(`(?i)\b(?:trace|request|req|correlation)[_.-]?id["']?\s*[=:]\s*["']?([A-Za-z0-9][A-Za-z0-9._:-]*)`)
+
+// traceparentPattern W3C Trace Context的traceparent头：版本-trace-id-parent-id-标志
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// CorrelationExtractor 从字段或消息中提取trace ID、request ID等关联ID，统一写入CorrelationField。
+// 各服务用不同的字段名记录同一个请求的ID，统一后可以按一个字段关联和查询。实现了Processor接口
+type CorrelationExtractor struct {
+	Fields      []string // 依次查找的字段，为空时为DefaultCorrelationFields
+	FromMessage bool     // 字段中都没有时从消息中提取
+}
+
+// Process 实现Processor接口。已有CorrelationField的日志不变，只在提取到ID时复制Fields
+func (c CorrelationExtractor) Process(entry LogEntry) (LogEntry, bool) {
+	if entry.Fields[CorrelationField] != "" {
+		return entry, true
+	}
+	id := c.extract(entry)
+	if id == "" {
+		return entry, true
+	}
+	fields := make(map[string]string, len(entry.Fields)+1)
+	for key, value := range entry.Fields {
+		fields[key] = value
+	}
+	fields[CorrelationField] = id
+	entry.Fields = fields
+	return entry, true
+}
+
+// extract 返回日志的关联ID，没有时返回空字符串
+func (c CorrelationExtractor) extract(entry LogEntry) string {
+	fields := c.Fields
+	if len(fields) == 0 {
+		fields = DefaultCorrelationFields
+	}
+	for _, field := range fields {
+		if value := strings.TrimSpace(entry.Fields[field]); value != "" {
+			return normalizeCorrelationID(value)
+		}
+	}
+	if c.FromMessage {
+		if match := correlationPattern.FindStringSubmatch(entry.Message); match != nil {
+			return normalizeCorrelationID(strings.TrimRight(match[1], ".:-")) // 句末的标点不是ID的一部分
+		}
+	}
+	return ""
+}
+
+// normalizeCorrelationID traceparent只取其中的trace-id，与直接记录trace_id的服务一致
+func normalizeCorrelationID(value string) string {
+	if match := traceparentPattern.FindStringSubmatch(strings.ToLower(value)); match != nil {
+		return match[1]
+	}
+	return value
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCorrelationExtractor(t *testing.T) {
+	extractor := CorrelationExtractor{FromMessage: true}
+	cases := []struct {
+		entry    LogEntry
+		expected string
+	}{
+		{LogEntry{Fields: map[string]string{"trace_id": "abc123"}}, "abc123"},
+		{LogEntry{Fields: map[string]string{"requestId": " req-7 "}}, "req-7"},
+		{LogEntry{Fields: map[string]string{"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}}, "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{LogEntry{Message: "调用下游失败 request_id=r-42."}, "r-42"},
+		{LogEntry{Message: `traceId: "t-9" 开始处理`}, "t-9"},
+		{LogEntry{Fields: map[string]string{CorrelationField: "kept", "trace_id": "other"}}, "kept"},
+		{LogEntry{Message: "没有关联ID"}, ""},
+	}
+	for _, c := range cases {
+		entry, ok := extractor.Process(c.entry)
+		if !ok || entry.Fields[CorrelationField] != c.expected {
+			t.Errorf("%+v 的关联ID应为 %q: %q", c.entry, c.expected, entry.Fields[CorrelationField])
+		}
+	}
+
+	// 只查找指定的字段，不修改上游的Fields
+	upstream := map[string]string{"trace_id": "a", "span": "b"}
+	entry, _ := CorrelationExtractor{Fields: []string{"span"}}.Process(LogEntry{Fields: upstream})
+	if entry.Fields[CorrelationField] != "b" || len(upstream) != 2 {
+		t.Errorf("应只按指定字段提取且不修改原map: %v %v", entry.Fields, upstream)
+	}
+	if entry, _ := (CorrelationExtractor{}).Process(LogEntry{Message: "trace_id=x"}); entry.Fields != nil {
+		t.Errorf("未开启FromMessage时不应从消息提取: %v", entry.Fields)
+	}
+}
+
+func TestGroupByCorrelation(t *testing.T) {
+	processor := NewLogProcessor()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	write := func(second int, service, id, message string) {
+		processor.Write(LogEntry{
+			Timestamp: base.Add(time.Duration(second) * time.Second),
+			Level:     "INFO",
+			Message:   message,
+			Fields:    map[string]string{"service": service, CorrelationField: id},
+		})
+	}
+	write(1, "gateway", "r1", "收到请求")
+	write(2, "gateway", "r2", "收到请求")
+	write(4, "db", "r1", "查询订单")
+	write(3, "order", "r1", "创建订单") // 来自另一台机器，晚到但时间更早
+	write(5, "gateway", "r1", "返回响应")
+
+	if got := messagesOf(processor.GroupByCorrelation("r1")); got != "收到请求,创建订单,查询订单,返回响应" {
+		t.Errorf("应按时间返回同一请求在各服务的日志: %s", got)
+	}
+	if len(processor.GroupByCorrelation("r3")) != 0 || len(processor.GroupByCorrelation("")) != 0 {
+		t.Error("不存在的关联ID应返回空")
+	}
+	result := processor.Query(QueryFilter{Correlation: "r1", Contains: "订单", Fields: map[string]string{"service": "db"}})
+	if messagesOf(result.Entries) != "查询订单" {
+		t.Errorf("关联ID应能与其他条件组合: %s", messagesOf(result.Entries))
+	}
+
+	// 淘汰的日志同步移出关联索引
+	processor.SetMaxEntries(3)
+	if got := messagesOf(processor.GroupByCorrelation("r1")); got != "创建订单,查询订单,返回响应" {
+		t.Errorf("淘汰后应只剩内存中的日志: %s", got)
+	}
+	if len(processor.GroupByCorrelation("r2")) != 0 {
+		t.Error("r2已被淘汰")
+	}
+}
+
+func TestCorrelationAcrossSources(t *testing.T) {
+	processor := NewLogProcessor()
+	pipeline := NewPipeline(PipelineConfig{Processors: []Processor{CorrelationExtractor{FromMessage: true}}, Sinks: []Sink{processor}})
+	pipeline.SetSource("api", SourceConfig{Parser: NewJSONParser(), Labels: map[string]string{"source": "api"}})
+	pipeline.SetSource("worker", SourceConfig{Labels: map[string]string{"source": "worker"}})
+	ctx := context.Background()
+	pipeline.SubmitFrom(ctx, "api", `{"ts": "2024-01-15T10:00:00Z", "level": "info", "msg": "下单", "trace_id": "t1"}`)
+	pipeline.SubmitFrom(ctx, "worker", "2024-01-15 10:00:02 [ERROR] 发货失败 trace_id=t1")
+	pipeline.SubmitFrom(ctx, "api", `{"ts": "2024-01-15T10:00:01Z", "level": "info", "msg": "无关请求", "trace_id": "t2"}`)
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	group := processor.GroupByCorrelation("t1")
+	if messagesOf(group) != "下单,发货失败 trace_id=t1" || group[1].Fields["source"] != "worker" {
+		t.Errorf("不同来源的同一请求应关联在一起: %v", group)
+	}
+
+	recorder := httptest.NewRecorder()
+	processor.QueryHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/query?correlation=t1&level=error", nil))
+	var result QueryResult
+	if err := json.NewDecoder(recorder.Body).Decode(&result); err != nil || messagesOf(result.Entries) != "发货失败 trace_id=t1" {
+		t.Errorf("HTTP查询应支持correlation参数: %+v %v", result, err)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DeadLetter 一行无法解析的原始日志
+type DeadLetter struct {
+	Time   time.Time `json:"time"`   // 进入死信的时间
+	Source string    `json:"source"` // 来源名，Submit提交的行为空
+	Line   string    `json:"line"`
+	Reason string    `json:"reason"` // 无法解析的原因，见ParseErrorer
+}
+
+// DeadLetterStore 保存死信，修复解析器后由Pipeline.ReplayDeadLetters取出重新处理
+type DeadLetterStore interface {
+	WriteDeadLetter(letter DeadLetter) error
+	Drain() ([]DeadLetter, error) // 取出并删除全部死信
+}
+
+// DeadLetterFile 以JSON行保存死信的文件，进程重启后死信仍然保留
+type DeadLetterFile struct {
+	path  string
+	file  *os.File
+	count int
+	mutex sync.Mutex
+}
+
+// OpenDeadLetterFile 打开或创建死信文件，已有的死信保留
+func OpenDeadLetterFile(path string) (*DeadLetterFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &DeadLetterFile{path: path, file: file}
+	letters, err := f.read()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.count = len(letters)
+	return f, nil
+}
+
+// WriteDeadLetter 实现DeadLetterStore接口，追加一行死信
+func (f *DeadLetterFile) WriteDeadLetter(letter DeadLetter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if _, err := f.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入死信 %s 失败: %v", f.path, err)
+	}
+	f.count++
+	return nil
+}
+
+// Len 返回文件中的死信条数
+func (f *DeadLetterFile) Len() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.count
+}
+
+// Drain 实现DeadLetterStore接口，读出全部死信后清空文件
+func (f *DeadLetterFile) Drain() ([]DeadLetter, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	letters, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.file.Truncate(0); err != nil {
+		return nil, err
+	}
+	f.count = 0
+	return letters, nil
+}
+
+// read 从头读取全部死信，调用方需持有mutex或独占文件
+func (f *DeadLetterFile) read() ([]DeadLetter, error) {
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(f.file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return nil, fmt.Errorf("死信 %s 第%d条格式错误: %v", f.path, len(letters)+1, err)
+		}
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return letters, nil
+}
+
+// Close 关闭文件
+func (f *DeadLetterFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.file.Close()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseErrorReasons(t *testing.T) {
+	regex, _ := NewRegexParser(`^(?P<level>\w+): (?P<message>.*)$`)
+	multiline, _ := NewMultilineParser(lineParser{}, `^\d{4}-`)
+	cases := []struct {
+		parser Parser
+		line   string
+		reason string
+	}{
+		{lineParser{}, "只有消息", "日期 时间 [级别] 消息"},
+		{lineParser{}, "2024-13-45 10:00:00 [INFO] 日期错误", `时间 "2024-13-45 10:00:00" 无法解析`},
+		{NewJSONParser(), "{不是JSON", "不是合法的JSON对象"},
+		{NewJSONParser(), `{"user": "a"}`, "缺少级别和消息字段"},
+		{NewJSONParser(), `{"msg": "x", "ts": "昨天"}`, `字段 ts 的时间 "昨天" 无法解析`},
+		{NewLogfmtParser(), `level="未闭合`, "不是合法的logfmt"},
+		{regex, "没有冒号", "与正则"},
+		{multiline, "\tat Main.run", "续行之前没有日志"},
+		{ParserFunc(func(string) (LogEntry, bool) { return LogEntry{}, false }), "x", "格式不正确"},
+	}
+	for _, c := range cases {
+		if reason := parseFailure(c.parser, c.line); !strings.Contains(reason, c.reason) {
+			t.Errorf("%q 的原因应包含 %q: %s", c.line, c.reason, reason)
+		}
+	}
+	if err := NewJSONParser().ParseError(`{"level": "info", "msg": "ok"}`); err != nil {
+		t.Errorf("能解析的行不应返回错误: %v", err)
+	}
+}
+
+func TestPipelineDeadLetters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead", "letters.jsonl")
+	store, err := OpenDeadLetterFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}, DeadLetters: store})
+	pipeline.SetSource("api", SourceConfig{Parser: NewJSONParser()})
+	ctx := context.Background()
+	pipeline.SubmitFrom(ctx, "api", `{"level": "info", "msg": "正常"}`)
+	pipeline.SubmitFrom(ctx, "api", "level=info msg=格式不对")
+	pipeline.Submit(ctx, "垃圾行")
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := pipeline.Stats()
+	if stats.Invalid != 2 || stats.DeadLetters != 2 || stats.Written != 1 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+	// 重新打开后死信仍在
+	reopened, err := OpenDeadLetterFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if reopened.Len() != 2 {
+		t.Fatalf("死信应持久化到文件: %d", reopened.Len())
+	}
+	letters, err := reopened.Drain()
+	if err != nil || len(letters) != 2 {
+		t.Fatalf("取出死信失败: %v %v", letters, err)
+	}
+	first := letters[0]
+	if first.Source != "api" || first.Line != "level=info msg=格式不对" || !strings.HasPrefix(first.Reason, "不是合法的JSON对象") || first.Time.IsZero() {
+		t.Errorf("死信应包含来源、原始行、原因和时间: %+v", first)
+	}
+	if letters[1].Source != "" || letters[1].Line != "垃圾行" {
+		t.Errorf("Submit提交的死信来源应为空: %+v", letters[1])
+	}
+	if reopened.Len() != 0 {
+		t.Errorf("Drain后应清空: %d", reopened.Len())
+	}
+}
+
+func TestReplayDeadLetters(t *testing.T) {
+	store, err := OpenDeadLetterFile(filepath.Join(t.TempDir(), "letters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}, DeadLetters: store})
+	pipeline.SetSource("api", SourceConfig{Parser: NewJSONParser()})
+	ctx := context.Background()
+	for _, line := range []string{"level=info msg=一", "level=error msg=二", "仍然无法解析"} {
+		pipeline.SubmitFrom(ctx, "api", line)
+	}
+	for deadline := time.Now().Add(2 * time.Second); pipeline.Stats().DeadLetters < 3; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待死信超时: %+v", pipeline.Stats())
+		}
+	}
+
+	// 修复解析器后重放，仍然无法解析的行回到死信
+	pipeline.SetSource("api", SourceConfig{Parser: NewLogfmtParser(), Labels: map[string]string{"source": "api"}})
+	count, err := pipeline.ReplayDeadLetters(ctx, store)
+	if err != nil || count != 3 {
+		t.Fatalf("应重放3条: %d %v", count, err)
+	}
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := messagesOf(sink.entries); got != "一,二" {
+		t.Errorf("修复后的行应到达输出: %s", got)
+	}
+	if sink.entries[0].Fields["source"] != "api" {
+		t.Errorf("重放的日志应使用来源的标签: %v", sink.entries[0].Fields)
+	}
+	if store.Len() != 1 || pipeline.Stats().DeadLetters != 4 {
+		t.Errorf("仍然无法解析的行应回到死信: %d %+v", store.Len(), pipeline.Stats())
+	}
+
+	// 管道关闭后重放失败，死信放回store
+	if _, err := pipeline.ReplayDeadLetters(ctx, store); err == nil || store.Len() != 1 {
+		t.Errorf("重放失败时死信应放回: %v %d", err, store.Len())
+	}
+}
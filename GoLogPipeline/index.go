@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultQueryLimit 查询默认每页返回的条数
+const DefaultQueryLimit = 100
+
+// QueryFilter 查询条件，零值字段表示不限制
+type QueryFilter struct {
+	From        time.Time         // 时间下限（含）
+	To          time.Time         // 时间上限（不含）
+	Levels      []string          // 匹配任一级别，不区分大小写
+	Contains    string            // 全文检索，消息必须包含其中的每个词
+	Fields      map[string]string // 字段精确匹配
+	Correlation string            // 关联ID，只返回CorrelationField等于它的日志
+	Descending  bool              // 为true时从最新的日志开始返回
+	Offset      int               // 跳过的条数
+	Limit       int               // 每页条数，<=0时为DefaultQueryLimit
+}
+
+// QueryResult 查询结果的一页
+type QueryResult struct {
+	Entries []LogEntry `json:"entries"`
+	Total   int        `json:"total"` // 满足条件的总条数
+	Offset  int        `json:"offset"`
+	Limit   int        `json:"limit"`
+	HasMore bool       `json:"has_more"`
+}
+
+// timelineRef 时间线上的一条日志，按时间排序，时间相同时按加入顺序
+type timelineRef struct {
+	timestamp time.Time
+	id        uint64
+}
+
+func (r timelineRef) before(other timelineRef) bool {
+	if r.timestamp.Equal(other.timestamp) {
+		return r.id < other.id
+	}
+	return r.timestamp.Before(other.timestamp)
+}
+
+// LogIndex 日志的内存索引：按时间排序的时间线、消息词的倒排索引和关联ID的索引。
+// 日志按加入顺序编号，淘汰时从最早加入的开始。不是并发安全的，由调用方加锁
+type LogIndex struct {
+	docs     map[uint64]LogEntry
+	timeline []timelineRef
+	postings map[string][]uint64 // 词 → 日志编号（递增），淘汰的编号在压缩前仍会留在其中
+	// correlations 关联ID → 日志编号（递增），淘汰时立即移除
+	correlations map[string][]uint64
+	nextID       uint64
+	oldest       uint64
+	stale        int // 倒排索引中已淘汰的编号数
+	live         int // 倒排索引中有效的编号数
+}
+
+// NewLogIndex 创建空索引
+func NewLogIndex() *LogIndex {
+	return &LogIndex{
+		docs:         make(map[uint64]LogEntry),
+		postings:     make(map[string][]uint64),
+		correlations: make(map[string][]uint64),
+	}
+}
+
+// tokenize 把文本切分为小写的词：字母数字连续的部分为一个词，汉字等没有空格分隔的文字每个字为一个词
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// uniqueTokens 去重后的词
+func uniqueTokens(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, token := range tokenize(text) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Add 加入一条日志
+func (idx *LogIndex) Add(entry LogEntry) {
+	id := idx.nextID
+	idx.nextID++
+	idx.docs[id] = entry
+
+	// 日志通常按时间顺序到达，只有乱序的日志需要插入
+	ref := timelineRef{timestamp: entry.Timestamp, id: id}
+	if n := len(idx.timeline); n == 0 || !ref.before(idx.timeline[n-1]) {
+		idx.timeline = append(idx.timeline, ref)
+	} else {
+		i := sort.Search(n, func(i int) bool { return ref.before(idx.timeline[i]) })
+		idx.timeline = append(idx.timeline, timelineRef{})
+		copy(idx.timeline[i+1:], idx.timeline[i:])
+		idx.timeline[i] = ref
+	}
+
+	for _, token := range uniqueTokens(entry.Message) {
+		idx.postings[token] = append(idx.postings[token], id)
+		idx.live++
+	}
+	if correlation := entry.Fields[CorrelationField]; correlation != "" {
+		idx.correlations[correlation] = append(idx.correlations[correlation], id)
+	}
+}
+
+// EvictOldest 淘汰最早加入的n条日志
+func (idx *LogIndex) EvictOldest(n int) {
+	for ; n > 0 && idx.oldest < idx.nextID; n-- {
+		id := idx.oldest
+		idx.oldest++
+		entry, exists := idx.docs[id]
+		if !exists {
+			continue
+		}
+		delete(idx.docs, id)
+
+		ref := timelineRef{timestamp: entry.Timestamp, id: id}
+		i := sort.Search(len(idx.timeline), func(i int) bool { return !idx.timeline[i].before(ref) })
+		idx.timeline = append(idx.timeline[:i], idx.timeline[i+1:]...)
+
+		tokens := len(uniqueTokens(entry.Message))
+		idx.live -= tokens
+		idx.stale += tokens
+
+		// 按加入顺序淘汰，被淘汰的总是该关联ID最早的一条
+		if correlation := entry.Fields[CorrelationField]; correlation != "" {
+			if ids := idx.correlations[correlation]; len(ids) > 1 {
+				idx.correlations[correlation] = ids[1:]
+			} else {
+				delete(idx.correlations, correlation)
+			}
+		}
+	}
+	if idx.stale > idx.live {
+		idx.compact()
+	}
+}
+
+// compact 从倒排索引中去掉已淘汰的编号
+func (idx *LogIndex) compact() {
+	for token, ids := range idx.postings {
+		i := sort.Search(len(ids), func(i int) bool { return ids[i] >= idx.oldest })
+		if i == len(ids) {
+			delete(idx.postings, token)
+			continue
+		}
+		idx.postings[token] = append([]uint64(nil), ids[i:]...)
+	}
+	idx.stale = 0
+}
+
+// Len 返回索引中的日志条数
+func (idx *LogIndex) Len() int {
+	return len(idx.docs)
+}
+
+// candidates 用倒排索引找出包含全部词（以及关联ID）的日志，按时间线顺序返回；
+// 没有检索词和关联ID时返回时间范围内的全部日志
+func (idx *LogIndex) candidates(filter QueryFilter) []timelineRef {
+	lo, hi := 0, len(idx.timeline)
+	if !filter.From.IsZero() {
+		lo = sort.Search(len(idx.timeline), func(i int) bool { return !idx.timeline[i].timestamp.Before(filter.From) })
+	}
+	if !filter.To.IsZero() {
+		hi = sort.Search(len(idx.timeline), func(i int) bool { return !idx.timeline[i].timestamp.Before(filter.To) })
+	}
+	if lo >= hi {
+		return nil
+	}
+
+	tokens := uniqueTokens(filter.Contains)
+	if len(tokens) == 0 && filter.Correlation == "" {
+		return idx.timeline[lo:hi]
+	}
+
+	// 从最短的倒排列表开始求交集
+	lists := make([][]uint64, 0, len(tokens)+1)
+	for _, token := range tokens {
+		lists = append(lists, idx.postings[token])
+	}
+	if filter.Correlation != "" {
+		lists = append(lists, idx.correlations[filter.Correlation])
+	}
+	for _, list := range lists {
+		if len(list) == 0 {
+			return nil
+		}
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	matched := make(map[uint64]bool)
+	for _, id := range lists[0] {
+		if id >= idx.oldest {
+			matched[id] = true
+		}
+	}
+	for _, list := range lists[1:] {
+		next := make(map[uint64]bool, len(matched))
+		for _, id := range list {
+			if matched[id] {
+				next[id] = true
+			}
+		}
+		matched = next
+	}
+
+	refs := make([]timelineRef, 0, len(matched))
+	for id := range matched {
+		entry := idx.docs[id]
+		ref := timelineRef{timestamp: entry.Timestamp, id: id}
+		if (filter.From.IsZero() || !ref.timestamp.Before(filter.From)) && (filter.To.IsZero() || ref.timestamp.Before(filter.To)) {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].before(refs[j]) })
+	return refs
+}
+
+// matches 检查级别、字段和检索词的连续出现（汉字按字索引，词组需要原样出现在消息中）
+func matches(entry LogEntry, filter QueryFilter, levels map[string]bool, phrases []string) bool {
+	if len(levels) > 0 && !levels[strings.ToUpper(entry.Level)] {
+		return false
+	}
+	for key, value := range filter.Fields {
+		if actual, exists := entry.Fields[key]; !exists || actual != value {
+			return false
+		}
+	}
+	if len(phrases) > 0 {
+		message := strings.ToLower(entry.Message)
+		for _, phrase := range phrases {
+			if !strings.Contains(message, phrase) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Query 按条件查询并分页，结果按时间排序
+func (idx *LogIndex) Query(filter QueryFilter) QueryResult {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultQueryLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	levels := make(map[string]bool, len(filter.Levels))
+	for _, level := range filter.Levels {
+		levels[strings.ToUpper(level)] = true
+	}
+	// 切分出多个词的检索词（如连续的汉字、disk-full）需要原样出现，单个词已由倒排索引按整词匹配
+	var phrases []string
+	for _, term := range strings.Fields(strings.ToLower(filter.Contains)) {
+		if len(tokenize(term)) > 1 {
+			phrases = append(phrases, term)
+		}
+	}
+
+	refs := idx.candidates(filter)
+	result := QueryResult{Offset: filter.Offset, Limit: filter.Limit, Entries: []LogEntry{}}
+	for i := range refs {
+		ref := refs[i]
+		if filter.Descending {
+			ref = refs[len(refs)-1-i]
+		}
+		entry := idx.docs[ref.id]
+		if !matches(entry, filter, levels, phrases) {
+			continue
+		}
+		if result.Total >= filter.Offset && len(result.Entries) < filter.Limit {
+			result.Entries = append(result.Entries, entry)
+		}
+		result.Total++
+	}
+	result.HasMore = filter.Offset+len(result.Entries) < result.Total
+	return result
+}
+
+// Correlated 返回关联ID为id的全部日志，按时间排序
+func (idx *LogIndex) Correlated(id string) []LogEntry {
+	if id == "" {
+		return nil
+	}
+	refs := idx.candidates(QueryFilter{Correlation: id})
+	entries := make([]LogEntry, len(refs))
+	for i, ref := range refs {
+		entries[i] = idx.docs[ref.id]
+	}
+	return entries
+}
+
+// ParseQueryFilter 从URL参数解析查询条件：
+// from、to（RFC3339、"2006-01-02 15:04:05"或"2006-01-02"），level（可重复或逗号分隔），q，
+// field=key:value（可重复），correlation，order=desc，offset，limit
+func ParseQueryFilter(r *http.Request) (QueryFilter, error) {
+	values := r.URL.Query()
+	var filter QueryFilter
+	var err error
+	if filter.From, err = parseReplayTime(values.Get("from")); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseReplayTime(values.Get("to")); err != nil {
+		return filter, err
+	}
+	for _, level := range values["level"] {
+		for _, l := range strings.Split(level, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				filter.Levels = append(filter.Levels, l)
+			}
+		}
+	}
+	filter.Contains = values.Get("q")
+	filter.Correlation = values.Get("correlation")
+	for _, field := range values["field"] {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok {
+			return filter, fmt.Errorf("字段条件 %q 应为 key:value", field)
+		}
+		if filter.Fields == nil {
+			filter.Fields = make(map[string]string)
+		}
+		filter.Fields[key] = value
+	}
+	filter.Descending = values.Get("order") == "desc"
+	for name, target := range map[string]*int{"offset": &filter.Offset, "limit": &filter.Limit} {
+		if value := values.Get(name); value != "" {
+			if *target, err = strconv.Atoi(value); err != nil {
+				return filter, fmt.Errorf("%s 不是整数: %q", name, value)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// QueryHandler 返回查询日志的HTTP处理器，参数见ParseQueryFilter，结果为JSON格式的QueryResult
+func (lp *LogProcessor) QueryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter, err := ParseQueryFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(lp.Query(filter))
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func messagesOf(entries []LogEntry) string {
+	messages := make([]string, len(entries))
+	for i, entry := range entries {
+		messages[i] = entry.Message
+	}
+	return strings.Join(messages, ",")
+}
+
+func TestQueryTimeRangeLevelsAndFields(t *testing.T) {
+	processor := NewLogProcessor()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, level := range []string{"INFO", "ERROR", "WARN", "ERROR", "INFO", "error"} {
+		processor.Write(LogEntry{
+			Timestamp: base.Add(time.Duration(i) * time.Minute),
+			Level:     level,
+			Message:   fmt.Sprintf("m%d", i),
+			Fields:    map[string]string{"service": []string{"api", "db"}[i%2]},
+		})
+	}
+	// 乱序到达的日志按时间排在前面
+	processor.Write(LogEntry{Timestamp: base.Add(-time.Minute), Level: "ERROR", Message: "late", Fields: map[string]string{"service": "db"}})
+
+	all := processor.Query(QueryFilter{})
+	if messagesOf(all.Entries) != "late,m0,m1,m2,m3,m4,m5" || all.Total != 7 || all.HasMore {
+		t.Errorf("应按时间排序返回全部日志: %+v", all)
+	}
+	ranged := processor.Query(QueryFilter{From: base.Add(time.Minute), To: base.Add(4 * time.Minute)})
+	if messagesOf(ranged.Entries) != "m1,m2,m3" {
+		t.Errorf("时间范围应为[From, To): %s", messagesOf(ranged.Entries))
+	}
+	errors := processor.Query(QueryFilter{Levels: []string{"error", "warn"}, Fields: map[string]string{"service": "db"}})
+	if messagesOf(errors.Entries) != "late,m1,m3,m5" {
+		t.Errorf("级别不区分大小写，字段精确匹配: %s", messagesOf(errors.Entries))
+	}
+
+	// 分页和倒序
+	page := processor.Query(QueryFilter{Levels: []string{"ERROR"}, Descending: true, Offset: 1, Limit: 2})
+	if messagesOf(page.Entries) != "m3,m1" || page.Total != 4 || !page.HasMore {
+		t.Errorf("倒序分页不正确: %+v", page)
+	}
+	last := processor.Query(QueryFilter{Levels: []string{"ERROR"}, Descending: true, Offset: 3, Limit: 2})
+	if messagesOf(last.Entries) != "late" || last.HasMore {
+		t.Errorf("最后一页不正确: %+v", last)
+	}
+	if empty := processor.Query(QueryFilter{From: base.Add(time.Hour)}); len(empty.Entries) != 0 || empty.Total != 0 {
+		t.Errorf("范围外没有日志: %+v", empty)
+	}
+}
+
+func TestQueryFullText(t *testing.T) {
+	processor := NewLogProcessor()
+	for _, line := range []string{
+		"2024-01-15 10:30:15 [ERROR] Payment timeout for order 42",
+		"2024-01-15 10:30:16 [WARN] 支付失败，稍后重试",
+		"2024-01-15 10:30:17 [ERROR] disk-full on /data",
+		"2024-01-15 10:30:18 [INFO] 失败的支付已退款",
+		"2024-01-15 10:30:19 [ERROR] timeouts exceeded",
+	} {
+		processor.ProcessLog(line)
+	}
+
+	cases := map[string]string{
+		"timeout":        "Payment timeout for order 42", // 按整词匹配，不匹配timeouts
+		"PAYMENT order":  "Payment timeout for order 42", // 不区分大小写，每个词都要出现
+		"支付失败":           "支付失败，稍后重试",                    // 汉字词组需要连续出现
+		"支付":             "支付失败，稍后重试,失败的支付已退款",
+		"disk-full":      "disk-full on /data",
+		"timeout refund": "",
+		"不存在":            "",
+	}
+	for query, want := range cases {
+		if got := messagesOf(processor.Query(QueryFilter{Contains: query}).Entries); got != want {
+			t.Errorf("检索 %q 期望 %q，实际 %q", query, want, got)
+		}
+	}
+
+	// 淘汰的日志不再能被检索到
+	processor.SetMaxEntries(2)
+	if got := processor.Query(QueryFilter{Contains: "支付"}); messagesOf(got.Entries) != "失败的支付已退款" || got.Total != 1 {
+		t.Errorf("淘汰的日志不应出现在结果中: %+v", got)
+	}
+	if got := processor.Query(QueryFilter{}); got.Total != 2 || processor.index.Len() != 2 {
+		t.Errorf("索引应与保留的日志一致: %+v", got)
+	}
+	for token, ids := range processor.index.postings {
+		for _, id := range ids {
+			if _, exists := processor.index.docs[id]; !exists {
+				t.Fatalf("压缩后倒排索引中仍有淘汰的日志: %s", token)
+			}
+		}
+	}
+}
+
+func TestQueryHandler(t *testing.T) {
+	processor := NewLogProcessor()
+	for i := 0; i < 5; i++ {
+		processor.Write(LogEntry{
+			Timestamp: time.Date(2024, 1, 15, 10, 30, i, 0, time.UTC),
+			Level:     []string{"INFO", "ERROR"}[i%2],
+			Message:   fmt.Sprintf("request %d failed", i),
+			Fields:    map[string]string{"host": "web-1"},
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	processor.QueryHandler().ServeHTTP(rec, httptest.NewRequest("GET",
+		"/query?from=2024-01-15T10:30:01Z&level=error,warn&q=failed&field=host:web-1&order=desc&limit=1", nil))
+	var result QueryResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("响应应为JSON: %s", rec.Body.String())
+	}
+	if result.Total != 2 || len(result.Entries) != 1 || result.Entries[0].Message != "request 3 failed" || !result.HasMore {
+		t.Errorf("HTTP查询结果不正确: %+v", result)
+	}
+
+	for _, query := range []string{"from=昨天", "limit=x", "field=host"} {
+		rec := httptest.NewRecorder()
+		processor.QueryHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/query?"+query, nil))
+		if rec.Code != 400 {
+			t.Errorf("参数 %s 应返回400，实际%d", query, rec.Code)
+		}
+	}
+}
@@ -12,11 +12,11 @@ func TestLogProcessor(t *testing.T) {
 	testLog := "2024-01-15 10:30:15 [INFO] 测试消息"
 	processor.ProcessLog(testLog)
 
-	if len(processor.entries) != 1 {
-		t.Errorf("期望1条日志，实际%d条", len(processor.entries))
+	if len(processor.Entries()) != 1 {
+		t.Errorf("期望1条日志，实际%d条", len(processor.Entries()))
 	}
 
-	entry := processor.entries[0]
+	entry := processor.Entries()[0]
 	if entry.Level != "INFO" {
 		t.Errorf("期望级别INFO，实际%s", entry.Level)
 	}
@@ -91,7 +91,7 @@ func TestFileReader(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if len(processor.entries) != 2 {
-		t.Errorf("期望读取2条日志，实际%d条", len(processor.entries))
+	if len(processor.Entries()) != 2 {
+		t.Errorf("期望读取2条日志，实际%d条", len(processor.Entries()))
 	}
 }
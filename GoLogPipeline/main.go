@@ -2,74 +2,279 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 // LogEntry 日志条目结构
 type LogEntry struct {
-	Timestamp time.Time
-	Level     string
-	Message   string
+	Timestamp time.Time         `json:"timestamp"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	Tenant    string            `json:"tenant,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"` // 处理步骤补充的字段
 }
 
-// LogProcessor 日志处理器
+// DefaultMaxEntries LogProcessor默认保留的日志条数
+const DefaultMaxEntries = 10000
+
+// LogProcessor 日志处理器，在环形缓冲区中只保留最近的MaxEntries条（或MaxBytes字节）日志，
+// 开启溢写后淘汰的日志写入磁盘段文件而不是直接丢弃。
+// 实现了Sink接口，可以作为并发管道Pipeline的输出
 type LogProcessor struct {
-	logChan chan string
-	entries []LogEntry
+	buffer    *RingBuffer
+	index     *LogIndex
+	spill     *SpillStore
+	spillErr  error
+	evicted   int
+	parser    Parser
+	assembler lineAssembler
+	invalid   int
+	mutex     sync.Mutex
 }
 
-// NewLogProcessor 创建日志处理器
+// NewLogProcessor 创建日志处理器，默认按 "日期 时间 [级别] 消息" 格式解析
 func NewLogProcessor() *LogProcessor {
 	return &LogProcessor{
-		logChan: make(chan string, 100),
-		entries: make([]LogEntry, 0),
+		buffer: NewRingBuffer(DefaultMaxEntries, 0),
+		index:  NewLogIndex(),
+		parser: lineParser{},
 	}
 }
 
-// ProcessLog 处理单条日志
-func (lp *LogProcessor) ProcessLog(line string) {
-	// 简单的日志解析：格式 "[时间] [级别] 消息"
-	parts := strings.SplitN(line, " ", 3)
-	if len(parts) < 3 {
-		return
+// SetMaxEntries 设置保留的日志条数，超出时淘汰最旧的日志，<=0表示不限制
+func (lp *LogProcessor) SetMaxEntries(n int) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	lp.evict(lp.buffer.SetLimits(n, lp.buffer.maxBytes))
+}
+
+// SetMaxBytes 设置保留日志的估算字节数上限，超出时淘汰最旧的日志，<=0表示不限制
+func (lp *LogProcessor) SetMaxBytes(n int64) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	lp.evict(lp.buffer.SetLimits(lp.buffer.maxEntries, n))
+}
+
+// EnableSpill 开启溢写：之后从内存淘汰的日志写入dir下的段文件，可以通过ScanAll读回
+func (lp *LogProcessor) EnableSpill(dir string, config SpillConfig) error {
+	store, err := OpenSpillStore(dir, config)
+	if err != nil {
+		return err
 	}
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.spill != nil {
+		lp.spill.Close()
+	}
+	lp.spill = store
+	return nil
+}
 
-	timestamp, err := time.Parse("2006-01-02 15:04:05", parts[0])
+// SetParser 替换解析器，例如读取JSON格式的日志文件时使用NewJSONParser()
+func (lp *LogProcessor) SetParser(parser Parser) {
+	lp.parser = parser
+}
+
+// ParseLine 解析单条日志，格式 "日期 时间 [级别] 消息"
+func ParseLine(line string) (LogEntry, bool) {
+	entry, err := parseLine(line)
+	return entry, err == nil
+}
+
+// parseLine 解析单条日志，无法解析时返回原因
+func parseLine(line string) (LogEntry, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 4 {
+		return LogEntry{}, fmt.Errorf("应为 \"日期 时间 [级别] 消息\"")
+	}
+
+	timestamp, err := time.Parse("2006-01-02 15:04:05", parts[0]+" "+parts[1])
 	if err != nil {
-		return
+		return LogEntry{}, fmt.Errorf("时间 %q 无法解析", parts[0]+" "+parts[1])
 	}
 
-	entry := LogEntry{
+	return LogEntry{
 		Timestamp: timestamp,
-		Level:     strings.Trim(parts[1], "[]"),
-		Message:   parts[2],
+		Level:     strings.Trim(parts[2], "[]"),
+		Message:   parts[3],
+	}, nil
+}
+
+// lineParser 按ParseLine解析的默认解析器，实现了ParseErrorer
+type lineParser struct{}
+
+// Parse 实现Parser接口
+func (lineParser) Parse(line string) (LogEntry, bool) {
+	return ParseLine(line)
+}
+
+// ParseError 实现ParseErrorer接口
+func (lineParser) ParseError(line string) error {
+	_, err := parseLine(line)
+	return err
+}
+
+// ProcessLog 处理单条日志，无法解析的日志计入Invalid。
+// 使用多行解析器时，日志在下一条日志开始或Flush时才加入
+func (lp *LogProcessor) ProcessLog(line string) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	done, _, valid := lp.assembler.feed(lp.parser, line)
+	if !valid {
+		lp.invalid++
+		fmt.Printf("无法解析的日志: %s\n", line)
+		return
+	}
+	if done != nil {
+		lp.add(done.entry)
+	}
+}
+
+// Flush 加入还在等待续行的多行日志，输入结束时调用
+func (lp *LogProcessor) Flush() {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	if done := lp.assembler.flush(); done != nil {
+		lp.add(done.entry)
 	}
+}
+
+// Write 实现Sink接口，加入已经解析好的日志
+func (lp *LogProcessor) Write(entry LogEntry) error {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	lp.add(entry)
+	return nil
+}
 
-	lp.entries = append(lp.entries, entry)
+// add 加入一条日志，调用方需持有mutex
+func (lp *LogProcessor) add(entry LogEntry) {
+	evicted := lp.buffer.Push(entry)
+	lp.index.Add(entry)
+	lp.evict(evicted)
 	fmt.Printf("处理日志: [%s] %s\n", entry.Level, entry.Message)
 }
 
-// FilterLogs 按级别过滤日志
+// evict 从索引中移除被环形缓冲区淘汰的日志，开启溢写时写入磁盘。调用方需持有mutex
+func (lp *LogProcessor) evict(evicted []LogEntry) {
+	if len(evicted) == 0 {
+		return
+	}
+	lp.index.EvictOldest(len(evicted))
+	lp.evicted += len(evicted)
+	if lp.spill != nil {
+		if err := lp.spill.Append(evicted); err != nil && lp.spillErr == nil {
+			lp.spillErr = err
+			log.Printf("溢写日志失败: %v", err)
+		}
+	}
+}
+
+// Invalid 返回无法解析的日志行数
+func (lp *LogProcessor) Invalid() int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.invalid
+}
+
+// Evicted 返回因超出MaxEntries或MaxBytes从内存淘汰的日志条数（包括已溢写到磁盘的）
+func (lp *LogProcessor) Evicted() int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.evicted
+}
+
+// Entries 返回内存中保留的日志副本，从旧到新
+func (lp *LogProcessor) Entries() []LogEntry {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.buffer.Slice()
+}
+
+// ScanAll 按时间先后遍历溢写到磁盘的日志和内存中的日志，fn返回false时停止
+func (lp *LogProcessor) ScanAll(fn func(entry LogEntry) bool) error {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	stopped := false
+	if lp.spill != nil {
+		err := lp.spill.Scan(time.Time{}, time.Time{}, func(entry LogEntry) bool {
+			stopped = !fn(entry)
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	lp.buffer.Each(fn)
+	return nil
+}
+
+// SpillErr 返回第一次溢写失败的错误，写入失败的那批日志已经丢失
+func (lp *LogProcessor) SpillErr() error {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.spillErr
+}
+
+// Close 关闭溢写存储
+func (lp *LogProcessor) Close() error {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.spill == nil {
+		return nil
+	}
+	return lp.spill.Close()
+}
+
+// FilterLogs 按级别过滤日志，需要更多条件时使用Query
 func (lp *LogProcessor) FilterLogs(level string) []LogEntry {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
 	var filtered []LogEntry
-	for _, entry := range lp.entries {
+	lp.buffer.Each(func(entry LogEntry) bool {
 		if entry.Level == level {
 			filtered = append(filtered, entry)
 		}
-	}
+		return true
+	})
 	return filtered
 }
 
+// Query 按时间范围、级别、全文和字段查询保留的日志，支持分页
+func (lp *LogProcessor) Query(filter QueryFilter) QueryResult {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.index.Query(filter)
+}
+
+// GroupByCorrelation 返回关联ID（CorrelationField，由CorrelationExtractor提取）为id的全部日志，
+// 按时间排序，用于查看一个请求在各服务中的完整经过。只包括内存中保留的日志
+func (lp *LogProcessor) GroupByCorrelation(id string) []LogEntry {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	return lp.index.Correlated(id)
+}
+
 // GenerateReport 生成日志报告
 func (lp *LogProcessor) GenerateReport() map[string]int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
 	report := make(map[string]int)
-	for _, entry := range lp.entries {
+	lp.buffer.Each(func(entry LogEntry) bool {
 		report[entry.Level]++
-	}
+		return true
+	})
 	return report
 }
 
@@ -83,9 +288,9 @@ func NewFileReader(processor *LogProcessor) *FileReader {
 	return &FileReader{processor: processor}
 }
 
-// ReadFromFile 从文件读取日志
+// ReadFromFile 从文件读取日志，gzip和zstd压缩的文件自动解压
 func (fr *FileReader) ReadFromFile(filename string) error {
-	file, err := os.Open(filename)
+	file, err := OpenLogFile(filename)
 	if err != nil {
 		return err
 	}
@@ -96,6 +301,7 @@ func (fr *FileReader) ReadFromFile(filename string) error {
 		line := scanner.Text()
 		fr.processor.ProcessLog(line)
 	}
+	fr.processor.Flush()
 
 	return scanner.Err()
 }
@@ -118,25 +324,60 @@ func (sr *StreamReader) ReadFromStdin() {
 		line := scanner.Text()
 		sr.processor.ProcessLog(line)
 	}
+	sr.processor.Flush()
+}
+
+// newPipeline 创建多租户管道并配置当前的解析和处理步骤，接收和回放共用同一份配置
+func newPipeline() *MultiTenantPipeline {
+	pipeline := NewMultiTenantPipeline()
+	pipeline.Use(DefaultLevels) // 统一各来源的级别写法，如 warning、W 都记为 WARN
+	return pipeline
 }
 
 func main() {
-	// 创建日志处理器
-	processor := NewLogProcessor()
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		if err := runConfig(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	// 创建文件读取器和流式读取器
-	fileReader := NewFileReader(processor)
-	streamReader := NewStreamReader(processor)
+	// 创建日志处理器和按小时的聚合器，作为并发管道的输出
+	processor := NewLogProcessor()
+	aggregator := NewAggregator(AggregateConfig{Window: time.Hour})
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{processor, aggregator}})
+	ctx := context.Background()
 
 	// 演示文件读取
 	fmt.Println("=== 文件读取演示 ===")
-	if err := fileReader.ReadFromFile("sample_logs.txt"); err != nil {
+	if file, err := os.Open("sample_logs.txt"); err != nil {
 		log.Printf("读取文件失败: %v", err)
+	} else {
+		if err := pipeline.Consume(ctx, "sample_logs.txt", file); err != nil {
+			log.Printf("读取文件失败: %v", err)
+		}
+		file.Close()
 	}
 
 	// 演示流式读取（这里只是演示，实际使用时可以替换为实时流）
 	fmt.Println("\n=== 流式读取演示 ===")
-	streamReader.ReadFromStdin()
+	fmt.Println("请输入日志行 (按Ctrl+D结束):")
+	if err := pipeline.Consume(ctx, "stdin", os.Stdin); err != nil {
+		log.Printf("读取标准输入失败: %v", err)
+	}
+
+	// 排空管道中的日志后再生成报告
+	shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := pipeline.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭管道超时: %v", err)
+	}
 
 	// 生成报告
 	fmt.Println("\n=== 日志报告 ===")
@@ -151,4 +392,8 @@ func main() {
 	for _, entry := range errorLogs {
 		fmt.Printf("[%s] %s\n", entry.Timestamp.Format("15:04:05"), entry.Message)
 	}
+
+	// 按小时汇总及最常见的错误
+	fmt.Println("\n=== 按小时汇总 ===")
+	fmt.Print(aggregator.Summary(time.Time{}, time.Time{}, 5).Text())
 }
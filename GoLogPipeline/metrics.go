@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSeries 每个指标最多的标签组合数，超出的组合被丢弃，避免日志中的高基数字段撑爆内存
+const DefaultMaxSeries = 1000
+
+// DefaultBuckets 直方图的默认分桶（秒），与Prometheus客户端库一致
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	metricNamePattern  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	invalidLabelChars  = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// metricSeries 一组标签值对应的计数器值或直方图
+type metricSeries struct {
+	labelValues []string
+	value       float64  // 计数器的值
+	buckets     []uint64 // 直方图每个分桶的计数（非累计）
+	sum         float64
+	count       uint64
+}
+
+// metric 一个计数器或直方图指标
+type metric struct {
+	name        string
+	help        string
+	kind        string // "counter" 或 "histogram"
+	fields      []string
+	labelNames  []string
+	bounds      []float64
+	series      map[string]*metricSeries
+	dropped     int64 // 超出MaxSeries被丢弃的观测次数
+	parseErrors int64 // 字段值无法解析的次数
+}
+
+// MetricsRegistry 从日志派生的指标，以Prometheus文本格式导出
+type MetricsRegistry struct {
+	metrics   map[string]*metric
+	names     []string
+	maxSeries int
+	mutex     sync.Mutex
+}
+
+// NewMetricsRegistry 创建空的指标注册表
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		metrics:   make(map[string]*metric),
+		maxSeries: DefaultMaxSeries,
+	}
+}
+
+// SetMaxSeries 设置每个指标最多的标签组合数，<=0表示不限制
+func (r *MetricsRegistry) SetMaxSeries(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.maxSeries = n
+}
+
+// register 注册指标，标签名由字段名转换而来（非法字符替换为下划线）
+func (r *MetricsRegistry) register(m *metric) error {
+	if !metricNamePattern.MatchString(m.name) {
+		return fmt.Errorf("指标名 %q 不合法", m.name)
+	}
+	seen := make(map[string]bool)
+	for _, field := range m.fields {
+		label := invalidLabelChars.ReplaceAllString(field, "_")
+		if label == "" || label == "le" || seen[label] {
+			return fmt.Errorf("指标 %s 的标签 %q 不合法或重复", m.name, field)
+		}
+		seen[label] = true
+		m.labelNames = append(m.labelNames, label)
+	}
+	m.series = make(map[string]*metricSeries)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.metrics[m.name]; exists {
+		return fmt.Errorf("指标 %s 已注册", m.name)
+	}
+	r.metrics[m.name] = m
+	r.names = append(r.names, m.name)
+	return nil
+}
+
+// seriesFor 返回日志对应的标签组合，超出MaxSeries时返回nil。调用方需持有mutex
+func (r *MetricsRegistry) seriesFor(m *metric, entry LogEntry) *metricSeries {
+	values := make([]string, len(m.fields))
+	for i, field := range m.fields {
+		values[i] = entryValue(entry, field)
+	}
+	key := strings.Join(values, "\x00")
+	series, exists := m.series[key]
+	if exists {
+		return series
+	}
+	if r.maxSeries > 0 && len(m.series) >= r.maxSeries {
+		m.dropped++
+		return nil
+	}
+	series = &metricSeries{labelValues: values}
+	if m.kind == "histogram" {
+		series.buckets = make([]uint64, len(m.bounds))
+	}
+	m.series[key] = series
+	return series
+}
+
+// CountEntries 注册计数器并返回对每条日志加一的处理步骤，标签取自labelFields
+// （"tenant"、"level"或Fields中的字段），例如 CountEntries("http_requests_total", "请求数", "status")
+func (r *MetricsRegistry) CountEntries(name, help string, labelFields ...string) (Processor, error) {
+	m := &metric{name: name, help: help, kind: "counter", fields: labelFields}
+	if err := r.register(m); err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(entry LogEntry) (LogEntry, bool) {
+		r.mutex.Lock()
+		if series := r.seriesFor(m, entry); series != nil {
+			series.value++
+		}
+		r.mutex.Unlock()
+		return entry, true
+	}), nil
+}
+
+// ObserveField 注册直方图并返回把日志中field字段的值记入直方图的处理步骤。
+// 值可以是数字（原样记录）或Go的时长格式如"120ms"（换算为秒）；没有该字段的日志不记录，
+// 无法解析的计入解析错误。buckets为空时使用DefaultBuckets
+func (r *MetricsRegistry) ObserveField(name, help, field string, buckets []float64, labelFields ...string) (Processor, error) {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	bounds := append([]float64(nil), buckets...)
+	sort.Float64s(bounds)
+	m := &metric{name: name, help: help, kind: "histogram", fields: labelFields, bounds: bounds}
+	if err := r.register(m); err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(entry LogEntry) (LogEntry, bool) {
+		raw, exists := entry.Fields[field]
+		if !exists {
+			return entry, true
+		}
+		value, err := parseMetricValue(raw)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if err != nil {
+			m.parseErrors++
+			return entry, true
+		}
+		if series := r.seriesFor(m, entry); series != nil {
+			if i := sort.SearchFloat64s(m.bounds, value); i < len(m.bounds) {
+				series.buckets[i]++
+			}
+			series.sum += value
+			series.count++
+		}
+		return entry, true
+	}), nil
+}
+
+// parseMetricValue 解析数字或时长（换算为秒）
+func parseMetricValue(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return d.Seconds(), nil
+	}
+	return 0, fmt.Errorf("无法解析指标值 %q", value)
+}
+
+// Handler 返回以Prometheus文本格式导出指标的HTTP处理器
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus 按注册顺序以Prometheus文本格式写出所有指标，同一指标的标签组合按标签值排序。
+// 另外导出 logpipeline_metric_series_dropped_total 和 logpipeline_metric_parse_errors_total
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	r.mutex.Lock()
+	var b strings.Builder
+	for _, name := range r.names {
+		m := r.metrics[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+
+		keys := make([]string, 0, len(m.series))
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			series := m.series[key]
+			if m.kind == "counter" {
+				fmt.Fprintf(&b, "%s%s %s\n", m.name, metricLabels(m.labelNames, series.labelValues), formatMetricValue(series.value))
+				continue
+			}
+			bucketLabels := func(le string) string {
+				return metricLabels(append(slices.Clone(m.labelNames), "le"), append(slices.Clone(series.labelValues), le))
+			}
+			var cumulative uint64
+			for i, bound := range m.bounds {
+				cumulative += series.buckets[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, bucketLabels(formatMetricValue(bound)), cumulative)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, bucketLabels("+Inf"), series.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", m.name, metricLabels(m.labelNames, series.labelValues), formatMetricValue(series.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", m.name, metricLabels(m.labelNames, series.labelValues), series.count)
+		}
+	}
+
+	if len(r.names) > 0 {
+		b.WriteString("# HELP logpipeline_metric_series_dropped_total 超出标签组合上限被丢弃的观测次数\n")
+		b.WriteString("# TYPE logpipeline_metric_series_dropped_total counter\n")
+		for _, name := range r.names {
+			fmt.Fprintf(&b, "logpipeline_metric_series_dropped_total{metric=%q} %d\n", name, r.metrics[name].dropped)
+		}
+		b.WriteString("# HELP logpipeline_metric_parse_errors_total 字段值无法解析的次数\n")
+		b.WriteString("# TYPE logpipeline_metric_parse_errors_total counter\n")
+		for _, name := range r.names {
+			fmt.Fprintf(&b, "logpipeline_metric_parse_errors_total{metric=%q} %d\n", name, r.metrics[name].parseErrors)
+		}
+	}
+	r.mutex.Unlock()
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricLabels 拼接标签，没有标签时返回空字符串
+func metricLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + metricLabelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
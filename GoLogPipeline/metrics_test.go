@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCountEntriesByStatus(t *testing.T) {
+	registry := NewMetricsRegistry()
+	requests, err := registry.CountEntries("http_requests_total", "按状态码统计的请求数", "tenant", "status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := NewPipeline(PipelineConfig{Parser: NewLogfmtParser(), Processors: []Processor{requests}})
+	for _, line := range []string{
+		`level=info msg=ok status=200`,
+		`level=info msg=ok status=200`,
+		`level=error msg=fail status=500`,
+		`level=info msg="no status"`,
+	} {
+		pipeline.Submit(context.Background(), line)
+	}
+	pipeline.Shutdown(context.Background())
+
+	var out strings.Builder
+	registry.WritePrometheus(&out)
+	for _, want := range []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{tenant="",status=""} 1` + "\n",
+		`http_requests_total{tenant="",status="200"} 2` + "\n",
+		`http_requests_total{tenant="",status="500"} 1` + "\n",
+		`logpipeline_metric_series_dropped_total{metric="http_requests_total"} 0` + "\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("缺少 %q:\n%s", want, out.String())
+		}
+	}
+
+	for _, args := range [][]string{{"bad-name"}, {"http_requests_total"}, {"ok_total", "le"}, {"ok_total", "a.b", "a_b"}} {
+		if _, err := registry.CountEntries(args[0], "", args[1:]...); err == nil {
+			t.Errorf("注册 %v 应返回错误", args)
+		}
+	}
+}
+
+func TestObserveFieldHistogram(t *testing.T) {
+	registry := NewMetricsRegistry()
+	latency, err := registry.ObserveField("http_request_duration_seconds", "请求耗时", "latency", []float64{1, 0.1, 0.5}, "route")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"0.05", "80ms", "0.3", "2s", "慢"} {
+		latency.Process(LogEntry{Fields: map[string]string{"latency": value, "route": "/api"}})
+	}
+	latency.Process(LogEntry{Fields: map[string]string{"route": "/api"}}) // 没有耗时字段不记录
+
+	var out strings.Builder
+	registry.WritePrometheus(&out)
+	want := `# HELP http_request_duration_seconds 请求耗时
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="/api",le="0.1"} 2
+http_request_duration_seconds_bucket{route="/api",le="0.5"} 3
+http_request_duration_seconds_bucket{route="/api",le="1"} 3
+http_request_duration_seconds_bucket{route="/api",le="+Inf"} 4
+http_request_duration_seconds_sum{route="/api"} 2.43
+http_request_duration_seconds_count{route="/api"} 4
+`
+	if !strings.HasPrefix(out.String(), want) {
+		t.Errorf("直方图输出不正确:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `logpipeline_metric_parse_errors_total{metric="http_request_duration_seconds"} 1`) {
+		t.Errorf("无法解析的值应计入解析错误:\n%s", out.String())
+	}
+}
+
+func TestMetricsSeriesLimitAndHandler(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.SetMaxSeries(2)
+	byUser, _ := registry.CountEntries("logins_total", "登录次数", "user")
+	for _, user := range []string{"alice", "bob", "carol", "alice", "dave"} {
+		byUser.Process(LogEntry{Fields: map[string]string{"user": user}})
+	}
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Content-Type不正确: %s", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(body, `logins_total{user="alice"} 2`) || strings.Contains(body, "carol") ||
+		!strings.Contains(body, `logpipeline_metric_series_dropped_total{metric="logins_total"} 2`) {
+		t.Errorf("超出标签组合上限的观测应被丢弃并计数:\n%s", body)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 时间格式。除Go的时间布局外，TimeLayouts还可以使用以下名称表示Unix时间戳
+const (
+	TimeUnix      = "unix"    // 秒，可以带小数；大于1e12的整数按毫秒处理
+	TimeUnixMilli = "unix_ms" // 毫秒
+	TimeUnixNano  = "unix_ns" // 纳秒
+)
+
+// LayoutNginx nginx和Apache访问日志的 $time_local 格式，如 10/Oct/2024:13:55:36 +0800
+const LayoutNginx = "02/Jan/2006:15:04:05 -0700"
+
+// DefaultTimeLayouts 未配置时间格式时依次尝试的格式
+var DefaultTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	LayoutNginx,
+	TimeUnix,
+}
+
+// parseTimestamp 依次按layouts解析时间，没有时区的时间按loc解释，loc为nil时为UTC
+func parseTimestamp(value string, layouts []string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	value = strings.TrimSpace(value)
+	for _, layout := range layouts {
+		if t, err := parseTimeLayout(value, layout, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间 %q", value)
+}
+
+func parseTimeLayout(value, layout string, loc *time.Location) (time.Time, error) {
+	switch layout {
+	case TimeUnix:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			// 1e12毫秒约为2001年，更大的整数不会是秒
+			if n > 1e12 {
+				return time.UnixMilli(n).UTC(), nil
+			}
+			return time.Unix(n, 0).UTC(), nil
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		sec, frac := math.Modf(n)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	case TimeUnixMilli:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return time.UnixMilli(n).UTC(), err
+	case TimeUnixNano:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return time.Unix(0, n).UTC(), err
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// LevelTable 级别别名表，把各来源的级别写法映射为统一的级别，键不区分大小写
+type LevelTable map[string]string
+
+// DefaultLevels 内置的级别别名，统一为 DEBUG、INFO、WARN、ERROR 四级。
+// 数字为bunyan/pino的级别（10 trace … 60 fatal）
+var DefaultLevels = LevelTable{
+	"TRACE": "DEBUG", "T": "DEBUG", "DEBUG": "DEBUG", "DBG": "DEBUG", "D": "DEBUG",
+	"INFO": "INFO", "INF": "INFO", "I": "INFO", "INFORMATION": "INFO", "INFORMATIONAL": "INFO", "NOTICE": "INFO",
+	"WARN": "WARN", "WARNING": "WARN", "WRN": "WARN", "W": "WARN",
+	"ERROR": "ERROR", "ERR": "ERROR", "E": "ERROR", "SEVERE": "ERROR",
+	"FATAL": "ERROR", "CRIT": "ERROR", "CRITICAL": "ERROR", "ALERT": "ERROR", "EMERG": "ERROR", "EMERGENCY": "ERROR", "PANIC": "ERROR",
+	"10": "DEBUG", "20": "DEBUG", "30": "INFO", "40": "WARN", "50": "ERROR", "60": "ERROR",
+}
+
+// Normalize 先查本表再查DefaultLevels，都没有时返回大写的原值
+func (t LevelTable) Normalize(level string) string {
+	key := strings.ToUpper(strings.TrimSpace(level))
+	if normalized, exists := t.lookup(key); exists {
+		return normalized
+	}
+	if normalized, exists := DefaultLevels[key]; exists {
+		return normalized
+	}
+	return key
+}
+
+// lookup 按不区分大小写的键查找，表中的键可以是任意大小写
+func (t LevelTable) lookup(key string) (string, bool) {
+	if normalized, exists := t[key]; exists {
+		return normalized, true
+	}
+	for alias, normalized := range t {
+		if strings.EqualFold(alias, key) {
+			return normalized, true
+		}
+	}
+	return "", false
+}
+
+// Process 实现Processor接口，用于统一自定义解析器或ParseLine解析出的级别
+func (t LevelTable) Process(entry LogEntry) (LogEntry, bool) {
+	entry.Level = t.Normalize(entry.Level)
+	return entry, true
+}
+
+// NormalizeLevel 按DefaultLevels统一级别
+func NormalizeLevel(level string) string {
+	return LevelTable(nil).Normalize(level)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeLevels(t *testing.T) {
+	for level, want := range map[string]string{
+		"warn": "WARN", "WARNING": "WARN", "W": "WARN", " Warning ": "WARN",
+		"trace": "DEBUG", "notice": "INFO", "err": "ERROR", "fatal": "ERROR", "50": "ERROR",
+		"audit": "AUDIT", "": "",
+	} {
+		if got := NormalizeLevel(level); got != want {
+			t.Errorf("NormalizeLevel(%q) = %q, 期望 %q", level, got, want)
+		}
+	}
+
+	// 自定义别名优先于内置的，键不区分大小写
+	table := LevelTable{"fatal": "FATAL", "Audit": "INFO"}
+	if table.Normalize("FATAL") != "FATAL" || table.Normalize("audit") != "INFO" || table.Normalize("w") != "WARN" {
+		t.Errorf("自定义级别别名未生效: %q %q %q", table.Normalize("FATAL"), table.Normalize("audit"), table.Normalize("w"))
+	}
+	if entry, ok := table.Process(LogEntry{Level: "Fatal"}); !ok || entry.Level != "FATAL" {
+		t.Errorf("作为处理步骤应改写级别: %+v", entry)
+	}
+}
+
+func TestTimestampLayouts(t *testing.T) {
+	want := time.Date(2024, 1, 15, 10, 30, 15, 0, time.UTC)
+	for value, layouts := range map[string][]string{
+		"2024-01-15T18:30:15+08:00":  nil,
+		"2024-01-15 10:30:15":        nil,
+		"2024-01-15 10:30:15.000":    nil,
+		"15/Jan/2024:18:30:15 +0800": nil,
+		"1705314615":                 nil,
+		"1705314615000":              nil,
+		"1705314615.0":               nil,
+		"1705314615000000000":        {TimeUnixNano},
+		"1705314615001":              {TimeUnixMilli},
+		"Jan 15 2024 10:30:15":       {"2006-01-02", "Jan 2 2006 15:04:05"},
+	} {
+		if layouts == nil {
+			layouts = DefaultTimeLayouts
+		}
+		got, err := parseTimestamp(value, layouts, nil)
+		if err != nil || got.Sub(want).Abs() >= time.Second {
+			t.Errorf("%q 解析为 %v (%v)", value, got, err)
+		}
+	}
+	if _, err := parseTimestamp("1705314615", []string{time.RFC3339}, nil); err == nil {
+		t.Error("不在格式列表中的时间不应解析")
+	}
+}
+
+func TestMappingTimezoneAndLevels(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	parser := &JSONParser{Mapping: EntryMapping{
+		TimeLayouts: []string{"2006/01/02 15:04:05", TimeUnixMilli},
+		Location:    shanghai,
+		Levels:      LevelTable{"crit": "FATAL"},
+	}}
+
+	entry, ok := parser.Parse(`{"ts":"2024/01/15 18:30:15","level":"W","msg":"本地时间"}`)
+	if !ok || entry.Level != "WARN" || !entry.Timestamp.Equal(time.Date(2024, 1, 15, 10, 30, 15, 0, time.UTC)) {
+		t.Errorf("没有时区的时间应按Location解释: %+v", entry)
+	}
+	entry, ok = parser.Parse(`{"ts":"1705314615000","level":"crit","msg":"毫秒"}`)
+	if !ok || entry.Level != "FATAL" || entry.Timestamp.Unix() != 1705314615 {
+		t.Errorf("应按第二种格式解析并使用自定义级别: %+v", entry)
+	}
+	if _, ok := parser.Parse(`{"ts":"2024-01-15T10:30:15Z","msg":"格式不在列表中"}`); ok {
+		t.Error("配置了TimeLayouts时不应再尝试默认格式")
+	}
+
+	// 接收和回放的管道统一级别写法
+	sink := &memorySink{}
+	pipeline := newPipeline()
+	pipeline.RegisterTenant(TenantConfig{ID: "app", Sink: sink})
+	pipeline.SetParser(NewLogfmtParser().Parse)
+	pipeline.Ingest("app", `level=warning msg=磁盘`)
+	if len(sink.entries) != 1 || sink.entries[0].Level != "WARN" {
+		t.Errorf("管道应统一级别: %+v", sink.entries)
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parser 把一行原始日志解析为LogEntry，返回false表示该行无法解析
+type Parser interface {
+	Parse(line string) (LogEntry, bool)
+}
+
+// ParserFunc 函数形式的解析器
+type ParserFunc func(line string) (LogEntry, bool)
+
+// Parse 实现Parser接口
+func (f ParserFunc) Parse(line string) (LogEntry, bool) {
+	return f(line)
+}
+
+// ParseErrorer 能说明失败原因的解析器，无法解析的行进入死信时记录这个原因；
+// 没有实现的解析器记为 "格式不正确"
+type ParseErrorer interface {
+	ParseError(line string) error // 返回line无法解析的原因，能解析时返回nil
+}
+
+// parseFailure 返回parser无法解析line的原因
+func parseFailure(parser Parser, line string) string {
+	if explainer, ok := parser.(ParseErrorer); ok {
+		if err := explainer.ParseError(line); err != nil {
+			return err.Error()
+		}
+	}
+	return "格式不正确"
+}
+
+// EntryMapping 结构化日志中时间、级别和消息对应的字段，为空时使用默认字段名；
+// 其余字段保存到LogEntry.Fields
+type EntryMapping struct {
+	TimeKeys    []string       // 默认 timestamp, time, ts, @timestamp
+	LevelKeys   []string       // 默认 level, lvl, severity
+	MessageKeys []string       // 默认 message, msg
+	TimeLayout  string         // 只按这一种格式解析，优先于TimeLayouts
+	TimeLayouts []string       // 依次尝试的格式，可以使用TimeUnix、TimeUnixMilli等名称；都为空时为DefaultTimeLayouts
+	Location    *time.Location // 没有时区的时间所在的时区，默认UTC
+	Levels      LevelTable     // 额外的级别别名，优先于DefaultLevels
+}
+
+var (
+	defaultTimeKeys    = []string{"timestamp", "time", "ts", "@timestamp"}
+	defaultLevelKeys   = []string{"level", "lvl", "severity"}
+	defaultMessageKeys = []string{"message", "msg"}
+)
+
+// buildEntry 按映射从字段中取出时间、级别和消息，级别按Levels和DefaultLevels统一。
+// 没有级别和消息、或时间字段存在但无法解析时返回错误
+func (m EntryMapping) buildEntry(values map[string]string) (LogEntry, error) {
+	var entry LogEntry
+	timeKey, hasTime := pick(values, m.TimeKeys, defaultTimeKeys)
+	levelKey, hasLevel := pick(values, m.LevelKeys, defaultLevelKeys)
+	messageKey, hasMessage := pick(values, m.MessageKeys, defaultMessageKeys)
+	if !hasLevel && !hasMessage {
+		return LogEntry{}, fmt.Errorf("缺少级别和消息字段")
+	}
+	if hasTime {
+		timestamp, err := m.parseTime(values[timeKey])
+		if err != nil {
+			return LogEntry{}, fmt.Errorf("字段 %s 的时间 %q 无法解析", timeKey, values[timeKey])
+		}
+		entry.Timestamp = timestamp
+	}
+	if hasLevel {
+		entry.Level = m.Levels.Normalize(values[levelKey])
+	}
+	entry.Message = values[messageKey]
+
+	for key, value := range values {
+		if (hasTime && key == timeKey) || (hasLevel && key == levelKey) || (hasMessage && key == messageKey) {
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]string)
+		}
+		entry.Fields[key] = value
+	}
+	return entry, nil
+}
+
+// pick 返回第一个存在的字段名，keys为空时使用defaults
+func pick(values map[string]string, keys, defaults []string) (string, bool) {
+	if len(keys) == 0 {
+		keys = defaults
+	}
+	for _, key := range keys {
+		if _, exists := values[key]; exists {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// parseTime 按TimeLayout或TimeLayouts解析时间，都未设置时依次尝试DefaultTimeLayouts
+func (m EntryMapping) parseTime(value string) (time.Time, error) {
+	layouts := m.TimeLayouts
+	if m.TimeLayout != "" {
+		layouts = []string{m.TimeLayout}
+	}
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+	return parseTimestamp(value, layouts, m.Location)
+}
+
+// JSONParser 解析每行一个JSON对象的日志，非字符串的字段值保存为紧凑的JSON文本
+type JSONParser struct {
+	Mapping EntryMapping
+}
+
+// NewJSONParser 创建使用默认字段名的JSON解析器
+func NewJSONParser() *JSONParser {
+	return &JSONParser{}
+}
+
+// Parse 实现Parser接口
+func (p *JSONParser) Parse(line string) (LogEntry, bool) {
+	entry, err := p.parse(line)
+	return entry, err == nil
+}
+
+// ParseError 实现ParseErrorer接口
+func (p *JSONParser) ParseError(line string) error {
+	_, err := p.parse(line)
+	return err
+}
+
+func (p *JSONParser) parse(line string) (LogEntry, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &object); err != nil {
+		return LogEntry{}, fmt.Errorf("不是合法的JSON对象: %v", err)
+	}
+	if object == nil {
+		return LogEntry{}, fmt.Errorf("不是合法的JSON对象")
+	}
+
+	values := make(map[string]string, len(object))
+	for key, raw := range object {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			values[key] = s
+			continue
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, raw); err != nil {
+			return LogEntry{}, err
+		}
+		values[key] = compact.String()
+	}
+	return p.Mapping.buildEntry(values)
+}
+
+// LogfmtParser 解析logfmt格式（key=value，值可以用双引号包含空格）的日志
+type LogfmtParser struct {
+	Mapping EntryMapping
+}
+
+// NewLogfmtParser 创建使用默认字段名的logfmt解析器
+func NewLogfmtParser() *LogfmtParser {
+	return &LogfmtParser{}
+}
+
+// Parse 实现Parser接口
+func (p *LogfmtParser) Parse(line string) (LogEntry, bool) {
+	entry, err := p.parse(line)
+	return entry, err == nil
+}
+
+// ParseError 实现ParseErrorer接口
+func (p *LogfmtParser) ParseError(line string) error {
+	_, err := p.parse(line)
+	return err
+}
+
+func (p *LogfmtParser) parse(line string) (LogEntry, error) {
+	values, ok := parseLogfmt(line)
+	if !ok {
+		return LogEntry{}, fmt.Errorf("不是合法的logfmt")
+	}
+	return p.Mapping.buildEntry(values)
+}
+
+// parseLogfmt 把 key=value 对解析为map，没有值的key记为空字符串
+func parseLogfmt(line string) (map[string]string, bool) {
+	values := make(map[string]string)
+	i := 0
+	for {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" || strings.ContainsAny(key, `"`) {
+			return nil, false
+		}
+		if i >= len(line) || line[i] == ' ' {
+			values[key] = ""
+			continue
+		}
+		i++ // 跳过 '='
+
+		if i < len(line) && line[i] == '"' {
+			value, n, err := unquotePrefix(line[i:])
+			if err != nil {
+				return nil, false
+			}
+			values[key] = value
+			i += n
+			if i < len(line) && line[i] != ' ' {
+				return nil, false
+			}
+			continue
+		}
+		start = i
+		for i < len(line) && line[i] != ' ' {
+			i++
+		}
+		values[key] = line[start:i]
+	}
+	return values, len(values) > 0
+}
+
+// unquotePrefix 解析s开头的双引号字符串，返回去掉引号和转义后的值及其在s中的长度
+func unquotePrefix(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			return value, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("引号未闭合")
+}
+
+// RegexParser 用带命名分组的正则表达式解析日志，分组名按Mapping映射到时间、级别和消息，
+// 其余命名分组保存到Fields。只有匹配整行的正则才能避免把不相关的行当作日志
+type RegexParser struct {
+	Pattern *regexp.Regexp
+	Mapping EntryMapping
+}
+
+// NewRegexParser 编译正则表达式，正则必须包含命名分组
+func NewRegexParser(pattern string) (*RegexParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	named := false
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			named = true
+			break
+		}
+	}
+	if !named {
+		return nil, fmt.Errorf("正则表达式 %q 没有命名分组", pattern)
+	}
+	return &RegexParser{Pattern: re}, nil
+}
+
+// Parse 实现Parser接口，没有参与匹配的可选分组不会出现在字段中
+func (p *RegexParser) Parse(line string) (LogEntry, bool) {
+	entry, err := p.parse(line)
+	return entry, err == nil
+}
+
+// ParseError 实现ParseErrorer接口
+func (p *RegexParser) ParseError(line string) error {
+	_, err := p.parse(line)
+	return err
+}
+
+func (p *RegexParser) parse(line string) (LogEntry, error) {
+	match := p.Pattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		return LogEntry{}, fmt.Errorf("与正则 %s 不匹配", p.Pattern)
+	}
+	values := make(map[string]string)
+	for i, name := range p.Pattern.SubexpNames() {
+		if name == "" || match[2*i] < 0 {
+			continue
+		}
+		values[name] = line[match[2*i]:match[2*i+1]]
+	}
+	return p.Mapping.buildEntry(values)
+}
+
+// DefaultMaxLines 多行日志默认最多合并的行数
+const DefaultMaxLines = 500
+
+// MultilineParser 把堆栈等跨多行的日志合并为一条：Start匹配的行（Start为nil时为Parser能解析的行）
+// 开始一条新日志，其余的行是续行，以换行符追加到上一条日志的Message中。
+// 上一条日志在下一条日志开始时才完成，来源结束时需要Flush输出最后一条
+type MultilineParser struct {
+	Parser   Parser
+	Start    *regexp.Regexp
+	MaxLines int // 每条日志最多合并的行数，超出的续行被丢弃，<=0时为DefaultMaxLines
+}
+
+// NewMultilineParser 创建多行解析器，start为空时能被parser解析的行即为新日志的开始
+func NewMultilineParser(parser Parser, start string) (*MultilineParser, error) {
+	multiline := &MultilineParser{Parser: parser}
+	if start != "" {
+		re, err := regexp.Compile(start)
+		if err != nil {
+			return nil, err
+		}
+		multiline.Start = re
+	}
+	return multiline, nil
+}
+
+// Parse 解析新日志的第一行，续行的合并由每个来源的lineAssembler完成
+func (p *MultilineParser) Parse(line string) (LogEntry, bool) {
+	if p.Start != nil && !p.Start.MatchString(line) {
+		return LogEntry{}, false
+	}
+	return p.Parser.Parse(line)
+}
+
+// ParseError 实现ParseErrorer接口。多行解析器只在前面没有日志时才会遇到无法解析的行
+func (p *MultilineParser) ParseError(line string) error {
+	if p.Start != nil && !p.Start.MatchString(line) {
+		return fmt.Errorf("续行之前没有日志，且不匹配新日志的开始 %s", p.Start)
+	}
+	return fmt.Errorf("续行之前没有日志，且%s", parseFailure(p.Parser, line))
+}
+
+// continues 该行是否是续行
+func (p *MultilineParser) continues(line string) bool {
+	if p.Start != nil {
+		return !p.Start.MatchString(line)
+	}
+	_, ok := p.Parser.Parse(line)
+	return !ok
+}
+
+func (p *MultilineParser) maxLines() int {
+	if p.MaxLines <= 0 {
+		return DefaultMaxLines
+	}
+	return p.MaxLines
+}
+
+// assembled 组装完成的日志及其原始行的总字节数
+type assembled struct {
+	entry LogEntry
+	size  int
+}
+
+// lineAssembler 按来源的解析器把原始行组装成日志。多行解析器的状态属于来源而不是解析器，
+// 同一个MultilineParser可以被多个来源共用
+type lineAssembler struct {
+	pending *assembled
+	lines   int
+}
+
+// feed 用parser处理一行，返回这一行完成的日志（多行解析器完成的是上一条），
+// merged表示该行作为续行合并到了上一条日志，valid为false表示该行无法解析
+func (a *lineAssembler) feed(parser Parser, line string) (done *assembled, merged, valid bool) {
+	multiline, isMultiline := parser.(*MultilineParser)
+	if !isMultiline {
+		entry, ok := parser.Parse(line)
+		if !ok {
+			return nil, false, false
+		}
+		return &assembled{entry: entry, size: len(line)}, false, true
+	}
+
+	if a.pending != nil && multiline.continues(line) {
+		if a.lines < multiline.maxLines() {
+			a.pending.entry.Message += "\n" + line
+			a.lines++
+		}
+		a.pending.size += len(line)
+		return nil, true, true
+	}
+	entry, ok := multiline.Parse(line)
+	if !ok {
+		return nil, false, false
+	}
+	done = a.pending
+	a.pending = &assembled{entry: entry, size: len(line)}
+	a.lines = 1
+	return done, false, true
+}
+
+// flush 返回还在等待续行的日志
+func (a *lineAssembler) flush() *assembled {
+	done := a.pending
+	a.pending = nil
+	a.lines = 0
+	return done
+}
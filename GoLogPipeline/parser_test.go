@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONAndLogfmtParsers(t *testing.T) {
+	entry, ok := NewJSONParser().Parse(`{"ts":"2024-01-15T10:30:15Z","level":"error","msg":"支付失败","order":42,"retry":{"n":2}}`)
+	if !ok {
+		t.Fatal("JSON日志应能解析")
+	}
+	if entry.Level != "ERROR" || entry.Message != "支付失败" || !entry.Timestamp.Equal(time.Date(2024, 1, 15, 10, 30, 15, 0, time.UTC)) {
+		t.Errorf("JSON日志解析不正确: %+v", entry)
+	}
+	if entry.Fields["order"] != "42" || entry.Fields["retry"] != `{"n":2}` || len(entry.Fields) != 2 {
+		t.Errorf("其余字段应保存到Fields: %v", entry.Fields)
+	}
+	if entry, ok := NewJSONParser().Parse(`{"time":1705314615123,"message":"毫秒时间戳"}`); !ok || entry.Timestamp.UnixMilli() != 1705314615123 {
+		t.Errorf("应支持毫秒时间戳: %+v", entry)
+	}
+	for _, line := range []string{"2024-01-15 10:30:15 [INFO] 文本", `{"user":"42"}`, `{"ts":"昨天","msg":"x"}`, `[1,2]`} {
+		if _, ok := NewJSONParser().Parse(line); ok {
+			t.Errorf("不应解析: %s", line)
+		}
+	}
+
+	entry, ok = NewLogfmtParser().Parse(`time=2024-01-15T10:30:15Z level=warn msg="磁盘 空间不足" path=/data free="5\"GB\"" debug`)
+	if !ok {
+		t.Fatal("logfmt日志应能解析")
+	}
+	if entry.Level != "WARN" || entry.Message != "磁盘 空间不足" || entry.Fields["path"] != "/data" || entry.Fields["free"] != `5"GB"` {
+		t.Errorf("logfmt日志解析不正确: %+v", entry)
+	}
+	if _, exists := entry.Fields["debug"]; !exists {
+		t.Errorf("没有值的key应保存为空字段: %v", entry.Fields)
+	}
+	if _, ok := NewLogfmtParser().Parse(`level=info msg="未闭合`); ok {
+		t.Error("引号未闭合时不应解析")
+	}
+
+	// 自定义字段名
+	parser := &JSONParser{Mapping: EntryMapping{LevelKeys: []string{"sev"}, MessageKeys: []string{"text"}}}
+	if entry, ok := parser.Parse(`{"sev":"info","text":"自定义","level":"x"}`); !ok || entry.Message != "自定义" || entry.Fields["level"] != "x" {
+		t.Errorf("自定义字段名未生效: %+v", entry)
+	}
+}
+
+func TestRegexParser(t *testing.T) {
+	parser, err := NewRegexParser(`^(?P<ip>\S+) - - \[(?P<time>[^\]]+)\] "(?P<message>[^"]*)" (?P<status>\d{3})$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parser.Mapping.TimeLayout = LayoutNginx
+
+	entry, ok := parser.Parse(`10.0.0.1 - - [15/Jan/2024:10:30:15 +0800] "GET /api/orders HTTP/1.1" 500`)
+	if !ok {
+		t.Fatal("访问日志应能解析")
+	}
+	if entry.Message != "GET /api/orders HTTP/1.1" || entry.Fields["ip"] != "10.0.0.1" || entry.Fields["status"] != "500" {
+		t.Errorf("命名分组映射不正确: %+v", entry)
+	}
+	if !entry.Timestamp.Equal(time.Date(2024, 1, 15, 2, 30, 15, 0, time.UTC)) {
+		t.Errorf("时间应按TimeLayout解析: %v", entry.Timestamp)
+	}
+	if _, ok := parser.Parse("不匹配的行"); ok {
+		t.Error("不匹配的行不应解析")
+	}
+	if _, err := NewRegexParser(`^\S+ (\w+)$`); err == nil {
+		t.Error("没有命名分组的正则应返回错误")
+	}
+}
+
+func TestMultilineParserPerSource(t *testing.T) {
+	pipeline := NewMultiTenantPipeline()
+	multiline, _ := NewMultilineParser(ParserFunc(ParseLine), "")
+	sink := &memorySink{}
+	pipeline.RegisterTenant(TenantConfig{ID: "java", Parser: multiline, Sink: sink})
+	pipeline.RegisterTenant(TenantConfig{ID: "json", Parser: NewJSONParser()})
+	pipeline.RegisterTenant(TenantConfig{ID: "plain"})
+
+	content := strings.Join([]string{
+		"2024-01-15 10:30:15 [ERROR] 请求处理失败",
+		"java.lang.NullPointerException: order is null",
+		"\tat com.example.OrderService.pay(OrderService.java:42)",
+		"\tat com.example.Api.handle(Api.java:17)",
+		"2024-01-15 10:30:16 [INFO] 请求完成",
+	}, "\n")
+	file := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(file, []byte(content), 0644)
+	if err := pipeline.ReadFromFile("java", file); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := pipeline.Entries("java")
+	if len(entries) != 2 || len(sink.entries) != 2 {
+		t.Fatalf("堆栈应合并为一条日志，读完文件后输出最后一条: %+v", entries)
+	}
+	if lines := strings.Split(entries[0].Message, "\n"); len(lines) != 4 || lines[3] != "\tat com.example.Api.handle(Api.java:17)" {
+		t.Errorf("续行应追加到消息中: %q", entries[0].Message)
+	}
+	usage, _ := pipeline.Usage("java")
+	if usage.Received != 5 || usage.Accepted != 2 || usage.Merged != 3 || usage.Invalid != 0 || usage.Bytes != int64(len(content)-4) {
+		t.Errorf("多行日志用量不正确: %+v", usage)
+	}
+
+	// 每个租户使用自己的解析器
+	pipeline.Ingest("json", `{"level":"warn","msg":"来自JSON"}`)
+	pipeline.Ingest("plain", `{"level":"warn","msg":"来自JSON"}`)
+	if entries, _ := pipeline.Entries("json"); len(entries) != 1 || entries[0].Level != "WARN" {
+		t.Errorf("json租户应使用JSON解析器: %+v", entries)
+	}
+	if usage, _ := pipeline.Usage("plain"); usage.Invalid != 1 {
+		t.Errorf("plain租户应使用默认解析器: %+v", usage)
+	}
+
+	// LogProcessor统计无法解析的行，堆栈开头没有上一条日志时无法解析
+	processor := NewLogProcessor()
+	processor.SetParser(multiline)
+	processor.ProcessLog("\tat 孤立的续行")
+	processor.ProcessLog("2024-01-15 10:30:15 [ERROR] 失败")
+	processor.ProcessLog("\tat 堆栈")
+	processor.Flush()
+	if processor.Invalid() != 1 || len(processor.Entries()) != 1 || processor.Entries()[0].Message != "失败\n\tat 堆栈" {
+		t.Errorf("LogProcessor多行解析不正确: invalid=%d %+v", processor.Invalid(), processor.Entries())
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPipelineClosed 管道已开始Shutdown，不再接收日志
+var ErrPipelineClosed = errors.New("管道已关闭")
+
+// DefaultStageBuffer 阶段之间通道的默认容量
+const DefaultStageBuffer = 100
+
+// PipelineConfig 并发管道的配置
+type PipelineConfig struct {
+	Parser     Parser      // 为nil时使用ParseLine
+	Processors []Processor // filter阶段依次执行的处理步骤，返回false的日志被丢弃
+	Sinks      []Sink      // sink阶段依次写入的输出
+	// DeadLetters 保存parse阶段无法解析的原始行，为nil时这些行只计入Invalid
+	DeadLetters DeadLetterStore
+	BufferSize  int // 每个阶段之间通道的容量，<=0时为DefaultStageBuffer
+}
+
+// PipelineStats 管道各阶段的计数和通道中排队的数量
+type PipelineStats struct {
+	Received      int64 `json:"received"`       // source提交的行数
+	Invalid       int64 `json:"invalid"`        // parse阶段无法解析的行数
+	DeadLetters   int64 `json:"dead_letters"`   // 写入死信的行数
+	Merged        int64 `json:"merged"`         // 合并到多行日志的续行数
+	Parsed        int64 `json:"parsed"`         // parse阶段输出的日志条数
+	Dropped       int64 `json:"dropped"`        // filter阶段丢弃的条数
+	Written       int64 `json:"written"`        // 写入全部输出的条数
+	SinkErrors    int64 `json:"sink_errors"`    // 写入输出失败的次数
+	QueuedLines   int   `json:"queued_lines"`   // 等待解析的行数
+	QueuedParsed  int   `json:"queued_parsed"`  // 等待过滤的日志条数
+	QueuedEntries int   `json:"queued_entries"` // 等待写入输出的日志条数
+}
+
+// SourceConfig 来源的配置，通过Pipeline.SetSource设置
+type SourceConfig struct {
+	Parser Parser            // 该来源的解析器，为nil时使用PipelineConfig.Parser
+	Labels map[string]string // 写入该来源每条日志Fields的标签，如 {"source": "syslog"}
+}
+
+// sourceLine 来自某个来源的一行，flush为true时表示该来源结束。
+// replay为true时是重新提交的死信，与来源的实时日志分开组装多行日志
+type sourceLine struct {
+	source string
+	line   string
+	flush  bool
+	replay bool
+}
+
+// assemblerKey 多行日志组装状态的key
+type assemblerKey struct {
+	source string
+	replay bool
+}
+
+// Pipeline 并发日志管道：source → parse → filter → sink，各阶段在自己的goroutine中运行，
+// 由有界通道连接。下游处理不过来时通道填满，Submit阻塞，压力一直传递到来源
+type Pipeline struct {
+	config      PipelineConfig
+	configMutex sync.RWMutex // 保护config中的Parser、Processors和Sinks，Reconfigure时替换
+	lines       chan sourceLine
+	parsed      chan LogEntry
+	filtered    chan LogEntry
+	done        chan struct{}
+
+	sourcesMutex sync.RWMutex
+	sources      map[string]SourceConfig
+
+	mutex    sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup // 正在执行的Submit，Shutdown等它们结束后才关闭输入
+
+	received, invalid, deadLetters, merged, parsedCount, dropped, written, sinkErrors atomic.Int64
+}
+
+// NewPipeline 创建管道并启动parse、filter和sink阶段
+func NewPipeline(config PipelineConfig) *Pipeline {
+	if config.Parser == nil {
+		config.Parser = lineParser{}
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultStageBuffer
+	}
+	p := &Pipeline{
+		config:   config,
+		lines:    make(chan sourceLine, config.BufferSize),
+		parsed:   make(chan LogEntry, config.BufferSize),
+		filtered: make(chan LogEntry, config.BufferSize),
+		done:     make(chan struct{}),
+		sources:  make(map[string]SourceConfig),
+	}
+	go p.parseStage()
+	go p.filterStage()
+	go p.sinkStage()
+	return p
+}
+
+// SetSource 设置来源的解析器和标签，之后解析的该来源的日志生效
+func (p *Pipeline) SetSource(name string, config SourceConfig) {
+	p.sourcesMutex.Lock()
+	defer p.sourcesMutex.Unlock()
+	p.sources[name] = config
+}
+
+// sourceConfig 返回来源的解析器和标签
+func (p *Pipeline) sourceConfig(name string) (Parser, map[string]string) {
+	p.sourcesMutex.RLock()
+	defer p.sourcesMutex.RUnlock()
+	config := p.sources[name]
+	if config.Parser == nil {
+		p.configMutex.RLock()
+		defer p.configMutex.RUnlock()
+		return p.config.Parser, config.Labels
+	}
+	return config.Parser, config.Labels
+}
+
+// Reconfigure 替换默认解析器、处理步骤、输出和死信，不中断来源和已在通道中的日志；BufferSize不能修改。
+// 返回时旧的处理步骤和输出已不再被使用，调用方可以安全地关闭它们
+func (p *Pipeline) Reconfigure(config PipelineConfig) {
+	if config.Parser == nil {
+		config.Parser = lineParser{}
+	}
+	p.configMutex.Lock()
+	defer p.configMutex.Unlock()
+	p.config.Parser = config.Parser
+	p.config.Processors = config.Processors
+	p.config.Sinks = config.Sinks
+	p.config.DeadLetters = config.DeadLetters
+}
+
+// Submit 提交一行日志，来源为空。通道已满时阻塞，直到有空位、ctx取消或管道关闭
+func (p *Pipeline) Submit(ctx context.Context, line string) error {
+	return p.send(ctx, sourceLine{line: line})
+}
+
+// SubmitFrom 提交来自指定来源的一行日志，使用该来源的解析器和标签
+func (p *Pipeline) SubmitFrom(ctx context.Context, source, line string) error {
+	return p.send(ctx, sourceLine{source: source, line: line})
+}
+
+// Consume 作为source阶段从r逐行读取日志提交给管道，直到读完、出错或ctx取消，使用该来源的解析器和标签。
+// 读完后该来源的最后一条多行日志随即输出。不同来源可以在多个goroutine中同时Consume，
+// 多行日志按来源分别组装
+func (p *Pipeline) Consume(ctx context.Context, source string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if err := p.send(ctx, sourceLine{source: source, line: scanner.Text()}); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取来源 %s 失败: %v", source, err)
+	}
+	return p.send(ctx, sourceLine{source: source, flush: true})
+}
+
+// send 把一行放入parse阶段的通道
+func (p *Pipeline) send(ctx context.Context, item sourceLine) error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return ErrPipelineClosed
+	}
+	p.inflight.Add(1)
+	p.mutex.Unlock()
+	defer p.inflight.Done()
+
+	select {
+	case p.lines <- item:
+		if !item.flush {
+			p.received.Add(1)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseStage 按来源组装并解析日志，输入结束后输出各来源剩余的多行日志
+func (p *Pipeline) parseStage() {
+	defer close(p.parsed)
+	assemblers := make(map[assemblerKey]*lineAssembler)
+	emit := func(done *assembled, labels map[string]string) {
+		entry := done.entry
+		if len(labels) > 0 {
+			fields := make(map[string]string, len(entry.Fields)+len(labels))
+			for key, value := range entry.Fields {
+				fields[key] = value
+			}
+			for key, value := range labels {
+				fields[key] = value
+			}
+			entry.Fields = fields
+		}
+		p.parsedCount.Add(1)
+		p.parsed <- entry
+	}
+
+	for item := range p.lines {
+		key := assemblerKey{source: item.source, replay: item.replay}
+		assembler, exists := assemblers[key]
+		if !exists {
+			assembler = &lineAssembler{}
+			assemblers[key] = assembler
+		}
+		parser, labels := p.sourceConfig(item.source)
+		if item.flush {
+			if done := assembler.flush(); done != nil {
+				emit(done, labels)
+			}
+			continue
+		}
+
+		done, merged, valid := assembler.feed(parser, item.line)
+		switch {
+		case !valid:
+			p.invalid.Add(1)
+			p.deadLetter(item, parser)
+		case merged:
+			p.merged.Add(1)
+		}
+		if done != nil {
+			emit(done, labels)
+		}
+	}
+
+	keys := make([]assemblerKey, 0, len(assemblers))
+	for key := range assemblers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].source != keys[j].source {
+			return keys[i].source < keys[j].source
+		}
+		return !keys[i].replay
+	})
+	for _, key := range keys {
+		if done := assemblers[key].flush(); done != nil {
+			_, labels := p.sourceConfig(key.source)
+			emit(done, labels)
+		}
+	}
+}
+
+// deadLetter 把无法解析的行连同来源和原因写入死信，写入失败计入SinkErrors
+func (p *Pipeline) deadLetter(item sourceLine, parser Parser) {
+	p.configMutex.RLock()
+	defer p.configMutex.RUnlock()
+	if p.config.DeadLetters == nil {
+		return
+	}
+	letter := DeadLetter{Time: time.Now(), Source: item.source, Line: item.line, Reason: parseFailure(parser, item.line)}
+	if err := p.config.DeadLetters.WriteDeadLetter(letter); err != nil {
+		p.sinkErrors.Add(1)
+		fmt.Printf("写入死信失败: %v\n", err)
+		return
+	}
+	p.deadLetters.Add(1)
+}
+
+// ReplayDeadLetters 取出store中的全部死信，按来源重新提交给管道，用各来源当前的解析器解析，
+// 在修复解析器后调用。仍然无法解析的行再次写入管道的死信；ctx取消或管道关闭时没有提交的死信放回store。
+// 返回重新提交的行数
+func (p *Pipeline) ReplayDeadLetters(ctx context.Context, store DeadLetterStore) (int, error) {
+	letters, err := store.Drain()
+	if err != nil {
+		return 0, err
+	}
+	var sources []string
+	seen := make(map[string]bool)
+	for i, letter := range letters {
+		if err := p.send(ctx, sourceLine{source: letter.Source, line: letter.Line, replay: true}); err != nil {
+			errs := []error{err}
+			for _, rest := range letters[i:] {
+				if writeErr := store.WriteDeadLetter(rest); writeErr != nil {
+					errs = append(errs, writeErr)
+					break
+				}
+			}
+			return i, errors.Join(errs...)
+		}
+		if !seen[letter.Source] {
+			seen[letter.Source] = true
+			sources = append(sources, letter.Source)
+		}
+	}
+	// 输出重新组装的最后一条多行日志
+	for _, source := range sources {
+		if err := p.send(ctx, sourceLine{source: source, flush: true, replay: true}); err != nil {
+			return len(letters), err
+		}
+	}
+	return len(letters), nil
+}
+
+// filterStage 依次执行处理步骤
+func (p *Pipeline) filterStage() {
+	defer close(p.filtered)
+	for entry := range p.parsed {
+		p.configMutex.RLock()
+		entry, ok := runProcessors(p.config.Processors, entry)
+		p.configMutex.RUnlock()
+		if !ok {
+			p.dropped.Add(1)
+			continue
+		}
+		p.filtered <- entry
+	}
+}
+
+// sinkStage 把日志写入所有输出，单个输出失败不影响其他输出；输入结束后Flush实现了Flusher的输出
+func (p *Pipeline) sinkStage() {
+	defer close(p.done)
+	for entry := range p.filtered {
+		failed := false
+		p.configMutex.RLock()
+		for _, sink := range p.config.Sinks {
+			if err := sink.Write(entry); err != nil {
+				p.sinkErrors.Add(1)
+				failed = true
+				fmt.Printf("写入输出失败: %v\n", err)
+			}
+		}
+		p.configMutex.RUnlock()
+		if !failed {
+			p.written.Add(1)
+		}
+	}
+
+	// 输入已排空，写出带缓冲的输出中剩余的日志
+	p.configMutex.RLock()
+	defer p.configMutex.RUnlock()
+	for _, sink := range p.config.Sinks {
+		if flusher, ok := sink.(Flusher); ok {
+			if err := flusher.Flush(); err != nil {
+				p.sinkErrors.Add(1)
+				fmt.Printf("写入输出失败: %v\n", err)
+			}
+		}
+	}
+}
+
+// Shutdown 停止接收新日志，等待已提交的日志（包括各来源未完成的多行日志）流经所有阶段并写入输出。
+// ctx在排空之前取消时返回ctx.Err()，剩余的日志仍在后台继续处理。可以重复调用
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		go func() {
+			// 阻塞在满通道上的Submit仍会完成，之后再关闭输入
+			p.inflight.Wait()
+			close(p.lines)
+		}()
+	}
+	p.mutex.Unlock()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 返回各阶段的计数和通道中排队的数量
+func (p *Pipeline) Stats() PipelineStats {
+	return PipelineStats{
+		Received:      p.received.Load(),
+		Invalid:       p.invalid.Load(),
+		DeadLetters:   p.deadLetters.Load(),
+		Merged:        p.merged.Load(),
+		Parsed:        p.parsedCount.Load(),
+		Dropped:       p.dropped.Load(),
+		Written:       p.written.Load(),
+		SinkErrors:    p.sinkErrors.Load(),
+		QueuedLines:   len(p.lines),
+		QueuedParsed:  len(p.parsed),
+		QueuedEntries: len(p.filtered),
+	}
+}
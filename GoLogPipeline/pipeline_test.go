@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingSink 在release关闭之前阻塞写入的测试用输出
+type blockingSink struct {
+	release chan struct{}
+	memorySink
+}
+
+func (bs *blockingSink) Write(entry LogEntry) error {
+	<-bs.release
+	return bs.memorySink.Write(entry)
+}
+
+func TestPipelineStagesAndShutdown(t *testing.T) {
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{
+		Processors: []Processor{ProcessorFunc(func(entry LogEntry) (LogEntry, bool) {
+			return entry, entry.Level != "DEBUG"
+		})},
+		Sinks: []Sink{sink},
+	})
+
+	ctx := context.Background()
+	for _, line := range []string{
+		"2024-01-15 10:30:15 [INFO] 启动",
+		"2024-01-15 10:30:16 [DEBUG] 调试",
+		"无法解析的日志",
+		"2024-01-15 10:30:17 [ERROR] 失败",
+	} {
+		if err := pipeline.Submit(ctx, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.entries) != 2 || sink.entries[0].Message != "启动" || sink.entries[1].Message != "失败" {
+		t.Fatalf("Shutdown应排空所有阶段并保持顺序: %+v", sink.entries)
+	}
+	stats := pipeline.Stats()
+	if stats.Received != 4 || stats.Invalid != 1 || stats.Parsed != 3 || stats.Dropped != 1 || stats.Written != 2 {
+		t.Errorf("阶段计数不正确: %+v", stats)
+	}
+	if err := pipeline.Submit(ctx, "2024-01-15 10:30:18 [INFO] 太晚了"); !errors.Is(err, ErrPipelineClosed) {
+		t.Errorf("关闭后提交应返回ErrPipelineClosed: %v", err)
+	}
+	if err := pipeline.Shutdown(ctx); err != nil {
+		t.Errorf("重复Shutdown应直接返回: %v", err)
+	}
+}
+
+func TestPipelineBackpressure(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}, BufferSize: 1})
+
+	// 输出阻塞时，通道和各阶段最多容纳有限的日志，之后Submit阻塞直到超时
+	accepted := 0
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err := pipeline.Submit(ctx, fmt.Sprintf("2024-01-15 10:30:15 [INFO] 日志%d", i))
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		accepted++
+	}
+	if accepted == 0 || accepted > 6 {
+		t.Fatalf("输出阻塞时应在有限的日志之后阻塞提交，实际接收%d条", accepted)
+	}
+
+	// 输出恢复前Shutdown超时，日志仍在管道中
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pipeline.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("输出阻塞时Shutdown应超时: %v", err)
+	}
+
+	close(sink.release)
+	if err := pipeline.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.entries) != accepted || pipeline.Stats().Written != int64(accepted) {
+		t.Errorf("已接收的%d条日志应全部写入: %d", accepted, len(sink.entries))
+	}
+}
+
+func TestPipelineConcurrentSources(t *testing.T) {
+	multiline, _ := NewMultilineParser(ParserFunc(ParseLine), "")
+	processor := NewLogProcessor()
+	processor.SetMaxEntries(150)
+	pipeline := NewPipeline(PipelineConfig{Parser: multiline, Sinks: []Sink{processor}, BufferSize: 4})
+
+	// 两个来源同时读取，堆栈按来源分别合并
+	var wg sync.WaitGroup
+	for _, source := range []string{"a", "b"} {
+		var lines []string
+		for i := 0; i < 100; i++ {
+			lines = append(lines, fmt.Sprintf("2024-01-15 10:30:15 [ERROR] %s-%d", source, i), "\tat "+source)
+		}
+		wg.Add(1)
+		go func(source string, content string) {
+			defer wg.Done()
+			if err := pipeline.Consume(context.Background(), source, strings.NewReader(content)); err != nil {
+				t.Error(err)
+			}
+		}(source, strings.Join(lines, "\n"))
+	}
+	wg.Wait()
+	if err := pipeline.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := pipeline.Stats()
+	if stats.Received != 400 || stats.Merged != 200 || stats.Written != 200 || stats.Invalid != 0 {
+		t.Errorf("并发来源的计数不正确: %+v", stats)
+	}
+	for _, entry := range processor.Entries() {
+		source := entry.Message[:1]
+		if !strings.HasSuffix(entry.Message, "\n\tat "+source) {
+			t.Fatalf("续行合并到了其他来源的日志: %q", entry.Message)
+		}
+	}
+	if len(processor.Entries()) != 150 || processor.Evicted() != 50 {
+		t.Errorf("LogProcessor应只保留最近的150条: %d, 淘汰%d", len(processor.Entries()), processor.Evicted())
+	}
+}
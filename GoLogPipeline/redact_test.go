@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRedactionRules(t *testing.T) {
+	redactor, err := NewRedactor(DefaultRedactionRules()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, _ := redactor.Process(LogEntry{
+		Level:   "INFO",
+		Message: "用户 alice.w@example.com.cn 绑定手机13812345678，卡号 4111 1111 1111 1111，订单1234567890123456",
+		Fields:  map[string]string{"contact": "+86 139-1234-5678", "order": "20240115103015"},
+	})
+	want := "用户 [email] 绑定手机[phone]，卡号 ************1111，订单1234567890123456"
+	if entry.Message != want {
+		t.Errorf("消息脱敏不正确:\n%s\n期望:\n%s", entry.Message, want)
+	}
+	if entry.Fields["order"] != "20240115103015" || !strings.Contains(entry.Fields["contact"], "[phone]") {
+		t.Errorf("字段脱敏不正确: %v", entry.Fields)
+	}
+
+	stats := redactor.Stats()
+	if stats["email"] != (RedactionStats{Entries: 1, Matches: 1}) || stats["phone"] != (RedactionStats{Entries: 1, Matches: 2}) || stats["card"].Matches != 1 {
+		t.Errorf("按规则的统计不正确: %+v", stats)
+	}
+}
+
+func TestRedactorCustomRulesAndFieldMasks(t *testing.T) {
+	redactor, err := NewRedactor(
+		RedactionRule{Name: "id_card", Pattern: `\b(\d{6})\d{8}(\d{3}[\dXx])\b`, Replacement: "$1********$2"},
+		RedactionRule{Name: "token", Pattern: `token=\S+`, Replacement: "token=***", Fields: []string{"message"}},
+		MaskFields("secrets", "Password", "api_key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := map[string]string{"password": "hunter2", "note": "token=abc", "id": "110101199003071234"}
+	entry, _ := redactor.Process(LogEntry{Message: "登录 token=abc123 身份证110101199003071234", Fields: original})
+
+	if entry.Message != "登录 token=*** 身份证110101********1234" {
+		t.Errorf("自定义规则未生效: %s", entry.Message)
+	}
+	if entry.Fields["password"] != "***" || entry.Fields["note"] != "token=abc" || entry.Fields["id"] != "110101********1234" {
+		t.Errorf("字段规则不正确: %v", entry.Fields)
+	}
+	if original["password"] != "hunter2" {
+		t.Error("不应修改调用方的Fields")
+	}
+	if stats := redactor.Stats(); stats["secrets"].Entries != 1 || stats["id_card"].Matches != 2 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+
+	for _, rules := range [][]RedactionRule{
+		{{Pattern: `x`}},
+		{{Name: "a", Pattern: `x`}, {Name: "a", Pattern: `y`}},
+		{{Name: "bad", Pattern: `(`}},
+		{{Name: "empty"}},
+	} {
+		if _, err := NewRedactor(rules...); err == nil {
+			t.Errorf("应拒绝规则: %+v", rules)
+		}
+	}
+}
+
+func TestRedactorInPipeline(t *testing.T) {
+	redactor, _ := NewRedactor(EmailRule())
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{
+		Parser:     NewJSONParser(),
+		Processors: []Processor{redactor},
+		Sinks:      []Sink{sink},
+	})
+	pipeline.Submit(context.Background(), `{"level":"info","msg":"发送邮件给 bob@example.com","to":"bob@example.com"}`)
+	pipeline.Submit(context.Background(), `{"level":"info","msg":"没有敏感信息"}`)
+	if err := pipeline.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.entries) != 2 || strings.Contains(sink.entries[0].Message, "@") || sink.entries[0].Fields["to"] != "[email]" {
+		t.Errorf("到达输出的日志应已脱敏: %+v", sink.entries)
+	}
+	if stats := redactor.Stats()["email"]; stats.Entries != 1 || stats.Matches != 2 {
+		t.Errorf("统计不正确: %+v", stats)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayWithFixedParser(t *testing.T) {
+	archive, err := NewArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := NewMultiTenantPipeline()
+	pipeline.SetArchive(archive)
+	pipeline.RegisterTenant(TenantConfig{ID: "app-a"})
+
+	pipeline.Ingest("app-a", "2024-01-15 10:30:15 [INFO] 用户登录 user=42")
+	pipeline.Ingest("app-a", "2024-01-15T10:30:16Z [ERROR] 新格式的时间戳")
+	pipeline.Ingest("app-a", "2024-01-15 10:30:17 [DEBUG] 调试信息")
+
+	usage, _ := pipeline.Usage("app-a")
+	if usage.Accepted != 2 || usage.Invalid != 1 {
+		t.Fatalf("旧解析逻辑应有1条无法解析: %+v", usage)
+	}
+
+	// 修复解析逻辑，并增加补充字段和过滤DEBUG的处理步骤
+	pipeline.SetParser(func(line string) (LogEntry, bool) {
+		if entry, ok := ParseLine(line); ok {
+			return entry, true
+		}
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) < 3 {
+			return LogEntry{}, false
+		}
+		timestamp, err := time.Parse(time.RFC3339, parts[0])
+		if err != nil {
+			return LogEntry{}, false
+		}
+		return LogEntry{Timestamp: timestamp, Level: strings.Trim(parts[1], "[]"), Message: parts[2]}, true
+	})
+	pipeline.Use(
+		ProcessorFunc(func(entry LogEntry) (LogEntry, bool) {
+			return entry, entry.Level != "DEBUG"
+		}),
+		ProcessorFunc(func(entry LogEntry) (LogEntry, bool) {
+			if i := strings.Index(entry.Message, "user="); i >= 0 {
+				entry.Fields = map[string]string{"user": entry.Message[i+len("user="):]}
+			}
+			return entry, true
+		}),
+	)
+
+	output := &memorySink{}
+	stats, err := pipeline.Replay(archive, ReplayRequest{}, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 3 || stats.Replayed != 2 || stats.Dropped != 1 || stats.Invalid != 0 {
+		t.Errorf("回放统计不正确: %+v", stats)
+	}
+	if len(output.entries) != 2 || output.entries[0].Fields["user"] != "42" || output.entries[1].Level != "ERROR" {
+		t.Errorf("回放结果不正确: %+v", output.entries)
+	}
+	if output.entries[1].Tenant != "app-a" {
+		t.Errorf("回放的日志应保留租户: %+v", output.entries[1])
+	}
+
+	// 回放不影响租户缓冲区和用量
+	entries, _ := pipeline.Entries("app-a")
+	after, _ := pipeline.Usage("app-a")
+	if len(entries) != 2 || after.Received != usage.Received {
+		t.Errorf("回放不应写入租户流: %d 条, %+v", len(entries), after)
+	}
+}
+
+func TestReplayRangeAndTenants(t *testing.T) {
+	dir := t.TempDir()
+	archive, _ := NewArchive(dir)
+	pipeline := NewMultiTenantPipeline()
+	pipeline.SetArchive(archive)
+	pipeline.RegisterTenant(TenantConfig{ID: "app-a"})
+	pipeline.RegisterTenant(TenantConfig{ID: "app-b"})
+
+	now := time.Date(2024, 1, 14, 23, 0, 0, 0, time.UTC)
+	pipeline.now = func() time.Time { return now }
+	for i := 0; i < 4; i++ {
+		pipeline.Ingest("app-a", "2024-01-15 10:30:15 [INFO] A")
+		pipeline.Ingest("app-b", "2024-01-15 10:30:15 [INFO] B")
+		now = now.Add(time.Hour)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if len(files) != 2 {
+		t.Errorf("期望按日期分为2个归档文件，实际%d个", len(files))
+	}
+
+	output := &memorySink{}
+	req := ReplayRequest{
+		From:    time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		To:      time.Date(2024, 1, 15, 2, 0, 0, 0, time.UTC),
+		Tenants: []string{"app-b"},
+	}
+	stats, err := pipeline.Replay(archive, req, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Replayed != 2 {
+		t.Errorf("期望回放app-b在00:00和01:00的2条日志，实际%+v", stats)
+	}
+	for _, entry := range output.entries {
+		if entry.Tenant != "app-b" {
+			t.Errorf("不应回放其他租户: %+v", entry)
+		}
+	}
+}
+
+func TestReplayCommand(t *testing.T) {
+	dir := t.TempDir()
+	archive, _ := NewArchive(filepath.Join(dir, "archive"))
+	received := time.Date(2024, 1, 15, 8, 0, 0, 0, time.UTC)
+	archive.Append(ArchiveRecord{ReceivedAt: received, Tenant: "app-a", Line: "2024-01-15 08:00:00 [warn] 小写级别"})
+	archive.Append(ArchiveRecord{ReceivedAt: received, Tenant: "app-a", Line: "无法解析"})
+
+	out := filepath.Join(dir, "replay.jsonl")
+	err := runReplay([]string{"-archive", filepath.Join(dir, "archive"), "-from", "2024-01-15", "-to", "2024-01-16", "-out", out})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry LogEntry
+		json.Unmarshal(scanner.Bytes(), &entry)
+		entries = append(entries, entry)
+	}
+	if len(entries) != 1 || entries[0].Level != "WARN" || entries[0].Tenant != "app-a" {
+		t.Errorf("回放输出不正确: %+v", entries)
+	}
+
+	if err := runReplay([]string{"-from", "昨天"}); err == nil {
+		t.Error("无效的时间应报错")
+	}
+}
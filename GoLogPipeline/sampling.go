@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxLimiterKeys 限流器最多同时跟踪的key数
+const DefaultMaxLimiterKeys = 10000
+
+// overflowKey 超出MaxKeys的key共用的限流桶
+const overflowKey = "_other"
+
+// DropStats 采样或限流的统计
+type DropStats struct {
+	Kept         int64            `json:"kept"`
+	Dropped      int64            `json:"dropped"`
+	DroppedByKey map[string]int64 `json:"dropped_by_key"`
+}
+
+// dropCounter 按key统计保留和丢弃的条数
+type dropCounter struct {
+	kept    int64
+	dropped map[string]int64
+	total   int64
+}
+
+func (c *dropCounter) drop(key string) {
+	if c.dropped == nil {
+		c.dropped = make(map[string]int64)
+	}
+	c.dropped[key]++
+	c.total++
+}
+
+func (c *dropCounter) stats() DropStats {
+	byKey := make(map[string]int64, len(c.dropped))
+	for key, n := range c.dropped {
+		byKey[key] = n
+	}
+	return DropStats{Kept: c.kept, Dropped: c.total, DroppedByKey: byKey}
+}
+
+// SamplingRule 采样规则：匹配级别的日志按key每N条保留1条，其余级别全部保留
+type SamplingRule struct {
+	Rate     int      // 每Rate条保留1条，<=1表示不采样
+	Levels   []string // 参与采样的级别，为空时为DEBUG和INFO
+	KeyField string   // 按"tenant"、"level"、"source"或Fields中的字段分别计数，为空时所有日志共用一个计数
+}
+
+// Sampler 按key的确定性采样：每个key的第1、N+1、2N+1……条保留，
+// 保留的日志在Fields中记录sample_rate，下游可以据此还原数量
+type Sampler struct {
+	rule    SamplingRule
+	levels  map[string]bool
+	seen    map[string]int
+	counter dropCounter
+	mutex   sync.Mutex
+}
+
+// NewSampler 创建采样器，作为Processor放入管道
+func NewSampler(rule SamplingRule) *Sampler {
+	levels := rule.Levels
+	if len(levels) == 0 {
+		levels = []string{"DEBUG", "INFO"}
+	}
+	s := &Sampler{rule: rule, levels: make(map[string]bool), seen: make(map[string]int)}
+	for _, level := range levels {
+		s.levels[strings.ToUpper(level)] = true
+	}
+	return s
+}
+
+// Process 实现Processor接口
+func (s *Sampler) Process(entry LogEntry) (LogEntry, bool) {
+	if s.rule.Rate <= 1 || !s.levels[strings.ToUpper(entry.Level)] {
+		return entry, true
+	}
+	key := entryValue(entry, s.rule.KeyField)
+
+	s.mutex.Lock()
+	n := s.seen[key]
+	s.seen[key] = (n + 1) % s.rule.Rate
+	if n != 0 {
+		s.counter.drop(key)
+		s.mutex.Unlock()
+		return entry, false
+	}
+	s.counter.kept++
+	s.mutex.Unlock()
+
+	fields := make(map[string]string, len(entry.Fields)+1)
+	for k, v := range entry.Fields {
+		fields[k] = v
+	}
+	fields["sample_rate"] = strconv.Itoa(s.rule.Rate)
+	entry.Fields = fields
+	return entry, true
+}
+
+// Stats 返回采样保留和丢弃的条数，只统计参与采样的日志
+func (s *Sampler) Stats() DropStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.counter.stats()
+}
+
+// RateLimit 限流配置：每个key以PerSecond的速率补充令牌，最多积累Burst个
+type RateLimit struct {
+	PerSecond float64
+	Burst     int    // <=0时为PerSecond向上取整
+	KeyField  string // 默认 "source"，即网络来源、租户等写入的来源标签
+	MaxKeys   int    // 最多跟踪的key数，超出时新key共用一个桶，<=0时为DefaultMaxLimiterKeys
+}
+
+// tokenBucket 单个key的令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter 按来源的令牌桶限流，超出速率的日志被丢弃，防止刷日志的服务撑爆内存或拖垮下游输出
+type RateLimiter struct {
+	limit   RateLimit
+	buckets map[string]*tokenBucket
+	counter dropCounter
+	mutex   sync.Mutex
+	now     func() time.Time
+}
+
+// NewRateLimiter 创建限流器，作为Processor放入管道
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = max(1, int(limit.PerSecond+0.999))
+	}
+	if limit.KeyField == "" {
+		limit.KeyField = "source"
+	}
+	if limit.MaxKeys <= 0 {
+		limit.MaxKeys = DefaultMaxLimiterKeys
+	}
+	return &RateLimiter{limit: limit, buckets: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// bucketFor 返回key的令牌桶，key过多时先清理已经回满的桶，仍然过多时使用共用桶。调用方需持有mutex
+func (rl *RateLimiter) bucketFor(key string, now time.Time) (string, *tokenBucket) {
+	if bucket, exists := rl.buckets[key]; exists {
+		return key, bucket
+	}
+	if len(rl.buckets) >= rl.limit.MaxKeys {
+		for k, bucket := range rl.buckets {
+			if rl.refill(bucket, now) >= float64(rl.limit.Burst) {
+				delete(rl.buckets, k)
+			}
+		}
+		if len(rl.buckets) >= rl.limit.MaxKeys {
+			key = overflowKey
+			if bucket, exists := rl.buckets[key]; exists {
+				return key, bucket
+			}
+		}
+	}
+	bucket := &tokenBucket{tokens: float64(rl.limit.Burst), last: now}
+	rl.buckets[key] = bucket
+	return key, bucket
+}
+
+// refill 按经过的时间补充令牌
+func (rl *RateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens = min(float64(rl.limit.Burst), bucket.tokens+elapsed*rl.limit.PerSecond)
+		bucket.last = now
+	}
+	return bucket.tokens
+}
+
+// Process 实现Processor接口
+func (rl *RateLimiter) Process(entry LogEntry) (LogEntry, bool) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := rl.now()
+	key, bucket := rl.bucketFor(entryValue(entry, rl.limit.KeyField), now)
+	if rl.refill(bucket, now) < 1 {
+		rl.counter.drop(key)
+		return entry, false
+	}
+	bucket.tokens--
+	rl.counter.kept++
+	return entry, true
+}
+
+// Stats 返回通过和被限流丢弃的条数
+func (rl *RateLimiter) Stats() DropStats {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return rl.counter.stats()
+}
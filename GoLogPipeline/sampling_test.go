@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSamplerKeepsOneInN(t *testing.T) {
+	sampler := NewSampler(SamplingRule{Rate: 3, KeyField: "service"})
+	kept := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		for _, service := range []string{"api", "db"} {
+			for _, level := range []string{"DEBUG", "ERROR"} {
+				entry, ok := sampler.Process(LogEntry{Level: level, Message: fmt.Sprint(i), Fields: map[string]string{"service": service}})
+				if ok {
+					kept[service+"/"+level]++
+					if level == "DEBUG" && (entry.Fields["sample_rate"] != "3" || entry.Message != fmt.Sprint(i)) {
+						t.Errorf("保留的采样日志应记录sample_rate: %+v", entry)
+					}
+				}
+			}
+		}
+	}
+	// 每个key的第1、4、7、10条保留，ERROR不参与采样
+	if kept["api/DEBUG"] != 4 || kept["db/DEBUG"] != 4 || kept["api/ERROR"] != 10 || kept["db/ERROR"] != 10 {
+		t.Errorf("采样结果不正确: %v", kept)
+	}
+	stats := sampler.Stats()
+	if stats.Kept != 8 || stats.Dropped != 12 || stats.DroppedByKey["api"] != 6 || stats.DroppedByKey["db"] != 6 {
+		t.Errorf("采样统计不正确: %+v", stats)
+	}
+
+	if _, ok := NewSampler(SamplingRule{Rate: 1}).Process(LogEntry{Level: "DEBUG"}); !ok {
+		t.Error("Rate<=1时不采样")
+	}
+}
+
+func TestRateLimiterPerSource(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{PerSecond: 2, Burst: 5})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	send := func(source string, n int) int {
+		passed := 0
+		for i := 0; i < n; i++ {
+			if _, ok := limiter.Process(LogEntry{Level: "INFO", Fields: map[string]string{"source": source}}); ok {
+				passed++
+			}
+		}
+		return passed
+	}
+
+	// 刷日志的来源只通过突发量，不影响其他来源
+	if got := send("noisy", 100); got != 5 {
+		t.Errorf("突发量之外应被限流，实际通过%d条", got)
+	}
+	if got := send("quiet", 3); got != 3 {
+		t.Errorf("其他来源不应受影响，实际通过%d条", got)
+	}
+	now = now.Add(1500 * time.Millisecond)
+	if got := send("noisy", 10); got != 3 {
+		t.Errorf("1.5秒按每秒2个补充3个令牌，实际通过%d条", got)
+	}
+	now = now.Add(time.Hour)
+	if got := send("noisy", 10); got != 5 {
+		t.Errorf("令牌最多积累到Burst，实际通过%d条", got)
+	}
+
+	stats := limiter.Stats()
+	if stats.Kept != 16 || stats.Dropped != 107 || stats.DroppedByKey["noisy"] != 107 || stats.DroppedByKey["quiet"] != 0 {
+		t.Errorf("限流统计不正确: %+v", stats)
+	}
+}
+
+func TestRateLimiterKeysAndPipeline(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{PerSecond: 1, MaxKeys: 2})
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	for _, source := range []string{"a", "b", "c", "d"} {
+		limiter.Process(LogEntry{Fields: map[string]string{"source": source}})
+	}
+	// a、b的桶未回满，c、d共用溢出桶
+	if stats := limiter.Stats(); stats.Kept != 3 || stats.DroppedByKey[overflowKey] != 1 || len(limiter.buckets) != 3 {
+		t.Errorf("超出MaxKeys的key应共用一个桶: %+v %d", stats, len(limiter.buckets))
+	}
+	now = now.Add(time.Minute)
+	limiter.Process(LogEntry{Fields: map[string]string{"source": "e"}})
+	if _, exists := limiter.buckets["e"]; !exists {
+		t.Error("回满的桶应被清理，为新key腾出位置")
+	}
+
+	// 在管道的filter阶段限流，丢弃的日志计入Dropped
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{
+		Processors: []Processor{NewRateLimiter(RateLimit{PerSecond: 0.001, Burst: 2}), NewSampler(SamplingRule{Rate: 2})},
+		Sinks:      []Sink{sink},
+	})
+	for i := 0; i < 10; i++ {
+		pipeline.Submit(context.Background(), fmt.Sprintf("2024-01-15 10:30:%02d [INFO] 刷屏", i))
+	}
+	pipeline.Shutdown(context.Background())
+	if len(sink.entries) != 1 || pipeline.Stats().Dropped != 9 {
+		t.Errorf("限流后再采样应只剩1条: %d %+v", len(sink.entries), pipeline.Stats())
+	}
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink 日志输出目标
+type Sink interface {
+	Write(entry LogEntry) error
+}
+
+// Flusher 带缓冲的输出，Pipeline排空后会调用Flush写出剩余的日志
+type Flusher interface {
+	Flush() error
+}
+
+// BatchWriter 批量写入的目标，由BatchingSink负责攒批和重试
+type BatchWriter interface {
+	WriteBatch(entries []LogEntry) error
+}
+
+// PartialBatchError 一批中只有部分日志写入失败，BatchingSink只重试Failed中的日志
+type PartialBatchError struct {
+	Failed []LogEntry
+	Err    error
+}
+
+func (e *PartialBatchError) Error() string {
+	return fmt.Sprintf("%d条日志写入失败: %v", len(e.Failed), e.Err)
+}
+
+func (e *PartialBatchError) Unwrap() error {
+	return e.Err
+}
+
+// 批量输出的默认配置
+const (
+	DefaultBatchSize    = 500
+	DefaultMaxRetries   = 3
+	DefaultRetryBackoff = 100 * time.Millisecond
+)
+
+// BatchConfig 批量输出的配置
+type BatchConfig struct {
+	BatchSize     int           // 攒够多少条写入一次，<=0时为DefaultBatchSize
+	FlushInterval time.Duration // 定时写出未满的批次，0表示只在攒满或Flush时写入
+	MaxRetries    int           // 失败后最多重试的次数，<0表示不重试，0时为DefaultMaxRetries
+	RetryBackoff  time.Duration // 第一次重试前的等待时间，之后每次翻倍，<=0时为DefaultRetryBackoff
+}
+
+// SinkMetrics 单个输出的写入统计
+type SinkMetrics struct {
+	Name      string    `json:"name"`
+	Written   int64     `json:"written"`  // 写入成功的日志条数
+	Failed    int64     `json:"failed"`   // 重试用尽后放弃的日志条数
+	Batches   int64     `json:"batches"`  // 写入的批次数
+	Retries   int64     `json:"retries"`  // 重试次数
+	Buffered  int       `json:"buffered"` // 等待写入的日志条数
+	LastError string    `json:"last_error,omitempty"`
+	LastFlush time.Time `json:"last_flush,omitempty"`
+}
+
+// BatchingSink 把日志攒批后交给BatchWriter写入，失败时按指数退避重试。
+// 攒满一批的Write会同步写入，输出慢时阻塞调用方，与Pipeline的背压一致
+type BatchingSink struct {
+	name       string
+	writer     BatchWriter
+	config     BatchConfig
+	mutex      sync.Mutex // 保护buffer和metrics
+	flushMutex sync.Mutex // 保证批次按顺序写入
+	buffer     []LogEntry
+	metrics    SinkMetrics
+	stop       chan struct{}
+	stopped    chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewBatchingSink 创建批量输出，FlushInterval>0时启动定时写出的goroutine，用完需Close
+func NewBatchingSink(name string, writer BatchWriter, config BatchConfig) *BatchingSink {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = DefaultRetryBackoff
+	}
+	s := &BatchingSink{
+		name:    name,
+		writer:  writer,
+		config:  config,
+		metrics: SinkMetrics{Name: name},
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if config.FlushInterval > 0 {
+		go s.flushLoop()
+	} else {
+		close(s.stopped)
+	}
+	return s
+}
+
+func (s *BatchingSink) flushLoop() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				fmt.Printf("输出 %s 定时写入失败: %v\n", s.name, err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Write 实现Sink接口，攒满一批时立即写入
+func (s *BatchingSink) Write(entry LogEntry) error {
+	s.mutex.Lock()
+	s.buffer = append(s.buffer, entry)
+	if len(s.buffer) < s.config.BatchSize {
+		s.mutex.Unlock()
+		return nil
+	}
+	batch := s.take()
+	s.mutex.Unlock()
+	return s.send(batch)
+}
+
+// Flush 写出缓冲中的全部日志
+func (s *BatchingSink) Flush() error {
+	s.mutex.Lock()
+	batch := s.take()
+	s.mutex.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return s.send(batch)
+}
+
+// take 取出缓冲中的日志，调用方需持有mutex
+func (s *BatchingSink) take() []LogEntry {
+	batch := s.buffer
+	s.buffer = nil
+	return batch
+}
+
+// send 写入一批日志，部分失败时只重试失败的日志，重试用尽后放弃并返回最后的错误
+func (s *BatchingSink) send(batch []LogEntry) error {
+	s.flushMutex.Lock()
+	defer s.flushMutex.Unlock()
+
+	backoff := s.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.writer.WriteBatch(batch)
+		written := len(batch)
+		var partial *PartialBatchError
+		if errors.As(err, &partial) {
+			written -= len(partial.Failed)
+			batch = partial.Failed
+		} else if err != nil {
+			written = 0
+		}
+
+		s.mutex.Lock()
+		s.metrics.Written += int64(written)
+		if err == nil {
+			s.metrics.Batches++
+			s.metrics.LastFlush = time.Now()
+			s.mutex.Unlock()
+			return nil
+		}
+		s.metrics.LastError = err.Error()
+		if attempt >= s.config.MaxRetries {
+			s.metrics.Failed += int64(len(batch))
+			s.mutex.Unlock()
+			return fmt.Errorf("输出 %s 重试%d次后仍失败: %w", s.name, attempt, err)
+		}
+		s.metrics.Retries++
+		s.mutex.Unlock()
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Metrics 返回写入统计
+func (s *BatchingSink) Metrics() SinkMetrics {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	metrics := s.metrics
+	metrics.Buffered = len(s.buffer)
+	return metrics
+}
+
+// Close 停止定时写出，写出剩余的日志并关闭实现了io.Closer的BatchWriter
+func (s *BatchingSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.stopped
+		err = s.Flush()
+		if closer, ok := s.writer.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// ElasticsearchWriter 通过_bulk接口把日志索引到Elasticsearch。
+// Index中的"{date}"替换为日志时间（UTC）的日期，如 "logs-{date}" 按天分索引
+type ElasticsearchWriter struct {
+	URL      string // 如 http://localhost:9200
+	Index    string
+	Username string // 为空时不使用Basic认证
+	Password string
+	Client   *http.Client // 为nil时使用http.DefaultClient
+}
+
+// indexFor 返回日志写入的索引名
+func (w *ElasticsearchWriter) indexFor(entry LogEntry) string {
+	return strings.ReplaceAll(w.Index, "{date}", entry.Timestamp.UTC().Format("2006.01.02"))
+}
+
+// WriteBatch 实现BatchWriter接口，部分文档被拒绝时返回PartialBatchError
+func (w *ElasticsearchWriter) WriteBatch(entries []LogEntry) error {
+	var body bytes.Buffer
+	for _, entry := range entries {
+		action, _ := json.Marshal(map[string]map[string]string{"index": {"_index": w.indexFor(entry)}})
+		doc, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(w.URL, "/")+"/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if w.Username != "" {
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+	data, err := doRequest(w.Client, req)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("无法解析bulk响应: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+
+	partial := &PartialBatchError{}
+	for i, item := range result.Items {
+		for _, op := range item {
+			if op.Status >= 300 && i < len(entries) {
+				partial.Failed = append(partial.Failed, entries[i])
+				if partial.Err == nil {
+					partial.Err = fmt.Errorf("状态码%d: %s", op.Status, op.Error)
+				}
+			}
+		}
+	}
+	if len(partial.Failed) == 0 {
+		return fmt.Errorf("bulk响应报告错误但没有失败的文档")
+	}
+	return partial
+}
+
+// KafkaMessage 发送到Kafka的一条消息
+type KafkaMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// KafkaProducer 向Kafka主题发送一批消息，可以用任意Kafka客户端实现
+type KafkaProducer interface {
+	Produce(topic string, messages []KafkaMessage) error
+}
+
+// KafkaWriter 把日志以JSON消息发送到Kafka主题
+type KafkaWriter struct {
+	Topic    string
+	KeyField string // 作为消息key的字段："tenant"、"level"或Fields中的字段名，为空时不设置key
+	Producer KafkaProducer
+}
+
+// keyFor 返回日志的消息key，相同key的消息进入同一分区
+func (w *KafkaWriter) keyFor(entry LogEntry) []byte {
+	if key := entryValue(entry, w.KeyField); key != "" {
+		return []byte(key)
+	}
+	return nil
+}
+
+// WriteBatch 实现BatchWriter接口
+func (w *KafkaWriter) WriteBatch(entries []LogEntry) error {
+	messages := make([]KafkaMessage, 0, len(entries))
+	for _, entry := range entries {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, KafkaMessage{Key: w.keyFor(entry), Value: value})
+	}
+	return w.Producer.Produce(w.Topic, messages)
+}
+
+// KafkaRESTProducer 通过Kafka REST Proxy（v2接口）发送消息，不需要Kafka客户端库
+type KafkaRESTProducer struct {
+	URL    string       // 如 http://localhost:8082
+	Client *http.Client // 为nil时使用http.DefaultClient
+}
+
+// Produce 实现KafkaProducer接口，任一消息发送失败时返回错误，整批会被重试（至少一次）
+func (p *KafkaRESTProducer) Produce(topic string, messages []KafkaMessage) error {
+	type record struct {
+		Key   *string `json:"key,omitempty"`
+		Value string  `json:"value"`
+	}
+	records := make([]record, len(messages))
+	for i, message := range messages {
+		records[i].Value = base64.StdEncoding.EncodeToString(message.Value)
+		if message.Key != nil {
+			key := base64.StdEncoding.EncodeToString(message.Key)
+			records[i].Key = &key
+		}
+	}
+	body, err := json.Marshal(map[string][]record{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(p.URL, "/")+"/topics/"+topic, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.binary.v2+json")
+	data, err := doRequest(p.Client, req)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("无法解析Kafka REST响应: %v", err)
+	}
+	failed := 0
+	var first string
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil {
+			if failed == 0 {
+				first = offset.Error
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d条消息发送到主题 %s 失败: %s", failed, topic, first)
+	}
+	return nil
+}
+
+// doRequest 发送请求并返回响应体，非2xx状态码返回错误
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s 返回 %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
+
+// RotatingFileWriter 以NDJSON（每行一个JSON）写入文件，文件超过MaxBytes时轮转：
+// path改名为path.1，原来的path.1改名为path.2，依此类推，只保留MaxFiles个旧文件
+type RotatingFileWriter struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	mutex    sync.Mutex
+}
+
+// NewRotatingFileWriter 打开或创建文件并追加写入，maxBytes<=0表示不轮转
+func NewRotatingFileWriter(path string, maxBytes int64, maxFiles int) (*RotatingFileWriter, error) {
+	w := &RotatingFileWriter{path: path, maxBytes: maxBytes, maxFiles: maxFiles}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingFileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+// rotate 关闭当前文件并依次改名，调用方需持有mutex
+func (w *RotatingFileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if w.maxFiles <= 0 {
+		if err := os.Remove(w.path); err != nil {
+			return err
+		}
+		return w.open()
+	}
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxFiles))
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		old := fmt.Sprintf("%s.%d", w.path, i)
+		if _, err := os.Stat(old); err == nil {
+			if err := os.Rename(old, fmt.Sprintf("%s.%d", w.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// WriteBatch 实现BatchWriter接口，一条日志不会被拆到两个文件中
+func (w *RotatingFileWriter) WriteBatch(entries []LogEntry) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for i, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(data)) > w.maxBytes {
+			if err := w.rotate(); err != nil {
+				return &PartialBatchError{Failed: entries[i:], Err: err}
+			}
+		}
+		n, err := w.file.Write(data)
+		w.size += int64(n)
+		if err != nil {
+			return &PartialBatchError{Failed: entries[i:], Err: err}
+		}
+	}
+	return nil
+}
+
+// Close 关闭当前文件
+func (w *RotatingFileWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyWriter 前failures次写入失败的测试用BatchWriter
+type flakyWriter struct {
+	mutex    sync.Mutex
+	failures int
+	batches  [][]LogEntry
+}
+
+func (fw *flakyWriter) WriteBatch(entries []LogEntry) error {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+	if fw.failures > 0 {
+		fw.failures--
+		return errors.New("暂时不可用")
+	}
+	fw.batches = append(fw.batches, append([]LogEntry(nil), entries...))
+	return nil
+}
+
+func testEntry(i int) LogEntry {
+	return LogEntry{
+		Timestamp: time.Date(2024, 1, 15, 10, 30, i, 0, time.UTC),
+		Level:     "INFO",
+		Message:   fmt.Sprintf("日志%d", i),
+		Tenant:    []string{"app-a", "app-b"}[i%2],
+	}
+}
+
+func TestBatchingSinkRetriesAndMetrics(t *testing.T) {
+	writer := &flakyWriter{failures: 2}
+	sink := NewBatchingSink("flaky", writer, BatchConfig{BatchSize: 3, RetryBackoff: time.Millisecond})
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(testEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	metrics := sink.Metrics()
+	if metrics.Written != 6 || metrics.Batches != 2 || metrics.Retries != 2 || metrics.Buffered != 1 || metrics.LastError == "" {
+		t.Errorf("攒批和重试统计不正确: %+v", metrics)
+	}
+
+	// Pipeline排空后Flush剩余的日志
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}})
+	pipeline.Submit(context.Background(), "2024-01-15 10:30:20 [WARN] 最后一条")
+	if err := pipeline.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if metrics := sink.Metrics(); metrics.Written != 8 || metrics.Buffered != 0 || len(writer.batches) != 3 {
+		t.Errorf("Shutdown后应写出缓冲中的日志: %+v", metrics)
+	}
+
+	// 重试用尽后放弃并计入Failed
+	broken := NewBatchingSink("broken", &flakyWriter{failures: 100}, BatchConfig{BatchSize: 2, MaxRetries: 1, RetryBackoff: time.Millisecond})
+	broken.Write(testEntry(0))
+	if err := broken.Write(testEntry(1)); err == nil {
+		t.Error("重试用尽后应返回错误")
+	}
+	if metrics := broken.Metrics(); metrics.Failed != 2 || metrics.Retries != 1 || metrics.Written != 0 {
+		t.Errorf("放弃的日志应计入Failed: %+v", metrics)
+	}
+
+	// 定时写出未满的批次
+	timed := NewBatchingSink("timed", writer, BatchConfig{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer timed.Close()
+	timed.Write(testEntry(9))
+	deadline := time.Now().Add(time.Second)
+	for timed.Metrics().Written != 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if timed.Metrics().Written != 1 {
+		t.Error("FlushInterval到期应写出未满的批次")
+	}
+}
+
+func TestElasticsearchAndKafkaWriters(t *testing.T) {
+	var mutex sync.Mutex
+	var bulkBodies []string
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.URL.Path != "/_bulk" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body := new(strings.Builder)
+		bufio.NewReader(r.Body).WriteTo(body)
+		bulkBodies = append(bulkBodies, body.String())
+		if len(bulkBodies) == 1 {
+			// 第二个文档被限流，只重试它
+			fmt.Fprint(w, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"errors":false,"items":[{"index":{"status":201}}]}`)
+	}))
+	defer es.Close()
+
+	sink := NewBatchingSink("elasticsearch", &ElasticsearchWriter{URL: es.URL, Index: "logs-{date}"}, BatchConfig{BatchSize: 2, RetryBackoff: time.Millisecond})
+	sink.Write(testEntry(0))
+	if err := sink.Write(testEntry(1)); err != nil {
+		t.Fatal(err)
+	}
+	if len(bulkBodies) != 2 || strings.Count(bulkBodies[0], "\n") != 4 || strings.Count(bulkBodies[1], "\n") != 2 {
+		t.Fatalf("部分失败时应只重试被拒绝的文档: %q", bulkBodies)
+	}
+	if !strings.Contains(bulkBodies[1], `{"index":{"_index":"logs-2024.01.15"}}`) || !strings.Contains(bulkBodies[1], "日志1") {
+		t.Errorf("bulk请求格式不正确: %s", bulkBodies[1])
+	}
+	if metrics := sink.Metrics(); metrics.Written != 2 || metrics.Retries != 1 || metrics.Failed != 0 {
+		t.Errorf("Elasticsearch输出统计不正确: %+v", metrics)
+	}
+
+	var records []map[string]string
+	kafka := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Records []map[string]string `json:"records"`
+		}
+		if r.URL.Path != "/topics/logs" || json.NewDecoder(r.Body).Decode(&body) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		records = append(records, body.Records...)
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null},{"partition":1,"offset":1,"error_code":null,"error":null}]}`)
+	}))
+	defer kafka.Close()
+
+	writer := &KafkaWriter{Topic: "logs", KeyField: "tenant", Producer: &KafkaRESTProducer{URL: kafka.URL}}
+	if err := writer.WriteBatch([]LogEntry{testEntry(0), testEntry(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1]["key"] != base64.StdEncoding.EncodeToString([]byte("app-b")) {
+		t.Fatalf("Kafka消息应以租户为key: %+v", records)
+	}
+	value, _ := base64.StdEncoding.DecodeString(records[0]["value"])
+	var entry LogEntry
+	if json.Unmarshal(value, &entry) != nil || entry.Message != "日志0" {
+		t.Errorf("Kafka消息值应为日志JSON: %s", value)
+	}
+
+	if err := (&KafkaWriter{Topic: "missing", Producer: &KafkaRESTProducer{URL: kafka.URL}}).WriteBatch([]LogEntry{testEntry(0)}); err == nil {
+		t.Error("REST Proxy返回错误状态时应返回错误")
+	}
+}
+
+func TestRotatingFileWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.ndjson")
+	line, _ := json.Marshal(testEntry(0))
+	size := int64(len(line) + 1)
+
+	writer, err := NewRotatingFileWriter(path, 2*size, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewBatchingSink("file", writer, BatchConfig{BatchSize: 3})
+	for i := 0; i < 7; i++ {
+		sink.Write(testEntry(i))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 每个文件两条，7条日志轮转3次，只保留2个旧文件
+	read := func(name string) []string {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", name, err)
+		}
+		var messages []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var entry LogEntry
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("%s 不是NDJSON: %q", name, line)
+			}
+			messages = append(messages, entry.Message)
+		}
+		return messages
+	}
+	if got := read(path); strings.Join(got, ",") != "日志6" {
+		t.Errorf("当前文件内容不正确: %v", got)
+	}
+	if got := read(path + ".1"); strings.Join(got, ",") != "日志4,日志5" {
+		t.Errorf("path.1内容不正确: %v", got)
+	}
+	if got := read(path + ".2"); strings.Join(got, ",") != "日志2,日志3" {
+		t.Errorf("path.2内容不正确: %v", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Error("超出MaxFiles的旧文件应被删除")
+	}
+
+	// 重新打开时接着已有的大小计算轮转
+	writer, _ = NewRotatingFileWriter(path, 2*size, 2)
+	writer.WriteBatch([]LogEntry{testEntry(7), testEntry(8)})
+	writer.Close()
+	if got := read(path); strings.Join(got, ",") != "日志8" {
+		t.Errorf("重新打开后应接着已有大小轮转: %v", got)
+	}
+}
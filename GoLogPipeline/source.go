@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslogFacilities RFC 5424中设施编号对应的名称
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogLevel 把syslog严重程度映射为日志级别
+func syslogLevel(severity int) string {
+	switch {
+	case severity <= 3: // emerg, alert, crit, err
+		return "ERROR"
+	case severity == 4: // warning
+		return "WARN"
+	case severity == 7: // debug
+		return "DEBUG"
+	default: // notice, info
+		return "INFO"
+	}
+}
+
+// SyslogParser 解析RFC 5424和RFC 3164（BSD）格式的syslog消息。
+// 主机、程序等头部字段保存到Fields；RFC 3164的时间没有年份和时区，按UTC取最近的一年
+type SyslogParser struct {
+	now func() time.Time
+}
+
+// NewSyslogParser 创建syslog解析器
+func NewSyslogParser() *SyslogParser {
+	return &SyslogParser{now: time.Now}
+}
+
+// Parse 实现Parser接口
+func (p *SyslogParser) Parse(line string) (LogEntry, bool) {
+	line = strings.TrimRight(line, "\r\n\x00")
+	if !strings.HasPrefix(line, "<") {
+		return LogEntry{}, false
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return LogEntry{}, false
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri > 191 {
+		return LogEntry{}, false
+	}
+	fields := map[string]string{
+		"facility": syslogFacilities[pri/8],
+		"severity": strconv.Itoa(pri % 8),
+	}
+	entry := LogEntry{Level: syslogLevel(pri % 8), Fields: fields}
+
+	rest := line[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		return p.parse5424(entry, rest[2:])
+	}
+	return p.parse3164(entry, rest)
+}
+
+// parse5424 解析 "TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG"，"-" 表示空值
+func (p *SyslogParser) parse5424(entry LogEntry, rest string) (LogEntry, bool) {
+	parts := strings.SplitN(rest, " ", 6)
+	if len(parts) < 6 {
+		return LogEntry{}, false
+	}
+	if parts[0] != "-" {
+		timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			return LogEntry{}, false
+		}
+		entry.Timestamp = timestamp
+	} else {
+		entry.Timestamp = p.now().UTC()
+	}
+	for i, key := range []string{"host", "app", "procid", "msgid"} {
+		if parts[i+1] != "-" {
+			entry.Fields[key] = parts[i+1]
+		}
+	}
+
+	data, message, ok := splitStructuredData(parts[5])
+	if !ok {
+		return LogEntry{}, false
+	}
+	if data != "-" {
+		entry.Fields["structured_data"] = data
+	}
+	entry.Message = strings.TrimPrefix(message, "\ufeff") // 消息可以以UTF-8 BOM开头
+	return entry, true
+}
+
+// splitStructuredData 分离开头的结构化数据（"-" 或若干 [...] 元素）和消息
+func splitStructuredData(s string) (data, message string, ok bool) {
+	if strings.HasPrefix(s, "-") {
+		return "-", strings.TrimPrefix(s[1:], " "), true
+	}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		// 参数值中的 "\]" 是转义，不是元素的结尾
+		j := i + 1
+		for ; j < len(s) && s[j] != ']'; j++ {
+			if s[j] == '\\' {
+				j++
+			}
+		}
+		if j >= len(s) {
+			return "", "", false
+		}
+		i = j + 1
+	}
+	if i == 0 {
+		return "", "", false
+	}
+	return s[:i], strings.TrimPrefix(s[i:], " "), true
+}
+
+// parse3164 解析 "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG"
+func (p *SyslogParser) parse3164(entry LogEntry, rest string) (LogEntry, bool) {
+	const layout = "Jan _2 15:04:05"
+	if len(rest) < len(layout)+1 {
+		return LogEntry{}, false
+	}
+	timestamp, err := time.Parse(layout, rest[:len(layout)])
+	if err != nil {
+		return LogEntry{}, false
+	}
+	now := p.now().UTC()
+	timestamp = timestamp.AddDate(now.Year(), 0, 0)
+	if timestamp.After(now.Add(24 * time.Hour)) {
+		timestamp = timestamp.AddDate(-1, 0, 0) // 年末收到的去年的消息
+	}
+	entry.Timestamp = timestamp
+
+	host, message, _ := strings.Cut(strings.TrimPrefix(rest[len(layout):], " "), " ")
+	entry.Fields["host"] = host
+	// TAG是开头的字母数字，后面可以跟 [PID]，以 ": " 结束
+	if tag, msg, found := strings.Cut(message, ": "); found && !strings.ContainsAny(tag, " ") {
+		if name, pid, hasPID := strings.Cut(tag, "["); hasPID {
+			entry.Fields["app"] = name
+			entry.Fields["procid"] = strings.TrimSuffix(pid, "]")
+		} else {
+			entry.Fields["app"] = tag
+		}
+		message = msg
+	}
+	entry.Message = message
+	return entry, true
+}
+
+// SyslogConfig syslog监听配置，UDPAddr和TCPAddr至少设置一个
+type SyslogConfig struct {
+	Name    string            // 来源名，默认 "syslog"
+	UDPAddr string            // 如 ":514"，为空时不监听UDP
+	TCPAddr string            // 如 ":514"，为空时不监听TCP
+	Labels  map[string]string // 附加的标签，默认只有 source=Name
+}
+
+// SyslogServer 接收syslog消息并提交给管道
+type SyslogServer struct {
+	pipeline *Pipeline
+	name     string
+	udp      net.PacketConn
+	tcp      net.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+	conns    map[net.Conn]bool
+	mutex    sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// ListenSyslog 开始监听syslog，消息使用SyslogParser解析并带上来源标签
+func ListenSyslog(pipeline *Pipeline, config SyslogConfig) (*SyslogServer, error) {
+	if config.UDPAddr == "" && config.TCPAddr == "" {
+		return nil, fmt.Errorf("syslog需要UDP或TCP地址")
+	}
+	if config.Name == "" {
+		config.Name = "syslog"
+	}
+	pipeline.SetSource(config.Name, SourceConfig{Parser: NewSyslogParser(), Labels: sourceLabels(config.Name, config.Labels)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &SyslogServer{pipeline: pipeline, name: config.Name, ctx: ctx, cancel: cancel, conns: make(map[net.Conn]bool)}
+	if config.UDPAddr != "" {
+		udp, err := net.ListenPacket("udp", config.UDPAddr)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		s.udp = udp
+		s.wg.Add(1)
+		go s.serveUDP()
+	}
+	if config.TCPAddr != "" {
+		tcp, err := net.Listen("tcp", config.TCPAddr)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.tcp = tcp
+		s.wg.Add(1)
+		go s.serveTCP()
+	}
+	return s, nil
+}
+
+// sourceLabels 来源名作为source标签，再加上附加的标签
+func sourceLabels(name string, extra map[string]string) map[string]string {
+	labels := map[string]string{"source": name}
+	for key, value := range extra {
+		labels[key] = value
+	}
+	return labels
+}
+
+// UDPAddr 返回UDP监听的地址，没有监听UDP时返回nil
+func (s *SyslogServer) UDPAddr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// TCPAddr 返回TCP监听的地址，没有监听TCP时返回nil
+func (s *SyslogServer) TCPAddr() net.Addr {
+	if s.tcp == nil {
+		return nil
+	}
+	return s.tcp.Addr()
+}
+
+// submit 提交一条消息，管道关闭或服务停止时返回false
+func (s *SyslogServer) submit(message string) bool {
+	err := s.pipeline.SubmitFrom(s.ctx, s.name, message)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, context.Canceled) {
+		fmt.Printf("syslog来源 %s 提交失败: %v\n", s.name, err)
+	}
+	return false
+}
+
+// serveUDP 每个数据报是一条消息
+func (s *SyslogServer) serveUDP() {
+	defer s.wg.Done()
+	buffer := make([]byte, 64*1024)
+	for {
+		n, _, err := s.udp.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		if message := strings.TrimRight(string(buffer[:n]), "\r\n\x00"); message != "" {
+			if !s.submit(message) {
+				return
+			}
+		}
+	}
+}
+
+func (s *SyslogServer) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		if s.ctx.Err() != nil {
+			// Close已经断开了现有连接
+			s.mutex.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.mutex.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn 按RFC 6587分帧：以数字开头的是 "长度 消息" 的八位组计数，否则每行一条消息
+func (s *SyslogServer) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	for {
+		first, err := reader.Peek(1)
+		if err != nil {
+			return
+		}
+		var message string
+		if first[0] >= '0' && first[0] <= '9' {
+			length, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(length))
+			if err != nil || n <= 0 || n > 1024*1024 {
+				return
+			}
+			data := make([]byte, n)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return
+			}
+			message = string(data)
+		} else {
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return
+			}
+			message = line
+		}
+		if message = strings.TrimRight(message, "\r\n\x00"); message != "" {
+			if !s.submit(message) {
+				return
+			}
+		}
+	}
+}
+
+// Close 停止监听并断开所有连接，正在提交的消息被放弃
+func (s *SyslogServer) Close() error {
+	s.cancel()
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	s.mutex.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// DefaultIngestBodyLimit HTTP接入单个请求体的默认上限
+const DefaultIngestBodyLimit = 10 << 20
+
+// IngestConfig HTTP接入配置
+type IngestConfig struct {
+	Name      string            // 来源名，默认 "http"
+	Parser    Parser            // 为nil时使用NewJSONParser()，可以换成自定义字段映射的JSONParser
+	Labels    map[string]string // 附加的标签，默认只有 source=Name
+	BodyLimit int64             // 请求体上限，<=0时为DefaultIngestBodyLimit
+}
+
+// IngestResult HTTP接入的响应
+type IngestResult struct {
+	Accepted int      `json:"accepted"`
+	Rejected int      `json:"rejected"`         // 不是合法JSON的行
+	Errors   []string `json:"errors,omitempty"` // 前几个被拒绝的行的原因
+}
+
+// NewIngestHandler 返回接收NDJSON批量日志的HTTP处理器（挂载到 POST /ingest），
+// 每行一个JSON对象，空行被忽略。不是合法JSON的行在响应中计为rejected，
+// 其余的提交给管道；管道满时请求阻塞，形成对客户端的背压
+func NewIngestHandler(pipeline *Pipeline, config IngestConfig) http.Handler {
+	if config.Name == "" {
+		config.Name = "http"
+	}
+	if config.Parser == nil {
+		config.Parser = NewJSONParser()
+	}
+	if config.BodyLimit <= 0 {
+		config.BodyLimit = DefaultIngestBodyLimit
+	}
+	pipeline.SetSource(config.Name, SourceConfig{Parser: config.Parser, Labels: sourceLabels(config.Name, config.Labels)})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "只支持POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var result IngestResult
+		scanner := bufio.NewScanner(http.MaxBytesReader(w, r.Body, config.BodyLimit))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if !json.Valid([]byte(line)) {
+				result.Rejected++
+				if len(result.Errors) < 10 {
+					result.Errors = append(result.Errors, fmt.Sprintf("第%d行不是合法的JSON", lineNo))
+				}
+				continue
+			}
+			if err := pipeline.SubmitFrom(r.Context(), config.Name, line); err != nil {
+				status := http.StatusServiceUnavailable
+				if !errors.Is(err, ErrPipelineClosed) {
+					status = http.StatusRequestTimeout
+				}
+				writeIngestResult(w, status, result)
+				return
+			}
+			result.Accepted++
+		}
+		if err := scanner.Err(); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeIngestResult(w, http.StatusRequestEntityTooLarge, result)
+				return
+			}
+			writeIngestResult(w, http.StatusBadRequest, result)
+			return
+		}
+		writeIngestResult(w, http.StatusOK, result)
+	})
+}
+
+// writeIngestResult 以JSON返回接入结果，出错时已接收的行仍然有效
+func writeIngestResult(w http.ResponseWriter, status int, result IngestResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogParser(t *testing.T) {
+	parser := NewSyslogParser()
+	parser.now = func() time.Time { return time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC) }
+
+	entry, ok := parser.Parse(`<165>1 2024-01-15T10:30:15.003Z web-1 nginx 8710 ID47 [exampleSDID@32473 iut="3" note="a\]b"] 请求超时`)
+	if !ok {
+		t.Fatal("RFC 5424消息应能解析")
+	}
+	if entry.Level != "INFO" || entry.Message != "请求超时" || !entry.Timestamp.Equal(time.Date(2024, 1, 15, 10, 30, 15, 3e6, time.UTC)) {
+		t.Errorf("RFC 5424解析不正确: %+v", entry)
+	}
+	want := map[string]string{"facility": "local4", "severity": "5", "host": "web-1", "app": "nginx", "procid": "8710", "msgid": "ID47",
+		"structured_data": `[exampleSDID@32473 iut="3" note="a\]b"]`}
+	for key, value := range want {
+		if entry.Fields[key] != value {
+			t.Errorf("字段 %s 期望 %q，实际 %q", key, value, entry.Fields[key])
+		}
+	}
+	if entry, ok := parser.Parse("<11>1 - db-1 - - - - disk failure"); !ok || entry.Level != "ERROR" || entry.Message != "disk failure" || entry.Fields["app"] != "" {
+		t.Errorf("空值字段解析不正确: %+v", entry)
+	}
+
+	// RFC 3164没有年份，12月的消息在1月收到时属于去年
+	entry, ok = parser.Parse("<36>Dec 31 23:59:58 gateway sshd[1024]: Failed password for root")
+	if !ok {
+		t.Fatal("RFC 3164消息应能解析")
+	}
+	if entry.Level != "WARN" || entry.Message != "Failed password for root" || entry.Fields["app"] != "sshd" || entry.Fields["procid"] != "1024" ||
+		entry.Fields["host"] != "gateway" || entry.Fields["facility"] != "auth" || entry.Timestamp.Year() != 2023 {
+		t.Errorf("RFC 3164解析不正确: %+v", entry)
+	}
+	if entry, _ := parser.Parse("<15>Jan  5 08:00:00 host1 plain message"); entry.Message != "plain message" || entry.Level != "DEBUG" || entry.Timestamp.Day() != 5 {
+		t.Errorf("没有TAG的消息解析不正确: %+v", entry)
+	}
+
+	for _, line := range []string{"没有PRI", "<999>1 - - - - - - x", "<13>1 昨天 h a p m - x", "<13>Foo 99 99:99:99 h x", "<13>1 - h a p m [未闭合"} {
+		if _, ok := parser.Parse(line); ok {
+			t.Errorf("不应解析: %s", line)
+		}
+	}
+}
+
+func TestSyslogServer(t *testing.T) {
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}})
+	server, err := ListenSyslog(pipeline, SyslogConfig{UDPAddr: "127.0.0.1:0", TCPAddr: "127.0.0.1:0", Labels: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udp, _ := net.Dial("udp", server.UDPAddr().String())
+	fmt.Fprint(udp, "<14>1 2024-01-15T10:30:15Z web-1 app - - - 来自UDP\n")
+	udp.Close()
+
+	tcp, _ := net.Dial("tcp", server.TCPAddr().String())
+	message := "<11>1 2024-01-15T10:30:16Z web-2 app - - - 八位组\n计数"
+	fmt.Fprintf(tcp, "%d %s", len(message), message)
+	fmt.Fprint(tcp, "<12>Jan 15 10:30:17 web-3 app: 按行分帧\n")
+	tcp.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for pipeline.Stats().Received < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	server.Close()
+	pipeline.Shutdown(context.Background())
+
+	messages := make(map[string]LogEntry)
+	for _, entry := range sink.entries {
+		messages[entry.Message] = entry
+	}
+	if len(messages) != 3 {
+		t.Fatalf("应收到UDP和TCP两种分帧的3条消息: %+v", sink.entries)
+	}
+	for _, msg := range []string{"来自UDP", "八位组\n计数", "按行分帧"} {
+		entry, exists := messages[msg]
+		if !exists {
+			t.Errorf("缺少消息 %q", msg)
+			continue
+		}
+		if entry.Fields["source"] != "syslog" || entry.Fields["env"] != "prod" {
+			t.Errorf("消息 %q 缺少来源标签: %v", msg, entry.Fields)
+		}
+	}
+	if messages["八位组\n计数"].Level != "ERROR" {
+		t.Errorf("严重程度映射不正确: %+v", messages["八位组\n计数"])
+	}
+}
+
+func TestIngestHandler(t *testing.T) {
+	sink := &memorySink{}
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{sink}})
+	handler := NewIngestHandler(pipeline, IngestConfig{Name: "mobile", BodyLimit: 1024})
+
+	body := `{"level":"info","msg":"启动"}
+
+not json
+{"level":"error","msg":"崩溃","device":"ios"}
+`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body)))
+	var result IngestResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	if rec.Code != http.StatusOK || result.Accepted != 2 || result.Rejected != 1 || result.Errors[0] != "第3行不是合法的JSON" {
+		t.Errorf("NDJSON批量接入结果不正确: %d %+v", rec.Code, result)
+	}
+
+	for _, tc := range []struct {
+		method string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "", http.StatusMethodNotAllowed},
+		{http.MethodPost, strings.Repeat(`{"msg":"x"}`+"\n", 200), http.StatusRequestEntityTooLarge},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tc.method, "/ingest", strings.NewReader(tc.body)))
+		if rec.Code != tc.status {
+			t.Errorf("%s 期望状态码%d，实际%d", tc.method, tc.status, rec.Code)
+		}
+	}
+
+	pipeline.Shutdown(context.Background())
+	if len(sink.entries) < 2 || sink.entries[1].Fields["source"] != "mobile" || sink.entries[1].Fields["device"] != "ios" {
+		t.Errorf("接入的日志应带上来源标签: %+v", sink.entries)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(`{"msg":"太晚了"}`)))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("管道关闭后应返回503，实际%d", rec.Code)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// entryOverhead 估算一条日志在内存中除字符串内容之外的开销（结构体、map等）
+const entryOverhead = 96
+
+// entrySize 估算一条日志占用的内存字节数
+func entrySize(entry LogEntry) int {
+	size := entryOverhead + len(entry.Level) + len(entry.Message) + len(entry.Tenant)
+	for key, value := range entry.Fields {
+		size += len(key) + len(value) + 16
+	}
+	return size
+}
+
+// RingBuffer 按条数和估算字节数限制的环形缓冲区，满时淘汰最旧的日志。
+// 存储按需增长到MaxEntries，不预先分配。不是并发安全的，由调用方加锁
+type RingBuffer struct {
+	items      []LogEntry
+	sizes      []int
+	head       int
+	count      int
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+}
+
+// NewRingBuffer 创建环形缓冲区，maxEntries或maxBytes<=0表示该维度不限制
+func NewRingBuffer(maxEntries int, maxBytes int64) *RingBuffer {
+	return &RingBuffer{maxEntries: maxEntries, maxBytes: maxBytes}
+}
+
+// Len 返回缓冲的日志条数
+func (rb *RingBuffer) Len() int {
+	return rb.count
+}
+
+// Bytes 返回缓冲日志的估算字节数
+func (rb *RingBuffer) Bytes() int64 {
+	return rb.bytes
+}
+
+// Push 加入一条日志，返回因此被淘汰的日志（按从旧到新）。最新的一条即使超过MaxBytes也会保留
+func (rb *RingBuffer) Push(entry LogEntry) []LogEntry {
+	size := entrySize(entry)
+	var evicted []LogEntry
+	for rb.count > 0 && ((rb.maxEntries > 0 && rb.count >= rb.maxEntries) || (rb.maxBytes > 0 && rb.bytes+int64(size) > rb.maxBytes)) {
+		evicted = append(evicted, rb.popOldest())
+	}
+	if rb.count == len(rb.items) {
+		rb.resize(max(16, 2*len(rb.items)))
+	}
+	i := (rb.head + rb.count) % len(rb.items)
+	rb.items[i] = entry
+	rb.sizes[i] = size
+	rb.count++
+	rb.bytes += int64(size)
+	return evicted
+}
+
+// SetLimits 修改限制，返回因此被淘汰的日志
+func (rb *RingBuffer) SetLimits(maxEntries int, maxBytes int64) []LogEntry {
+	rb.maxEntries = maxEntries
+	rb.maxBytes = maxBytes
+	var evicted []LogEntry
+	for rb.count > 0 && ((maxEntries > 0 && rb.count > maxEntries) || (maxBytes > 0 && rb.bytes > maxBytes && rb.count > 1)) {
+		evicted = append(evicted, rb.popOldest())
+	}
+	if len(rb.items) > 16 && rb.count < len(rb.items)/4 {
+		rb.resize(max(16, 2*rb.count)) // 缩小限制后释放多余的存储
+	}
+	return evicted
+}
+
+// popOldest 取出最旧的一条
+func (rb *RingBuffer) popOldest() LogEntry {
+	entry := rb.items[rb.head]
+	rb.bytes -= int64(rb.sizes[rb.head])
+	rb.items[rb.head] = LogEntry{}
+	rb.head = (rb.head + 1) % len(rb.items)
+	rb.count--
+	return entry
+}
+
+// resize 重新分配存储，容量不超过maxEntries
+func (rb *RingBuffer) resize(capacity int) {
+	if rb.maxEntries > 0 {
+		capacity = min(capacity, rb.maxEntries)
+	}
+	capacity = max(capacity, rb.count, 1)
+	items := make([]LogEntry, capacity)
+	sizes := make([]int, capacity)
+	for i := 0; i < rb.count; i++ {
+		j := (rb.head + i) % len(rb.items)
+		items[i] = rb.items[j]
+		sizes[i] = rb.sizes[j]
+	}
+	rb.items, rb.sizes, rb.head = items, sizes, 0
+}
+
+// Each 从旧到新遍历，fn返回false时停止
+func (rb *RingBuffer) Each(fn func(entry LogEntry) bool) {
+	for i := 0; i < rb.count; i++ {
+		if !fn(rb.items[(rb.head+i)%len(rb.items)]) {
+			return
+		}
+	}
+}
+
+// Slice 返回从旧到新的日志副本
+func (rb *RingBuffer) Slice() []LogEntry {
+	entries := make([]LogEntry, 0, rb.count)
+	rb.Each(func(entry LogEntry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	return entries
+}
+
+// DefaultSegmentBytes 溢写段文件的默认大小
+const DefaultSegmentBytes = 64 << 20
+
+// SpillConfig 溢写配置
+type SpillConfig struct {
+	SegmentBytes int64 // 段文件写满多少字节后换新段，<=0时为DefaultSegmentBytes
+	MaxDiskBytes int64 // 所有段的总大小上限，超出时删除最旧的段，<=0表示不限制
+}
+
+// SpillStats 溢写存储的统计
+type SpillStats struct {
+	Segments int   `json:"segments"`
+	Entries  int   `json:"entries"`
+	Bytes    int64 `json:"bytes"`
+	Deleted  int   `json:"deleted"` // 因MaxDiskBytes随最旧的段被删除的日志条数
+}
+
+// spillSegment 一个段文件：按写入顺序保存NDJSON，记录其中日志的时间范围
+type spillSegment struct {
+	seq   int
+	path  string
+	size  int64
+	count int
+	first time.Time // 段内最早的日志时间
+	last  time.Time // 段内最晚的日志时间
+}
+
+func (seg *spillSegment) observe(entry LogEntry, size int) {
+	if seg.count == 0 || entry.Timestamp.Before(seg.first) {
+		seg.first = entry.Timestamp
+	}
+	if seg.count == 0 || entry.Timestamp.After(seg.last) {
+		seg.last = entry.Timestamp
+	}
+	seg.count++
+	seg.size += int64(size)
+}
+
+// SpillStore 把从内存淘汰的日志写入磁盘上的段文件（dir/segment-000001.ndjson……），
+// 段按编号顺序保存，最后一段是正在写入的活动段
+type SpillStore struct {
+	dir      string
+	config   SpillConfig
+	segments []*spillSegment
+	active   *os.File
+	nextSeq  int
+	deleted  int
+	mutex    sync.Mutex
+}
+
+// OpenSpillStore 打开溢写目录，读取已有的段并合并其中过小的段，之后的写入进入新段
+func OpenSpillStore(dir string, config SpillConfig) (*SpillStore, error) {
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = DefaultSegmentBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &SpillStore{dir: dir, config: config, nextSeq: 1}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "segment-*.ndjson"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		var seq int
+		if _, err := fmt.Sscanf(filepath.Base(path), "segment-%d.ndjson", &seq); err != nil {
+			continue
+		}
+		seg := &spillSegment{seq: seq, path: path}
+		if err := readSegment(path, func(entry LogEntry, size int) bool {
+			seg.observe(entry, size)
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+		s.nextSeq = max(s.nextSeq, seq+1)
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	if err := s.compactLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readSegment 按顺序读取段文件，fn返回false时停止
+func readSegment(path string, fn func(entry LogEntry, size int) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("段文件 %s 格式错误: %v", path, err)
+		}
+		if !fn(entry, len(scanner.Bytes())+1) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *SpillStore) segmentPath(seq int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("segment-%06d.ndjson", seq))
+}
+
+// Append 按顺序追加日志，活动段写满时换新段并合并、清理旧段
+func (s *SpillStore) Append(entries []LogEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		if s.active == nil {
+			seq := s.nextSeq
+			s.nextSeq++
+			file, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			s.active = file
+			s.segments = append(s.segments, &spillSegment{seq: seq, path: file.Name()})
+		}
+		if _, err := s.active.Write(data); err != nil {
+			return err
+		}
+		seg := s.segments[len(s.segments)-1]
+		seg.observe(entry, len(data))
+
+		if seg.size >= s.config.SegmentBytes {
+			if err := s.active.Close(); err != nil {
+				return err
+			}
+			s.active = nil
+			if err := s.compactLocked(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Compact 合并相邻的过小的段（合并后不超过SegmentBytes），并按MaxDiskBytes删除最旧的段
+func (s *SpillStore) Compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.compactLocked()
+}
+
+// compactLocked 调用方需持有mutex，活动段不参与合并和删除
+func (s *SpillStore) compactLocked() error {
+	closed := len(s.segments)
+	if s.active != nil {
+		closed--
+	}
+
+	var merged []*spillSegment
+	for i := 0; i < closed; i++ {
+		seg := s.segments[i]
+		if n := len(merged); n > 0 && merged[n-1].size+seg.size <= s.config.SegmentBytes {
+			if err := s.mergeInto(merged[n-1], seg); err != nil {
+				return err
+			}
+			continue
+		}
+		merged = append(merged, seg)
+	}
+	s.segments = append(merged, s.segments[closed:]...)
+
+	if s.config.MaxDiskBytes > 0 {
+		var total int64
+		for _, seg := range s.segments {
+			total += seg.size
+		}
+		for len(s.segments) > 1 && total > s.config.MaxDiskBytes && s.segments[0] != s.activeSegment() {
+			oldest := s.segments[0]
+			if err := os.Remove(oldest.path); err != nil {
+				return err
+			}
+			total -= oldest.size
+			s.deleted += oldest.count
+			s.segments = s.segments[1:]
+		}
+	}
+	return nil
+}
+
+// activeSegment 返回正在写入的段，没有时返回nil
+func (s *SpillStore) activeSegment() *spillSegment {
+	if s.active == nil || len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+// mergeInto 把src追加到dst之后：写入临时文件后替换dst，再删除src
+func (s *SpillStore) mergeInto(dst, src *spillSegment) error {
+	tmp := dst.path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{dst.path, src.path} {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			_, err = out.Write(data)
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst.path); err != nil {
+		return err
+	}
+	if err := os.Remove(src.path); err != nil {
+		return err
+	}
+
+	if src.count > 0 && (dst.count == 0 || src.first.Before(dst.first)) {
+		dst.first = src.first
+	}
+	if src.count > 0 && (dst.count == 0 || src.last.After(dst.last)) {
+		dst.last = src.last
+	}
+	dst.count += src.count
+	dst.size += src.size
+	return nil
+}
+
+// Scan 按写入顺序遍历时间在[from, to)内的溢写日志，零值时间表示不限制；
+// 时间范围与条件不相交的段直接跳过。fn返回false时停止
+func (s *SpillStore) Scan(from, to time.Time, fn func(entry LogEntry) bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stopped := false
+	for _, seg := range s.segments {
+		if seg.count == 0 || (!from.IsZero() && seg.last.Before(from)) || (!to.IsZero() && !seg.first.Before(to)) {
+			continue
+		}
+		err := readSegment(seg.path, func(entry LogEntry, _ int) bool {
+			if (!from.IsZero() && entry.Timestamp.Before(from)) || (!to.IsZero() && !entry.Timestamp.Before(to)) {
+				return true
+			}
+			if !fn(entry) {
+				stopped = true
+			}
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats 返回段数、日志条数和磁盘占用
+func (s *SpillStore) Stats() SpillStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := SpillStats{Segments: len(s.segments), Deleted: s.deleted}
+	for _, seg := range s.segments {
+		stats.Entries += seg.count
+		stats.Bytes += seg.size
+	}
+	return stats
+}
+
+// Close 关闭活动段，下次打开时写入新段
+func (s *SpillStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRingBufferLimits(t *testing.T) {
+	rb := NewRingBuffer(3, 0)
+	var evicted []LogEntry
+	for i := 0; i < 5; i++ {
+		evicted = append(evicted, rb.Push(testEntry(i))...)
+	}
+	if got := messagesOf(rb.Slice()); got != "日志2,日志3,日志4" {
+		t.Errorf("应保留最近的3条: %s", got)
+	}
+	if got := messagesOf(evicted); got != "日志0,日志1" {
+		t.Errorf("应按从旧到新返回淘汰的日志: %s", got)
+	}
+
+	// 按字节数限制，最新的一条即使超限也保留
+	size := int64(entrySize(testEntry(0)))
+	if evicted := rb.SetLimits(0, 2*size); len(evicted) != 1 || rb.Len() != 2 || rb.Bytes() > 2*size {
+		t.Errorf("缩小字节上限后应淘汰1条: 淘汰%d条，剩余%d条%d字节", len(evicted), rb.Len(), rb.Bytes())
+	}
+	big := testEntry(9)
+	big.Message = string(make([]byte, 4*size))
+	if evicted := rb.Push(big); len(evicted) != 2 || rb.Len() != 1 {
+		t.Errorf("超大的日志应淘汰其余日志并保留自身: 淘汰%d条，剩余%d条", len(evicted), rb.Len())
+	}
+}
+
+func TestSpillStoreSegmentsAndCompaction(t *testing.T) {
+	dir := t.TempDir()
+	data, err := json.Marshal(testEntry(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lineSize := int64(len(data) + 1)
+	store, err := OpenSpillStore(dir, SpillConfig{SegmentBytes: 4 * lineSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i += 2 {
+		if err := store.Append([]LogEntry{testEntry(i), testEntry(i + 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := store.Stats(); stats.Entries != 10 || stats.Segments != 3 {
+		t.Errorf("10条日志应分成4+4+2三段: %+v", stats)
+	}
+
+	// 按时间范围读取，与范围不相交的段被跳过
+	var got []LogEntry
+	from, to := testEntry(3).Timestamp, testEntry(7).Timestamp
+	if err := store.Scan(from, to, func(entry LogEntry) bool {
+		got = append(got, entry)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := messagesOf(got); msgs != "日志3,日志4,日志5,日志6" {
+		t.Errorf("时间范围读取不正确: %s", msgs)
+	}
+	store.Close()
+
+	// 重新打开时合并过小的段，再按磁盘上限删除最旧的段
+	store, err = OpenSpillStore(dir, SpillConfig{SegmentBytes: 8 * lineSize, MaxDiskBytes: 6 * lineSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	stats := store.Stats()
+	if stats.Segments != 1 || stats.Entries != 2 || stats.Deleted != 8 {
+		t.Errorf("合并后超出磁盘上限的旧段应被删除: %+v", stats)
+	}
+	if paths, _ := filepath.Glob(filepath.Join(dir, "*")); len(paths) != 1 {
+		t.Errorf("合并和删除后不应留下多余文件: %v", paths)
+	}
+	got = nil
+	store.Scan(time.Time{}, time.Time{}, func(entry LogEntry) bool {
+		got = append(got, entry)
+		return true
+	})
+	if msgs := messagesOf(got); msgs != "日志8,日志9" {
+		t.Errorf("应只剩最新的段: %s", msgs)
+	}
+}
+
+func TestLogProcessorSpillsEvictedEntries(t *testing.T) {
+	processor := NewLogProcessor()
+	processor.SetMaxEntries(10)
+	if err := processor.EnableSpill(t.TempDir(), SpillConfig{SegmentBytes: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	defer processor.Close()
+
+	for i := 0; i < 50; i++ {
+		processor.Write(testEntry(i))
+	}
+	if entries := processor.Entries(); len(entries) != 10 || entries[0].Message != "日志40" || processor.Evicted() != 40 {
+		t.Errorf("内存中应只保留最近的10条: %d条，淘汰%d条", len(entries), processor.Evicted())
+	}
+	if result := processor.Query(QueryFilter{Limit: 100}); result.Total != 10 {
+		t.Errorf("查询只覆盖内存中的日志: %d", result.Total)
+	}
+
+	var all []LogEntry
+	if err := processor.ScanAll(func(entry LogEntry) bool {
+		all = append(all, entry)
+		return true
+	}); err != nil || processor.SpillErr() != nil {
+		t.Fatal(err, processor.SpillErr())
+	}
+	if len(all) != 50 {
+		t.Fatalf("溢写和内存中的日志合起来应有50条: %d", len(all))
+	}
+	for i, entry := range all {
+		if entry.Message != testEntry(i).Message {
+			t.Fatalf("第%d条顺序不正确: %s", i, entry.Message)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultTailQueue 每个实时跟踪客户端默认的发送队列长度
+const DefaultTailQueue = 256
+
+// TailFilter 实时跟踪的过滤条件，为空的条件不限制
+type TailFilter struct {
+	Levels []string       // 任一级别匹配即可，不区分大小写
+	Source string         // 匹配Fields["source"]
+	Match  *regexp.Regexp // 匹配消息
+}
+
+// ParseTailFilter 从URL参数解析过滤条件：level（可重复或逗号分隔），source，match（正则表达式）
+func ParseTailFilter(values url.Values) (TailFilter, error) {
+	var filter TailFilter
+	for _, level := range values["level"] {
+		for _, l := range strings.Split(level, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				filter.Levels = append(filter.Levels, l)
+			}
+		}
+	}
+	filter.Source = values.Get("source")
+	if pattern := values.Get("match"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return filter, fmt.Errorf("match 不是有效的正则表达式: %v", err)
+		}
+		filter.Match = re
+	}
+	return filter, nil
+}
+
+// Matches 日志是否满足过滤条件
+func (f TailFilter) Matches(entry LogEntry) bool {
+	if len(f.Levels) > 0 {
+		matched := false
+		for _, level := range f.Levels {
+			if strings.EqualFold(level, entry.Level) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if f.Source != "" && entry.Fields["source"] != f.Source {
+		return false
+	}
+	return f.Match == nil || f.Match.MatchString(entry.Message)
+}
+
+// TailMessage 发送给实时跟踪客户端的JSON消息
+type TailMessage struct {
+	Type    string    `json:"type"`              // entry：一条日志；dropped：客户端太慢丢弃了日志
+	Entry   *LogEntry `json:"entry,omitempty"`   // Type为entry时的日志
+	Dropped int64     `json:"dropped,omitempty"` // Type为dropped时上次发送后丢弃的条数
+}
+
+// tailClient 一个实时跟踪连接，发送由自己的goroutine完成
+type tailClient struct {
+	conn    *wsConn
+	filter  TailFilter
+	send    chan []byte
+	dropped atomic.Int64
+	done    chan struct{}
+}
+
+// TailHub 管理实时跟踪（live tail）的WebSocket连接，作为Sink加入管道后，
+// 把每条日志推送给过滤条件匹配的客户端。
+// 每个客户端有自己的发送队列，队列满时丢弃日志并在之后告知客户端丢弃的条数，慢客户端不会阻塞管道
+type TailHub struct {
+	mutex     sync.RWMutex
+	clients   map[*tailClient]bool
+	queueSize int
+	closed    bool
+}
+
+// NewTailHub 创建实时跟踪的连接管理器，queueSize为每个客户端的发送队列长度，<=0时使用DefaultTailQueue
+func NewTailHub(queueSize int) *TailHub {
+	if queueSize <= 0 {
+		queueSize = DefaultTailQueue
+	}
+	return &TailHub{clients: make(map[*tailClient]bool), queueSize: queueSize}
+}
+
+// Write 把日志放入匹配的客户端的发送队列，不会阻塞
+func (h *TailHub) Write(entry LogEntry) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var message []byte
+	for client := range h.clients {
+		if !client.filter.Matches(entry) {
+			continue
+		}
+		if message == nil {
+			var err error
+			if message, err = json.Marshal(TailMessage{Type: "entry", Entry: &entry}); err != nil {
+				return err
+			}
+		}
+		select {
+		case client.send <- message:
+		default:
+			client.dropped.Add(1)
+		}
+	}
+	return nil
+}
+
+// Clients 返回当前连接的客户端数
+func (h *TailHub) Clients() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.clients)
+}
+
+// ServeHTTP 处理 /tail 请求：WebSocket请求按URL参数（见ParseTailFilter）订阅日志，
+// 浏览器直接打开时返回一个简单的实时日志页面
+func (h *TailHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketRequest(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(tailPage)
+		return
+	}
+	filter, err := ParseTailFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		log.Printf("实时跟踪连接失败: %v", err)
+		return
+	}
+
+	client := &tailClient{conn: conn, filter: filter, send: make(chan []byte, h.queueSize), done: make(chan struct{})}
+	if !h.register(client) {
+		conn.Close()
+		return
+	}
+	go h.writeLoop(client)
+
+	// 读取客户端消息只为处理ping和关闭，客户端断开后注销
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	h.unregister(client)
+}
+
+func (h *TailHub) register(client *tailClient) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return false
+	}
+	h.clients[client] = true
+	return true
+}
+
+// unregister 移除客户端并关闭连接，可以重复调用
+func (h *TailHub) unregister(client *tailClient) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.clients[client] {
+		delete(h.clients, client)
+		close(client.done)
+	}
+	client.conn.Close()
+}
+
+// writeLoop 把队列中的消息写给客户端，先告知之前丢弃的条数；写失败时注销客户端
+func (h *TailHub) writeLoop(client *tailClient) {
+	for {
+		select {
+		case message := <-client.send:
+			if dropped := client.dropped.Swap(0); dropped > 0 {
+				notice, _ := json.Marshal(TailMessage{Type: "dropped", Dropped: dropped})
+				if err := client.conn.WriteText(notice); err != nil {
+					h.unregister(client)
+					return
+				}
+			}
+			if err := client.conn.WriteText(message); err != nil {
+				h.unregister(client)
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
+}
+
+// Close 断开所有客户端，之后的连接会被拒绝
+func (h *TailHub) Close() error {
+	h.mutex.Lock()
+	h.closed = true
+	clients := make([]*tailClient, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	h.mutex.Unlock()
+	for _, client := range clients {
+		h.unregister(client)
+	}
+	return nil
+}
+
+// tailPage 浏览器直接打开 /tail 时的实时日志页面，过滤条件与WebSocket的URL参数相同
+//
+//go:embed tail.html
+var tailPage []byte
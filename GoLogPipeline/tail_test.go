@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient 测试用的最小WebSocket客户端
+type wsTestClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialTail 连接到测试服务器的 /tail，校验握手响应
+func dialTail(t *testing.T, server *httptest.Server, query string) *wsTestClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	key := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	request := "GET /tail?" + query + " HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("握手失败: %s %v", response.Status, response.Header)
+	}
+	return &wsTestClient{conn: conn, reader: reader}
+}
+
+// write 发送一个加掩码的帧
+func (c *wsTestClient) write(opcode byte, payload []byte) error {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// read 读取服务端的一帧
+func (c *wsTestClient) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	length := uint64(header[1] & 0x7F)
+	if length == 126 {
+		var extended [2]byte
+		io.ReadFull(c.reader, extended[:])
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0F, payload
+}
+
+func (c *wsTestClient) readMessage(t *testing.T) TailMessage {
+	t.Helper()
+	opcode, payload := c.read(t)
+	var message TailMessage
+	if err := json.Unmarshal(payload, &message); opcode != wsText || err != nil {
+		t.Fatalf("应收到JSON文本消息: %d %q %v", opcode, payload, err)
+	}
+	return message
+}
+
+func waitForClients(t *testing.T, hub *TailHub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for hub.Clients() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("客户端数应为%d: %d", n, hub.Clients())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTailFilter(t *testing.T) {
+	filter, err := ParseTailFilter(url.Values{"level": {"error,warn"}, "source": {"api"}, "match": {`timeout|refused`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := map[string]string{"source": "api"}
+	cases := []struct {
+		entry LogEntry
+		want  bool
+	}{
+		{LogEntry{Level: "ERROR", Message: "connection refused", Fields: api}, true},
+		{LogEntry{Level: "WARN", Message: "read timeout", Fields: api}, true},
+		{LogEntry{Level: "INFO", Message: "read timeout", Fields: api}, false},
+		{LogEntry{Level: "ERROR", Message: "disk full", Fields: api}, false},
+		{LogEntry{Level: "ERROR", Message: "read timeout", Fields: map[string]string{"source": "db"}}, false},
+	}
+	for _, c := range cases {
+		if got := filter.Matches(c.entry); got != c.want {
+			t.Errorf("%+v: 应为%v", c.entry, c.want)
+		}
+	}
+	if !(TailFilter{}).Matches(LogEntry{Level: "DEBUG"}) {
+		t.Error("空的过滤条件应匹配所有日志")
+	}
+	if _, err := ParseTailFilter(url.Values{"match": {"("}}); err == nil {
+		t.Error("无效的正则表达式应报错")
+	}
+}
+
+func TestTailHubStreamsMatchingEntries(t *testing.T) {
+	hub := NewTailHub(0)
+	mux := http.NewServeMux()
+	mux.Handle("/tail", hub)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// 浏览器直接打开时返回页面
+	response, err := http.Get(server.URL + "/tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("普通请求应返回实时日志页面: %v", response.Header)
+	}
+
+	errors := dialTail(t, server, "level=ERROR")
+	api := dialTail(t, server, "source=api&match=^GET")
+	waitForClients(t, hub, 2)
+
+	pipeline := NewPipeline(PipelineConfig{Sinks: []Sink{hub}})
+	pipeline.SetSource("api", SourceConfig{Labels: map[string]string{"source": "api"}})
+	for _, line := range []string{
+		"2024-01-15 10:00:00 [INFO] GET /users 200",
+		"2024-01-15 10:00:01 [ERROR] POST /orders 500",
+		"2024-01-15 10:00:02 [ERROR] GET /orders 500",
+	} {
+		pipeline.SubmitFrom(context.Background(), "api", line)
+	}
+
+	if got := errors.readMessage(t); got.Type != "entry" || got.Entry.Message != "POST /orders 500" {
+		t.Errorf("ERROR订阅的第一条不正确: %+v", got)
+	}
+	if got := errors.readMessage(t); got.Entry.Message != "GET /orders 500" {
+		t.Errorf("ERROR订阅的第二条不正确: %+v", got.Entry)
+	}
+	if got := api.readMessage(t); got.Entry.Message != "GET /users 200" || got.Entry.Fields["source"] != "api" {
+		t.Errorf("api订阅的第一条不正确: %+v", got.Entry)
+	}
+
+	if got := api.readMessage(t); got.Entry.Message != "GET /orders 500" {
+		t.Errorf("api订阅的第二条不正确: %+v", got.Entry)
+	}
+
+	// ping得到pong，关闭帧得到关闭回复并注销
+	api.write(wsPing, []byte("hi"))
+	if opcode, payload := api.read(t); opcode != wsPong || string(payload) != "hi" {
+		t.Errorf("应回复pong: %d %q", opcode, payload)
+	}
+	api.write(wsClose, []byte{0x03, 0xE8})
+	if opcode, _ := api.read(t); opcode != wsClose {
+		t.Errorf("应回复关闭帧: %d", opcode)
+	}
+	waitForClients(t, hub, 1)
+
+	// 关闭后断开其余客户端
+	pipeline.Shutdown(context.Background())
+	hub.Close()
+	if opcode, _ := errors.read(t); opcode != wsClose {
+		t.Errorf("关闭时应发送关闭帧: %d", opcode)
+	}
+	waitForClients(t, hub, 0)
+}
+
+func TestTailHubSlowClientDrops(t *testing.T) {
+	hub := NewTailHub(2)
+	server, client := net.Pipe()
+	defer client.Close()
+	slow := &tailClient{
+		conn:   &wsConn{conn: server, reader: bufio.NewReader(server)},
+		send:   make(chan []byte, hub.queueSize),
+		done:   make(chan struct{}),
+		filter: TailFilter{Levels: []string{"INFO"}},
+	}
+	hub.register(slow)
+
+	// 发送goroutine还没开始，队列满后的日志被丢弃，Write不会阻塞
+	for i := 0; i < 5; i++ {
+		if err := hub.Write(testEntry(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	go hub.writeLoop(slow)
+
+	reader := &wsTestClient{conn: client, reader: bufio.NewReader(client)}
+	if got := reader.readMessage(t); got.Type != "dropped" || got.Dropped != 3 {
+		t.Errorf("应先告知丢弃的条数: %+v", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := reader.readMessage(t); got.Type != "entry" || got.Entry.Message != testEntry(i).Message {
+			t.Errorf("应按顺序收到队列中的日志: %+v", got)
+		}
+	}
+	client.Close()
+	hub.Close()
+	if hub.register(&tailClient{}) {
+		t.Error("关闭后应拒绝新的连接")
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownTenant = errors.New("未知租户")
+	ErrQuotaExceeded = errors.New("租户配额已用尽")
+)
+
+// TenantConfig 租户配置
+type TenantConfig struct {
+	ID             string
+	QuotaPerMinute int           // 每分钟最多接收的日志条数，0表示不限制
+	BufferSize     int           // 隔离缓冲区容量，超出时丢弃最旧的日志，0表示不限制
+	Retention      time.Duration // 日志保留时长，0表示永久保留
+	Sink           Sink          // 租户专属输出，可为nil
+	Parser         Parser        // 租户日志的解析器，为nil时使用管道的默认解析器
+}
+
+// TenantUsage 租户用量统计
+type TenantUsage struct {
+	Received   int   `json:"received"`
+	Accepted   int   `json:"accepted"`
+	Rejected   int   `json:"rejected"`    // 超出配额被拒绝
+	Invalid    int   `json:"invalid"`     // 无法解析
+	Merged     int   `json:"merged"`      // 作为续行合并到上一条多行日志
+	Dropped    int   `json:"dropped"`     // 被处理步骤丢弃
+	Evicted    int   `json:"evicted"`     // 因缓冲区满或过期被淘汰
+	SinkErrors int   `json:"sink_errors"` // 写入租户输出失败
+	Bytes      int64 `json:"bytes"`
+	Buffered   int   `json:"buffered"`
+}
+
+// tenantRecord 缓冲区中的日志及其接收时间
+type tenantRecord struct {
+	entry      LogEntry
+	receivedAt time.Time
+}
+
+// tenantStream 单个租户的隔离流，字段由mutex保护。
+// 需要同时持有两把锁时先取MultiTenantPipeline.mutex再取租户的mutex
+type tenantStream struct {
+	mutex       sync.Mutex
+	config      TenantConfig
+	records     []tenantRecord
+	usage       TenantUsage
+	windowStart time.Time
+	windowCount int
+	assembler   lineAssembler
+}
+
+// MultiTenantPipeline 多租户日志管道，每个租户拥有独立的配额、缓冲区、输出和保留策略。
+// mutex只保护租户表和管道级设置，接收日志时只短暂持有以查找租户，解析、归档等处理在租户自己的锁内进行，
+// 一个租户的慢解析器或归档写入不会阻塞其他租户
+type MultiTenantPipeline struct {
+	tenants    map[string]*tenantStream
+	mutex      sync.Mutex
+	now        func() time.Time
+	parser     Parser
+	processors []Processor
+	archive    *Archive
+}
+
+// NewMultiTenantPipeline 创建多租户日志管道
+func NewMultiTenantPipeline() *MultiTenantPipeline {
+	return &MultiTenantPipeline{
+		tenants: make(map[string]*tenantStream),
+		now:     time.Now,
+		parser:  lineParser{},
+	}
+}
+
+// SetParser 替换解析函数，之后接收和回放的日志都使用新的解析逻辑
+func (mp *MultiTenantPipeline) SetParser(parse func(line string) (LogEntry, bool)) {
+	mp.SetDefaultParser(ParserFunc(parse))
+}
+
+// SetDefaultParser 替换没有配置TenantConfig.Parser的租户使用的解析器
+func (mp *MultiTenantPipeline) SetDefaultParser(parser Parser) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.parser = parser
+}
+
+// tenantParser 返回租户使用的解析器，没有配置时使用管道的默认解析器
+func tenantParser(config TenantConfig, defaultParser Parser) Parser {
+	if config.Parser != nil {
+		return config.Parser
+	}
+	return defaultParser
+}
+
+// pipelineSettings 接收日志时使用的管道级设置的快照
+type pipelineSettings struct {
+	parser     Parser // 默认解析器
+	processors []Processor
+	archive    *Archive
+}
+
+// lookup 在mutex内查找租户并取得管道级设置的快照，之后的处理只需要租户自己的锁
+func (mp *MultiTenantPipeline) lookup(tenantID string) (*tenantStream, pipelineSettings, error) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	stream, exists := mp.tenants[tenantID]
+	if !exists {
+		return nil, pipelineSettings{}, fmt.Errorf("%w: %s", ErrUnknownTenant, tenantID)
+	}
+	return stream, pipelineSettings{parser: mp.parser, processors: mp.processors, archive: mp.archive}, nil
+}
+
+// Use 追加解析之后的处理步骤
+func (mp *MultiTenantPipeline) Use(processors ...Processor) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.processors = append(mp.processors, processors...)
+}
+
+// SetArchive 设置归档，之后通过配额检查的原始日志行（包括无法解析的）都会归档，供回放使用
+func (mp *MultiTenantPipeline) SetArchive(archive *Archive) {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+	mp.archive = archive
+}
+
+// RegisterTenant 注册或更新租户配置，更新时保留已缓冲的日志和用量
+func (mp *MultiTenantPipeline) RegisterTenant(config TenantConfig) error {
+	if config.ID == "" {
+		return fmt.Errorf("租户ID不能为空")
+	}
+
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	if stream, exists := mp.tenants[config.ID]; exists {
+		stream.mutex.Lock()
+		stream.config = config
+		stream.mutex.Unlock()
+		return nil
+	}
+	mp.tenants[config.ID] = &tenantStream{config: config}
+	return nil
+}
+
+// Ingest 接收租户的一行日志。租户使用多行解析器时，日志在下一条日志开始或Flush时才进入缓冲区。
+// 归档在租户的锁内写入，同一租户的归档顺序与接收顺序一致
+func (mp *MultiTenantPipeline) Ingest(tenantID, line string) error {
+	stream, settings, err := mp.lookup(tenantID)
+	if err != nil {
+		return err
+	}
+
+	stream.mutex.Lock()
+	now := mp.now()
+	stream.usage.Received++
+
+	// 配额按一分钟的固定窗口计算
+	if now.Sub(stream.windowStart) >= time.Minute {
+		stream.windowStart = now
+		stream.windowCount = 0
+	}
+	if stream.config.QuotaPerMinute > 0 && stream.windowCount >= stream.config.QuotaPerMinute {
+		stream.usage.Rejected++
+		stream.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, tenantID)
+	}
+	stream.windowCount++
+
+	if settings.archive != nil {
+		if err := settings.archive.Append(ArchiveRecord{ReceivedAt: now, Tenant: tenantID, Line: line}); err != nil {
+			fmt.Printf("归档日志失败: %v\n", err)
+		}
+	}
+
+	done, merged, valid := stream.assembler.feed(tenantParser(stream.config, settings.parser), line)
+	switch {
+	case !valid:
+		stream.usage.Invalid++
+	case merged:
+		stream.usage.Merged++
+	}
+	if done == nil {
+		stream.mutex.Unlock()
+		return nil
+	}
+	entry, sink := accept(stream, settings.processors, tenantID, done, now)
+	stream.mutex.Unlock()
+	return writeSink(stream, tenantID, entry, sink)
+}
+
+// Flush 输出租户还在等待续行的多行日志，来源结束（如文件读完）时调用；没有等待的日志时不做处理
+func (mp *MultiTenantPipeline) Flush(tenantID string) error {
+	stream, settings, err := mp.lookup(tenantID)
+	if err != nil {
+		return err
+	}
+
+	stream.mutex.Lock()
+	done := stream.assembler.flush()
+	if done == nil {
+		stream.mutex.Unlock()
+		return nil
+	}
+	entry, sink := accept(stream, settings.processors, tenantID, done, mp.now())
+	stream.mutex.Unlock()
+	return writeSink(stream, tenantID, entry, sink)
+}
+
+// accept 对组装完成的日志执行处理步骤并放入租户缓冲区，返回处理后的日志和需要写入的输出，
+// 日志被丢弃或租户没有输出时sink为nil。调用方需持有租户的mutex
+func accept(stream *tenantStream, processors []Processor, tenantID string, done *assembled, now time.Time) (LogEntry, Sink) {
+	entry := done.entry
+	entry.Tenant = tenantID
+	entry, ok := runProcessors(processors, entry)
+	if !ok {
+		stream.usage.Dropped++
+		return entry, nil
+	}
+
+	stream.records = append(stream.records, tenantRecord{entry: entry, receivedAt: now})
+	if size := stream.config.BufferSize; size > 0 && len(stream.records) > size {
+		evicted := len(stream.records) - size
+		stream.records = stream.records[evicted:]
+		stream.usage.Evicted += evicted
+	}
+	stream.usage.Accepted++
+	stream.usage.Bytes += int64(done.size)
+	return entry, stream.config.Sink
+}
+
+// writeSink 在锁外写入输出，避免慢输出阻塞同一租户的接收
+func writeSink(stream *tenantStream, tenantID string, entry LogEntry, sink Sink) error {
+	if sink == nil {
+		return nil
+	}
+	if err := sink.Write(entry); err != nil {
+		stream.mutex.Lock()
+		stream.usage.SinkErrors++
+		stream.mutex.Unlock()
+		return fmt.Errorf("租户 %s 写入输出失败: %v", tenantID, err)
+	}
+	return nil
+}
+
+// ReadFromFile 从文件读取日志并标记为指定租户，读完后输出最后一条多行日志
+func (mp *MultiTenantPipeline) ReadFromFile(tenantID, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if err := mp.Ingest(tenantID, scanner.Text()); errors.Is(err, ErrUnknownTenant) {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := mp.Flush(tenantID); errors.Is(err, ErrUnknownTenant) {
+		return err
+	}
+	return nil
+}
+
+// Entries 返回租户缓冲区中的日志副本
+func (mp *MultiTenantPipeline) Entries(tenantID string) ([]LogEntry, error) {
+	stream, _, err := mp.lookup(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	entries := make([]LogEntry, len(stream.records))
+	for i, record := range stream.records {
+		entries[i] = record.entry
+	}
+	return entries, nil
+}
+
+// EnforceRetention 按各租户的保留策略淘汰过期日志，返回淘汰的总条数
+func (mp *MultiTenantPipeline) EnforceRetention() int {
+	mp.mutex.Lock()
+	streams := make([]*tenantStream, 0, len(mp.tenants))
+	for _, stream := range mp.tenants {
+		streams = append(streams, stream)
+	}
+	mp.mutex.Unlock()
+
+	now := mp.now()
+	total := 0
+	for _, stream := range streams {
+		total += stream.enforceRetention(now)
+	}
+	return total
+}
+
+// enforceRetention 淘汰租户缓冲区中过期的日志，返回淘汰的条数
+func (stream *tenantStream) enforceRetention(now time.Time) int {
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if stream.config.Retention <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-stream.config.Retention)
+	expired := 0
+	for expired < len(stream.records) && stream.records[expired].receivedAt.Before(cutoff) {
+		expired++
+	}
+	stream.records = stream.records[expired:]
+	stream.usage.Evicted += expired
+	return expired
+}
+
+// Usage 获取租户用量统计
+func (mp *MultiTenantPipeline) Usage(tenantID string) (TenantUsage, error) {
+	stream, _, err := mp.lookup(tenantID)
+	if err != nil {
+		return TenantUsage{}, err
+	}
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	usage := stream.usage
+	usage.Buffered = len(stream.records)
+	return usage, nil
+}
+
+// Tenants 返回已注册的租户ID列表
+func (mp *MultiTenantPipeline) Tenants() []string {
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	ids := make([]string, 0, len(mp.tenants))
+	for id := range mp.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
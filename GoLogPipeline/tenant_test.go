@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// memorySink 测试用输出
+type memorySink struct {
+	entries []LogEntry
+}
+
+func (ms *memorySink) Write(entry LogEntry) error {
+	ms.entries = append(ms.entries, entry)
+	return nil
+}
+
+func TestTenantIsolation(t *testing.T) {
+	pipeline := NewMultiTenantPipeline()
+	sinkA := &memorySink{}
+	pipeline.RegisterTenant(TenantConfig{ID: "app-a", Sink: sinkA})
+	pipeline.RegisterTenant(TenantConfig{ID: "app-b"})
+
+	pipeline.Ingest("app-a", "2024-01-15 10:30:15 [INFO] 来自A")
+	pipeline.Ingest("app-b", "2024-01-15 10:30:16 [ERROR] 来自B")
+	pipeline.Ingest("app-b", "无法解析的日志")
+
+	entriesA, _ := pipeline.Entries("app-a")
+	entriesB, _ := pipeline.Entries("app-b")
+	if len(entriesA) != 1 || len(entriesB) != 1 {
+		t.Fatalf("租户缓冲区未隔离: A=%d B=%d", len(entriesA), len(entriesB))
+	}
+	if entriesA[0].Tenant != "app-a" {
+		t.Errorf("日志未标记租户: %+v", entriesA[0])
+	}
+	if len(sinkA.entries) != 1 {
+		t.Errorf("期望租户A输出1条，实际%d条", len(sinkA.entries))
+	}
+
+	usageB, _ := pipeline.Usage("app-b")
+	if usageB.Received != 2 || usageB.Accepted != 1 || usageB.Invalid != 1 {
+		t.Errorf("租户B用量不正确: %+v", usageB)
+	}
+
+	if err := pipeline.Ingest("unknown", "2024-01-15 10:30:15 [INFO] x"); !errors.Is(err, ErrUnknownTenant) {
+		t.Errorf("期望未知租户错误，实际%v", err)
+	}
+}
+
+func TestTenantQuotaAndBuffer(t *testing.T) {
+	pipeline := NewMultiTenantPipeline()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	pipeline.now = func() time.Time { return now }
+	pipeline.RegisterTenant(TenantConfig{ID: "noisy", QuotaPerMinute: 3, BufferSize: 2})
+
+	for i := 0; i < 5; i++ {
+		pipeline.Ingest("noisy", "2024-01-15 10:30:15 [INFO] 消息")
+	}
+
+	usage, _ := pipeline.Usage("noisy")
+	if usage.Accepted != 3 || usage.Rejected != 2 {
+		t.Errorf("配额未生效: %+v", usage)
+	}
+	if usage.Buffered != 2 || usage.Evicted != 1 {
+		t.Errorf("缓冲区容量未生效: %+v", usage)
+	}
+
+	// 进入下一个配额窗口
+	now = now.Add(time.Minute)
+	if err := pipeline.Ingest("noisy", "2024-01-15 10:31:15 [INFO] 消息"); err != nil {
+		t.Errorf("新窗口应恢复配额: %v", err)
+	}
+}
+
+func TestTenantRetention(t *testing.T) {
+	pipeline := NewMultiTenantPipeline()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	pipeline.now = func() time.Time { return now }
+	pipeline.RegisterTenant(TenantConfig{ID: "short", Retention: time.Hour})
+	pipeline.RegisterTenant(TenantConfig{ID: "forever"})
+
+	pipeline.Ingest("short", "2024-01-15 10:00:00 [INFO] 旧日志")
+	pipeline.Ingest("forever", "2024-01-15 10:00:00 [INFO] 旧日志")
+
+	now = now.Add(2 * time.Hour)
+	pipeline.Ingest("short", "2024-01-15 12:00:00 [INFO] 新日志")
+
+	if evicted := pipeline.EnforceRetention(); evicted != 1 {
+		t.Errorf("期望淘汰1条，实际%d条", evicted)
+	}
+
+	short, _ := pipeline.Entries("short")
+	forever, _ := pipeline.Entries("forever")
+	if len(short) != 1 || len(forever) != 1 {
+		t.Errorf("保留策略未按租户隔离: short=%d forever=%d", len(short), len(forever))
+	}
+}
+
+func TestTenantIngestDoesNotBlockOthers(t *testing.T) {
+	pipeline := NewMultiTenantPipeline()
+	archive, err := NewArchive(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline.SetArchive(archive)
+
+	// 租户slow的解析器阻塞，直到测试放行
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	pipeline.RegisterTenant(TenantConfig{ID: "slow", Parser: ParserFunc(func(line string) (LogEntry, bool) {
+		close(entered)
+		<-release
+		return LogEntry{Message: line}, true
+	})})
+	pipeline.RegisterTenant(TenantConfig{ID: "fast"})
+
+	slowDone := make(chan error, 1)
+	go func() { slowDone <- pipeline.Ingest("slow", "慢日志") }()
+	<-entered
+
+	fastDone := make(chan error, 1)
+	go func() { fastDone <- pipeline.Ingest("fast", "2024-01-15 10:30:15 [INFO] 快日志") }()
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Errorf("租户fast接收失败: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("一个租户的慢解析器阻塞了其他租户的接收")
+	}
+	if usage, _ := pipeline.Usage("fast"); usage.Accepted != 1 {
+		t.Errorf("租户fast期望接收1条，实际%+v", usage)
+	}
+
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Errorf("租户slow接收失败: %v", err)
+	}
+	if usage, _ := pipeline.Usage("slow"); usage.Accepted != 1 {
+		t.Errorf("租户slow期望接收1条，实际%+v", usage)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 项目只依赖标准库，这里实现服务端需要的最小WebSocket（RFC 6455）：握手、文本消息、
+// 分片的客户端消息、ping/pong和关闭，不支持扩展（如permessage-deflate）
+
+// WebSocket的操作码
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsAcceptGUID 计算Sec-WebSocket-Accept时拼接在key后面的固定GUID
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessage 客户端消息的最大字节数，实时跟踪只需要接收很小的控制消息
+const wsMaxMessage = 64 * 1024
+
+// wsWriteTimeout 写一帧的超时，避免卡住的客户端占住发送goroutine
+const wsWriteTimeout = 10 * time.Second
+
+// errWebSocketClosed 对方发送了关闭帧
+var errWebSocketClosed = errors.New("WebSocket连接已关闭")
+
+// isWebSocketRequest 请求是否要求升级为WebSocket
+func isWebSocketRequest(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn 服务端的WebSocket连接，写入可以在多个goroutine中进行，读取只能在一个goroutine中进行
+type wsConn struct {
+	conn       net.Conn
+	reader     *bufio.Reader
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+}
+
+// upgradeWebSocket 完成握手并接管连接，失败时已经写好了HTTP错误响应
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet || !isWebSocketRequest(r) {
+		http.Error(w, "需要WebSocket连接", http.StatusBadRequest)
+		return nil, errors.New("不是WebSocket请求")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "只支持WebSocket版本13", http.StatusUpgradeRequired)
+		return nil, errors.New("WebSocket版本不支持")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Sec-WebSocket-Key无效", http.StatusBadRequest)
+		return nil, errors.New("Sec-WebSocket-Key无效")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "连接不支持升级", http.StatusInternalServerError)
+		return nil, errors.New("ResponseWriter不支持Hijack")
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: buffered.Reader}, nil
+}
+
+// WriteText 发送一条文本消息
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsText, data)
+}
+
+// writeFrame 写一个不分片、不加掩码的帧（服务端发出的帧不加掩码）
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // FIN
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadMessage 读取一条完整的数据消息，自动回复ping；收到关闭帧时回复关闭并返回errWebSocketClosed
+func (c *wsConn) ReadMessage() (opcode byte, message []byte, err error) {
+	for {
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frameOpcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeFrame(wsClose, payload) // 原样返回状态码，完成关闭握手
+			return 0, nil, errWebSocketClosed
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return 0, nil, errors.New("上一条分片消息还没有结束")
+			}
+			opcode = frameOpcode
+		case wsContinuation:
+			if opcode == 0 {
+				return 0, nil, errors.New("没有开始的分片消息")
+			}
+		default:
+			return 0, nil, fmt.Errorf("未知的操作码 %#x", frameOpcode)
+		}
+		if len(message)+len(payload) > wsMaxMessage {
+			return 0, nil, fmt.Errorf("消息超过%d字节", wsMaxMessage)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame 读取一帧，客户端发来的帧必须加掩码
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("不支持WebSocket扩展")
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("客户端的帧没有掩码")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, errors.New("控制帧不能分片或超过125字节")
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, fmt.Errorf("帧超过%d字节", wsMaxMessage)
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Close 发送关闭帧（状态码1001，服务端离开）后关闭连接，可以重复调用
+func (c *wsConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.writeFrame(wsClose, []byte{0x03, 0xE9})
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 配置文件使用的YAML子集：块映射、块序列（包括序列项中的映射）、单行的流式 [a, b] 和 {k: v}、
+// 单引号和双引号字符串、注释。不支持锚点、多文档、块标量（| 和 >）等其余语法。
+// 项目只依赖标准库，因此没有引入完整的YAML库
+
+// yamlLine 去掉注释后的非空行
+type yamlLine struct {
+	num    int // 行号，用于错误信息
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML 把YAML解析为map[string]any、[]any和标量（string、int64、float64、bool、nil）
+func parseYAML(data string) (any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(data, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		text := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("第%d行: 缩进不能使用制表符", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+
+	p := &yamlParser{lines: lines}
+	value, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("第%d行: 缩进不正确", p.lines[p.pos].num)
+	}
+	return value, nil
+}
+
+// stripYAMLComment 去掉引号之外、行首或空白之后的 # 注释
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" \t:[{,-", rune(line[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock 解析从当前行开始、缩进为indent的映射或序列
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	if isSequenceItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		rest := strings.TrimLeft(line.text[1:], " ")
+		if rest == "" {
+			p.pos++
+			var item any
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				var err error
+				if item, err = p.parseBlock(p.lines[p.pos].indent); err != nil {
+					return nil, err
+				}
+			}
+			items = append(items, item)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok || isSequenceItem(rest) {
+			// "- key: value" 的映射（或嵌套序列）从 "- " 之后的列开始，后续的键与它对齐
+			column := indent + len(line.text) - len(rest)
+			p.lines[p.pos] = yamlLine{num: line.num, indent: column, text: rest}
+			item, err := p.parseBlock(column)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+		item, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", line.num, err)
+		}
+		items = append(items, item)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	values := map[string]any{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && !isSequenceItem(p.lines[p.pos].text) {
+		line := p.lines[p.pos]
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("第%d行: 应为 \"键: 值\"", line.num)
+		}
+		if _, exists := values[key]; exists {
+			return nil, fmt.Errorf("第%d行: 键 %q 重复", line.num, key)
+		}
+		p.pos++
+
+		if rest == "|" || rest == ">" || strings.HasPrefix(rest, "&") || strings.HasPrefix(rest, "*") {
+			return nil, fmt.Errorf("第%d行: 不支持块标量、锚点和别名", line.num)
+		}
+		if rest != "" {
+			value, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行: %v", line.num, err)
+			}
+			values[key] = value
+			continue
+		}
+		// 值在下一行：缩进更深的块，或与键对齐的序列
+		var value any
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			if next.indent > indent || (next.indent == indent && isSequenceItem(next.text)) {
+				var err error
+				if value, err = p.parseBlock(next.indent); err != nil {
+					return nil, err
+				}
+			}
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// splitYAMLKey 把 "键: 值" 拆开，键可以带引号；值可以为空
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' || (end+2 < len(text) && text[end+2] != ' ') {
+			return "", "", false
+		}
+		value, err := parseYAMLScalar(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return fmt.Sprint(value), strings.TrimSpace(text[end+2:]), true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// closingQuote 返回text开头的引号字符串的结束位置，没有闭合时返回-1
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case quote == '\'' && text[i] == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++ // 单引号字符串中 '' 表示一个单引号
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLScalar 解析一行中的值：引号字符串、流式序列和映射或普通标量
+func parseYAMLScalar(text string) (any, error) {
+	f := &yamlFlow{text: text}
+	value, err := f.value(false)
+	if err != nil {
+		return nil, err
+	}
+	f.skipSpaces()
+	if f.pos < len(f.text) {
+		return nil, fmt.Errorf("值 %q 结尾有多余的内容", text)
+	}
+	return value, nil
+}
+
+// yamlFlow 解析单行的值，inFlow为true时普通标量在 , ] } 处结束
+type yamlFlow struct {
+	text string
+	pos  int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.pos < len(f.text) && f.text[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+func (f *yamlFlow) value(inFlow bool) (any, error) {
+	f.skipSpaces()
+	if f.pos >= len(f.text) {
+		return nil, nil
+	}
+	switch c := f.text[f.pos]; c {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		end := closingQuote(f.text[f.pos:])
+		if end < 0 {
+			return nil, fmt.Errorf("引号未闭合: %s", f.text[f.pos:])
+		}
+		quoted := f.text[f.pos : f.pos+end+1]
+		f.pos += end + 1
+		if c == '\'' {
+			return strings.ReplaceAll(quoted[1:len(quoted)-1], "''", "'"), nil
+		}
+		return strconv.Unquote(quoted)
+	}
+
+	start := f.pos
+	for f.pos < len(f.text) {
+		c := f.text[f.pos]
+		if inFlow && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		if inFlow && c == ':' && (f.pos+1 == len(f.text) || strings.ContainsRune(" ,]}", rune(f.text[f.pos+1]))) {
+			break
+		}
+		f.pos++
+	}
+	return plainYAMLScalar(strings.TrimSpace(f.text[start:f.pos])), nil
+}
+
+func (f *yamlFlow) sequence() (any, error) {
+	f.pos++ // '['
+	items := []any{}
+	for {
+		f.skipSpaces()
+		if f.pos < len(f.text) && f.text[f.pos] == ']' {
+			f.pos++
+			return items, nil
+		}
+		item, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		f.skipSpaces()
+		if f.pos >= len(f.text) {
+			return nil, fmt.Errorf("序列缺少 ]")
+		}
+		if f.text[f.pos] == ',' {
+			f.pos++
+		} else if f.text[f.pos] != ']' {
+			return nil, fmt.Errorf("序列中应为 , 或 ]")
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (any, error) {
+	f.pos++ // '{'
+	values := map[string]any{}
+	for {
+		f.skipSpaces()
+		if f.pos < len(f.text) && f.text[f.pos] == '}' {
+			f.pos++
+			return values, nil
+		}
+		key, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		f.skipSpaces()
+		if f.pos >= len(f.text) || f.text[f.pos] != ':' {
+			return nil, fmt.Errorf("映射中应为 键: 值")
+		}
+		f.pos++
+		value, err := f.value(true)
+		if err != nil {
+			return nil, err
+		}
+		values[fmt.Sprint(key)] = value
+		f.skipSpaces()
+		if f.pos >= len(f.text) {
+			return nil, fmt.Errorf("映射缺少 }")
+		}
+		if f.text[f.pos] == ',' {
+			f.pos++
+		} else if f.text[f.pos] != '}' {
+			return nil, fmt.Errorf("映射中应为 , 或 }")
+		}
+	}
+}
+
+// plainYAMLScalar 识别不带引号的布尔、空值和数字，其余为字符串
+func plainYAMLScalar(text string) any {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n
+	}
+	// 只接受十进制写法，inf、nan、0x1p3之类按字符串处理
+	if strings.Trim(text, "0123456789+-.eE") == "" {
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			return n
+		}
+	}
+	return text
+}
@@ -1,36 +1,94 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"ranking/helper"
 	"ranking/models"
 	"ranking/services"
 )
 
 type APIHandler struct {
-	leaderboard *models.Leaderboard
-	manager     *services.ConnectionManager
+	store     models.Store
+	manager   *services.ConnectionManager
+	authKey   []byte
+	limiter   *services.RateLimiter
+	validator services.ScoreValidator
+	tracker   *services.RankTracker
 }
 
-func NewAPIHandler(leaderboard *models.Leaderboard, manager *services.ConnectionManager) *APIHandler {
+func NewAPIHandler(store models.Store, manager *services.ConnectionManager) *APIHandler {
 	return &APIHandler{
-		leaderboard: leaderboard,
-		manager:     manager,
+		store:   store,
+		manager: manager,
 	}
 }
 
+// SetAuthKey requires score submissions to carry a bearer token signed with
+// key. A player's token may only submit for its own user ID; a server's token
+// may submit for anyone. A nil key accepts anonymous submissions.
+func (h *APIHandler) SetAuthKey(key []byte) {
+	h.authKey = key
+}
+
+// SetRateLimiter limits score submissions per target user.
+func (h *APIHandler) SetRateLimiter(limiter *services.RateLimiter) {
+	h.limiter = limiter
+}
+
+// SetValidator checks every score submission before it is applied.
+func (h *APIHandler) SetValidator(validator services.ScoreValidator) {
+	h.validator = validator
+}
+
+// SetRankTracker notifies tracker of every applied score change.
+func (h *APIHandler) SetRankTracker(tracker *services.RankTracker) {
+	h.tracker = tracker
+}
+
+// authenticate returns the claims of the request's bearer token, or nil
+// claims when authentication is disabled.
+func (h *APIHandler) authenticate(r *http.Request) (*helper.UserClaim, error) {
+	if h.authKey == nil {
+		return nil, nil
+	}
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return nil, errors.New("missing bearer token")
+	}
+	return helper.AnalyzeToken(h.authKey, strings.TrimSpace(token))
+}
+
 func (h *APIHandler) HandleUpdateScore(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	claims, err := h.authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Either score (absolute) or delta (increment) is given. The idempotency
+	// key may also come from the Idempotency-Key header.
 	var req struct {
-		UserID   string `json:"user_id"`
-		Username string `json:"username"`
-		Score    int    `json:"score"`
+		UserID         string `json:"user_id"`
+		Username       string `json:"username"`
+		Score          int    `json:"score"`
+		Delta          *int   `json:"delta"`
+		IdempotencyKey string `json:"idempotency_key"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -38,35 +96,281 @@ func (h *APIHandler) HandleUpdateScore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.UserID == "" || req.Username == "" || req.Score < 0 {
+	if claims != nil && !claims.IsServer() {
+		if req.UserID == "" {
+			req.UserID = claims.Identity
+		}
+		if req.UserID != claims.Identity {
+			http.Error(w, "Forbidden: players may only submit their own score", http.StatusForbidden)
+			return
+		}
+		if req.Username == "" {
+			req.Username = claims.Name
+		}
+	}
+
+	if req.UserID == "" || req.Username == "" || (req.Delta == nil && req.Score < 0) {
 		http.Error(w, "Invalid parameters", http.StatusBadRequest)
 		return
 	}
 
-	h.leaderboard.UpdateScore(req.UserID, req.Username, req.Score)
+	update := models.ScoreUpdate{
+		UserID:         req.UserID,
+		Username:       req.Username,
+		Score:          req.Score,
+		IdempotencyKey: req.IdempotencyKey,
+	}
+	if req.Delta != nil {
+		update.Score = *req.Delta
+		update.Delta = true
+	}
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		update.IdempotencyKey = key
+	}
 
-	broadcastMsg := map[string]interface{}{
-		"type":    "update",
-		"top10":   h.leaderboard.GetTopN(10),
-		"updated": time.Now().Unix(),
+	if h.limiter != nil {
+		if allowed, retryAfter := h.limiter.Allow(update.UserID); !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Too many score submissions", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if h.validator != nil {
+		if err := h.validate(r.Context(), update, claims); err != nil {
+			if errors.Is(err, services.ErrScoreRejected) {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			log.Printf("Failed to validate score: %v", err)
+			http.Error(w, "Storage unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	result, err := h.store.ApplyScore(r.Context(), update)
+	if err != nil {
+		log.Printf("Failed to update score: %v", err)
+		http.Error(w, "Storage unavailable", http.StatusServiceUnavailable)
+		return
 	}
 
-	h.manager.BroadcastMessage(broadcastMsg)
+	message := "Score updated successfully"
+	switch {
+	case result.Duplicate:
+		message = "Duplicate request, score already updated"
+	case !result.Applied:
+		message = "Score not updated: the board keeps the best score"
+	default:
+		BroadcastTop(r.Context(), h.store, h.manager)
+		if h.tracker != nil {
+			h.tracker.Notify()
+		}
+	}
 
-	currentRank, _ := h.leaderboard.GetUserRank(req.UserID)
 	response := map[string]interface{}{
-		"success": true,
-		"rank":    currentRank,
-		"user_id": req.UserID,
-		"message": "Score updated successfully",
+		"success":     true,
+		"rank":        result.Rank,
+		"score":       result.Score,
+		"approximate": result.Approximate,
+		"applied":     result.Applied,
+		"duplicate":   result.Duplicate,
+		"user_id":     req.UserID,
+		"message":     message,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// validate runs the validator against the user's current score. The check is
+// not atomic with the update: it bounds what one submission can do, while the
+// board's ScorePolicy is what the store enforces.
+func (h *APIHandler) validate(ctx context.Context, update models.ScoreUpdate, claims *helper.UserClaim) error {
+	current, exists, err := h.store.GetUserRank(ctx, update.UserID)
+	if err != nil {
+		return err
+	}
+	return h.validator.ValidateScore(ctx, services.ScoreSubmission{
+		Update:  update,
+		Claims:  claims,
+		Current: current.Score,
+		Exists:  exists,
+	})
+}
+
 func (h *APIHandler) HandleGetTop(w http.ResponseWriter, r *http.Request) {
-	top := h.leaderboard.GetTopN(10)
+	top, err := h.store.GetTopN(r.Context(), 10)
+	if err != nil {
+		log.Printf("Failed to read leaderboard: %v", err)
+		http.Error(w, "Storage unavailable", http.StatusServiceUnavailable)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(top)
 }
+
+const (
+	// MaxPageSize caps the limit of a range query.
+	MaxPageSize = 100
+	// MaxAroundK caps the neighbors on each side of an "around me" query.
+	MaxAroundK = 50
+	// MaxHistoryPoints caps the points of a timeline query.
+	MaxHistoryPoints = 1000
+
+	defaultPageSize = 20
+	defaultAroundK  = 5
+)
+
+// HandleGetRange serves GET /api/range?offset=0&limit=20 for paging through the board.
+func (h *APIHandler) HandleGetRange(w http.ResponseWriter, r *http.Request) {
+	offset, err := queryInt(r, "offset", 0, 0, -1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultPageSize, 1, MaxPageSize)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := rangeResponse(r.Context(), h.store, offset, limit)
+	if err != nil {
+		log.Printf("Failed to read leaderboard range: %v", err)
+		http.Error(w, "Storage unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetAround serves GET /api/around?user_id=user1&k=5 with the user's neighbors.
+func (h *APIHandler) HandleGetAround(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	k, err := queryInt(r, "k", defaultAroundK, 0, MaxAroundK)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, exists, err := aroundResponse(r.Context(), h.store, userID, k)
+	if err != nil {
+		log.Printf("Failed to read players around %s: %v", userID, err)
+		http.Error(w, "Storage unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetHistory serves GET /api/history?user_id=user1&limit=100 with the
+// user's score and rank after each of their updates, oldest first.
+func (h *APIHandler) HandleGetHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		http.Error(w, "user_id is required", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", models.DefaultHistoryLength, 1, MaxHistoryPoints)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := historyResponse(r.Context(), h.store, userID, limit)
+	if err != nil {
+		log.Printf("Failed to read history of %s: %v", userID, err)
+		http.Error(w, "Storage unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// historyResponse is the payload of timeline queries over HTTP and WebSocket.
+func historyResponse(ctx context.Context, store models.Store, userID string, limit int) (map[string]interface{}, error) {
+	points, err := store.GetHistory(ctx, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type":    "history",
+		"user_id": userID,
+		"points":  points,
+	}, nil
+}
+
+// rangeResponse is the payload of range queries over HTTP and WebSocket.
+func rangeResponse(ctx context.Context, store models.Store, offset, limit int) (map[string]interface{}, error) {
+	players, err := store.GetRange(ctx, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	total, err := store.TotalPlayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"type":    "range",
+		"offset":  offset,
+		"limit":   limit,
+		"total":   total,
+		"players": players,
+	}, nil
+}
+
+// aroundResponse is the payload of "around me" queries over HTTP and WebSocket.
+func aroundResponse(ctx context.Context, store models.Store, userID string, k int) (map[string]interface{}, bool, error) {
+	players, exists, err := store.GetAroundUser(ctx, userID, k)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return map[string]interface{}{
+		"type":    "around",
+		"user_id": userID,
+		"k":       k,
+		"players": players,
+	}, true, nil
+}
+
+// queryInt reads an integer query parameter within [min, max]; max < 0 means unbounded.
+func queryInt(r *http.Request, name string, fallback, min, max int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || (max >= 0 && value > max) {
+		if max >= 0 {
+			return 0, fmt.Errorf("%s must be an integer between %d and %d", name, min, max)
+		}
+		return 0, fmt.Errorf("%s must be an integer of at least %d", name, min)
+	}
+	return value, nil
+}
+
+// BroadcastTop sends the current top 10 to every WebSocket client of the
+// default board. It is also called for updates relayed from other instances.
+func BroadcastTop(ctx context.Context, store models.Store, manager *services.ConnectionManager) {
+	top, err := store.GetTopN(ctx, 10)
+	if err != nil {
+		log.Printf("Failed to read leaderboard for broadcast: %v", err)
+		return
+	}
+	broadcastMsg := map[string]interface{}{
+		"type":    "update",
+		"top10":   top,
+		"updated": time.Now().Unix(),
+	}
+
+	manager.BroadcastBoardMessage(services.DefaultBoard, broadcastMsg)
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"time"
@@ -19,17 +21,24 @@ var upgrader = websocket.Upgrader{
 }
 
 type WebSocketHandler struct {
-	leaderboard *models.Leaderboard
-	manager     *services.ConnectionManager
+	store   models.Store
+	manager *services.ConnectionManager
+	tracker *services.RankTracker
 }
 
-func NewWebSocketHandler(leaderboard *models.Leaderboard, manager *services.ConnectionManager) *WebSocketHandler {
+func NewWebSocketHandler(store models.Store, manager *services.ConnectionManager) *WebSocketHandler {
 	return &WebSocketHandler{
-		leaderboard: leaderboard,
-		manager:     manager,
+		store:   store,
+		manager: manager,
 	}
 }
 
+// SetRankTracker sends rank change events to clients that connect with a
+// user ID (/ws?user_id=user1).
+func (h *WebSocketHandler) SetRankTracker(tracker *services.RankTracker) {
+	h.tracker = tracker
+}
+
 func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -38,21 +47,192 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 	}
 	defer h.manager.Unregister(conn)
 
-	h.manager.Register(conn)
+	if !h.registerResumed(conn, r.URL.Query().Get("resume")) {
+		// The snapshot is read outside the sequencing lock; deltas appended
+		// since its seq are queued right after it.
+		seq := h.manager.Deltas().LastSeq(services.DefaultBoard)
+		snapshot, err := h.snapshotMessage(r.Context(), r.URL.Query().Get("user_id"), seq)
+		if err != nil {
+			log.Printf("WebSocket snapshot failed: %v", err)
+			conn.Close()
+			return
+		}
+		h.manager.RegisterAt(conn, services.DefaultBoard, seq, func(deltas []services.Delta, ok bool) [][]byte {
+			messages := [][]byte{snapshot}
+			for _, delta := range deltas {
+				messages = append(messages, delta.Payload)
+			}
+			return messages
+		})
+	}
 
-	initialData := map[string]interface{}{
-		"type":    "initial",
-		"top10":   h.leaderboard.GetTopN(10),
-		"updated": time.Now().Unix(),
+	if userID := r.URL.Query().Get("user_id"); userID != "" && h.tracker != nil {
+		stop, err := h.tracker.Watch(r.Context(), userID, func(event []byte) {
+			if err := h.manager.Send(conn, event); err != nil {
+				log.Printf("WebSocket rank event dropped: %v", err)
+			}
+		})
+		if err != nil {
+			log.Printf("Failed to watch rank of %s: %v", userID, err)
+		} else {
+			defer stop()
+		}
 	}
-	jsonData, _ := json.Marshal(initialData)
-	conn.WriteMessage(websocket.TextMessage, jsonData)
 
+	// The read loop also processes pongs; it ends when the pong wait expires.
 	for {
-		_, _, err := conn.ReadMessage()
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("WebSocket connection closed: %v", err)
 			break
 		}
+		reply, _ := json.Marshal(h.handleRequest(r.Context(), data))
+		if err := h.manager.Send(conn, reply); err != nil {
+			log.Printf("WebSocket reply failed: %v", err)
+			break
+		}
+	}
+}
+
+// wsRequest is a query sent by a client over the WebSocket:
+//
+//	{"type": "range", "offset": 0, "limit": 20}
+//	{"type": "around", "user_id": "user1", "k": 5}
+//	{"type": "history", "user_id": "user1", "limit": 100}
+//
+// The reply has the same type and the same payload as /api/range,
+// /api/around and /api/history, or type "error".
+type wsRequest struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+	UserID string `json:"user_id"`
+	K      *int   `json:"k"`
+}
+
+func (h *WebSocketHandler) handleRequest(ctx context.Context, data []byte) map[string]interface{} {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return wsError("invalid request")
+	}
+
+	switch req.Type {
+	case "range":
+		if req.Limit == 0 {
+			req.Limit = defaultPageSize
+		}
+		if req.Offset < 0 || req.Limit < 1 || req.Limit > MaxPageSize {
+			return wsError(fmt.Sprintf("offset must be at least 0 and limit between 1 and %d", MaxPageSize))
+		}
+		response, err := rangeResponse(ctx, h.store, req.Offset, req.Limit)
+		if err != nil {
+			log.Printf("Failed to read leaderboard range: %v", err)
+			return wsError("storage unavailable")
+		}
+		return response
+	case "around":
+		k := defaultAroundK
+		if req.K != nil {
+			k = *req.K
+		}
+		if req.UserID == "" || k < 0 || k > MaxAroundK {
+			return wsError(fmt.Sprintf("user_id is required and k must be between 0 and %d", MaxAroundK))
+		}
+		response, exists, err := aroundResponse(ctx, h.store, req.UserID, k)
+		if err != nil {
+			log.Printf("Failed to read players around %s: %v", req.UserID, err)
+			return wsError("storage unavailable")
+		}
+		if !exists {
+			return wsError("user not found")
+		}
+		return response
+	case "history":
+		if req.Limit == 0 {
+			req.Limit = models.DefaultHistoryLength
+		}
+		if req.UserID == "" || req.Limit < 1 || req.Limit > MaxHistoryPoints {
+			return wsError(fmt.Sprintf("user_id is required and limit must be between 1 and %d", MaxHistoryPoints))
+		}
+		response, err := historyResponse(ctx, h.store, req.UserID, req.Limit)
+		if err != nil {
+			log.Printf("Failed to read history of %s: %v", req.UserID, err)
+			return wsError("storage unavailable")
+		}
+		return response
+	default:
+		return wsError(fmt.Sprintf("unknown request type %q", req.Type))
+	}
+}
+
+func wsError(message string) map[string]interface{} {
+	return map[string]interface{}{"type": "error", "message": message}
+}
+
+// registerResumed registers conn with the deltas missed since the resume
+// token followed by a "resumed" marker. It returns false if the token is
+// invalid or the deltas have already been evicted from the buffer.
+func (h *WebSocketHandler) registerResumed(conn *websocket.Conn, token string) bool {
+	if token == "" {
+		return false
+	}
+	board, seq, err := services.DecodeResumeToken(token)
+	if err != nil || board != services.DefaultBoard {
+		return false
+	}
+	return h.manager.RegisterAt(conn, board, seq, func(deltas []services.Delta, ok bool) [][]byte {
+		if !ok {
+			return nil
+		}
+		return resumeMessages(board, seq, deltas)
+	})
+}
+
+// resumeMessages returns the replayed deltas followed by the "resumed" marker.
+func resumeMessages(board string, seq uint64, deltas []services.Delta) [][]byte {
+	messages := make([][]byte, 0, len(deltas)+1)
+	for _, delta := range deltas {
+		messages = append(messages, delta.Payload)
+	}
+
+	lastSeq := seq
+	if len(deltas) > 0 {
+		lastSeq = deltas[len(deltas)-1].Seq
+	}
+	resumed, _ := json.Marshal(map[string]interface{}{
+		"type":         "resumed",
+		"board":        board,
+		"seq":          lastSeq,
+		"replayed":     len(deltas),
+		"resume_token": services.EncodeResumeToken(board, lastSeq),
+	})
+	return append(messages, resumed)
+}
+
+// snapshotMessage is the initial message at seq, which must be read before
+// the store; with a user ID (/ws?user_id=user1) it also carries the players
+// around that user.
+func (h *WebSocketHandler) snapshotMessage(ctx context.Context, userID string, seq uint64) ([]byte, error) {
+	top, err := h.store.GetTopN(ctx, 10)
+	if err != nil {
+		return nil, err
+	}
+	initialData := map[string]interface{}{
+		"type":         "initial",
+		"board":        services.DefaultBoard,
+		"top10":        top,
+		"seq":          seq,
+		"resume_token": services.EncodeResumeToken(services.DefaultBoard, seq),
+		"updated":      time.Now().Unix(),
+	}
+	if userID != "" {
+		around, exists, err := h.store.GetAroundUser(ctx, userID, defaultAroundK)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			initialData["around"] = around
+		}
 	}
+	return json.Marshal(initialData)
 }
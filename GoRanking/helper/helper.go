@@ -0,0 +1,68 @@
+package helper
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// RolePlayer tokens may only submit scores for their own user ID.
+	RolePlayer = "player"
+	// RoleServer tokens belong to trusted game servers and may submit for any user.
+	RoleServer = "server"
+)
+
+type UserClaim struct {
+	Identity string `json:"identity"` // user ID, or the name of a game server
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// IsServer reports whether the token belongs to a trusted game server.
+func (uc *UserClaim) IsServer() bool {
+	return uc.Role == RoleServer
+}
+
+// GenerateToken signs an HS256 token that expires after ttl (never if ttl is 0).
+func GenerateToken(key []byte, identity, name, role string, ttl time.Duration) (string, error) {
+	uc := UserClaim{
+		Identity: identity,
+		Name:     name,
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if ttl != 0 {
+		uc.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, uc)
+	return token.SignedString(key)
+}
+
+// AnalyzeToken verifies the signature and expiry of an HS256 token.
+func AnalyzeToken(key []byte, token string) (*UserClaim, error) {
+	uc := new(UserClaim)
+	claims, err := jwt.ParseWithClaims(token, uc, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !claims.Valid {
+		return nil, errors.New("token is invalid")
+	}
+	if uc.Identity == "" {
+		return nil, errors.New("token has no identity")
+	}
+	if uc.Role == "" {
+		uc.Role = RolePlayer
+	}
+	return uc, nil
+}
@@ -0,0 +1,26 @@
+package helper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	key := []byte("secret")
+	token, err := GenerateToken(key, "user1", "Alice", RoleServer, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := AnalyzeToken(key, token)
+	if err != nil || claims.Identity != "user1" || claims.Name != "Alice" || !claims.IsServer() {
+		t.Errorf("Unexpected claims %+v (%v)", claims, err)
+	}
+
+	if _, err := AnalyzeToken([]byte("other"), token); err == nil {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+	expired, _ := GenerateToken(key, "user1", "Alice", RolePlayer, -time.Minute)
+	if _, err := AnalyzeToken(key, expired); err == nil {
+		t.Error("Expected an expired token to be rejected")
+	}
+}
@@ -1,24 +1,108 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"ranking/handlers"
+	"ranking/helper"
 	"ranking/models"
 	"ranking/services"
+
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
-	// 创建排行榜
-	leaderboard := models.NewLeaderboard()
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		issueToken(os.Args[2:])
+		return
+	}
+
+	maxSize := flag.Int("max-size", 0, "keep only the top N players exactly, 0 for unbounded")
+	noDecrease := flag.Bool("no-decrease", false, "keep each player's best score: ignore updates that would lower it")
+	redisAddr := flag.String("redis", "", "Redis address (host:port or redis:// URL) to store the leaderboard in; in memory if empty")
+	jwtKey := flag.String("jwt-key", os.Getenv("RANKING_JWT_KEY"), "HS256 key that score submissions must be signed with (default $RANKING_JWT_KEY); anonymous if empty")
+	rateLimit := flag.Float64("rate-limit", services.DefaultRateLimit, "score submissions per second per user, 0 for unlimited")
+	rateBurst := flag.Int("rate-burst", services.DefaultRateBurst, "score submissions a user may make at once")
+	maxDelta := flag.Int("max-delta", 0, "reject submissions that change a score by more than this, 0 for no limit")
+	historyLength := flag.Int("history", models.DefaultHistoryLength, "score timeline points kept per user, 0 to disable")
+	serverAuthoritative := flag.Bool("server-authoritative", false, "accept scores only from tokens with the server role")
+	flag.Parse()
+	if *maxSize != 0 && *redisAddr != "" {
+		log.Fatal("-max-size only applies to the in-memory leaderboard and cannot be combined with -redis")
+	}
 
 	// 创建连接管理器
 	manager := services.NewConnectionManager()
 
+	// 创建排行榜存储
+	policy := models.ScorePolicy{NoDecrease: *noDecrease}
+	var store models.Store
+	var redisStore *models.RedisStore
+	if *redisAddr != "" {
+		var err error
+		if redisStore, err = openRedisStore(*redisAddr); err != nil {
+			log.Fatalf("Redis unavailable: %v", err)
+		}
+		redisStore.SetPolicy(policy)
+		redisStore.SetHistoryLength(*historyLength)
+		store = redisStore
+	} else {
+		leaderboard := models.NewBoundedLeaderboard(models.CapacityOptions{MaxSize: *maxSize})
+		leaderboard.SetPolicy(policy)
+		leaderboard.SetHistoryLength(*historyLength)
+		store = models.NewMemoryStore(leaderboard)
+	}
+
+	// 排名变化事件：跟踪带user_id连接的用户
+	tracker := services.NewRankTracker(store, services.RankTrackerOptions{})
+	go tracker.Run()
+
+	if redisStore != nil {
+		// 其他实例的分数更新同样推送给本实例的客户端
+		go func() {
+			err := redisStore.Subscribe(context.Background(), func(string) {
+				handlers.BroadcastTop(context.Background(), store, manager)
+				tracker.Notify()
+			})
+			log.Fatalf("Redis subscription failed: %v", err)
+		}()
+	}
+
 	// 创建处理器
-	wsHandler := handlers.NewWebSocketHandler(leaderboard, manager)
-	apiHandler := handlers.NewAPIHandler(leaderboard, manager)
+	wsHandler := handlers.NewWebSocketHandler(store, manager)
+	wsHandler.SetRankTracker(tracker)
+	apiHandler := handlers.NewAPIHandler(store, manager)
+	apiHandler.SetRankTracker(tracker)
+
+	// 分数提交的鉴权、限流与校验
+	if *jwtKey != "" {
+		apiHandler.SetAuthKey([]byte(*jwtKey))
+	} else {
+		log.Println("Warning: no -jwt-key, anyone can submit scores for any user")
+	}
+	if *rateLimit > 0 {
+		apiHandler.SetRateLimiter(services.NewRateLimiter(*rateLimit, *rateBurst))
+	}
+	var validators services.ValidatorChain
+	if *serverAuthoritative {
+		if *jwtKey == "" {
+			log.Fatal("-server-authoritative requires -jwt-key")
+		}
+		validators = append(validators, services.ServerAuthoritative{})
+	}
+	if *maxDelta > 0 {
+		validators = append(validators, services.MaxDeltaValidator{MaxDelta: *maxDelta})
+	}
+	if len(validators) > 0 {
+		apiHandler.SetValidator(validators)
+	}
 
 	// 启动WebSocket广播协程
 	go manager.Run()
@@ -27,8 +111,52 @@ func main() {
 	http.HandleFunc("/ws", wsHandler.HandleWebSocket)
 	http.HandleFunc("/api/update-score", apiHandler.HandleUpdateScore)
 	http.HandleFunc("/api/top", apiHandler.HandleGetTop)
+	http.HandleFunc("/api/range", apiHandler.HandleGetRange)
+	http.HandleFunc("/api/around", apiHandler.HandleGetAround)
+	http.HandleFunc("/api/history", apiHandler.HandleGetHistory)
 	http.Handle("/", http.FileServer(http.Dir("./static")))
 
 	log.Println("Server starting on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+func openRedisStore(addr string) (*models.RedisStore, error) {
+	options := &redis.Options{Addr: addr}
+	if strings.Contains(addr, "://") {
+		var err error
+		if options, err = redis.ParseURL(addr); err != nil {
+			return nil, err
+		}
+	}
+	client := redis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return models.NewRedisStore(client, services.DefaultBoard), nil
+}
+
+// issueToken prints a signed token, e.g. for a game server or for testing:
+//
+//	go run . token -identity user1 -name Alice -ttl 24h
+func issueToken(args []string) {
+	flags := flag.NewFlagSet("token", flag.ExitOnError)
+	key := flags.String("jwt-key", os.Getenv("RANKING_JWT_KEY"), "HS256 signing key (default $RANKING_JWT_KEY)")
+	identity := flags.String("identity", "", "user ID, or the name of a game server")
+	name := flags.String("name", "", "username")
+	role := flags.String("role", helper.RolePlayer, "player or server")
+	ttl := flags.Duration("ttl", 24*time.Hour, "validity, 0 for no expiry")
+	flags.Parse(args)
+
+	if *key == "" || *identity == "" {
+		log.Fatal("token requires -jwt-key and -identity")
+	}
+	if *role != helper.RolePlayer && *role != helper.RoleServer {
+		log.Fatalf("unknown role %q", *role)
+	}
+	token, err := helper.GenerateToken([]byte(*key), *identity, *name, *role, *ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(token)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestBoundedLeaderboardKeepsTopN(t *testing.T) {
+	bounded := NewBoundedLeaderboard(CapacityOptions{MaxSize: 50})
+	exact := NewLeaderboard()
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		userID := fmt.Sprintf("user%d", i)
+		score := rng.Intn(100000)
+		bounded.UpdateScore(userID, userID, score)
+		exact.UpdateScore(userID, userID, score)
+	}
+
+	if bounded.Size() != 50 {
+		t.Fatalf("Expected 50 retained players, got %d", bounded.Size())
+	}
+	if bounded.TotalPlayers() != 2000 {
+		t.Errorf("Expected 2000 total players, got %d", bounded.TotalPlayers())
+	}
+
+	top := bounded.GetTopN(50)
+	want := exact.GetTopN(50)
+	for i := range want {
+		if top[i].UserID != want[i].UserID || top[i].Rank != i+1 {
+			t.Fatalf("Position %d: expected %s rank %d, got %s rank %d", i, want[i].UserID, i+1, top[i].UserID, top[i].Rank)
+		}
+		if estimate, _ := bounded.GetUserRankEstimate(top[i].UserID); estimate.Approximate {
+			t.Errorf("Retained player %s should have an exact rank", top[i].UserID)
+		}
+	}
+}
+
+func TestBoundedLeaderboardApproximateRank(t *testing.T) {
+	bounded := NewBoundedLeaderboard(CapacityOptions{MaxSize: 100})
+
+	rng := rand.New(rand.NewSource(2))
+	scores := make([]int, 10000)
+	for i := range scores {
+		userID := fmt.Sprintf("user%d", i)
+		scores[i] = 1000 + rng.Intn(1000000)
+		bounded.UpdateScore(userID, userID, scores[i])
+	}
+
+	for i := 0; i < len(scores); i += 97 {
+		userID := fmt.Sprintf("user%d", i)
+		want := 1
+		for _, score := range scores {
+			if score > scores[i] {
+				want++
+			}
+		}
+		estimate, ok := bounded.GetUserRankEstimate(userID)
+		if !ok {
+			t.Fatalf("Evicted user %s should still have a rank", userID)
+		}
+		if want > 100 && !estimate.Approximate {
+			t.Errorf("Evicted user %s should have an approximate rank", userID)
+		}
+		// Buckets are 1% wide in score, so allow 2% of the board as rank error.
+		if diff := estimate.Rank - want; diff > 200 || diff < -200 {
+			t.Errorf("User %s: expected rank near %d, got %d", userID, want, estimate.Rank)
+		}
+	}
+
+	if _, ok := bounded.GetUserRank("nobody"); ok {
+		t.Error("Unknown user should not have a rank")
+	}
+}
+
+func TestBoundedLeaderboardReadmission(t *testing.T) {
+	lb := NewBoundedLeaderboard(CapacityOptions{MaxSize: 2})
+	lb.UpdateScore("user1", "Alice", 300)
+	lb.UpdateScore("user2", "Bob", 200)
+	lb.UpdateScore("user3", "Charlie", 100)
+
+	estimate, ok := lb.GetUserRankEstimate("user3")
+	if !ok || estimate.Rank != 3 || estimate.Score != 100 || !estimate.Approximate {
+		t.Fatalf("Expected evicted user3 at approximate rank 3, got %+v", estimate)
+	}
+
+	// An evicted player who climbs back takes the bottom player's slot.
+	lb.UpdateScore("user3", "Charlie", 400)
+	top := lb.GetTopN(2)
+	if top[0].UserID != "user3" || top[1].UserID != "user1" {
+		t.Errorf("Expected user3, user1 on top, got %s, %s", top[0].UserID, top[1].UserID)
+	}
+	if lb.TotalPlayers() != 3 {
+		t.Errorf("Re-admitted player should not be double counted, got %d players", lb.TotalPlayers())
+	}
+	if rank, _ := lb.GetUserRank("user2"); rank != 3 {
+		t.Errorf("Expected evicted user2 at rank 3, got %d", rank)
+	}
+
+	// A retained player falling below evicted ones is ranked below them.
+	lb.UpdateScore("user1", "Alice", 50)
+	if rank, _ := lb.GetUserRank("user1"); rank != 3 {
+		t.Errorf("Expected user1 pushed below evicted user2 to rank 3, got %d", rank)
+	}
+}
+
+func TestBoundedLeaderboardForgottenUsersDoNotDrift(t *testing.T) {
+	// A single slot remembers only the last evicted player.
+	lb := NewBoundedLeaderboard(CapacityOptions{MaxSize: 1, SketchSlots: 1})
+	lb.UpdateScore("user1", "Alice", 100)
+	lb.UpdateScore("user2", "Bob", 50)
+	lb.UpdateScore("user3", "Charlie", 40) // evicted, user2 forgotten
+
+	// Forgotten and remembered players take turns climbing back; the total
+	// must never count anyone twice.
+	for i := 0; i < 10; i++ {
+		userID := fmt.Sprintf("user%d", i%3+1)
+		lb.UpdateScore(userID, userID, 1000+i)
+		if total := lb.TotalPlayers(); total > 3 {
+			t.Fatalf("Step %d: expected at most 3 players, got %d", i, total)
+		}
+	}
+	if lb.evicted.total != 1 {
+		t.Errorf("Expected the sketch to hold only the remembered player, got %d", lb.evicted.total)
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// DefaultHistoryLength is how many timeline points are kept per user.
+const DefaultHistoryLength = 100
+
+// HistoryPoint is a user's score and rank right after one of their applied
+// updates. Rank changes caused by other players are not recorded.
+type HistoryPoint struct {
+	Score       int       `json:"score"`
+	Rank        int       `json:"rank"`
+	Approximate bool      `json:"approximate,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// scoreHistory is a ring of the latest points of one user.
+type scoreHistory struct {
+	points []HistoryPoint
+	start  int
+}
+
+func (h *scoreHistory) add(point HistoryPoint, capacity int) {
+	if len(h.points) > capacity {
+		// The length was lowered: keep only the newest points.
+		h.points, h.start = h.latest(capacity), 0
+	}
+	if len(h.points) < capacity {
+		h.points = append(h.points, point)
+		return
+	}
+	h.points[h.start] = point
+	h.start = (h.start + 1) % len(h.points)
+}
+
+// latest returns up to limit of the newest points, oldest first.
+func (h *scoreHistory) latest(limit int) []HistoryPoint {
+	if limit <= 0 || limit > len(h.points) {
+		limit = len(h.points)
+	}
+	result := make([]HistoryPoint, 0, limit)
+	for i := len(h.points) - limit; i < len(h.points); i++ {
+		result = append(result, h.points[(h.start+i)%len(h.points)])
+	}
+	return result
+}
+
+// SetHistoryLength sets how many timeline points are kept per user; 0
+// stops recording. Lowering it trims each user's timeline on their next update.
+func (lb *Leaderboard) SetHistoryLength(length int) {
+	lb.Lock()
+	defer lb.Unlock()
+	lb.historyLength = length
+}
+
+func (lb *Leaderboard) recordLocked(userID string, estimate RankEstimate, now time.Time) {
+	if _, retained := lb.scores[userID]; !retained || lb.historyLength <= 0 {
+		return
+	}
+	history, exists := lb.history[userID]
+	if !exists {
+		history = &scoreHistory{}
+		lb.history[userID] = history
+	}
+	history.add(HistoryPoint{
+		Score:       estimate.Score,
+		Rank:        estimate.Rank,
+		Approximate: estimate.Approximate,
+		Time:        now,
+	}, lb.historyLength)
+}
+
+// GetHistory returns up to limit of the user's latest timeline points, oldest
+// first; limit <= 0 returns all of them. A bounded board forgets the timeline
+// of players it evicts.
+func (lb *Leaderboard) GetHistory(userID string, limit int) []HistoryPoint {
+	lb.RLock()
+	defer lb.RUnlock()
+
+	history, exists := lb.history[userID]
+	if !exists {
+		return []HistoryPoint{}
+	}
+	return history.latest(limit)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func timeline(points []HistoryPoint) string {
+	result := ""
+	for i, point := range points {
+		if i > 0 {
+			result += ","
+		}
+		result += fmt.Sprintf("%d#%d", point.Score, point.Rank)
+	}
+	return result
+}
+
+func TestScoreHistory(t *testing.T) {
+	ctx := context.Background()
+	stores := testStores(t, ScorePolicy{NoDecrease: true})
+	stores["memory"].(*MemoryStore).Leaderboard().SetHistoryLength(3)
+	stores["redis"].(*RedisStore).SetHistoryLength(3)
+
+	for name, store := range stores {
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100})
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user2", Username: "Bob", Score: 150})
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 50})                                    // rejected
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100, Delta: true, IdempotencyKey: "a"}) // 200
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100, Delta: true, IdempotencyKey: "a"}) // duplicate
+
+		points, err := store.GetHistory(ctx, "user1", 0)
+		if err != nil || timeline(points) != "100#1,200#1" {
+			t.Errorf("%s: expected only applied updates, got %s (%v)", name, timeline(points), err)
+		}
+		if len(points) == 2 && (points[0].Time.IsZero() || points[1].Time.Before(points[0].Time)) {
+			t.Errorf("%s: expected increasing times, got %+v", name, points)
+		}
+		if points, _ := store.GetHistory(ctx, "user2", 0); timeline(points) != "150#1" {
+			t.Errorf("%s: expected the rank at the time of the update, got %s", name, timeline(points))
+		}
+
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 300})
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 400})
+		if points, _ := store.GetHistory(ctx, "user1", 0); timeline(points) != "200#1,300#1,400#1" {
+			t.Errorf("%s: expected the latest 3 points, got %s", name, timeline(points))
+		}
+		if points, _ := store.GetHistory(ctx, "user1", 2); timeline(points) != "300#1,400#1" {
+			t.Errorf("%s: expected the latest 2 points, got %s", name, timeline(points))
+		}
+		if points, err := store.GetHistory(ctx, "nobody", 0); err != nil || len(points) != 0 {
+			t.Errorf("%s: expected no history for an unknown user, got %v (%v)", name, points, err)
+		}
+	}
+}
+
+func TestScoreHistoryRing(t *testing.T) {
+	var history scoreHistory
+	for i := 1; i <= 5; i++ {
+		history.add(HistoryPoint{Score: i}, 3)
+	}
+	if got := timeline(history.latest(0)); got != "3#0,4#0,5#0" {
+		t.Errorf("Expected the newest 3 points, got %s", got)
+	}
+
+	// A lower length keeps the newest points.
+	history.add(HistoryPoint{Score: 6}, 2)
+	if got := timeline(history.latest(0)); got != "5#0,6#0" {
+		t.Errorf("Expected the newest 2 points, got %s", got)
+	}
+}
+
+func TestBoundedBoardForgetsEvictedHistory(t *testing.T) {
+	lb := NewBoundedLeaderboard(CapacityOptions{MaxSize: 2})
+	for i := 1; i <= 3; i++ {
+		lb.ApplyScore(ScoreUpdate{UserID: fmt.Sprintf("u%d", i), Score: 100 * i})
+	}
+	if points := lb.GetHistory("u1", 0); len(points) != 0 {
+		t.Errorf("Expected the evicted player's history to be dropped, got %v", points)
+	}
+	lb.ApplyScore(ScoreUpdate{UserID: "u4", Score: 1})
+	if len(lb.history) != 2 {
+		t.Errorf("Expected history only for retained players, got %d", len(lb.history))
+	}
+}
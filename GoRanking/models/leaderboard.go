@@ -1,68 +1,189 @@
 package models
 
-import (
-	"sort"
-	"sync"
-)
+import "sync"
 
 type Leaderboard struct {
 	sync.RWMutex
-	scores     map[string]*PlayerScore
-	sortedKeys []string
+	scores  map[string]*PlayerScore
+	ranking *skipList
+
+	policy      ScorePolicy
+	idempotency *idempotencyCache
+
+	history       map[string]*scoreHistory
+	historyLength int
+
+	// Bounded boards keep only the top maxSize players; evicted players live on
+	// as a score histogram plus a bounded user->score table.
+	maxSize int
+	evicted *scoreSketch
+	users   *userScoreTable
+}
+
+// CapacityOptions configures a bounded leaderboard.
+type CapacityOptions struct {
+	MaxSize     int     // players kept exactly; 0 means unbounded
+	Accuracy    float64 // relative error of evicted score buckets, DefaultSketchAccuracy if 0
+	SketchSlots int     // evicted users whose score is remembered, DefaultSketchSlots if 0
+}
+
+// RankEstimate is a user's rank; Approximate is set when it was derived from
+// the sketch of evicted players.
+type RankEstimate struct {
+	Rank        int  `json:"rank"`
+	Score       int  `json:"score"`
+	Approximate bool `json:"approximate"`
 }
 
 func NewLeaderboard() *Leaderboard {
 	return &Leaderboard{
-		scores:     make(map[string]*PlayerScore),
-		sortedKeys: make([]string, 0),
+		scores:      make(map[string]*PlayerScore),
+		ranking:     newSkipList(),
+		idempotency: newIdempotencyCache(DefaultIdempotencyKeys),
+
+		history:       make(map[string]*scoreHistory),
+		historyLength: DefaultHistoryLength,
 	}
 }
 
+// NewBoundedLeaderboard creates a leaderboard that keeps at most opts.MaxSize
+// players exactly and answers ranks of evicted players approximately.
+func NewBoundedLeaderboard(opts CapacityOptions) *Leaderboard {
+	lb := NewLeaderboard()
+	if opts.MaxSize <= 0 {
+		return lb
+	}
+	if opts.Accuracy <= 0 || opts.Accuracy >= 1 {
+		opts.Accuracy = DefaultSketchAccuracy
+	}
+	lb.maxSize = opts.MaxSize
+	lb.evicted = newScoreSketch(opts.Accuracy)
+	lb.users = newUserScoreTable(opts.SketchSlots)
+	return lb
+}
+
 func (lb *Leaderboard) UpdateScore(userID, username string, score int) {
 	lb.Lock()
 	defer lb.Unlock()
+	lb.updateLocked(userID, username, score)
+}
 
+func (lb *Leaderboard) updateLocked(userID, username string, score int) {
 	if player, exists := lb.scores[userID]; exists {
+		lb.ranking.remove(player)
 		player.UpdateScore(score)
+		lb.ranking.insert(player)
 	} else {
-		lb.scores[userID] = NewPlayerScore(userID, username, score)
+		if lb.maxSize > 0 {
+			// A previously evicted player competes for a slot again.
+			if old, ok := lb.users.get(userID); ok {
+				lb.evicted.remove(old)
+				lb.users.remove(userID)
+			}
+		}
+		player := NewPlayerScore(userID, username, score)
+		lb.scores[userID] = player
+		lb.ranking.insert(player)
 	}
 
-	lb.resort()
+	lb.evict()
 }
 
-func (lb *Leaderboard) resort() {
-	players := make([]*PlayerScore, 0, len(lb.scores))
-	for _, player := range lb.scores {
-		players = append(players, player)
+// evict moves players beyond maxSize from the bottom of the board into the sketch.
+func (lb *Leaderboard) evict() {
+	if lb.maxSize <= 0 {
+		return
 	}
-
-	sort.Slice(players, func(i, j int) bool {
-		if players[i].Score == players[j].Score {
-			return players[i].UpdatedAt.Before(players[j].UpdatedAt)
+	for lb.ranking.length > lb.maxSize {
+		player := lb.ranking.at(lb.ranking.length).player
+		lb.ranking.remove(player)
+		lb.evicted.add(player.Score)
+		// A forgotten user could never be removed when they climb back, so
+		// they leave the sketch along with their slot.
+		if replaced, ok := lb.users.put(player.UserID, player.Score); ok {
+			lb.evicted.remove(replaced)
 		}
-		return players[i].Score > players[j].Score
-	})
+		delete(lb.scores, player.UserID)
+		delete(lb.history, player.UserID)
+	}
+}
+
+// evictedAbove returns a function counting evicted players with a strictly
+// higher score bucket, or nil when nobody was evicted. Retained players whose
+// score fell below evicted players are pushed down by that many places, so the
+// top of the board stays exact.
+func (lb *Leaderboard) evictedAbove() func(int) int {
+	if lb.evicted != nil && lb.evicted.total > 0 {
+		return lb.evicted.aboveCounter(false)
+	}
+	return nil
+}
 
-	lb.sortedKeys = make([]string, len(players))
-	for i, player := range players {
-		player.Rank = i + 1
-		lb.sortedKeys[i] = player.UserID
+// snapshot copies a retained player with its rank, so callers can use it
+// after the lock is released.
+func snapshot(player *PlayerScore, position int, above func(int) int) *PlayerScore {
+	result := *player
+	result.Rank = position
+	if above != nil {
+		result.Rank += above(player.Score)
 	}
+	return &result
 }
 
+// GetTopN returns copies of the first n players in O(log n + n).
 func (lb *Leaderboard) GetTopN(n int) []*PlayerScore {
 	lb.RLock()
 	defer lb.RUnlock()
 
-	if n > len(lb.sortedKeys) {
-		n = len(lb.sortedKeys)
+	return lb.rangeLocked(1, n)
+}
+
+// GetRange returns copies of up to limit players after the first offset, for
+// paging through the board, in O(log n + limit).
+func (lb *Leaderboard) GetRange(offset, limit int) []*PlayerScore {
+	lb.RLock()
+	defer lb.RUnlock()
+
+	return lb.rangeLocked(offset+1, offset+limit)
+}
+
+// GetAroundUser returns the user with up to k players directly above and
+// below. Evicted players of a bounded board have no exact neighbors, so
+// exists is false for them as for unknown users.
+func (lb *Leaderboard) GetAroundUser(userID string, k int) ([]*PlayerScore, bool) {
+	lb.RLock()
+	defer lb.RUnlock()
+
+	player, exists := lb.scores[userID]
+	if !exists {
+		return nil, false
+	}
+	if k < 0 {
+		k = 0
+	}
+	position := lb.ranking.position(player)
+	return lb.rangeLocked(position-k, position+k), true
+}
+
+// rangeLocked returns copies of the players at positions first..last, clipped
+// to the board.
+func (lb *Leaderboard) rangeLocked(first, last int) []*PlayerScore {
+	if first < 1 {
+		first = 1
+	}
+	if last > lb.ranking.length {
+		last = lb.ranking.length
+	}
+	if first > last {
+		return []*PlayerScore{}
 	}
 
-	result := make([]*PlayerScore, n)
-	for i := 0; i < n; i++ {
-		userID := lb.sortedKeys[i]
-		result[i] = lb.scores[userID]
+	above := lb.evictedAbove()
+	result := make([]*PlayerScore, 0, last-first+1)
+	node := lb.ranking.at(first)
+	for position := first; position <= last; position++ {
+		result = append(result, snapshot(node.player, position, above))
+		node = node.next[0].node
 	}
 	return result
 }
@@ -71,9 +192,60 @@ func (lb *Leaderboard) GetUserRank(userID string) (int, bool) {
 	lb.RLock()
 	defer lb.RUnlock()
 
-	player, exists := lb.scores[userID]
+	estimate, exists := lb.rankLocked(userID)
+	return estimate.Rank, exists
+}
+
+// GetUserRankEstimate is GetUserRank that also reports whether the rank is approximate.
+func (lb *Leaderboard) GetUserRankEstimate(userID string) (RankEstimate, bool) {
+	lb.RLock()
+	defer lb.RUnlock()
+
+	return lb.rankLocked(userID)
+}
+
+func (lb *Leaderboard) rankLocked(userID string) (RankEstimate, bool) {
+	if player, exists := lb.scores[userID]; exists {
+		position := lb.ranking.position(player)
+		rank := position
+		if above := lb.evictedAbove(); above != nil {
+			rank += above(player.Score)
+		}
+		return RankEstimate{Rank: rank, Score: player.Score, Approximate: rank != position}, true
+	}
+	if lb.maxSize <= 0 {
+		return RankEstimate{}, false
+	}
+	score, exists := lb.users.get(userID)
 	if !exists {
-		return 0, false
+		return RankEstimate{}, false
+	}
+
+	// The zero time ranks before every player with the same score, so this
+	// counts retained players with a strictly higher score.
+	retainedAbove := lb.ranking.countBefore(rankKey{score: score})
+	return RankEstimate{
+		Rank:        retainedAbove + lb.evicted.aboveCounter(true)(score) + 1,
+		Score:       score,
+		Approximate: true,
+	}, true
+}
+
+// Size returns the number of players kept exactly.
+func (lb *Leaderboard) Size() int {
+	lb.RLock()
+	defer lb.RUnlock()
+	return len(lb.scores)
+}
+
+// TotalPlayers returns retained plus evicted players.
+func (lb *Leaderboard) TotalPlayers() int {
+	lb.RLock()
+	defer lb.RUnlock()
+
+	total := len(lb.scores)
+	if lb.evicted != nil {
+		total += lb.evicted.total
 	}
-	return player.Rank, true
+	return total
 }
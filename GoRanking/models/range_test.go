@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func userIDs(players []*PlayerScore) string {
+	ids := ""
+	for i, player := range players {
+		if i > 0 {
+			ids += ","
+		}
+		ids += fmt.Sprintf("%s#%d", player.UserID, player.Rank)
+	}
+	return ids
+}
+
+func TestGetRangeAndAroundUser(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t, ScorePolicy{}) {
+		for i := 1; i <= 10; i++ {
+			store.ApplyScore(ctx, ScoreUpdate{UserID: fmt.Sprintf("u%d", i), Username: fmt.Sprintf("User %d", i), Score: 1000 - i*10})
+		}
+
+		cases := []struct {
+			offset, limit int
+			want          string
+		}{
+			{0, 3, "u1#1,u2#2,u3#3"},
+			{8, 5, "u9#9,u10#10"},
+			{10, 5, ""},
+			{2, 0, ""},
+		}
+		for _, c := range cases {
+			players, err := store.GetRange(ctx, c.offset, c.limit)
+			if err != nil || userIDs(players) != c.want {
+				t.Errorf("%s: GetRange(%d, %d) = %s (%v), expected %s", name, c.offset, c.limit, userIDs(players), err, c.want)
+			}
+		}
+		if page, _ := store.GetRange(ctx, 3, 1); page[0].Username != "User 4" || page[0].Score != 960 {
+			t.Errorf("%s: expected full player data, got %+v", name, page[0])
+		}
+
+		around := []struct {
+			userID string
+			k      int
+			want   string
+		}{
+			{"u5", 2, "u3#3,u4#4,u5#5,u6#6,u7#7"},
+			{"u1", 2, "u1#1,u2#2,u3#3"},
+			{"u10", 1, "u9#9,u10#10"},
+			{"u4", 0, "u4#4"},
+		}
+		for _, c := range around {
+			players, exists, err := store.GetAroundUser(ctx, c.userID, c.k)
+			if err != nil || !exists || userIDs(players) != c.want {
+				t.Errorf("%s: GetAroundUser(%s, %d) = %s (%v), expected %s", name, c.userID, c.k, userIDs(players), err, c.want)
+			}
+		}
+		if _, exists, err := store.GetAroundUser(ctx, "nobody", 3); exists || err != nil {
+			t.Errorf("%s: unknown user should not exist (%v)", name, err)
+		}
+	}
+}
+
+func TestGetAroundUserOnBoundedBoard(t *testing.T) {
+	lb := NewBoundedLeaderboard(CapacityOptions{MaxSize: 3})
+	for i := 1; i <= 5; i++ {
+		lb.UpdateScore(fmt.Sprintf("u%d", i), "", 100-i)
+	}
+
+	if players, exists := lb.GetAroundUser("u3", 5); !exists || userIDs(players) != "u1#1,u2#2,u3#3" {
+		t.Errorf("Expected neighbors among retained players, got %s", userIDs(players))
+	}
+	if _, exists := lb.GetAroundUser("u5", 1); exists {
+		t.Error("Evicted players should have no exact neighbors")
+	}
+}
@@ -0,0 +1,365 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps a board in Redis:
+//
+//	ranking:{board}:scores   ZSET  member -> score
+//	ranking:{board}:members  HASH  user ID -> current member
+//	ranking:{board}:names    HASH  user ID -> username
+//	ranking:{board}:history:<user ID>  LIST  "<unix ms> <score> <rank>", newest last
+//	ranking:{board}:idempotency:<user ID>:<key>  STRING  first result, expires after the TTL
+//
+// A member is "<inverted update time>:<user ID>". Redis orders equal scores by
+// member, so with ZREVRANK the earliest update ranks first, as in Leaderboard.
+// The hash tag keeps all keys of a board in one Redis Cluster slot.
+type RedisStore struct {
+	client   redis.UniversalClient
+	prefix   string
+	instance string
+	policy   ScorePolicy
+	history  int
+}
+
+// RedisUpdate is published on the board's update channel after every score
+// change, so every instance can refresh its WebSocket clients.
+type RedisUpdate struct {
+	Instance string `json:"instance"`
+	UserID   string `json:"user_id"`
+}
+
+// memberTimeDigits is the width of the inverted update time in a member.
+const memberTimeDigits = 16
+
+// updateScript applies a ScoreUpdate in one atomic step: it answers retries
+// from the idempotency key (KEYS[5], optional), applies the delta and the
+// no-decrease policy, replaces the user's member, stores the name, appends to
+// the user's history (KEYS[4]) and publishes the update. It returns
+// {0-based rank, score, applied, duplicate}.
+var updateScript = redis.NewScript(`
+if #KEYS > 4 then
+	local seen = redis.call('GET', KEYS[5])
+	if seen then
+		local rank, score, applied = string.match(seen, '^(%d+) (%-?%d+) (%d)$')
+		return {tonumber(rank), score, tonumber(applied), 1}
+	end
+end
+
+local old = redis.call('HGET', KEYS[2], ARGV[1])
+local current = nil
+if old then
+	current = tonumber(redis.call('ZSCORE', KEYS[1], old))
+end
+local score = tonumber(ARGV[2])
+if ARGV[7] == '1' and current then
+	score = score + current
+end
+
+local member = ARGV[3]
+local applied = 1
+if ARGV[8] == '1' and current and score < current then
+	applied = 0
+	member = old
+	score = current
+else
+	if old then
+		redis.call('ZREM', KEYS[1], old)
+	end
+	redis.call('ZADD', KEYS[1], score, member)
+	redis.call('HSET', KEYS[2], ARGV[1], member)
+	redis.call('HSET', KEYS[3], ARGV[1], ARGV[4])
+	redis.call('PUBLISH', ARGV[5], ARGV[6])
+end
+
+local rank = redis.call('ZREVRANK', KEYS[1], member)
+local scoreText = string.format('%d', score)
+local historyLength = tonumber(ARGV[10])
+if applied == 1 and historyLength > 0 then
+	redis.call('RPUSH', KEYS[4], ARGV[11] .. ' ' .. scoreText .. ' ' .. (rank + 1))
+	redis.call('LTRIM', KEYS[4], -historyLength, -1)
+end
+if #KEYS > 4 then
+	redis.call('SET', KEYS[5], rank .. ' ' .. scoreText .. ' ' .. applied, 'PX', ARGV[9])
+end
+return {rank, scoreText, applied, 0}
+`)
+
+// rankScript returns {0-based rank, score} or nil for an unknown user.
+var rankScript = redis.NewScript(`
+local member = redis.call('HGET', KEYS[2], ARGV[1])
+if not member then
+	return false
+end
+return {redis.call('ZREVRANK', KEYS[1], member), redis.call('ZSCORE', KEYS[1], member)}
+`)
+
+// aroundScript returns {first 0-based rank, members and scores} of the user
+// and up to ARGV[2] neighbors on each side, or nil for an unknown user.
+var aroundScript = redis.NewScript(`
+local member = redis.call('HGET', KEYS[2], ARGV[1])
+if not member then
+	return false
+end
+local rank = redis.call('ZREVRANK', KEYS[1], member)
+local k = tonumber(ARGV[2])
+local first = math.max(rank - k, 0)
+return {first, redis.call('ZREVRANGE', KEYS[1], first, rank + k, 'WITHSCORES')}
+`)
+
+func NewRedisStore(client redis.UniversalClient, board string) *RedisStore {
+	instance := make([]byte, 8)
+	rand.Read(instance)
+	return &RedisStore{
+		client:   client,
+		prefix:   "ranking:{" + board + "}:",
+		instance: hex.EncodeToString(instance),
+		history:  DefaultHistoryLength,
+	}
+}
+
+func (s *RedisStore) keys() []string {
+	return []string{s.prefix + "scores", s.prefix + "members", s.prefix + "names"}
+}
+
+func (s *RedisStore) channel() string {
+	return s.prefix + "updates"
+}
+
+// SetPolicy sets the board's score policy for updates through this store.
+// Every instance serving the board should use the same policy.
+func (s *RedisStore) SetPolicy(policy ScorePolicy) {
+	s.policy = policy
+}
+
+// SetHistoryLength sets how many timeline points are kept per user; 0 stops
+// recording.
+func (s *RedisStore) SetHistoryLength(length int) {
+	s.history = length
+}
+
+func (s *RedisStore) historyKey(userID string) string {
+	return s.prefix + "history:" + userID
+}
+
+func (s *RedisStore) ApplyScore(ctx context.Context, update ScoreUpdate) (ScoreResult, error) {
+	now := time.Now()
+	keys := append(s.keys(), s.historyKey(update.UserID))
+	if update.IdempotencyKey != "" {
+		keys = append(keys, s.prefix+"idempotency:"+update.UserID+":"+update.IdempotencyKey)
+	}
+	notification, _ := json.Marshal(RedisUpdate{Instance: s.instance, UserID: update.UserID})
+	values, err := updateScript.Run(ctx, s.client, keys,
+		update.UserID, update.Score, encodeMember(update.UserID, now), update.Username,
+		s.channel(), notification, redisFlag(update.Delta), redisFlag(s.policy.NoDecrease),
+		s.policy.idempotencyTTL().Milliseconds(), max(s.history, 0), now.UnixMilli()).Slice()
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	if len(values) != 4 {
+		return ScoreResult{}, fmt.Errorf("unexpected update result %v", values)
+	}
+
+	rank, _ := values[0].(int64)
+	score, err := strconv.Atoi(fmt.Sprint(values[1]))
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	applied, _ := values[2].(int64)
+	duplicate, _ := values[3].(int64)
+	return ScoreResult{
+		RankEstimate: RankEstimate{Rank: int(rank) + 1, Score: score},
+		Applied:      applied == 1,
+		Duplicate:    duplicate == 1,
+	}, nil
+}
+
+func redisFlag(set bool) string {
+	if set {
+		return "1"
+	}
+	return "0"
+}
+
+func (s *RedisStore) GetTopN(ctx context.Context, n int) ([]*PlayerScore, error) {
+	return s.GetRange(ctx, 0, n)
+}
+
+func (s *RedisStore) GetRange(ctx context.Context, offset, limit int) ([]*PlayerScore, error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		return []*PlayerScore{}, nil
+	}
+	entries, err := s.client.ZRevRangeWithScores(ctx, s.prefix+"scores", int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	members := make([]string, len(entries))
+	scores := make([]float64, len(entries))
+	for i, entry := range entries {
+		members[i] = entry.Member.(string)
+		scores[i] = entry.Score
+	}
+	return s.players(ctx, offset+1, members, scores)
+}
+
+func (s *RedisStore) GetAroundUser(ctx context.Context, userID string, k int) ([]*PlayerScore, bool, error) {
+	if k < 0 {
+		k = 0
+	}
+	values, err := aroundScript.Run(ctx, s.client, s.keys(), userID, k).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	first, _ := values[0].(int64)
+	flat, _ := values[1].([]interface{})
+	members := make([]string, 0, len(flat)/2)
+	scores := make([]float64, 0, len(flat)/2)
+	for i := 0; i+1 < len(flat); i += 2 {
+		score, err := strconv.ParseFloat(fmt.Sprint(flat[i+1]), 64)
+		if err != nil {
+			return nil, false, err
+		}
+		members = append(members, fmt.Sprint(flat[i]))
+		scores = append(scores, score)
+	}
+	players, err := s.players(ctx, int(first)+1, members, scores)
+	return players, err == nil, err
+}
+
+// players builds the players ranked from firstRank on and fills in their names.
+func (s *RedisStore) players(ctx context.Context, firstRank int, members []string, scores []float64) ([]*PlayerScore, error) {
+	players := make([]*PlayerScore, len(members))
+	if len(members) == 0 {
+		return players, nil
+	}
+
+	userIDs := make([]string, len(members))
+	for i, member := range members {
+		userID, updatedAt, err := decodeMember(member)
+		if err != nil {
+			return nil, err
+		}
+		userIDs[i] = userID
+		players[i] = &PlayerScore{UserID: userID, Score: int(scores[i]), Rank: firstRank + i, UpdatedAt: updatedAt}
+	}
+	names, err := s.client.HMGet(ctx, s.prefix+"names", userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if name, ok := name.(string); ok {
+			players[i].Username = name
+		}
+	}
+	return players, nil
+}
+
+func (s *RedisStore) GetUserRank(ctx context.Context, userID string) (RankEstimate, bool, error) {
+	values, err := rankScript.Run(ctx, s.client, s.keys(), userID).Slice()
+	if errors.Is(err, redis.Nil) {
+		return RankEstimate{}, false, nil
+	}
+	if err != nil {
+		return RankEstimate{}, false, err
+	}
+	rank, _ := values[0].(int64)
+	score, err := strconv.ParseFloat(fmt.Sprint(values[1]), 64)
+	if err != nil {
+		return RankEstimate{}, false, err
+	}
+	return RankEstimate{Rank: int(rank) + 1, Score: int(score)}, true, nil
+}
+
+func (s *RedisStore) GetHistory(ctx context.Context, userID string, limit int) ([]HistoryPoint, error) {
+	start := int64(0)
+	if limit > 0 {
+		start = int64(-limit)
+	}
+	entries, err := s.client.LRange(ctx, s.historyKey(userID), start, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	points := make([]HistoryPoint, 0, len(entries))
+	for _, entry := range entries {
+		var millis int64
+		var point HistoryPoint
+		if _, err := fmt.Sscanf(entry, "%d %d %d", &millis, &point.Score, &point.Rank); err != nil {
+			return nil, fmt.Errorf("invalid history entry %q", entry)
+		}
+		point.Time = time.UnixMilli(millis)
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+func (s *RedisStore) TotalPlayers(ctx context.Context) (int, error) {
+	total, err := s.client.ZCard(ctx, s.prefix+"scores").Result()
+	return int(total), err
+}
+
+// Subscribe calls onUpdate for every score change made by other instances
+// until ctx is done. Changes made through this store are left to the caller,
+// which already knows about them.
+func (s *RedisStore) Subscribe(ctx context.Context, onUpdate func(userID string)) error {
+	pubsub := s.client.Subscribe(ctx, s.channel())
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case message, ok := <-messages:
+			if !ok {
+				return errors.New("redis subscription closed")
+			}
+			var update RedisUpdate
+			if err := json.Unmarshal([]byte(message.Payload), &update); err != nil {
+				log.Printf("Invalid leaderboard update %q: %v", message.Payload, err)
+				continue
+			}
+			if update.Instance != s.instance {
+				onUpdate(update.UserID)
+			}
+		}
+	}
+}
+
+// encodeMember builds a member whose lexical order is the reverse of the
+// update time, so earlier updates sort higher among equal scores.
+func encodeMember(userID string, updatedAt time.Time) string {
+	inverted := math.MaxInt64 - updatedAt.UnixNano()
+	return fmt.Sprintf("%0*x:%s", memberTimeDigits, inverted, userID)
+}
+
+func decodeMember(member string) (string, time.Time, error) {
+	if len(member) <= memberTimeDigits || member[memberTimeDigits] != ':' {
+		return "", time.Time{}, fmt.Errorf("invalid leaderboard member %q", member)
+	}
+	inverted, err := strconv.ParseInt(member[:memberTimeDigits], 16, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid leaderboard member %q", member)
+	}
+	return member[memberTimeDigits+1:], time.Unix(0, math.MaxInt64-inverted), nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedisStore(t *testing.T, server *miniredis.Miniredis) *RedisStore {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client, "global")
+}
+
+func TestRedisStoreMatchesMemoryStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx := context.Background()
+	stores := map[string]Store{
+		"memory": NewMemoryStore(NewLeaderboard()),
+		"redis":  newTestRedisStore(t, server),
+	}
+
+	for name, store := range stores {
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100})
+		time.Sleep(time.Millisecond)
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user2", Username: "Bob", Score: 300})
+		time.Sleep(time.Millisecond)
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user3", Username: "Charlie", Score: 100}) // ties with Alice, updated later
+		time.Sleep(time.Millisecond)
+		rank, err := store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 200})
+		if err != nil || rank.Rank != 2 || rank.Score != 200 {
+			t.Errorf("%s: expected Alice to move to rank 2, got %+v (%v)", name, rank, err)
+		}
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user4", Username: "Dave", Score: 200}) // ties with Alice, updated later
+
+		top, err := store.GetTopN(ctx, 10)
+		if err != nil || len(top) != 4 {
+			t.Fatalf("%s: expected 4 players, got %d (%v)", name, len(top), err)
+		}
+		for i, want := range []string{"user2", "user1", "user4", "user3"} {
+			if top[i].UserID != want || top[i].Rank != i+1 {
+				t.Errorf("%s: position %d: expected %s, got %s rank %d", name, i, want, top[i].UserID, top[i].Rank)
+			}
+		}
+		if top[1].Username != "Alice" || top[1].Score != 200 || top[1].UpdatedAt.IsZero() {
+			t.Errorf("%s: unexpected player %+v", name, top[1])
+		}
+
+		if rank, exists, err := store.GetUserRank(ctx, "user3"); err != nil || !exists || rank.Rank != 4 || rank.Score != 100 {
+			t.Errorf("%s: expected Charlie at rank 4, got %+v exists=%v (%v)", name, rank, exists, err)
+		}
+		if _, exists, err := store.GetUserRank(ctx, "nobody"); err != nil || exists {
+			t.Errorf("%s: unknown user should not exist (%v)", name, err)
+		}
+		if total, err := store.TotalPlayers(ctx); err != nil || total != 4 {
+			t.Errorf("%s: expected 4 players, got %d (%v)", name, total, err)
+		}
+	}
+}
+
+func TestRedisStoreSurvivesRestart(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx := context.Background()
+
+	first := newTestRedisStore(t, server)
+	first.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100})
+	first.ApplyScore(ctx, ScoreUpdate{UserID: "user2", Username: "Bob", Score: 200})
+
+	// A new process, or another instance, sees the same board.
+	second := newTestRedisStore(t, server)
+	if rank, exists, err := second.GetUserRank(ctx, "user1"); err != nil || !exists || rank.Rank != 2 {
+		t.Errorf("Expected Alice at rank 2 after restart, got %+v exists=%v (%v)", rank, exists, err)
+	}
+	second.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 500})
+	if top, _ := first.GetTopN(ctx, 1); len(top) != 1 || top[0].UserID != "user1" {
+		t.Errorf("Expected instances to share updates, got %+v", top)
+	}
+	if total, _ := first.TotalPlayers(ctx); total != 2 {
+		t.Errorf("Updating an existing player should not add a member, got %d players", total)
+	}
+}
+
+func TestRedisStoreSubscribe(t *testing.T) {
+	server := miniredis.RunT(t)
+	local := newTestRedisStore(t, server)
+	remote := newTestRedisStore(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- local.Subscribe(ctx, func(userID string) { updates <- userID })
+	}()
+
+	// Wait until the subscription is active before publishing.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.PubSubChannels("")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	local.ApplyScore(ctx, ScoreUpdate{UserID: "own", Username: "Own", Score: 10})
+	remote.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100})
+	select {
+	case userID := <-updates:
+		if userID != "user1" {
+			t.Errorf("Expected only the other instance's update, got %s", userID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an update from the other instance")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected Subscribe to stop with the context, got %v", err)
+	}
+}
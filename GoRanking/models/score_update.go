@@ -0,0 +1,152 @@
+package models
+
+import "time"
+
+const (
+	// DefaultIdempotencyTTL is how long an idempotency key protects against retries.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyKeys bounds the keys remembered by an in-memory board.
+	DefaultIdempotencyKeys = 100000
+)
+
+// ScoreUpdate is one score submission.
+type ScoreUpdate struct {
+	UserID   string
+	Username string
+	Score    int  // new score, or the amount to add when Delta is set
+	Delta    bool // add Score to the current score (0 for a new player)
+
+	// IdempotencyKey, if set, makes retries of the same submission by the
+	// same user return the first result instead of applying it again.
+	IdempotencyKey string
+}
+
+// ScoreResult is the outcome of a ScoreUpdate. Rank and Score describe the
+// player after the update, or the current state if it was not applied.
+type ScoreResult struct {
+	RankEstimate
+	Applied   bool `json:"applied"`   // false if the board policy rejected the change
+	Duplicate bool `json:"duplicate"` // a retry answered from the idempotency key
+}
+
+// ScorePolicy is the per-board rule for accepting score changes.
+type ScorePolicy struct {
+	// NoDecrease keeps each player's best score: updates that would lower an
+	// existing score, including negative deltas, are not applied.
+	NoDecrease bool
+	// IdempotencyTTL is how long idempotency keys are kept, DefaultIdempotencyTTL if 0.
+	IdempotencyTTL time.Duration
+}
+
+func (p ScorePolicy) idempotencyTTL() time.Duration {
+	if p.IdempotencyTTL <= 0 {
+		return DefaultIdempotencyTTL
+	}
+	return p.IdempotencyTTL
+}
+
+// SetPolicy replaces the board's score policy.
+func (lb *Leaderboard) SetPolicy(policy ScorePolicy) {
+	lb.Lock()
+	defer lb.Unlock()
+	lb.policy = policy
+}
+
+// ApplyScore applies an absolute or incremental update under the board's
+// policy and idempotency keys, and returns the resulting rank.
+func (lb *Leaderboard) ApplyScore(update ScoreUpdate) ScoreResult {
+	lb.Lock()
+	defer lb.Unlock()
+
+	now := time.Now()
+	if update.IdempotencyKey != "" {
+		if result, ok := lb.idempotency.get(update.UserID, update.IdempotencyKey, now); ok {
+			result.Duplicate = true
+			return result
+		}
+	}
+
+	current, exists := lb.currentScoreLocked(update.UserID)
+	score := update.Score
+	if update.Delta {
+		score += current
+	}
+	result := ScoreResult{Applied: !(lb.policy.NoDecrease && exists && score < current)}
+	if result.Applied {
+		lb.updateLocked(update.UserID, update.Username, score)
+	}
+	result.RankEstimate, _ = lb.rankLocked(update.UserID)
+	if result.Applied {
+		lb.recordLocked(update.UserID, result.RankEstimate, now)
+	}
+
+	if update.IdempotencyKey != "" {
+		lb.idempotency.put(update.UserID, update.IdempotencyKey, result, now, lb.policy.idempotencyTTL())
+	}
+	return result
+}
+
+// currentScoreLocked returns the score of a retained or evicted player.
+func (lb *Leaderboard) currentScoreLocked(userID string) (int, bool) {
+	if player, exists := lb.scores[userID]; exists {
+		return player.Score, true
+	}
+	if lb.maxSize > 0 {
+		return lb.users.get(userID)
+	}
+	return 0, false
+}
+
+type idempotentResult struct {
+	result  ScoreResult
+	expires time.Time
+}
+
+type idempotencyEntry struct {
+	id      string
+	expires time.Time
+}
+
+// idempotencyCache remembers results by user and key until they expire. Keys
+// are dropped in insertion order, which is also expiry order for a fixed TTL;
+// beyond the capacity the oldest keys are dropped early.
+type idempotencyCache struct {
+	capacity int
+	results  map[string]idempotentResult
+	order    []idempotencyEntry
+}
+
+func newIdempotencyCache(capacity int) *idempotencyCache {
+	if capacity <= 0 {
+		capacity = DefaultIdempotencyKeys
+	}
+	return &idempotencyCache{capacity: capacity, results: make(map[string]idempotentResult)}
+}
+
+func idempotencyID(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+func (c *idempotencyCache) get(userID, key string, now time.Time) (ScoreResult, bool) {
+	entry, exists := c.results[idempotencyID(userID, key)]
+	if !exists || !now.Before(entry.expires) {
+		return ScoreResult{}, false
+	}
+	return entry.result, true
+}
+
+func (c *idempotencyCache) put(userID, key string, result ScoreResult, now time.Time, ttl time.Duration) {
+	expires := now.Add(ttl)
+	for len(c.order) > 0 && (len(c.order) >= c.capacity || !now.Before(c.order[0].expires)) {
+		oldest := c.order[0]
+		// A key stored again after expiring has a newer entry later in order.
+		if c.results[oldest.id].expires.Equal(oldest.expires) {
+			delete(c.results, oldest.id)
+		}
+		c.order = c.order[1:]
+	}
+
+	id := idempotencyID(userID, key)
+	c.results[id] = idempotentResult{result: result, expires: expires}
+	c.order = append(c.order, idempotencyEntry{id: id, expires: expires})
+}
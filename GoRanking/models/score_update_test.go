@@ -0,0 +1,97 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testStores returns a memory and a Redis store with the same policy.
+func testStores(t *testing.T, policy ScorePolicy) map[string]Store {
+	t.Helper()
+	leaderboard := NewLeaderboard()
+	leaderboard.SetPolicy(policy)
+	redisStore := newTestRedisStore(t, miniredis.RunT(t))
+	redisStore.SetPolicy(policy)
+	return map[string]Store{"memory": NewMemoryStore(leaderboard), "redis": redisStore}
+}
+
+func TestApplyScoreDeltaAndIdempotency(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t, ScorePolicy{}) {
+		// A delta for a new player starts from 0.
+		result, err := store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 30, Delta: true})
+		if err != nil || !result.Applied || result.Score != 30 || result.Rank != 1 {
+			t.Fatalf("%s: unexpected first delta %+v (%v)", name, result, err)
+		}
+
+		retry := ScoreUpdate{UserID: "user1", Username: "Alice", Score: 20, Delta: true, IdempotencyKey: "req-1"}
+		first, _ := store.ApplyScore(ctx, retry)
+		second, err := store.ApplyScore(ctx, retry)
+		if err != nil || first.Score != 50 || first.Duplicate || !second.Duplicate || second.Score != 50 || !second.Applied {
+			t.Errorf("%s: retry should be answered from the key: %+v then %+v (%v)", name, first, second, err)
+		}
+
+		// Keys are per user, and a new key applies again.
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user2", Username: "Bob", Score: 5, Delta: true, IdempotencyKey: "req-1"})
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: -10, Delta: true, IdempotencyKey: "req-2"})
+		if rank, _, _ := store.GetUserRank(ctx, "user1"); rank.Score != 40 {
+			t.Errorf("%s: expected score 40, got %d", name, rank.Score)
+		}
+		if rank, exists, _ := store.GetUserRank(ctx, "user2"); !exists || rank.Score != 5 {
+			t.Errorf("%s: the same key of another user should apply, got %+v", name, rank)
+		}
+	}
+}
+
+func TestApplyScoreNoDecreasePolicy(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range testStores(t, ScorePolicy{NoDecrease: true}) {
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 100})
+		store.ApplyScore(ctx, ScoreUpdate{UserID: "user2", Username: "Bob", Score: 80})
+
+		lower, err := store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: 50})
+		if err != nil || lower.Applied || lower.Score != 100 || lower.Rank != 1 {
+			t.Errorf("%s: a lower score should be rejected, got %+v (%v)", name, lower, err)
+		}
+		negative, _ := store.ApplyScore(ctx, ScoreUpdate{UserID: "user1", Username: "Alice", Score: -1, Delta: true})
+		if negative.Applied || negative.Score != 100 {
+			t.Errorf("%s: a negative delta should be rejected, got %+v", name, negative)
+		}
+		higher, _ := store.ApplyScore(ctx, ScoreUpdate{UserID: "user2", Username: "Bob", Score: 120})
+		if !higher.Applied || higher.Rank != 1 {
+			t.Errorf("%s: a higher score should apply, got %+v", name, higher)
+		}
+		if top, _ := store.GetTopN(ctx, 2); top[1].UserID != "user1" || top[1].Score != 100 {
+			t.Errorf("%s: expected Alice to keep 100, got %+v", name, top[1])
+		}
+	}
+}
+
+func TestIdempotencyCacheExpiryAndCapacity(t *testing.T) {
+	cache := newIdempotencyCache(2)
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	result := ScoreResult{Applied: true}
+
+	cache.put("user1", "a", result, now, time.Minute)
+	if _, ok := cache.get("user1", "a", now.Add(time.Minute)); ok {
+		t.Error("Expected the key to expire after the TTL")
+	}
+
+	// Stored again after expiring: dropping the old entry keeps the new one.
+	cache.put("user1", "a", result, now.Add(2*time.Minute), time.Minute)
+	if _, ok := cache.get("user1", "a", now.Add(2*time.Minute)); !ok {
+		t.Error("Expected the key stored again to be remembered")
+	}
+
+	cache.put("user1", "b", result, now.Add(2*time.Minute), time.Hour)
+	cache.put("user1", "c", result, now.Add(2*time.Minute), time.Hour)
+	if len(cache.results) != 2 {
+		t.Errorf("Expected at most 2 keys, got %d", len(cache.results))
+	}
+	if _, ok := cache.get("user1", "a", now.Add(2*time.Minute)); ok {
+		t.Error("Expected the oldest key to be dropped beyond the capacity")
+	}
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultSketchAccuracy is the relative error of bucketed evicted scores.
+	DefaultSketchAccuracy = 0.01
+	// DefaultSketchSlots bounds how many evicted users keep an (approximate) score.
+	DefaultSketchSlots = 1 << 20
+)
+
+// scoreSketch is a log-bucketed histogram of scores (in the spirit of DDSketch):
+// every bucket covers scores within a fixed relative error, so memory grows with
+// the logarithm of the score range instead of the number of players.
+type scoreSketch struct {
+	logGamma float64
+	buckets  map[int]int
+	total    int
+}
+
+func newScoreSketch(accuracy float64) *scoreSketch {
+	gamma := (1 + accuracy) / (1 - accuracy)
+	return &scoreSketch{logGamma: math.Log(gamma), buckets: make(map[int]int)}
+}
+
+// key maps a score to its bucket; larger scores never map to smaller keys.
+func (s *scoreSketch) key(score int) int {
+	switch {
+	case score == 0:
+		return 0
+	case score > 0:
+		return 1 + int(math.Ceil(math.Log(float64(score))/s.logGamma))
+	default:
+		return -1 - int(math.Ceil(math.Log(float64(-score))/s.logGamma))
+	}
+}
+
+func (s *scoreSketch) add(score int) {
+	s.buckets[s.key(score)]++
+	s.total++
+}
+
+func (s *scoreSketch) remove(score int) {
+	k := s.key(score)
+	if s.buckets[k] == 0 {
+		return
+	}
+	s.buckets[k]--
+	s.total--
+	if s.buckets[k] == 0 {
+		delete(s.buckets, k)
+	}
+}
+
+// aboveCounter snapshots the histogram and returns a function estimating how
+// many sketched scores are greater than a score. With sameBucketHalf, scores in
+// the same bucket are counted as half above, half below; otherwise not at all.
+func (s *scoreSketch) aboveCounter(sameBucketHalf bool) func(score int) int {
+	keys := make([]int, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	// above[i] is the number of scores in buckets keys[i+1:].
+	above := make([]int, len(keys))
+	for i, sum := len(keys)-1, 0; i >= 0; i-- {
+		above[i] = sum
+		sum += s.buckets[keys[i]]
+	}
+
+	return func(score int) int {
+		k := s.key(score)
+		i := sort.SearchInts(keys, k)
+		switch {
+		case i == len(keys):
+			return 0
+		case keys[i] == k:
+			if !sameBucketHalf {
+				return above[i]
+			}
+			return above[i] + s.buckets[k]/2
+		default:
+			return above[i] + s.buckets[keys[i]]
+		}
+	}
+}
+
+// userSlot remembers one evicted user's score under a hash fingerprint.
+type userSlot struct {
+	fingerprint uint64
+	score       int
+}
+
+// userScoreTable is a fixed-size two-choice hash table of evicted users' scores.
+// When both candidate slots are taken the older entry is overwritten and put
+// returns its score, so the caller can drop the forgotten user from the sketch
+// too; a fingerprint collision can in rare cases return another user's score.
+// Memory stays bounded by the number of slots.
+type userScoreTable struct {
+	slots []userSlot
+}
+
+func newUserScoreTable(size int) *userScoreTable {
+	if size <= 0 {
+		size = DefaultSketchSlots
+	}
+	return &userScoreTable{slots: make([]userSlot, size)}
+}
+
+func (t *userScoreTable) positions(userID string) (uint64, int, int) {
+	h := fnv.New64a()
+	h.Write([]byte(userID))
+	fingerprint := h.Sum64() | 1 // zero marks an empty slot
+	n := uint64(len(t.slots))
+	return fingerprint, int(fingerprint % n), int((fingerprint >> 32) * 0x9E3779B1 % n)
+}
+
+func (t *userScoreTable) get(userID string) (int, bool) {
+	fingerprint, a, b := t.positions(userID)
+	for _, i := range []int{a, b} {
+		if t.slots[i].fingerprint == fingerprint {
+			return t.slots[i].score, true
+		}
+	}
+	return 0, false
+}
+
+// put stores the score, overwriting the first candidate slot when both are
+// taken. It returns the score of the user it replaced, if any, or the user's
+// own previous score.
+func (t *userScoreTable) put(userID string, score int) (replaced int, ok bool) {
+	fingerprint, a, b := t.positions(userID)
+	for _, i := range []int{a, b} {
+		if t.slots[i].fingerprint == fingerprint || t.slots[i].fingerprint == 0 {
+			replaced, ok = t.slots[i].score, t.slots[i].fingerprint != 0
+			t.slots[i] = userSlot{fingerprint: fingerprint, score: score}
+			return replaced, ok
+		}
+	}
+	replaced = t.slots[a].score
+	t.slots[a] = userSlot{fingerprint: fingerprint, score: score}
+	return replaced, true
+}
+
+func (t *userScoreTable) remove(userID string) {
+	fingerprint, a, b := t.positions(userID)
+	for _, i := range []int{a, b} {
+		if t.slots[i].fingerprint == fingerprint {
+			t.slots[i] = userSlot{}
+		}
+	}
+}
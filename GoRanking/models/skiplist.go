@@ -0,0 +1,184 @@
+package models
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	skipListMaxLevel = 32
+	skipListP        = 0.25
+)
+
+// rankKey orders players: higher score first, then the earlier update, then
+// the user ID so that every player has a distinct position.
+type rankKey struct {
+	score     int
+	updatedAt time.Time
+	userID    string
+}
+
+func keyOf(player *PlayerScore) rankKey {
+	return rankKey{score: player.Score, updatedAt: player.UpdatedAt, userID: player.UserID}
+}
+
+func (a rankKey) before(b rankKey) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if !a.updatedAt.Equal(b.updatedAt) {
+		return a.updatedAt.Before(b.updatedAt)
+	}
+	return a.userID < b.userID
+}
+
+// skipLink points to the next node on one level; span is the number of
+// positions it skips, which makes rank lookups O(log n).
+type skipLink struct {
+	node *skipNode
+	span int
+}
+
+type skipNode struct {
+	key    rankKey
+	player *PlayerScore
+	next   []skipLink
+}
+
+// skipList is an indexable skip list of players in rank order (as in Redis
+// sorted sets). Insert, remove, rank and lookup by position are O(log n).
+// A player's key is copied on insert, so remove it before changing its score.
+type skipList struct {
+	head   *skipNode
+	level  int
+	length int
+	rng    *rand.Rand
+}
+
+func newSkipList() *skipList {
+	return &skipList{
+		head:  &skipNode{next: make([]skipLink, skipListMaxLevel)},
+		level: 1,
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (l *skipList) randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && l.rng.Float64() < skipListP {
+		level++
+	}
+	return level
+}
+
+func (l *skipList) insert(player *PlayerScore) {
+	key := keyOf(player)
+	var update [skipListMaxLevel]*skipNode
+	var rank [skipListMaxLevel]int
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		if i < l.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.next[i].node != nil && x.next[i].node.key.before(key) {
+			rank[i] += x.next[i].span
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+
+	level := l.randomLevel()
+	if level > l.level {
+		for i := l.level; i < level; i++ {
+			update[i] = l.head
+			l.head.next[i].span = l.length
+		}
+		l.level = level
+	}
+
+	node := &skipNode{key: key, player: player, next: make([]skipLink, level)}
+	for i := 0; i < level; i++ {
+		node.next[i].node = update[i].next[i].node
+		node.next[i].span = update[i].next[i].span - (rank[0] - rank[i])
+		update[i].next[i] = skipLink{node: node, span: rank[0] - rank[i] + 1}
+	}
+	for i := level; i < l.level; i++ {
+		update[i].next[i].span++
+	}
+	l.length++
+}
+
+// remove deletes the player inserted under its current key.
+func (l *skipList) remove(player *PlayerScore) bool {
+	key := keyOf(player)
+	var update [skipListMaxLevel]*skipNode
+
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.key.before(key) {
+			x = x.next[i].node
+		}
+		update[i] = x
+	}
+	x = x.next[0].node
+	if x == nil || x.key != key {
+		return false
+	}
+
+	for i := 0; i < l.level; i++ {
+		if update[i].next[i].node == x {
+			update[i].next[i].span += x.next[i].span - 1
+			update[i].next[i].node = x.next[i].node
+		} else {
+			update[i].next[i].span--
+		}
+	}
+	for l.level > 1 && l.head.next[l.level-1].node == nil {
+		l.level--
+	}
+	l.length--
+	return true
+}
+
+// countBefore returns how many players rank strictly before key.
+func (l *skipList) countBefore(key rankKey) int {
+	count := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && x.next[i].node.key.before(key) {
+			count += x.next[i].span
+			x = x.next[i].node
+		}
+	}
+	return count
+}
+
+// position returns the 1-based position of the player.
+func (l *skipList) position(player *PlayerScore) int {
+	return l.countBefore(keyOf(player)) + 1
+}
+
+// at returns the node at the 1-based position, or nil if out of range.
+func (l *skipList) at(position int) *skipNode {
+	if position < 1 || position > l.length {
+		return nil
+	}
+	traversed := 0
+	x := l.head
+	for i := l.level - 1; i >= 0; i-- {
+		for x.next[i].node != nil && traversed+x.next[i].span <= position {
+			traversed += x.next[i].span
+			x = x.next[i].node
+		}
+		if traversed == position {
+			return x
+		}
+	}
+	return nil
+}
+
+// first returns the node in first place; follow next[0] for the rest.
+func (l *skipList) first() *skipNode {
+	return l.head.next[0].node
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSkipListMatchesSortedOrder(t *testing.T) {
+	list := newSkipList()
+	players := make(map[string]*PlayerScore)
+	rng := rand.New(rand.NewSource(3))
+	base := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 5000; i++ {
+		userID := fmt.Sprintf("user%d", rng.Intn(500))
+		if player, exists := players[userID]; exists {
+			if !list.remove(player) {
+				t.Fatalf("Failed to remove %s", userID)
+			}
+			if rng.Intn(10) == 0 {
+				delete(players, userID)
+				continue
+			}
+		}
+		// Few distinct scores and times, so the tie-breakers are exercised.
+		player := &PlayerScore{UserID: userID, Score: rng.Intn(50), UpdatedAt: base.Add(time.Duration(rng.Intn(20)) * time.Second)}
+		players[userID] = player
+		list.insert(player)
+	}
+
+	want := make([]*PlayerScore, 0, len(players))
+	for _, player := range players {
+		want = append(want, player)
+	}
+	sort.Slice(want, func(i, j int) bool { return keyOf(want[i]).before(keyOf(want[j])) })
+
+	if list.length != len(want) {
+		t.Fatalf("Expected %d players, got %d", len(want), list.length)
+	}
+	node := list.first()
+	for i, player := range want {
+		if node == nil || node.player != player {
+			t.Fatalf("Position %d: expected %s", i+1, player.UserID)
+		}
+		if got := list.position(player); got != i+1 {
+			t.Errorf("%s: expected position %d, got %d", player.UserID, i+1, got)
+		}
+		if got := list.at(i + 1); got != node {
+			t.Errorf("at(%d) returned the wrong node", i+1)
+		}
+		node = node.next[0].node
+	}
+	if node != nil || list.at(0) != nil || list.at(len(want)+1) != nil {
+		t.Error("Expected nothing outside the list")
+	}
+	if list.remove(&PlayerScore{UserID: "missing"}) {
+		t.Error("Removing an absent player should fail")
+	}
+}
+
+func TestLeaderboardTieBreakAndReturnedCopies(t *testing.T) {
+	lb := NewLeaderboard()
+	lb.UpdateScore("user1", "Alice", 100)
+	time.Sleep(time.Millisecond)
+	lb.UpdateScore("user2", "Bob", 100)
+	time.Sleep(time.Millisecond)
+	lb.UpdateScore("user3", "Charlie", 50)
+	time.Sleep(time.Millisecond)
+	lb.UpdateScore("user3", "Charlie", 100) // reached 100 last
+
+	top := lb.GetTopN(3)
+	for i, want := range []string{"user1", "user2", "user3"} {
+		if top[i].UserID != want || top[i].Rank != i+1 {
+			t.Errorf("Position %d: expected %s, got %s rank %d", i, want, top[i].UserID, top[i].Rank)
+		}
+	}
+
+	// Returned players are snapshots and do not change with the board.
+	lb.UpdateScore("user1", "Alice", 10)
+	if top[0].Score != 100 || top[0].Rank != 1 {
+		t.Errorf("Expected the snapshot to keep score 100 rank 1, got %+v", top[0])
+	}
+	if rank, _ := lb.GetUserRank("user1"); rank != 3 {
+		t.Errorf("Expected Alice to drop to rank 3, got %d", rank)
+	}
+}
+
+const benchmarkPlayers = 1_000_000
+
+var (
+	benchmarkBoard     *Leaderboard
+	benchmarkBoardOnce sync.Once
+)
+
+// millionPlayerBoard builds a board of 1M players once for all benchmarks.
+func millionPlayerBoard() *Leaderboard {
+	benchmarkBoardOnce.Do(func() {
+		benchmarkBoard = NewLeaderboard()
+		rng := rand.New(rand.NewSource(4))
+		for i := 0; i < benchmarkPlayers; i++ {
+			userID := fmt.Sprintf("user%d", i)
+			benchmarkBoard.UpdateScore(userID, userID, rng.Intn(10_000_000))
+		}
+	})
+	return benchmarkBoard
+}
+
+func BenchmarkUpdateScore1M(b *testing.B) {
+	lb := millionPlayerBoard()
+	rng := rand.New(rand.NewSource(5))
+	userIDs := make([]string, 1024)
+	for i := range userIDs {
+		userIDs[i] = fmt.Sprintf("user%d", rng.Intn(benchmarkPlayers))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		userID := userIDs[i%len(userIDs)]
+		lb.UpdateScore(userID, userID, rng.Intn(10_000_000))
+	}
+}
+
+func BenchmarkGetUserRank1M(b *testing.B) {
+	lb := millionPlayerBoard()
+	rng := rand.New(rand.NewSource(6))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lb.GetUserRank(fmt.Sprintf("user%d", rng.Intn(benchmarkPlayers)))
+	}
+}
+
+func BenchmarkGetTopN1M(b *testing.B) {
+	lb := millionPlayerBoard()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lb.GetTopN(100)
+	}
+}
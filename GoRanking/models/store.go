@@ -0,0 +1,65 @@
+package models
+
+import "context"
+
+// Store is the storage behind the API and WebSocket handlers. MemoryStore keeps
+// a single process's Leaderboard; RedisStore keeps scores in Redis so they
+// survive restarts and are shared by every instance.
+type Store interface {
+	// ApplyScore sets or increments the user's score atomically under the
+	// board's ScorePolicy and returns the resulting rank.
+	ApplyScore(ctx context.Context, update ScoreUpdate) (ScoreResult, error)
+	GetTopN(ctx context.Context, n int) ([]*PlayerScore, error)
+	// GetRange returns up to limit players after the first offset.
+	GetRange(ctx context.Context, offset, limit int) ([]*PlayerScore, error)
+	// GetAroundUser returns the user with up to k players above and below.
+	GetAroundUser(ctx context.Context, userID string, k int) ([]*PlayerScore, bool, error)
+	GetUserRank(ctx context.Context, userID string) (RankEstimate, bool, error)
+	// GetHistory returns up to limit of the user's latest timeline points,
+	// oldest first; limit <= 0 returns all that are kept.
+	GetHistory(ctx context.Context, userID string, limit int) ([]HistoryPoint, error)
+	TotalPlayers(ctx context.Context) (int, error)
+}
+
+// MemoryStore adapts an in-memory Leaderboard to Store; it never fails.
+type MemoryStore struct {
+	leaderboard *Leaderboard
+}
+
+func NewMemoryStore(leaderboard *Leaderboard) *MemoryStore {
+	return &MemoryStore{leaderboard: leaderboard}
+}
+
+func (s *MemoryStore) Leaderboard() *Leaderboard {
+	return s.leaderboard
+}
+
+func (s *MemoryStore) ApplyScore(_ context.Context, update ScoreUpdate) (ScoreResult, error) {
+	return s.leaderboard.ApplyScore(update), nil
+}
+
+func (s *MemoryStore) GetTopN(_ context.Context, n int) ([]*PlayerScore, error) {
+	return s.leaderboard.GetTopN(n), nil
+}
+
+func (s *MemoryStore) GetRange(_ context.Context, offset, limit int) ([]*PlayerScore, error) {
+	return s.leaderboard.GetRange(offset, limit), nil
+}
+
+func (s *MemoryStore) GetAroundUser(_ context.Context, userID string, k int) ([]*PlayerScore, bool, error) {
+	players, exists := s.leaderboard.GetAroundUser(userID, k)
+	return players, exists, nil
+}
+
+func (s *MemoryStore) GetUserRank(_ context.Context, userID string) (RankEstimate, bool, error) {
+	estimate, exists := s.leaderboard.GetUserRankEstimate(userID)
+	return estimate, exists, nil
+}
+
+func (s *MemoryStore) GetHistory(_ context.Context, userID string, limit int) ([]HistoryPoint, error) {
+	return s.leaderboard.GetHistory(userID, limit), nil
+}
+
+func (s *MemoryStore) TotalPlayers(_ context.Context) (int, error) {
+	return s.leaderboard.TotalPlayers(), nil
+}
@@ -2,37 +2,237 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+var (
+	ErrSendQueueFull = errors.New("send queue full")
+	ErrNotRegistered = errors.New("connection not registered")
+)
+
+const (
+	// DefaultSendQueue is how many messages may wait for a slow connection
+	// before broadcasts to it are dropped.
+	DefaultSendQueue = 64
+	// DefaultWriteWait bounds a single write; a connection that cannot take
+	// a message in time is closed.
+	DefaultWriteWait = 10 * time.Second
+	// DefaultPongWait is how long a connection may stay silent before it is
+	// closed. Pings are sent every 9/10 of it.
+	DefaultPongWait = 60 * time.Second
+)
+
+// ConnectionOptions tunes how the manager writes to WebSocket connections.
+// Zero fields take the defaults.
+type ConnectionOptions struct {
+	DeltaBuffer int
+	SendQueue   int
+	WriteWait   time.Duration
+	PongWait    time.Duration
+}
+
+// client is a registered connection. Only its writeLoop writes to conn, so a
+// slow connection delays nobody but itself.
+type client struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	// board and seq are the last delta queued at registration; Run skips
+	// broadcasts of that board up to seq, which the client already has.
+	board string
+	seq   uint64
+}
+
+// outgoing is a broadcast waiting for Run. Board messages carry their board
+// and sequence number; other messages have neither.
+type outgoing struct {
+	board   string
+	seq     uint64
+	payload []byte
+}
+
+func (c *client) stop() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// enqueue queues message without blocking and reports whether there was room.
+func (c *client) enqueue(message []byte) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
 type ConnectionManager struct {
 	sync.RWMutex
-	connections map[*websocket.Conn]bool
-	broadcast   chan []byte
+	connections map[*websocket.Conn]*client
+	broadcast   chan outgoing
+	deltas      *DeltaBuffer
+	sequencing  sync.Mutex
+	options     ConnectionOptions
+	dropped     atomic.Uint64
 }
 
 func NewConnectionManager() *ConnectionManager {
+	return NewConnectionManagerWithOptions(ConnectionOptions{})
+}
+
+// NewConnectionManagerWithBuffer keeps up to bufferSize deltas per board for
+// clients that reconnect with a resume token.
+func NewConnectionManagerWithBuffer(bufferSize int) *ConnectionManager {
+	return NewConnectionManagerWithOptions(ConnectionOptions{DeltaBuffer: bufferSize})
+}
+
+func NewConnectionManagerWithOptions(options ConnectionOptions) *ConnectionManager {
+	if options.SendQueue <= 0 {
+		options.SendQueue = DefaultSendQueue
+	}
+	if options.WriteWait <= 0 {
+		options.WriteWait = DefaultWriteWait
+	}
+	if options.PongWait <= 0 {
+		options.PongWait = DefaultPongWait
+	}
 	return &ConnectionManager{
-		connections: make(map[*websocket.Conn]bool),
-		broadcast:   make(chan []byte, 100),
+		connections: make(map[*websocket.Conn]*client),
+		broadcast:   make(chan outgoing, 100),
+		deltas:      NewDeltaBuffer(options.DeltaBuffer),
+		options:     options,
 	}
 }
 
+func (cm *ConnectionManager) Deltas() *DeltaBuffer {
+	return cm.deltas
+}
+
+// Dropped is the number of broadcasts dropped because a connection's send
+// queue was full.
+func (cm *ConnectionManager) Dropped() uint64 {
+	return cm.dropped.Load()
+}
+
 func (cm *ConnectionManager) Register(conn *websocket.Conn) {
+	cm.RegisterAndSend(conn)
+}
+
+// RegisterAndSend queues messages to conn before it starts receiving
+// broadcasts. It also arms the read deadline, which the caller's read loop
+// must keep servicing so pongs are processed. Clients that replay board
+// deltas register with RegisterAt instead.
+func (cm *ConnectionManager) RegisterAndSend(conn *websocket.Conn, messages ...[]byte) {
+	cm.register(&client{conn: conn}, messages)
+}
+
+// RegisterAt registers conn as a client that has seen board up to seq. While
+// holding the sequencing lock it passes the deltas after seq to initial,
+// queues the messages initial returns and registers conn, so no delta can be
+// appended in between and get lost. Deltas already waiting for Run are not
+// sent a second time. ok is false when the deltas after seq were evicted;
+// if initial then returns nil, conn is not registered and RegisterAt
+// returns false.
+func (cm *ConnectionManager) RegisterAt(conn *websocket.Conn, board string, seq uint64, initial func(deltas []Delta, ok bool) [][]byte) bool {
+	cm.sequencing.Lock()
+	defer cm.sequencing.Unlock()
+
+	deltas, ok := cm.deltas.Since(board, seq)
+	messages := initial(deltas, ok)
+	if messages == nil {
+		return false
+	}
+	if len(deltas) > 0 {
+		seq = deltas[len(deltas)-1].Seq
+	}
+	cm.register(&client{conn: conn, board: board, seq: seq}, messages)
+	return true
+}
+
+func (cm *ConnectionManager) register(c *client, messages [][]byte) {
+	// The queue always has room for the initial messages, however many
+	// deltas a resume replays.
+	c.send = make(chan []byte, max(cm.options.SendQueue, len(messages)))
+	c.done = make(chan struct{})
+	for _, message := range messages {
+		c.send <- message
+	}
+	conn := c.conn
+
+	pongWait := cm.options.PongWait
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	cm.Lock()
-	defer cm.Unlock()
-	cm.connections[conn] = true
+	cm.connections[conn] = c
+	cm.Unlock()
+	go cm.writeLoop(c)
 }
 
+// Send queues a message to one registered connection, such as the reply to a
+// client's request. Replies are never dropped silently: a full queue returns
+// ErrSendQueueFull and the caller should close the connection.
+func (cm *ConnectionManager) Send(conn *websocket.Conn, message []byte) error {
+	cm.RLock()
+	c, exists := cm.connections[conn]
+	cm.RUnlock()
+	if !exists {
+		return ErrNotRegistered
+	}
+	if !c.enqueue(message) {
+		return ErrSendQueueFull
+	}
+	return nil
+}
+
+// Unregister stops broadcasting to conn. Its writeLoop sends a close frame
+// and closes the connection.
 func (cm *ConnectionManager) Unregister(conn *websocket.Conn) {
 	cm.Lock()
 	defer cm.Unlock()
-	if _, exists := cm.connections[conn]; exists {
+	if c, exists := cm.connections[conn]; exists {
 		delete(cm.connections, conn)
-		conn.Close()
+		c.stop()
+	}
+}
+
+// writeLoop is the only writer of a connection. Every write, including
+// pings, has a deadline; a failed write unregisters the connection.
+func (cm *ConnectionManager) writeLoop(c *client) {
+	ticker := time.NewTicker(cm.options.PongWait * 9 / 10)
+	defer func() {
+		ticker.Stop()
+		cm.Unregister(c.conn)
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+				time.Now().Add(cm.options.WriteWait))
+			return
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(cm.options.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Printf("Error writing message: %v", err)
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cm.options.WriteWait)); err != nil {
+				log.Printf("Error writing ping: %v", err)
+				return
+			}
+		}
 	}
 }
 
@@ -42,21 +242,39 @@ func (cm *ConnectionManager) BroadcastMessage(message interface{}) {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
-	cm.broadcast <- jsonMsg
+	cm.broadcast <- outgoing{payload: jsonMsg}
 }
 
+// BroadcastBoardMessage stamps message with the next sequence number of the
+// board, records it in the delta buffer and broadcasts it.
+func (cm *ConnectionManager) BroadcastBoardMessage(board string, message map[string]interface{}) {
+	cm.sequencing.Lock()
+	defer cm.sequencing.Unlock()
+
+	delta, err := cm.deltas.Append(board, func(seq uint64) ([]byte, error) {
+		return withSequence(board, seq, message)
+	})
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return
+	}
+	cm.broadcast <- outgoing{board: board, seq: delta.Seq, payload: delta.Payload}
+}
+
+// Run fans broadcasts out to the send queues. A connection whose queue is
+// full misses the message: every update carries the full top 10, so it only
+// skips a step, and the seq gap tells it what it missed.
 func (cm *ConnectionManager) Run() {
 	for {
 		message := <-cm.broadcast
 
 		cm.RLock()
-		for conn := range cm.connections {
-			err := conn.WriteMessage(websocket.TextMessage, message)
-			if err != nil {
-				log.Printf("Error writing message: %v", err)
-				cm.RUnlock()
-				cm.Unregister(conn)
-				cm.RLock()
+		for _, c := range cm.connections {
+			if message.board != "" && message.board == c.board && message.seq <= c.seq {
+				continue
+			}
+			if !c.enqueue(message.payload) {
+				cm.dropped.Add(1)
 			}
 		}
 		cm.RUnlock()
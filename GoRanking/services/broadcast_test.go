@@ -0,0 +1,270 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testServer registers every WebSocket connection with cm and services its
+// reads until the connection closes.
+func testServer(t *testing.T, cm *ConnectionManager) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		cm.RegisterAndSend(conn, []byte(`{"type":"initial"}`))
+		defer cm.Unregister(conn)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func clientCount(cm *ConnectionManager) int {
+	cm.RLock()
+	defer cm.RUnlock()
+	return len(cm.connections)
+}
+
+func waitFor(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSlowClientDoesNotStallBroadcasts(t *testing.T) {
+	cm := NewConnectionManagerWithOptions(ConnectionOptions{SendQueue: 2, WriteWait: 300 * time.Millisecond})
+	go cm.Run()
+	url := testServer(t, cm)
+
+	dial(t, url) // never reads, so the socket buffers fill up
+	fast := dial(t, url)
+	waitFor(t, func() bool { return clientCount(cm) == 2 }, "Expected 2 registered clients")
+
+	// Each broadcast reaches the fast client promptly while the slow
+	// client's queue is full and its writer blocked.
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+	fast.SetReadDeadline(time.Now().Add(5 * time.Second))
+	fast.ReadMessage() // initial
+	for i := 0; i < 40; i++ {
+		cm.broadcast <- outgoing{payload: payload}
+		fast.SetReadDeadline(time.Now().Add(time.Second))
+		if _, message, err := fast.ReadMessage(); err != nil || len(message) != len(payload) {
+			t.Fatalf("Broadcast %d to the fast client stalled: %v", i, err)
+		}
+	}
+
+	if cm.Dropped() == 0 {
+		t.Error("Expected broadcasts to the slow client to be dropped")
+	}
+	waitFor(t, func() bool { return clientCount(cm) == 1 }, "Expected the stuck client to be closed after the write deadline")
+}
+
+func TestUnresponsiveClientTimesOut(t *testing.T) {
+	cm := NewConnectionManagerWithOptions(ConnectionOptions{PongWait: 200 * time.Millisecond})
+	url := testServer(t, cm)
+
+	conn := dial(t, url)
+	// Reading answers pings, keeping the connection alive past the pong wait.
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	waitFor(t, func() bool { return clientCount(cm) == 1 }, "Expected a registered client")
+	time.Sleep(500 * time.Millisecond)
+	if clientCount(cm) != 1 {
+		t.Fatal("Expected a client answering pings to stay connected")
+	}
+
+	// A client that stops answering is closed once the pong wait expires.
+	conn.SetPongHandler(func(string) error { return nil })
+	silent := dial(t, url)
+	silent.SetPingHandler(func(string) error { return nil })
+	go func() {
+		for {
+			if _, _, err := silent.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	waitFor(t, func() bool { return clientCount(cm) == 2 }, "Expected 2 registered clients")
+	waitFor(t, func() bool { return clientCount(cm) == 1 }, "Expected the silent client to time out")
+}
+
+func TestSendReportsFullQueue(t *testing.T) {
+	cm := NewConnectionManager()
+	if err := cm.Send(nil, []byte("reply")); err != ErrNotRegistered {
+		t.Errorf("Expected ErrNotRegistered, got %v", err)
+	}
+
+	c := &client{send: make(chan []byte, 1), done: make(chan struct{})}
+	if !c.enqueue([]byte("a")) || c.enqueue([]byte("b")) {
+		t.Error("Expected the second message to find the queue full")
+	}
+	c.stop()
+	c.stop() // idempotent
+}
+
+// resumeServer registers each WebSocket connection at ?seq=N, replaying the
+// deltas after N before the live broadcasts.
+func resumeServer(t *testing.T, cm *ConnectionManager) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		seq, _ := strconv.ParseUint(r.URL.Query().Get("seq"), 10, 64)
+		registered := cm.RegisterAt(conn, DefaultBoard, seq, func(deltas []Delta, ok bool) [][]byte {
+			if !ok {
+				return nil
+			}
+			messages := [][]byte{}
+			for _, delta := range deltas {
+				messages = append(messages, delta.Payload)
+			}
+			return messages
+		})
+		if !registered {
+			conn.Close()
+			return
+		}
+		defer cm.Unregister(conn)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// readSeqs reads n board messages and returns their sequence numbers.
+func readSeqs(t *testing.T, conn *websocket.Conn, n int) []uint64 {
+	t.Helper()
+	seqs := make([]uint64, 0, n)
+	for len(seqs) < n {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected %d messages, got %v: %v", n, seqs, err)
+		}
+		var message struct{ Seq uint64 }
+		json.Unmarshal(data, &message)
+		seqs = append(seqs, message.Seq)
+	}
+	return seqs
+}
+
+func TestResumeSkipsQueuedDeltas(t *testing.T) {
+	cm := NewConnectionManager()
+	url := resumeServer(t, cm)
+
+	// Run is not started yet, so deltas 3-5 are still waiting to be fanned
+	// out when the client replays them.
+	for i := 0; i < 5; i++ {
+		cm.BroadcastBoardMessage(DefaultBoard, map[string]interface{}{"type": "update"})
+	}
+	conn := dial(t, url+"?seq=2")
+	waitFor(t, func() bool { return clientCount(cm) == 1 }, "Expected a registered client")
+	go cm.Run()
+	cm.BroadcastBoardMessage(DefaultBoard, map[string]interface{}{"type": "update"})
+
+	if seqs := readSeqs(t, conn, 4); fmt.Sprint(seqs) != "[3 4 5 6]" {
+		t.Errorf("Expected deltas 3-6 once each, got %v", seqs)
+	}
+}
+
+func TestResumeDuringBroadcastsIsGaplessAndUnique(t *testing.T) {
+	const total = 1000
+	cm := NewConnectionManagerWithOptions(ConnectionOptions{DeltaBuffer: total, SendQueue: total})
+	go cm.Run()
+
+	url := resumeServer(t, cm)
+
+	for i := 0; i < 10; i++ {
+		cm.BroadcastBoardMessage(DefaultBoard, map[string]interface{}{"type": "update"})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 10; i < total; i++ {
+			cm.BroadcastBoardMessage(DefaultBoard, map[string]interface{}{"type": "update"})
+			if i%5 == 0 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+
+	// Resume while the broadcasts are in flight; every client must see each
+	// delta after its resume point exactly once and in order.
+	errs := make(chan error, 50)
+	for c := 0; c < 50; c++ {
+		from := cm.Deltas().LastSeq(DefaultBoard)
+		conn := dial(t, fmt.Sprintf("%s?seq=%d", url, from))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			next := from + 1
+			for next <= total {
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					errs <- fmt.Errorf("resumed at %d, waiting for %d: %v", from, next, err)
+					return
+				}
+				var message struct{ Seq uint64 }
+				json.Unmarshal(data, &message)
+				if message.Seq != next {
+					errs <- fmt.Errorf("resumed at %d: expected seq %d, got %d", from, next, message.Seq)
+					return
+				}
+				next++
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
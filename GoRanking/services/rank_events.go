@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"ranking/models"
+)
+
+// Kinds of rank change events.
+const (
+	RankEnteredTop = "entered_top"
+	RankLeftTop    = "left_top"
+	RankMovedUp    = "moved_up"
+	RankMovedDown  = "moved_down"
+)
+
+// DefaultMinRankChange is how many places a user must move before a
+// moved_up or moved_down event.
+const DefaultMinRankChange = 5
+
+// DefaultTopThresholds are the "top N" groups users are told about entering
+// or leaving.
+var DefaultTopThresholds = []int{10, 100}
+
+// RankEvent tells a watching client that its user's rank changed:
+//
+//	{"type": "rank_change", "event": "entered_top", "threshold": 10, "rank": 8, "previous_rank": 12, ...}
+//	{"type": "rank_change", "event": "moved_down", "places": 5, "rank": 17, "previous_rank": 12, ...}
+type RankEvent struct {
+	Type         string    `json:"type"`
+	UserID       string    `json:"user_id"`
+	Event        string    `json:"event"`
+	Rank         int       `json:"rank"`
+	PreviousRank int       `json:"previous_rank"` // 0 if the user had no rank
+	Places       int       `json:"places,omitempty"`
+	Threshold    int       `json:"threshold,omitempty"`
+	Score        int       `json:"score"`
+	Time         time.Time `json:"time"`
+}
+
+// RankTrackerOptions tunes which changes produce events. Zero fields take
+// the defaults.
+type RankTrackerOptions struct {
+	Thresholds []int
+	MinChange  int
+}
+
+type rankWatch struct {
+	subscribers map[int]func([]byte)
+	seen        int // rank at the last check, 0 if unranked
+	reported    int // rank that moves are measured from
+}
+
+// RankTracker watches the ranks of users with an open WebSocket and sends
+// them events when they cross a top N threshold or move by MinChange places,
+// including when other players overtake them. Notify after every score change
+// schedules a check; checks coalesce, so each costs one rank lookup per
+// watched user however many updates arrive meanwhile.
+type RankTracker struct {
+	sync.Mutex
+	store      models.Store
+	thresholds []int
+	minChange  int
+	watches    map[string]*rankWatch
+	nextID     int
+	notify     chan struct{}
+}
+
+func NewRankTracker(store models.Store, options RankTrackerOptions) *RankTracker {
+	thresholds := options.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = DefaultTopThresholds
+	}
+	thresholds = append([]int(nil), thresholds...)
+	sort.Ints(thresholds)
+	if options.MinChange <= 0 {
+		options.MinChange = DefaultMinRankChange
+	}
+	return &RankTracker{
+		store:      store,
+		thresholds: thresholds,
+		minChange:  options.MinChange,
+		watches:    make(map[string]*rankWatch),
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// Watch sends the user's rank events to send until the returned function is
+// called. Changes are measured from the user's rank when first watched.
+func (rt *RankTracker) Watch(ctx context.Context, userID string, send func([]byte)) (func(), error) {
+	rt.Lock()
+	_, watched := rt.watches[userID]
+	rt.Unlock()
+
+	rank := 0
+	if !watched {
+		estimate, exists, err := rt.store.GetUserRank(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			rank = estimate.Rank
+		}
+	}
+
+	rt.Lock()
+	defer rt.Unlock()
+	watch, exists := rt.watches[userID]
+	if !exists {
+		watch = &rankWatch{subscribers: make(map[int]func([]byte)), seen: rank, reported: rank}
+		rt.watches[userID] = watch
+	}
+	rt.nextID++
+	id := rt.nextID
+	watch.subscribers[id] = send
+
+	return func() {
+		rt.Lock()
+		defer rt.Unlock()
+		delete(watch.subscribers, id)
+		if len(watch.subscribers) == 0 && rt.watches[userID] == watch {
+			delete(rt.watches, userID)
+		}
+	}, nil
+}
+
+// Notify schedules a check without blocking.
+func (rt *RankTracker) Notify() {
+	select {
+	case rt.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (rt *RankTracker) Run() {
+	for range rt.notify {
+		if err := rt.Check(context.Background()); err != nil {
+			log.Printf("Failed to check ranks: %v", err)
+		}
+	}
+}
+
+// Check looks up the rank of every watched user and sends the events.
+func (rt *RankTracker) Check(ctx context.Context) error {
+	rt.Lock()
+	userIDs := make([]string, 0, len(rt.watches))
+	for userID := range rt.watches {
+		userIDs = append(userIDs, userID)
+	}
+	rt.Unlock()
+
+	for _, userID := range userIDs {
+		estimate, exists, err := rt.store.GetUserRank(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		rt.Lock()
+		watch, watched := rt.watches[userID]
+		if !watched {
+			rt.Unlock()
+			continue
+		}
+		events := rt.compare(watch, userID, estimate)
+		subscribers := make([]func([]byte), 0, len(watch.subscribers))
+		for _, send := range watch.subscribers {
+			subscribers = append(subscribers, send)
+		}
+		rt.Unlock()
+
+		for _, event := range events {
+			payload, _ := json.Marshal(event)
+			for _, send := range subscribers {
+				send(payload)
+			}
+		}
+	}
+	return nil
+}
+
+// compare updates the watch with the user's current rank and returns the
+// events since the last check.
+func (rt *RankTracker) compare(watch *rankWatch, userID string, estimate models.RankEstimate) []RankEvent {
+	rank, previous := estimate.Rank, watch.seen
+	if rank == previous {
+		return nil
+	}
+	watch.seen = rank
+	event := func(kind string) RankEvent {
+		return RankEvent{
+			Type:         "rank_change",
+			UserID:       userID,
+			Event:        kind,
+			Rank:         rank,
+			PreviousRank: previous,
+			Score:        estimate.Score,
+			Time:         time.Now(),
+		}
+	}
+
+	var events []RankEvent
+	// The smallest threshold crossed is the most notable one.
+	for _, threshold := range rt.thresholds {
+		wasIn := previous > 0 && previous <= threshold
+		isIn := rank <= threshold
+		if wasIn == isIn {
+			continue
+		}
+		kind := RankLeftTop
+		if isIn {
+			kind = RankEnteredTop
+		}
+		crossed := event(kind)
+		crossed.Threshold = threshold
+		events = append(events, crossed)
+		break
+	}
+
+	places := watch.reported - rank
+	if watch.reported > 0 && (places >= rt.minChange || -places >= rt.minChange) {
+		moved := event(RankMovedUp)
+		if places < 0 {
+			moved.Event = RankMovedDown
+			places = -places
+		}
+		moved.PreviousRank = watch.reported
+		moved.Places = places
+		events = append(events, moved)
+	}
+	// Moves are measured from the rank the user was last told about.
+	if len(events) > 0 || watch.reported == 0 {
+		watch.reported = rank
+	}
+	return events
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"ranking/models"
+)
+
+func collectEvents(events *[]RankEvent) func([]byte) {
+	return func(payload []byte) {
+		var event RankEvent
+		json.Unmarshal(payload, &event)
+		*events = append(*events, event)
+	}
+}
+
+func TestRankTrackerEvents(t *testing.T) {
+	ctx := context.Background()
+	store := models.NewMemoryStore(models.NewLeaderboard())
+	for i := 1; i <= 20; i++ {
+		store.ApplyScore(ctx, models.ScoreUpdate{UserID: fmt.Sprintf("u%d", i), Score: 1000 - i*10})
+	}
+	tracker := NewRankTracker(store, RankTrackerOptions{Thresholds: []int{10}, MinChange: 5})
+
+	var events []RankEvent
+	cancel, err := tracker.Watch(ctx, "u12", collectEvents(&events))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// u12 climbs from 12 to 9: it enters the top 10 but moves only 3 places.
+	store.ApplyScore(ctx, models.ScoreUpdate{UserID: "u12", Score: 915})
+	tracker.Check(ctx)
+	if len(events) != 1 || events[0].Event != RankEnteredTop || events[0].Threshold != 10 || events[0].Rank != 9 || events[0].PreviousRank != 12 {
+		t.Fatalf("Expected to enter the top 10, got %+v", events)
+	}
+
+	// Others overtake u12 one at a time: it leaves the top 10 at 11, then
+	// hears again once it has dropped 5 more places.
+	events = nil
+	for i := 13; i <= 19; i++ {
+		store.ApplyScore(ctx, models.ScoreUpdate{UserID: fmt.Sprintf("u%d", i), Score: 2000 + i})
+		tracker.Check(ctx)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected left top 10 and moved down events, got %+v", events)
+	}
+	if events[0].Event != RankLeftTop || events[0].Rank != 11 || events[0].PreviousRank != 10 {
+		t.Errorf("Expected to leave the top 10 at rank 11, got %+v", events[0])
+	}
+	if events[1].Event != RankMovedDown || events[1].Places != 5 || events[1].PreviousRank != 11 || events[1].Rank != 16 {
+		t.Errorf("Expected to drop 5 places from 11, got %+v", events[1])
+	}
+
+	// A big climb both enters the top 10 and reports the places gained.
+	events = nil
+	store.ApplyScore(ctx, models.ScoreUpdate{UserID: "u12", Score: 5000})
+	tracker.Notify()
+	tracker.Notify() // coalesced
+	if len(tracker.notify) != 1 {
+		t.Errorf("Expected notifications to coalesce, got %d", len(tracker.notify))
+	}
+	<-tracker.notify
+	tracker.Check(ctx)
+	if len(events) != 2 || events[0].Event != RankEnteredTop || events[1].Event != RankMovedUp || events[1].Places != 15 || events[1].Rank != 1 {
+		t.Errorf("Expected to enter the top 10 and move up 15 places, got %+v", events)
+	}
+
+	cancel()
+	events = nil
+	store.ApplyScore(ctx, models.ScoreUpdate{UserID: "u1", Score: 9000})
+	tracker.Check(ctx)
+	if len(events) != 0 || len(tracker.watches) != 0 {
+		t.Errorf("Expected no events after cancel, got %+v", events)
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRateLimit = 5.0 // submissions per second per user
+	DefaultRateBurst = 10
+
+	// rateSweepInterval is how often buckets that refilled completely are dropped.
+	rateSweepInterval = time.Minute
+)
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket per key: each key may spend burst requests at
+// once and regains perSecond of them every second.
+type RateLimiter struct {
+	sync.Mutex
+	perSecond float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if perSecond <= 0 {
+		perSecond = DefaultRateLimit
+	}
+	if burst <= 0 {
+		burst = DefaultRateBurst
+	}
+	return &RateLimiter{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		now:       time.Now,
+	}
+}
+
+// Allow spends one token of key. When none is left it returns false and how
+// long until the next token.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	rl.sweepLocked(now)
+
+	bucket, exists := rl.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = bucket
+	}
+	bucket.tokens = rl.refill(bucket, now)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rl.perSecond * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+func (rl *RateLimiter) refill(bucket *tokenBucket, now time.Time) float64 {
+	tokens := bucket.tokens + now.Sub(bucket.last).Seconds()*rl.perSecond
+	if tokens > rl.burst {
+		tokens = rl.burst
+	}
+	return tokens
+}
+
+// sweepLocked drops full buckets, which behave like missing ones, so idle
+// users do not keep memory.
+func (rl *RateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(rl.lastSweep) < rateSweepInterval {
+		return
+	}
+	rl.lastSweep = now
+	for key, bucket := range rl.buckets {
+		if rl.refill(bucket, now) >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefillsPerKey(t *testing.T) {
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter(2, 3)
+	rl.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := rl.Allow("user1"); !allowed {
+			t.Fatalf("Expected request %d within the burst to be allowed", i+1)
+		}
+	}
+	allowed, retryAfter := rl.Allow("user1")
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Errorf("Expected rejection with retry after 500ms, got %v %v", allowed, retryAfter)
+	}
+	if allowed, _ := rl.Allow("user2"); !allowed {
+		t.Error("Expected another user to have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if allowed, _ := rl.Allow("user1"); !allowed {
+		t.Error("Expected one token after 500ms")
+	}
+	if allowed, _ := rl.Allow("user1"); allowed {
+		t.Error("Expected the refilled token to be spent")
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	rl := NewRateLimiter(1, 5)
+	rl.now = func() time.Time { return now }
+
+	rl.Allow("idle")
+	now = now.Add(rateSweepInterval)
+	rl.Allow("active")
+	if _, exists := rl.buckets["idle"]; exists {
+		t.Error("Expected the refilled bucket to be swept")
+	}
+	if _, exists := rl.buckets["active"]; !exists {
+		t.Error("Expected the active bucket to be kept")
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBoard           = "global"
+	DefaultDeltaBufferSize = 256
+)
+
+var (
+	ErrInvalidResumeToken = errors.New("invalid resume token")
+	// ErrStaleResumeToken means the token was issued by another process (or
+	// before a restart), whose sequence numbers mean nothing to this buffer.
+	ErrStaleResumeToken = errors.New("resume token from another epoch")
+)
+
+// resumeEpoch identifies this process in resume tokens. Sequence numbers
+// restart from 1 with every process, so a token is only valid for the epoch
+// that issued it.
+var resumeEpoch = newResumeEpoch()
+
+func newResumeEpoch() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Delta is one broadcast message together with its per-board sequence number.
+type Delta struct {
+	Board   string
+	Seq     uint64
+	Payload []byte
+}
+
+type boardDeltas struct {
+	lastSeq uint64
+	deltas  []Delta
+}
+
+// DeltaBuffer keeps the most recent broadcast deltas of every board so that
+// reconnecting clients can catch up without a full snapshot.
+type DeltaBuffer struct {
+	sync.RWMutex
+	capacity int
+	boards   map[string]*boardDeltas
+}
+
+func NewDeltaBuffer(capacity int) *DeltaBuffer {
+	if capacity <= 0 {
+		capacity = DefaultDeltaBufferSize
+	}
+	return &DeltaBuffer{
+		capacity: capacity,
+		boards:   make(map[string]*boardDeltas),
+	}
+}
+
+// Append assigns the next sequence number of the board to payload and stores
+// it, evicting the oldest delta once the buffer is full.
+func (db *DeltaBuffer) Append(board string, build func(seq uint64) ([]byte, error)) (Delta, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	bd, exists := db.boards[board]
+	if !exists {
+		bd = &boardDeltas{}
+		db.boards[board] = bd
+	}
+
+	seq := bd.lastSeq + 1
+	payload, err := build(seq)
+	if err != nil {
+		return Delta{}, err
+	}
+
+	delta := Delta{Board: board, Seq: seq, Payload: payload}
+	bd.lastSeq = seq
+	bd.deltas = append(bd.deltas, delta)
+	if len(bd.deltas) > db.capacity {
+		bd.deltas = append(bd.deltas[:0:0], bd.deltas[len(bd.deltas)-db.capacity:]...)
+	}
+	return delta, nil
+}
+
+// Since returns every delta of the board after seq. ok is false when some of
+// those deltas were already evicted and the client needs a full snapshot.
+func (db *DeltaBuffer) Since(board string, seq uint64) (deltas []Delta, ok bool) {
+	db.RLock()
+	defer db.RUnlock()
+
+	bd, exists := db.boards[board]
+	if !exists {
+		return nil, seq == 0
+	}
+	if seq > bd.lastSeq {
+		return nil, false
+	}
+	if seq == bd.lastSeq {
+		return nil, true
+	}
+	if len(bd.deltas) == 0 || bd.deltas[0].Seq > seq+1 {
+		return nil, false
+	}
+
+	start := int(seq + 1 - bd.deltas[0].Seq)
+	deltas = make([]Delta, len(bd.deltas)-start)
+	copy(deltas, bd.deltas[start:])
+	return deltas, true
+}
+
+func (db *DeltaBuffer) LastSeq(board string) uint64 {
+	db.RLock()
+	defer db.RUnlock()
+
+	if bd, exists := db.boards[board]; exists {
+		return bd.lastSeq
+	}
+	return 0
+}
+
+// EncodeResumeToken returns the opaque token a client presents on reconnect.
+// It is bound to the epoch of this process.
+func EncodeResumeToken(board string, seq uint64) string {
+	raw := resumeEpoch + ":" + board + ":" + strconv.FormatUint(seq, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeResumeToken returns the board and sequence number of token. It
+// returns ErrStaleResumeToken for a token issued by another epoch, so a
+// client reconnecting after a restart gets a full snapshot instead of
+// deltas matched against an unrelated sequence.
+func DecodeResumeToken(token string) (string, uint64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", 0, ErrInvalidResumeToken
+	}
+
+	epoch, rest, found := strings.Cut(string(raw), ":")
+	sep := strings.LastIndex(rest, ":")
+	if !found || sep <= 0 {
+		return "", 0, ErrInvalidResumeToken
+	}
+	seq, err := strconv.ParseUint(rest[sep+1:], 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidResumeToken
+	}
+	if epoch != resumeEpoch {
+		return "", 0, ErrStaleResumeToken
+	}
+	return rest[:sep], seq, nil
+}
+
+// withSequence adds the sequence number and resume token to a board message.
+func withSequence(board string, seq uint64, message map[string]interface{}) ([]byte, error) {
+	stamped := make(map[string]interface{}, len(message)+3)
+	for k, v := range message {
+		stamped[k] = v
+	}
+	stamped["board"] = board
+	stamped["seq"] = seq
+	stamped["resume_token"] = EncodeResumeToken(board, seq)
+	return json.Marshal(stamped)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func appendPayload(db *DeltaBuffer, board string) Delta {
+	delta, _ := db.Append(board, func(seq uint64) ([]byte, error) {
+		return withSequence(board, seq, map[string]interface{}{"type": "update"})
+	})
+	return delta
+}
+
+func TestDeltaBufferSince(t *testing.T) {
+	db := NewDeltaBuffer(3)
+	for i := 0; i < 5; i++ {
+		appendPayload(db, DefaultBoard)
+	}
+
+	if seq := db.LastSeq(DefaultBoard); seq != 5 {
+		t.Fatalf("Expected last seq 5, got %d", seq)
+	}
+
+	deltas, ok := db.Since(DefaultBoard, 3)
+	if !ok || len(deltas) != 2 || deltas[0].Seq != 4 || deltas[1].Seq != 5 {
+		t.Errorf("Expected deltas 4 and 5, got %v (ok=%v)", deltas, ok)
+	}
+
+	if deltas, ok := db.Since(DefaultBoard, 5); !ok || len(deltas) != 0 {
+		t.Errorf("Expected up-to-date client to need no deltas, got %v (ok=%v)", deltas, ok)
+	}
+
+	if _, ok := db.Since(DefaultBoard, 1); ok {
+		t.Error("Expected evicted deltas to require a full snapshot")
+	}
+
+	if _, ok := db.Since(DefaultBoard, 9); ok {
+		t.Error("Expected sequence from the future to require a full snapshot")
+	}
+}
+
+func TestDeltaBufferPerBoard(t *testing.T) {
+	db := NewDeltaBuffer(10)
+	appendPayload(db, "weekly")
+	delta := appendPayload(db, "daily")
+
+	if delta.Seq != 1 {
+		t.Errorf("Expected boards to have independent sequences, got %d", delta.Seq)
+	}
+
+	var message map[string]interface{}
+	if err := json.Unmarshal(delta.Payload, &message); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+	if message["board"] != "daily" || message["seq"] != float64(1) {
+		t.Errorf("Expected payload to be stamped with board and seq, got %v", message)
+	}
+}
+
+func TestResumeToken(t *testing.T) {
+	token := EncodeResumeToken("season:1", 42)
+	board, seq, err := DecodeResumeToken(token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if board != "season:1" || seq != 42 {
+		t.Errorf("Expected season:1/42, got %s/%d", board, seq)
+	}
+
+	if _, _, err := DecodeResumeToken("not-a-token"); err != ErrInvalidResumeToken {
+		t.Errorf("Expected ErrInvalidResumeToken, got %v", err)
+	}
+}
+
+func TestResumeTokenEpoch(t *testing.T) {
+	token := EncodeResumeToken(DefaultBoard, 42)
+
+	// A restarted process numbers its deltas from 1 again under a new epoch.
+	previous := resumeEpoch
+	resumeEpoch = newResumeEpoch()
+	defer func() { resumeEpoch = previous }()
+
+	if _, _, err := DecodeResumeToken(token); err != ErrStaleResumeToken {
+		t.Errorf("Expected ErrStaleResumeToken for a token of another epoch, got %v", err)
+	}
+	if _, _, err := DecodeResumeToken(EncodeResumeToken(DefaultBoard, 42)); err != nil {
+		t.Errorf("Expected a token of the current epoch to decode, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"ranking/helper"
+	"ranking/models"
+)
+
+// ErrScoreRejected wraps every reason a ScoreValidator refuses an update.
+var ErrScoreRejected = errors.New("score rejected")
+
+// ScoreSubmission is what a ScoreValidator sees before an update is applied.
+type ScoreSubmission struct {
+	Update models.ScoreUpdate
+	// Claims of the caller's token, nil when authentication is disabled.
+	Claims *helper.UserClaim
+	// Current is the user's score before the update; Exists is false for new players.
+	Current int
+	Exists  bool
+}
+
+// Change is the difference the update would make to the user's score.
+func (s ScoreSubmission) Change() int {
+	if s.Update.Delta {
+		return s.Update.Score
+	}
+	return s.Update.Score - s.Current
+}
+
+// ScoreValidator decides whether a score submission is plausible. It returns
+// an error wrapping ErrScoreRejected to refuse it.
+type ScoreValidator interface {
+	ValidateScore(ctx context.Context, submission ScoreSubmission) error
+}
+
+// ValidatorFunc adapts a function to ScoreValidator.
+type ValidatorFunc func(ctx context.Context, submission ScoreSubmission) error
+
+func (f ValidatorFunc) ValidateScore(ctx context.Context, submission ScoreSubmission) error {
+	return f(ctx, submission)
+}
+
+// ValidatorChain accepts a submission only if every validator does.
+type ValidatorChain []ScoreValidator
+
+func (c ValidatorChain) ValidateScore(ctx context.Context, submission ScoreSubmission) error {
+	for _, validator := range c {
+		if err := validator.ValidateScore(ctx, submission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxDeltaValidator refuses submissions that change a score by more than
+// MaxDelta at once. A new player's first score counts from 0.
+type MaxDeltaValidator struct {
+	MaxDelta int
+}
+
+func (v MaxDeltaValidator) ValidateScore(_ context.Context, submission ScoreSubmission) error {
+	change := submission.Change()
+	if change < 0 {
+		change = -change
+	}
+	if change > v.MaxDelta {
+		return fmt.Errorf("%w: change of %d exceeds the maximum of %d", ErrScoreRejected, change, v.MaxDelta)
+	}
+	return nil
+}
+
+// ServerAuthoritative accepts scores only from game servers, never from
+// players' own clients. It needs authentication to be enabled.
+type ServerAuthoritative struct{}
+
+func (ServerAuthoritative) ValidateScore(_ context.Context, submission ScoreSubmission) error {
+	if submission.Claims == nil || !submission.Claims.IsServer() {
+		return fmt.Errorf("%w: scores must be submitted by a game server", ErrScoreRejected)
+	}
+	return nil
+}
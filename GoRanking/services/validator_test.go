@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ranking/helper"
+	"ranking/models"
+)
+
+func TestScoreValidators(t *testing.T) {
+	ctx := context.Background()
+	player := &helper.UserClaim{Identity: "user1", Role: helper.RolePlayer}
+	server := &helper.UserClaim{Identity: "match-server", Role: helper.RoleServer}
+	validator := ValidatorChain{ServerAuthoritative{}, MaxDeltaValidator{MaxDelta: 100}}
+
+	cases := []struct {
+		name       string
+		submission ScoreSubmission
+		accepted   bool
+	}{
+		{"server delta", ScoreSubmission{Update: models.ScoreUpdate{Score: 100, Delta: true}, Claims: server}, true},
+		{"server negative delta", ScoreSubmission{Update: models.ScoreUpdate{Score: -101, Delta: true}, Claims: server}, false},
+		{"server absolute", ScoreSubmission{Update: models.ScoreUpdate{Score: 550}, Claims: server, Current: 500, Exists: true}, true},
+		{"server absolute jump", ScoreSubmission{Update: models.ScoreUpdate{Score: 650}, Claims: server, Current: 500, Exists: true}, false},
+		{"new player from 0", ScoreSubmission{Update: models.ScoreUpdate{Score: 150}, Claims: server}, false},
+		{"player", ScoreSubmission{Update: models.ScoreUpdate{Score: 1, Delta: true}, Claims: player}, false},
+		{"anonymous", ScoreSubmission{Update: models.ScoreUpdate{Score: 1, Delta: true}}, false},
+	}
+	for _, c := range cases {
+		err := validator.ValidateScore(ctx, c.submission)
+		if (err == nil) != c.accepted {
+			t.Errorf("%s: expected accepted=%v, got %v", c.name, c.accepted, err)
+		}
+		if err != nil && !errors.Is(err, ErrScoreRejected) {
+			t.Errorf("%s: expected ErrScoreRejected, got %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigsResponse GET /configs 的响应
+type ConfigsResponse struct {
+	Version int      `json:"version"`
+	Values  Snapshot `json:"values"`
+}
+
+// PollResponse GET /poll 的响应，事件与Watch流相同（snapshot或change）
+type PollResponse struct {
+	Version int          `json:"version"`
+	Events  []WatchEvent `json:"events"`
+}
+
+// 长轮询等待时间的默认值和上限
+const (
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 5 * time.Minute
+)
+
+// parseGroups 解析逗号分隔的groups参数
+func parseGroups(r *http.Request) []string {
+	if v := r.URL.Query().Get("groups"); v != "" {
+		return strings.Split(v, ",")
+	}
+	return nil
+}
+
+// handleConfigs GET /configs?groups=a,b 返回当前版本和配置值
+func (s *ConfigServer) handleConfigs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+
+	values, version := s.config.snapshotWithVersion()
+	if groups := parseGroups(r); groups != nil {
+		selected := make(Snapshot, len(groups))
+		for _, group := range groups {
+			if items, exists := values[group]; exists {
+				selected[group] = items
+			}
+		}
+		values = selected
+	}
+	writeJSON(w, http.StatusOK, ConfigsResponse{Version: version, Values: Snapshot(values)})
+}
+
+// handlePoll GET /poll?version=N&groups=a,b&timeout=30s 长轮询：
+// 版本N之后已有变更时立即返回，否则等待到有变更或超时，超时返回304。
+// 变更历史不足以覆盖版本N时返回全量快照
+func (s *ConfigServer) handlePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+
+	query := r.URL.Query()
+	req := WatchRequest{Groups: parseGroups(r)}
+	if v := query.Get("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的version: %s", v))
+			return
+		}
+		req.FromVersion = version
+	}
+	timeout := defaultPollTimeout
+	if v := query.Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的timeout: %s", v))
+			return
+		}
+		if d < maxPollTimeout {
+			timeout = d
+		} else {
+			timeout = maxPollTimeout
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	events := s.config.Watch(ctx, req, 0)
+
+	var collected []WatchEvent
+	for len(collected) == 0 {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			collected = append(collected, event)
+		case <-ctx.Done():
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	// 一并返回已经到达的事件，减少请求次数
+	for drained := false; !drained; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				drained = true
+				break
+			}
+			collected = append(collected, event)
+		default:
+			drained = true
+		}
+	}
+
+	writeJSON(w, http.StatusOK, PollResponse{Version: collected[len(collected)-1].Version, Events: collected})
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Backend 配置持久化后端：保存配置中心的完整状态，重启后恢复，并可在多个实例间共享。
+// 修订号标识后端中状态的版本，用于检测多个实例的并发写入
+type Backend interface {
+	// Load 读取已保存的状态及其修订号，尚未保存过时返回nil和0
+	Load(ctx context.Context) ([]byte, uint64, error)
+	// Save 仅当后端中的修订号仍为revision（0表示尚无数据）时写入完整状态，返回新的修订号；
+	// 状态已被其他实例修改时返回ErrConflict
+	Save(ctx context.Context, data []byte, revision uint64) (uint64, error)
+	// Watch 阻塞监听后端数据变化，每次变化后以最新数据及其修订号回调onChange，ctx取消时返回
+	Watch(ctx context.Context, onChange func(data []byte, revision uint64))
+}
+
+// ErrConflict 后端中的状态已被其他实例修改，本次写入被拒绝
+var ErrConflict = errors.New("后端配置已被其他实例修改")
+
+// errUnchanged 修改没有实际变化，updateLocked无需写入后端
+var errUnchanged = errors.New("配置没有变化")
+
+// maxConflictRetries 写入冲突时重新加载后端状态并重试修改的最大次数
+const maxConflictRetries = 5
+
+// persistedState 后端中保存的状态
+type persistedState struct {
+	Version      int                     `json:"version"`
+	Groups       map[string]*ConfigGroup `json:"groups"`
+	Environments map[string]*Environment `json:"environments,omitempty"`
+	Namespaces   map[string]*Namespace   `json:"namespaces,omitempty"`
+	History      []*ConfigChange         `json:"history,omitempty"`
+}
+
+// environments 返回保存的环境，旧版本保存的状态中没有环境
+func (state *persistedState) environments() map[string]*Environment {
+	if state.Environments == nil {
+		return make(map[string]*Environment)
+	}
+	for _, env := range state.Environments {
+		if env.Overrides == nil {
+			env.Overrides = make(map[string]map[string]*ConfigItem)
+		}
+	}
+	return state.Environments
+}
+
+// namespaces 返回保存的命名空间，旧版本保存的状态中没有命名空间
+func (state *persistedState) namespaces() map[string]*Namespace {
+	if state.Namespaces == nil {
+		return make(map[string]*Namespace)
+	}
+	for _, ns := range state.Namespaces {
+		if ns.ACL == nil {
+			ns.ACL = make(map[string]string)
+		}
+	}
+	return state.Namespaces
+}
+
+// reloadUser 热加载产生的变更记录的更新者
+const reloadUser = "backend-reload"
+
+// AttachBackend 挂载持久化后端：后端已有数据时用其替换内存中的配置，否则把当前配置写入后端。
+// 挂载后每次修改配置都会同步保存
+func (rc *RiskConfig) AttachBackend(ctx context.Context, backend Backend) error {
+	data, revision, err := backend.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %v", err)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.backend = backend
+	rc.revision = revision
+	if len(data) == 0 {
+		return rc.persistLocked()
+	}
+
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析后端配置失败: %v", err)
+	}
+	rc.applyStateLocked(&state)
+	if state.History != nil {
+		rc.history = state.History
+		rc.trimHistoryLocked(time.Now())
+	}
+	if state.Version > rc.version {
+		rc.version = state.Version
+	}
+	rc.persisted = data
+	return nil
+}
+
+// applyStateLocked 用后端状态替换内存中的配置组、环境和命名空间，调用方需持有写锁
+func (rc *RiskConfig) applyStateLocked(state *persistedState) {
+	if state.Groups == nil {
+		state.Groups = make(map[string]*ConfigGroup)
+	}
+	for _, group := range state.Groups {
+		if group.Items == nil {
+			group.Items = make(map[string]*ConfigItem)
+		}
+	}
+	indexLists(state.Groups)
+	rc.groups = state.Groups
+	rc.envs = state.environments()
+	rc.namespaces = state.namespaces()
+}
+
+// StartHotReload 监听后端变化（例如手工编辑配置文件或其他实例写入）并应用新状态，
+// 产生Watch事件和监听器通知。阻塞直到ctx取消
+func (rc *RiskConfig) StartHotReload(ctx context.Context) error {
+	rc.mutex.RLock()
+	backend := rc.backend
+	rc.mutex.RUnlock()
+	if backend == nil {
+		return fmt.Errorf("未挂载持久化后端")
+	}
+
+	backend.Watch(ctx, func(data []byte, revision uint64) {
+		if err := rc.reload(data, revision); err != nil {
+			fmt.Printf("热加载配置失败: %v\n", err)
+		}
+	})
+	return nil
+}
+
+// reload 应用后端中的新状态
+func (rc *RiskConfig) reload(data []byte, revision uint64) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.reloadLocked(data, revision)
+}
+
+// reloadLocked 应用后端中修订号为revision的状态，调用方需持有写锁。
+// 其他实例写入的状态带有它们的变更历史和全局版本号，直接采用，并按历史发布本实例还没有的变更，
+// 保留真实的更新者；版本号没有前进（例如手工编辑配置文件）时才逐项比较，
+// 每个差异记一条更新者为backend-reload的变更
+func (rc *RiskConfig) reloadLocked(data []byte, revision uint64) error {
+	// 本实例刚写入的数据无需再应用
+	if bytes.Equal(data, rc.persisted) {
+		rc.revision = revision
+		return nil
+	}
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析后端配置失败: %v", err)
+	}
+	rc.persisted = data
+	rc.revision = revision
+
+	oldGroups, oldVersion := rc.groups, rc.version
+	rc.applyStateLocked(&state)
+	now := time.Now()
+
+	if state.Version > oldVersion {
+		rc.history = state.History
+		if rc.history == nil {
+			rc.history = make([]*ConfigChange, 0)
+		}
+		rc.version = state.Version
+		if len(state.History) > 0 && state.History[0].Version <= oldVersion+1 {
+			rc.pending = replayChanges(oldGroups, state.History, oldVersion)
+		} else {
+			// 中间的历史已被清理，只能按差异发布
+			for _, change := range diffGroups(oldGroups, rc.groups, now) {
+				change.Version = rc.version
+				rc.pending = append(rc.pending, change)
+			}
+		}
+		rc.trimHistoryLocked(now)
+	} else {
+		for _, change := range diffGroups(oldGroups, rc.groups, now) {
+			rc.version++
+			change.Version = rc.version
+			rc.recordChangeLocked(change)
+		}
+	}
+
+	if len(rc.pending) > 0 {
+		fmt.Printf("热加载配置: %d 项变更\n", len(rc.pending))
+	}
+	rc.publishPendingLocked()
+	return nil
+}
+
+// replayChanges 返回history中from之后的变更。历史中的列表变更只保留了增删的成员，
+// 从groups中的原值开始依次应用，补全发布所需的完整新旧值
+func replayChanges(groups map[string]*ConfigGroup, history []*ConfigChange, from int) []*ConfigChange {
+	current := make(map[[2]string]interface{})
+	valueOf := func(groupName, key string) interface{} {
+		if value, exists := current[[2]string{groupName, key}]; exists {
+			return value
+		}
+		if group := groups[groupName]; group != nil && group.Items[key] != nil {
+			return group.Items[key].Value
+		}
+		return nil
+	}
+
+	var changes []*ConfigChange
+	for _, entry := range history {
+		if entry.Version <= from {
+			continue
+		}
+		change := *entry
+		if entry.Ops != nil {
+			change.Ops = make([]*ConfigChange, len(entry.Ops))
+			for i, op := range entry.Ops {
+				copied := *op
+				change.Ops[i] = &copied
+			}
+		}
+		// 环境覆盖值的变更不改变基础配置的值
+		if change.Env == "" {
+			for _, op := range change.Changes() {
+				if op.List != nil {
+					op.OldValue = valueOf(op.GroupName, op.Key)
+					op.NewValue = applyListDelta(op.OldValue, op.List)
+				}
+				current[[2]string{op.GroupName, op.Key}] = op.NewValue
+			}
+		}
+		changes = append(changes, &change)
+	}
+	return changes
+}
+
+// diffGroups 逐项比较两组配置，为每个新增、修改和删除的配置项返回一条更新者为backend-reload的变更
+func diffGroups(old, groups map[string]*ConfigGroup, now time.Time) []*ConfigChange {
+	var changes []*ConfigChange
+	for name, group := range groups {
+		oldGroup := old[name]
+		for key, item := range group.Items {
+			var oldItem *ConfigItem
+			if oldGroup != nil {
+				oldItem = oldGroup.Items[key]
+			}
+			if oldItem != nil && sameValue(oldItem.Value, item.Value) {
+				continue
+			}
+			change := &ConfigChange{GroupName: name, Key: key, NewValue: item.Value, UpdatedBy: reloadUser, Timestamp: now, Namespace: group.Namespace}
+			if oldItem != nil {
+				change.OldValue = oldItem.Value
+			}
+			changes = append(changes, change)
+		}
+		if oldGroup != nil {
+			for key, oldItem := range oldGroup.Items {
+				if _, exists := group.Items[key]; !exists {
+					changes = append(changes, &ConfigChange{GroupName: name, Key: key, OldValue: oldItem.Value, UpdatedBy: reloadUser, Timestamp: now, Namespace: group.Namespace})
+				}
+			}
+		}
+	}
+	for name, oldGroup := range old {
+		if _, exists := groups[name]; exists {
+			continue
+		}
+		for key, oldItem := range oldGroup.Items {
+			changes = append(changes, &ConfigChange{GroupName: name, Key: key, OldValue: oldItem.Value, UpdatedBy: reloadUser, Timestamp: now, Namespace: oldGroup.Namespace})
+		}
+	}
+	return changes
+}
+
+// sameValue 按JSON表示比较配置值，避免int与float64等表示差异被当作变更
+func sameValue(a, b interface{}) bool {
+	x, errX := json.Marshal(a)
+	y, errY := json.Marshal(b)
+	return errX == nil && errY == nil && bytes.Equal(x, y)
+}
+
+// updateLocked 执行一次修改并持久化，调用方需持有写锁。修改产生的变更在写入后端成功后才推送给
+// 订阅者和监听器；修改或写入失败时内存恢复到上次保存的状态。后端已被其他实例修改时
+// 先加载其最新状态，再重新执行修改
+func (rc *RiskConfig) updateLocked(apply func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := apply(); err != nil {
+			if err == errUnchanged {
+				return nil
+			}
+			if len(rc.pending) > 0 {
+				rc.restoreLocked()
+			}
+			return err
+		}
+		err := rc.persistLocked()
+		if err == nil {
+			rc.publishPendingLocked()
+			return nil
+		}
+
+		rc.restoreLocked()
+		if !errors.Is(err, ErrConflict) || attempt == maxConflictRetries {
+			return err
+		}
+		if err := rc.refreshLocked(); err != nil {
+			return err
+		}
+	}
+}
+
+// persistLocked 把当前状态写入后端，未挂载后端时不做任何事。调用方需持有写锁，
+// 在锁内写入保证多次修改按顺序落盘
+func (rc *RiskConfig) persistLocked() error {
+	if rc.backend == nil {
+		return nil
+	}
+
+	state := persistedState{Version: rc.version, Groups: rc.groups, Environments: rc.envs, Namespaces: rc.namespaces, History: rc.history}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	revision, err := rc.backend.Save(context.Background(), data, rc.revision)
+	if err != nil {
+		return fmt.Errorf("持久化配置失败: %w", err)
+	}
+	rc.persisted = data
+	rc.revision = revision
+	return nil
+}
+
+// restoreLocked 丢弃未持久化的修改，恢复到上次保存或热加载的状态，调用方需持有写锁。
+// 未挂载后端时没有可恢复的状态，已记录的变更照常发布
+func (rc *RiskConfig) restoreLocked() {
+	if rc.backend == nil || rc.persisted == nil {
+		rc.publishPendingLocked()
+		return
+	}
+
+	var state persistedState
+	if err := json.Unmarshal(rc.persisted, &state); err != nil {
+		rc.publishPendingLocked()
+		return
+	}
+	rc.applyStateLocked(&state)
+	rc.history = state.History
+	if rc.history == nil {
+		rc.history = make([]*ConfigChange, 0)
+	}
+	rc.version = state.Version
+	rc.pending = nil
+}
+
+// refreshLocked 从后端加载最新状态并应用，调用方需持有写锁
+func (rc *RiskConfig) refreshLocked() error {
+	data, revision, err := rc.backend.Load(context.Background())
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %v", err)
+	}
+	if len(data) == 0 {
+		rc.revision = 0
+		return nil
+	}
+	return rc.reloadLocked(data, revision)
+}
+
+// DefaultPollInterval 文件和etcd后端检查变化的默认间隔
+const DefaultPollInterval = 2 * time.Second
+
+// FileBackend 基于本地JSON文件的后端，写入时先写临时文件再重命名，不会留下写了一半的文件。
+// 修订号是文件内容的哈希，写入前检查文件是否已被修改；检查和重命名之间没有文件锁，
+// 多个进程写同一个文件时应改用etcd或Consul。热加载按PollInterval轮询文件的修改时间和内容，
+// 不使用inotify/fsnotify，因此修改最多延迟一个轮询间隔才生效
+type FileBackend struct {
+	Path         string
+	PollInterval time.Duration
+}
+
+// NewFileBackend 创建文件后端
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{Path: path, PollInterval: DefaultPollInterval}
+}
+
+// fileRevision 文件内容的修订号，0保留给不存在的文件
+func fileRevision(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	if sum := h.Sum64(); sum != 0 {
+		return sum
+	}
+	return 1
+}
+
+// Load 读取配置文件，文件不存在时返回nil
+func (fb *FileBackend) Load(ctx context.Context) ([]byte, uint64, error) {
+	data, err := os.ReadFile(fb.Path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, fileRevision(data), nil
+}
+
+// Save 文件内容仍为revision时原子地写入配置文件
+func (fb *FileBackend) Save(ctx context.Context, data []byte, revision uint64) (uint64, error) {
+	_, current, err := fb.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if current != revision {
+		return 0, ErrConflict
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fb.Path), 0755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fb.Path), filepath.Base(fb.Path)+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), fb.Path); err != nil {
+		return 0, err
+	}
+	return fileRevision(data), nil
+}
+
+// Watch 定期检查文件，修改时间或大小变化且内容不同时回调
+func (fb *FileBackend) Watch(ctx context.Context, onChange func(data []byte, revision uint64)) {
+	interval := fb.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastMod time.Time
+	var lastSize int64
+	if info, err := os.Stat(fb.Path); err == nil {
+		lastMod, lastSize = info.ModTime(), info.Size()
+	}
+	_, last, _ := fb.Load(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(fb.Path)
+			if err != nil || (info.ModTime().Equal(lastMod) && info.Size() == lastSize) {
+				continue
+			}
+			lastMod, lastSize = info.ModTime(), info.Size()
+			data, revision, err := fb.Load(ctx)
+			if err != nil || len(data) == 0 || revision == last {
+				continue
+			}
+			last = revision
+			onChange(data, revision)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBackendKey etcd/Consul中保存配置的默认键
+const DefaultBackendKey = "riskconfig/state"
+
+// EtcdBackend 通过etcd v3的HTTP网关（/v3/kv/*）读写配置，多个实例指向同一个键即可共享配置。
+// 修订号是键的mod_revision，写入使用比较mod_revision的事务；热加载定期比较键的mod_revision
+type EtcdBackend struct {
+	Endpoint     string // 例如 http://127.0.0.1:2379
+	Key          string
+	PollInterval time.Duration
+	Client       *http.Client
+}
+
+// NewEtcdBackend 创建etcd后端
+func NewEtcdBackend(endpoint, key string) *EtcdBackend {
+	if key == "" {
+		key = DefaultBackendKey
+	}
+	return &EtcdBackend{
+		Endpoint:     strings.TrimRight(endpoint, "/"),
+		Key:          key,
+		PollInterval: DefaultPollInterval,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// etcdRangeResponse /v3/kv/range的响应，int64字段以字符串编码
+type etcdRangeResponse struct {
+	Kvs []struct {
+		Value       string `json:"value"`
+		ModRevision string `json:"mod_revision"`
+	} `json:"kvs"`
+}
+
+func (eb *EtcdBackend) post(ctx context.Context, path string, body interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, eb.Endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := eb.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("etcd %s 返回 %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// etcdTxnResponse /v3/kv/txn的响应，比较失败时succeeded省略
+type etcdTxnResponse struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	Succeeded bool `json:"succeeded"`
+}
+
+// get 读取键的值和mod_revision，键不存在时返回nil
+func (eb *EtcdBackend) get(ctx context.Context) ([]byte, uint64, error) {
+	var resp etcdRangeResponse
+	key := base64.StdEncoding.EncodeToString([]byte(eb.Key))
+	if err := eb.post(ctx, "/v3/kv/range", map[string]string{"key": key}, &resp); err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+	if err != nil {
+		return nil, 0, err
+	}
+	revision, _ := strconv.ParseUint(resp.Kvs[0].ModRevision, 10, 64)
+	return data, revision, nil
+}
+
+// Load 读取配置及其mod_revision
+func (eb *EtcdBackend) Load(ctx context.Context) ([]byte, uint64, error) {
+	return eb.get(ctx)
+}
+
+// Save 在一个事务中比较mod_revision并写入配置，键不存在时mod_revision为0
+func (eb *EtcdBackend) Save(ctx context.Context, data []byte, revision uint64) (uint64, error) {
+	key := base64.StdEncoding.EncodeToString([]byte(eb.Key))
+	txn := map[string]interface{}{
+		"compare": []map[string]string{
+			{"key": key, "target": "MOD", "result": "EQUAL", "mod_revision": strconv.FormatUint(revision, 10)},
+		},
+		"success": []map[string]interface{}{
+			{"request_put": map[string]string{"key": key, "value": base64.StdEncoding.EncodeToString(data)}},
+		},
+	}
+	var resp etcdTxnResponse
+	if err := eb.post(ctx, "/v3/kv/txn", txn, &resp); err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrConflict
+	}
+	// 事务中写入的键的mod_revision就是事务的revision
+	return strconv.ParseUint(resp.Header.Revision, 10, 64)
+}
+
+// Watch 定期检查mod_revision，变化时回调
+func (eb *EtcdBackend) Watch(ctx context.Context, onChange func(data []byte, revision uint64)) {
+	interval := eb.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	_, lastRevision, _ := eb.get(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, revision, err := eb.get(ctx)
+			if err != nil || revision == lastRevision || len(data) == 0 {
+				continue
+			}
+			lastRevision = revision
+			onChange(data, revision)
+		}
+	}
+}
+
+// ConsulBackend 通过Consul KV的HTTP接口读写配置，修订号是键的ModifyIndex，写入使用?cas=；
+// 热加载使用阻塞查询（?index=N&wait=...）
+type ConsulBackend struct {
+	Address string // 例如 http://127.0.0.1:8500
+	Key     string
+	Wait    time.Duration // 阻塞查询的最长等待时间
+	Client  *http.Client
+}
+
+// NewConsulBackend 创建Consul后端
+func NewConsulBackend(address, key string) *ConsulBackend {
+	if key == "" {
+		key = DefaultBackendKey
+	}
+	return &ConsulBackend{
+		Address: strings.TrimRight(address, "/"),
+		Key:     key,
+		Wait:    30 * time.Second,
+		Client:  &http.Client{},
+	}
+}
+
+// consulKV /v1/kv/<key>响应中的一项，Value以base64编码
+type consulKV struct {
+	Value       []byte `json:"Value"`
+	ModifyIndex uint64 `json:"ModifyIndex"`
+}
+
+func (cb *ConsulBackend) keyURL(query url.Values) string {
+	u := cb.Address + "/v1/kv/" + strings.TrimLeft(cb.Key, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// get 读取键的值、ModifyIndex和X-Consul-Index，index>0时为阻塞查询；键不存在时返回nil
+func (cb *ConsulBackend) get(ctx context.Context, index uint64) ([]byte, uint64, uint64, error) {
+	query := url.Values{}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", cb.Wait.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cb.keyURL(query), nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	resp, err := cb.Client.Do(req)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var kvs []consulKV
+		if err := json.NewDecoder(resp.Body).Decode(&kvs); err != nil {
+			return nil, 0, 0, err
+		}
+		if len(kvs) == 0 {
+			return nil, 0, newIndex, nil
+		}
+		return kvs[0].Value, kvs[0].ModifyIndex, newIndex, nil
+	case http.StatusNotFound:
+		return nil, 0, newIndex, nil
+	default:
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, 0, 0, fmt.Errorf("consul 返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+}
+
+// Load 读取配置及其ModifyIndex
+func (cb *ConsulBackend) Load(ctx context.Context) ([]byte, uint64, error) {
+	data, revision, _, err := cb.get(ctx, 0)
+	return data, revision, err
+}
+
+// Save 以?cas=<ModifyIndex>写入配置，cas=0表示键必须不存在。
+// Consul的写入响应不带新的ModifyIndex，写入后重新读取；读到的已是其他实例写入的数据时
+// 返回原修订号，下次写入会因冲突而先加载最新状态
+func (cb *ConsulBackend) Save(ctx context.Context, data []byte, revision uint64) (uint64, error) {
+	query := url.Values{"cas": {strconv.FormatUint(revision, 10)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, cb.keyURL(query), bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := cb.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("consul 返回 %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if strings.TrimSpace(string(body)) != "true" {
+		return 0, ErrConflict
+	}
+
+	current, modifyIndex, _, err := cb.get(ctx, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(current, data) {
+		return revision, nil
+	}
+	return modifyIndex, nil
+}
+
+// Watch 以阻塞查询等待键变化，X-Consul-Index增长时回调；请求失败时稍后重试
+func (cb *ConsulBackend) Watch(ctx context.Context, onChange func(data []byte, revision uint64)) {
+	_, _, index, err := cb.get(ctx, 0)
+	if err != nil || index == 0 {
+		index = 1
+	}
+
+	for ctx.Err() == nil {
+		data, revision, newIndex, err := cb.get(ctx, index)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		// 索引回退（例如Consul快照恢复）时按官方建议重置
+		if newIndex < index {
+			index = 1
+			continue
+		}
+		if newIndex == index {
+			continue
+		}
+		index = newIndex
+		if len(data) > 0 {
+			onChange(data, revision)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileBackendSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	config := NewRiskConfig()
+	if err := config.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatalf("挂载后端失败: %v", err)
+	}
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.SetConfig("risk_limits", "max_single_amount", 5000.0, "单笔限额", "admin")
+	config.SetConfig("risk_limits", "daily_transaction_count", 50, "每日笔数", "admin")
+	config.DeleteConfig("risk_limits", "daily_transaction_count", "admin")
+
+	// 模拟重启
+	restarted := NewRiskConfig()
+	if err := restarted.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatalf("挂载后端失败: %v", err)
+	}
+	value, err := restarted.GetConfig("risk_limits", "max_single_amount")
+	if err != nil || value != 5000.0 {
+		t.Errorf("重启后期望恢复5000，实际 %v (%v)", value, err)
+	}
+	if _, err := restarted.GetConfig("risk_limits", "daily_transaction_count"); err == nil {
+		t.Error("已删除的配置不应恢复")
+	}
+	if restarted.GetStats()["version"] != 3 {
+		t.Errorf("期望恢复全局版本3，实际%d", restarted.GetStats()["version"])
+	}
+}
+
+func TestFileBackendHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	backend := NewFileBackend(path)
+	backend.PollInterval = 10 * time.Millisecond
+
+	config := NewRiskConfig()
+	config.AttachBackend(context.Background(), backend)
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.SetConfig("risk_limits", "max_single_amount", 5000.0, "单笔限额", "admin")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := config.Watch(ctx, WatchRequest{FromVersion: 1}, 0)
+	go config.StartHotReload(ctx)
+	time.Sleep(30 * time.Millisecond)
+
+	// 手工编辑配置文件
+	data, _ := os.ReadFile(path)
+	var state persistedState
+	json.Unmarshal(data, &state)
+	state.Groups["risk_limits"].Items["max_single_amount"].Value = 3000.0
+	edited, _ := json.Marshal(state)
+	if err := os.WriteFile(path, edited, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != WatchChange || event.Key != "max_single_amount" || event.Value != 3000.0 || event.UpdatedBy != reloadUser {
+			t.Errorf("热加载事件不正确: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到热加载事件")
+	}
+
+	value, _ := config.GetConfig("risk_limits", "max_single_amount")
+	if value != 3000.0 {
+		t.Errorf("期望热加载后为3000，实际%v", value)
+	}
+}
+
+// fakeEtcd 模拟etcd v3 HTTP网关的kv/range和比较mod_revision后写入的kv/txn
+type fakeEtcd struct {
+	mutex     sync.Mutex
+	values    map[string]string
+	revisions map[string]int64
+	revision  int64
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{values: make(map[string]string), revisions: make(map[string]int64)}
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Key     string `json:"key"`
+		Compare []struct {
+			Key         string `json:"key"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"compare"`
+		Success []struct {
+			RequestPut struct {
+				Key   string `json:"key"`
+				Value string `json:"value"`
+			} `json:"request_put"`
+		} `json:"success"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.URL.Path {
+	case "/v3/kv/txn":
+		for _, cmp := range body.Compare {
+			if strconv.FormatInt(f.revisions[cmp.Key], 10) != cmp.ModRevision {
+				json.NewEncoder(w).Encode(map[string]interface{}{"header": map[string]string{"revision": strconv.FormatInt(f.revision, 10)}})
+				return
+			}
+		}
+		f.revision++
+		for _, op := range body.Success {
+			f.values[op.RequestPut.Key] = op.RequestPut.Value
+			f.revisions[op.RequestPut.Key] = f.revision
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"header": map[string]string{"revision": strconv.FormatInt(f.revision, 10)}, "succeeded": true})
+	case "/v3/kv/range":
+		resp := map[string]interface{}{}
+		if value, ok := f.values[body.Key]; ok {
+			resp["kvs"] = []map[string]string{{"key": body.Key, "value": value, "mod_revision": strconv.FormatInt(f.revisions[body.Key], 10)}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestEtcdBackendSharedAcrossInstances(t *testing.T) {
+	etcd := newFakeEtcd()
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	primary := NewRiskConfig()
+	if err := primary.AttachBackend(context.Background(), NewEtcdBackend(server.URL, "")); err != nil {
+		t.Fatalf("挂载后端失败: %v", err)
+	}
+	primary.CreateGroup("blacklist", "黑名单配置")
+	primary.SetConfig("blacklist", "enabled", true, "启用黑名单", "admin")
+
+	if _, ok := etcd.values[base64.StdEncoding.EncodeToString([]byte(DefaultBackendKey))]; !ok {
+		t.Fatal("配置应写入默认键")
+	}
+
+	backend := NewEtcdBackend(server.URL, "")
+	backend.PollInterval = 10 * time.Millisecond
+	replica := NewRiskConfig()
+	replica.AttachBackend(context.Background(), backend)
+	if value, _ := replica.GetConfig("blacklist", "enabled"); value != true {
+		t.Errorf("第二个实例应读到共享配置，实际%v", value)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go replica.StartHotReload(ctx)
+	time.Sleep(30 * time.Millisecond)
+
+	primary.SetConfig("blacklist", "enabled", false, "关闭黑名单", "admin")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if value, _ := replica.GetConfig("blacklist", "enabled"); value == false {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("第二个实例未热加载其他实例的修改")
+}
+
+// fakeConsul 模拟Consul KV接口，支持?cas=写入和阻塞查询
+type fakeConsul struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	values   map[string][]byte
+	modified map[string]uint64
+	index    uint64
+}
+
+func newFakeConsul() *fakeConsul {
+	f := &fakeConsul{values: make(map[string][]byte), modified: make(map[string]uint64), index: 1}
+	f.cond = sync.NewCond(&f.mutex)
+	return f
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if cas := r.URL.Query().Get("cas"); cas != "" && cas != strconv.FormatUint(f.modified[key], 10) {
+			w.Write([]byte("false"))
+			return
+		}
+		f.index++
+		f.values[key] = data
+		f.modified[key] = f.index
+		f.cond.Broadcast()
+		w.Write([]byte("true"))
+	case http.MethodGet:
+		if wait := r.URL.Query().Get("index"); wait != "" {
+			// 客户端断开时唤醒挂起的阻塞查询，让测试服务器可以关闭
+			stop := context.AfterFunc(r.Context(), func() {
+				f.mutex.Lock()
+				defer f.mutex.Unlock()
+				f.cond.Broadcast()
+			})
+			defer stop()
+			index, _ := strconv.ParseUint(wait, 10, 64)
+			for f.index <= index && r.Context().Err() == nil {
+				f.cond.Wait()
+			}
+		}
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		data, ok := f.values[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]interface{}{{"Key": key, "Value": data, "ModifyIndex": f.modified[key]}})
+	}
+}
+
+func TestConsulBackendBlockingWatch(t *testing.T) {
+	consul := newFakeConsul()
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	primary := NewRiskConfig()
+	primary.AttachBackend(context.Background(), NewConsulBackend(server.URL, "risk/config"))
+	primary.CreateGroup("risk_limits", "风控限额配置")
+	primary.SetConfig("risk_limits", "max_daily_amount", 10000.0, "每日限额", "admin")
+
+	replica := NewRiskConfig()
+	replica.AttachBackend(context.Background(), NewConsulBackend(server.URL, "risk/config"))
+	if value, _ := replica.GetConfig("risk_limits", "max_daily_amount"); value != 10000.0 {
+		t.Fatalf("第二个实例应读到共享配置，实际%v", value)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := replica.Watch(ctx, WatchRequest{FromVersion: 1}, 0)
+	go replica.StartHotReload(ctx)
+	time.Sleep(30 * time.Millisecond)
+
+	primary.SetConfig("risk_limits", "max_daily_amount", 20000.0, "每日限额", "admin")
+	select {
+	case event := <-events:
+		if event.Value != 20000.0 || event.OldValue != 10000.0 {
+			t.Errorf("热加载事件不正确: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("阻塞查询未收到变更")
+	}
+
+	cancel()
+}
+
+// failingBackend 写入总是失败的后端
+type failingBackend struct{}
+
+func (failingBackend) Load(ctx context.Context) ([]byte, uint64, error) { return nil, 0, nil }
+
+func (failingBackend) Save(ctx context.Context, data []byte, revision uint64) (uint64, error) {
+	return 0, errors.New("磁盘已满")
+}
+
+func (failingBackend) Watch(ctx context.Context, onChange func(data []byte, revision uint64)) {}
+
+func TestBackendSaveFailureRollsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := NewRiskConfig()
+	config.AttachBackend(context.Background(), NewFileBackend(path))
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.SetConfig("risk_limits", "max_amount", 1000, "", "admin")
+
+	listener := &batchRecorder{}
+	config.AddListener(listener)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := config.Watch(ctx, WatchRequest{FromVersion: 1}, 0)
+
+	config.mutex.Lock()
+	config.backend = failingBackend{}
+	config.mutex.Unlock()
+
+	if err := config.SetConfig("risk_limits", "max_amount", 2000, "", "ops"); err == nil {
+		t.Fatal("写入后端失败时应返回错误")
+	}
+	if err := config.CreateGroup("blacklist", "黑名单"); err == nil {
+		t.Fatal("写入后端失败时应返回错误")
+	}
+
+	if value, _ := config.GetConfig("risk_limits", "max_amount"); value != 1000.0 {
+		t.Errorf("写入失败后应恢复原值，实际%v", value)
+	}
+	if _, err := config.GetGroup("blacklist"); err == nil {
+		t.Error("写入失败后不应保留新建的配置组")
+	}
+	if stats := config.GetStats(); stats["version"] != 1 || stats["history"] != 1 {
+		t.Errorf("写入失败后版本和历史应不变: %v", stats)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("写入失败的变更不应推送: %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+	listener.mu.Lock()
+	defer listener.mu.Unlock()
+	if len(listener.batches) != 0 {
+		t.Errorf("写入失败的变更不应通知监听器: %v", listener.batches)
+	}
+}
+
+func TestSharedBackendConcurrentWriters(t *testing.T) {
+	backends := map[string]func(url string) Backend{
+		"etcd":   func(url string) Backend { return NewEtcdBackend(url, "") },
+		"consul": func(url string) Backend { return NewConsulBackend(url, "") },
+	}
+	servers := map[string]http.Handler{"etcd": newFakeEtcd(), "consul": newFakeConsul()}
+
+	for name, newBackend := range backends {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(servers[name])
+			defer server.Close()
+
+			first := NewRiskConfig()
+			first.AttachBackend(context.Background(), newBackend(server.URL))
+			first.CreateGroup("risk_limits", "风控限额配置")
+			second := NewRiskConfig()
+			second.AttachBackend(context.Background(), newBackend(server.URL))
+
+			// 两个实例都没有热加载，second基于过期的状态写入
+			first.SetConfig("risk_limits", "max_amount", 1000, "", "alice")
+			if err := second.SetConfig("risk_limits", "max_count", 50, "", "bob"); err != nil {
+				t.Fatalf("冲突后应重新加载并重试: %v", err)
+			}
+
+			if value, _ := second.GetConfig("risk_limits", "max_amount"); value != 1000.0 {
+				t.Errorf("重试前应加载其他实例的修改，实际%v", value)
+			}
+			restarted := NewRiskConfig()
+			restarted.AttachBackend(context.Background(), newBackend(server.URL))
+			amount, _ := restarted.GetConfig("risk_limits", "max_amount")
+			count, _ := restarted.GetConfig("risk_limits", "max_count")
+			if amount != 1000.0 || count != 50.0 {
+				t.Errorf("后端应保留两个实例的修改，实际 max_amount=%v max_count=%v", amount, count)
+			}
+		})
+	}
+}
+
+// waitForVersion 等待热加载把配置中心推进到指定全局版本
+func waitForVersion(t *testing.T, config *RiskConfig, version int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for config.GetStats()["version"] < version {
+		if time.Now().After(deadline) {
+			t.Fatalf("热加载超时，期望版本%d，实际%d", version, config.GetStats()["version"])
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHotReloadAdoptsSharedHistory(t *testing.T) {
+	server := httptest.NewServer(newFakeEtcd())
+	defer server.Close()
+	newBackend := func() Backend {
+		backend := NewEtcdBackend(server.URL, "")
+		backend.PollInterval = 5 * time.Millisecond
+		return backend
+	}
+
+	primary := NewRiskConfig()
+	primary.AttachBackend(context.Background(), newBackend())
+	primary.CreateGroup("risk_limits", "风控限额配置")
+	replica := NewRiskConfig()
+	replica.AttachBackend(context.Background(), newBackend())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go primary.StartHotReload(ctx)
+	go replica.StartHotReload(ctx)
+	time.Sleep(20 * time.Millisecond)
+
+	primary.SetConfig("risk_limits", "max_amount", 1000, "", "alice")
+	waitForVersion(t, replica, 1)
+	replica.SetConfig("risk_limits", "max_amount", 2000, "", "bob")
+	waitForVersion(t, primary, 2)
+
+	// 两个实例的版本号和变更历史一致，保留真实的更新者
+	for name, config := range map[string]*RiskConfig{"primary": primary, "replica": replica} {
+		history := config.GetHistory(0)
+		if len(history) != 2 || history[0].UpdatedBy != "alice" || history[1].UpdatedBy != "bob" ||
+			history[0].Version != 1 || history[1].Version != 2 {
+			t.Errorf("%s 的变更历史不正确: %+v %+v", name, history[0], history[len(history)-1])
+		}
+		if version := config.GetStats()["version"]; version != 2 {
+			t.Errorf("%s 的全局版本应为2，实际%d", name, version)
+		}
+	}
+
+	// 热加载的Watch事件带有原始的版本号和更新者，列表变更补全完整的值
+	events := replica.Watch(ctx, WatchRequest{FromVersion: 2}, 0)
+	primary.CreateList("risk_limits", "blocked", []string{"u1"}, ListOptions{}, "carol")
+	primary.AddToList("risk_limits", "blocked", []string{"u2"}, "carol")
+	for _, want := range []struct {
+		version int
+		members int
+	}{{3, 1}, {4, 2}} {
+		select {
+		case event := <-events:
+			members, _ := event.Value.([]interface{})
+			if event.Version != want.version || event.UpdatedBy != "carol" || len(members) != want.members {
+				t.Errorf("热加载事件不正确: %+v", event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("未收到版本%d的热加载事件", want.version)
+		}
+	}
+	if ok, _ := replica.Contains("risk_limits", "blocked", "u2"); !ok {
+		t.Error("热加载后列表应包含新成员")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 客户端接收变更的方式
+const (
+	ClientPush     = "push" // 订阅 GET /watch 流，服务端推送变更
+	ClientLongPoll = "poll" // 循环请求 GET /poll 长轮询
+)
+
+// ErrNoConfig 首次加载时服务端不可达，且没有可用的本地缓存
+var ErrNoConfig = errors.New("配置中心不可达且没有本地缓存")
+
+// ClientStatus 客户端同步状态
+type ClientStatus struct {
+	Version   int       `json:"version"`
+	Connected bool      `json:"connected"` // 最近一次与服务端通信是否成功
+	Stale     bool      `json:"stale"`     // 当前值是否来自本地缓存或断线前的最后已知值
+	LastSync  time.Time `json:"last_sync"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// clientCache 写入缓存文件的内容
+type clientCache struct {
+	Version int      `json:"version"`
+	Values  Snapshot `json:"values"`
+}
+
+// ConfigClient 配置中心客户端：在本地缓存配置值，通过推送或长轮询保持更新。
+// 服务端不可达时继续使用最后已知的值，设置CacheFile后进程重启时也能离线启动
+type ConfigClient struct {
+	BaseURL       string
+	Groups        []string // 只同步指定配置组，为空表示全部
+	Mode          string
+	CacheFile     string
+	PollTimeout   time.Duration
+	Heartbeat     time.Duration
+	RetryInterval time.Duration
+	HTTPClient    *http.Client
+
+	mutex     sync.RWMutex
+	values    Snapshot
+	version   int
+	connected bool
+	stale     bool
+	lastSync  time.Time
+	lastErr   error
+	onChange  []func(WatchEvent)
+}
+
+// NewConfigClient 创建客户端，默认使用推送方式
+func NewConfigClient(baseURL string, groups ...string) *ConfigClient {
+	return &ConfigClient{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		Groups:        groups,
+		Mode:          ClientPush,
+		PollTimeout:   30 * time.Second,
+		Heartbeat:     10 * time.Second,
+		RetryInterval: time.Second,
+		HTTPClient:    &http.Client{},
+		values:        make(Snapshot),
+	}
+}
+
+// OnChange 注册变更回调，收到快照或变更事件并更新本地缓存后调用
+func (c *ConfigClient) OnChange(fn func(WatchEvent)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// Start 加载初始配置并在后台保持同步，直到ctx取消。
+// 服务端不可达时从CacheFile加载最后已知的值，两者都不可用时返回ErrNoConfig
+func (c *ConfigClient) Start(ctx context.Context) error {
+	if err := c.fetch(ctx); err != nil {
+		c.setError(err)
+		if cacheErr := c.loadCache(); cacheErr != nil {
+			return fmt.Errorf("%w: %v", ErrNoConfig, err)
+		}
+		fmt.Printf("配置中心不可达，使用本地缓存的版本 %d: %v\n", c.Version(), err)
+	}
+
+	go c.run(ctx)
+	return nil
+}
+
+// Get 读取本地缓存中的配置值
+func (c *ConfigClient) Get(groupName, key string) (interface{}, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	value, exists := c.values[groupName][key]
+	return value, exists
+}
+
+// GetFloat 读取数值配置，不存在或不是数值时返回defaultValue
+func (c *ConfigClient) GetFloat(groupName, key string, defaultValue float64) float64 {
+	value, exists := c.Get(groupName, key)
+	if !exists {
+		return defaultValue
+	}
+	number, ok := toFloat(value)
+	if !ok {
+		return defaultValue
+	}
+	return number
+}
+
+// Snapshot 返回本地缓存的全部配置值的副本
+func (c *ConfigClient) Snapshot() Snapshot {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	copied := make(Snapshot, len(c.values))
+	for group, items := range c.values {
+		copied[group] = make(map[string]interface{}, len(items))
+		for key, value := range items {
+			copied[group][key] = value
+		}
+	}
+	return copied
+}
+
+// Version 返回本地缓存的配置版本
+func (c *ConfigClient) Version() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.version
+}
+
+// Status 返回同步状态
+func (c *ConfigClient) Status() ClientStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	status := ClientStatus{Version: c.version, Connected: c.connected, Stale: c.stale, LastSync: c.lastSync}
+	if c.lastErr != nil {
+		status.LastError = c.lastErr.Error()
+	}
+	return status
+}
+
+// run 按Mode保持同步，出错后等待RetryInterval重试
+func (c *ConfigClient) run(ctx context.Context) {
+	for {
+		var err error
+		if c.Mode == ClientLongPoll {
+			err = c.poll(ctx)
+		} else {
+			err = c.watch(ctx)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			c.setError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.RetryInterval):
+		}
+	}
+}
+
+func (c *ConfigClient) groupsParam(query url.Values) {
+	if len(c.Groups) > 0 {
+		query.Set("groups", strings.Join(c.Groups, ","))
+	}
+}
+
+// fetch 通过 GET /configs 加载全量配置
+func (c *ConfigClient) fetch(ctx context.Context) error {
+	query := url.Values{}
+	c.groupsParam(query)
+	resp, err := c.get(ctx, "/configs", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body ConfigsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("解析配置失败: %v", err)
+	}
+	c.apply([]WatchEvent{{Type: WatchSnapshot, Version: body.Version, Snapshot: body.Values, Timestamp: time.Now()}})
+	return nil
+}
+
+// poll 发起一次长轮询，超时未变更时返回nil
+func (c *ConfigClient) poll(ctx context.Context) error {
+	query := url.Values{}
+	query.Set("version", strconv.Itoa(c.Version()))
+	query.Set("timeout", c.PollTimeout.String())
+	c.groupsParam(query)
+
+	resp, err := c.get(ctx, "/poll", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		c.markSynced()
+		return nil
+	}
+
+	var body PollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("解析长轮询响应失败: %v", err)
+	}
+	c.apply(body.Events)
+	return nil
+}
+
+// watch 订阅 GET /watch 流直到连接断开
+func (c *ConfigClient) watch(ctx context.Context) error {
+	query := url.Values{}
+	query.Set("from_version", strconv.Itoa(c.Version()))
+	query.Set("heartbeat", c.Heartbeat.String())
+	c.groupsParam(query)
+
+	resp, err := c.get(ctx, "/watch", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event WatchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("解析配置事件失败: %v", err)
+		}
+		if event.Type == WatchHeartbeat {
+			c.markSynced()
+			continue
+		}
+		c.apply([]WatchEvent{event})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("配置中心关闭了订阅连接")
+}
+
+func (c *ConfigClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotModified {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s 返回状态码 %d", path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// apply 把事件应用到本地缓存，写入缓存文件并调用变更回调
+func (c *ConfigClient) apply(events []WatchEvent) {
+	c.mutex.Lock()
+	for _, event := range events {
+		switch event.Type {
+		case WatchSnapshot:
+			c.values = make(Snapshot, len(event.Snapshot))
+			for group, items := range event.Snapshot {
+				c.values[group] = make(map[string]interface{}, len(items))
+				for key, value := range items {
+					c.values[group][key] = value
+				}
+			}
+		case WatchChange:
+			if event.Deleted {
+				delete(c.values[event.Group], event.Key)
+			} else {
+				if c.values[event.Group] == nil {
+					c.values[event.Group] = make(map[string]interface{})
+				}
+				if event.Value == nil && event.List != nil {
+					c.values[event.Group][event.Key] = applyListDelta(c.values[event.Group][event.Key], event.List)
+				} else {
+					c.values[event.Group][event.Key] = event.Value
+				}
+			}
+		}
+		if event.Version > c.version || event.Type == WatchSnapshot {
+			c.version = event.Version
+		}
+	}
+	c.connected, c.stale, c.lastErr = true, false, nil
+	c.lastSync = time.Now()
+	callbacks := append([]func(WatchEvent){}, c.onChange...)
+	cacheErr := c.saveCacheLocked()
+	c.mutex.Unlock()
+
+	if cacheErr != nil {
+		fmt.Printf("写入配置缓存失败: %v\n", cacheErr)
+	}
+	for _, event := range events {
+		for _, fn := range callbacks {
+			fn(event)
+		}
+	}
+}
+
+func (c *ConfigClient) markSynced() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connected, c.stale, c.lastErr = true, false, nil
+	c.lastSync = time.Now()
+}
+
+// setError 记录通信失败，本地缓存的值保持不变并标记为过期
+func (c *ConfigClient) setError(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.connected, c.stale, c.lastErr = false, true, err
+}
+
+// saveCacheLocked 把本地缓存写入CacheFile，调用方需持有写锁
+func (c *ConfigClient) saveCacheLocked() error {
+	if c.CacheFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(clientCache{Version: c.version, Values: c.values})
+	if err != nil {
+		return err
+	}
+	tmp := c.CacheFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.CacheFile)
+}
+
+// loadCache 从CacheFile加载最后已知的配置
+func (c *ConfigClient) loadCache() error {
+	if c.CacheFile == "" {
+		return errors.New("未设置缓存文件")
+	}
+	data, err := os.ReadFile(c.CacheFile)
+	if err != nil {
+		return err
+	}
+	var cache clientCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return fmt.Errorf("解析缓存文件失败: %v", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values = cache.Values
+	if c.values == nil {
+		c.values = make(Snapshot)
+	}
+	c.version = cache.Version
+	c.stale = true
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待条件超时")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConfigClientPush(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("blacklist", "黑名单")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	config.SetConfig("blacklist", "users", []interface{}{"u1"}, "", "admin")
+	server := httptest.NewServer(NewConfigServer(config))
+	defer server.Close()
+
+	client := NewConfigClient(server.URL, "risk_limits")
+	var mu sync.Mutex
+	var events []WatchEvent
+	client.OnChange(func(event WatchEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if client.GetFloat("risk_limits", "max_amount", 0) != 1000 || client.Version() != 2 {
+		t.Fatalf("初始加载不正确: version=%d", client.Version())
+	}
+	if _, exists := client.Get("blacklist", "users"); exists {
+		t.Error("未订阅的配置组不应加载")
+	}
+
+	config.SetConfig("risk_limits", "max_amount", 2000.0, "", "admin")
+	config.SetConfig("blacklist", "users", []interface{}{"u2"}, "", "admin")
+	config.SetConfig("risk_limits", "mode", "strict", "", "admin")
+	config.DeleteConfig("risk_limits", "max_amount", "admin")
+	waitUntil(t, func() bool { return client.Version() == 6 })
+
+	if _, exists := client.Get("risk_limits", "max_amount"); exists {
+		t.Error("删除的配置项应从本地缓存移除")
+	}
+	if value, _ := client.Get("risk_limits", "mode"); value != "strict" {
+		t.Errorf("推送的变更未应用: %v", value)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 4 || events[0].Type != WatchSnapshot || events[3].Key != "max_amount" || !events[3].Deleted {
+		t.Errorf("变更回调不正确: %+v", events)
+	}
+	if status := client.Status(); !status.Connected || status.Stale {
+		t.Errorf("同步状态不正确: %+v", status)
+	}
+}
+
+func TestConfigClientLongPoll(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	server := httptest.NewServer(NewConfigServer(config))
+	defer server.Close()
+
+	// 没有新变更时等待到超时返回304
+	resp, err := http.Get(server.URL + "/poll?version=1&timeout=50ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("无变更时期望304，实际%d", resp.StatusCode)
+	}
+	if resp, _ := http.Get(server.URL + "/poll?version=x"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("无效的version应返回400，实际%d", resp.StatusCode)
+	}
+
+	client := NewConfigClient(server.URL)
+	client.Mode = ClientLongPoll
+	client.PollTimeout = 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(150 * time.Millisecond) // 至少经历一次超时的长轮询
+	config.SetConfig("risk_limits", "max_amount", 3000.0, "", "admin")
+	config.SetConfig("risk_limits", "count", 5, "", "admin")
+	waitUntil(t, func() bool { return client.Version() == 3 })
+	if client.GetFloat("risk_limits", "max_amount", 0) != 3000 || client.GetFloat("risk_limits", "count", 0) != 5 {
+		t.Errorf("长轮询的变更未应用: %v", client.Snapshot())
+	}
+}
+
+func TestConfigClientFallback(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "client-cache.json")
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	server := httptest.NewServer(NewConfigServer(config))
+
+	client := NewConfigClient(server.URL)
+	client.CacheFile = cacheFile
+	client.RetryInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := client.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	config.SetConfig("risk_limits", "max_amount", 1500.0, "", "admin")
+	waitUntil(t, func() bool { return client.Version() == 2 })
+
+	// 服务端不可达后继续使用最后已知的值
+	server.CloseClientConnections()
+	server.Close()
+	waitUntil(t, func() bool { return client.Status().Stale })
+	if status := client.Status(); status.Connected || status.LastError == "" || client.GetFloat("risk_limits", "max_amount", 0) != 1500 {
+		t.Errorf("断线后应保留最后已知的值: %+v", status)
+	}
+
+	// 新进程在服务端不可达时从缓存文件启动
+	offline := NewConfigClient(server.URL)
+	offline.CacheFile = cacheFile
+	offline.RetryInterval = time.Hour
+	if err := offline.Start(ctx); err != nil {
+		t.Fatalf("应从缓存启动: %v", err)
+	}
+	if offline.GetFloat("risk_limits", "max_amount", 0) != 1500 || offline.Version() != 2 || !offline.Status().Stale {
+		t.Errorf("缓存加载不正确: %+v %v", offline.Status(), offline.Snapshot())
+	}
+
+	empty := NewConfigClient(server.URL)
+	if err := empty.Start(ctx); !errors.Is(err, ErrNoConfig) {
+		t.Errorf("没有缓存时期望ErrNoConfig，实际 %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RetryableListener 可选的监听器接口：返回error表示处理失败，按投递策略重试。
+// 实现它的监听器收到HandleConfigChange而不是OnConfigChange
+type RetryableListener interface {
+	HandleConfigChange(change *ConfigChange) error
+}
+
+// DeliveryPolicy 监听器通知的重试策略。处理失败（返回error或panic）后
+// 等待Backoff重试，之后每次等待时间翻倍，MaxAttempts次都失败时写入死信记录
+type DeliveryPolicy struct {
+	MaxAttempts int           // 每个通知最多投递次数，包含首次投递
+	Backoff     time.Duration // 首次重试前的等待时间
+}
+
+// DefaultDeliveryPolicy 默认的重试策略
+var DefaultDeliveryPolicy = DeliveryPolicy{MaxAttempts: 3, Backoff: 100 * time.Millisecond}
+
+// maxDeadLetters 最多保留的死信记录数
+const maxDeadLetters = 1000
+
+// DeadLetter 重试耗尽后仍未成功投递的通知
+type DeadLetter struct {
+	Listener string        `json:"listener"` // 监听器类型
+	Change   *ConfigChange `json:"change"`
+	Attempts int           `json:"attempts"`
+	Error    string        `json:"error"`
+	FailedAt time.Time     `json:"failed_at"`
+}
+
+// listenerQueue 单个监听器的投递队列：由一个goroutine按版本顺序逐个投递，
+// 前一个通知处理完（成功或进入死信）之后才投递下一个，慢监听器不影响其他监听器
+type listenerQueue struct {
+	listener ConfigListener
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	pending  []*ConfigChange
+	busy     bool
+}
+
+func newListenerQueue(listener ConfigListener) *listenerQueue {
+	q := &listenerQueue{listener: listener}
+	q.cond = sync.NewCond(&q.mutex)
+	return q
+}
+
+func (q *listenerQueue) push(change *ConfigChange) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, change)
+	q.cond.Signal()
+}
+
+// backlog 返回尚未处理完的通知数
+func (q *listenerQueue) backlog() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.busy {
+		return len(q.pending) + 1
+	}
+	return len(q.pending)
+}
+
+// run 按入队顺序投递通知
+func (q *listenerQueue) run(rc *RiskConfig) {
+	for {
+		q.mutex.Lock()
+		for len(q.pending) == 0 {
+			q.busy = false
+			q.cond.Wait()
+		}
+		change := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.busy = true
+		q.mutex.Unlock()
+
+		rc.deliver(q.listener, change)
+	}
+}
+
+// deliver 把一条变更记录投递给监听器。实现了BatchListener的监听器对事务只收到一次批量通知，
+// 其他监听器按事务中的顺序逐项收到通知，每一项单独重试
+func (rc *RiskConfig) deliver(listener ConfigListener, change *ConfigChange) {
+	rc.mutex.RLock()
+	policy := rc.delivery
+	rc.mutex.RUnlock()
+
+	if batch, ok := listener.(BatchListener); ok && change.Ops != nil {
+		rc.retry(policy, listener, change, func() error {
+			batch.OnConfigBatch(change.Ops)
+			return nil
+		})
+		return
+	}
+	for _, op := range change.Changes() {
+		op := op
+		rc.retry(policy, listener, op, func() error {
+			if retryable, ok := listener.(RetryableListener); ok {
+				return retryable.HandleConfigChange(op)
+			}
+			listener.OnConfigChange(op.GroupName, op.Key, op.OldValue, op.NewValue)
+			return nil
+		})
+	}
+}
+
+// retry 按策略调用handle直到成功，重试耗尽时写入死信记录
+func (rc *RiskConfig) retry(policy DeliveryPolicy, listener ConfigListener, change *ConfigChange, handle func() error) {
+	backoff := policy.Backoff
+	var err error
+	attempts := 0
+	for attempts < policy.MaxAttempts {
+		if attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		attempts++
+		if err = safeCall(handle); err == nil {
+			rc.metrics.observeLatency(time.Since(change.Timestamp))
+			return
+		}
+		rc.metrics.listenerError(fmt.Sprintf("%T", listener))
+		fmt.Printf("监听器 %T 处理变更 %s.%s (版本 %d) 失败，第%d次: %v\n", listener, change.GroupName, change.Key, change.Version, attempts, err)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.deadLetters = append(rc.deadLetters, &DeadLetter{
+		Listener: fmt.Sprintf("%T", listener),
+		Change:   change,
+		Attempts: attempts,
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+	})
+	if len(rc.deadLetters) > maxDeadLetters {
+		rc.deadLetters = rc.deadLetters[1:]
+	}
+}
+
+// safeCall 调用handle，把panic转换为error
+func safeCall(handle func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handle()
+}
+
+// SetDeliveryPolicy 设置监听器通知的重试策略，对之后开始投递的通知生效
+func (rc *RiskConfig) SetDeliveryPolicy(policy DeliveryPolicy) error {
+	if policy.MaxAttempts < 1 || policy.Backoff < 0 {
+		return fmt.Errorf("无效的投递策略: %+v", policy)
+	}
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.delivery = policy
+	return nil
+}
+
+// DeadLetters 返回重试耗尽的通知，按时间从旧到新排列
+func (rc *RiskConfig) DeadLetters() []*DeadLetter {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	return append([]*DeadLetter(nil), rc.deadLetters...)
+}
+
+// enqueueListenersLocked 把变更记录放入每个监听器的投递队列。
+// 在持有写锁时入队，队列中的顺序与版本号顺序一致
+func (rc *RiskConfig) enqueueListenersLocked(change *ConfigChange) {
+	for _, q := range rc.listeners {
+		q.push(change)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// retryableRecorder 按配置项键决定失败次数的监听器
+type retryableRecorder struct {
+	mu       sync.Mutex
+	failures map[string]int // 键 -> 剩余失败次数，负数表示一直失败
+	panics   bool           // 失败时panic而不是返回error
+	received []string
+	attempts map[string]int
+}
+
+func (r *retryableRecorder) OnConfigChange(groupName, key string, oldValue, newValue interface{}) {}
+
+func (r *retryableRecorder) HandleConfigChange(change *ConfigChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[change.Key]++
+	if left := r.failures[change.Key]; left != 0 {
+		r.failures[change.Key] = left - 1
+		if r.panics {
+			panic("处理失败 " + change.Key)
+		}
+		return errors.New("处理失败 " + change.Key)
+	}
+	r.received = append(r.received, change.Key)
+	return nil
+}
+
+func (r *retryableRecorder) snapshot() ([]string, map[string]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempts := make(map[string]int, len(r.attempts))
+	for key, n := range r.attempts {
+		attempts[key] = n
+	}
+	return append([]string(nil), r.received...), attempts
+}
+
+func TestListenerOrderedDelivery(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+
+	var mu sync.Mutex
+	var slow, fast []interface{}
+	config.AddListener(&testListener{onChange: func(group, key string, oldValue, newValue interface{}) {
+		time.Sleep(time.Millisecond) // 慢监听器也按顺序收到每一个变更
+		mu.Lock()
+		defer mu.Unlock()
+		slow = append(slow, newValue)
+	}})
+	config.AddListener(&testListener{onChange: func(group, key string, oldValue, newValue interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fast = append(fast, newValue)
+	}})
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		config.SetConfig("risk_limits", "max_amount", i, "", "admin")
+	}
+	waitUntil(t, func() bool { return config.GetStats()["pending_notifications"] == 0 })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(slow) != n || len(fast) != n {
+		t.Fatalf("每个监听器应收到%d个通知，实际 %d / %d", n, len(slow), len(fast))
+	}
+	for i := 0; i < n; i++ {
+		if slow[i] != i || fast[i] != i {
+			t.Fatalf("第%d个通知乱序: %v / %v", i, slow[i], fast[i])
+		}
+	}
+}
+
+func TestListenerRetryAndPanicRecovery(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	if err := config.SetDeliveryPolicy(DeliveryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	failing := &retryableRecorder{failures: map[string]int{"max_amount": 2}, attempts: map[string]int{}}
+	panicking := &retryableRecorder{failures: map[string]int{"max_amount": 1}, panics: true, attempts: map[string]int{}}
+	config.AddListener(failing)
+	config.AddListener(panicking)
+
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	config.SetConfig("risk_limits", "mode", "strict", "", "admin")
+	waitUntil(t, func() bool { return config.GetStats()["pending_notifications"] == 0 })
+
+	for name, listener := range map[string]*retryableRecorder{"error": failing, "panic": panicking} {
+		received, attempts := listener.snapshot()
+		if len(received) != 2 || received[0] != "max_amount" || received[1] != "mode" {
+			t.Errorf("%s: 重试成功后应按顺序收到全部通知: %v", name, received)
+		}
+		if attempts["mode"] != 1 {
+			t.Errorf("%s: 成功的通知不应重试: %v", name, attempts)
+		}
+	}
+	if _, attempts := failing.snapshot(); attempts["max_amount"] != 3 {
+		t.Errorf("失败两次后第三次应成功: %v", attempts)
+	}
+	if letters := config.DeadLetters(); len(letters) != 0 {
+		t.Errorf("重试成功的通知不应进入死信: %+v", letters)
+	}
+	if err := config.SetDeliveryPolicy(DeliveryPolicy{}); err == nil {
+		t.Error("MaxAttempts为0的策略应被拒绝")
+	}
+}
+
+func TestListenerDeadLetter(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetDeliveryPolicy(DeliveryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	broken := &retryableRecorder{failures: map[string]int{"max_amount": -1}, attempts: map[string]int{}}
+	config.AddListener(broken)
+	batch := &batchRecorder{}
+	config.AddListener(&panickingBatch{batchRecorder: batch})
+
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	config.Txn().Set("risk_limits", "mode", "strict", "").Set("risk_limits", "count", 5, "").Commit("admin")
+	waitUntil(t, func() bool { return config.GetStats()["pending_notifications"] == 0 })
+
+	// 一直失败的通知进入死信，不阻塞之后的通知
+	received, attempts := broken.snapshot()
+	if attempts["max_amount"] != 2 || len(received) != 2 || received[0] != "mode" {
+		t.Errorf("重试耗尽后应继续投递后续通知: %v %v", received, attempts)
+	}
+	letters := config.DeadLetters()
+	if len(letters) != 2 || config.GetStats()["dead_letters"] != 2 {
+		t.Fatalf("期望2条死信，实际 %+v", letters)
+	}
+	var fromBroken, fromBatch *DeadLetter
+	for _, letter := range letters {
+		switch letter.Listener {
+		case fmt.Sprintf("%T", broken):
+			fromBroken = letter
+		case fmt.Sprintf("%T", &panickingBatch{}):
+			fromBatch = letter
+		}
+	}
+	if fromBroken == nil || fromBroken.Change.Key != "max_amount" || fromBroken.Attempts != 2 || fromBroken.Error != "处理失败 max_amount" {
+		t.Errorf("死信记录不正确: %+v", fromBroken)
+	}
+	if fromBatch == nil || len(fromBatch.Change.Ops) != 2 || fromBatch.Error != "panic: 批量处理失败" {
+		t.Errorf("批量通知的死信应包含整个事务: %+v", fromBatch)
+	}
+}
+
+// panickingBatch 处理事务时一直panic的批量监听器
+type panickingBatch struct {
+	*batchRecorder
+}
+
+func (p *panickingBatch) OnConfigBatch(changes []*ConfigChange) {
+	panic("批量处理失败")
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultEnvironment 基础环境，即配置组中保存的配置；其他环境逐层覆盖其父环境
+const DefaultEnvironment = "default"
+
+// Environment 配置环境，只保存相对父环境的覆盖值，例如 default → staging → prod
+type Environment struct {
+	Name      string                            `json:"name"`
+	Parent    string                            `json:"parent"`
+	Overrides map[string]map[string]*ConfigItem `json:"overrides"` // 配置组 -> 键 -> 覆盖值
+}
+
+// EnvDiff 两个环境中解析结果不同的配置项
+type EnvDiff struct {
+	Group   string      `json:"group"`
+	Key     string      `json:"key"`
+	ValueA  interface{} `json:"value_a,omitempty"`
+	ValueB  interface{} `json:"value_b,omitempty"`
+	InA     bool        `json:"in_a"`
+	InB     bool        `json:"in_b"`
+	SourceA string      `json:"source_a,omitempty"` // 值在A的继承链中来自哪个环境
+	SourceB string      `json:"source_b,omitempty"`
+}
+
+// CreateEnvironment 创建继承parent的环境，parent为空时继承default
+func (rc *RiskConfig) CreateEnvironment(name, parent string) error {
+	if parent == "" {
+		parent = DefaultEnvironment
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		if name == "" || name == DefaultEnvironment || rc.envs[name] != nil {
+			return fmt.Errorf("环境 %s 已存在", name)
+		}
+		if parent != DefaultEnvironment && rc.envs[parent] == nil {
+			return fmt.Errorf("父环境 %s 不存在", parent)
+		}
+
+		rc.envs[name] = &Environment{Name: name, Parent: parent, Overrides: make(map[string]map[string]*ConfigItem)}
+		fmt.Printf("创建环境: %s (继承 %s)\n", name, parent)
+		return nil
+	})
+}
+
+// EnvironmentChain 返回环境的继承链，从自身到default
+func (rc *RiskConfig) EnvironmentChain(env string) ([]string, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	return rc.envChainLocked(env)
+}
+
+func (rc *RiskConfig) envChainLocked(env string) ([]string, error) {
+	var chain []string
+	for env != DefaultEnvironment {
+		e, exists := rc.envs[env]
+		if !exists {
+			return nil, fmt.Errorf("环境 %s 不存在", env)
+		}
+		chain = append(chain, env)
+		env = e.Parent
+	}
+	return append(chain, DefaultEnvironment), nil
+}
+
+// resolveLocked 沿继承链查找配置项，返回配置项和定义它的环境。调用方需持有锁
+func (rc *RiskConfig) resolveLocked(env, groupName, key string) (*ConfigItem, string, error) {
+	chain, err := rc.envChainLocked(env)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, exists := rc.groups[groupName]; !exists {
+		return nil, "", fmt.Errorf("配置组 %s 不存在", groupName)
+	}
+	for _, name := range chain {
+		var item *ConfigItem
+		if name == DefaultEnvironment {
+			item = rc.groups[groupName].Items[key]
+		} else {
+			item = rc.envs[name].Overrides[groupName][key]
+		}
+		if item != nil {
+			return item, name, nil
+		}
+	}
+	return nil, "", fmt.Errorf("配置项 %s.%s 在环境 %s 中不存在", groupName, key, env)
+}
+
+// ResolveConfig 获取配置项在环境中的生效值，同时返回值来自继承链中的哪个环境
+func (rc *RiskConfig) ResolveConfig(env, groupName, key string) (interface{}, string, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	rc.metrics.read(groupName)
+
+	item, source, err := rc.resolveLocked(env, groupName, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return item.Value, source, nil
+}
+
+// resolvedValuesLocked 计算环境中所有配置组的生效值，调用方需持有锁
+func (rc *RiskConfig) resolvedValuesLocked(env string) (map[string]map[string]*ConfigItem, map[string]map[string]string, error) {
+	chain, err := rc.envChainLocked(env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]map[string]*ConfigItem, len(rc.groups))
+	sources := make(map[string]map[string]string, len(rc.groups))
+	for groupName := range rc.groups {
+		values[groupName] = make(map[string]*ConfigItem)
+		sources[groupName] = make(map[string]string)
+	}
+	// 从default开始逐层覆盖
+	for i := len(chain) - 1; i >= 0; i-- {
+		layer := make(map[string]map[string]*ConfigItem)
+		if chain[i] == DefaultEnvironment {
+			for groupName, group := range rc.groups {
+				layer[groupName] = group.Items
+			}
+		} else {
+			layer = rc.envs[chain[i]].Overrides
+		}
+		for groupName, items := range layer {
+			if values[groupName] == nil {
+				continue // 配置组只能在default中创建
+			}
+			for key, item := range items {
+				values[groupName][key] = item
+				sources[groupName][key] = chain[i]
+			}
+		}
+	}
+	return values, sources, nil
+}
+
+// ResolveGroup 获取配置组在环境中的全部生效值
+func (rc *RiskConfig) ResolveGroup(env, groupName string) (map[string]interface{}, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	values, _, err := rc.resolvedValuesLocked(env)
+	if err != nil {
+		return nil, err
+	}
+	items, exists := values[groupName]
+	if !exists {
+		return nil, fmt.Errorf("配置组 %s 不存在", groupName)
+	}
+	result := make(map[string]interface{}, len(items))
+	for key, item := range items {
+		result[key] = item.Value
+	}
+	return result, nil
+}
+
+// SetEnvConfig 在环境中覆盖配置项，env为default时等同于SetConfig。
+// 覆盖值同样需要通过校验规则，变更记录带有环境名
+func (rc *RiskConfig) SetEnvConfig(env, groupName, key string, value interface{}, description, updatedBy string) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		return rc.setEnvConfigLocked(env, groupName, key, value, description, updatedBy)
+	})
+}
+
+// setEnvConfigLocked 设置环境覆盖值但不持久化，调用方需持有写锁
+func (rc *RiskConfig) setEnvConfigLocked(env, groupName, key string, value interface{}, description, updatedBy string) error {
+	if env == DefaultEnvironment {
+		return rc.setConfigLocked(groupName, key, value, description, updatedBy)
+	}
+
+	e, exists := rc.envs[env]
+	if !exists {
+		return fmt.Errorf("环境 %s 不存在", env)
+	}
+	if _, exists := rc.groups[groupName]; !exists {
+		return fmt.Errorf("配置组 %s 不存在", groupName)
+	}
+	if err := rc.authorizeGroupLocked(groupName, updatedBy, PermWrite); err != nil {
+		return err
+	}
+	if err := rc.validateLocked(groupName, key, value); err != nil {
+		return err
+	}
+
+	var oldValue interface{}
+	if old, _, err := rc.resolveLocked(env, groupName, key); err == nil {
+		oldValue = old.Value
+	}
+
+	item := &ConfigItem{Key: key, Value: value, Description: description, Version: 1, UpdatedAt: time.Now(), UpdatedBy: updatedBy}
+	if e.Overrides[groupName] == nil {
+		e.Overrides[groupName] = make(map[string]*ConfigItem)
+	}
+	if old, exists := e.Overrides[groupName][key]; exists {
+		item.Version = old.Version + 1
+	}
+	e.Overrides[groupName][key] = item
+	rc.version++
+
+	rc.recordChangeLocked(&ConfigChange{
+		Env:       env,
+		GroupName: groupName,
+		Key:       key,
+		OldValue:  oldValue,
+		NewValue:  value,
+		UpdatedBy: updatedBy,
+		Timestamp: time.Now(),
+		Version:   rc.version,
+	})
+
+	fmt.Printf("设置环境配置: [%s] %s.%s = %v (by %s)\n", env, groupName, key, value, updatedBy)
+	return nil
+}
+
+// DeleteEnvConfig 删除环境中的覆盖值，之后该配置项重新继承父环境。env为default时等同于DeleteConfig
+func (rc *RiskConfig) DeleteEnvConfig(env, groupName, key, deletedBy string) error {
+	if env == DefaultEnvironment {
+		return rc.DeleteConfig(groupName, key, deletedBy)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		e, exists := rc.envs[env]
+		if !exists {
+			return fmt.Errorf("环境 %s 不存在", env)
+		}
+		if err := rc.authorizeGroupLocked(groupName, deletedBy, PermWrite); err != nil {
+			return err
+		}
+		old, exists := e.Overrides[groupName][key]
+		if !exists {
+			return fmt.Errorf("环境 %s 没有覆盖配置项 %s.%s", env, groupName, key)
+		}
+		delete(e.Overrides[groupName], key)
+		if len(e.Overrides[groupName]) == 0 {
+			delete(e.Overrides, groupName)
+		}
+
+		// 删除覆盖后的新值是父环境中的值
+		var newValue interface{}
+		if inherited, _, err := rc.resolveLocked(env, groupName, key); err == nil {
+			newValue = inherited.Value
+		}
+		rc.version++
+		rc.recordChangeLocked(&ConfigChange{
+			Env:       env,
+			GroupName: groupName,
+			Key:       key,
+			OldValue:  old.Value,
+			NewValue:  newValue,
+			UpdatedBy: deletedBy,
+			Timestamp: time.Now(),
+			Version:   rc.version,
+		})
+
+		fmt.Printf("删除环境配置: [%s] %s.%s (by %s)\n", env, groupName, key, deletedBy)
+		return nil
+	})
+}
+
+// Diff 比较两个环境中所有配置项的生效值，按配置组和键排序返回不同的项
+func (rc *RiskConfig) Diff(envA, envB string) ([]EnvDiff, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	valuesA, sourcesA, err := rc.resolvedValuesLocked(envA)
+	if err != nil {
+		return nil, err
+	}
+	valuesB, sourcesB, err := rc.resolvedValuesLocked(envB)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []EnvDiff
+	for groupName := range rc.groups {
+		keys := make(map[string]bool)
+		for key := range valuesA[groupName] {
+			keys[key] = true
+		}
+		for key := range valuesB[groupName] {
+			keys[key] = true
+		}
+		for key := range keys {
+			a, inA := valuesA[groupName][key]
+			b, inB := valuesB[groupName][key]
+			if inA && inB && sameValue(a.Value, b.Value) {
+				continue
+			}
+			diff := EnvDiff{Group: groupName, Key: key, InA: inA, InB: inB}
+			if inA {
+				diff.ValueA, diff.SourceA = a.Value, sourcesA[groupName][key]
+			}
+			if inB {
+				diff.ValueB, diff.SourceB = b.Value, sourcesB[groupName][key]
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Group != diffs[j].Group {
+			return diffs[i].Group < diffs[j].Group
+		}
+		return diffs[i].Key < diffs[j].Key
+	})
+	return diffs, nil
+}
+
+// Promote 把配置项在fromEnv中的生效值写入toEnv（toEnv为default时写入基础配置），
+// 两个环境的生效值已经相同时不做任何修改
+func (rc *RiskConfig) Promote(groupName, key, fromEnv, toEnv, promotedBy string) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		source, _, err := rc.resolveLocked(fromEnv, groupName, key)
+		if err != nil {
+			return err
+		}
+		if _, err := rc.envChainLocked(toEnv); err != nil {
+			return err
+		}
+		if target, _, err := rc.resolveLocked(toEnv, groupName, key); err == nil && sameValue(target.Value, source.Value) {
+			return errUnchanged
+		}
+
+		if err := rc.setEnvConfigLocked(toEnv, groupName, key, source.Value, source.Description, promotedBy); err != nil {
+			return err
+		}
+		fmt.Printf("晋升配置: %s.%s 从 %s 到 %s (by %s)\n", groupName, key, fromEnv, toEnv, promotedBy)
+		return nil
+	})
+}
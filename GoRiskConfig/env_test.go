@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func newEnvConfig(t *testing.T) *RiskConfig {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "单笔限额", "admin")
+	config.SetConfig("risk_limits", "max_count", 10.0, "次数限额", "admin")
+	if err := config.CreateEnvironment("staging", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.CreateEnvironment("prod", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestEnvironmentInheritance(t *testing.T) {
+	config := newEnvConfig(t)
+	config.SetEnvConfig("staging", "risk_limits", "max_amount", 2000.0, "", "qa")
+	config.SetEnvConfig("prod", "risk_limits", "max_count", 5.0, "", "ops")
+
+	cases := []struct {
+		env, key string
+		value    interface{}
+		source   string
+	}{
+		{"default", "max_amount", 1000.0, "default"},
+		{"staging", "max_amount", 2000.0, "staging"},
+		{"prod", "max_amount", 2000.0, "staging"},
+		{"staging", "max_count", 10.0, "default"},
+		{"prod", "max_count", 5.0, "prod"},
+	}
+	for _, c := range cases {
+		value, source, err := config.ResolveConfig(c.env, "risk_limits", c.key)
+		if err != nil || value != c.value || source != c.source {
+			t.Errorf("%s.%s 期望 %v (来自%s)，实际 %v (来自%s) %v", c.env, c.key, c.value, c.source, value, source, err)
+		}
+	}
+
+	// 基础配置的变化会传递到没有覆盖的环境
+	config.SetConfig("risk_limits", "max_count", 20.0, "", "admin")
+	if value, _, _ := config.ResolveConfig("staging", "risk_limits", "max_count"); value != 20.0 {
+		t.Errorf("staging应继承default的新值，实际%v", value)
+	}
+	if value, _, _ := config.ResolveConfig("prod", "risk_limits", "max_count"); value != 5.0 {
+		t.Errorf("prod的覆盖值不应被default改变，实际%v", value)
+	}
+
+	// 删除覆盖后重新继承父环境
+	if err := config.DeleteEnvConfig("staging", "risk_limits", "max_amount", "qa"); err != nil {
+		t.Fatal(err)
+	}
+	group, _ := config.ResolveGroup("prod", "risk_limits")
+	if group["max_amount"] != 1000.0 || group["max_count"] != 5.0 {
+		t.Errorf("prod的生效值不正确: %v", group)
+	}
+	if chain, _ := config.EnvironmentChain("prod"); len(chain) != 3 || chain[1] != "staging" {
+		t.Errorf("继承链不正确: %v", chain)
+	}
+
+	if err := config.CreateEnvironment("prod", ""); err == nil {
+		t.Error("重复创建环境应返回错误")
+	}
+	if err := config.CreateEnvironment("canary", "missing"); err == nil {
+		t.Error("父环境不存在时应返回错误")
+	}
+	if _, _, err := config.ResolveConfig("missing", "risk_limits", "max_amount"); err == nil {
+		t.Error("不存在的环境应返回错误")
+	}
+}
+
+func TestEnvironmentDiffAndPromote(t *testing.T) {
+	config := newEnvConfig(t)
+	config.SetEnvConfig("staging", "risk_limits", "max_amount", 3000.0, "新限额", "qa")
+	config.SetEnvConfig("staging", "risk_limits", "review_window", "10m", "", "qa")
+
+	diffs, err := config.Diff("prod", "staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("prod没有覆盖时应与staging一致: %+v", diffs)
+	}
+
+	diffs, _ = config.Diff("default", "staging")
+	if len(diffs) != 2 {
+		t.Fatalf("期望2项差异，实际%+v", diffs)
+	}
+	if d := diffs[0]; d.Key != "max_amount" || d.ValueA != 1000.0 || d.ValueB != 3000.0 || d.SourceB != "staging" {
+		t.Errorf("max_amount差异不正确: %+v", d)
+	}
+	if d := diffs[1]; d.Key != "review_window" || d.InA || !d.InB {
+		t.Errorf("review_window差异不正确: %+v", d)
+	}
+
+	if err := config.Promote("risk_limits", "max_amount", "staging", "default", "release"); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := config.GetConfig("risk_limits", "max_amount")
+	if value != 3000.0 {
+		t.Errorf("晋升后default应为3000，实际%v", value)
+	}
+	history := config.GetHistory(1)
+	if len(history) != 1 || history[0].Env != "" || history[0].UpdatedBy != "release" {
+		t.Errorf("晋升到default应记录为基础配置变更: %+v", history)
+	}
+
+	// 生效值相同时晋升不产生变更
+	version := config.GetStats()["version"]
+	if err := config.Promote("risk_limits", "max_amount", "staging", "prod", "release"); err != nil {
+		t.Fatal(err)
+	}
+	if config.GetStats()["version"] != version {
+		t.Error("生效值相同时不应产生新版本")
+	}
+	config.SetEnvConfig("prod", "risk_limits", "review_window", "30m", "", "ops")
+	if err := config.Promote("risk_limits", "review_window", "staging", "prod", "release"); err != nil {
+		t.Fatal(err)
+	}
+	if value, source, _ := config.ResolveConfig("prod", "risk_limits", "review_window"); value != "10m" || source != "prod" {
+		t.Errorf("晋升到prod应写入覆盖值，实际 %v (来自%s)", value, source)
+	}
+	if history := config.GetHistory(1); history[0].Env != "prod" || history[0].OldValue != "30m" {
+		t.Errorf("环境变更应记录环境名: %+v", history[0])
+	}
+
+	// Watch补发的增量只包含基础配置的变更
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if event := <-config.Watch(ctx, WatchRequest{FromVersion: 2}, 0); event.Type != WatchChange || event.Version != 5 || event.Value != 3000.0 {
+		t.Errorf("Watch不应补发环境覆盖值的变更: %+v", event)
+	}
+	if err := config.Promote("risk_limits", "missing", "staging", "prod", "release"); err == nil {
+		t.Error("来源环境中不存在的配置项应返回错误")
+	}
+}
+
+func TestEnvironmentValidationAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := NewRiskConfig()
+	if err := config.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	config.CreateEnvironment("staging", "")
+	config.CreateEnvironment("prod", "staging")
+	config.SetEnvConfig("prod", "risk_limits", "max_amount", 500.0, "", "ops")
+
+	maximum := 5000.0
+	schema := &GroupSchema{Properties: map[string]*FieldSchema{"max_amount": {Type: "number", Maximum: &maximum}}}
+	if err := config.SetSchema("risk_limits", schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetEnvConfig("staging", "risk_limits", "max_amount", 9000.0, "", "qa"); err == nil {
+		t.Error("环境覆盖值同样需要通过校验")
+	}
+
+	// 回滚只作用于基础配置
+	if _, err := config.RollbackTo(0, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _, _ := config.ResolveConfig("prod", "risk_limits", "max_amount"); value != 500.0 {
+		t.Errorf("回滚不应影响环境覆盖值，实际%v", value)
+	}
+
+	restarted := NewRiskConfig()
+	if err := restarted.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	value, source, err := restarted.ResolveConfig("prod", "risk_limits", "max_amount")
+	if err != nil || value != 500.0 || source != "prod" {
+		t.Errorf("重启后应恢复环境覆盖值，实际 %v (来自%s) %v", value, source, err)
+	}
+	if chain, _ := restarted.EnvironmentChain("prod"); len(chain) != 3 {
+		t.Errorf("重启后应恢复环境继承关系: %v", chain)
+	}
+}
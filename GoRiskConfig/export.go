@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 快照的导出格式
+const (
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+	FormatDotenv = "env"
+)
+
+// Snapshot 所有配置组的配置值：配置组 -> 键 -> 值
+type Snapshot map[string]map[string]interface{}
+
+// KeyChange 两个快照之间一个配置项的差异
+type KeyChange struct {
+	Group    string      `json:"group"`
+	Key      string      `json:"key"`
+	OldValue interface{} `json:"old_value,omitempty"`
+	NewValue interface{} `json:"new_value,omitempty"`
+}
+
+// SnapshotDiff 从快照A到快照B新增、删除和修改的配置项，均按配置组和键排序
+type SnapshotDiff struct {
+	Added    []KeyChange `json:"added"`
+	Removed  []KeyChange `json:"removed"`
+	Modified []KeyChange `json:"modified"`
+}
+
+// Empty 两个快照是否完全一致
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Snapshot 返回当前所有配置值的副本
+func (rc *RiskConfig) Snapshot() Snapshot {
+	return Snapshot(rc.snapshotValues())
+}
+
+// ExportAs 按指定格式导出当前配置值
+func (rc *RiskConfig) ExportAs(format string) ([]byte, error) {
+	return EncodeSnapshot(format, rc.Snapshot())
+}
+
+// ImportAs 解析指定格式的配置值并导入，见ImportSnapshot
+func (rc *RiskConfig) ImportAs(format string, data []byte, importedBy string) error {
+	snapshot, err := ParseSnapshot(format, data)
+	if err != nil {
+		return err
+	}
+	return rc.ImportSnapshot(snapshot, importedBy)
+}
+
+// ImportSnapshot 把快照中的值逐项写入配置中心：不存在的配置组自动创建，值为null的配置项被删除，
+// 快照中没有的配置项保持不变。每个实际变化的配置项产生一条变更记录；
+// 任何一项未通过校验或没有写权限时整个导入不生效
+func (rc *RiskConfig) ImportSnapshot(snapshot Snapshot, importedBy string) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		// 先校验全部配置项，列表类型配置项的值按写入时的规则转换为去重排序的成员，
+		// 之后逐项写入不会再失败，也能与已有的值正确比较
+		values := make(Snapshot, len(snapshot))
+		for _, group := range sortedGroups(snapshot) {
+			if err := rc.authorizeGroupLocked(group, importedBy, PermWrite); err != nil {
+				return err
+			}
+			values[group] = make(map[string]interface{}, len(snapshot[group]))
+			for key, value := range snapshot[group] {
+				if value != nil {
+					if existing := rc.groups[group]; existing != nil && existing.Items[key] != nil && existing.Items[key].List != nil {
+						list, err := normalizeList(value)
+						if err != nil {
+							return fmt.Errorf("配置项 %s.%s: %v", group, key, err)
+						}
+						value = list
+					}
+					if err := rc.validateLocked(group, key, value); err != nil {
+						return err
+					}
+				}
+				values[group][key] = value
+			}
+		}
+
+		for _, group := range sortedGroups(values) {
+			if _, exists := rc.groups[group]; !exists {
+				rc.groups[group] = &ConfigGroup{Name: group, Items: make(map[string]*ConfigItem), Version: 1}
+				fmt.Printf("导入时创建配置组: %s (by %s)\n", group, importedBy)
+			}
+			items := rc.groups[group].Items
+			for _, key := range sortedKeys(values[group]) {
+				value := values[group][key]
+				old, exists := items[key]
+				switch {
+				case value == nil && exists:
+					if err := rc.deleteConfigLocked(group, key, importedBy); err != nil {
+						return err
+					}
+				case value != nil && (!exists || !sameValue(old.Value, value)):
+					description := ""
+					if exists {
+						description = old.Description
+					}
+					if err := rc.setConfigLocked(group, key, value, description, importedBy); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// DiffSnapshots 比较两个快照，返回从a到b新增、删除和修改的配置项
+func DiffSnapshots(a, b Snapshot) *SnapshotDiff {
+	diff := &SnapshotDiff{}
+	groups := make(map[string]bool)
+	for group := range a {
+		groups[group] = true
+	}
+	for group := range b {
+		groups[group] = true
+	}
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	for _, group := range names {
+		keys := make(map[string]interface{})
+		for key := range a[group] {
+			keys[key] = nil
+		}
+		for key := range b[group] {
+			keys[key] = nil
+		}
+		for _, key := range sortedKeys(keys) {
+			oldValue, inA := a[group][key]
+			newValue, inB := b[group][key]
+			change := KeyChange{Group: group, Key: key, OldValue: oldValue, NewValue: newValue}
+			switch {
+			case !inA:
+				diff.Added = append(diff.Added, change)
+			case !inB:
+				diff.Removed = append(diff.Removed, change)
+			case !sameValue(oldValue, newValue):
+				diff.Modified = append(diff.Modified, change)
+			}
+		}
+	}
+	return diff
+}
+
+// EncodeSnapshot 把快照编码为指定格式
+func EncodeSnapshot(format string, snapshot Snapshot) ([]byte, error) {
+	switch format {
+	case FormatJSON:
+		return json.MarshalIndent(snapshot, "", "  ")
+	case FormatYAML:
+		return encodeYAML(snapshot)
+	case FormatDotenv:
+		return encodeDotenv(snapshot)
+	}
+	return nil, fmt.Errorf("不支持的格式: %s", format)
+}
+
+// ParseSnapshot 解析指定格式的快照
+func ParseSnapshot(format string, data []byte) (Snapshot, error) {
+	switch format {
+	case FormatJSON:
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, err
+		}
+		if snapshot == nil {
+			snapshot = make(Snapshot)
+		}
+		return snapshot, nil
+	case FormatYAML:
+		return parseYAML(data)
+	case FormatDotenv:
+		return parseDotenv(data)
+	}
+	return nil, fmt.Errorf("不支持的格式: %s", format)
+}
+
+func sortedGroups(snapshot Snapshot) []string {
+	names := make([]string, 0, len(snapshot))
+	for group := range snapshot {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// plainName YAML中无需加引号的配置组名和键
+var plainName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-/]*$`)
+
+func yamlName(name string) string {
+	if plainName.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+// encodeYAML 输出两层映射，值以JSON形式书写（JSON是YAML的子集），列表和对象使用flow风格
+func encodeYAML(snapshot Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, group := range sortedGroups(snapshot) {
+		items := snapshot[group]
+		if len(items) == 0 {
+			fmt.Fprintf(&buf, "%s: {}\n", yamlName(group))
+			continue
+		}
+		fmt.Fprintf(&buf, "%s:\n", yamlName(group))
+		for _, key := range sortedKeys(items) {
+			value, err := json.Marshal(items[key])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s 无法编码: %v", group, key, err)
+			}
+			fmt.Fprintf(&buf, "  %s: %s\n", yamlName(key), value)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// parseYAML 解析encodeYAML输出的YAML子集：两层映射、注释、单双引号字符串、
+// flow风格的列表和对象以及普通标量，不支持多行的块列表和块字符串
+func parseYAML(data []byte) (Snapshot, error) {
+	snapshot := make(Snapshot)
+	group := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("第%d行: 不支持使用制表符缩进", lineNo)
+		}
+
+		name, rest, err := splitYAMLKey(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", lineNo, err)
+		}
+		if line[0] != ' ' {
+			group = name
+			if _, exists := snapshot[group]; exists {
+				return nil, fmt.Errorf("第%d行: 配置组 %s 重复", lineNo, group)
+			}
+			snapshot[group] = make(map[string]interface{})
+			if rest != "" && rest != "{}" {
+				return nil, fmt.Errorf("第%d行: 配置组 %s 的值必须是映射", lineNo, group)
+			}
+			continue
+		}
+
+		if group == "" {
+			return nil, fmt.Errorf("第%d行: 配置项不属于任何配置组", lineNo)
+		}
+		if rest == "" {
+			return nil, fmt.Errorf("第%d行: %s 缺少值，不支持多行的块结构", lineNo, name)
+		}
+		value, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", lineNo, err)
+		}
+		snapshot[group][name] = value
+	}
+	return snapshot, scanner.Err()
+}
+
+// splitYAMLKey 拆分 "key: value"，key可以加引号
+func splitYAMLKey(line string) (string, string, error) {
+	if strings.HasPrefix(line, `"`) {
+		end := strings.Index(line[1:], `":`)
+		if end < 0 {
+			return "", "", fmt.Errorf("无法解析: %s", line)
+		}
+		name, err := strconv.Unquote(line[:end+2])
+		if err != nil {
+			return "", "", err
+		}
+		return name, strings.TrimSpace(line[end+3:]), nil
+	}
+	i := strings.Index(line, ":")
+	if i <= 0 || (i+1 < len(line) && line[i+1] != ' ') {
+		return "", "", fmt.Errorf("无法解析: %s", line)
+	}
+	return line[:i], strings.TrimSpace(line[i+1:]), nil
+}
+
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch text[0] {
+	case '"', '[', '{':
+		var value interface{}
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("无法解析值 %s: %v", text, err)
+		}
+		return value, nil
+	case '\'':
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("单引号字符串未结束: %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	return parsePlainScalar(text), nil
+}
+
+// parsePlainScalar 解析不带引号的标量：null、布尔、数字，其余按字符串处理
+func parsePlainScalar(text string) interface{} {
+	switch text {
+	case "null", "~":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if number, err := strconv.ParseFloat(text, 64); err == nil {
+		return number
+	}
+	return text
+}
+
+// dotenvName 仅包含小写字母、数字和单个下划线的名称才能在.env中无损往返
+var dotenvName = regexp.MustCompile(`^[a-z0-9]+(_[a-z0-9]+)*$`)
+
+// encodeDotenv 每个配置项一行 GROUP__KEY=value：字符串加双引号，列表和对象以单引号包裹的JSON书写
+func encodeDotenv(snapshot Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, group := range sortedGroups(snapshot) {
+		if !dotenvName.MatchString(group) {
+			return nil, fmt.Errorf("配置组名 %s 无法表示为环境变量", group)
+		}
+		for _, key := range sortedKeys(snapshot[group]) {
+			if !dotenvName.MatchString(key) {
+				return nil, fmt.Errorf("配置项 %s.%s 无法表示为环境变量", group, key)
+			}
+			value, err := json.Marshal(snapshot[group][key])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s 无法编码: %v", group, key, err)
+			}
+			if value[0] == '[' || value[0] == '{' {
+				value = []byte("'" + string(value) + "'")
+			}
+			fmt.Fprintf(&buf, "%s__%s=%s\n", strings.ToUpper(group), strings.ToUpper(key), value)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// parseDotenv 解析 GROUP__KEY=value 格式，支持注释、export前缀和单双引号
+func parseDotenv(data []byte) (Snapshot, error) {
+	snapshot := make(Snapshot)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, raw, found := strings.Cut(line, "=")
+		group, key, split := strings.Cut(strings.TrimSpace(name), "__")
+		if !found || !split || group == "" || key == "" {
+			return nil, fmt.Errorf("第%d行: 变量名应为 GROUP__KEY: %s", lineNo, line)
+		}
+		group, key = strings.ToLower(group), strings.ToLower(key)
+
+		value, err := parseDotenvValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("第%d行: %v", lineNo, err)
+		}
+		if snapshot[group] == nil {
+			snapshot[group] = make(map[string]interface{})
+		}
+		snapshot[group][key] = value
+	}
+	return snapshot, scanner.Err()
+}
+
+func parseDotenvValue(raw string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("无法解析值 %s: %v", raw, err)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return nil, fmt.Errorf("单引号字符串未结束: %s", raw)
+		}
+		inner := raw[1 : len(raw)-1]
+		if strings.HasPrefix(inner, "[") || strings.HasPrefix(inner, "{") {
+			var value interface{}
+			if err := json.Unmarshal([]byte(inner), &value); err != nil {
+				return nil, fmt.Errorf("无法解析值 %s: %v", raw, err)
+			}
+			return value, nil
+		}
+		return inner, nil
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return parsePlainScalar(raw), nil
+}
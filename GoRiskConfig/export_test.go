@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func newExportConfig() *RiskConfig {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("blacklist", "黑名单")
+	config.CreateGroup("empty", "空配置组")
+	config.SetConfig("risk_limits", "max_daily_amount", 10000.0, "每日限额", "admin")
+	config.SetConfig("risk_limits", "daily_transaction_count", 50, "每日笔数", "admin")
+	config.SetConfig("risk_limits", "mode", "strict: \"on\" # 注释", "", "admin")
+	config.SetConfig("risk_limits", "enabled", true, "", "admin")
+	config.SetConfig("blacklist", "user_ids", []interface{}{"u1", "u2"}, "", "admin")
+	config.SetConfig("blacklist", "scores", map[string]interface{}{"u1": 90.0}, "", "admin")
+	return config
+}
+
+func TestExportFormatsRoundTrip(t *testing.T) {
+	config := newExportConfig()
+	original := config.Snapshot()
+
+	for _, format := range []string{FormatJSON, FormatYAML, FormatDotenv} {
+		data, err := config.ExportAs(format)
+		if err != nil {
+			t.Fatalf("%s 导出失败: %v", format, err)
+		}
+		parsed, err := ParseSnapshot(format, data)
+		if err != nil {
+			t.Fatalf("%s 解析失败: %v\n%s", format, err, data)
+		}
+		diff := DiffSnapshots(original, parsed)
+		// .env没有空配置组的表示
+		if format == FormatDotenv && len(parsed["empty"]) == 0 {
+			delete(parsed, "empty")
+			diff = DiffSnapshots(original, parsed)
+		}
+		if !diff.Empty() {
+			t.Errorf("%s 往返后不一致: %+v\n%s", format, diff, data)
+		}
+	}
+
+	yaml, _ := config.ExportAs(FormatYAML)
+	if !strings.Contains(string(yaml), "  daily_transaction_count: 50\n") || !strings.Contains(string(yaml), "empty: {}\n") {
+		t.Errorf("YAML输出不符合预期:\n%s", yaml)
+	}
+	env, _ := config.ExportAs(FormatDotenv)
+	if !strings.Contains(string(env), "BLACKLIST__USER_IDS='[\"u1\",\"u2\"]'\n") {
+		t.Errorf(".env输出不符合预期:\n%s", env)
+	}
+
+	// 手写的YAML和.env：注释、单引号、普通标量
+	handYAML := "# 评审用\nrisk_limits:\n  max_daily_amount: 2e4   # 上调\n  mode: 'it''s'\n  region: CN\n  note: ~\n"
+	snapshot, err := ParseSnapshot(FormatYAML, []byte(handYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	limits := snapshot["risk_limits"]
+	if limits["max_daily_amount"] != 20000.0 || limits["mode"] != "it's" || limits["region"] != "CN" || limits["note"] != nil {
+		t.Errorf("手写YAML解析不正确: %v", limits)
+	}
+	handEnv := "# 生产\nexport RISK_LIMITS__MAX_DAILY_AMOUNT=3000\nRISK_LIMITS__MODE=relaxed # 注释\n"
+	if snapshot, err := ParseSnapshot(FormatDotenv, []byte(handEnv)); err != nil || snapshot["risk_limits"]["max_daily_amount"] != 3000.0 || snapshot["risk_limits"]["mode"] != "relaxed" {
+		t.Errorf("手写.env解析不正确: %v %v", snapshot, err)
+	}
+
+	for _, bad := range []string{"risk_limits:\n  list:\n    - a\n", "  orphan: 1\n", "risk_limits: 5\n"} {
+		if _, err := ParseSnapshot(FormatYAML, []byte(bad)); err == nil {
+			t.Errorf("不支持的YAML应返回错误: %q", bad)
+		}
+	}
+	if _, err := ParseSnapshot(FormatDotenv, []byte("NO_SEPARATOR=1\n")); err == nil {
+		t.Error("缺少GROUP__KEY分隔的变量名应返回错误")
+	}
+	bad := NewRiskConfig()
+	bad.CreateGroup("Risk-Limits", "")
+	bad.SetConfig("Risk-Limits", "x", 1, "", "admin")
+	if _, err := bad.ExportAs(FormatDotenv); err == nil {
+		t.Error("无法表示为环境变量的名称应返回错误")
+	}
+	if _, err := config.ExportAs("toml"); err == nil {
+		t.Error("不支持的格式应返回错误")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	a := Snapshot{
+		"risk_limits": {"max_amount": 1000.0, "count": 50, "mode": "strict"},
+		"old_group":   {"flag": true},
+	}
+	b := Snapshot{
+		"risk_limits": {"max_amount": 2000.0, "count": 50.0, "region": "CN"},
+		"new_group":   {"list": []interface{}{"x"}},
+	}
+
+	diff := DiffSnapshots(a, b)
+	keys := func(changes []KeyChange) string {
+		var parts []string
+		for _, c := range changes {
+			parts = append(parts, c.Group+"."+c.Key)
+		}
+		return strings.Join(parts, ",")
+	}
+	if got := keys(diff.Added); got != "new_group.list,risk_limits.region" {
+		t.Errorf("新增项不正确: %s", got)
+	}
+	if got := keys(diff.Removed); got != "old_group.flag,risk_limits.mode" {
+		t.Errorf("删除项不正确: %s", got)
+	}
+	// int 50 与 float64 50 视为相同
+	if got := keys(diff.Modified); got != "risk_limits.max_amount" {
+		t.Errorf("修改项不正确: %s", got)
+	}
+	if m := diff.Modified[0]; m.OldValue != 1000.0 || m.NewValue != 2000.0 {
+		t.Errorf("修改前后的值不正确: %+v", m)
+	}
+	if !DiffSnapshots(a, a).Empty() {
+		t.Error("相同快照不应有差异")
+	}
+}
+
+func TestImportFormats(t *testing.T) {
+	config := newExportConfig()
+	before := config.Snapshot()
+	version := config.GetStats()["version"]
+
+	yaml := "risk_limits:\n  max_daily_amount: 20000\n  daily_transaction_count: 50\n  mode: null\nnew_group:\n  enabled: true\n"
+	if err := config.ImportAs(FormatYAML, []byte(yaml), "reviewer"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有实际变化的配置项产生变更记录：修改、删除、新增各一条
+	changes := config.GetHistory(0)
+	if config.GetStats()["version"] != version+3 || changes[len(changes)-1].UpdatedBy != "reviewer" {
+		t.Errorf("导入应产生3条变更，实际版本 %d -> %d", version, config.GetStats()["version"])
+	}
+	diff := DiffSnapshots(before, config.Snapshot())
+	if len(diff.Added) != 1 || len(diff.Removed) != 1 || len(diff.Modified) != 1 {
+		t.Errorf("导入后的差异不正确: %+v", diff)
+	}
+	if _, err := config.GetConfig("blacklist", "user_ids"); err != nil {
+		t.Error("快照中没有的配置项应保持不变")
+	}
+
+	// 校验失败时整个导入不生效
+	maximum := 50000.0
+	config.SetSchema("risk_limits", &GroupSchema{Properties: map[string]*FieldSchema{"max_daily_amount": {Type: "number", Maximum: &maximum}}})
+	version = config.GetStats()["version"]
+	env := "BLACKLIST__REGION=\"CN\"\nRISK_LIMITS__MAX_DAILY_AMOUNT=90000\n"
+	if err := config.ImportAs(FormatDotenv, []byte(env), "reviewer"); err == nil {
+		t.Error("未通过校验的导入应返回错误")
+	}
+	if config.GetStats()["version"] != version {
+		t.Error("导入失败时不应有任何修改")
+	}
+	if _, err := config.GetConfig("blacklist", "region"); err == nil {
+		t.Error("导入失败时其他配置项也不应写入")
+	}
+}
+
+func TestImportSnapshotLists(t *testing.T) {
+	config := newExportConfig()
+	config.CreateList("blacklist", "devices", []string{"d1", "d2"}, ListOptions{}, "admin")
+	version := config.GetStats()["version"]
+
+	// 列表成员顺序和重复不同的相同列表不产生变更
+	snapshot := config.Snapshot()
+	snapshot["blacklist"]["devices"] = []interface{}{"d2", "d1", "d2"}
+	if err := config.ImportSnapshot(snapshot, "reviewer"); err != nil {
+		t.Fatal(err)
+	}
+	if config.GetStats()["version"] != version {
+		t.Errorf("重新导入相同的快照不应产生变更，版本 %d -> %d", version, config.GetStats()["version"])
+	}
+
+	// 列表的值不是数组时整个导入不生效，已排在前面的配置项和新配置组也不写入
+	invalid := Snapshot{
+		"a_group":     {"enabled": true},
+		"blacklist":   {"devices": "d3"},
+		"risk_limits": {"max_daily_amount": 1.0},
+	}
+	if err := config.ImportSnapshot(invalid, "reviewer"); err == nil {
+		t.Fatal("列表的值不是数组时应返回错误")
+	}
+	if config.GetStats()["version"] != version {
+		t.Error("导入失败时不应有任何修改")
+	}
+	if _, err := config.GetGroup("a_group"); err == nil {
+		t.Error("导入失败时不应创建配置组")
+	}
+	if value, _ := config.GetConfig("risk_limits", "max_daily_amount"); value != 10000.0 {
+		t.Errorf("导入失败时其他配置项应保持不变，实际%v", value)
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 本目录没有依赖清单，gRPC服务按协议直接实现在net/http之上：请求和响应都是
+// 5字节前缀（压缩标志+长度）分帧的protobuf消息，状态码放在HTTP/2 trailer的grpc-status中。
+// 消息编码与 proto/watch.proto 一致，任何语言用该文件生成的客户端都可以直接调用
+
+// GRPCWatchPath ConfigWatch.Watch方法的gRPC路径
+const GRPCWatchPath = "/riskconfig.ConfigWatch/Watch"
+
+// defaultWatchHeartbeat 订阅请求未指定心跳间隔时的默认值
+const defaultWatchHeartbeat = 15 * time.Second
+
+// maxGRPCRequestSize WatchRequest消息的大小上限
+const maxGRPCRequestSize = 1 << 20
+
+// gRPC状态码
+const (
+	grpcOK            = 0
+	grpcInvalidArg    = 3
+	grpcUnimplemented = 12
+	grpcInternal      = 13
+	grpcUnavailable   = 14
+)
+
+// watch.proto中WatchEvent.Type的取值
+var grpcEventTypes = map[string]uint64{
+	WatchSnapshot:  0,
+	WatchChange:    1,
+	WatchHeartbeat: 2,
+}
+
+// handleGRPCWatch POST /riskconfig.ConfigWatch/Watch
+// 服务端流式RPC，语义与 GET /watch 相同。gRPC要求HTTP/2，需用ListenAndServeTLS启动服务
+func (s *ConfigServer) handleGRPCWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeError(w, http.StatusUnsupportedMediaType, "只支持gRPC请求")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok || r.ProtoMajor != 2 {
+		writeError(w, http.StatusHTTPVersionNotSupported, "gRPC需要HTTP/2")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc+proto")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	req, heartbeat, code, err := readGRPCWatchRequest(r.Body)
+	if err != nil {
+		setGRPCStatus(w, code, err.Error())
+		return
+	}
+	flusher.Flush()
+
+	events := s.config.Watch(r.Context(), req, heartbeat)
+	for event := range events {
+		message, err := encodeWatchEvent(event)
+		if err != nil {
+			setGRPCStatus(w, grpcInternal, err.Error())
+			return
+		}
+		if _, err := w.Write(grpcFrame(message)); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+	if r.Context().Err() == nil {
+		// 积压过多被断开，客户端用最后应用的版本重新订阅
+		setGRPCStatus(w, grpcUnavailable, "订阅积压过多，请从最后应用的版本重新订阅")
+	}
+}
+
+// setGRPCStatus 写入gRPC状态trailer
+func setGRPCStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", grpcPercentEncode(message))
+	}
+}
+
+// grpcPercentEncode 按gRPC规范对grpc-message做百分号编码
+func grpcPercentEncode(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// grpcFrame 为消息加上未压缩标志和4字节大端长度前缀
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	return frame
+}
+
+// readGRPCWatchRequest 读取请求中唯一的一帧并解码为WatchRequest，失败时返回对应的gRPC状态码
+func readGRPCWatchRequest(body io.Reader) (WatchRequest, time.Duration, int, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return WatchRequest{}, 0, grpcInvalidArg, fmt.Errorf("读取请求失败: %v", err)
+	}
+	if header[0] != 0 {
+		return WatchRequest{}, 0, grpcUnimplemented, errors.New("不支持压缩的请求")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxGRPCRequestSize {
+		return WatchRequest{}, 0, grpcInvalidArg, fmt.Errorf("请求过大: %d字节", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return WatchRequest{}, 0, grpcInvalidArg, fmt.Errorf("读取请求失败: %v", err)
+	}
+
+	req, heartbeatMS, err := decodeWatchRequest(message)
+	if err != nil {
+		return WatchRequest{}, 0, grpcInvalidArg, err
+	}
+	heartbeat := defaultWatchHeartbeat
+	if heartbeatMS > 0 {
+		heartbeat = time.Duration(heartbeatMS) * time.Millisecond
+	}
+	return req, heartbeat, grpcOK, nil
+}
+
+// protobuf线格式
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// decodeWatchRequest 解码WatchRequest，未知字段被跳过
+func decodeWatchRequest(data []byte) (WatchRequest, int64, error) {
+	var req WatchRequest
+	var heartbeatMS int64
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return WatchRequest{}, 0, errors.New("无效的WatchRequest")
+		}
+		data = data[n:]
+		field, wire := key>>3, key&7
+
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return WatchRequest{}, 0, errors.New("无效的WatchRequest")
+			}
+			data = data[n:]
+			switch field {
+			case 1:
+				if int64(v) < 0 || int64(v) > math.MaxInt32 {
+					return WatchRequest{}, 0, fmt.Errorf("无效的from_version: %d", int64(v))
+				}
+				req.FromVersion = int(v)
+			case 3:
+				heartbeatMS = int64(v)
+				if heartbeatMS < 0 {
+					return WatchRequest{}, 0, fmt.Errorf("无效的heartbeat_ms: %d", heartbeatMS)
+				}
+			}
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return WatchRequest{}, 0, errors.New("无效的WatchRequest")
+			}
+			value := data[n : n+int(size)]
+			data = data[n+int(size):]
+			if field == 2 {
+				req.Groups = append(req.Groups, string(value))
+			}
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return WatchRequest{}, 0, errors.New("无效的WatchRequest")
+			}
+			data = data[size:]
+		default:
+			return WatchRequest{}, 0, fmt.Errorf("WatchRequest中不支持的线格式 %d", wire)
+		}
+	}
+	return req, heartbeatMS, nil
+}
+
+// protoBuffer 按proto3规则编码消息，标量字段为零值时省略
+type protoBuffer []byte
+
+func (b *protoBuffer) key(field int, wire int) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|uint64(wire))
+}
+
+func (b *protoBuffer) uint(field int, v uint64) {
+	if v != 0 {
+		b.key(field, wireVarint)
+		*b = binary.AppendUvarint(*b, v)
+	}
+}
+
+func (b *protoBuffer) bool(field int, v bool) {
+	if v {
+		b.uint(field, 1)
+	}
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	if s != "" {
+		b.bytes(field, []byte(s))
+	}
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// message 编码嵌套消息，即使内容为空也写入字段（表示字段存在）
+func (b *protoBuffer) message(field int, encode func(*protoBuffer)) {
+	var nested protoBuffer
+	encode(&nested)
+	b.bytes(field, nested)
+}
+
+// encodeWatchEvent 把Watch事件编码为watch.proto中的WatchEvent
+func encodeWatchEvent(event WatchEvent) ([]byte, error) {
+	var b protoBuffer
+	b.uint(1, grpcEventTypes[event.Type])
+	b.uint(2, uint64(event.Version))
+	b.string(3, event.Group)
+	b.string(4, event.Key)
+	for field, value := range []interface{}{5: event.Value, 6: event.OldValue} {
+		if value == nil {
+			continue
+		}
+		normalized, err := jsonValue(value)
+		if err != nil {
+			return nil, err
+		}
+		b.message(field, func(b *protoBuffer) { encodeProtoValue(b, normalized) })
+	}
+	b.bool(7, event.Deleted)
+	b.string(8, event.UpdatedBy)
+
+	groups := make([]string, 0, len(event.Snapshot))
+	for group := range event.Snapshot {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		normalized, err := jsonValue(event.Snapshot[group])
+		if err != nil {
+			return nil, err
+		}
+		items, _ := normalized.(map[string]interface{})
+		b.message(9, func(b *protoBuffer) {
+			b.string(1, group)
+			b.message(2, func(b *protoBuffer) { encodeProtoStruct(b, items) })
+		})
+	}
+
+	if !event.Timestamp.IsZero() {
+		b.message(10, func(b *protoBuffer) {
+			b.uint(1, uint64(event.Timestamp.Unix()))
+			b.uint(2, uint64(event.Timestamp.Nanosecond()))
+		})
+	}
+	if event.List != nil {
+		b.message(11, func(b *protoBuffer) {
+			for _, member := range event.List.Added {
+				b.bytes(1, []byte(member))
+			}
+			for _, member := range event.List.Removed {
+				b.bytes(2, []byte(member))
+			}
+		})
+	}
+	return b, nil
+}
+
+// jsonValue 把配置值转换为JSON的通用表示（float64、string、bool、nil、数组和对象），
+// 与 GET /watch 输出的值一致
+func jsonValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("编码配置值失败: %v", err)
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// encodeProtoValue 编码google.protobuf.Value，value必须是jsonValue的结果
+func encodeProtoValue(b *protoBuffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		b.key(1, wireVarint) // null_value，oneof字段即使为零值也要写入
+		*b = binary.AppendUvarint(*b, 0)
+	case float64:
+		b.key(2, wireFixed64)
+		*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(v))
+	case string:
+		b.bytes(3, []byte(v))
+	case bool:
+		b.key(4, wireVarint)
+		if v {
+			*b = binary.AppendUvarint(*b, 1)
+		} else {
+			*b = binary.AppendUvarint(*b, 0)
+		}
+	case map[string]interface{}:
+		b.message(5, func(b *protoBuffer) { encodeProtoStruct(b, v) })
+	case []interface{}:
+		b.message(6, func(b *protoBuffer) {
+			for _, element := range v {
+				b.message(1, func(b *protoBuffer) { encodeProtoValue(b, element) })
+			}
+		})
+	}
+}
+
+// encodeProtoStruct 编码google.protobuf.Struct的字段，按键排序保证输出稳定
+func encodeProtoStruct(b *protoBuffer, fields map[string]interface{}) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.message(1, func(b *protoBuffer) {
+			b.string(1, key)
+			b.message(2, func(b *protoBuffer) { encodeProtoValue(b, fields[key]) })
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// protoField 测试中解码出的一个protobuf字段
+type protoField struct {
+	field  int
+	varint uint64
+	data   []byte
+}
+
+// decodeProtoFields 按线格式拆分消息的字段，只支持Watch事件用到的线格式
+func decodeProtoFields(t *testing.T, data []byte) map[int][]protoField {
+	t.Helper()
+	fields := make(map[int][]protoField)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		f := protoField{field: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.varint, n = binary.Uvarint(data)
+			data = data[n:]
+		case wireFixed64:
+			f.varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			f.data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		default:
+			t.Fatalf("意外的线格式 %d", key&7)
+		}
+		fields[f.field] = append(fields[f.field], f)
+	}
+	return fields
+}
+
+// startGRPCWatch 通过HTTP/2发起Watch调用，返回响应
+func startGRPCWatch(t *testing.T, ctx context.Context, server *httptest.Server, body []byte) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+GRPCWatchPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK {
+		t.Fatalf("期望HTTP/2的200响应，实际 %s %d", resp.Proto, resp.StatusCode)
+	}
+	return resp
+}
+
+// readGRPCMessage 读取一帧响应消息
+func readGRPCMessage(t *testing.T, body io.Reader) map[int][]protoField {
+	t.Helper()
+	var header [5]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		t.Fatal("读取响应帧失败:", err)
+	}
+	message := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(body, message); err != nil {
+		t.Fatal("读取响应帧失败:", err)
+	}
+	return decodeProtoFields(t, message)
+}
+
+func newGRPCTestServer(t *testing.T, config *RiskConfig) *httptest.Server {
+	server := httptest.NewUnstartedServer(NewConfigServer(config))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGRPCWatch(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("other", "其他")
+	config.SetConfig("risk_limits", "max_amount", 1000, "", "admin")
+	server := newGRPCTestServer(t, config)
+
+	var request protoBuffer
+	request.string(2, "risk_limits")
+	request.uint(3, 60000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp := startGRPCWatch(t, ctx, server, grpcFrame(request))
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/grpc+proto" {
+		t.Errorf("Content-Type不正确: %s", resp.Header.Get("Content-Type"))
+	}
+
+	// 快照：type为SNAPSHOT(0)，snapshot中包含配置组的Struct
+	snapshot := readGRPCMessage(t, resp.Body)
+	if len(snapshot[1]) != 0 || snapshot[2][0].varint != 1 || len(snapshot[10]) != 1 {
+		t.Fatalf("快照事件不正确: %+v", snapshot)
+	}
+	entry := decodeProtoFields(t, snapshot[9][0].data)
+	if string(entry[1][0].data) != "risk_limits" {
+		t.Fatalf("快照的配置组不正确: %s", entry[1][0].data)
+	}
+	field := decodeProtoFields(t, decodeProtoFields(t, entry[2][0].data)[1][0].data)
+	value := decodeProtoFields(t, field[2][0].data)
+	if string(field[1][0].data) != "max_amount" || math.Float64frombits(value[2][0].varint) != 1000 {
+		t.Errorf("快照中的配置值不正确: %+v", field)
+	}
+
+	// 增量：只推送订阅的配置组
+	config.SetConfig("other", "flag", true, "", "admin")
+	config.SetConfig("risk_limits", "max_amount", 2000, "", "ops")
+	change := readGRPCMessage(t, resp.Body)
+	if change[1][0].varint != 1 || change[2][0].varint != 3 ||
+		string(change[3][0].data) != "risk_limits" || string(change[4][0].data) != "max_amount" || string(change[8][0].data) != "ops" {
+		t.Fatalf("变更事件不正确: %+v", change)
+	}
+	newValue := decodeProtoFields(t, change[5][0].data)
+	oldValue := decodeProtoFields(t, change[6][0].data)
+	if math.Float64frombits(newValue[2][0].varint) != 2000 || math.Float64frombits(oldValue[2][0].varint) != 1000 {
+		t.Errorf("变更事件的新旧值不正确: %+v %+v", newValue, oldValue)
+	}
+}
+
+func TestGRPCWatchResumeAndErrors(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "mode", "strict", "", "admin")
+	config.DeleteConfig("risk_limits", "mode", "admin")
+	server := newGRPCTestServer(t, config)
+
+	// 从版本1续订，补发删除事件
+	var request protoBuffer
+	request.uint(1, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp := startGRPCWatch(t, ctx, server, grpcFrame(request))
+	deleted := readGRPCMessage(t, resp.Body)
+	if deleted[2][0].varint != 2 || deleted[7][0].varint != 1 || len(deleted[5]) != 0 {
+		t.Errorf("续订补发的删除事件不正确: %+v", deleted)
+	}
+	resp.Body.Close()
+
+	// 压缩的请求返回UNIMPLEMENTED
+	frame := grpcFrame(nil)
+	frame[0] = 1
+	resp = startGRPCWatch(t, ctx, server, frame)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Trailer.Get("Grpc-Status") != "12" {
+		t.Errorf("期望grpc-status 12，实际 %q", resp.Trailer.Get("Grpc-Status"))
+	}
+
+	// 不完整的请求返回INVALID_ARGUMENT
+	resp = startGRPCWatch(t, ctx, server, []byte{0, 0, 0, 0, 9, 1})
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.Trailer.Get("Grpc-Status") != "3" || resp.Trailer.Get("Grpc-Message") == "" {
+		t.Errorf("期望grpc-status 3，实际 %q %q", resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message"))
+	}
+}
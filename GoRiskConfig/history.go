@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultHistoryPageSize GetHistoryPage每页默认返回的变更记录数
+const DefaultHistoryPageSize = 100
+
+// HistoryRetention 变更历史的保留策略，超出任一限制的最旧记录被清理。
+// 被清理的版本不能再回滚，Watch从更早的版本续订时退回全量快照
+type HistoryRetention struct {
+	MaxCount int           `json:"max_count"` // 最多保留的记录数，<=0表示不限
+	MaxAge   time.Duration `json:"max_age"`   // 最长保留时间，<=0表示不限
+}
+
+// HistoryFilter 变更历史查询条件，零值的条件不做过滤
+type HistoryFilter struct {
+	Group     string    // 事务中任一项属于该配置组即匹配
+	Key       string    // 与Group一起使用时匹配配置组中的键，单独使用时匹配任意配置组中的键
+	UpdatedBy string    // 修改人
+	Since     time.Time // 不早于Since
+	Until     time.Time // 早于Until
+	Principal string    // 非空时只返回principal可读的命名空间中的变更
+}
+
+// HistoryPage 一页变更历史，按版本从新到旧排列
+type HistoryPage struct {
+	Changes    []*ConfigChange `json:"changes"`
+	NextCursor string          `json:"next_cursor,omitempty"` // 下一页的游标，为空表示没有更早的记录
+}
+
+func (f HistoryFilter) matches(change *ConfigChange) bool {
+	if f.UpdatedBy != "" && change.UpdatedBy != f.UpdatedBy {
+		return false
+	}
+	if !f.Since.IsZero() && change.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !change.Timestamp.Before(f.Until) {
+		return false
+	}
+	if f.Group == "" && f.Key == "" {
+		return true
+	}
+	for _, op := range change.Changes() {
+		if (f.Group == "" || op.GroupName == f.Group) && (f.Key == "" || op.Key == f.Key) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHistoryRetention 设置变更历史的保留策略并立即清理超出限制的记录
+func (rc *RiskConfig) SetHistoryRetention(retention HistoryRetention) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		rc.maxHistory = retention.MaxCount
+		rc.maxHistoryAge = retention.MaxAge
+		if !rc.trimHistoryLocked(time.Now()) {
+			return errUnchanged
+		}
+		return nil
+	})
+}
+
+// trimHistoryLocked 按保留策略清理最旧的记录，返回是否有记录被清理。调用方需持有写锁
+func (rc *RiskConfig) trimHistoryLocked(now time.Time) bool {
+	drop := 0
+	if rc.maxHistory > 0 && len(rc.history) > rc.maxHistory {
+		drop = len(rc.history) - rc.maxHistory
+	}
+	if rc.maxHistoryAge > 0 {
+		cutoff := now.Add(-rc.maxHistoryAge)
+		for drop < len(rc.history) && rc.history[drop].Timestamp.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return false
+	}
+	// 复制到新的切片，释放被清理记录占用的内存
+	rc.history = append([]*ConfigChange(nil), rc.history[drop:]...)
+	return true
+}
+
+// GetHistoryPage 按条件分页查询变更历史，从最新的记录开始。
+// cursor为空表示第一页，之后传入上一页的NextCursor；limit<=0时使用DefaultHistoryPageSize
+func (rc *RiskConfig) GetHistoryPage(filter HistoryFilter, cursor string, limit int) (HistoryPage, error) {
+	before := -1
+	if cursor != "" {
+		version, err := strconv.Atoi(cursor)
+		if err != nil || version < 0 {
+			return HistoryPage{}, fmt.Errorf("无效的游标: %s", cursor)
+		}
+		before = version
+	}
+	if limit <= 0 {
+		limit = DefaultHistoryPageSize
+	}
+
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	page := HistoryPage{Changes: []*ConfigChange{}}
+	for i := len(rc.history) - 1; i >= 0; i-- {
+		change := rc.history[i]
+		if before >= 0 && change.Version >= before {
+			continue
+		}
+		if !filter.matches(change) || (filter.Principal != "" && !rc.canReadChangeLocked(change, filter.Principal)) {
+			continue
+		}
+		if len(page.Changes) == limit {
+			page.NextCursor = strconv.Itoa(page.Changes[limit-1].Version)
+			break
+		}
+		page.Changes = append(page.Changes, change)
+	}
+	return page, nil
+}
+
+// GetKeyHistory 返回保留的历史中一个配置项的全部变更，按时间从旧到新排列。
+// 事务中的变更返回其中该配置项的一项，环境覆盖值的变更也包含在内（Env为环境名）
+func (rc *RiskConfig) GetKeyHistory(groupName, key string) []*ConfigChange {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	var result []*ConfigChange
+	for _, change := range rc.history {
+		for _, op := range change.Changes() {
+			if op.GroupName == groupName && op.Key == key {
+				result = append(result, op)
+			}
+		}
+	}
+	return result
+}
+
+// handleHistory GET /history?group=risk_limits&key=max_amount&updated_by=ops&since=24h&cursor=N&limit=100
+// 分页返回变更历史，since和until可以是RFC3339时间或相对当前时间的时长
+func (s *ConfigServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+
+	params := r.URL.Query()
+	filter := HistoryFilter{Group: params.Get("group"), Key: params.Get("key"), UpdatedBy: params.Get("updated_by")}
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := params.Get(name); v != "" {
+			t, err := parseTimeParam(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的%s: %s", name, v))
+				return
+			}
+			*target = t
+		}
+	}
+	limit := 0
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的limit: %s", v))
+			return
+		}
+		limit = n
+	}
+
+	page, err := s.config.GetHistoryPage(filter, params.Get("cursor"), limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseTimeParam 解析RFC3339时间或相对当前时间的时长（如 "24h" 表示24小时前）
+func parseTimeParam(v string) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
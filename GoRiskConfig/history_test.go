@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func historyVersions(changes []*ConfigChange) []int {
+	var versions []int
+	for _, change := range changes {
+		versions = append(versions, change.Version)
+	}
+	return versions
+}
+
+func TestHistoryPageAndFilter(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateNamespace("payments", "", "alice")
+	config.CreateNamespacedGroup("payments", "pay_limits", "", "alice")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")                                         // v1
+	config.SetConfig("risk_limits", "mode", "strict", "", "ops")                                               // v2
+	config.SetConfig("pay_limits", "max_amount", 500.0, "", "alice")                                           // v3
+	config.Txn().Set("risk_limits", "max_amount", 2000.0, "").Set("risk_limits", "count", 5, "").Commit("ops") // v4
+	config.SetConfig("risk_limits", "mode", "relaxed", "", "admin")                                            // v5
+
+	// 从最新的记录开始分页
+	first, err := config.GetHistoryPage(HistoryFilter{}, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := config.GetHistoryPage(HistoryFilter{}, first.NextCursor, 2)
+	third, _ := config.GetHistoryPage(HistoryFilter{}, second.NextCursor, 2)
+	if got := historyVersions(first.Changes); len(got) != 2 || got[0] != 5 || got[1] != 4 || first.NextCursor == "" {
+		t.Errorf("第一页不正确: %v %q", got, first.NextCursor)
+	}
+	if got := historyVersions(second.Changes); len(got) != 2 || got[0] != 3 {
+		t.Errorf("第二页不正确: %v", got)
+	}
+	if got := historyVersions(third.Changes); len(got) != 1 || got[0] != 1 || third.NextCursor != "" {
+		t.Errorf("最后一页不正确: %v %q", got, third.NextCursor)
+	}
+
+	cases := []struct {
+		filter HistoryFilter
+		want   []int
+	}{
+		{HistoryFilter{Group: "risk_limits", Key: "max_amount"}, []int{4, 1}},
+		{HistoryFilter{Key: "max_amount"}, []int{4, 3, 1}},
+		{HistoryFilter{UpdatedBy: "ops"}, []int{4, 2}},
+		{HistoryFilter{Group: "risk_limits", Key: "count"}, []int{4}},
+		{HistoryFilter{Principal: "bob"}, []int{5, 4, 2, 1}},
+		{HistoryFilter{Since: time.Now().Add(time.Hour)}, nil},
+		{HistoryFilter{Until: time.Now().Add(time.Hour), Group: "pay_limits"}, []int{3}},
+	}
+	for _, c := range cases {
+		page, _ := config.GetHistoryPage(c.filter, "", 0)
+		got := historyVersions(page.Changes)
+		if len(got) != len(c.want) {
+			t.Errorf("查询 %+v: 期望 %v，实际 %v", c.filter, c.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("查询 %+v: 期望 %v，实际 %v", c.filter, c.want, got)
+				break
+			}
+		}
+	}
+
+	// 单个配置项的完整历史，事务中只返回该配置项的一项
+	keyHistory := config.GetKeyHistory("risk_limits", "max_amount")
+	if len(keyHistory) != 2 || keyHistory[1].Version != 4 || keyHistory[1].Ops != nil || keyHistory[1].NewValue != 2000.0 {
+		t.Errorf("配置项历史不正确: %+v", keyHistory)
+	}
+	if _, err := config.GetHistoryPage(HistoryFilter{}, "abc", 0); err == nil {
+		t.Error("无效的游标应返回错误")
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	for i := 1; i <= 5; i++ {
+		config.SetConfig("risk_limits", "max_amount", float64(i*1000), "", "admin")
+	}
+
+	// 按数量清理
+	if err := config.SetHistoryRetention(HistoryRetention{MaxCount: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if got := historyVersions(config.GetHistory(0)); len(got) != 3 || got[0] != 3 {
+		t.Errorf("应只保留最近3条: %v", got)
+	}
+	if _, err := config.RollbackTo(1, "auditor"); err == nil {
+		t.Error("历史已被清理的版本不能回滚")
+	}
+
+	// 按时间清理
+	config.mutex.Lock()
+	config.history[0].Timestamp = time.Now().Add(-48 * time.Hour)
+	config.history[1].Timestamp = time.Now().Add(-25 * time.Hour)
+	config.mutex.Unlock()
+	config.SetHistoryRetention(HistoryRetention{MaxAge: 24 * time.Hour})
+	if got := historyVersions(config.GetHistory(0)); len(got) != 1 || got[0] != 5 {
+		t.Errorf("应清理超过24小时的记录: %v", got)
+	}
+
+	// 不限数量时保留全部新记录
+	for i := 0; i < 1200; i++ {
+		config.SetConfig("risk_limits", "count", i, "", "admin")
+	}
+	if n := len(config.GetHistory(0)); n != 1201 {
+		t.Errorf("MaxCount为0时不应按数量清理，实际保留%d条", n)
+	}
+}
+
+func TestHistoryPersistedAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := NewRiskConfig()
+	if err := config.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	config.SetHistoryRetention(HistoryRetention{MaxCount: 10, MaxAge: time.Hour})
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")                                          // v1
+	config.SetConfig("risk_limits", "max_amount", 2000.0, "", "ops")                                            // v2
+	config.Txn().Set("risk_limits", "max_amount", 3000.0, "").Set("risk_limits", "mode", "x", "").Commit("ops") // v3
+
+	restarted := NewRiskConfig()
+	if err := restarted.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	history := restarted.GetHistory(0)
+	if len(history) != 3 || len(history[2].Ops) != 2 || history[1].UpdatedBy != "ops" {
+		t.Fatalf("重启后应恢复变更历史: %+v", history)
+	}
+	if keyHistory := restarted.GetKeyHistory("risk_limits", "max_amount"); len(keyHistory) != 3 || keyHistory[0].NewValue != 1000.0 {
+		t.Errorf("重启后配置项历史不正确: %+v", keyHistory)
+	}
+
+	// 重启后仍可回滚到重启前的版本
+	if _, err := restarted.RollbackTo(1, "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := restarted.GetConfig("risk_limits", "max_amount"); value != 1000.0 {
+		t.Errorf("回滚后的值不正确: %v", value)
+	}
+
+	server := httptest.NewServer(NewConfigServer(restarted))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/history?group=risk_limits&key=max_amount&since=1h&limit=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var page HistoryPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Changes) != 2 || page.Changes[0].Version != 4 || page.NextCursor != "3" {
+		t.Errorf("历史接口结果不正确: %+v", page)
+	}
+	for _, query := range []string{"cursor=x", "limit=-1", "until=tomorrow"} {
+		if resp, _ := http.Get(server.URL + "/history?" + query); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s 应返回400，实际%d", query, resp.StatusCode)
+		}
+	}
+}
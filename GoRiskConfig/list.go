@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"time"
+)
+
+// ListOptions 列表类型配置项的选项
+type ListOptions struct {
+	// Bloom 为true时为列表维护布隆过滤器，Contains先查过滤器，
+	// 大多数不在列表中的ID不需要查找列表本身，适合很大的黑白名单
+	Bloom bool `json:"bloom,omitempty"`
+	// FalsePositiveRate 布隆过滤器的误判率，默认0.01
+	FalsePositiveRate float64 `json:"false_positive_rate,omitempty"`
+}
+
+// defaultFalsePositiveRate 布隆过滤器默认误判率
+const defaultFalsePositiveRate = 0.01
+
+// ListDelta 列表成员级的变更。AddToList/RemoveFromList的变更历史只记录增删的成员，
+// 不保存整个列表的新旧副本
+type ListDelta struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// inverse 返回撤销本次增删的变更
+func (d *ListDelta) inverse() *ListDelta {
+	return &ListDelta{Added: d.Removed, Removed: d.Added}
+}
+
+// applyListDelta 把成员增删应用到列表值上，返回新的有序切片，不修改原值
+func applyListDelta(value interface{}, delta *ListDelta) []interface{} {
+	current, _ := value.([]interface{})
+	removed := make(map[string]bool, len(delta.Removed))
+	for _, member := range delta.Removed {
+		removed[member] = true
+	}
+	members := make([]interface{}, 0, len(current)+len(delta.Added))
+	for _, member := range current {
+		if !removed[memberString(member)] {
+			members = append(members, member)
+		}
+	}
+	for _, member := range delta.Added {
+		members = append(members, member)
+	}
+	return normalizeListMembers(members)
+}
+
+// CreateList 创建列表类型（集合语义）的配置项，如黑名单、白名单。
+// 列表的值是去重并排序的字符串数组，之后通过AddToList/RemoveFromList逐个增删成员
+func (rc *RiskConfig) CreateList(groupName, key string, members []string, opts ListOptions, createdBy string) error {
+	if opts.FalsePositiveRate < 0 || opts.FalsePositiveRate >= 1 {
+		return fmt.Errorf("无效的误判率: %v", opts.FalsePositiveRate)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		group, exists := rc.groups[groupName]
+		if !exists {
+			return fmt.Errorf("配置组 %s 不存在", groupName)
+		}
+		if _, exists := group.Items[key]; exists {
+			return fmt.Errorf("配置项 %s.%s 已存在", groupName, key)
+		}
+
+		value := make([]interface{}, len(members))
+		for i, member := range members {
+			value[i] = member
+		}
+		if err := rc.setConfigLocked(groupName, key, normalizeListMembers(value), "", createdBy); err != nil {
+			return err
+		}
+		item := group.Items[key]
+		item.List = &opts
+		item.indexList()
+		return nil
+	})
+}
+
+// AddToList 向列表添加成员，已存在的成员被忽略，返回实际添加的数量。
+// 没有新成员时不产生变更
+func (rc *RiskConfig) AddToList(groupName, key string, members []string, updatedBy string) (int, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var added []string
+	err := rc.updateLocked(func() error {
+		item, current, err := rc.listItemLocked(groupName, key)
+		if err != nil {
+			return err
+		}
+
+		added = nil
+		seen := make(map[string]bool)
+		for _, member := range members {
+			if !seen[member] && !containsSorted(current, member) {
+				seen[member] = true
+				added = append(added, member)
+			}
+		}
+		if len(added) == 0 {
+			return errUnchanged
+		}
+		sort.Strings(added)
+
+		// 两个有序序列归并，不需要重新排序整个列表
+		merged := make([]interface{}, 0, len(current)+len(added))
+		i := 0
+		for _, member := range current {
+			for i < len(added) && added[i] < memberString(member) {
+				merged = append(merged, added[i])
+				i++
+			}
+			merged = append(merged, member)
+		}
+		for ; i < len(added); i++ {
+			merged = append(merged, added[i])
+		}
+		return rc.changeListLocked(groupName, key, item, merged, &ListDelta{Added: added}, updatedBy)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(added), nil
+}
+
+// RemoveFromList 从列表删除成员，不存在的成员被忽略，返回实际删除的数量
+func (rc *RiskConfig) RemoveFromList(groupName, key string, members []string, updatedBy string) (int, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var removed []string
+	err := rc.updateLocked(func() error {
+		item, current, err := rc.listItemLocked(groupName, key)
+		if err != nil {
+			return err
+		}
+
+		remove := make(map[string]bool, len(members))
+		for _, member := range members {
+			remove[member] = true
+		}
+		kept := make([]interface{}, 0, len(current))
+		removed = nil
+		for _, member := range current {
+			if remove[memberString(member)] {
+				removed = append(removed, memberString(member))
+			} else {
+				kept = append(kept, member)
+			}
+		}
+		if len(removed) == 0 {
+			return errUnchanged
+		}
+		return rc.changeListLocked(groupName, key, item, kept, &ListDelta{Removed: removed}, updatedBy)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// Contains 判断member是否在列表中。列表有序，查找为二分查找；
+// 开启布隆过滤器时过滤器判定不存在的成员直接返回false
+func (rc *RiskConfig) Contains(groupName, key, member string) (bool, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	rc.metrics.read(groupName)
+
+	item, members, err := rc.listItemLocked(groupName, key)
+	if err != nil {
+		return false, err
+	}
+	if item.bloom != nil && !item.bloom.mayContain(member) {
+		return false, nil
+	}
+	return containsSorted(members, member), nil
+}
+
+// listItemLocked 查找列表类型的配置项，返回配置项和有序的成员，调用方需持有锁
+func (rc *RiskConfig) listItemLocked(groupName, key string) (*ConfigItem, []interface{}, error) {
+	group, exists := rc.groups[groupName]
+	if !exists {
+		return nil, nil, fmt.Errorf("配置组 %s 不存在", groupName)
+	}
+	item, exists := group.Items[key]
+	if !exists {
+		return nil, nil, fmt.Errorf("配置项 %s.%s 不存在", groupName, key)
+	}
+	members, ok := item.Value.([]interface{})
+	if item.List == nil || !ok {
+		return nil, nil, fmt.Errorf("配置项 %s.%s 不是列表", groupName, key)
+	}
+	return item, members, nil
+}
+
+// changeListLocked 原地更新列表配置项并记录成员级的变更，调用方需持有写锁。
+// 成员写入新的切片，之前通过GetConfig取得的值不会被修改
+func (rc *RiskConfig) changeListLocked(groupName, key string, item *ConfigItem, members []interface{}, delta *ListDelta, updatedBy string) error {
+	if err := rc.authorizeGroupLocked(groupName, updatedBy, PermWrite); err != nil {
+		return err
+	}
+	if err := rc.validateLocked(groupName, key, members); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	oldValue := item.Value
+	item.Value = members
+	item.Version++
+	item.UpdatedAt = now
+	item.UpdatedBy = updatedBy
+	// 删除的成员留在过滤器中只会多一次二分查找；列表超出过滤器容量时重建以保持误判率
+	if item.bloom != nil && len(members) <= item.bloom.capacity {
+		for _, member := range delta.Added {
+			item.bloom.add(member)
+		}
+	} else {
+		item.indexList()
+	}
+
+	group := rc.groups[groupName]
+	group.Version++
+	group.UpdatedAt = now
+	rc.version++
+
+	rc.recordChangeLocked(&ConfigChange{
+		GroupName: groupName,
+		Key:       key,
+		OldValue:  oldValue,
+		NewValue:  members,
+		List:      delta,
+		UpdatedBy: updatedBy,
+		Timestamp: now,
+		Version:   rc.version,
+	})
+
+	fmt.Printf("更新列表: %s.%s 新增%d 删除%d (by %s)\n", groupName, key, len(delta.Added), len(delta.Removed), updatedBy)
+	return nil
+}
+
+// normalizeList 把列表类型配置项的新值转换为去重排序的字符串数组
+func normalizeList(value interface{}) ([]interface{}, error) {
+	var members []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		members = v
+	case []string:
+		for _, member := range v {
+			members = append(members, member)
+		}
+	default:
+		return nil, fmt.Errorf("列表的值必须是字符串数组，实际为 %s", describeValue(value))
+	}
+	for _, member := range members {
+		if _, ok := member.(string); !ok {
+			return nil, fmt.Errorf("列表成员必须是字符串，实际为 %s", describeValue(member))
+		}
+	}
+	return normalizeListMembers(members), nil
+}
+
+// normalizeListMembers 对字符串成员去重并排序，返回新的切片
+func normalizeListMembers(members []interface{}) []interface{} {
+	sorted := make([]interface{}, 0, len(members))
+	seen := make(map[string]bool, len(members))
+	for _, member := range members {
+		s := memberString(member)
+		if !seen[s] {
+			seen[s] = true
+			sorted = append(sorted, s)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].(string) < sorted[j].(string) })
+	return sorted
+}
+
+// memberString 返回列表成员的字符串，非字符串成员（手工编辑的后端数据）视为空字符串
+func memberString(member interface{}) string {
+	s, _ := member.(string)
+	return s
+}
+
+// containsSorted 在有序的字符串成员中二分查找
+func containsSorted(members []interface{}, member string) bool {
+	i := sort.Search(len(members), func(i int) bool { return memberString(members[i]) >= member })
+	return i < len(members) && memberString(members[i]) == member
+}
+
+// indexList 按列表当前的值重建布隆过滤器。列表的值被替换时调用
+func (item *ConfigItem) indexList() {
+	item.bloom = nil
+	if item.List == nil || !item.List.Bloom {
+		return
+	}
+	members, ok := item.Value.([]interface{})
+	if !ok {
+		return
+	}
+	rate := item.List.FalsePositiveRate
+	if rate == 0 {
+		rate = defaultFalsePositiveRate
+	}
+	item.bloom = newBloomFilter(len(members), rate)
+	for _, member := range members {
+		item.bloom.add(memberString(member))
+	}
+}
+
+// indexLists 为从JSON加载的配置组中的列表重建布隆过滤器
+func indexLists(groups map[string]*ConfigGroup) {
+	for _, group := range groups {
+		for _, item := range group.Items {
+			item.indexList()
+		}
+	}
+}
+
+// bloomFilter 布隆过滤器，位数和哈希函数个数按容量和误判率计算
+type bloomFilter struct {
+	bits     []uint64
+	m        uint64 // 位数
+	k        uint64 // 哈希函数个数
+	capacity int    // 按误判率设计的成员数
+}
+
+func newBloomFilter(n int, rate float64) *bloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k, capacity: n}
+}
+
+// positions 用双重哈希计算成员对应的k个位置
+func (b *bloomFilter) positions(member string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	positions := make([]uint64, b.k)
+	for i := uint64(0); i < b.k; i++ {
+		positions[i] = (h1 + i*h2) % b.m
+	}
+	return positions
+}
+
+func (b *bloomFilter) add(member string) {
+	for _, pos := range b.positions(member) {
+		b.bits[pos/64] |= 1 << (pos % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(member string) bool {
+	for _, pos := range b.positions(member) {
+		if b.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
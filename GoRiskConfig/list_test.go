@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListOperations(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("blacklist", "黑名单")
+	if err := config.CreateList("blacklist", "user_ids", []string{"u3", "u1", "u3"}, ListOptions{}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := config.GetConfig("blacklist", "user_ids"); fmt.Sprint(value) != "[u1 u3]" {
+		t.Errorf("列表应去重并排序: %v", value)
+	}
+
+	added, err := config.AddToList("blacklist", "user_ids", []string{"u2", "u1", "u2"}, "ops")
+	if err != nil || added != 1 {
+		t.Fatalf("期望添加1个成员，实际 %d %v", added, err)
+	}
+	if added, _ := config.AddToList("blacklist", "user_ids", []string{"u1"}, "ops"); added != 0 {
+		t.Error("已存在的成员不应重复添加")
+	}
+	removed, err := config.RemoveFromList("blacklist", "user_ids", []string{"u3", "u9"}, "ops")
+	if err != nil || removed != 1 {
+		t.Fatalf("期望删除1个成员，实际 %d %v", removed, err)
+	}
+
+	for member, want := range map[string]bool{"u1": true, "u2": true, "u3": false, "u0": false} {
+		if got, _ := config.Contains("blacklist", "user_ids", member); got != want {
+			t.Errorf("Contains(%s) = %v，期望 %v", member, got, want)
+		}
+	}
+	// 只有实际变化的操作产生变更记录
+	history := config.GetHistory(0)
+	if len(history) != 3 || fmt.Sprint(history[1].List) != "&{[u2] []}" || history[2].UpdatedBy != "ops" {
+		t.Errorf("变更记录不正确: %d 条", len(history))
+	}
+
+	// 整体写入列表时同样按集合处理
+	config.SetConfig("blacklist", "user_ids", []interface{}{"b", "a", "b"}, "", "admin")
+	if value, _ := config.GetConfig("blacklist", "user_ids"); fmt.Sprint(value) != "[a b]" {
+		t.Errorf("SetConfig写入列表时应去重排序: %v", value)
+	}
+	if err := config.SetConfig("blacklist", "user_ids", []interface{}{"a", 1}, "", "admin"); err == nil {
+		t.Error("列表成员不是字符串时应失败")
+	}
+
+	config.SetConfig("blacklist", "plain", []interface{}{"x"}, "", "admin")
+	if _, err := config.Contains("blacklist", "plain", "x"); err == nil {
+		t.Error("普通配置项不能按列表操作")
+	}
+	if err := config.CreateList("blacklist", "user_ids", nil, ListOptions{}, "admin"); err == nil {
+		t.Error("重复创建列表应失败")
+	}
+}
+
+func TestListBloomFilter(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("blacklist", "黑名单")
+	members := make([]string, 10000)
+	for i := range members {
+		members[i] = fmt.Sprintf("device-%05d", i)
+	}
+	if err := config.CreateList("blacklist", "devices", members, ListOptions{Bloom: true}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	item := config.groups["blacklist"].Items["devices"]
+	if item.bloom == nil {
+		t.Fatal("应创建布隆过滤器")
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if item.bloom.mayContain(fmt.Sprintf("other-%05d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("误判率过高: %d/10000", falsePositives)
+	}
+
+	// 过滤器的误判由列表本身纠正，结果始终准确
+	for i := 0; i < 10000; i += 97 {
+		if ok, _ := config.Contains("blacklist", "devices", members[i]); !ok {
+			t.Errorf("%s 应在列表中", members[i])
+		}
+		if ok, _ := config.Contains("blacklist", "devices", fmt.Sprintf("other-%05d", i)); ok {
+			t.Errorf("other-%05d 不应在列表中", i)
+		}
+	}
+
+	// 删除成员后过滤器重建
+	config.RemoveFromList("blacklist", "devices", []string{"device-00042"}, "ops")
+	config.AddToList("blacklist", "devices", []string{"device-new"}, "ops")
+	item = config.groups["blacklist"].Items["devices"]
+	if item.bloom == nil || !item.bloom.mayContain("device-new") {
+		t.Error("修改后应重建布隆过滤器")
+	}
+	if ok, _ := config.Contains("blacklist", "devices", "device-00042"); ok {
+		t.Error("删除的成员不应在列表中")
+	}
+	if ok, _ := config.Contains("blacklist", "devices", "device-new"); !ok {
+		t.Error("新增的成员应在列表中")
+	}
+	if err := config.CreateList("blacklist", "bad", nil, ListOptions{Bloom: true, FalsePositiveRate: 1.5}, "admin"); err == nil {
+		t.Error("无效的误判率应被拒绝")
+	}
+}
+
+func TestListPersistenceAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := NewRiskConfig()
+	if err := config.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	config.CreateGroup("whitelist", "白名单")
+	config.CreateList("whitelist", "merchants", []string{"m1", "m2"}, ListOptions{Bloom: true, FalsePositiveRate: 0.001}, "admin") // v1
+	config.SetTags("whitelist", "merchants", []string{"core"}, "admin")
+	config.AddToList("whitelist", "merchants", []string{"m3"}, "ops") // v2
+
+	restarted := NewRiskConfig()
+	if err := restarted.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	item := restarted.groups["whitelist"].Items["merchants"]
+	if item.List == nil || item.List.FalsePositiveRate != 0.001 || item.bloom == nil || fmt.Sprint(item.Tags) != "[core]" {
+		t.Fatalf("重启后应恢复列表选项并重建布隆过滤器: %+v", item)
+	}
+	if ok, _ := restarted.Contains("whitelist", "merchants", "m3"); !ok {
+		t.Error("重启后应能查询列表成员")
+	}
+
+	// 回滚恢复成员，列表选项保留
+	if _, err := config.RollbackTo(1, "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := config.Contains("whitelist", "merchants", "m3"); ok {
+		t.Error("回滚后m3不应在列表中")
+	}
+	if added, err := config.AddToList("whitelist", "merchants", []string{"m4"}, "ops"); err != nil || added != 1 {
+		t.Errorf("回滚后仍应是列表: %d %v", added, err)
+	}
+}
+
+func TestListHistoryRecordsMembers(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("blacklist", "黑名单")
+	config.CreateList("blacklist", "device_ids", []string{"d1", "d2"}, ListOptions{Bloom: true}, "admin") // v1
+	item := config.groups["blacklist"].Items["device_ids"]
+
+	// 实时通知收到增删前后的完整列表
+	notified := make(chan [2]interface{}, 2)
+	config.AddListener(&testListener{onChange: func(_, _ string, oldValue, newValue interface{}) {
+		notified <- [2]interface{}{oldValue, newValue}
+	}})
+	config.AddToList("blacklist", "device_ids", []string{"d4", "d3"}, "ops") // v2
+	config.RemoveFromList("blacklist", "device_ids", []string{"d1"}, "ops")  // v3
+
+	if config.groups["blacklist"].Items["device_ids"] != item || item.Version != 3 {
+		t.Error("增删成员应原地更新配置项")
+	}
+	if ok, _ := config.Contains("blacklist", "device_ids", "d4"); !ok {
+		t.Error("新增的成员应能通过布隆过滤器查到")
+	}
+
+	// 历史只保存增删的成员
+	history := config.GetKeyHistory("blacklist", "device_ids")
+	if len(history) != 3 || history[1].OldValue != nil || history[1].NewValue != nil ||
+		fmt.Sprint(history[1].List.Added) != "[d3 d4]" || fmt.Sprint(history[2].List.Removed) != "[d1]" {
+		t.Fatalf("历史应记录成员级变更: %+v", history)
+	}
+	for _, want := range []string{"[[d1 d2] [d1 d2 d3 d4]]", "[[d1 d2 d3 d4] [d2 d3 d4]]"} {
+		select {
+		case values := <-notified:
+			if fmt.Sprint(values) != want {
+				t.Errorf("通知应包含增删前后的完整列表: %v", values)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("没有收到变更通知")
+		}
+	}
+
+	// Watch续订从历史补发成员级变更
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := config.Watch(ctx, WatchRequest{FromVersion: 1}, 0)
+	var value interface{} = []interface{}{"d1", "d2"}
+	for i := 0; i < 2; i++ {
+		event := <-events
+		if event.Deleted || event.List == nil {
+			t.Fatalf("补发的列表变更不正确: %+v", event)
+		}
+		value = applyListDelta(value, event.List)
+	}
+	if fmt.Sprint(value) != "[d2 d3 d4]" {
+		t.Errorf("应用补发的变更后应得到当前列表: %v", value)
+	}
+
+	// 回滚倒序撤销成员级变更
+	if _, err := config.RollbackKey("blacklist", "device_ids", 2, "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := config.GetConfig("blacklist", "device_ids"); fmt.Sprint(value) != "[d1 d2 d3 d4]" {
+		t.Errorf("回滚到v2后的列表不正确: %v", value)
+	}
+	if _, err := config.RollbackTo(1, "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := config.GetConfig("blacklist", "device_ids"); fmt.Sprint(value) != "[d1 d2]" {
+		t.Errorf("回滚到v1后的列表不正确: %v", value)
+	}
+}
@@ -3,25 +3,29 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 )
 
 // ConfigItem 配置项
 type ConfigItem struct {
-	Key         string      `json:"key"`
-	Value       interface{} `json:"value"`
-	Description string      `json:"description"`
-	Version     int         `json:"version"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	UpdatedBy   string      `json:"updated_by"`
+	Key         string       `json:"key"`
+	Value       interface{}  `json:"value"`
+	Description string       `json:"description"`
+	Version     int          `json:"version"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	UpdatedBy   string       `json:"updated_by"`
+	Tags        []string     `json:"tags,omitempty"` // 标签，修改配置值时保留
+	List        *ListOptions `json:"list,omitempty"` // 非nil表示列表类型（集合语义）的配置项
+
+	bloom *bloomFilter // 列表的布隆过滤器，由List.Bloom开启
 }
 
 // ConfigGroup 配置组
 type ConfigGroup struct {
 	Name        string                 `json:"name"`
 	Description string                 `json:"description"`
+	Namespace   string                 `json:"namespace,omitempty"` // 所属命名空间，为空表示不做访问控制
 	Items       map[string]*ConfigItem `json:"items"`
 	Version     int                    `json:"version"`
 	UpdatedAt   time.Time              `json:"updated_at"`
@@ -29,12 +33,26 @@ type ConfigGroup struct {
 
 // RiskConfig 风控配置中心
 type RiskConfig struct {
-	groups     map[string]*ConfigGroup
-	listeners  []ConfigListener
-	mutex      sync.RWMutex
-	version    int
-	history    []*ConfigChange
-	maxHistory int
+	groups        map[string]*ConfigGroup
+	listeners     []*listenerQueue
+	delivery      DeliveryPolicy
+	deadLetters   []*DeadLetter
+	metrics       *configMetrics
+	rateRules     []*changeRateRule
+	mutex         sync.RWMutex
+	version       int
+	history       []*ConfigChange
+	maxHistory    int           // 最多保留的变更记录数，<=0表示不限
+	maxHistoryAge time.Duration // 变更记录最长保留时间，<=0表示不限
+	watchers      map[*watcher]bool
+	subscriptions map[*Subscription]bool
+	envs          map[string]*Environment
+	namespaces    map[string]*Namespace
+	schemas       map[string]*GroupSchema
+	backend       Backend
+	persisted     []byte          // 最近一次写入或从后端读到的状态，用于忽略自身写入引起的热加载
+	revision      uint64          // persisted在后端中的修订号
+	pending       []*ConfigChange // 已记录但尚未持久化的变更，写入后端成功后才发布
 }
 
 // ConfigListener 配置监听器
@@ -51,15 +69,34 @@ type ConfigChange struct {
 	UpdatedBy string
 	Timestamp time.Time
 	Version   int
+	// Env 为空表示基础配置的变更，否则为环境覆盖值的变更
+	Env string
+	// Namespace 变更时配置组所属的命名空间
+	Namespace string
+	// Rollback 为true表示该变更由回滚产生，RollbackVersion为回滚的目标版本
+	Rollback        bool
+	RollbackVersion int
+	// Ops 非nil表示该记录是一个事务，包含事务中每个配置项的变更，它们共享同一个版本号
+	Ops []*ConfigChange
+	// List 非nil表示列表成员的增删。实时通知中OldValue和NewValue为增删前后的完整列表，
+	// 变更历史中只保留List
+	List *ListDelta
 }
 
 // NewRiskConfig 创建风控配置中心
 func NewRiskConfig() *RiskConfig {
 	return &RiskConfig{
-		groups:     make(map[string]*ConfigGroup),
-		listeners:  make([]ConfigListener, 0),
-		history:    make([]*ConfigChange, 0),
-		maxHistory: 1000,
+		groups:        make(map[string]*ConfigGroup),
+		listeners:     make([]*listenerQueue, 0),
+		delivery:      DefaultDeliveryPolicy,
+		metrics:       newConfigMetrics(),
+		history:       make([]*ConfigChange, 0),
+		maxHistory:    1000,
+		watchers:      make(map[*watcher]bool),
+		subscriptions: make(map[*Subscription]bool),
+		envs:          make(map[string]*Environment),
+		namespaces:    make(map[string]*Namespace),
+		schemas:       make(map[string]*GroupSchema),
 	}
 }
 
@@ -68,20 +105,22 @@ func (rc *RiskConfig) CreateGroup(name, description string) error {
 	rc.mutex.Lock()
 	defer rc.mutex.Unlock()
 
-	if _, exists := rc.groups[name]; exists {
-		return fmt.Errorf("配置组 %s 已存在", name)
-	}
+	return rc.updateLocked(func() error {
+		if _, exists := rc.groups[name]; exists {
+			return fmt.Errorf("配置组 %s 已存在", name)
+		}
 
-	rc.groups[name] = &ConfigGroup{
-		Name:        name,
-		Description: description,
-		Items:       make(map[string]*ConfigItem),
-		Version:     1,
-		UpdatedAt:   time.Now(),
-	}
+		rc.groups[name] = &ConfigGroup{
+			Name:        name,
+			Description: description,
+			Items:       make(map[string]*ConfigItem),
+			Version:     1,
+			UpdatedAt:   time.Now(),
+		}
 
-	fmt.Printf("创建配置组: %s\n", name)
-	return nil
+		fmt.Printf("创建配置组: %s\n", name)
+		return nil
+	})
 }
 
 // SetConfig 设置配置项
@@ -89,10 +128,31 @@ func (rc *RiskConfig) SetConfig(groupName, key string, value interface{}, descri
 	rc.mutex.Lock()
 	defer rc.mutex.Unlock()
 
+	return rc.updateLocked(func() error {
+		return rc.setConfigLocked(groupName, key, value, description, updatedBy)
+	})
+}
+
+// setConfigLocked 设置配置项但不持久化，调用方需持有写锁
+func (rc *RiskConfig) setConfigLocked(groupName, key string, value interface{}, description, updatedBy string) error {
 	group, exists := rc.groups[groupName]
 	if !exists {
 		return fmt.Errorf("配置组 %s 不存在", groupName)
 	}
+	if err := rc.authorizeGroupLocked(groupName, updatedBy, PermWrite); err != nil {
+		return err
+	}
+
+	if item, exists := group.Items[key]; exists && item.List != nil {
+		list, err := normalizeList(value)
+		if err != nil {
+			return err
+		}
+		value = list
+	}
+	if err := rc.validateLocked(groupName, key, value); err != nil {
+		return err
+	}
 
 	oldValue := interface{}(nil)
 	var oldItem *ConfigItem
@@ -114,6 +174,9 @@ func (rc *RiskConfig) SetConfig(groupName, key string, value interface{}, descri
 
 	if oldItem != nil {
 		newItem.Version = oldItem.Version + 1
+		newItem.Tags = oldItem.Tags
+		newItem.List = oldItem.List
+		newItem.indexList()
 	}
 
 	group.Items[key] = newItem
@@ -132,13 +195,7 @@ func (rc *RiskConfig) SetConfig(groupName, key string, value interface{}, descri
 		Version:   rc.version,
 	}
 
-	rc.history = append(rc.history, change)
-	if len(rc.history) > rc.maxHistory {
-		rc.history = rc.history[1:] // 移除最旧的记录
-	}
-
-	// 通知监听器
-	go rc.notifyListeners(groupName, key, oldValue, value)
+	rc.recordChangeLocked(change)
 
 	fmt.Printf("设置配置: %s.%s = %v (by %s)\n", groupName, key, value, updatedBy)
 	return nil
@@ -148,6 +205,7 @@ func (rc *RiskConfig) SetConfig(groupName, key string, value interface{}, descri
 func (rc *RiskConfig) GetConfig(groupName, key string) (interface{}, error) {
 	rc.mutex.RLock()
 	defer rc.mutex.RUnlock()
+	rc.metrics.read(groupName)
 
 	group, exists := rc.groups[groupName]
 	if !exists {
@@ -180,10 +238,20 @@ func (rc *RiskConfig) DeleteConfig(groupName, key, deletedBy string) error {
 	rc.mutex.Lock()
 	defer rc.mutex.Unlock()
 
+	return rc.updateLocked(func() error {
+		return rc.deleteConfigLocked(groupName, key, deletedBy)
+	})
+}
+
+// deleteConfigLocked 删除配置项但不持久化，调用方需持有写锁
+func (rc *RiskConfig) deleteConfigLocked(groupName, key, deletedBy string) error {
 	group, exists := rc.groups[groupName]
 	if !exists {
 		return fmt.Errorf("配置组 %s 不存在", groupName)
 	}
+	if err := rc.authorizeGroupLocked(groupName, deletedBy, PermWrite); err != nil {
+		return err
+	}
 
 	item, exists := group.Items[key]
 	if !exists {
@@ -207,30 +275,63 @@ func (rc *RiskConfig) DeleteConfig(groupName, key, deletedBy string) error {
 		Version:   rc.version,
 	}
 
-	rc.history = append(rc.history, change)
-	if len(rc.history) > rc.maxHistory {
-		rc.history = rc.history[1:]
-	}
-
-	// 通知监听器
-	go rc.notifyListeners(groupName, key, oldValue, nil)
+	rc.recordChangeLocked(change)
 
 	fmt.Printf("删除配置: %s.%s (by %s)\n", groupName, key, deletedBy)
 	return nil
 }
 
-// AddListener 添加配置监听器
-func (rc *RiskConfig) AddListener(listener ConfigListener) {
-	rc.mutex.Lock()
-	defer rc.mutex.Unlock()
-	rc.listeners = append(rc.listeners, listener)
+// recordChangeLocked 记录变更历史，变更在本次修改持久化后由publishPendingLocked发布，调用方需持有写锁
+func (rc *RiskConfig) recordChangeLocked(change *ConfigChange) {
+	for _, op := range change.Changes() {
+		if group, exists := rc.groups[op.GroupName]; exists {
+			op.Namespace = group.Namespace
+		}
+	}
+	if change.Ops != nil {
+		// 事务中的配置项都属于同一个命名空间时记录该命名空间
+		change.Namespace = change.Ops[0].Namespace
+		for _, op := range change.Ops {
+			if op.Namespace != change.Namespace {
+				change.Namespace = ""
+			}
+		}
+	}
+	entry := change
+	if change.List != nil {
+		stripped := *change
+		stripped.OldValue, stripped.NewValue = nil, nil
+		entry = &stripped
+	}
+	rc.history = append(rc.history, entry)
+	rc.trimHistoryLocked(change.Timestamp)
+	rc.pending = append(rc.pending, change)
 }
 
-// notifyListeners 通知所有监听器
-func (rc *RiskConfig) notifyListeners(groupName, key string, oldValue, newValue interface{}) {
-	for _, listener := range rc.listeners {
-		listener.OnConfigChange(groupName, key, oldValue, newValue)
+// publishPendingLocked 发布已记录的变更：统计并检查告警规则，推送给跨进程订阅者并放入监听器的投递队列，
+// 调用方需持有写锁
+func (rc *RiskConfig) publishPendingLocked() {
+	for _, change := range rc.pending {
+		for _, op := range change.Changes() {
+			rc.observeChangeLocked(op)
+		}
+		// Watch流和监听器只反映基础配置，环境覆盖值的变更只进入历史和订阅
+		if change.Env == "" {
+			rc.publishLocked(change)
+			rc.enqueueListenersLocked(change)
+		}
+		rc.dispatchLocked(change)
 	}
+	rc.pending = nil
+}
+
+// AddListener 添加配置监听器，每个监听器按版本顺序收到添加之后的变更
+func (rc *RiskConfig) AddListener(listener ConfigListener) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	q := newListenerQueue(listener)
+	rc.listeners = append(rc.listeners, q)
+	go q.run(rc)
 }
 
 // GetHistory 获取变更历史
@@ -265,12 +366,29 @@ func (rc *RiskConfig) ImportConfig(data []byte, importedBy string) error {
 	rc.mutex.Lock()
 	defer rc.mutex.Unlock()
 
-	for name, group := range groups {
-		rc.groups[name] = group
-		fmt.Printf("导入配置组: %s (by %s)\n", name, importedBy)
-	}
+	return rc.updateLocked(func() error {
+		if err := rc.validateGroupsLocked(groups); err != nil {
+			return err
+		}
+		// 导入既不能覆盖无权修改的配置组，也不能把配置组放入无权写入的命名空间
+		for name, group := range groups {
+			if err := rc.authorizeGroupLocked(name, importedBy, PermWrite); err != nil {
+				return err
+			}
+			if group.Namespace != "" {
+				if err := rc.authorizeNamespaceLocked(group.Namespace, importedBy, PermWrite); err != nil {
+					return err
+				}
+			}
+		}
 
-	return nil
+		indexLists(groups)
+		for name, group := range groups {
+			rc.groups[name] = group
+			fmt.Printf("导入配置组: %s (by %s)\n", name, importedBy)
+		}
+		return nil
+	})
 }
 
 // GetStats 获取统计信息
@@ -286,6 +404,11 @@ func (rc *RiskConfig) GetStats() map[string]int {
 		"version":     rc.version,
 	}
 
+	stats["dead_letters"] = len(rc.deadLetters)
+	for _, q := range rc.listeners {
+		stats["pending_notifications"] += q.backlog()
+	}
+
 	for _, group := range rc.groups {
 		stats["total_items"] += len(group.Items)
 	}
@@ -321,8 +444,17 @@ func main() {
 	config.SetConfig("blacklist", "check_ip", true, "检查IP黑名单", "admin")
 	config.SetConfig("blacklist", "check_device", true, "检查设备黑名单", "admin")
 
+	// 设置校验规则，之后限额不能被设置为非数值
+	config.SetSchema("risk_limits", &GroupSchema{Properties: map[string]*FieldSchema{
+		"max_daily_amount":  {Type: SchemaNumber},
+		"max_single_amount": {Type: SchemaNumber},
+	}})
+	if err := config.SetConfig("risk_limits", "max_daily_amount", "10000", "每日最大交易金额", "admin"); err != nil {
+		fmt.Printf("配置被拒绝: %v\n", err)
+	}
+
 	// 获取配置
-	maxAmount, _ := config.GetConfig("risk_limits", "max_daily_amount")
+	maxAmount := config.GetFloat("risk_limits", "max_daily_amount", 0)
 	fmt.Printf("每日最大金额: %v\n", maxAmount)
 
 	// 更新配置
@@ -335,6 +467,12 @@ func main() {
 	fmt.Println("\n=== 变更历史 ===")
 	history := config.GetHistory(5)
 	for _, change := range history {
+		if change.List != nil {
+			fmt.Printf("[%s] 列表 %s.%s: +%v -%v (by %s)\n",
+				change.Timestamp.Format("15:04:05"), change.GroupName, change.Key,
+				change.List.Added, change.List.Removed, change.UpdatedBy)
+			continue
+		}
 		action := "更新"
 		if change.NewValue == nil {
 			action = "删除"
@@ -346,6 +484,35 @@ func main() {
 			change.GroupName, change.Key, change.OldValue, change.NewValue, change.UpdatedBy)
 	}
 
+	// 模拟候选限额对样本交易的影响
+	fmt.Println("\n=== 规则模拟 ===")
+	results := config.Simulate(
+		map[string]map[string]interface{}{"risk_limits": {"max_single_amount": 3000.0}},
+		[]Transaction{{ID: "tx1", Amount: 4000}, {ID: "tx2", Amount: 1000}},
+	)
+	for _, result := range results {
+		fmt.Printf("%s: 当前=%s 候选=%s\n", result.TransactionID, result.Current.Action, result.Candidate.Action)
+	}
+
+	// 按配置中的规则评估交易
+	fmt.Println("\n=== 规则引擎 ===")
+	config.CreateGroup(DefaultRuleGroup, "风控规则")
+	config.SetConfig(DefaultRuleGroup, "single_amount",
+		`{"type": "threshold", "field": "amount", "op": ">", "value": "$risk_limits.max_single_amount", "action": "deny"}`, "单笔限额", "admin")
+	config.SetConfig(DefaultRuleGroup, "night_large",
+		`{"type": "expression", "expr": "amount > 1000 && hour < 6", "action": "review"}`, "夜间大额交易", "admin")
+	engine := NewRuleEngine(config)
+	for _, event := range []RiskEvent{{"amount": 6000, "hour": 12}, {"amount": 2000, "hour": 3}, {"amount": 100, "hour": 12}} {
+		decision := engine.Evaluate(event)
+		fmt.Printf("%v: %s %d 条规则命中\n", event, decision.Action, len(decision.Matched))
+	}
+
+	// 撤销最近一次限额调整
+	fmt.Println("\n=== 版本回滚 ===")
+	if change, err := config.RollbackKey("risk_limits", "max_daily_amount", 6, "admin"); err == nil && change != nil {
+		fmt.Printf("%s.%s 回滚到版本 %d: %v -> %v\n", change.GroupName, change.Key, change.RollbackVersion, change.OldValue, change.NewValue)
+	}
+
 	// 显示统计信息
 	stats := config.GetStats()
 	fmt.Printf("\n=== 统计信息 ===\n")
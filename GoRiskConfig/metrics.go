@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// notificationLatencyBuckets 通知延迟直方图的桶上界（秒）
+var notificationLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 30}
+
+// configMetrics 配置中心的运行指标，有独立的锁，读取路径只持有rc.mutex的读锁时也能计数
+type configMetrics struct {
+	mutex          sync.Mutex
+	reads          map[string]int64 // 配置组 -> 读取次数
+	writes         map[string]int64 // 配置组 -> 变更次数
+	listenerErrors map[string]int64 // 监听器类型 -> 处理失败次数
+	latencyCounts  []int64          // 每个桶的计数（不累加），最后一个为+Inf
+	latencySum     float64
+	latencyCount   int64
+}
+
+func newConfigMetrics() *configMetrics {
+	return &configMetrics{
+		reads:          make(map[string]int64),
+		writes:         make(map[string]int64),
+		listenerErrors: make(map[string]int64),
+		latencyCounts:  make([]int64, len(notificationLatencyBuckets)+1),
+	}
+}
+
+func (m *configMetrics) read(groupName string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.reads[groupName]++
+}
+
+func (m *configMetrics) write(groupName string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.writes[groupName]++
+}
+
+func (m *configMetrics) listenerError(listener string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.listenerErrors[listener]++
+}
+
+// observeLatency 记录从变更发生到监听器处理完成的时间
+func (m *configMetrics) observeLatency(d time.Duration) {
+	seconds := d.Seconds()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	i := sort.SearchFloat64s(notificationLatencyBuckets, seconds)
+	m.latencyCounts[i]++
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// ChangeRateAlert 配置组在时间窗口内变更过于频繁，通常是自动化脚本失控的迹象
+type ChangeRateAlert struct {
+	Group     string        `json:"group"`
+	Changes   int           `json:"changes"` // 窗口内的变更次数
+	Window    time.Duration `json:"window"`
+	Limit     int           `json:"limit"`
+	UpdatedBy []string      `json:"updated_by"` // 窗口内的修改人
+	FiredAt   time.Time     `json:"fired_at"`
+}
+
+// changeRateRule 一条变更频率告警规则
+type changeRateRule struct {
+	limit   int
+	window  time.Duration
+	hook    func(ChangeRateAlert)
+	recent  map[string][]*ConfigChange // 配置组 -> 窗口内的变更
+	firedAt map[string]time.Time       // 配置组 -> 最近一次告警时间
+}
+
+// OnChangeRate 注册变更频率告警：任一配置组在window内变更超过limit次时异步调用hook。
+// 同一配置组告警后在window内不再重复告警。可注册多条不同阈值的规则
+func (rc *RiskConfig) OnChangeRate(limit int, window time.Duration, hook func(ChangeRateAlert)) error {
+	if limit < 1 || window <= 0 {
+		return fmt.Errorf("无效的告警规则: %d 次/%v", limit, window)
+	}
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.rateRules = append(rc.rateRules, &changeRateRule{
+		limit:   limit,
+		window:  window,
+		hook:    hook,
+		recent:  make(map[string][]*ConfigChange),
+		firedAt: make(map[string]time.Time),
+	})
+	return nil
+}
+
+// observeChangeLocked 统计变更并检查告警规则，调用方需持有写锁
+func (rc *RiskConfig) observeChangeLocked(change *ConfigChange) {
+	rc.metrics.write(change.GroupName)
+
+	for _, rule := range rc.rateRules {
+		cutoff := change.Timestamp.Add(-rule.window)
+		recent := rule.recent[change.GroupName]
+		for len(recent) > 0 && !recent[0].Timestamp.After(cutoff) {
+			recent = recent[1:]
+		}
+		recent = append(recent, change)
+		rule.recent[change.GroupName] = recent
+
+		if len(recent) <= rule.limit || change.Timestamp.Sub(rule.firedAt[change.GroupName]) < rule.window {
+			continue
+		}
+		rule.firedAt[change.GroupName] = change.Timestamp
+
+		alert := ChangeRateAlert{
+			Group:   change.GroupName,
+			Changes: len(recent),
+			Window:  rule.window,
+			Limit:   rule.limit,
+			FiredAt: change.Timestamp,
+		}
+		seen := make(map[string]bool)
+		for _, c := range recent {
+			if !seen[c.UpdatedBy] {
+				seen[c.UpdatedBy] = true
+				alert.UpdatedBy = append(alert.UpdatedBy, c.UpdatedBy)
+			}
+		}
+		sort.Strings(alert.UpdatedBy)
+		fmt.Printf("告警: 配置组 %s 在 %v 内变更 %d 次，超过 %d 次 (by %v)\n", alert.Group, alert.Window, alert.Changes, alert.Limit, alert.UpdatedBy)
+		go rule.hook(alert)
+	}
+}
+
+// WriteMetrics 以Prometheus文本格式输出指标
+func (rc *RiskConfig) WriteMetrics(w io.Writer) {
+	rc.mutex.RLock()
+	version := rc.version
+	items := make(map[string]int, len(rc.groups))
+	for name, group := range rc.groups {
+		items[name] = len(group.Items)
+	}
+	deadLetters := len(rc.deadLetters)
+	pending := 0
+	for _, q := range rc.listeners {
+		pending += q.backlog()
+	}
+	rc.mutex.RUnlock()
+
+	m := rc.metrics
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	writeCounter(w, "riskconfig_reads_total", "配置读取次数", "group", m.reads)
+	writeCounter(w, "riskconfig_writes_total", "配置变更次数", "group", m.writes)
+	writeCounter(w, "riskconfig_listener_errors_total", "监听器处理失败次数（含重试）", "listener", m.listenerErrors)
+
+	fmt.Fprintln(w, "# HELP riskconfig_notification_latency_seconds 从变更发生到监听器处理完成的时间")
+	fmt.Fprintln(w, "# TYPE riskconfig_notification_latency_seconds histogram")
+	var cumulative int64
+	for i, bound := range notificationLatencyBuckets {
+		cumulative += m.latencyCounts[i]
+		fmt.Fprintf(w, "riskconfig_notification_latency_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	fmt.Fprintf(w, "riskconfig_notification_latency_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(w, "riskconfig_notification_latency_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(w, "riskconfig_notification_latency_seconds_count %d\n", m.latencyCount)
+
+	fmt.Fprintln(w, "# HELP riskconfig_items 配置组中的配置项数")
+	fmt.Fprintln(w, "# TYPE riskconfig_items gauge")
+	for _, name := range sortedMetricLabels(items) {
+		fmt.Fprintf(w, "riskconfig_items{group=%q} %d\n", name, items[name])
+	}
+	writeGauge(w, "riskconfig_version", "全局配置版本号", version)
+	writeGauge(w, "riskconfig_pending_notifications", "监听器队列中尚未处理完的通知数", pending)
+	writeGauge(w, "riskconfig_dead_letters", "重试耗尽的通知数", deadLetters)
+}
+
+func writeCounter(w io.Writer, name, help, label string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, values[key])
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+func sortedMetricLabels(values map[string]int) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleMetrics GET /metrics 输出Prometheus文本格式的指标
+func (s *ConfigServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.config.WriteMetrics(w)
+}
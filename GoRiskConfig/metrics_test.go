@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMetricsCounters(t *testing.T) {
+	config := NewRiskConfig()
+	config.SetDeliveryPolicy(DeliveryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	config.AddListener(&retryableRecorder{failures: map[string]int{"mode": 1}, attempts: map[string]int{}})
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("blacklist", "黑名单")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	config.SetConfig("risk_limits", "mode", "strict", "", "admin")
+	config.CreateList("blacklist", "user_ids", []string{"u1"}, ListOptions{}, "admin")
+
+	config.GetConfig("risk_limits", "max_amount")
+	config.GetFloat("risk_limits", "max_amount", 0)
+	config.GetConfig("risk_limits", "missing")
+	config.Contains("blacklist", "user_ids", "u1")
+	waitUntil(t, func() bool { return config.GetStats()["pending_notifications"] == 0 })
+
+	var buf bytes.Buffer
+	config.WriteMetrics(&buf)
+	out := buf.String()
+	for _, line := range []string{
+		`riskconfig_reads_total{group="risk_limits"} 3`,
+		`riskconfig_reads_total{group="blacklist"} 1`,
+		`riskconfig_writes_total{group="risk_limits"} 2`,
+		`riskconfig_writes_total{group="blacklist"} 1`,
+		`riskconfig_listener_errors_total{listener="*main.retryableRecorder"} 1`,
+		`riskconfig_notification_latency_seconds_bucket{le="+Inf"} 3`,
+		`riskconfig_notification_latency_seconds_count 3`,
+		`riskconfig_items{group="risk_limits"} 2`,
+		"riskconfig_version 3",
+		"riskconfig_dead_letters 0",
+		"# TYPE riskconfig_notification_latency_seconds histogram",
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("指标输出缺少 %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestChangeRateAlert(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("switches", "开关")
+
+	var mu sync.Mutex
+	var alerts []ChangeRateAlert
+	if err := config.OnChangeRate(3, 200*time.Millisecond, func(alert ChangeRateAlert) {
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, alert)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.OnChangeRate(0, time.Minute, func(ChangeRateAlert) {}); err == nil {
+		t.Error("无效的告警规则应被拒绝")
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(alerts)
+	}
+
+	config.SetConfig("switches", "strict_mode", true, "", "admin")
+	for i := 0; i < 3; i++ {
+		config.SetConfig("risk_limits", "max_amount", float64(1000+i), "", "bot")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if count() != 0 {
+		t.Fatal("未超过阈值时不应告警")
+	}
+
+	// 事务中的每一项都计入变更次数，第4次变更时告警
+	config.Txn().Set("risk_limits", "max_amount", 2000.0, "").Set("risk_limits", "mode", "x", "").Commit("ops")
+	waitUntil(t, func() bool { return count() == 1 })
+	mu.Lock()
+	alert := alerts[0]
+	mu.Unlock()
+	if alert.Group != "risk_limits" || alert.Changes != 4 || alert.Limit != 3 || len(alert.UpdatedBy) != 2 || alert.UpdatedBy[0] != "bot" {
+		t.Errorf("告警内容不正确: %+v", alert)
+	}
+
+	// 窗口内不重复告警，窗口过后再次超过阈值时重新告警
+	config.SetConfig("risk_limits", "max_amount", 3000.0, "", "bot")
+	time.Sleep(250 * time.Millisecond)
+	if count() != 1 {
+		t.Errorf("同一窗口内不应重复告警: %d", count())
+	}
+	for i := 0; i < 4; i++ {
+		config.SetConfig("risk_limits", "max_amount", float64(4000+i), "", "bot")
+	}
+	waitUntil(t, func() bool { return count() == 2 })
+	mu.Lock()
+	defer mu.Unlock()
+	if alerts[1].Changes != 4 || len(alerts[1].UpdatedBy) != 1 {
+		t.Errorf("窗口外的变更不应计入: %+v", alerts[1])
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	server := httptest.NewServer(NewConfigServer(config))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type不正确: %s", resp.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), `riskconfig_writes_total{group="risk_limits"} 1`) {
+		t.Errorf("指标接口输出不正确:\n%s", body)
+	}
+	if resp, _ := http.Post(server.URL+"/metrics", "text/plain", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST应返回405，实际%d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 命名空间权限，高级别权限包含低级别权限
+const (
+	PermRead  = "read"  // 读取配置和变更历史
+	PermWrite = "write" // 修改、删除配置项，创建配置组
+	PermAdmin = "admin" // 管理访问控制列表
+)
+
+// AnyPrincipal 在访问控制列表中表示所有调用方
+const AnyPrincipal = "*"
+
+var permLevels = map[string]int{PermRead: 1, PermWrite: 2, PermAdmin: 3}
+
+// ErrAccessDenied 调用方对命名空间没有所需权限
+var ErrAccessDenied = errors.New("没有访问权限")
+
+// Namespace 租户命名空间，多个业务线共用一个配置中心时各自的配置组归属不同的命名空间。
+// 不属于任何命名空间的配置组不做访问控制
+type Namespace struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	ACL         map[string]string `json:"acl"` // 调用方 -> 权限
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// CreateNamespace 创建命名空间，owner获得admin权限
+func (rc *RiskConfig) CreateNamespace(name, description, owner string) error {
+	if name == "" || owner == "" {
+		return fmt.Errorf("命名空间名称和所有者不能为空")
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		if _, exists := rc.namespaces[name]; exists {
+			return fmt.Errorf("命名空间 %s 已存在", name)
+		}
+		rc.namespaces[name] = &Namespace{
+			Name:        name,
+			Description: description,
+			ACL:         map[string]string{owner: PermAdmin},
+			CreatedAt:   time.Now(),
+		}
+
+		fmt.Printf("创建命名空间: %s (owner %s)\n", name, owner)
+		return nil
+	})
+}
+
+// CreateNamespacedGroup 在命名空间中创建配置组，createdBy需要write权限
+func (rc *RiskConfig) CreateNamespacedGroup(namespace, name, description, createdBy string) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		if err := rc.authorizeNamespaceLocked(namespace, createdBy, PermWrite); err != nil {
+			return err
+		}
+		if _, exists := rc.groups[name]; exists {
+			return fmt.Errorf("配置组 %s 已存在", name)
+		}
+
+		rc.groups[name] = &ConfigGroup{
+			Name:        name,
+			Description: description,
+			Namespace:   namespace,
+			Items:       make(map[string]*ConfigItem),
+			Version:     1,
+			UpdatedAt:   time.Now(),
+		}
+
+		fmt.Printf("创建配置组: %s/%s (by %s)\n", namespace, name, createdBy)
+		return nil
+	})
+}
+
+// Grant 授予principal在命名空间中的权限，覆盖原有权限，grantedBy需要admin权限
+func (rc *RiskConfig) Grant(namespace, principal, perm, grantedBy string) error {
+	if _, valid := permLevels[perm]; !valid {
+		return fmt.Errorf("无效的权限: %s", perm)
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		if err := rc.authorizeNamespaceLocked(namespace, grantedBy, PermAdmin); err != nil {
+			return err
+		}
+		rc.namespaces[namespace].ACL[principal] = perm
+
+		fmt.Printf("授权: %s 在命名空间 %s 中获得%s权限 (by %s)\n", principal, namespace, perm, grantedBy)
+		return nil
+	})
+}
+
+// Revoke 撤销principal在命名空间中的权限，revokedBy需要admin权限。不能撤销最后一个admin
+func (rc *RiskConfig) Revoke(namespace, principal, revokedBy string) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		if err := rc.authorizeNamespaceLocked(namespace, revokedBy, PermAdmin); err != nil {
+			return err
+		}
+		ns := rc.namespaces[namespace]
+		if ns.ACL[principal] == PermAdmin {
+			admins := 0
+			for _, perm := range ns.ACL {
+				if perm == PermAdmin {
+					admins++
+				}
+			}
+			if admins == 1 {
+				return fmt.Errorf("不能撤销命名空间 %s 的最后一个管理员", namespace)
+			}
+		}
+		delete(ns.ACL, principal)
+
+		fmt.Printf("撤销授权: %s 在命名空间 %s 中的权限 (by %s)\n", principal, namespace, revokedBy)
+		return nil
+	})
+}
+
+// GetNamespace 获取命名空间及其访问控制列表
+func (rc *RiskConfig) GetNamespace(name string) (*Namespace, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	ns, exists := rc.namespaces[name]
+	if !exists {
+		return nil, fmt.Errorf("命名空间 %s 不存在", name)
+	}
+	return ns, nil
+}
+
+// NamespaceGroups 返回principal可读的命名空间中的配置组名，按名称排序
+func (rc *RiskConfig) NamespaceGroups(namespace, principal string) ([]string, error) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	if err := rc.authorizeNamespaceLocked(namespace, principal, PermRead); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name, group := range rc.groups {
+		if group.Namespace == namespace {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// authorizeNamespaceLocked 检查principal在命名空间中是否至少具有perm权限。调用方需持有锁
+func (rc *RiskConfig) authorizeNamespaceLocked(namespace, principal, perm string) error {
+	ns, exists := rc.namespaces[namespace]
+	if !exists {
+		return fmt.Errorf("命名空间 %s 不存在", namespace)
+	}
+	granted := permLevels[ns.ACL[principal]]
+	if wildcard := permLevels[ns.ACL[AnyPrincipal]]; wildcard > granted {
+		granted = wildcard
+	}
+	if granted < permLevels[perm] {
+		return fmt.Errorf("%w: %s 在命名空间 %s 中没有%s权限", ErrAccessDenied, principal, namespace, perm)
+	}
+	return nil
+}
+
+// authorizeGroupLocked 检查principal对配置组所属的命名空间是否具有perm权限，
+// 不属于命名空间或不存在的配置组不做检查。调用方需持有锁
+func (rc *RiskConfig) authorizeGroupLocked(groupName, principal, perm string) error {
+	group, exists := rc.groups[groupName]
+	if !exists || group.Namespace == "" {
+		return nil
+	}
+	return rc.authorizeNamespaceLocked(group.Namespace, principal, perm)
+}
+
+// GetConfigAs 以principal的身份读取配置项，需要配置组所属命名空间的read权限
+func (rc *RiskConfig) GetConfigAs(principal, groupName, key string) (interface{}, error) {
+	rc.mutex.RLock()
+	err := rc.authorizeGroupLocked(groupName, principal, PermRead)
+	rc.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return rc.GetConfig(groupName, key)
+}
+
+// canReadChangeLocked 事务中的每一项都可读时变更记录才可读。调用方需持有锁
+func (rc *RiskConfig) canReadChangeLocked(change *ConfigChange, principal string) bool {
+	for _, op := range change.Changes() {
+		if op.Namespace != "" && rc.authorizeNamespaceLocked(op.Namespace, principal, PermRead) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// GetHistoryFor 返回principal可读的最近limit条变更历史，跳过其无权读取的命名空间中的变更
+func (rc *RiskConfig) GetHistoryFor(principal string, limit int) []*ConfigChange {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+
+	var result []*ConfigChange
+	for i := len(rc.history) - 1; i >= 0 && (limit <= 0 || len(result) < limit); i-- {
+		change := rc.history[i]
+		if rc.canReadChangeLocked(change, principal) {
+			result = append(result, change)
+		}
+	}
+	// 与GetHistory一致，按时间从旧到新返回
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newTenantConfig(t *testing.T) *RiskConfig {
+	config := NewRiskConfig()
+	if err := config.CreateNamespace("payments", "支付业务线", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.CreateNamespace("lending", "信贷业务线", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.CreateNamespacedGroup("payments", "pay_limits", "支付限额", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.CreateNamespacedGroup("lending", "loan_limits", "贷款限额", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	config.CreateGroup("shared", "公共配置")
+	return config
+}
+
+func TestNamespaceWriteACL(t *testing.T) {
+	config := newTenantConfig(t)
+
+	if err := config.SetConfig("pay_limits", "max_amount", 1000.0, "", "alice"); err != nil {
+		t.Fatalf("所有者应可写入: %v", err)
+	}
+	err := config.SetConfig("pay_limits", "max_amount", 9999.0, "", "bob")
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Fatalf("其他业务线写入应被拒绝，实际 %v", err)
+	}
+	if err := config.DeleteConfig("pay_limits", "max_amount", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("其他业务线删除应被拒绝，实际 %v", err)
+	}
+	if value, _ := config.GetConfig("pay_limits", "max_amount"); value != 1000.0 {
+		t.Errorf("被拒绝的写入不应生效，实际%v", value)
+	}
+	if err := config.CreateNamespacedGroup("payments", "pay_rules", "", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("无write权限不能创建配置组，实际 %v", err)
+	}
+
+	// 授予read权限仍不能写；write权限可写但不能管理授权
+	config.Grant("payments", "bob", PermRead, "alice")
+	if err := config.SetConfig("pay_limits", "max_amount", 2.0, "", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("read权限不能写入，实际 %v", err)
+	}
+	config.Grant("payments", "bob", PermWrite, "alice")
+	if err := config.SetConfig("pay_limits", "max_amount", 2000.0, "", "bob"); err != nil {
+		t.Errorf("write权限应可写入: %v", err)
+	}
+	if err := config.Grant("payments", "carol", PermWrite, "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("没有admin权限不能授权，实际 %v", err)
+	}
+
+	// 环境覆盖、回滚和导入同样受访问控制
+	config.CreateEnvironment("prod", "")
+	if err := config.SetEnvConfig("prod", "loan_limits", "max_amount", 1.0, "", "alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("环境覆盖应检查权限，实际 %v", err)
+	}
+	if _, err := config.RollbackTo(0, "carol"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("回滚应检查权限，实际 %v", err)
+	}
+	if err := config.ImportConfig([]byte(`{"loan_limits": {"name": "loan_limits", "items": {}}}`), "alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("导入不能覆盖无权修改的配置组，实际 %v", err)
+	}
+	if err := config.ImportConfig([]byte(`{"sneaky": {"name": "sneaky", "namespace": "lending", "items": {}}}`), "alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("导入不能把配置组放入无权写入的命名空间，实际 %v", err)
+	}
+
+	// 不属于命名空间的配置组不做访问控制
+	if err := config.SetConfig("shared", "region", "CN", "", "anyone"); err != nil {
+		t.Errorf("公共配置组不应受限: %v", err)
+	}
+
+	// 撤销后失去权限；最后一个admin不能被撤销
+	if err := config.Revoke("payments", "bob", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetConfig("pay_limits", "max_amount", 3.0, "", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("撤销后应失去写权限，实际 %v", err)
+	}
+	if err := config.Revoke("payments", "alice", "alice"); err == nil {
+		t.Error("不能撤销最后一个管理员")
+	}
+	if err := config.Grant("payments", "bob", "owner", "alice"); err == nil {
+		t.Error("无效的权限应返回错误")
+	}
+}
+
+func TestNamespaceReadACLAndHistory(t *testing.T) {
+	config := newTenantConfig(t)
+	config.SetConfig("pay_limits", "max_amount", 1000.0, "", "alice")
+	config.SetConfig("loan_limits", "max_amount", 50000.0, "", "bob")
+	config.SetConfig("shared", "region", "CN", "", "ops")
+
+	history := config.GetHistory(0)
+	if history[0].Namespace != "payments" || history[1].Namespace != "lending" || history[2].Namespace != "" {
+		t.Errorf("变更历史应记录命名空间: %+v", history)
+	}
+
+	if _, err := config.GetConfigAs("alice", "loan_limits", "max_amount"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("无read权限不能读取，实际 %v", err)
+	}
+	if value, err := config.GetConfigAs("alice", "pay_limits", "max_amount"); err != nil || value != 1000.0 {
+		t.Errorf("所有者应可读取: %v %v", value, err)
+	}
+
+	visible := config.GetHistoryFor("alice", 0)
+	if len(visible) != 2 || visible[0].GroupName != "pay_limits" || visible[1].GroupName != "shared" {
+		t.Errorf("alice应只看到支付和公共配置的变更: %+v", visible)
+	}
+	if latest := config.GetHistoryFor("alice", 1); len(latest) != 1 || latest[0].GroupName != "shared" {
+		t.Errorf("limit应返回最近的可读变更: %+v", latest)
+	}
+
+	// 通配授权对所有调用方生效
+	config.Grant("lending", AnyPrincipal, PermRead, "bob")
+	if _, err := config.GetConfigAs("alice", "loan_limits", "max_amount"); err != nil {
+		t.Errorf("通配read权限应允许读取: %v", err)
+	}
+	if err := config.SetConfig("loan_limits", "max_amount", 1.0, "", "alice"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("通配read权限不应允许写入，实际 %v", err)
+	}
+	groups, err := config.NamespaceGroups("lending", "alice")
+	if err != nil || len(groups) != 1 || groups[0] != "loan_limits" {
+		t.Errorf("命名空间配置组不正确: %v %v", groups, err)
+	}
+}
+
+func TestNamespacePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := NewRiskConfig()
+	if err := config.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	config.CreateNamespace("payments", "支付业务线", "alice")
+	config.CreateNamespacedGroup("payments", "pay_limits", "支付限额", "alice")
+	config.Grant("payments", "bob", PermRead, "alice")
+
+	restarted := NewRiskConfig()
+	if err := restarted.AttachBackend(context.Background(), NewFileBackend(path)); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := restarted.GetNamespace("payments")
+	if err != nil || ns.ACL["alice"] != PermAdmin || ns.ACL["bob"] != PermRead {
+		t.Fatalf("重启后应恢复访问控制列表: %+v %v", ns, err)
+	}
+	if err := restarted.SetConfig("pay_limits", "max_amount", 1.0, "", "bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("重启后配置组应仍属于命名空间，实际 %v", err)
+	}
+}
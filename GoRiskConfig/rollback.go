@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// rollbackTarget 一个需要恢复的配置项及其在目标版本时的值
+type rollbackTarget struct {
+	groupName string
+	key       string
+	value     interface{} // nil表示目标版本时该配置项不存在
+}
+
+// valuesAtLocked 根据变更历史计算目标版本时的配置值：从当前值开始倒序撤销version之后的变更，
+// 整体写入的变更直接取OldValue，列表成员级的变更反向增删成员。keyFilter非nil时只计算指定配置项。
+// 调用方需持有锁
+func (rc *RiskConfig) valuesAtLocked(version int, keyFilter func(group, key string) bool) ([]rollbackTarget, error) {
+	if version < 0 || version > rc.version {
+		return nil, fmt.Errorf("版本 %d 不存在，当前版本为 %d", version, rc.version)
+	}
+	if version < rc.version && (len(rc.history) == 0 || rc.history[0].Version > version+1) {
+		return nil, fmt.Errorf("版本 %d 之后的变更历史已被清理，无法回滚", version)
+	}
+
+	seen := make(map[string]int)
+	var targets []rollbackTarget
+	for _, entry := range rc.history {
+		if entry.Version <= version || entry.Env != "" {
+			continue // 只回滚基础配置，环境覆盖值通过Promote或SetEnvConfig调整
+		}
+		for _, change := range entry.Changes() {
+			if keyFilter != nil && !keyFilter(change.GroupName, change.Key) {
+				continue
+			}
+			id := change.GroupName + "." + change.Key
+			if _, exists := seen[id]; exists {
+				continue
+			}
+			seen[id] = len(targets)
+			target := rollbackTarget{groupName: change.GroupName, key: change.Key}
+			if group, exists := rc.groups[change.GroupName]; exists {
+				if item, exists := group.Items[change.Key]; exists {
+					target.value = item.Value
+				}
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	for i := len(rc.history) - 1; i >= 0 && rc.history[i].Version > version; i-- {
+		entry := rc.history[i]
+		if entry.Env != "" {
+			continue
+		}
+		ops := entry.Changes()
+		for j := len(ops) - 1; j >= 0; j-- {
+			index, exists := seen[ops[j].GroupName+"."+ops[j].Key]
+			if !exists {
+				continue
+			}
+			if ops[j].List != nil {
+				targets[index].value = applyListDelta(targets[index].value, ops[j].List.inverse())
+			} else {
+				targets[index].value = ops[j].OldValue
+			}
+		}
+	}
+	return targets, nil
+}
+
+// applyRollbackLocked 校验并恢复配置项，每个实际变化的配置项记录一条回滚变更。
+// 任何一项校验失败时不做任何修改。调用方需持有写锁
+func (rc *RiskConfig) applyRollbackLocked(targets []rollbackTarget, version int, rolledBackBy string) ([]*ConfigChange, error) {
+	for _, target := range targets {
+		if _, exists := rc.groups[target.groupName]; !exists {
+			return nil, fmt.Errorf("配置组 %s 不存在", target.groupName)
+		}
+		if err := rc.authorizeGroupLocked(target.groupName, rolledBackBy, PermWrite); err != nil {
+			return nil, err
+		}
+		if target.value == nil {
+			continue
+		}
+		if err := rc.validateLocked(target.groupName, target.key, target.value); err != nil {
+			return nil, fmt.Errorf("回滚到版本 %d 失败: %v", version, err)
+		}
+	}
+
+	var changes []*ConfigChange
+	now := time.Now()
+	for _, target := range targets {
+		group := rc.groups[target.groupName]
+		oldItem := group.Items[target.key]
+
+		var oldValue interface{}
+		if oldItem != nil {
+			oldValue = oldItem.Value
+		}
+		if (oldItem == nil && target.value == nil) || (oldItem != nil && target.value != nil && sameValue(oldValue, target.value)) {
+			continue
+		}
+
+		if target.value == nil {
+			delete(group.Items, target.key)
+		} else {
+			item := &ConfigItem{Key: target.key, Value: target.value, Version: 1, UpdatedAt: now, UpdatedBy: rolledBackBy}
+			if oldItem != nil {
+				item.Description = oldItem.Description
+				item.Version = oldItem.Version + 1
+				item.Tags = oldItem.Tags
+				item.List = oldItem.List
+				item.indexList()
+			}
+			group.Items[target.key] = item
+		}
+		group.Version++
+		group.UpdatedAt = now
+		rc.version++
+
+		change := &ConfigChange{
+			GroupName:       target.groupName,
+			Key:             target.key,
+			OldValue:        oldValue,
+			NewValue:        target.value,
+			UpdatedBy:       rolledBackBy,
+			Timestamp:       now,
+			Version:         rc.version,
+			Rollback:        true,
+			RollbackVersion: version,
+		}
+		rc.recordChangeLocked(change)
+		changes = append(changes, change)
+	}
+
+	if len(changes) > 0 {
+		fmt.Printf("回滚到版本 %d: %d 项变更 (by %s)\n", version, len(changes), rolledBackBy)
+	}
+	return changes, nil
+}
+
+// RollbackTo 把所有配置项恢复到指定版本时的值，回滚本身作为新的变更记录，返回产生的变更
+func (rc *RiskConfig) RollbackTo(version int, rolledBackBy string) ([]*ConfigChange, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var changes []*ConfigChange
+	err := rc.updateLocked(func() error {
+		targets, err := rc.valuesAtLocked(version, nil)
+		if err != nil {
+			return err
+		}
+		// 按配置组和键排序，保证回滚产生的变更顺序稳定
+		sort.Slice(targets, func(i, j int) bool {
+			if targets[i].groupName != targets[j].groupName {
+				return targets[i].groupName < targets[j].groupName
+			}
+			return targets[i].key < targets[j].key
+		})
+		changes, err = rc.applyRollbackLocked(targets, version, rolledBackBy)
+		if err == nil && len(changes) == 0 {
+			return errUnchanged
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// RollbackKey 把单个配置项恢复到指定版本时的值，该配置项没有变化时返回nil
+func (rc *RiskConfig) RollbackKey(groupName, key string, version int, rolledBackBy string) (*ConfigChange, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var changes []*ConfigChange
+	err := rc.updateLocked(func() error {
+		if _, exists := rc.groups[groupName]; !exists {
+			return fmt.Errorf("配置组 %s 不存在", groupName)
+		}
+		targets, err := rc.valuesAtLocked(version, func(group, k string) bool {
+			return group == groupName && k == key
+		})
+		if err != nil {
+			return err
+		}
+		changes, err = rc.applyRollbackLocked(targets, version, rolledBackBy)
+		if err == nil && len(changes) == 0 {
+			return errUnchanged
+		}
+		return err
+	})
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+	return changes[0], nil
+}
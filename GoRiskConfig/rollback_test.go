@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRollbackTo(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("limits", "限额")
+	config.SetConfig("limits", "max_amount", 1000.0, "单笔限额", "admin") // v1
+	config.SetConfig("limits", "max_count", 10, "次数限额", "admin")      // v2
+	config.SetConfig("limits", "max_amount", 2000.0, "单笔限额", "ops")   // v3
+	config.DeleteConfig("limits", "max_count", "ops")                 // v4
+	config.SetConfig("limits", "new_key", "x", "新配置", "ops")          // v5
+
+	time.Sleep(50 * time.Millisecond) // 等待上面写入的异步通知完成
+
+	var mu sync.Mutex
+	notified := make(map[string]interface{})
+	config.AddListener(&testListener{onChange: func(group, key string, oldValue, newValue interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified[key] = newValue
+	}})
+
+	changes, err := config.RollbackTo(2, "auditor")
+	if err != nil {
+		t.Fatalf("回滚失败: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("期望3条回滚变更，实际%d条", len(changes))
+	}
+	for _, change := range changes {
+		if !change.Rollback || change.RollbackVersion != 2 || change.UpdatedBy != "auditor" {
+			t.Errorf("回滚变更记录不正确: %+v", change)
+		}
+	}
+
+	if value, _ := config.GetConfig("limits", "max_amount"); value != 1000.0 {
+		t.Errorf("max_amount应恢复为1000，实际%v", value)
+	}
+	if value, _ := config.GetConfig("limits", "max_count"); value != 10 {
+		t.Errorf("max_count应恢复为10，实际%v", value)
+	}
+	if _, err := config.GetConfig("limits", "new_key"); err == nil {
+		t.Error("new_key在版本2时不存在，应被删除")
+	}
+	group, _ := config.GetGroup("limits")
+	if group.Items["max_amount"].Description != "单笔限额" {
+		t.Error("回滚应保留配置项描述")
+	}
+
+	history := config.GetHistory(0)
+	if len(history) != 8 || history[7].Version != 8 || config.GetStats()["version"] != 8 {
+		t.Errorf("回滚应作为新变更记录到历史，实际%d条", len(history))
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	if len(notified) != 3 || notified["new_key"] != nil || notified["max_amount"] != 1000.0 {
+		t.Errorf("监听器通知不正确: %v", notified)
+	}
+	mu.Unlock()
+
+	// 回滚本身也可以被回滚
+	if _, err := config.RollbackTo(5, "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := config.GetConfig("limits", "new_key"); value != "x" {
+		t.Errorf("回滚撤销后new_key应恢复，实际%v", value)
+	}
+
+	// 已经是目标状态时不产生变更
+	changes, err = config.RollbackTo(config.GetStats()["version"], "auditor")
+	if err != nil || len(changes) != 0 {
+		t.Errorf("回滚到当前版本不应产生变更: %v %v", changes, err)
+	}
+	if _, err := config.RollbackTo(100, "auditor"); err == nil {
+		t.Error("回滚到不存在的版本应返回错误")
+	}
+}
+
+func TestRollbackKey(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("limits", "限额")
+	config.SetConfig("limits", "a", 1, "", "admin") // v1
+	config.SetConfig("limits", "b", 1, "", "admin") // v2
+	config.SetConfig("limits", "a", 2, "", "admin") // v3
+	config.SetConfig("limits", "b", 2, "", "admin") // v4
+
+	events := config.Watch(context.Background(), WatchRequest{FromVersion: 4}, 0)
+
+	change, err := config.RollbackKey("limits", "a", 1, "ops")
+	if err != nil || change == nil {
+		t.Fatalf("回滚单个配置项失败: %v", err)
+	}
+	if change.OldValue != 2 || change.NewValue != 1 || change.Version != 5 {
+		t.Errorf("回滚变更记录不正确: %+v", change)
+	}
+	if value, _ := config.GetConfig("limits", "b"); value != 2 {
+		t.Errorf("其他配置项不应被回滚，实际%v", value)
+	}
+
+	select {
+	case event := <-events:
+		if event.Key != "a" || event.Value != 1 || event.Version != 5 {
+			t.Errorf("订阅者收到的事件不正确: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("订阅者未收到回滚事件")
+	}
+
+	// 回滚到配置项创建之前等于删除
+	if _, err := config.RollbackKey("limits", "b", 1, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.GetConfig("limits", "b"); err == nil {
+		t.Error("b在版本1时不存在，应被删除")
+	}
+
+	if change, err := config.RollbackKey("limits", "a", 1, "ops"); change != nil || err != nil {
+		t.Errorf("配置项已是目标值时不应产生变更: %v %v", change, err)
+	}
+	if _, err := config.RollbackKey("missing", "a", 1, "ops"); err == nil {
+		t.Error("回滚不存在的配置组应返回错误")
+	}
+}
+
+func TestRollbackValidationAndTrimmedHistory(t *testing.T) {
+	config := NewRiskConfig()
+	config.maxHistory = 2
+	config.CreateGroup("limits", "限额")
+	config.SetConfig("limits", "amount", "1000", "", "admin") // v1
+	config.SetConfig("limits", "amount", 2000.0, "", "admin") // v2
+	config.SetSchema("limits", &GroupSchema{Properties: map[string]*FieldSchema{"amount": {Type: SchemaNumber}}})
+
+	if _, err := config.RollbackKey("limits", "amount", 1, "ops"); err == nil {
+		t.Error("回滚后的值不符合校验规则时应返回错误")
+	}
+	if value, _ := config.GetConfig("limits", "amount"); value != 2000.0 {
+		t.Errorf("校验失败时不应修改配置，实际%v", value)
+	}
+
+	config.SetConfig("limits", "amount", 3000.0, "", "admin") // v3，历史只保留v2、v3
+	if _, err := config.RollbackTo(0, "ops"); err == nil {
+		t.Error("历史已被清理的版本不能回滚")
+	}
+	if _, err := config.RollbackTo(2, "ops"); err != nil {
+		t.Errorf("版本2之后的历史完整，应能回滚: %v", err)
+	}
+	if value, _ := config.GetConfig("limits", "amount"); value != 2000.0 {
+		t.Errorf("amount应恢复为2000，实际%v", value)
+	}
+}
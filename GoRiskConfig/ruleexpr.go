@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 规则表达式语法：
+//   字面量   1000、"CN"、true、false、null、[1, 2]
+//   变量     amount、user.country（从事件上下文读取），$risk_limits.max_single_amount（从配置读取）
+//   运算     + - * /、== != < <= > >=、in、&& || !、括号
+
+type exprTokenKind int
+
+const (
+	exprEOF exprTokenKind = iota
+	exprNumber
+	exprString
+	exprIdent
+	exprOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(src)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			num, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("位置%d: 无效的数字 %s", start, string(runes[start:i]))
+			}
+			tokens = append(tokens, exprToken{kind: exprNumber, num: num, text: string(runes[start:i]), pos: start})
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("位置%d: 字符串未结束", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: exprString, text: sb.String(), pos: start})
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: exprIdent, text: string(runes[start:i]), pos: start})
+		default:
+			start := i
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch two {
+			case "==", "!=", "<=", ">=", "&&", "||":
+				tokens = append(tokens, exprToken{kind: exprOp, text: two, pos: start})
+				i += 2
+				continue
+			}
+			if !strings.ContainsRune("+-*/<>!()[],", r) {
+				return nil, fmt.Errorf("位置%d: 无法识别的字符 %q", start, r)
+			}
+			tokens = append(tokens, exprToken{kind: exprOp, text: string(r), pos: start})
+			i++
+		}
+	}
+	return append(tokens, exprToken{kind: exprEOF, pos: len(runes)}), nil
+}
+
+// exprNode 表达式语法树节点
+type exprNode interface {
+	eval(env exprEnv) (interface{}, error)
+}
+
+// exprEnv 表达式求值时查找变量
+type exprEnv interface {
+	lookup(name string) (interface{}, bool)
+}
+
+type literalNode struct{ value interface{} }
+
+type identNode struct{ name string }
+
+type listNode struct{ items []exprNode }
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+// CompiledExpr 编译后的规则表达式
+type CompiledExpr struct {
+	Source string
+	root   exprNode
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// CompileExpr 编译规则表达式
+func CompileExpr(src string) (*CompiledExpr, error) {
+	tokens, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != exprEOF {
+		return nil, fmt.Errorf("位置%d: 多余的内容 %q", tok.pos, tok.text)
+	}
+	return &CompiledExpr{Source: src, root: root}, nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != exprEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) acceptOp(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != exprOp && !(tok.kind == exprIdent && tok.text == "in") {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.acceptOp(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("位置%d: 期望 %q", tok.pos, op)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOp("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.acceptOp("==", "!=", "<", "<=", ">", ">=", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseAdditive() (exprNode, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseMultiplicative() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOp("*", "/")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.acceptOp("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case exprNumber:
+		return &literalNode{value: tok.num}, nil
+	case exprString:
+		return &literalNode{value: tok.text}, nil
+	case exprIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		return &identNode{name: tok.text}, nil
+	case exprOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			list := &listNode{}
+			if _, ok := p.acceptOp("]"); ok {
+				return list, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if _, ok := p.acceptOp(","); !ok {
+					return list, p.expect("]")
+				}
+			}
+		}
+	case exprEOF:
+		return nil, fmt.Errorf("位置%d: 表达式不完整", tok.pos)
+	}
+	return nil, fmt.Errorf("位置%d: 意外的 %q", tok.pos, tok.text)
+}
+
+// Eval 在给定环境中求值
+func (ce *CompiledExpr) Eval(env exprEnv) (interface{}, error) {
+	return ce.root.eval(env)
+}
+
+func (n *literalNode) eval(env exprEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *identNode) eval(env exprEnv) (interface{}, error) {
+	value, ok := env.lookup(n.name)
+	if !ok {
+		return nil, fmt.Errorf("未定义的变量 %s", n.name)
+	}
+	return value, nil
+}
+
+func (n *listNode) eval(env exprEnv) (interface{}, error) {
+	items := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+	return items, nil
+}
+
+func (n *unaryNode) eval(env exprEnv) (interface{}, error) {
+	value, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("! 需要布尔值，实际为 %s", describeValue(value))
+		}
+		return !b, nil
+	}
+	f, ok := toFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("- 需要数值，实际为 %s", describeValue(value))
+	}
+	return -f, nil
+}
+
+func (n *binaryNode) eval(env exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// 逻辑运算短路求值
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s 需要布尔值，实际为 %s", n.op, describeValue(left))
+		}
+		if (n.op == "&&" && !l) || (n.op == "||" && l) {
+			return l, nil
+		}
+		right, err := n.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s 需要布尔值，实际为 %s", n.op, describeValue(right))
+		}
+		return r, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return sameValue(normalizeNumber(left), normalizeNumber(right)), nil
+	case "!=":
+		return !sameValue(normalizeNumber(left), normalizeNumber(right)), nil
+	case "in":
+		return containsValue(right, left)
+	}
+
+	if ls, ok := left.(string); ok {
+		rs, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s 两侧类型不一致", n.op)
+		}
+		switch n.op {
+		case "+":
+			return ls + rs, nil
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+		return nil, fmt.Errorf("字符串不支持 %s", n.op)
+	}
+
+	l, lok := toFloat(left)
+	r, rok := toFloat(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("%s 需要数值，实际为 %s 和 %s", n.op, describeValue(left), describeValue(right))
+	}
+	switch n.op {
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("除数为0")
+		}
+		return l / r, nil
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	}
+	return nil, fmt.Errorf("不支持的运算符 %s", n.op)
+}
+
+// normalizeNumber 把各种数值类型统一为float64，使 50 == 50.0
+func normalizeNumber(v interface{}) interface{} {
+	if f, ok := toFloat(v); ok {
+		return f
+	}
+	return v
+}
+
+// containsValue 判断列表中是否包含某个值
+func containsValue(list, value interface{}) (bool, error) {
+	var items []interface{}
+	switch l := list.(type) {
+	case []interface{}:
+		items = l
+	case []string:
+		for _, s := range l {
+			items = append(items, s)
+		}
+	default:
+		return false, fmt.Errorf("in 右侧需要列表，实际为 %s", describeValue(list))
+	}
+	for _, item := range items {
+		if sameValue(normalizeNumber(item), normalizeNumber(value)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
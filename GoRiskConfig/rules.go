@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 规则引擎的决策结果，严重程度依次升高
+const (
+	ActionAllow  = "allow"
+	ActionReview = "review"
+	ActionDeny   = "deny"
+)
+
+// 规则类型
+const (
+	RuleThreshold  = "threshold"  // 字段与阈值比较
+	RuleExpression = "expression" // 布尔表达式
+	RuleList       = "list"       // 字段是否在名单中
+)
+
+// DefaultRuleGroup 存放规则的配置组，每个配置项是一条规则，配置键即规则ID
+const DefaultRuleGroup = "risk_rules"
+
+// Rule 配置中的一条规则
+type Rule struct {
+	ID          string        `json:"id,omitempty"`
+	Type        string        `json:"type"`
+	Description string        `json:"description,omitempty"`
+	Action      string        `json:"action"`
+	Priority    int           `json:"priority,omitempty"`
+	Disabled    bool          `json:"disabled,omitempty"`
+	Field       string        `json:"field,omitempty"`  // threshold/list: 事件字段，支持 user.country 形式的路径
+	Op          string        `json:"op,omitempty"`     // threshold: > >= < <= == !=
+	Value       interface{}   `json:"value,omitempty"`  // threshold: 阈值，"$组名.配置键" 引用其他配置
+	Expr        string        `json:"expr,omitempty"`   // expression
+	List        string        `json:"list,omitempty"`   // list: 名单所在配置，格式为 "组名.配置键"
+	Values      []interface{} `json:"values,omitempty"` // list: 直接给出的名单
+	NotIn       bool          `json:"not_in,omitempty"` // list: 不在名单中时命中（白名单）
+}
+
+// RiskEvent 待评估的交易或事件上下文，可以嵌套，如 {"amount": 100, "user": {"country": "CN"}}
+type RiskEvent map[string]interface{}
+
+// RuleMatch 命中的规则
+type RuleMatch struct {
+	RuleID      string `json:"rule_id"`
+	Type        string `json:"type"`
+	Action      string `json:"action"`
+	Priority    int    `json:"priority"`
+	Description string `json:"description,omitempty"`
+	Detail      string `json:"detail"`
+}
+
+// RuleDecision 规则引擎的评估结果
+type RuleDecision struct {
+	Action        string      `json:"action"`
+	Matched       []RuleMatch `json:"matched"`
+	Errors        []string    `json:"errors,omitempty"` // 无法解析或求值的规则，存在时结果至少为review
+	ConfigVersion int         `json:"config_version"`
+}
+
+// RuleEngine 根据配置中的规则评估事件
+type RuleEngine struct {
+	config *RiskConfig
+	Group  string
+	exprs  map[string]*CompiledExpr
+	mutex  sync.Mutex
+}
+
+// NewRuleEngine 创建规则引擎，规则从DefaultRuleGroup读取
+func NewRuleEngine(config *RiskConfig) *RuleEngine {
+	return &RuleEngine{
+		config: config,
+		Group:  DefaultRuleGroup,
+		exprs:  make(map[string]*CompiledExpr),
+	}
+}
+
+// actionSeverity 决策的严重程度
+func actionSeverity(action string) int {
+	switch action {
+	case ActionDeny:
+		return 2
+	case ActionReview:
+		return 1
+	}
+	return 0
+}
+
+// ParseRule 把配置值解析为规则，配置值可以是Rule、JSON对象或JSON字符串
+func ParseRule(id string, value interface{}) (*Rule, error) {
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	var rule Rule
+	if err := json.Unmarshal(data, &rule); err != nil {
+		return nil, fmt.Errorf("规则 %s 格式错误: %v", id, err)
+	}
+	rule.ID = id
+
+	switch rule.Action {
+	case ActionAllow, ActionReview, ActionDeny:
+	default:
+		return nil, fmt.Errorf("规则 %s 的action无效: %q", id, rule.Action)
+	}
+	switch rule.Type {
+	case RuleThreshold:
+		switch rule.Op {
+		case ">", ">=", "<", "<=", "==", "!=":
+		default:
+			return nil, fmt.Errorf("规则 %s 的op无效: %q", id, rule.Op)
+		}
+		if rule.Field == "" || rule.Value == nil {
+			return nil, fmt.Errorf("规则 %s 缺少field或value", id)
+		}
+	case RuleExpression:
+		if rule.Expr == "" {
+			return nil, fmt.Errorf("规则 %s 缺少expr", id)
+		}
+	case RuleList:
+		if rule.Field == "" || (rule.List == "" && len(rule.Values) == 0) {
+			return nil, fmt.Errorf("规则 %s 缺少field或名单", id)
+		}
+	default:
+		return nil, fmt.Errorf("规则 %s 的type无效: %q", id, rule.Type)
+	}
+	return &rule, nil
+}
+
+// ruleEnv 规则求值环境：事件字段和配置快照
+type ruleEnv struct {
+	event  RiskEvent
+	values map[string]map[string]interface{}
+}
+
+func (env *ruleEnv) lookup(name string) (interface{}, bool) {
+	if strings.HasPrefix(name, "$") {
+		return env.configValue(name[1:])
+	}
+
+	var current interface{} = map[string]interface{}(env.event)
+	for _, part := range strings.Split(name, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// configValue 按 "组名.配置键" 读取配置
+func (env *ruleEnv) configValue(ref string) (interface{}, bool) {
+	parts := strings.SplitN(ref, ".", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+	value, ok := env.values[parts[0]][parts[1]]
+	return value, ok
+}
+
+// compileExpr 编译表达式并缓存
+func (re *RuleEngine) compileExpr(src string) (*CompiledExpr, error) {
+	re.mutex.Lock()
+	defer re.mutex.Unlock()
+
+	if expr, ok := re.exprs[src]; ok {
+		return expr, nil
+	}
+	expr, err := CompileExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	re.exprs[src] = expr
+	return expr, nil
+}
+
+// match 评估单条规则，返回是否命中及说明
+func (re *RuleEngine) match(rule *Rule, env *ruleEnv) (bool, string, error) {
+	switch rule.Type {
+	case RuleThreshold:
+		threshold := rule.Value
+		if ref, ok := threshold.(string); ok && strings.HasPrefix(ref, "$") {
+			value, ok := env.lookup(ref)
+			if !ok {
+				return false, "", fmt.Errorf("规则 %s 引用的配置 %s 不存在", rule.ID, ref)
+			}
+			threshold = value
+		}
+		actual, ok := env.lookup(rule.Field)
+		if !ok {
+			return false, "", nil
+		}
+		node := &binaryNode{op: rule.Op, left: &literalNode{value: actual}, right: &literalNode{value: threshold}}
+		result, err := node.eval(env)
+		if err != nil {
+			return false, "", fmt.Errorf("规则 %s: %v", rule.ID, err)
+		}
+		return result == true, fmt.Sprintf("%s=%v %s %v", rule.Field, actual, rule.Op, threshold), nil
+
+	case RuleExpression:
+		expr, err := re.compileExpr(rule.Expr)
+		if err != nil {
+			return false, "", fmt.Errorf("规则 %s 表达式错误: %v", rule.ID, err)
+		}
+		result, err := expr.Eval(env)
+		if err != nil {
+			return false, "", fmt.Errorf("规则 %s: %v", rule.ID, err)
+		}
+		matched, ok := result.(bool)
+		if !ok {
+			return false, "", fmt.Errorf("规则 %s 表达式结果不是布尔值", rule.ID)
+		}
+		return matched, rule.Expr, nil
+
+	case RuleList:
+		list := interface{}(rule.Values)
+		name := "values"
+		if rule.List != "" {
+			value, ok := env.configValue(rule.List)
+			if !ok {
+				return false, "", fmt.Errorf("规则 %s 引用的名单 %s 不存在", rule.ID, rule.List)
+			}
+			list, name = value, rule.List
+		}
+		actual, ok := env.lookup(rule.Field)
+		if !ok {
+			return false, "", nil
+		}
+		found, err := containsValue(list, actual)
+		if err != nil {
+			return false, "", fmt.Errorf("规则 %s: %v", rule.ID, err)
+		}
+		if rule.NotIn {
+			return !found, fmt.Sprintf("%s=%v 不在名单 %s 中", rule.Field, actual, name), nil
+		}
+		return found, fmt.Sprintf("%s=%v 在名单 %s 中", rule.Field, actual, name), nil
+	}
+	return false, "", nil
+}
+
+// snapshotWithVersion 在同一把锁内复制配置值和全局版本
+func (rc *RiskConfig) snapshotWithVersion() (map[string]map[string]interface{}, int) {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	return rc.snapshotValuesLocked(), rc.version
+}
+
+// Rules 返回配置中的全部规则，按优先级从高到低、ID升序排列，无法解析的规则以错误返回
+func (re *RuleEngine) Rules() ([]*Rule, []error) {
+	values, _ := re.config.snapshotWithVersion()
+	return parseRules(values[re.Group])
+}
+
+func parseRules(items map[string]interface{}) ([]*Rule, []error) {
+	var rules []*Rule
+	var errs []error
+	for id, value := range items {
+		rule, err := ParseRule(id, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return rules, errs
+}
+
+// Evaluate 用当前配置评估事件：所有启用的规则都会被评估，结果取命中规则中最严重的action，
+// 未命中任何规则时为allow；规则本身有错误时结果至少为review，避免错误配置静默放行
+func (re *RuleEngine) Evaluate(event RiskEvent) *RuleDecision {
+	values, version := re.config.snapshotWithVersion()
+	rules, errs := parseRules(values[re.Group])
+
+	decision := &RuleDecision{Action: ActionAllow, Matched: []RuleMatch{}, ConfigVersion: version}
+	for _, err := range errs {
+		decision.Errors = append(decision.Errors, err.Error())
+	}
+
+	env := &ruleEnv{event: event, values: values}
+	for _, rule := range rules {
+		if rule.Disabled {
+			continue
+		}
+		matched, detail, err := re.match(rule, env)
+		if err != nil {
+			decision.Errors = append(decision.Errors, err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		decision.Matched = append(decision.Matched, RuleMatch{
+			RuleID:      rule.ID,
+			Type:        rule.Type,
+			Action:      rule.Action,
+			Priority:    rule.Priority,
+			Description: rule.Description,
+			Detail:      detail,
+		})
+		if actionSeverity(rule.Action) > actionSeverity(decision.Action) {
+			decision.Action = rule.Action
+		}
+	}
+
+	if len(decision.Errors) > 0 && actionSeverity(decision.Action) < actionSeverity(ActionReview) {
+		decision.Action = ActionReview
+	}
+	return decision
+}
+
+// handleEvaluate 处理 POST /rules/evaluate，请求体为 {"event": {...}}
+func (s *ConfigServer) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持POST")
+		return
+	}
+
+	var req struct {
+		Event RiskEvent `json:"event"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.rules.Evaluate(req.Event))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newRuleConfig(t *testing.T) *RiskConfig {
+	t.Helper()
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.CreateGroup("blacklist", "黑名单配置")
+	config.CreateGroup(DefaultRuleGroup, "风控规则")
+	config.SetConfig("risk_limits", "max_single_amount", 5000.0, "", "admin")
+	config.SetConfig("blacklist", "countries", []interface{}{"KP", "IR"}, "", "admin")
+
+	rules := map[string]string{
+		"single_amount": `{"type": "threshold", "field": "amount", "op": ">", "value": "$risk_limits.max_single_amount", "action": "deny", "priority": 10}`,
+		"night_minor":   `{"type": "expression", "expr": "user.age < 18 && (hour >= 23 || hour < 6)", "action": "review", "description": "未成年人夜间交易"}`,
+		"country":       `{"type": "list", "field": "user.country", "list": "blacklist.countries", "action": "deny", "priority": 20}`,
+		"vip_fast":      `{"type": "list", "field": "user.level", "values": ["gold", "platinum"], "action": "allow"}`,
+	}
+	for id, rule := range rules {
+		if err := config.SetConfig(DefaultRuleGroup, id, rule, "", "admin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return config
+}
+
+func TestCompileExpr(t *testing.T) {
+	env := &ruleEnv{
+		event:  RiskEvent{"amount": 120.0, "count": 3, "user": map[string]interface{}{"country": "CN"}},
+		values: map[string]map[string]interface{}{"risk_limits": {"max": 100.0}},
+	}
+	cases := map[string]interface{}{
+		"amount * 2 - 40 > 200":                   false,
+		"amount > $risk_limits.max":               true,
+		"user.country in ['CN', 'US']":            true,
+		"!(count == 3) || user.country != \"CN\"": false,
+		"-amount + 20 == -100":                    true,
+		"count / 2":                               1.5,
+	}
+	for src, expected := range cases {
+		expr, err := CompileExpr(src)
+		if err != nil {
+			t.Errorf("%s 编译失败: %v", src, err)
+			continue
+		}
+		result, err := expr.Eval(env)
+		if err != nil || result != expected {
+			t.Errorf("%s 期望 %v，实际 %v (%v)", src, expected, result, err)
+		}
+	}
+
+	for _, src := range []string{"amount >", "(amount > 1", "amount # 1", "amount > 1 2"} {
+		if _, err := CompileExpr(src); err == nil {
+			t.Errorf("%s 应编译失败", src)
+		}
+	}
+	if expr, _ := CompileExpr("missing > 1"); expr != nil {
+		if _, err := expr.Eval(env); err == nil {
+			t.Error("未定义变量应报错")
+		}
+	}
+}
+
+func TestRuleEngineEvaluate(t *testing.T) {
+	engine := NewRuleEngine(newRuleConfig(t))
+
+	decision := engine.Evaluate(RiskEvent{"amount": 100, "hour": 12, "user": map[string]interface{}{"age": 30, "country": "CN", "level": "silver"}})
+	if decision.Action != ActionAllow || len(decision.Matched) != 0 {
+		t.Errorf("普通交易应放行: %+v", decision)
+	}
+
+	decision = engine.Evaluate(RiskEvent{"amount": 8000, "hour": 12, "user": map[string]interface{}{"age": 30, "country": "KP", "level": "gold"}})
+	if decision.Action != ActionDeny || len(decision.Matched) != 3 {
+		t.Fatalf("期望拒绝并命中3条规则: %+v", decision)
+	}
+	// 按优先级排列
+	if decision.Matched[0].RuleID != "country" || decision.Matched[1].RuleID != "single_amount" {
+		t.Errorf("命中规则顺序不正确: %+v", decision.Matched)
+	}
+	if !strings.Contains(decision.Matched[1].Detail, "5000") {
+		t.Errorf("阈值规则应说明引用的限额: %s", decision.Matched[1].Detail)
+	}
+
+	decision = engine.Evaluate(RiskEvent{"amount": 100, "hour": 2, "user": map[string]interface{}{"age": 16, "country": "CN"}})
+	if decision.Action != ActionReview || decision.Matched[0].RuleID != "night_minor" {
+		t.Errorf("期望人工审核: %+v", decision)
+	}
+
+	// 修改配置中的限额立即生效
+	engine.config.SetConfig("risk_limits", "max_single_amount", 50.0, "", "admin")
+	decision = engine.Evaluate(RiskEvent{"amount": 100, "hour": 12, "user": map[string]interface{}{"age": 30, "country": "CN"}})
+	if decision.Action != ActionDeny {
+		t.Errorf("降低限额后应拒绝: %+v", decision)
+	}
+}
+
+func TestRuleEngineBrokenRules(t *testing.T) {
+	config := newRuleConfig(t)
+	config.SetConfig(DefaultRuleGroup, "broken_expr", `{"type": "expression", "expr": "amount >", "action": "deny"}`, "", "admin")
+	config.SetConfig(DefaultRuleGroup, "bad_action", `{"type": "threshold", "field": "amount", "op": ">", "value": 1, "action": "block"}`, "", "admin")
+	config.SetConfig(DefaultRuleGroup, "disabled", `{"type": "threshold", "field": "amount", "op": ">", "value": 1, "action": "deny", "disabled": true}`, "", "admin")
+
+	engine := NewRuleEngine(config)
+	decision := engine.Evaluate(RiskEvent{"amount": 100, "hour": 12, "user": map[string]interface{}{"age": 30, "country": "CN"}})
+	if decision.Action != ActionReview {
+		t.Errorf("存在错误规则时应转人工审核: %+v", decision)
+	}
+	if len(decision.Errors) != 2 {
+		t.Errorf("期望2个规则错误，实际 %v", decision.Errors)
+	}
+	if len(decision.Matched) != 0 {
+		t.Errorf("禁用的规则不应命中: %+v", decision.Matched)
+	}
+}
+
+func TestEvaluateEndpoint(t *testing.T) {
+	server := NewConfigServer(newRuleConfig(t))
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"event": map[string]interface{}{"amount": 9000, "hour": 12, "user": map[string]interface{}{"age": 30, "country": "CN"}},
+	})
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rules/evaluate", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望200，实际%d: %s", rec.Code, rec.Body.String())
+	}
+
+	var decision RuleDecision
+	json.Unmarshal(rec.Body.Bytes(), &decision)
+	if decision.Action != ActionDeny || len(decision.Matched) != 1 || decision.Matched[0].RuleID != "single_amount" {
+		t.Errorf("评估结果不正确: %+v", decision)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/rules/evaluate", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET应返回405，实际%d", rec.Code)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 配置值类型，与JSON Schema的type保持一致，另外增加duration
+const (
+	SchemaInteger  = "integer"
+	SchemaNumber   = "number"
+	SchemaBoolean  = "boolean"
+	SchemaString   = "string"
+	SchemaDuration = "duration" // time.Duration、"30s"形式的字符串或秒数
+)
+
+// FieldSchema 单个配置项的校验规则，字段取自JSON Schema的常用子集
+type FieldSchema struct {
+	Type    string        `json:"type"`
+	Minimum *float64      `json:"minimum,omitempty"`
+	Maximum *float64      `json:"maximum,omitempty"`
+	Enum    []interface{} `json:"enum,omitempty"`
+	Pattern string        `json:"pattern,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// GroupSchema 配置组的校验规则，结构与JSON Schema的object一致：
+// {"type": "object", "properties": {...}, "additionalProperties": false}
+type GroupSchema struct {
+	Properties           map[string]*FieldSchema `json:"properties"`
+	AdditionalProperties *bool                   `json:"additionalProperties,omitempty"`
+}
+
+// compile 检查规则本身是否合法
+func (fs *FieldSchema) compile() error {
+	switch fs.Type {
+	case SchemaInteger, SchemaNumber, SchemaBoolean, SchemaString, SchemaDuration:
+	default:
+		return fmt.Errorf("不支持的类型 %q", fs.Type)
+	}
+	if fs.Pattern != "" {
+		re, err := regexp.Compile(fs.Pattern)
+		if err != nil {
+			return fmt.Errorf("无效的pattern: %v", err)
+		}
+		fs.pattern = re
+	}
+	return nil
+}
+
+// Validate 校验配置值
+func (fs *FieldSchema) Validate(value interface{}) error {
+	var number float64
+	hasNumber := false
+
+	switch fs.Type {
+	case SchemaInteger:
+		f, ok := toFloat(value)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Errorf("期望整数，实际为 %s", describeValue(value))
+		}
+		number, hasNumber = f, true
+	case SchemaNumber:
+		f, ok := toFloat(value)
+		if !ok {
+			return fmt.Errorf("期望数值，实际为 %s", describeValue(value))
+		}
+		number, hasNumber = f, true
+	case SchemaBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("期望布尔值，实际为 %s", describeValue(value))
+		}
+	case SchemaString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("期望字符串，实际为 %s", describeValue(value))
+		}
+		if fs.pattern != nil && !fs.pattern.MatchString(s) {
+			return fmt.Errorf("%q 不匹配 %s", s, fs.Pattern)
+		}
+	case SchemaDuration:
+		d, ok := toDuration(value)
+		if !ok {
+			return fmt.Errorf("期望时长，实际为 %s", describeValue(value))
+		}
+		number, hasNumber = d.Seconds(), true
+	}
+
+	if hasNumber {
+		if fs.Minimum != nil && number < *fs.Minimum {
+			return fmt.Errorf("%v 小于最小值 %v", value, *fs.Minimum)
+		}
+		if fs.Maximum != nil && number > *fs.Maximum {
+			return fmt.Errorf("%v 大于最大值 %v", value, *fs.Maximum)
+		}
+	}
+
+	if len(fs.Enum) > 0 {
+		for _, allowed := range fs.Enum {
+			if sameValue(allowed, value) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v 不在允许的取值 %v 中", value, fs.Enum)
+	}
+	return nil
+}
+
+// describeValue 描述值的类型，用于错误信息
+func describeValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("字符串 %q", value)
+	case bool:
+		return "布尔值"
+	}
+	if _, ok := toFloat(value); ok {
+		return fmt.Sprintf("数值 %v", value)
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// SetSchema 为配置组设置校验规则，已有配置不符合规则时拒绝设置
+func (rc *RiskConfig) SetSchema(groupName string, schema *GroupSchema) error {
+	for key, field := range schema.Properties {
+		if err := field.compile(); err != nil {
+			return fmt.Errorf("配置项 %s.%s 的规则无效: %v", groupName, key, err)
+		}
+	}
+
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if group, exists := rc.groups[groupName]; exists {
+		keys := make([]string, 0, len(group.Items))
+		for key := range group.Items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := schema.validate(groupName, key, group.Items[key].Value); err != nil {
+				return fmt.Errorf("现有配置不符合规则: %v", err)
+			}
+		}
+	}
+
+	rc.schemas[groupName] = schema
+	return nil
+}
+
+// LoadSchemas 从JSON加载多个配置组的校验规则，格式为 组名 -> JSON Schema object
+func (rc *RiskConfig) LoadSchemas(data []byte) error {
+	var schemas map[string]*GroupSchema
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return fmt.Errorf("解析校验规则失败: %v", err)
+	}
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := rc.SetSchema(name, schemas[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate 校验配置组中的一个配置项
+func (gs *GroupSchema) validate(groupName, key string, value interface{}) error {
+	field, exists := gs.Properties[key]
+	if !exists {
+		if gs.AdditionalProperties != nil && !*gs.AdditionalProperties {
+			return fmt.Errorf("配置项 %s.%s 未在规则中定义", groupName, key)
+		}
+		return nil
+	}
+	if err := field.Validate(value); err != nil {
+		return fmt.Errorf("配置项 %s.%s 校验失败: %v", groupName, key, err)
+	}
+	return nil
+}
+
+// validateLocked 按配置组的规则校验配置值，未设置规则的组不做校验。调用方需持有锁
+func (rc *RiskConfig) validateLocked(groupName, key string, value interface{}) error {
+	schema, exists := rc.schemas[groupName]
+	if !exists {
+		return nil
+	}
+	return schema.validate(groupName, key, value)
+}
+
+// validateGroupsLocked 校验一批配置组，用于导入
+func (rc *RiskConfig) validateGroupsLocked(groups map[string]*ConfigGroup) error {
+	var errs []string
+	for name, group := range groups {
+		for key, item := range group.Items {
+			if err := rc.validateLocked(name, key, item.Value); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
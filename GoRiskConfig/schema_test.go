@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const riskLimitsSchema = `{
+  "risk_limits": {
+    "type": "object",
+    "properties": {
+      "max_daily_amount": {"type": "number", "minimum": 0},
+      "daily_transaction_count": {"type": "integer", "minimum": 1, "maximum": 1000},
+      "mode": {"type": "string", "enum": ["strict", "relaxed"]},
+      "review_window": {"type": "duration", "maximum": 3600},
+      "region": {"type": "string", "pattern": "^[A-Z]{2}$"}
+    },
+    "additionalProperties": false
+  }
+}`
+
+func TestSchemaValidationOnSetConfig(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额配置")
+	if err := config.LoadSchemas([]byte(riskLimitsSchema)); err != nil {
+		t.Fatalf("加载校验规则失败: %v", err)
+	}
+
+	valid := map[string]interface{}{
+		"max_daily_amount":        10000.0,
+		"daily_transaction_count": 50,
+		"mode":                    "strict",
+		"review_window":           "10m",
+		"region":                  "CN",
+	}
+	for key, value := range valid {
+		if err := config.SetConfig("risk_limits", key, value, "", "admin"); err != nil {
+			t.Errorf("合法配置 %s=%v 被拒绝: %v", key, value, err)
+		}
+	}
+
+	invalid := map[string]interface{}{
+		"max_daily_amount":        "10000",
+		"daily_transaction_count": 2.5,
+		"mode":                    "loose",
+		"review_window":           "2h",
+		"region":                  "china",
+		"unknown_key":             1,
+	}
+	for key, value := range invalid {
+		if err := config.SetConfig("risk_limits", key, value, "", "admin"); err == nil {
+			t.Errorf("非法配置 %s=%v 应被拒绝", key, value)
+		}
+	}
+
+	if v := config.GetFloat("risk_limits", "max_daily_amount", 0); v != 10000 {
+		t.Errorf("被拒绝的设置不应修改配置，实际%v", v)
+	}
+	if stats := config.GetStats(); stats["version"] != len(valid) {
+		t.Errorf("被拒绝的设置不应增加版本号，实际%d", stats["version"])
+	}
+}
+
+func TestSchemaRejectsExistingAndImportedValues(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.SetConfig("risk_limits", "max_daily_amount", "unlimited", "", "admin")
+
+	err := config.LoadSchemas([]byte(riskLimitsSchema))
+	if err == nil || !strings.Contains(err.Error(), "max_daily_amount") {
+		t.Fatalf("现有配置不符合规则时应拒绝设置规则，实际%v", err)
+	}
+
+	config.DeleteConfig("risk_limits", "max_daily_amount", "admin")
+	if err := config.LoadSchemas([]byte(riskLimitsSchema)); err != nil {
+		t.Fatalf("加载校验规则失败: %v", err)
+	}
+
+	data := []byte(`{"risk_limits": {"name": "risk_limits", "items": {"max_daily_amount": {"key": "max_daily_amount", "value": -1}}}}`)
+	if err := config.ImportConfig(data, "admin"); err == nil {
+		t.Error("导入不符合规则的配置应失败")
+	}
+	if _, err := config.GetConfig("risk_limits", "max_daily_amount"); err == nil {
+		t.Error("导入失败时不应修改配置")
+	}
+
+	if err := config.SetSchema("risk_limits", &GroupSchema{Properties: map[string]*FieldSchema{"x": {Type: "map"}}}); err == nil {
+		t.Error("不支持的类型应被拒绝")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 搜索结果的默认每页条数和上限
+const (
+	DefaultSearchPageSize = 50
+	maxSearchPageSize     = 500
+)
+
+// SearchQuery 配置项查询条件，各条件同时满足才匹配，零值的条件不做过滤
+type SearchQuery struct {
+	Prefix    string    `json:"prefix,omitempty"`     // "配置组.键" 的前缀，如 "risk_limits.max_"
+	Tags      []string  `json:"tags,omitempty"`       // 必须包含全部标签
+	UpdatedBy string    `json:"updated_by,omitempty"` // 最后修改人
+	Since     time.Time `json:"since,omitempty"`      // 最后修改时间不早于Since
+}
+
+// SearchHit 匹配的配置项
+type SearchHit struct {
+	Group string     `json:"group"`
+	Item  ConfigItem `json:"item"`
+}
+
+// SearchResult 一页搜索结果，Total为全部匹配数
+type SearchResult struct {
+	Hits     []SearchHit `json:"hits"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+// SetTags 设置配置项的标签，覆盖原有标签。标签只是元数据，不改变配置项版本，也不产生变更记录
+func (rc *RiskConfig) SetTags(groupName, key string, tags []string, updatedBy string) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	return rc.updateLocked(func() error {
+		group, exists := rc.groups[groupName]
+		if !exists {
+			return fmt.Errorf("配置组 %s 不存在", groupName)
+		}
+		if err := rc.authorizeGroupLocked(groupName, updatedBy, PermWrite); err != nil {
+			return err
+		}
+		item, exists := group.Items[key]
+		if !exists {
+			return fmt.Errorf("配置项 %s.%s 不存在", groupName, key)
+		}
+
+		item.Tags = normalizeTags(tags)
+		fmt.Printf("设置标签: %s.%s = %v (by %s)\n", groupName, key, item.Tags, updatedBy)
+		return nil
+	})
+}
+
+// normalizeTags 去掉空白和重复的标签并排序
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var result []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (q SearchQuery) matches(groupName string, item *ConfigItem) bool {
+	if q.Prefix != "" && !strings.HasPrefix(groupName+"."+item.Key, q.Prefix) {
+		return false
+	}
+	if q.UpdatedBy != "" && item.UpdatedBy != q.UpdatedBy {
+		return false
+	}
+	if !q.Since.IsZero() && item.UpdatedAt.Before(q.Since) {
+		return false
+	}
+	for _, want := range q.Tags {
+		found := false
+		for _, tag := range item.Tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Search 按条件查询配置项，结果按配置组和键排序后分页返回。
+// page从1开始，pageSize<=0时使用DefaultSearchPageSize
+func (rc *RiskConfig) Search(query SearchQuery, page, pageSize int) SearchResult {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = DefaultSearchPageSize
+	}
+	if pageSize > maxSearchPageSize {
+		pageSize = maxSearchPageSize
+	}
+
+	rc.mutex.RLock()
+	var hits []SearchHit
+	for groupName, group := range rc.groups {
+		for _, item := range group.Items {
+			if query.matches(groupName, item) {
+				hits = append(hits, SearchHit{Group: groupName, Item: *item})
+			}
+		}
+	}
+	rc.mutex.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Group != hits[j].Group {
+			return hits[i].Group < hits[j].Group
+		}
+		return hits[i].Item.Key < hits[j].Item.Key
+	})
+
+	result := SearchResult{Total: len(hits), Page: page, PageSize: pageSize, Hits: []SearchHit{}}
+	if start := (page - 1) * pageSize; start < len(hits) {
+		end := start + pageSize
+		if end > len(hits) {
+			end = len(hits)
+		}
+		result.Hits = hits[start:end]
+	}
+	return result
+}
+
+// handleSearch GET /search?prefix=risk_limits.&tags=velocity&updated_by=ops&since=168h&page=1&page_size=50
+// since可以是RFC3339时间，也可以是相对当前时间的时长
+func (s *ConfigServer) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+
+	params := r.URL.Query()
+	query := SearchQuery{Prefix: params.Get("prefix"), UpdatedBy: params.Get("updated_by")}
+	if v := params.Get("tags"); v != "" {
+		query.Tags = strings.Split(v, ",")
+	}
+	if v := params.Get("since"); v != "" {
+		since, err := parseTimeParam(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的since: %s", v))
+			return
+		}
+		query.Since = since
+	}
+
+	var page, pageSize int
+	for name, target := range map[string]*int{"page": &page, "page_size": &pageSize} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的%s: %s", name, v))
+				return
+			}
+			*target = n
+		}
+	}
+
+	writeJSON(w, http.StatusOK, s.config.Search(query, page, pageSize))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func searchKeys(result SearchResult) []string {
+	var keys []string
+	for _, hit := range result.Hits {
+		keys = append(keys, hit.Group+"."+hit.Item.Key)
+	}
+	return keys
+}
+
+func TestSearchFilters(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("velocity", "频率限制")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	config.SetConfig("risk_limits", "max_daily", 5000.0, "", "ops")
+	config.SetConfig("velocity", "per_minute", 10, "", "ops")
+	config.SetConfig("velocity", "per_hour", 100, "", "admin")
+	config.SetTags("risk_limits", "max_daily", []string{"velocity", " daily ", "velocity"}, "admin")
+	config.SetTags("velocity", "per_minute", []string{"velocity"}, "admin")
+	config.SetTags("velocity", "per_hour", []string{"velocity"}, "admin")
+
+	// 一周前修改的配置项不在结果中
+	config.groups["velocity"].Items["per_hour"].UpdatedAt = time.Now().Add(-8 * 24 * time.Hour)
+
+	cases := []struct {
+		query SearchQuery
+		want  string
+	}{
+		{SearchQuery{}, "[risk_limits.max_amount risk_limits.max_daily velocity.per_hour velocity.per_minute]"},
+		{SearchQuery{Prefix: "risk_limits.max_"}, "[risk_limits.max_amount risk_limits.max_daily]"},
+		{SearchQuery{Tags: []string{"velocity"}, Since: time.Now().Add(-7 * 24 * time.Hour)}, "[risk_limits.max_daily velocity.per_minute]"},
+		{SearchQuery{Tags: []string{"velocity", "daily"}}, "[risk_limits.max_daily]"},
+		{SearchQuery{UpdatedBy: "ops", Prefix: "velocity."}, "[velocity.per_minute]"},
+		{SearchQuery{Tags: []string{"unknown"}}, "[]"},
+	}
+	for _, c := range cases {
+		result := config.Search(c.query, 1, 0)
+		if got := fmt.Sprint(searchKeys(result)); got != c.want || result.Total != len(result.Hits) {
+			t.Errorf("查询 %+v: 期望 %s，实际 %s (total %d)", c.query, c.want, got, result.Total)
+		}
+	}
+
+	if tags := config.groups["risk_limits"].Items["max_daily"].Tags; fmt.Sprint(tags) != "[daily velocity]" {
+		t.Errorf("标签应去重并排序: %v", tags)
+	}
+	if err := config.SetTags("risk_limits", "missing", []string{"x"}, "admin"); err == nil {
+		t.Error("给不存在的配置项设置标签应失败")
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("blacklist", "黑名单")
+	for i := 0; i < 25; i++ {
+		config.SetConfig("blacklist", fmt.Sprintf("rule_%02d", i), i, "", "admin")
+	}
+
+	first := config.Search(SearchQuery{Prefix: "blacklist."}, 1, 10)
+	last := config.Search(SearchQuery{Prefix: "blacklist."}, 3, 10)
+	beyond := config.Search(SearchQuery{Prefix: "blacklist."}, 4, 10)
+	if first.Total != 25 || len(first.Hits) != 10 || first.Hits[0].Item.Key != "rule_00" {
+		t.Errorf("第一页不正确: %+v", searchKeys(first))
+	}
+	if len(last.Hits) != 5 || last.Hits[4].Item.Key != "rule_24" {
+		t.Errorf("最后一页不正确: %+v", searchKeys(last))
+	}
+	if beyond.Hits == nil || len(beyond.Hits) != 0 || beyond.Total != 25 {
+		t.Errorf("超出范围的页应返回空列表: %+v", beyond)
+	}
+	if result := config.Search(SearchQuery{}, 0, 10000); result.Page != 1 || result.PageSize != maxSearchPageSize {
+		t.Errorf("分页参数应被规范化: page=%d page_size=%d", result.Page, result.PageSize)
+	}
+}
+
+func TestSearchEndpointAndTagsPreserved(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("velocity", "频率限制")
+	config.SetConfig("velocity", "per_minute", 10, "", "admin")
+	config.SetTags("velocity", "per_minute", []string{"velocity", "card"}, "admin")
+
+	// 修改值、事务和回滚都保留标签
+	config.SetConfig("velocity", "per_minute", 20, "", "ops")
+	config.Txn().Set("velocity", "per_minute", 30, "").Commit("ops")
+	config.RollbackTo(2, "ops")
+	if tags := config.groups["velocity"].Items["per_minute"].Tags; fmt.Sprint(tags) != "[card velocity]" {
+		t.Errorf("修改配置值后标签应保留: %v", tags)
+	}
+
+	server := httptest.NewServer(NewConfigServer(config))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/search?tags=velocity,card&updated_by=ops&since=24h&page_size=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var result SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 1 || result.Hits[0].Item.Value != 20.0 || result.PageSize != 10 {
+		t.Errorf("搜索接口结果不正确: %+v", result)
+	}
+
+	for _, query := range []string{"since=yesterday", "page=-1", "page_size=x"} {
+		if resp, _ := http.Get(server.URL + "/search?" + query); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s 应返回400，实际%d", query, resp.StatusCode)
+		}
+	}
+}
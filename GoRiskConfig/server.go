@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ConfigServer 配置中心HTTP服务
+type ConfigServer struct {
+	config *RiskConfig
+	rules  *RuleEngine
+	mux    *http.ServeMux
+}
+
+// NewConfigServer 创建配置中心HTTP服务并注册路由
+func NewConfigServer(config *RiskConfig) *ConfigServer {
+	s := &ConfigServer{
+		config: config,
+		rules:  NewRuleEngine(config),
+		mux:    http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/rules/simulate", s.handleSimulate)
+	s.mux.HandleFunc("/rules/evaluate", s.handleEvaluate)
+	s.mux.HandleFunc("/watch", s.handleWatch)
+	s.mux.HandleFunc(GRPCWatchPath, s.handleGRPCWatch)
+	s.mux.HandleFunc("/configs", s.handleConfigs)
+	s.mux.HandleFunc("/poll", s.handlePoll)
+	s.mux.HandleFunc("/search", s.handleSearch)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/history", s.handleHistory)
+
+	return s
+}
+
+// ServeHTTP 实现http.Handler接口
+func (s *ConfigServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// writeJSON 输出JSON响应
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 输出错误响应
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
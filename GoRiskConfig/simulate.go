@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// Transaction 交易样本
+type Transaction struct {
+	ID          string  `json:"id"`
+	UserID      string  `json:"user_id"`
+	Amount      float64 `json:"amount"`
+	DailyAmount float64 `json:"daily_amount"` // 当日已发生金额（不含本笔）
+	DailyCount  int     `json:"daily_count"`  // 当日已发生笔数（不含本笔）
+}
+
+// Decision 风控决策
+type Decision struct {
+	Action  string   `json:"action"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// SimulationRequest 模拟请求：候选配置为 组名 -> 配置键 -> 值 的覆盖集合
+type SimulationRequest struct {
+	Candidate map[string]map[string]interface{} `json:"candidate"`
+	Samples   []Transaction                     `json:"samples"`
+}
+
+// SimulationResult 单个样本在当前配置与候选配置下的决策对比
+type SimulationResult struct {
+	TransactionID string   `json:"transaction_id"`
+	Current       Decision `json:"current"`
+	Candidate     Decision `json:"candidate"`
+	Changed       bool     `json:"changed"`
+}
+
+// snapshotValues 复制当前所有配置值
+func (rc *RiskConfig) snapshotValues() map[string]map[string]interface{} {
+	rc.mutex.RLock()
+	defer rc.mutex.RUnlock()
+	return rc.snapshotValuesLocked()
+}
+
+// snapshotValuesLocked 复制当前所有配置值，调用方需持有锁
+func (rc *RiskConfig) snapshotValuesLocked() map[string]map[string]interface{} {
+	values := make(map[string]map[string]interface{}, len(rc.groups))
+	for name, group := range rc.groups {
+		items := make(map[string]interface{}, len(group.Items))
+		for key, item := range group.Items {
+			items[key] = item.Value
+		}
+		values[name] = items
+	}
+	return values
+}
+
+// toFloat 将数值类型的配置值转换为float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// evaluateTransaction 按risk_limits组中的限额对交易做出决策
+func evaluateTransaction(values map[string]map[string]interface{}, tx Transaction) Decision {
+	decision := Decision{Action: DecisionApprove}
+	limits := values["risk_limits"]
+
+	if limit, ok := toFloat(limits["max_single_amount"]); ok && tx.Amount > limit {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("单笔金额 %.2f 超过限额 %.2f", tx.Amount, limit))
+	}
+	if limit, ok := toFloat(limits["max_daily_amount"]); ok && tx.DailyAmount+tx.Amount > limit {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("当日金额 %.2f 超过限额 %.2f", tx.DailyAmount+tx.Amount, limit))
+	}
+	if limit, ok := toFloat(limits["daily_transaction_count"]); ok && float64(tx.DailyCount+1) > limit {
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("当日笔数 %d 超过限制 %.0f", tx.DailyCount+1, limit))
+	}
+
+	if len(decision.Reasons) > 0 {
+		decision.Action = DecisionReject
+	}
+	return decision
+}
+
+// Simulate 分别在当前配置和叠加候选配置后的配置下评估样本，不修改任何已发布配置
+func (rc *RiskConfig) Simulate(candidate map[string]map[string]interface{}, samples []Transaction) []SimulationResult {
+	current := rc.snapshotValues()
+
+	proposed := rc.snapshotValues()
+	for groupName, items := range candidate {
+		if proposed[groupName] == nil {
+			proposed[groupName] = make(map[string]interface{})
+		}
+		for key, value := range items {
+			proposed[groupName][key] = value
+		}
+	}
+
+	results := make([]SimulationResult, 0, len(samples))
+	for _, tx := range samples {
+		before := evaluateTransaction(current, tx)
+		after := evaluateTransaction(proposed, tx)
+		results = append(results, SimulationResult{
+			TransactionID: tx.ID,
+			Current:       before,
+			Candidate:     after,
+			Changed:       before.Action != after.Action,
+		})
+	}
+
+	return results
+}
+
+// handleSimulate 处理 POST /rules/simulate
+func (s *ConfigServer) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "仅支持POST")
+		return
+	}
+
+	var req SimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("请求格式错误: %v", err))
+		return
+	}
+
+	results := s.config.Simulate(req.Candidate, req.Samples)
+
+	changed := 0
+	for _, result := range results {
+		if result.Changed {
+			changed++
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"results": results,
+		"total":   len(results),
+		"changed": changed,
+	})
+}
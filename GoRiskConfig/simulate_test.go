@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.SetConfig("risk_limits", "max_single_amount", 5000.0, "单笔最大交易金额", "admin")
+
+	samples := []Transaction{
+		{ID: "tx1", Amount: 3000},
+		{ID: "tx2", Amount: 6000},
+	}
+	candidate := map[string]map[string]interface{}{
+		"risk_limits": {"max_single_amount": 2000.0},
+	}
+
+	results := config.Simulate(candidate, samples)
+	if len(results) != 2 {
+		t.Fatalf("期望2条结果，实际%d条", len(results))
+	}
+
+	if results[0].Current.Action != DecisionApprove || results[0].Candidate.Action != DecisionReject || !results[0].Changed {
+		t.Errorf("tx1决策不正确: %+v", results[0])
+	}
+	if results[1].Current.Action != DecisionReject || results[1].Changed {
+		t.Errorf("tx2决策不正确: %+v", results[1])
+	}
+
+	// 模拟不应修改已发布配置
+	value, _ := config.GetConfig("risk_limits", "max_single_amount")
+	if value != 5000.0 {
+		t.Errorf("模拟修改了当前配置: %v", value)
+	}
+}
+
+func TestSimulateEndpoint(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额配置")
+	config.SetConfig("risk_limits", "daily_transaction_count", 50, "每日最大交易次数", "admin")
+
+	server := NewConfigServer(config)
+
+	body, _ := json.Marshal(SimulationRequest{
+		Candidate: map[string]map[string]interface{}{
+			"risk_limits": {"daily_transaction_count": 10},
+		},
+		Samples: []Transaction{{ID: "tx1", Amount: 100, DailyCount: 20}},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/rules/simulate", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("期望状态码200，实际%d", rec.Code)
+	}
+
+	var resp struct {
+		Results []SimulationResult `json:"results"`
+		Changed int                `json:"changed"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal("解析响应失败:", err)
+	}
+	if resp.Changed != 1 || resp.Results[0].Candidate.Action != DecisionReject {
+		t.Errorf("模拟结果不正确: %+v", resp)
+	}
+
+	// 非POST请求
+	req = httptest.NewRequest(http.MethodGet, "/rules/simulate", nil)
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("期望状态码405，实际%d", rec.Code)
+	}
+}
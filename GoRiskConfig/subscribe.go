@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+)
+
+// DefaultSubscriptionBuffer 每个订阅默认可积压的变更数
+const DefaultSubscriptionBuffer = 64
+
+// ErrSubscriptionOverflow 订阅者消费过慢、积压超过缓冲区时订阅被关闭
+var ErrSubscriptionOverflow = errors.New("订阅积压超过缓冲区，已自动取消")
+
+// Subscription 按配置组和键的glob模式订阅的变更流。C关闭即表示订阅已取消，
+// 原因可通过Err查询：ctx取消、调用Close或积压溢出
+type Subscription struct {
+	C <-chan ConfigChange
+
+	groupGlob string
+	keyGlob   string
+	events    chan ConfigChange
+	done      chan struct{}
+	closed    bool
+	err       error
+	config    *RiskConfig
+}
+
+func (s *Subscription) matches(change *ConfigChange) bool {
+	groupOK, _ := path.Match(s.groupGlob, change.GroupName)
+	keyOK, _ := path.Match(s.keyGlob, change.Key)
+	return groupOK && keyOK
+}
+
+// send 非阻塞投递，调用方需持有rc.mutex；缓冲区满时关闭订阅
+func (s *Subscription) send(change *ConfigChange) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- *change:
+	default:
+		s.closeLocked(ErrSubscriptionOverflow)
+	}
+}
+
+// closeLocked 关闭channel并从配置中心注销，调用方需持有rc.mutex
+func (s *Subscription) closeLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.events)
+	close(s.done)
+	delete(s.config.subscriptions, s)
+}
+
+// Close 取消订阅，可重复调用
+func (s *Subscription) Close() {
+	s.config.mutex.Lock()
+	defer s.config.mutex.Unlock()
+	s.closeLocked(nil)
+}
+
+// Err 返回订阅被关闭的原因，正常关闭或仍在订阅中时为nil
+func (s *Subscription) Err() error {
+	s.config.mutex.RLock()
+	defer s.config.mutex.RUnlock()
+	return s.err
+}
+
+// Subscribe 订阅配置组和键都匹配glob模式（path.Match语法，如 "risk_*"、"max_*"）的变更，
+// 只推送订阅之后的变更。buffer<=0时使用DefaultSubscriptionBuffer。
+// ctx取消时自动取消订阅并关闭C
+func (rc *RiskConfig) Subscribe(ctx context.Context, groupGlob, keyGlob string, buffer int) (*Subscription, error) {
+	for _, pattern := range []string{groupGlob, keyGlob} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的订阅模式 %q: %v", pattern, err)
+		}
+	}
+	if buffer <= 0 {
+		buffer = DefaultSubscriptionBuffer
+	}
+
+	events := make(chan ConfigChange, buffer)
+	sub := &Subscription{C: events, groupGlob: groupGlob, keyGlob: keyGlob, events: events, done: make(chan struct{}), config: rc}
+
+	rc.mutex.Lock()
+	rc.subscriptions[sub] = true
+	rc.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			rc.mutex.Lock()
+			defer rc.mutex.Unlock()
+			sub.closeLocked(ctx.Err())
+		case <-sub.done:
+		}
+	}()
+	return sub, nil
+}
+
+// dispatchLocked 把变更投递给匹配的订阅，调用方需持有写锁
+func (rc *RiskConfig) dispatchLocked(change *ConfigChange) {
+	for _, op := range change.Changes() {
+		for sub := range rc.subscriptions {
+			if sub.matches(op) {
+				sub.send(op)
+			}
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func nextChange(t *testing.T, sub *Subscription) ConfigChange {
+	select {
+	case change, ok := <-sub.C:
+		if !ok {
+			t.Fatal("订阅已关闭")
+		}
+		return change
+	case <-time.After(time.Second):
+		t.Fatal("等待变更超时")
+	}
+	return ConfigChange{}
+}
+
+func TestSubscribePatterns(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("risk_rules", "风控规则")
+	config.CreateGroup("blacklist", "黑名单")
+
+	limits, err := config.Subscribe(context.Background(), "risk_*", "max_*", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer limits.Close()
+	all, _ := config.Subscribe(context.Background(), "*", "*", 0)
+	defer all.Close()
+
+	config.SetConfig("blacklist", "max_hits", 3, "", "admin")
+	config.SetConfig("risk_limits", "daily_count", 50, "", "admin")
+	config.SetConfig("risk_rules", "max_score", 80, "", "admin")
+	config.DeleteConfig("risk_rules", "max_score", "ops")
+
+	change := nextChange(t, limits)
+	if change.GroupName != "risk_rules" || change.Key != "max_score" || change.NewValue != 80 || change.Version != 3 {
+		t.Errorf("订阅收到的变更不正确: %+v", change)
+	}
+	deleted := nextChange(t, limits)
+	if deleted.NewValue != nil || deleted.OldValue != 80 || deleted.UpdatedBy != "ops" {
+		t.Errorf("删除变更不正确: %+v", deleted)
+	}
+	select {
+	case extra := <-limits.C:
+		t.Errorf("不应收到不匹配的变更: %+v", extra)
+	default:
+	}
+
+	for version := 1; version <= 4; version++ {
+		if change := nextChange(t, all); change.Version != version {
+			t.Errorf("期望按顺序收到版本%d，实际%d", version, change.Version)
+		}
+	}
+
+	if _, err := config.Subscribe(context.Background(), "[", "*", 0); err == nil {
+		t.Error("无效的glob模式应返回错误")
+	}
+}
+
+func TestSubscribeUnsubscribe(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	byContext, _ := config.Subscribe(ctx, "*", "*", 0)
+	byClose, _ := config.Subscribe(context.Background(), "*", "*", 0)
+
+	cancel()
+	byClose.Close()
+	byClose.Close()
+	for _, sub := range []*Subscription{byContext, byClose} {
+		select {
+		case _, ok := <-sub.C:
+			if ok {
+				t.Error("取消后不应再收到变更")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("取消订阅后channel应被关闭")
+		}
+	}
+	if byContext.Err() != context.Canceled || byClose.Err() != nil {
+		t.Errorf("关闭原因不正确: %v, %v", byContext.Err(), byClose.Err())
+	}
+
+	config.mutex.RLock()
+	remaining := len(config.subscriptions)
+	config.mutex.RUnlock()
+	if remaining != 0 {
+		t.Errorf("关闭的订阅应自动注销，剩余%d个", remaining)
+	}
+	if err := config.SetConfig("risk_limits", "max_amount", 1.0, "", "admin"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubscribeOverflow(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+
+	slow, _ := config.Subscribe(context.Background(), "*", "*", 2)
+	for i := 0; i < 3; i++ {
+		config.SetConfig("risk_limits", "max_amount", float64(i), "", "admin")
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != 2 || slow.Err() != ErrSubscriptionOverflow {
+		t.Errorf("积压溢出应在投递缓冲内容后关闭订阅: received=%d err=%v", received, slow.Err())
+	}
+}
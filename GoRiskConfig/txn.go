@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// BatchListener 可选的监听器接口：实现它的监听器对一个事务只收到一次批量通知，
+// 否则按事务中的顺序逐项收到OnConfigChange
+type BatchListener interface {
+	OnConfigBatch(changes []*ConfigChange)
+}
+
+// txnOp 事务中的一个操作
+type txnOp struct {
+	groupName   string
+	key         string
+	value       interface{}
+	description string
+	delete      bool
+}
+
+// Txn 多个配置项的原子修改：Commit时全部生效或全部不生效，
+// 只产生一个版本号、一条变更历史和一次批量通知
+type Txn struct {
+	config *RiskConfig
+	ops    []txnOp
+}
+
+// Txn 开始一个事务
+func (rc *RiskConfig) Txn() *Txn {
+	return &Txn{config: rc}
+}
+
+// Set 在事务中设置配置项
+func (t *Txn) Set(groupName, key string, value interface{}, description string) *Txn {
+	t.ops = append(t.ops, txnOp{groupName: groupName, key: key, value: value, description: description})
+	return t
+}
+
+// Delete 在事务中删除配置项
+func (t *Txn) Delete(groupName, key string) *Txn {
+	t.ops = append(t.ops, txnOp{groupName: groupName, key: key, delete: true})
+	return t
+}
+
+// Changes 返回变更记录包含的单项变更：事务返回其中每一项，普通变更返回自身
+func (c *ConfigChange) Changes() []*ConfigChange {
+	if c.Ops != nil {
+		return c.Ops
+	}
+	return []*ConfigChange{c}
+}
+
+// Commit 校验并原子地应用事务中的全部操作。同一配置项被多次操作时只记录最终结果，
+// 最终值与原值相同的配置项不产生变更。任何一项配置组不存在、没有写权限、
+// 未通过校验或删除不存在的配置项时整个事务不生效。没有实际变化时返回nil
+func (t *Txn) Commit(committedBy string) (*ConfigChange, error) {
+	if len(t.ops) == 0 {
+		return nil, fmt.Errorf("事务为空")
+	}
+
+	rc := t.config
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	var change *ConfigChange
+	err := rc.updateLocked(func() error {
+		change = nil
+		// 在当前配置上依次模拟每个操作，得到每个配置项的原值和最终值
+		type pending struct {
+			groupName, key string
+			oldItem        *ConfigItem
+			final          *ConfigItem // nil表示删除
+		}
+		var order []*pending
+		byKey := make(map[string]*pending)
+		now := time.Now()
+		for _, op := range t.ops {
+			group, exists := rc.groups[op.groupName]
+			if !exists {
+				return fmt.Errorf("配置组 %s 不存在", op.groupName)
+			}
+			if err := rc.authorizeGroupLocked(op.groupName, committedBy, PermWrite); err != nil {
+				return err
+			}
+
+			id := op.groupName + "." + op.key
+			p, seen := byKey[id]
+			if !seen {
+				p = &pending{groupName: op.groupName, key: op.key, oldItem: group.Items[op.key], final: group.Items[op.key]}
+				byKey[id] = p
+				order = append(order, p)
+			}
+
+			if op.delete {
+				if p.final == nil {
+					return fmt.Errorf("配置项 %s 不存在", id)
+				}
+				p.final = nil
+				continue
+			}
+			value := op.value
+			if p.oldItem != nil && p.oldItem.List != nil {
+				list, err := normalizeList(value)
+				if err != nil {
+					return err
+				}
+				value = list
+			}
+			if err := rc.validateLocked(op.groupName, op.key, value); err != nil {
+				return err
+			}
+			p.final = &ConfigItem{Key: op.key, Value: value, Description: op.description, UpdatedAt: now, UpdatedBy: committedBy}
+		}
+
+		var ops []*ConfigChange
+		for _, p := range order {
+			var oldValue, newValue interface{}
+			if p.oldItem != nil {
+				oldValue = p.oldItem.Value
+			}
+			if p.final != nil {
+				newValue = p.final.Value
+			}
+			if (p.oldItem == nil && p.final == nil) || (p.oldItem != nil && p.final != nil && sameValue(oldValue, newValue)) {
+				continue
+			}
+
+			group := rc.groups[p.groupName]
+			if p.final == nil {
+				delete(group.Items, p.key)
+			} else {
+				p.final.Version = 1
+				if p.oldItem != nil {
+					p.final.Version = p.oldItem.Version + 1
+					p.final.Tags = p.oldItem.Tags
+					p.final.List = p.oldItem.List
+					p.final.indexList()
+				}
+				group.Items[p.key] = p.final
+			}
+			group.Version++
+			group.UpdatedAt = now
+			ops = append(ops, &ConfigChange{
+				GroupName: p.groupName,
+				Key:       p.key,
+				OldValue:  oldValue,
+				NewValue:  newValue,
+				UpdatedBy: committedBy,
+				Timestamp: now,
+			})
+		}
+		if len(ops) == 0 {
+			return errUnchanged
+		}
+
+		rc.version++
+		for _, op := range ops {
+			op.Version = rc.version
+		}
+		change = &ConfigChange{UpdatedBy: committedBy, Timestamp: now, Version: rc.version, Ops: ops}
+		rc.recordChangeLocked(change)
+
+		fmt.Printf("提交事务: %d 项变更，版本 %d (by %s)\n", len(ops), rc.version, committedBy)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return change, nil
+}
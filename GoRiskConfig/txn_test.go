@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchRecorder 记录批量通知的监听器
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]*ConfigChange
+}
+
+func (b *batchRecorder) OnConfigChange(groupName, key string, oldValue, newValue interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, []*ConfigChange{{GroupName: groupName, Key: key, NewValue: newValue}})
+}
+
+func (b *batchRecorder) OnConfigBatch(changes []*ConfigChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batches = append(b.batches, changes)
+}
+
+func TestTxnCommitAtomic(t *testing.T) {
+	config := NewRiskConfig()
+	batch := &batchRecorder{}
+	var mu sync.Mutex
+	var plain []string
+	config.AddListener(batch)
+	config.AddListener(&testListener{onChange: func(group, key string, oldValue, newValue interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		plain = append(plain, group+"."+key)
+	}})
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("switches", "开关")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "单笔限额", "admin")
+	config.SetConfig("switches", "legacy_check", true, "", "admin")
+
+	time.Sleep(50 * time.Millisecond) // 等待上面写入的异步通知完成后清空记录
+	batch.mu.Lock()
+	batch.batches = nil
+	batch.mu.Unlock()
+	mu.Lock()
+	plain = nil
+	mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watch := config.Watch(ctx, WatchRequest{FromVersion: 2}, 0)
+	sub, _ := config.Subscribe(ctx, "*", "*", 0)
+
+	change, err := config.Txn().
+		Set("risk_limits", "max_amount", 5000.0, "").
+		Set("switches", "strict_mode", true, "严格模式").
+		Delete("switches", "legacy_check").
+		Commit("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.Version != 3 || len(change.Ops) != 3 || config.GetStats()["version"] != 3 {
+		t.Fatalf("事务应只产生一个版本: %+v", change)
+	}
+	if history := config.GetHistory(0); len(history) != 3 || history[2] != change {
+		t.Errorf("事务应只产生一条变更历史，实际%d条", len(history))
+	}
+	if op := change.Ops[0]; op.OldValue != 1000.0 || op.NewValue != 5000.0 || op.Version != 3 {
+		t.Errorf("事务中的变更不正确: %+v", op)
+	}
+	item := config.groups["risk_limits"].Items["max_amount"]
+	if item.Version != 2 || item.Description != "" || item.UpdatedBy != "ops" {
+		t.Errorf("配置项版本不正确: %+v", item)
+	}
+	if _, err := config.GetConfig("switches", "legacy_check"); err == nil {
+		t.Error("事务中删除的配置项应不存在")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	batch.mu.Lock()
+	if len(batch.batches) != 1 || len(batch.batches[0]) != 3 {
+		t.Errorf("实现BatchListener的监听器应只收到一次批量通知: %+v", batch.batches)
+	}
+	batch.mu.Unlock()
+	mu.Lock()
+	if len(plain) != 3 || plain[0] != "risk_limits.max_amount" || plain[2] != "switches.legacy_check" {
+		t.Errorf("普通监听器应按顺序逐项收到通知: %v", plain)
+	}
+	mu.Unlock()
+
+	// Watch流和订阅逐项推送，版本号相同
+	for i := 0; i < 3; i++ {
+		event := <-watch
+		if event.Version != 3 || event.Key != change.Ops[i].Key {
+			t.Errorf("第%d个Watch事件不正确: %+v", i, event)
+		}
+		if got := nextChange(t, sub); got.Key != change.Ops[i].Key || got.Version != 3 {
+			t.Errorf("第%d个订阅变更不正确: %+v", i, got)
+		}
+	}
+
+	// 从事务之前的版本续订时补发事务中的每一项
+	replay := config.Watch(ctx, WatchRequest{FromVersion: 2}, 0)
+	for i := 0; i < 3; i++ {
+		if event := <-replay; event.Key != change.Ops[i].Key {
+			t.Errorf("补发的第%d个事件不正确: %+v", i, event)
+		}
+	}
+}
+
+func TestTxnValidationFailure(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin")
+	maximum := 10000.0
+	config.SetSchema("risk_limits", &GroupSchema{Properties: map[string]*FieldSchema{"max_amount": {Type: "number", Maximum: &maximum}}})
+	config.CreateNamespace("payments", "", "alice")
+	config.CreateNamespacedGroup("payments", "pay_limits", "", "alice")
+
+	failures := []*Txn{
+		config.Txn().Set("risk_limits", "enabled", true, "").Set("risk_limits", "max_amount", 99999.0, ""),
+		config.Txn().Set("risk_limits", "enabled", true, "").Delete("risk_limits", "missing"),
+		config.Txn().Set("risk_limits", "enabled", true, "").Set("no_such_group", "x", 1, ""),
+		config.Txn().Set("risk_limits", "enabled", true, "").Set("pay_limits", "x", 1, ""),
+		config.Txn(),
+	}
+	for i, txn := range failures {
+		if _, err := txn.Commit("bob"); err == nil {
+			t.Errorf("第%d个事务应失败", i)
+		}
+	}
+	if _, err := failures[3].Commit("bob"); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("没有写权限时应返回ErrAccessDenied，实际 %v", err)
+	}
+	if config.GetStats()["version"] != 1 || len(config.GetHistory(0)) != 1 {
+		t.Error("失败的事务不应产生任何变更")
+	}
+	if _, err := config.GetConfig("risk_limits", "enabled"); err == nil {
+		t.Error("失败的事务中的其他操作也不应生效")
+	}
+}
+
+func TestTxnCollapseAndRollback(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_amount", 1000.0, "", "admin") // v1
+	config.SetConfig("risk_limits", "mode", "strict", "", "admin")     // v2
+
+	// 同一配置项的多次操作只记录最终结果，最终没有变化的配置项被忽略
+	change, err := config.Txn().
+		Set("risk_limits", "max_amount", 2000.0, "").
+		Set("risk_limits", "max_amount", 3000.0, "").
+		Set("risk_limits", "mode", "relaxed", "").
+		Set("risk_limits", "mode", "strict", "").
+		Set("risk_limits", "temp", 1, "").
+		Delete("risk_limits", "temp").
+		Commit("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(change.Ops) != 1 || change.Ops[0].OldValue != 1000.0 || change.Ops[0].NewValue != 3000.0 {
+		t.Fatalf("事务应合并为一项变更: %+v", change.Ops)
+	}
+	if noop, err := config.Txn().Set("risk_limits", "mode", "strict", "").Commit("ops"); noop != nil || err != nil {
+		t.Errorf("没有实际变化的事务应返回nil: %+v %v", noop, err)
+	}
+
+	config.Txn().Set("risk_limits", "mode", "relaxed", "").Set("risk_limits", "extra", true, "").Commit("ops") // v4
+	if _, err := config.RollbackTo(2, "auditor"); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := config.Snapshot()["risk_limits"]
+	if len(snapshot) != 2 || snapshot["max_amount"] != 1000.0 || snapshot["mode"] != "strict" {
+		t.Errorf("回滚应撤销事务中的全部修改: %v", snapshot)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GetInt 获取整数配置，配置不存在或类型不符时返回默认值
+func (rc *RiskConfig) GetInt(groupName, key string, def int) int {
+	value, err := rc.GetConfig(groupName, key)
+	if err != nil {
+		return def
+	}
+	if s, ok := value.(string); ok {
+		if n, err := strconv.Atoi(strings.TrimSpace(s)); err == nil {
+			return n
+		}
+		return def
+	}
+	f, ok := toFloat(value)
+	if !ok || f != float64(int(f)) {
+		return def
+	}
+	return int(f)
+}
+
+// GetFloat 获取浮点数配置，整数配置同样可以读取
+func (rc *RiskConfig) GetFloat(groupName, key string, def float64) float64 {
+	value, err := rc.GetConfig(groupName, key)
+	if err != nil {
+		return def
+	}
+	if s, ok := value.(string); ok {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return f
+		}
+		return def
+	}
+	if f, ok := toFloat(value); ok {
+		return f
+	}
+	return def
+}
+
+// GetBool 获取布尔配置，也接受 "true"/"false" 等字符串
+func (rc *RiskConfig) GetBool(groupName, key string, def bool) bool {
+	value, err := rc.GetConfig(groupName, key)
+	if err != nil {
+		return def
+	}
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// GetString 获取字符串配置
+func (rc *RiskConfig) GetString(groupName, key string, def string) string {
+	value, err := rc.GetConfig(groupName, key)
+	if err != nil {
+		return def
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return def
+}
+
+// GetDuration 获取时长配置，支持time.Duration、"30s"形式的字符串和表示秒数的数值
+func (rc *RiskConfig) GetDuration(groupName, key string, def time.Duration) time.Duration {
+	value, err := rc.GetConfig(groupName, key)
+	if err != nil {
+		return def
+	}
+	if d, ok := toDuration(value); ok {
+		return d
+	}
+	return def
+}
+
+// toDuration 将配置值转换为时长
+func toDuration(value interface{}) (time.Duration, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, true
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		return d, err == nil
+	case json.Number:
+		f, err := v.Float64()
+		return time.Duration(f * float64(time.Second)), err == nil
+	}
+	if f, ok := toFloat(value); ok {
+		return time.Duration(f * float64(time.Second)), true
+	}
+	return 0, false
+}
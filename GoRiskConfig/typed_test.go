@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTypedAccessors(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("limits", "限额")
+	config.SetConfig("limits", "count", 50, "", "admin")
+	config.SetConfig("limits", "amount", 10000.5, "", "admin")
+	config.SetConfig("limits", "enabled", true, "", "admin")
+	config.SetConfig("limits", "name", "default", "", "admin")
+	config.SetConfig("limits", "window", "90s", "", "admin")
+	config.SetConfig("limits", "cooldown", 30.0, "", "admin")
+	config.SetConfig("limits", "count_text", "12", "", "admin")
+
+	if v := config.GetInt("limits", "count", 0); v != 50 {
+		t.Errorf("GetInt期望50，实际%d", v)
+	}
+	if v := config.GetInt("limits", "count_text", 0); v != 12 {
+		t.Errorf("GetInt应解析数字字符串，实际%d", v)
+	}
+	if v := config.GetInt("limits", "amount", -1); v != -1 {
+		t.Errorf("非整数应返回默认值，实际%d", v)
+	}
+	if v := config.GetFloat("limits", "count", 0); v != 50 {
+		t.Errorf("GetFloat应能读取整数，实际%v", v)
+	}
+	if v := config.GetFloat("limits", "amount", 0); v != 10000.5 {
+		t.Errorf("GetFloat期望10000.5，实际%v", v)
+	}
+	if !config.GetBool("limits", "enabled", false) {
+		t.Error("GetBool期望true")
+	}
+	if v := config.GetString("limits", "name", ""); v != "default" {
+		t.Errorf("GetString期望default，实际%s", v)
+	}
+	if v := config.GetString("limits", "count", "fallback"); v != "fallback" {
+		t.Errorf("类型不符应返回默认值，实际%s", v)
+	}
+	if v := config.GetDuration("limits", "window", 0); v != 90*time.Second {
+		t.Errorf("GetDuration期望90s，实际%v", v)
+	}
+	if v := config.GetDuration("limits", "cooldown", 0); v != 30*time.Second {
+		t.Errorf("数值时长按秒解析，实际%v", v)
+	}
+	if v := config.GetDuration("limits", "missing", time.Minute); v != time.Minute {
+		t.Errorf("不存在的配置应返回默认值，实际%v", v)
+	}
+	if v := config.GetBool("missing_group", "enabled", true); !v {
+		t.Error("不存在的配置组应返回默认值")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Watch事件类型
+const (
+	WatchSnapshot  = "snapshot"  // 全量快照，之后只推送增量
+	WatchChange    = "change"    // 单个配置项变更
+	WatchHeartbeat = "heartbeat" // 心跳，携带服务端当前版本
+)
+
+// WatchRequest 订阅请求
+type WatchRequest struct {
+	FromVersion int      `json:"from_version"` // 客户端已应用的版本，0表示需要全量快照
+	Groups      []string `json:"groups"`       // 只订阅指定配置组，为空表示全部
+}
+
+// WatchEvent 推送给订阅者的事件
+type WatchEvent struct {
+	Type      string                            `json:"type"`
+	Version   int                               `json:"version"`
+	Group     string                            `json:"group,omitempty"`
+	Key       string                            `json:"key,omitempty"`
+	Value     interface{}                       `json:"value,omitempty"`
+	OldValue  interface{}                       `json:"old_value,omitempty"`
+	Deleted   bool                              `json:"deleted,omitempty"`
+	List      *ListDelta                        `json:"list,omitempty"` // 列表成员的增删；从历史补发时没有Value，需应用到已有的值上
+	UpdatedBy string                            `json:"updated_by,omitempty"`
+	Snapshot  map[string]map[string]interface{} `json:"snapshot,omitempty"`
+	Timestamp time.Time                         `json:"timestamp"`
+}
+
+// watchBufferSize 每个订阅者在引导事件之外可积压的事件数，积压满时断开订阅，客户端按版本续订
+const watchBufferSize = 256
+
+// watcher 一个跨进程订阅者
+type watcher struct {
+	groups map[string]bool
+	events chan WatchEvent
+	closed bool
+}
+
+func (w *watcher) matches(group string) bool {
+	return len(w.groups) == 0 || w.groups[group]
+}
+
+// send 非阻塞发送，调用方需持有rc.mutex；缓冲区满时关闭订阅
+func (w *watcher) send(event WatchEvent) {
+	if w.closed {
+		return
+	}
+	select {
+	case w.events <- event:
+	default:
+		w.closed = true
+		close(w.events)
+	}
+}
+
+// changeEvent 将变更记录转换为Watch事件
+func changeEvent(change *ConfigChange) WatchEvent {
+	return WatchEvent{
+		Type:      WatchChange,
+		Version:   change.Version,
+		Group:     change.GroupName,
+		Key:       change.Key,
+		Value:     change.NewValue,
+		OldValue:  change.OldValue,
+		Deleted:   change.NewValue == nil && change.List == nil,
+		List:      change.List,
+		UpdatedBy: change.UpdatedBy,
+		Timestamp: change.Timestamp,
+	}
+}
+
+// bootstrapLocked 计算订阅的引导事件：变更历史覆盖FromVersion之后的全部变更时补发增量，
+// 否则发送全量快照。调用方需持有锁
+func (rc *RiskConfig) bootstrapLocked(req WatchRequest, w *watcher) []WatchEvent {
+	if req.FromVersion > 0 && req.FromVersion <= rc.version {
+		covered := req.FromVersion == rc.version ||
+			(len(rc.history) > 0 && rc.history[0].Version <= req.FromVersion+1)
+		if covered {
+			var events []WatchEvent
+			for _, entry := range rc.history {
+				if entry.Version <= req.FromVersion || entry.Env != "" {
+					continue
+				}
+				for _, change := range entry.Changes() {
+					if w.matches(change.GroupName) {
+						events = append(events, changeEvent(change))
+					}
+				}
+			}
+			return events
+		}
+	}
+
+	snapshot := rc.snapshotValuesLocked()
+	for group := range snapshot {
+		if !w.matches(group) {
+			delete(snapshot, group)
+		}
+	}
+	return []WatchEvent{{Type: WatchSnapshot, Version: rc.version, Snapshot: snapshot, Timestamp: time.Now()}}
+}
+
+// Watch 订阅配置变更：先按FromVersion补发增量或发送快照，再实时推送变更，
+// 每隔heartbeat发送一次心跳。ctx取消或订阅者积压过多时关闭返回的channel
+func (rc *RiskConfig) Watch(ctx context.Context, req WatchRequest, heartbeat time.Duration) <-chan WatchEvent {
+	w := &watcher{groups: make(map[string]bool, len(req.Groups))}
+	for _, group := range req.Groups {
+		w.groups[group] = true
+	}
+
+	// 注册订阅者和计算引导事件在同一把锁内完成，引导事件与实时变更之间不会丢失或重复
+	rc.mutex.Lock()
+	bootstrap := rc.bootstrapLocked(req, w)
+	w.events = make(chan WatchEvent, len(bootstrap)+watchBufferSize)
+	for _, event := range bootstrap {
+		w.events <- event
+	}
+	rc.watchers[w] = true
+	rc.mutex.Unlock()
+
+	go rc.keepAlive(ctx, w, heartbeat)
+	return w.events
+}
+
+// keepAlive 定期发送心跳，ctx取消时注销订阅者
+func (rc *RiskConfig) keepAlive(ctx context.Context, w *watcher, heartbeat time.Duration) {
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			rc.mutex.Lock()
+			w.send(WatchEvent{Type: WatchHeartbeat, Version: rc.version, Timestamp: time.Now()})
+			closed := w.closed
+			rc.mutex.Unlock()
+			if closed {
+				rc.removeWatcher(w)
+				return
+			}
+		case <-ctx.Done():
+			rc.removeWatcher(w)
+			return
+		}
+	}
+}
+
+func (rc *RiskConfig) removeWatcher(w *watcher) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	delete(rc.watchers, w)
+	if !w.closed {
+		w.closed = true
+		close(w.events)
+	}
+}
+
+// publishLocked 把变更推送给订阅者，调用方需持有写锁
+func (rc *RiskConfig) publishLocked(change *ConfigChange) {
+	for _, op := range change.Changes() {
+		for w := range rc.watchers {
+			if w.matches(op.GroupName) {
+				w.send(changeEvent(op))
+			}
+		}
+	}
+}
+
+// handleWatch GET /watch?from_version=N&groups=a,b&heartbeat=10s
+// 以换行分隔的JSON流推送Watch事件，供其他进程或语言的服务订阅
+func (s *ConfigServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "只支持GET")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "不支持流式响应")
+		return
+	}
+
+	query := r.URL.Query()
+	var req WatchRequest
+	if v := query.Get("from_version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的from_version: %s", v))
+			return
+		}
+		req.FromVersion = version
+	}
+	if v := query.Get("groups"); v != "" {
+		req.Groups = strings.Split(v, ",")
+	}
+	heartbeat := defaultWatchHeartbeat
+	if v := query.Get("heartbeat"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("无效的heartbeat: %s", v))
+			return
+		}
+		heartbeat = d
+	}
+
+	events := s.config.Watch(r.Context(), req, heartbeat)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
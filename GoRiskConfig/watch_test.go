@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, events <-chan WatchEvent) WatchEvent {
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("订阅已关闭")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("等待事件超时")
+	}
+	return WatchEvent{}
+}
+
+func TestWatchSnapshotThenDelta(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.CreateGroup("blacklist", "黑名单")
+	config.SetConfig("risk_limits", "max_single_amount", 5000.0, "", "admin")
+	config.SetConfig("blacklist", "enabled", true, "", "admin")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := config.Watch(ctx, WatchRequest{Groups: []string{"risk_limits"}}, 0)
+
+	snapshot := nextEvent(t, events)
+	if snapshot.Type != WatchSnapshot || snapshot.Version != 2 {
+		t.Fatalf("期望版本2的快照，实际%+v", snapshot)
+	}
+	if _, exists := snapshot.Snapshot["blacklist"]; exists || snapshot.Snapshot["risk_limits"]["max_single_amount"] != 5000.0 {
+		t.Errorf("快照应只包含订阅的配置组: %v", snapshot.Snapshot)
+	}
+
+	config.SetConfig("blacklist", "check_ip", true, "", "admin")
+	config.SetConfig("risk_limits", "max_single_amount", 3000.0, "", "operator")
+	change := nextEvent(t, events)
+	if change.Type != WatchChange || change.Version != 4 || change.Value != 3000.0 || change.OldValue != 5000.0 {
+		t.Errorf("变更事件不正确: %+v", change)
+	}
+
+	config.DeleteConfig("risk_limits", "max_single_amount", "admin")
+	if deleted := nextEvent(t, events); !deleted.Deleted || deleted.Version != 5 {
+		t.Errorf("删除事件不正确: %+v", deleted)
+	}
+
+	cancel()
+	for range events {
+	}
+	if len(config.watchers) != 0 {
+		t.Error("取消后应注销订阅者")
+	}
+}
+
+func TestWatchResumeFromVersion(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	for i := 1; i <= 5; i++ {
+		config.SetConfig("risk_limits", "max_single_amount", float64(i*1000), "", "admin")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := config.Watch(ctx, WatchRequest{FromVersion: 3}, 0)
+	for _, version := range []int{4, 5} {
+		if event := nextEvent(t, events); event.Type != WatchChange || event.Version != version {
+			t.Errorf("期望补发版本%d的增量，实际%+v", version, event)
+		}
+	}
+
+	// 历史已被淘汰时退回全量快照
+	short := NewRiskConfig()
+	short.maxHistory = 2
+	short.CreateGroup("risk_limits", "风控限额")
+	for i := 1; i <= 5; i++ {
+		short.SetConfig("risk_limits", "max_single_amount", float64(i*1000), "", "admin")
+	}
+	resumed := short.Watch(ctx, WatchRequest{FromVersion: 2}, 0)
+	if event := nextEvent(t, resumed); event.Type != WatchSnapshot || event.Version != 5 {
+		t.Errorf("期望版本5的快照，实际%+v", event)
+	}
+	covered := short.Watch(ctx, WatchRequest{FromVersion: 3}, 0)
+	if event := nextEvent(t, covered); event.Type != WatchChange || event.Version != 4 {
+		t.Errorf("期望补发版本4的增量，实际%+v", event)
+	}
+
+	// 来自未来的版本同样需要快照
+	future := config.Watch(ctx, WatchRequest{FromVersion: 100}, 0)
+	if event := nextEvent(t, future); event.Type != WatchSnapshot {
+		t.Errorf("期望快照，实际%+v", event)
+	}
+}
+
+func TestWatchHeartbeat(t *testing.T) {
+	config := NewRiskConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := config.Watch(ctx, WatchRequest{}, 20*time.Millisecond)
+	nextEvent(t, events) // 快照
+	if event := nextEvent(t, events); event.Type != WatchHeartbeat {
+		t.Errorf("期望心跳，实际%+v", event)
+	}
+}
+
+func TestWatchEndpoint(t *testing.T) {
+	config := NewRiskConfig()
+	config.CreateGroup("risk_limits", "风控限额")
+	config.SetConfig("risk_limits", "max_single_amount", 5000.0, "", "admin")
+
+	server := httptest.NewServer(NewConfigServer(config))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/watch?from_version=1&heartbeat=1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	config.SetConfig("risk_limits", "max_single_amount", 3000.0, "", "admin")
+
+	scanner := bufio.NewScanner(resp.Body)
+	if !scanner.Scan() {
+		t.Fatal("未收到事件")
+	}
+	var event WatchEvent
+	json.Unmarshal(scanner.Bytes(), &event)
+	if event.Type != WatchChange || event.Version != 2 || event.Value != 3000.0 {
+		t.Errorf("事件不正确: %+v", event)
+	}
+
+	bad, _ := http.Get(server.URL + "/watch?from_version=abc")
+	if bad.StatusCode != http.StatusBadRequest {
+		t.Errorf("期望400，实际%d", bad.StatusCode)
+	}
+	bad.Body.Close()
+}
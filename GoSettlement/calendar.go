@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RollConvention 非营业日顺延规则
+type RollConvention int
+
+const (
+	RollNone              RollConvention = iota // 不调整
+	RollFollowing                               // 顺延到下一个营业日
+	RollPreceding                               // 提前到上一个营业日
+	RollModifiedFollowing                       // 顺延，跨月则提前
+	RollModifiedPreceding                       // 提前，跨月则顺延
+)
+
+// DayCountConvention 计息天数规则
+type DayCountConvention int
+
+const (
+	Actual365   DayCountConvention = iota // 实际天数/365
+	Actual360                             // 实际天数/360
+	Business252                           // 营业日/252
+)
+
+const dateLayout = "2006-01-02"
+
+// BusinessCalendar 营业日历，支持周末和按地区配置的节假日
+type BusinessCalendar struct {
+	weekends map[time.Weekday]bool
+	holidays map[string]map[string]bool // 地区 -> 日期(2006-01-02)
+	mutex    sync.RWMutex
+}
+
+// NewBusinessCalendar 创建营业日历，默认周六、周日为周末
+func NewBusinessCalendar() *BusinessCalendar {
+	return &BusinessCalendar{
+		weekends: map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays: make(map[string]map[string]bool),
+	}
+}
+
+// SetWeekend 设置周末
+func (bc *BusinessCalendar) SetWeekend(days ...time.Weekday) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	bc.weekends = make(map[time.Weekday]bool, len(days))
+	for _, day := range days {
+		bc.weekends[day] = true
+	}
+}
+
+// AddHolidays 为地区添加节假日
+func (bc *BusinessCalendar) AddHolidays(region string, dates ...time.Time) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	if bc.holidays[region] == nil {
+		bc.holidays[region] = make(map[string]bool)
+	}
+	for _, date := range dates {
+		bc.holidays[region][date.Format(dateLayout)] = true
+	}
+}
+
+// RemoveHoliday 移除地区的节假日（如调休上班）
+func (bc *BusinessCalendar) RemoveHoliday(region string, date time.Time) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	delete(bc.holidays[region], date.Format(dateLayout))
+}
+
+// IsBusinessDay 判断日期在该地区是否为营业日
+func (bc *BusinessCalendar) IsBusinessDay(region string, date time.Time) bool {
+	bc.mutex.RLock()
+	defer bc.mutex.RUnlock()
+
+	if bc.weekends[date.Weekday()] {
+		return false
+	}
+	return !bc.holidays[region][date.Format(dateLayout)]
+}
+
+// step 沿direction方向找到第一个营业日（含当天）
+func (bc *BusinessCalendar) step(region string, date time.Time, direction int) time.Time {
+	for i := 0; i < 366 && !bc.IsBusinessDay(region, date); i++ {
+		date = date.AddDate(0, 0, direction)
+	}
+	return date
+}
+
+// Adjust 按顺延规则调整日期
+func (bc *BusinessCalendar) Adjust(region string, date time.Time, convention RollConvention) time.Time {
+	switch convention {
+	case RollFollowing:
+		return bc.step(region, date, 1)
+	case RollPreceding:
+		return bc.step(region, date, -1)
+	case RollModifiedFollowing:
+		adjusted := bc.step(region, date, 1)
+		if adjusted.Month() != date.Month() {
+			return bc.step(region, date, -1)
+		}
+		return adjusted
+	case RollModifiedPreceding:
+		adjusted := bc.step(region, date, -1)
+		if adjusted.Month() != date.Month() {
+			return bc.step(region, date, 1)
+		}
+		return adjusted
+	default:
+		return date
+	}
+}
+
+// AddBusinessDays 在日期上增加n个营业日，n为负数时向前推算
+func (bc *BusinessCalendar) AddBusinessDays(region string, date time.Time, n int) time.Time {
+	direction := 1
+	if n < 0 {
+		direction = -1
+		n = -n
+	}
+	for n > 0 {
+		date = date.AddDate(0, 0, direction)
+		if bc.IsBusinessDay(region, date) {
+			n--
+		}
+	}
+	return date
+}
+
+// BusinessDaysBetween 统计(start, end]区间内的营业日数
+func (bc *BusinessCalendar) BusinessDaysBetween(region string, start, end time.Time) int {
+	count := 0
+	for date := start.AddDate(0, 0, 1); !date.After(end); date = date.AddDate(0, 0, 1) {
+		if bc.IsBusinessDay(region, date) {
+			count++
+		}
+	}
+	return count
+}
+
+// AccrueInterest 按计息规则计算[start, end)期间的利息：计息包含start当天，不包含end当天。
+// Business252按区间内的营业日计数，start为节假日时不计息，end为节假日不影响结果
+func (bc *BusinessCalendar) AccrueInterest(region string, principal, annualRate float64, start, end time.Time, basis DayCountConvention) float64 {
+	if !end.After(start) {
+		return 0
+	}
+
+	days := math.Round(end.Sub(start).Hours() / 24)
+	switch basis {
+	case Actual360:
+		return principal * annualRate * days / 360
+	case Business252:
+		// (start-1, end-1]即[start, end)
+		businessDays := bc.BusinessDaysBetween(region, start.AddDate(0, 0, -1), end.AddDate(0, 0, -1))
+		return principal * annualRate * float64(businessDays) / 252
+	default:
+		return principal * annualRate * days / 365
+	}
+}
+
+// SetCalendar 为结算引擎设置营业日历和所在地区
+func (se *SettlementEngine) SetCalendar(calendar *BusinessCalendar, region string) {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	se.calendar = calendar
+	se.region = region
+}
+
+// SettlementDate 计算T+lag营业日的结算日期
+func (se *SettlementEngine) SettlementDate(tradeDate time.Time, lag int) time.Time {
+	se.mutex.RLock()
+	calendar, region := se.calendar, se.region
+	se.mutex.RUnlock()
+
+	if calendar == nil {
+		return tradeDate.AddDate(0, 0, lag)
+	}
+	return calendar.AddBusinessDays(region, calendar.Adjust(region, tradeDate, RollFollowing), lag)
+}
+
+// ScheduleTransaction 预约在指定日期执行的交易，日期按顺延规则调整到营业日，返回实际执行日期
+func (se *SettlementEngine) ScheduleTransaction(tx *Transaction, runAt time.Time, convention RollConvention) (time.Time, error) {
+	if tx.UserID == "" || tx.Amount <= 0 {
+		return time.Time{}, fmt.Errorf("无效的交易参数")
+	}
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	if se.calendar != nil {
+		runAt = se.calendar.Adjust(se.region, runAt, convention)
+	}
+	tx.ScheduledAt = runAt
+	tx.Status = "scheduled"
+	se.scheduled = append(se.scheduled, tx)
+
+	fmt.Printf("交易已预约: 用户%s, 金额%.2f, 执行日期%s\n", tx.UserID, tx.Amount, runAt.Format(dateLayout))
+	return runAt, nil
+}
+
+// ReleaseDueTransactions 提交所有执行日期不晚于now的预约交易，返回提交数量
+func (se *SettlementEngine) ReleaseDueTransactions(now time.Time) int {
+	se.mutex.Lock()
+	due := make([]*Transaction, 0)
+	remaining := se.scheduled[:0]
+	for _, tx := range se.scheduled {
+		if !tx.ScheduledAt.After(now) {
+			due = append(due, tx)
+		} else {
+			remaining = append(remaining, tx)
+		}
+	}
+	se.scheduled = remaining
+	se.mutex.Unlock()
+
+	released := 0
+	for _, tx := range due {
+		if err := se.SubmitTransaction(tx); err != nil {
+			fmt.Printf("预约交易提交失败，保留到下次释放: %v\n", err)
+			se.mutex.Lock()
+			se.scheduled = append(se.scheduled, tx)
+			se.mutex.Unlock()
+			continue
+		}
+		released++
+	}
+	return released
+}
+
+// startOfDay 日期当天零点
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// SetPayoutCutoff 设置出账交易的截止时间（当天零点起的时长，如15*time.Hour表示15:00）。
+// 设置了营业日历时，截止时间之后或非营业日处理的出账交易顺延到下一个营业日结算
+func (se *SettlementEngine) SetPayoutCutoff(cutoff time.Duration) {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	se.payoutCutoff = cutoff
+}
+
+// payoutDateLocked 在now处理的出账交易的结算日期：营业日截止时间之前为当天，否则为下一个营业日。
+// 调用方需持有锁且已设置营业日历
+func (se *SettlementEngine) payoutDateLocked(now time.Time) time.Time {
+	today := startOfDay(now)
+	if se.calendar.IsBusinessDay(se.region, today) && (se.payoutCutoff <= 0 || now.Sub(today) < se.payoutCutoff) {
+		return today
+	}
+	return se.calendar.AddBusinessDays(se.region, today, 1)
+}
+
+// deferPayouts 把批次中不能在当天结算的出账交易转为预约交易，由引擎在结算日通过ReleaseDueTransactions重新提交，
+// 返回需要立即处理的交易。已预约过的交易到期后直接处理，不会再次顺延
+func (se *SettlementEngine) deferPayouts(batch []*Transaction, now time.Time) []*Transaction {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	if se.calendar == nil {
+		return batch
+	}
+	payoutDate := se.payoutDateLocked(now)
+	if payoutDate.Equal(startOfDay(now)) {
+		return batch
+	}
+
+	kept := make([]*Transaction, 0, len(batch))
+	for _, tx := range batch {
+		if tx.Type != "debit" || !tx.ScheduledAt.IsZero() {
+			kept = append(kept, tx)
+			continue
+		}
+		tx.ScheduledAt = payoutDate
+		tx.Status = "scheduled"
+		se.scheduled = append(se.scheduled, tx)
+		fmt.Printf("出账交易顺延: %s, 用户%s, 结算日期%s\n", tx.ID, tx.UserID, payoutDate.Format(dateLayout))
+	}
+	return kept
+}
+
+// SetInterestRate 设置账户余额的年利率和计息规则，从since当天开始计息
+func (se *SettlementEngine) SetInterestRate(annualRate float64, basis DayCountConvention, since time.Time) {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	se.interestRate = annualRate
+	se.dayCount = basis
+	se.lastAccrual = startOfDay(since)
+}
+
+// AccrueInterest 为余额为正的账户计提[上次计息日, 今天)的利息并入账，返回入账的利息总额。
+// 利息只在营业日入账，非营业日的利息并入下一个营业日；引擎每次定时处理时调用
+func (se *SettlementEngine) AccrueInterest(now time.Time) float64 {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	if se.interestRate == 0 {
+		return 0
+	}
+	calendar := se.calendar
+	if calendar == nil {
+		calendar = NewBusinessCalendar()
+	}
+	end := startOfDay(now)
+	if !end.After(se.lastAccrual) || !calendar.IsBusinessDay(se.region, end) {
+		return 0
+	}
+
+	total := 0.0
+	for _, account := range se.accounts {
+		if account.Balance <= 0 {
+			continue
+		}
+		interest := calendar.AccrueInterest(se.region, account.Balance, se.interestRate, se.lastAccrual, end, se.dayCount)
+		account.Balance += interest
+		account.Version++
+		account.UpdatedAt = now
+		total += interest
+	}
+
+	fmt.Printf("计息: %s至%s, 利息合计%.2f\n", se.lastAccrual.Format(dateLayout), end.Format(dateLayout), total)
+	se.lastAccrual = end
+	return total
+}
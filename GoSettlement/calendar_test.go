@@ -0,0 +1,198 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestBusinessCalendarAdjust(t *testing.T) {
+	calendar := NewBusinessCalendar()
+	calendar.AddHolidays("CN", date(2024, 10, 1), date(2024, 10, 2), date(2024, 10, 3))
+
+	// 2024-09-28为周六
+	if calendar.IsBusinessDay("CN", date(2024, 9, 28)) {
+		t.Error("周六不应为营业日")
+	}
+	if calendar.IsBusinessDay("CN", date(2024, 10, 1)) {
+		t.Error("节假日不应为营业日")
+	}
+	if !calendar.IsBusinessDay("US", date(2024, 10, 1)) {
+		t.Error("其他地区的节假日不应生效")
+	}
+
+	if got := calendar.Adjust("CN", date(2024, 10, 1), RollFollowing); !got.Equal(date(2024, 10, 4)) {
+		t.Errorf("Following期望2024-10-04，实际%s", got.Format(dateLayout))
+	}
+	if got := calendar.Adjust("CN", date(2024, 10, 1), RollPreceding); !got.Equal(date(2024, 9, 30)) {
+		t.Errorf("Preceding期望2024-09-30，实际%s", got.Format(dateLayout))
+	}
+
+	// 2024-08-31为周六，顺延会跨月，ModifiedFollowing应提前到8-30
+	if got := calendar.Adjust("CN", date(2024, 8, 31), RollModifiedFollowing); !got.Equal(date(2024, 8, 30)) {
+		t.Errorf("ModifiedFollowing期望2024-08-30，实际%s", got.Format(dateLayout))
+	}
+}
+
+func TestAddBusinessDays(t *testing.T) {
+	calendar := NewBusinessCalendar()
+	calendar.AddHolidays("CN", date(2024, 10, 1))
+
+	// 2024-09-27周五 + 2个营业日 = 10-02（跳过周末和10-01）
+	if got := calendar.AddBusinessDays("CN", date(2024, 9, 27), 2); !got.Equal(date(2024, 10, 2)) {
+		t.Errorf("期望2024-10-02，实际%s", got.Format(dateLayout))
+	}
+	if got := calendar.AddBusinessDays("CN", date(2024, 10, 2), -2); !got.Equal(date(2024, 9, 27)) {
+		t.Errorf("期望2024-09-27，实际%s", got.Format(dateLayout))
+	}
+	if n := calendar.BusinessDaysBetween("CN", date(2024, 9, 27), date(2024, 10, 4)); n != 4 {
+		t.Errorf("期望4个营业日，实际%d", n)
+	}
+}
+
+func TestAccrueInterest(t *testing.T) {
+	calendar := NewBusinessCalendar()
+
+	interest := calendar.AccrueInterest("CN", 36500, 0.1, date(2024, 1, 1), date(2024, 1, 11), Actual365)
+	if math.Abs(interest-100) > 1e-9 {
+		t.Errorf("Actual365期望利息100，实际%.4f", interest)
+	}
+
+	// 2024-01-01周一至01-08周一，[start, end)内5个营业日
+	interest = calendar.AccrueInterest("CN", 25200, 0.1, date(2024, 1, 1), date(2024, 1, 8), Business252)
+	if math.Abs(interest-50) > 1e-9 {
+		t.Errorf("Business252期望利息50，实际%.4f", interest)
+	}
+}
+
+func TestAccrueInterestHolidayBoundary(t *testing.T) {
+	calendar := NewBusinessCalendar()
+	calendar.AddHolidays("CN", date(2024, 1, 1), date(2024, 1, 8))
+
+	// start为节假日不计息：[01-01, 01-08)内为01-02至01-05共4个营业日
+	interest := calendar.AccrueInterest("CN", 25200, 0.1, date(2024, 1, 1), date(2024, 1, 8), Business252)
+	if math.Abs(interest-40) > 1e-9 {
+		t.Errorf("start为节假日期望利息40，实际%.4f", interest)
+	}
+
+	// end为节假日不影响结果：[01-02, 01-08)仍为4个营业日，[01-08, 01-10)只有01-09
+	interest = calendar.AccrueInterest("CN", 25200, 0.1, date(2024, 1, 2), date(2024, 1, 8), Business252)
+	if math.Abs(interest-40) > 1e-9 {
+		t.Errorf("end为节假日期望利息40，实际%.4f", interest)
+	}
+	interest = calendar.AccrueInterest("CN", 25200, 0.1, date(2024, 1, 8), date(2024, 1, 10), Business252)
+	if math.Abs(interest-10) > 1e-9 {
+		t.Errorf("期望利息10，实际%.4f", interest)
+	}
+}
+
+func TestScheduledTransactions(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("user1", 1000.0)
+	calendar := NewBusinessCalendar()
+	calendar.AddHolidays("CN", date(2024, 10, 1))
+	engine.SetCalendar(calendar, "CN")
+
+	runAt, err := engine.ScheduleTransaction(&Transaction{UserID: "user1", Amount: 100, Type: "debit"}, date(2024, 10, 1), RollFollowing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !runAt.Equal(date(2024, 10, 2)) {
+		t.Errorf("期望顺延到2024-10-02，实际%s", runAt.Format(dateLayout))
+	}
+
+	if n := engine.ReleaseDueTransactions(date(2024, 10, 1)); n != 0 {
+		t.Errorf("未到期交易不应提交，实际提交%d笔", n)
+	}
+	if n := engine.ReleaseDueTransactions(date(2024, 10, 2)); n != 1 {
+		t.Errorf("期望提交1笔到期交易，实际%d笔", n)
+	}
+
+	engine.Start()
+	defer engine.Stop()
+	time.Sleep(200 * time.Millisecond)
+	account, _ := engine.GetAccount("user1")
+	if account.Balance != 900.0 {
+		t.Errorf("期望余额900.0，实际%.2f", account.Balance)
+	}
+
+	if got := engine.SettlementDate(date(2024, 9, 30), 1); !got.Equal(date(2024, 10, 2)) {
+		t.Errorf("T+1结算日期期望2024-10-02，实际%s", got.Format(dateLayout))
+	}
+}
+
+func TestPayoutCutoff(t *testing.T) {
+	engine := newTestEngine()
+	calendar := NewBusinessCalendar()
+	calendar.AddHolidays("CN", date(2024, 10, 1))
+	engine.SetCalendar(calendar, "CN")
+	engine.SetPayoutCutoff(15 * time.Hour)
+
+	newBatch := func() []*Transaction {
+		return []*Transaction{
+			{ID: "d1", UserID: "user1", Amount: 100, Type: "debit"},
+			{ID: "c1", UserID: "user1", Amount: 100, Type: "credit"},
+		}
+	}
+
+	// 营业日截止时间之前全部立即处理
+	if kept := engine.deferPayouts(newBatch(), date(2024, 9, 30).Add(10*time.Hour)); len(kept) != 2 {
+		t.Errorf("截止时间前期望处理2笔，实际%d笔", len(kept))
+	}
+
+	// 截止时间之后出账交易顺延，跳过10-01节假日到10-02
+	batch := newBatch()
+	kept := engine.deferPayouts(batch, date(2024, 9, 30).Add(16*time.Hour))
+	if len(kept) != 1 || kept[0].Type != "credit" {
+		t.Fatalf("截止时间后只应立即处理入账交易，实际%v", kept)
+	}
+	if !batch[0].ScheduledAt.Equal(date(2024, 10, 2)) {
+		t.Errorf("出账交易期望顺延到2024-10-02，实际%s", batch[0].ScheduledAt.Format(dateLayout))
+	}
+
+	// 非营业日提交的出账交易顺延到下一个营业日，到期后重新提交时不再顺延
+	batch = newBatch()
+	engine.deferPayouts(batch, date(2024, 10, 1).Add(9*time.Hour))
+	if !batch[0].ScheduledAt.Equal(date(2024, 10, 2)) {
+		t.Errorf("节假日的出账交易期望顺延到2024-10-02，实际%s", batch[0].ScheduledAt.Format(dateLayout))
+	}
+	if kept := engine.deferPayouts(batch[:1], date(2024, 10, 2).Add(16*time.Hour)); len(kept) != 1 {
+		t.Error("已顺延的出账交易到期后应直接处理")
+	}
+}
+
+func TestEngineTickReleasesAndAccrues(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("payer", 1000.0)
+	engine.CreateAccount("saver", 36500.0)
+	calendar := NewBusinessCalendar()
+	calendar.SetWeekend() // 每天都是营业日，结果与测试运行日期无关
+	engine.SetCalendar(calendar, "CN")
+
+	today := startOfDay(time.Now())
+	engine.SetInterestRate(0.1, Actual365, today.AddDate(0, 0, -10))
+	if _, err := engine.ScheduleTransaction(&Transaction{UserID: "payer", Amount: 100, Type: "debit"}, today.AddDate(0, 0, -1), RollFollowing); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不手动调用ReleaseDueTransactions和AccrueInterest，由引擎定时处理
+	engine.Start()
+	defer engine.Stop()
+	time.Sleep(300 * time.Millisecond)
+
+	payer, _ := engine.GetAccount("payer")
+	saver, _ := engine.GetAccount("saver")
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	if payer.Balance >= 1000.0 {
+		t.Errorf("到期的预约交易应由引擎自动提交，余额%.2f", payer.Balance)
+	}
+	// 36500 * 0.1 * 10 / 365 = 100
+	if math.Abs(saver.Balance-36600) > 1e-6 {
+		t.Errorf("期望计息后余额36600，实际%.2f", saver.Balance)
+	}
+}
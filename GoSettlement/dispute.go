@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 争议状态：open -> evidence -> resolved/chargeback，open也可以直接裁决
+const (
+	DisputeOpen       = "open"       // 已发起，争议金额已临时冻结
+	DisputeEvidence   = "evidence"   // 已提交举证，等待裁决
+	DisputeResolved   = "resolved"   // 裁决有利于收款方，冻结金额释放
+	DisputeChargeback = "chargeback" // 拒付成立，冲正争议金额
+)
+
+// 争议分录类型
+const (
+	EntryFreeze   = "freeze"   // 临时冻结
+	EntryRelease  = "release"  // 释放冻结
+	EntryReversal = "reversal" // 拒付冲正
+)
+
+// DefaultEvidenceDays 发起争议后提交举证的期限（营业日，未设置日历时按自然日）
+const DefaultEvidenceDays = 7
+
+// EvidenceItem 争议举证材料
+type EvidenceItem struct {
+	SubmittedBy string    `json:"submitted_by"`
+	Description string    `json:"description"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// DisputeEntry 争议处理过程中产生的资金分录
+type DisputeEntry struct {
+	Type      string    `json:"type"`
+	Amount    float64   `json:"amount"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Dispute 针对一笔入账交易的争议
+type Dispute struct {
+	ID               string         `json:"id"`
+	TransactionID    string         `json:"transaction_id"`
+	UserID           string         `json:"user_id"` // 原交易的入账账户，争议金额从该账户冻结
+	Amount           float64        `json:"amount"`
+	Reason           string         `json:"reason"`
+	Status           string         `json:"status"`
+	FrozenAmount     float64        `json:"frozen_amount"` // 当前仍冻结的金额，余额不足时小于争议金额
+	Shortfall        float64        `json:"shortfall"`     // 拒付时账户资金不足未能冲正的金额
+	Evidence         []EvidenceItem `json:"evidence,omitempty"`
+	Entries          []DisputeEntry `json:"entries"`
+	OpenedAt         time.Time      `json:"opened_at"`
+	EvidenceDeadline time.Time      `json:"evidence_deadline"`
+	ResolvedAt       time.Time      `json:"resolved_at,omitempty"`
+	Resolution       string         `json:"resolution,omitempty"`
+}
+
+// DisputeReport 争议统计报表
+type DisputeReport struct {
+	Total            int            `json:"total"`
+	ByStatus         map[string]int `json:"by_status"`
+	ByReason         map[string]int `json:"by_reason"`
+	DisputedAmount   float64        `json:"disputed_amount"`
+	FrozenAmount     float64        `json:"frozen_amount"`
+	ReleasedAmount   float64        `json:"released_amount"`
+	ChargebackAmount float64        `json:"chargeback_amount"`
+	Shortfall        float64        `json:"shortfall"`
+	ChargebackRate   float64        `json:"chargeback_rate"` // 拒付笔数 / 已裁决笔数
+}
+
+// findTransaction 按ID查找已提交的交易，调用方需持有锁
+func (se *SettlementEngine) findTransaction(txID string) (*Transaction, bool) {
+	for i := range se.transactions {
+		if se.transactions[i].ID == txID {
+			return &se.transactions[i], true
+		}
+	}
+	return nil, false
+}
+
+// OpenDispute 对入账交易发起争议，并从入账账户临时冻结争议金额；amount为0表示全额争议。
+// 同一笔交易可以多次部分争议，但累计金额不能超过原交易金额
+func (se *SettlementEngine) OpenDispute(txID string, amount float64, reason string) (*Dispute, error) {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	tx, exists := se.findTransaction(txID)
+	if !exists {
+		return nil, fmt.Errorf("交易 %s 不存在", txID)
+	}
+	if tx.Type != "credit" {
+		return nil, fmt.Errorf("只能对入账交易发起争议")
+	}
+	if amount == 0 {
+		amount = tx.Amount
+	}
+	if amount < 0 {
+		return nil, fmt.Errorf("无效的争议金额")
+	}
+
+	disputed := 0.0
+	for _, d := range se.disputes {
+		if d.TransactionID == txID && d.Status != DisputeResolved {
+			disputed += d.Amount
+		}
+	}
+	if disputed+amount > tx.Amount {
+		return nil, fmt.Errorf("争议金额 %.2f 超过交易可争议金额 %.2f", amount, tx.Amount-disputed)
+	}
+
+	account, exists := se.accounts[tx.UserID]
+	if !exists {
+		return nil, fmt.Errorf("账户 %s 不存在", tx.UserID)
+	}
+
+	now := time.Now()
+	se.disputeSeq++
+	dispute := &Dispute{
+		ID:               fmt.Sprintf("dp_%d", se.disputeSeq),
+		TransactionID:    txID,
+		UserID:           tx.UserID,
+		Amount:           amount,
+		Reason:           reason,
+		Status:           DisputeOpen,
+		Entries:          make([]DisputeEntry, 0),
+		OpenedAt:         now,
+		EvidenceDeadline: now.AddDate(0, 0, DefaultEvidenceDays),
+	}
+	if se.calendar != nil {
+		dispute.EvidenceDeadline = se.calendar.AddBusinessDays(se.region, now, DefaultEvidenceDays)
+	}
+
+	// 余额不足时冻结全部可用余额，差额在拒付时记为资金缺口
+	freeze := amount
+	if account.Balance < freeze {
+		freeze = account.Balance
+	}
+	if freeze > 0 {
+		account.Balance -= freeze
+		account.FrozenAmount += freeze
+		account.DisputeHold += freeze
+		account.Version++
+		account.UpdatedAt = now
+		dispute.FrozenAmount = freeze
+		dispute.Entries = append(dispute.Entries, DisputeEntry{Type: EntryFreeze, Amount: freeze, Timestamp: now})
+	}
+
+	se.disputes[dispute.ID] = dispute
+	fmt.Printf("发起争议: %s, 交易%s, 金额%.2f, 冻结%.2f\n", dispute.ID, txID, amount, freeze)
+	return dispute, nil
+}
+
+// SubmitEvidence 提交举证材料，争议进入evidence状态
+func (se *SettlementEngine) SubmitEvidence(disputeID, submittedBy, description string) error {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	dispute, exists := se.disputes[disputeID]
+	if !exists {
+		return fmt.Errorf("争议 %s 不存在", disputeID)
+	}
+	if dispute.Status != DisputeOpen && dispute.Status != DisputeEvidence {
+		return fmt.Errorf("争议 %s 已结束", disputeID)
+	}
+
+	now := time.Now()
+	if now.After(dispute.EvidenceDeadline) {
+		return fmt.Errorf("争议 %s 已超过举证期限", disputeID)
+	}
+
+	dispute.Evidence = append(dispute.Evidence, EvidenceItem{
+		SubmittedBy: submittedBy,
+		Description: description,
+		SubmittedAt: now,
+	})
+	dispute.Status = DisputeEvidence
+	return nil
+}
+
+// ResolveDispute 裁决争议：chargeback为true时拒付成立，冲正争议金额；否则释放冻结金额
+func (se *SettlementEngine) ResolveDispute(disputeID string, chargeback bool, resolution string) (*Dispute, error) {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	dispute, exists := se.disputes[disputeID]
+	if !exists {
+		return nil, fmt.Errorf("争议 %s 不存在", disputeID)
+	}
+	if err := se.resolveLocked(dispute, chargeback, resolution, time.Now()); err != nil {
+		return nil, err
+	}
+	return dispute, nil
+}
+
+// resolveLocked 执行裁决并过账，调用方需持有锁
+func (se *SettlementEngine) resolveLocked(dispute *Dispute, chargeback bool, resolution string, now time.Time) error {
+	if dispute.Status != DisputeOpen && dispute.Status != DisputeEvidence {
+		return fmt.Errorf("争议 %s 已结束", dispute.ID)
+	}
+	account, exists := se.accounts[dispute.UserID]
+	if !exists {
+		return fmt.Errorf("账户 %s 不存在", dispute.UserID)
+	}
+
+	// 争议冻结只能由裁决释放；账户上的冻结不足说明账务已不一致，拒绝过账
+	frozen := dispute.FrozenAmount
+	if account.FrozenAmount < frozen || account.DisputeHold < frozen {
+		return fmt.Errorf("账户 %s 冻结金额 %.2f（争议冻结 %.2f）不足以释放争议 %s 的 %.2f",
+			account.UserID, account.FrozenAmount, account.DisputeHold, dispute.ID, frozen)
+	}
+	account.FrozenAmount -= frozen
+	account.DisputeHold -= frozen
+	dispute.FrozenAmount = 0
+
+	if chargeback {
+		// 冻结部分直接冲正，不足部分从可用余额扣除，仍不足时记为资金缺口
+		remaining := dispute.Amount - frozen
+		fromBalance := remaining
+		if account.Balance < fromBalance {
+			fromBalance = account.Balance
+		}
+		account.Balance -= fromBalance
+		dispute.Shortfall = remaining - fromBalance
+		reversed := frozen + fromBalance
+
+		dispute.Status = DisputeChargeback
+		dispute.Entries = append(dispute.Entries, DisputeEntry{Type: EntryReversal, Amount: reversed, Timestamp: now})
+		se.transactions = append(se.transactions, Transaction{
+			ID:          fmt.Sprintf("rev_%s", dispute.ID),
+			UserID:      dispute.UserID,
+			Amount:      reversed,
+			Type:        "debit",
+			Status:      DisputeChargeback,
+			Timestamp:   now,
+			Description: fmt.Sprintf("拒付冲正 %s (原交易 %s)", dispute.ID, dispute.TransactionID),
+		})
+		fmt.Printf("拒付成立: %s, 冲正%.2f, 缺口%.2f\n", dispute.ID, reversed, dispute.Shortfall)
+	} else {
+		account.Balance += frozen
+		dispute.Status = DisputeResolved
+		if frozen > 0 {
+			dispute.Entries = append(dispute.Entries, DisputeEntry{Type: EntryRelease, Amount: frozen, Timestamp: now})
+		}
+		fmt.Printf("争议解决: %s, 释放%.2f\n", dispute.ID, frozen)
+	}
+
+	account.Version++
+	account.UpdatedAt = now
+	dispute.ResolvedAt = now
+	dispute.Resolution = resolution
+	return nil
+}
+
+// ExpireDisputes 对超过举证期限仍未举证的争议按拒付处理，返回处理数量
+func (se *SettlementEngine) ExpireDisputes(now time.Time) int {
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+
+	expired := 0
+	for _, dispute := range se.sortedDisputesLocked() {
+		if dispute.Status == DisputeOpen && now.After(dispute.EvidenceDeadline) {
+			if err := se.resolveLocked(dispute, true, "举证超时", now); err == nil {
+				expired++
+			}
+		}
+	}
+	return expired
+}
+
+// sortedDisputesLocked 按发起顺序返回所有争议，调用方需持有锁
+func (se *SettlementEngine) sortedDisputesLocked() []*Dispute {
+	disputes := make([]*Dispute, 0, len(se.disputes))
+	for _, dispute := range se.disputes {
+		disputes = append(disputes, dispute)
+	}
+	sort.Slice(disputes, func(i, j int) bool {
+		if !disputes[i].OpenedAt.Equal(disputes[j].OpenedAt) {
+			return disputes[i].OpenedAt.Before(disputes[j].OpenedAt)
+		}
+		return disputes[i].ID < disputes[j].ID
+	})
+	return disputes
+}
+
+// GetDispute 获取争议详情
+func (se *SettlementEngine) GetDispute(disputeID string) (*Dispute, error) {
+	se.mutex.RLock()
+	defer se.mutex.RUnlock()
+
+	dispute, exists := se.disputes[disputeID]
+	if !exists {
+		return nil, fmt.Errorf("争议 %s 不存在", disputeID)
+	}
+	return dispute, nil
+}
+
+// ListDisputes 按发起顺序列出争议，status为空表示全部
+func (se *SettlementEngine) ListDisputes(status string) []*Dispute {
+	se.mutex.RLock()
+	defer se.mutex.RUnlock()
+
+	result := make([]*Dispute, 0)
+	for _, dispute := range se.sortedDisputesLocked() {
+		if status == "" || dispute.Status == status {
+			result = append(result, dispute)
+		}
+	}
+	return result
+}
+
+// GetDisputeReport 统计发起时间在[from, to)内的争议，零值时间表示不限制
+func (se *SettlementEngine) GetDisputeReport(from, to time.Time) *DisputeReport {
+	se.mutex.RLock()
+	defer se.mutex.RUnlock()
+
+	report := &DisputeReport{
+		ByStatus: make(map[string]int),
+		ByReason: make(map[string]int),
+	}
+	closed := 0
+	for _, dispute := range se.disputes {
+		if (!from.IsZero() && dispute.OpenedAt.Before(from)) || (!to.IsZero() && !dispute.OpenedAt.Before(to)) {
+			continue
+		}
+		report.Total++
+		report.ByStatus[dispute.Status]++
+		report.ByReason[dispute.Reason]++
+		report.DisputedAmount += dispute.Amount
+		report.FrozenAmount += dispute.FrozenAmount
+		report.Shortfall += dispute.Shortfall
+		for _, entry := range dispute.Entries {
+			switch entry.Type {
+			case EntryRelease:
+				report.ReleasedAmount += entry.Amount
+			case EntryReversal:
+				report.ChargebackAmount += entry.Amount
+			}
+		}
+		if dispute.Status == DisputeResolved || dispute.Status == DisputeChargeback {
+			closed++
+		}
+	}
+	if closed > 0 {
+		report.ChargebackRate = float64(report.ByStatus[DisputeChargeback]) / float64(closed)
+	}
+	return report
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// settledCredit 提交一笔入账交易并等待结算完成
+func settledCredit(t *testing.T, engine *SettlementEngine, userID string, amount float64) *Transaction {
+	t.Helper()
+	tx := &Transaction{UserID: userID, Amount: amount, Type: "credit", Description: "收款"}
+	if err := engine.SubmitTransaction(tx); err != nil {
+		t.Fatalf("提交交易失败: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	return tx
+}
+
+func TestDisputeChargeback(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("merchant", 0)
+	engine.Start()
+	defer engine.Stop()
+
+	tx := settledCredit(t, engine, "merchant", 300.0)
+
+	dispute, err := engine.OpenDispute(tx.ID, 0, "未收到商品")
+	if err != nil {
+		t.Fatalf("发起争议失败: %v", err)
+	}
+	account, _ := engine.GetAccount("merchant")
+	if dispute.Amount != 300 || account.Balance != 0 || account.FrozenAmount != 300 {
+		t.Errorf("全额争议应冻结300，余额%.2f 冻结%.2f", account.Balance, account.FrozenAmount)
+	}
+
+	if err := engine.SubmitEvidence(dispute.ID, "merchant", "物流签收记录"); err != nil {
+		t.Fatalf("提交举证失败: %v", err)
+	}
+	if dispute.Status != DisputeEvidence {
+		t.Errorf("期望evidence状态，实际%s", dispute.Status)
+	}
+
+	if _, err := engine.ResolveDispute(dispute.ID, true, "签收人非持卡人"); err != nil {
+		t.Fatalf("裁决失败: %v", err)
+	}
+	if dispute.Status != DisputeChargeback || account.FrozenAmount != 0 || account.Balance != 0 {
+		t.Errorf("拒付后冻结金额应冲正: %+v, 账户%+v", dispute, account)
+	}
+	last := dispute.Entries[len(dispute.Entries)-1]
+	if last.Type != EntryReversal || last.Amount != 300 {
+		t.Errorf("期望300的冲正分录，实际%+v", last)
+	}
+
+	if _, err := engine.ResolveDispute(dispute.ID, false, ""); err == nil {
+		t.Error("已结束的争议不能再次裁决")
+	}
+	if _, err := engine.OpenDispute(tx.ID, 10, "重复争议"); err == nil {
+		t.Error("已拒付的金额不能再次争议")
+	}
+}
+
+func TestDisputeReleaseAndPartial(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("merchant", 50.0)
+	engine.Start()
+	defer engine.Stop()
+
+	tx := settledCredit(t, engine, "merchant", 200.0)
+
+	first, err := engine.OpenDispute(tx.ID, 120, "金额错误")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.OpenDispute(tx.ID, 100, "金额错误"); err == nil {
+		t.Error("累计争议金额不能超过交易金额")
+	}
+	second, err := engine.OpenDispute(tx.ID, 80, "重复扣款")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := engine.GetAccount("merchant")
+	if account.Balance != 50 || account.FrozenAmount != 200 {
+		t.Errorf("期望余额50冻结200，实际%.2f/%.2f", account.Balance, account.FrozenAmount)
+	}
+
+	engine.ResolveDispute(first.ID, false, "商户胜诉")
+	if first.Status != DisputeResolved || account.Balance != 170 || account.FrozenAmount != 80 {
+		t.Errorf("胜诉应释放120，余额%.2f 冻结%.2f", account.Balance, account.FrozenAmount)
+	}
+
+	// 释放的金额可以重新争议
+	if _, err := engine.OpenDispute(tx.ID, 100, "金额错误"); err != nil {
+		t.Errorf("已释放的金额应可重新争议: %v", err)
+	}
+
+	if _, err := engine.OpenDispute("missing", 0, ""); err == nil {
+		t.Error("不存在的交易不能发起争议")
+	}
+	if open := engine.ListDisputes(DisputeOpen); len(open) != 2 || open[0].ID != second.ID {
+		t.Errorf("期望2个未结束的争议，实际%d", len(open))
+	}
+}
+
+func TestDisputeShortfallAndExpiry(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("merchant", 0)
+	engine.Start()
+	defer engine.Stop()
+
+	tx := settledCredit(t, engine, "merchant", 100.0)
+
+	// 资金已转出，只能部分冻结
+	engine.FreezeAmount("merchant", 60.0)
+	dispute, err := engine.OpenDispute(tx.ID, 0, "欺诈")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dispute.FrozenAmount != 40 {
+		t.Errorf("期望冻结可用余额40，实际%.2f", dispute.FrozenAmount)
+	}
+
+	if n := engine.ExpireDisputes(time.Now()); n != 0 {
+		t.Errorf("未到期的争议不应处理，实际%d", n)
+	}
+	if n := engine.ExpireDisputes(dispute.EvidenceDeadline.Add(time.Hour)); n != 1 {
+		t.Fatalf("期望1个超时争议，实际%d", n)
+	}
+	if dispute.Status != DisputeChargeback || dispute.Shortfall != 60 || dispute.Resolution != "举证超时" {
+		t.Errorf("超时应按拒付处理并记录缺口: %+v", dispute)
+	}
+
+	report := engine.GetDisputeReport(time.Time{}, time.Time{})
+	if report.Total != 1 || report.ByStatus[DisputeChargeback] != 1 || report.ByReason["欺诈"] != 1 {
+		t.Errorf("报表统计不正确: %+v", report)
+	}
+	if report.ChargebackAmount != 40 || report.Shortfall != 60 || report.ChargebackRate != 1 {
+		t.Errorf("报表金额不正确: %+v", report)
+	}
+	if future := engine.GetDisputeReport(time.Now().Add(time.Hour), time.Time{}); future.Total != 0 {
+		t.Errorf("时间范围外的争议不应统计: %+v", future)
+	}
+}
+
+func TestDisputeHoldCannotBeUnfrozen(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("u", 0)
+	engine.Start()
+	defer engine.Stop()
+
+	tx := settledCredit(t, engine, "u", 100.0)
+	dispute, err := engine.OpenDispute(tx.ID, 0, "未收到商品")
+	if err != nil {
+		t.Fatalf("发起争议失败: %v", err)
+	}
+	if err := engine.UnfreezeAmount("u", 100); err == nil {
+		t.Error("争议冻结不能通过UnfreezeAmount释放")
+	}
+
+	// 普通冻结仍可解冻，争议冻结保持不变
+	settledCredit(t, engine, "u", 50.0)
+	if err := engine.FreezeAmount("u", 50); err != nil {
+		t.Fatalf("冻结失败: %v", err)
+	}
+	if err := engine.UnfreezeAmount("u", 60); err == nil {
+		t.Error("解冻金额不能超过普通冻结")
+	}
+	if err := engine.UnfreezeAmount("u", 50); err != nil {
+		t.Errorf("普通冻结应可以解冻: %v", err)
+	}
+
+	if _, err := engine.ResolveDispute(dispute.ID, false, "商户胜诉"); err != nil {
+		t.Fatalf("裁决失败: %v", err)
+	}
+	account, _ := engine.GetAccount("u")
+	if account.Balance != 150 || account.FrozenAmount != 0 || account.DisputeHold != 0 {
+		t.Errorf("期望余额150、冻结0，实际余额%.2f 冻结%.2f 争议冻结%.2f", account.Balance, account.FrozenAmount, account.DisputeHold)
+	}
+}
+
+func TestResolveDisputeRejectsInconsistentHold(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("u", 0)
+	engine.Start()
+	defer engine.Stop()
+
+	tx := settledCredit(t, engine, "u", 100.0)
+	dispute, _ := engine.OpenDispute(tx.ID, 0, "未收到商品")
+
+	// 模拟账务被外部改动：冻结金额已不足以覆盖争议冻结
+	account, _ := engine.GetAccount("u")
+	engine.mutex.Lock()
+	account.FrozenAmount = 0
+	engine.mutex.Unlock()
+
+	if _, err := engine.ResolveDispute(dispute.ID, false, ""); err == nil {
+		t.Error("冻结金额为负前应拒绝裁决")
+	}
+	if account.Balance != 0 || account.FrozenAmount != 0 || dispute.Status != DisputeOpen {
+		t.Errorf("拒绝裁决时不应过账: 余额%.2f 冻结%.2f 状态%s", account.Balance, account.FrozenAmount, dispute.Status)
+	}
+}
@@ -16,6 +16,7 @@ type Transaction struct {
 	Status      string    `json:"status"`
 	Timestamp   time.Time `json:"timestamp"`
 	Description string    `json:"description"`
+	ScheduledAt time.Time `json:"scheduled_at,omitempty"`
 }
 
 // Account 账户信息
@@ -23,6 +24,7 @@ type Account struct {
 	UserID      string  `json:"user_id"`
 	Balance     float64 `json:"balance"`
 	FrozenAmount float64 `json:"frozen_amount"`
+	DisputeHold float64 `json:"dispute_hold"` // FrozenAmount中由未结争议冻结的部分，只能通过裁决释放
 	Version     int64   `json:"version"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -45,6 +47,17 @@ type SettlementEngine struct {
 	stopChan   chan bool
 	batchSize  int
 	batchTimeout time.Duration
+	calendar   *BusinessCalendar
+	region     string
+	scheduled  []*Transaction
+	payoutCutoff time.Duration // 出账截止时间（当天零点起的时长），0表示营业日全天可出账
+	interestRate float64
+	dayCount   DayCountConvention
+	lastAccrual time.Time
+	disputes   map[string]*Dispute
+	disputeSeq int
+	limits     RiskLimits
+	velocity   map[string]*dailyUsage
 }
 
 // NewSettlementEngine 创建结算引擎
@@ -56,6 +69,8 @@ func NewSettlementEngine() *SettlementEngine {
 		stopChan:       make(chan bool),
 		batchSize:      100,
 		batchTimeout:   5 * time.Second,
+		disputes:       make(map[string]*Dispute),
+		velocity:       make(map[string]*dailyUsage),
 	}
 }
 
@@ -118,6 +133,17 @@ func (se *SettlementEngine) processTransaction(tx *Transaction) *SettlementResul
 		}
 	}
 
+	now := time.Now()
+	if reason := se.checkLimitsLocked(tx, now); reason != "" {
+		return &SettlementResult{
+			TransactionID: tx.ID,
+			Success:       false,
+			NewBalance:    account.Balance,
+			ErrorMessage:  reason,
+			Timestamp:     now,
+		}
+	}
+
 	var newBalance float64
 	var success bool
 	var errorMsg string
@@ -145,6 +171,7 @@ func (se *SettlementEngine) processTransaction(tx *Transaction) *SettlementResul
 		account.Balance = newBalance
 		account.Version++
 		account.UpdatedAt = time.Now()
+		se.recordUsageLocked(tx, now)
 	}
 
 	return &SettlementResult{
@@ -175,6 +202,18 @@ func (se *SettlementEngine) batchProcessTransactions(txs []*Transaction) []*Sett
 			continue
 		}
 
+		now := time.Now()
+		if reason := se.checkLimitsLocked(tx, now); reason != "" {
+			results[i] = &SettlementResult{
+				TransactionID: tx.ID,
+				Success:       false,
+				NewBalance:    account.Balance,
+				ErrorMessage:  reason,
+				Timestamp:     now,
+			}
+			continue
+		}
+
 		var newBalance float64
 		var success bool
 		var errorMsg string
@@ -202,6 +241,7 @@ func (se *SettlementEngine) batchProcessTransactions(txs []*Transaction) []*Sett
 			account.Balance = newBalance
 			account.Version++
 			account.UpdatedAt = time.Now()
+			se.recordUsageLocked(tx, now)
 		}
 
 		results[i] = &SettlementResult{
@@ -242,6 +282,11 @@ func (se *SettlementEngine) processSettlementQueue() {
 			}
 
 		case <-timer.C:
+			// 提交到期的预约交易（包括顺延的出账交易），并按营业日计息
+			now := time.Now()
+			se.ReleaseDueTransactions(now)
+			se.AccrueInterest(now)
+
 			// 超时处理当前批次
 			if len(batch) > 0 {
 				se.processBatch(batch)
@@ -262,6 +307,10 @@ func (se *SettlementEngine) processSettlementQueue() {
 
 // processBatch 处理批次交易
 func (se *SettlementEngine) processBatch(batch []*Transaction) {
+	batch = se.deferPayouts(batch, time.Now())
+	if len(batch) == 0 {
+		return
+	}
 	fmt.Printf("开始处理批次交易，数量: %d\n", len(batch))
 
 	results := se.batchProcessTransactions(batch)
@@ -359,6 +408,9 @@ func (se *SettlementEngine) UnfreezeAmount(userID string, amount float64) error
 	if account.FrozenAmount < amount {
 		return fmt.Errorf("冻结金额不足")
 	}
+	if account.FrozenAmount-account.DisputeHold < amount {
+		return fmt.Errorf("冻结金额不足，其中%.2f为争议冻结，需通过裁决释放", account.DisputeHold)
+	}
 
 	account.Balance += amount
 	account.FrozenAmount -= amount
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 风控配置中心risk_limits配置组中与结算限额对应的键
+const (
+	RiskLimitsGroup               = "risk_limits"
+	LimitKeyMaxSingleAmount       = "max_single_amount"
+	LimitKeyMaxDailyAmount        = "max_daily_amount"
+	LimitKeyDailyTransactionCount = "daily_transaction_count"
+)
+
+// riskWatchEvent 风控配置中心 GET /watch 推送的事件，字段与配置中心的WatchEvent一致
+type riskWatchEvent struct {
+	Type     string                            `json:"type"` // snapshot, change, heartbeat
+	Version  int                               `json:"version"`
+	Group    string                            `json:"group"`
+	Key      string                            `json:"key"`
+	Value    interface{}                       `json:"value"`
+	Deleted  bool                              `json:"deleted"`
+	Snapshot map[string]map[string]interface{} `json:"snapshot"`
+}
+
+// InstanceLimits 一致性检查中单个引擎实例的状态
+type InstanceLimits struct {
+	Instance string     `json:"instance"`
+	Limits   RiskLimits `json:"limits"`
+	InSync   bool       `json:"in_sync"`
+}
+
+// LimitsConsistencyReport 各引擎实例当前执行的限额与配置中心是否一致
+type LimitsConsistencyReport struct {
+	ConfigVersion int              `json:"config_version"` // 桥接器已应用的配置版本
+	Expected      RiskLimits       `json:"expected"`
+	Instances     []InstanceLimits `json:"instances"`
+	Consistent    bool             `json:"consistent"`
+	LastError     string           `json:"last_error,omitempty"`
+}
+
+// RiskLimitBridge 订阅风控配置中心risk_limits配置组的Watch流，把限额变更实时应用到
+// 已挂载的结算引擎，无需重启。断线后按最后应用的版本续订
+type RiskLimitBridge struct {
+	Endpoint      string        // 配置中心地址，如 http://localhost:8080
+	Heartbeat     time.Duration // 请求服务端发送心跳的间隔
+	RetryInterval time.Duration // 断线后重连的间隔
+	Client        *http.Client
+
+	mutex    sync.Mutex
+	engines  map[string]*SettlementEngine
+	values   map[string]interface{} // risk_limits组的当前值
+	version  int
+	expected RiskLimits
+	synced   bool // 是否已收到过快照或增量
+	lastErr  error
+}
+
+// NewRiskLimitBridge 创建连接到配置中心的限额桥接器
+func NewRiskLimitBridge(endpoint string) *RiskLimitBridge {
+	return &RiskLimitBridge{
+		Endpoint:      endpoint,
+		Heartbeat:     10 * time.Second,
+		RetryInterval: time.Second,
+		Client:        &http.Client{},
+		engines:       make(map[string]*SettlementEngine),
+		values:        make(map[string]interface{}),
+	}
+}
+
+// Attach 挂载一个引擎实例，已同步过配置时立即应用当前限额
+func (b *RiskLimitBridge) Attach(instance string, engine *SettlementEngine) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, exists := b.engines[instance]; exists {
+		return fmt.Errorf("引擎实例 %s 已挂载", instance)
+	}
+	b.engines[instance] = engine
+	if b.synced {
+		engine.SetRiskLimits(b.expected)
+	}
+	return nil
+}
+
+// Detach 卸载引擎实例，引擎保留最后应用的限额
+func (b *RiskLimitBridge) Detach(instance string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.engines, instance)
+}
+
+// Run 持续订阅配置变更直到ctx取消，连接断开后等待RetryInterval重连
+func (b *RiskLimitBridge) Run(ctx context.Context) error {
+	for {
+		if err := b.stream(ctx); err != nil && ctx.Err() == nil {
+			b.mutex.Lock()
+			b.lastErr = err
+			b.mutex.Unlock()
+			fmt.Printf("风控配置订阅中断: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.RetryInterval):
+		}
+	}
+}
+
+// stream 建立一次Watch连接并逐条处理事件，连接结束时返回
+func (b *RiskLimitBridge) stream(ctx context.Context) error {
+	b.mutex.Lock()
+	query := url.Values{}
+	query.Set("from_version", strconv.Itoa(b.version))
+	query.Set("groups", RiskLimitsGroup)
+	query.Set("heartbeat", b.Heartbeat.String())
+	b.mutex.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.Endpoint+"/watch?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("配置中心返回状态码 %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var event riskWatchEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("解析配置事件失败: %v", err)
+		}
+		b.handleEvent(event)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("配置中心关闭了订阅连接")
+}
+
+// handleEvent 更新本地的risk_limits值并推送到所有引擎
+func (b *RiskLimitBridge) handleEvent(event riskWatchEvent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch event.Type {
+	case "snapshot":
+		b.values = make(map[string]interface{})
+		for key, value := range event.Snapshot[RiskLimitsGroup] {
+			b.values[key] = value
+		}
+	case "change":
+		if event.Group != RiskLimitsGroup {
+			return
+		}
+		if event.Deleted {
+			delete(b.values, event.Key)
+		} else {
+			b.values[event.Key] = event.Value
+		}
+	default:
+		return
+	}
+	b.version = event.Version
+
+	limits, err := limitsFromValues(b.values)
+	if err != nil {
+		// 配置值无效时引擎继续执行上一次的限额
+		b.lastErr = fmt.Errorf("配置版本 %d: %v", event.Version, err)
+		fmt.Printf("忽略无效的风控限额: %v\n", b.lastErr)
+		return
+	}
+	limits.ConfigVersion = event.Version
+	limits.AppliedAt = time.Now()
+	b.expected = limits
+	b.synced = true
+	b.lastErr = nil
+	for _, engine := range b.engines {
+		engine.SetRiskLimits(limits)
+	}
+}
+
+// limitsFromValues 把risk_limits组的配置值转换为限额，未配置的限额为0（不限制）
+func limitsFromValues(values map[string]interface{}) (RiskLimits, error) {
+	var limits RiskLimits
+	for key, target := range map[string]*float64{
+		LimitKeyMaxSingleAmount: &limits.MaxSingleAmount,
+		LimitKeyMaxDailyAmount:  &limits.MaxDailyAmount,
+	} {
+		if value, exists := values[key]; exists {
+			number, ok := value.(float64)
+			if !ok || number < 0 {
+				return RiskLimits{}, fmt.Errorf("%s 不是有效的金额: %v", key, value)
+			}
+			*target = number
+		}
+	}
+	if value, exists := values[LimitKeyDailyTransactionCount]; exists {
+		number, ok := value.(float64)
+		if !ok || number < 0 || number != float64(int(number)) {
+			return RiskLimits{}, fmt.Errorf("%s 不是有效的次数: %v", LimitKeyDailyTransactionCount, value)
+		}
+		limits.DailyTransactionCount = int(number)
+	}
+	return limits, nil
+}
+
+// sameLimits 比较两组限额的取值，忽略应用时间
+func sameLimits(a, b RiskLimits) bool {
+	return a.MaxSingleAmount == b.MaxSingleAmount && a.MaxDailyAmount == b.MaxDailyAmount &&
+		a.DailyTransactionCount == b.DailyTransactionCount && a.ConfigVersion == b.ConfigVersion
+}
+
+// CheckConsistency 报告每个引擎实例当前执行的限额，以及是否与桥接器最后应用的配置一致
+func (b *RiskLimitBridge) CheckConsistency() *LimitsConsistencyReport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	report := &LimitsConsistencyReport{ConfigVersion: b.version, Expected: b.expected, Consistent: b.synced}
+	if b.lastErr != nil {
+		report.LastError = b.lastErr.Error()
+	}
+	for instance, engine := range b.engines {
+		limits := engine.GetRiskLimits()
+		inSync := b.synced && sameLimits(limits, b.expected)
+		report.Instances = append(report.Instances, InstanceLimits{Instance: instance, Limits: limits, InSync: inSync})
+		if !inSync {
+			report.Consistent = false
+		}
+	}
+	sort.Slice(report.Instances, func(i, j int) bool {
+		return report.Instances[i].Instance < report.Instances[j].Instance
+	})
+	return report
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRiskConfig 模拟风控配置中心的 GET /watch 流，每个连接先发送queued中的事件，
+// 之后转发pushed中的事件；closeAfter>0时发送该数量的事件后断开
+type fakeRiskConfig struct {
+	mutex        sync.Mutex
+	queued       []riskWatchEvent
+	pushed       chan riskWatchEvent
+	fromVersions []string
+	closeAfter   int
+}
+
+func (f *fakeRiskConfig) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.fromVersions = append(f.fromVersions, r.URL.Query().Get("from_version"))
+	queued := f.queued
+	f.queued = nil
+	closeAfter := f.closeAfter
+	f.mutex.Unlock()
+
+	flusher := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	sent := 0
+	send := func(event riskWatchEvent) bool {
+		encoder.Encode(event)
+		flusher.Flush()
+		sent++
+		return closeAfter == 0 || sent < closeAfter
+	}
+	for _, event := range queued {
+		if !send(event) {
+			return
+		}
+	}
+	for {
+		select {
+		case event := <-f.pushed:
+			if !send(event) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待条件超时")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRiskLimitsEnforced(t *testing.T) {
+	engine := newTestEngine()
+	engine.CreateAccount("user1", 10000.0)
+	engine.SetRiskLimits(RiskLimits{MaxSingleAmount: 500, MaxDailyAmount: 800, DailyTransactionCount: 3})
+
+	cases := []struct {
+		amount float64
+		kind   string
+		ok     bool
+		reason string
+	}{
+		{600, "debit", false, "超过单笔限额500.00"},
+		{400, "debit", true, ""},
+		{300, "debit", true, ""},
+		{200, "debit", false, "超过每日限额800.00"},
+		{2000, "credit", true, ""}, // 入账不受限额约束
+		{50, "debit", true, ""},
+		{10, "debit", false, "超过每日交易次数3"},
+	}
+	for i, c := range cases {
+		result := engine.processTransaction(&Transaction{ID: "tx", UserID: "user1", Amount: c.amount, Type: c.kind})
+		if result.Success != c.ok || result.ErrorMessage != c.reason {
+			t.Errorf("第%d笔交易期望 %v %q，实际 %v %q", i, c.ok, c.reason, result.Success, result.ErrorMessage)
+		}
+	}
+
+	// 批量结算同样执行限额，热更新后立即生效
+	engine.SetRiskLimits(RiskLimits{MaxSingleAmount: 100})
+	results := engine.batchProcessTransactions([]*Transaction{
+		{ID: "a", UserID: "user1", Amount: 150, Type: "debit"},
+		{ID: "b", UserID: "user1", Amount: 80, Type: "debit"},
+	})
+	if results[0].Success || !results[1].Success {
+		t.Errorf("批量结算未按新限额执行: %+v %+v", results[0], results[1])
+	}
+
+	// 跨天后重新计数
+	engine.mutex.Lock()
+	engine.velocity["user1"].day = "2000-01-01"
+	engine.mutex.Unlock()
+	engine.SetRiskLimits(RiskLimits{DailyTransactionCount: 1})
+	if result := engine.processTransaction(&Transaction{ID: "c", UserID: "user1", Amount: 10, Type: "debit"}); !result.Success {
+		t.Errorf("跨天后应重新计数: %s", result.ErrorMessage)
+	}
+}
+
+func TestRiskLimitBridgeHotApply(t *testing.T) {
+	fake := &fakeRiskConfig{
+		pushed: make(chan riskWatchEvent, 8),
+		queued: []riskWatchEvent{{Type: "snapshot", Version: 3, Snapshot: map[string]map[string]interface{}{
+			"risk_limits": {"max_single_amount": 5000.0, "daily_transaction_count": 50.0},
+		}}},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	primary, replica := newTestEngine(), newTestEngine()
+	primary.CreateAccount("user1", 10000.0)
+	bridge := NewRiskLimitBridge(server.URL)
+	bridge.Attach("primary", primary)
+	bridge.Attach("replica", replica)
+	if err := bridge.Attach("primary", primary); err == nil {
+		t.Error("重复挂载应返回错误")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.Run(ctx)
+
+	waitFor(t, func() bool { return bridge.CheckConsistency().ConfigVersion == 3 })
+	report := bridge.CheckConsistency()
+	if !report.Consistent || len(report.Instances) != 2 || report.Instances[0].Instance != "primary" {
+		t.Fatalf("快照应用后各实例应一致: %+v", report)
+	}
+	if limits := replica.GetRiskLimits(); limits.MaxSingleAmount != 5000 || limits.DailyTransactionCount != 50 || limits.ConfigVersion != 3 {
+		t.Errorf("快照限额不正确: %+v", limits)
+	}
+
+	// 运行中的引擎无需重启即按新限额结算
+	fake.pushed <- riskWatchEvent{Type: "change", Version: 4, Group: "risk_limits", Key: "max_single_amount", Value: 1000.0}
+	waitFor(t, func() bool { return primary.GetRiskLimits().ConfigVersion == 4 })
+	if result := primary.processTransaction(&Transaction{ID: "tx", UserID: "user1", Amount: 2000, Type: "debit"}); result.Success {
+		t.Error("热更新后的单笔限额未生效")
+	}
+
+	// 删除配置项后恢复为不限制；无效值被忽略，引擎保留上一次的限额
+	fake.pushed <- riskWatchEvent{Type: "change", Version: 5, Group: "risk_limits", Key: "daily_transaction_count", Deleted: true}
+	fake.pushed <- riskWatchEvent{Type: "change", Version: 6, Group: "risk_limits", Key: "max_daily_amount", Value: "lots"}
+	waitFor(t, func() bool { return bridge.CheckConsistency().ConfigVersion == 6 })
+	report = bridge.CheckConsistency()
+	if report.LastError == "" || !report.Consistent || report.Expected.ConfigVersion != 5 || report.Expected.DailyTransactionCount != 0 {
+		t.Errorf("无效配置应记录错误并保留版本5的限额: %+v", report)
+	}
+
+	// 绕过桥接器修改限额的实例会在一致性检查中暴露
+	replica.SetRiskLimits(RiskLimits{MaxSingleAmount: 99999})
+	report = bridge.CheckConsistency()
+	if report.Consistent || report.Instances[0].InSync != true || report.Instances[1].InSync {
+		t.Errorf("一致性检查应发现replica不一致: %+v", report)
+	}
+}
+
+func TestRiskLimitBridgeReconnect(t *testing.T) {
+	fake := &fakeRiskConfig{
+		pushed:     make(chan riskWatchEvent, 8),
+		closeAfter: 1,
+		queued: []riskWatchEvent{{Type: "snapshot", Version: 7, Snapshot: map[string]map[string]interface{}{
+			"risk_limits": {"max_daily_amount": 20000.0},
+		}}},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	engine := newTestEngine()
+	bridge := NewRiskLimitBridge(server.URL)
+	bridge.RetryInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bridge.Run(ctx)
+
+	waitFor(t, func() bool { return bridge.CheckConsistency().ConfigVersion == 7 })
+	// 同步之后挂载的实例立即获得当前限额
+	bridge.Attach("late", engine)
+	if engine.GetRiskLimits().MaxDailyAmount != 20000 {
+		t.Errorf("挂载时应立即应用当前限额: %+v", engine.GetRiskLimits())
+	}
+
+	fake.pushed <- riskWatchEvent{Type: "change", Version: 8, Group: "risk_limits", Key: "max_daily_amount", Value: 30000.0}
+	waitFor(t, func() bool { return engine.GetRiskLimits().ConfigVersion == 8 })
+
+	fake.mutex.Lock()
+	fromVersions := append([]string(nil), fake.fromVersions...)
+	fake.mutex.Unlock()
+	if len(fromVersions) < 2 || fromVersions[0] != "0" || fromVersions[1] != "7" {
+		t.Errorf("断线后应按最后应用的版本续订: %v", fromVersions)
+	}
+}
@@ -5,8 +5,15 @@ import (
 	"time"
 )
 
-func TestCreateAccount(t *testing.T) {
+// newTestEngine 创建批处理超时很短的引擎，测试中提交的交易很快就会结算
+func newTestEngine() *SettlementEngine {
 	engine := NewSettlementEngine()
+	engine.batchTimeout = 50 * time.Millisecond
+	return engine
+}
+
+func TestCreateAccount(t *testing.T) {
+	engine := newTestEngine()
 
 	// 测试创建账户
 	err := engine.CreateAccount("user1", 1000.0)
@@ -22,7 +29,7 @@ func TestCreateAccount(t *testing.T) {
 }
 
 func TestSubmitTransaction(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 	engine.CreateAccount("user1", 1000.0)
 
 	// 启动引擎
@@ -59,7 +66,7 @@ func TestSubmitTransaction(t *testing.T) {
 }
 
 func TestCreditTransaction(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 	engine.CreateAccount("user1", 1000.0)
 
 	engine.Start()
@@ -83,7 +90,7 @@ func TestCreditTransaction(t *testing.T) {
 }
 
 func TestDebitTransaction(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 	engine.CreateAccount("user1", 1000.0)
 
 	engine.Start()
@@ -122,7 +129,7 @@ func TestDebitTransaction(t *testing.T) {
 }
 
 func TestBatchProcessing(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 	engine.CreateAccount("user1", 1000.0)
 	engine.CreateAccount("user2", 500.0)
 
@@ -162,7 +169,7 @@ func TestBatchProcessing(t *testing.T) {
 }
 
 func TestFreezeUnfreeze(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 	engine.CreateAccount("user1", 1000.0)
 
 	// 测试冻结
@@ -201,7 +208,7 @@ func TestFreezeUnfreeze(t *testing.T) {
 }
 
 func TestGetAccount(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 
 	// 测试获取不存在的账户
 	_, err := engine.GetAccount("nonexistent")
@@ -222,7 +229,7 @@ func TestGetAccount(t *testing.T) {
 }
 
 func TestTransactionStats(t *testing.T) {
-	engine := NewSettlementEngine()
+	engine := newTestEngine()
 	engine.CreateAccount("user1", 1000.0)
 	engine.CreateAccount("user2", 500.0)
 
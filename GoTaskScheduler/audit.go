@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 候选节点被拒绝的原因
+const (
+	RejectBusy     = "busy"     // 节点没有空闲任务槽
+	RejectOffline  = "offline"  // 节点心跳超时
+	RejectReserved = "reserved" // 空闲任务槽属于其他集群的预留容量
+	RejectPolicy   = "policy"   // 跨集群策略不允许使用该节点
+	RejectAffinity = "affinity" // 调度策略不接受该节点，如标签不匹配
+	RejectSticky   = "sticky"   // 任务的亲和键绑定在其他节点上
+	RejectRanked   = "ranked"   // 节点可用，但调度策略选择了其他节点
+)
+
+// maxAuditPerTask 每个任务保留的调度决策数，等待中的任务每次重试都会产生一条
+const maxAuditPerTask = 100
+
+// CandidateDecision 一次调度中对单个候选节点的判断
+type CandidateDecision struct {
+	WorkerID  string
+	ClusterID string
+	Selected  bool
+	Reason    string // 未被选中时的拒绝原因
+	Detail    string
+}
+
+// SchedulingDecision 一次调度尝试的审计记录
+type SchedulingDecision struct {
+	TaskID     string
+	Attempt    int
+	Time       time.Time
+	Strategy   FailoverPolicy
+	Placed     bool
+	WorkerID   string
+	ClusterID  string
+	Candidates []CandidateDecision
+	Summary    string
+}
+
+// strategyOf 返回任务实际生效的跨集群策略
+func strategyOf(task *Task) FailoverPolicy {
+	if task.Failover == "" {
+		return FailoverPreferLocal
+	}
+	return task.Failover
+}
+
+// explainPlacement 逐个说明候选节点被选中或拒绝的原因，必须在分配前调用，
+// 调用方需持有workerMutex
+func (ts *TaskScheduler) explainPlacement(task *Task, chosen *Worker) []CandidateDecision {
+	clusterIDs := make([]string, 0, len(ts.clusters))
+	for clusterID := range ts.clusters {
+		clusterIDs = append(clusterIDs, clusterID)
+	}
+	sort.Strings(clusterIDs)
+
+	strategy := strategyOf(task)
+	bound := ts.boundWorker(task)
+	localAvailable := len(ts.candidateSlots(task, []string{task.ClusterID})) > 0
+
+	var candidates []CandidateDecision
+	for _, clusterID := range clusterIDs {
+		available := make(map[*Worker]bool)
+		for _, worker := range ts.availableFor(task, clusterID) {
+			available[worker] = true
+		}
+		remote := clusterID != task.ClusterID
+
+		for _, workerID := range ts.clusters[clusterID] {
+			worker := ts.workers[workerID]
+			candidate := CandidateDecision{WorkerID: worker.ID, ClusterID: clusterID}
+			switch {
+			case worker == chosen:
+				candidate.Selected = true
+			case worker.Status == "offline":
+				candidate.Reason = RejectOffline
+				candidate.Detail = fmt.Sprintf("最近心跳 %s", worker.LastHeartbeat.Format(time.RFC3339))
+			case bound != nil && worker != bound:
+				candidate.Reason = RejectSticky
+				candidate.Detail = fmt.Sprintf("亲和键 %s 绑定在节点 %s", task.AffinityKey, bound.ID)
+			case freeSlots(worker) == 0:
+				candidate.Reason = RejectBusy
+				candidate.Detail = fmt.Sprintf("节点状态为 %s，运行中 %d/%d", worker.Status, worker.Running, capacityOf(worker))
+			case !ts.accepts(task, worker):
+				candidate.Reason = RejectAffinity
+				candidate.Detail = fmt.Sprintf("%s策略不接受该节点，任务标签 %v，节点标签 %v", ts.strategy.Name(), task.Labels, worker.Labels)
+			case remote && strategy == FailoverStrict:
+				candidate.Reason = RejectPolicy
+				candidate.Detail = fmt.Sprintf("strict策略只允许集群 %s", task.ClusterID)
+			case !available[worker]:
+				candidate.Reason = RejectReserved
+				candidate.Detail = fmt.Sprintf("集群 %s 预留了 %d 个任务槽", clusterID, ts.reserved[clusterID])
+			case remote && strategy == FailoverPreferLocal && localAvailable:
+				candidate.Reason = RejectPolicy
+				candidate.Detail = fmt.Sprintf("本集群 %s 有空闲节点", task.ClusterID)
+			default:
+				candidate.Reason = RejectRanked
+				candidate.Detail = fmt.Sprintf("%s策略选择了其他节点", ts.strategy.Name())
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// summarizeDecision 生成一行说明，未分配时按原因统计被拒绝的节点数
+func summarizeDecision(decision *SchedulingDecision) string {
+	if decision.Placed {
+		return fmt.Sprintf("分配到 %s (集群 %s，策略 %s)", decision.WorkerID, decision.ClusterID, decision.Strategy)
+	}
+	if len(decision.Candidates) == 0 {
+		return "没有任何工作节点"
+	}
+
+	counts := make(map[string]int)
+	for _, candidate := range decision.Candidates {
+		counts[candidate.Reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%s %d", reason, counts[reason])
+	}
+	return fmt.Sprintf("没有可用节点 (策略 %s): %s", decision.Strategy, strings.Join(parts, ", "))
+}
+
+// recordDecision 保存调度决策，每个任务只保留最近maxAuditPerTask条
+func (ts *TaskScheduler) recordDecision(task *Task, worker *Worker, placed bool, candidates []CandidateDecision) {
+	decision := &SchedulingDecision{
+		TaskID:     task.ID,
+		Time:       time.Now(),
+		Strategy:   strategyOf(task),
+		Placed:     placed,
+		Candidates: candidates,
+	}
+	if placed {
+		decision.WorkerID = worker.ID
+		decision.ClusterID = worker.ClusterID
+	}
+	decision.Summary = summarizeDecision(decision)
+	ts.appendDecision(task.ID, decision)
+}
+
+// appendDecision 追加一条决策并编号
+func (ts *TaskScheduler) appendDecision(taskID string, decision *SchedulingDecision) {
+	ts.auditMutex.Lock()
+	defer ts.auditMutex.Unlock()
+
+	ts.attempts[taskID]++
+	decision.Attempt = ts.attempts[taskID]
+	decisions := append(ts.audit[taskID], decision)
+	if len(decisions) > maxAuditPerTask {
+		decisions = decisions[len(decisions)-maxAuditPerTask:]
+	}
+	ts.audit[taskID] = decisions
+}
+
+// recordQuotaWait 记录因队列达到并发上限而没有尝试调度的任务
+func (ts *TaskScheduler) recordQuotaWait(task *Task, queue string, limit int) {
+	decision := &SchedulingDecision{
+		TaskID:   task.ID,
+		Time:     time.Now(),
+		Strategy: strategyOf(task),
+		Summary:  fmt.Sprintf("队列 %s 已达到并发上限 %d，等待队列中的任务完成", queue, limit),
+	}
+	ts.appendDecision(task.ID, decision)
+}
+
+// recordGroupWait 记录因任务组中其他成员无法分配而整组等待的任务
+func (ts *TaskScheduler) recordGroupWait(task *Task, groupID, blocking string) {
+	decision := &SchedulingDecision{
+		TaskID:   task.ID,
+		Time:     time.Now(),
+		Strategy: strategyOf(task),
+		Summary:  fmt.Sprintf("任务组 %s 中的任务 %s 没有可用节点，整组等待", groupID, blocking),
+	}
+	ts.appendDecision(task.ID, decision)
+}
+
+// GetSchedulingAudit 返回任务的调度决策记录，按时间先后排列
+func (ts *TaskScheduler) GetSchedulingAudit(taskID string) []SchedulingDecision {
+	ts.auditMutex.Lock()
+	defer ts.auditMutex.Unlock()
+
+	decisions := make([]SchedulingDecision, len(ts.audit[taskID]))
+	for i, decision := range ts.audit[taskID] {
+		decisions[i] = *decision
+	}
+	return decisions
+}
+
+// ExplainTask 说明任务最近一次调度的结果，用于排查任务为什么一直处于pending
+func (ts *TaskScheduler) ExplainTask(taskID string) string {
+	ts.auditMutex.Lock()
+	defer ts.auditMutex.Unlock()
+
+	decisions := ts.audit[taskID]
+	if len(decisions) == 0 {
+		return fmt.Sprintf("任务 %s 还没有被调度过", taskID)
+	}
+	last := decisions[len(decisions)-1]
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "任务 %s 第%d次调度: %s", taskID, last.Attempt, last.Summary)
+	for _, candidate := range last.Candidates {
+		if candidate.Selected {
+			fmt.Fprintf(&b, "\n  %s/%s: 选中", candidate.ClusterID, candidate.WorkerID)
+		} else {
+			fmt.Fprintf(&b, "\n  %s/%s: %s (%s)", candidate.ClusterID, candidate.WorkerID, candidate.Reason, candidate.Detail)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func candidateReasons(decision SchedulingDecision) map[string]string {
+	reasons := make(map[string]string)
+	for _, candidate := range decision.Candidates {
+		if candidate.Selected {
+			reasons[candidate.WorkerID] = "selected"
+		} else {
+			reasons[candidate.WorkerID] = candidate.Reason
+		}
+	}
+	return reasons
+}
+
+func TestAuditPlacedTask(t *testing.T) {
+	scheduler := newFailoverScheduler()
+	scheduler.SetReservedCapacity("clusterB", 1)
+
+	local := &Task{ID: "task1", ClusterID: "clusterA"}
+	scheduler.Schedule(local)
+
+	audit := scheduler.GetSchedulingAudit("task1")
+	if len(audit) != 1 || !audit[0].Placed || audit[0].WorkerID != "a1" || audit[0].Strategy != FailoverPreferLocal {
+		t.Fatalf("调度决策记录不正确: %+v", audit)
+	}
+	reasons := candidateReasons(audit[0])
+	if reasons["a1"] != "selected" || reasons["b1"] != RejectPolicy || reasons["c1"] != RejectPolicy {
+		t.Errorf("prefer-local在本集群有空闲时应拒绝其他集群: %v", reasons)
+	}
+
+	// clusterA已满，溢出任务只能使用clusterB未预留的节点
+	overflow := &Task{ID: "task2", ClusterID: "clusterA"}
+	scheduler.Schedule(overflow)
+	reasons = candidateReasons(scheduler.GetSchedulingAudit("task2")[0])
+	expected := map[string]string{"a1": RejectBusy, "b1": "selected", "b2": RejectReserved, "c1": RejectRanked}
+	for worker, reason := range expected {
+		if reasons[worker] != reason {
+			t.Errorf("节点 %s 期望 %s，实际 %s", worker, reason, reasons[worker])
+		}
+	}
+}
+
+func TestAuditStuckTask(t *testing.T) {
+	scheduler := newFailoverScheduler()
+	scheduler.Schedule(&Task{ID: "task1", ClusterID: "clusterA"})
+
+	stuck := &Task{ID: "task2", ClusterID: "clusterA", Failover: FailoverStrict}
+	for i := 0; i < 3; i++ {
+		if scheduler.Schedule(stuck) {
+			t.Fatal("strict任务不应被调度")
+		}
+	}
+
+	audit := scheduler.GetSchedulingAudit("task2")
+	if len(audit) != 3 || audit[2].Attempt != 3 || audit[2].Placed {
+		t.Fatalf("每次调度尝试都应记录: %+v", audit)
+	}
+	reasons := candidateReasons(audit[2])
+	if reasons["a1"] != RejectBusy || reasons["b1"] != RejectPolicy || reasons["c1"] != RejectPolicy {
+		t.Errorf("拒绝原因不正确: %v", reasons)
+	}
+	if !strings.Contains(audit[2].Summary, "busy 1") || !strings.Contains(audit[2].Summary, "policy 3") {
+		t.Errorf("摘要应统计拒绝原因: %s", audit[2].Summary)
+	}
+
+	explanation := scheduler.ExplainTask("task2")
+	if !strings.Contains(explanation, "第3次调度") || !strings.Contains(explanation, "strict策略只允许集群 clusterA") {
+		t.Errorf("说明信息不完整: %s", explanation)
+	}
+	if !strings.Contains(scheduler.ExplainTask("unknown"), "还没有被调度过") {
+		t.Error("未调度的任务应有提示")
+	}
+}
+
+func TestAuditRetention(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	task := &Task{ID: "task1", ClusterID: "none"}
+	for i := 0; i < maxAuditPerTask+5; i++ {
+		scheduler.Schedule(task)
+	}
+
+	audit := scheduler.GetSchedulingAudit("task1")
+	if len(audit) != maxAuditPerTask {
+		t.Fatalf("期望保留%d条记录，实际%d条", maxAuditPerTask, len(audit))
+	}
+	if audit[len(audit)-1].Attempt != maxAuditPerTask+5 || audit[0].Summary != "没有任何工作节点" {
+		t.Errorf("应保留最近的记录并保持尝试次数: %+v", audit[len(audit)-1])
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+// capacityOf 节点的任务槽数，未设置Capacity时为1
+func capacityOf(worker *Worker) int {
+	if worker.Capacity <= 0 {
+		return 1
+	}
+	return worker.Capacity
+}
+
+// freeSlots 节点还能接收的任务数，busy和offline的节点为0
+func freeSlots(worker *Worker) int {
+	if worker.Status != "idle" {
+		return 0
+	}
+	return max(capacityOf(worker)-worker.Running, 0)
+}
+
+// occupySlot 分配任务时占用一个任务槽，槽位用满时节点变为busy
+func occupySlot(worker *Worker) {
+	worker.Running++
+	if worker.Running >= capacityOf(worker) {
+		worker.Status = "busy"
+	}
+}
+
+// releaseSlot 任务结束时释放任务槽，已离线的节点保持离线
+func releaseSlot(worker *Worker) {
+	if worker.Running > 0 {
+		worker.Running--
+	}
+	if worker.Status == "busy" && worker.Running < capacityOf(worker) {
+		worker.Status = "idle"
+	}
+}
+
+// ClusterUtilization 集群的容量和使用情况，离线节点不计入容量
+type ClusterUtilization struct {
+	Workers     int     // 节点总数
+	Online      int     // 在线节点数
+	Capacity    int     // 在线节点的任务槽总数
+	Running     int     // 正在运行的任务数
+	Utilization float64 // Running / Capacity，没有在线节点时为0
+}
+
+// GetClusterUtilization 返回每个集群的任务槽使用情况
+func (ts *TaskScheduler) GetClusterUtilization() map[string]ClusterUtilization {
+	ts.workerMutex.RLock()
+	defer ts.workerMutex.RUnlock()
+
+	stats := make(map[string]ClusterUtilization)
+	for clusterID, workerIDs := range ts.clusters {
+		var usage ClusterUtilization
+		for _, workerID := range workerIDs {
+			worker := ts.workers[workerID]
+			usage.Workers++
+			if worker.Status == "offline" {
+				continue
+			}
+			usage.Online++
+			usage.Capacity += capacityOf(worker)
+			usage.Running += worker.Running
+		}
+		if usage.Capacity > 0 {
+			usage.Utilization = float64(usage.Running) / float64(usage.Capacity)
+		}
+		stats[clusterID] = usage
+	}
+	return stats
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCapacitySlots(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+
+	first := &Task{ID: "task1", ClusterID: "cluster1"}
+	second := &Task{ID: "task2", ClusterID: "cluster1"}
+	third := &Task{ID: "task3", ClusterID: "cluster1"}
+	for _, task := range []*Task{first, second, third} {
+		scheduler.SubmitTask(task)
+	}
+	scheduler.dispatch()
+
+	worker := scheduler.workers["worker1"]
+	if first.WorkerID != "worker1" || second.WorkerID != "worker1" {
+		t.Fatalf("Capacity为2的节点应同时运行两个任务: %s %s", first.WorkerID, second.WorkerID)
+	}
+	if third.Status != "pending" {
+		t.Errorf("任务槽已满时任务3应等待，实际状态%s", third.Status)
+	}
+	if worker.Running != 2 || worker.Status != "busy" {
+		t.Errorf("任务槽用满后节点应为busy: running=%d status=%s", worker.Running, worker.Status)
+	}
+	audit := scheduler.GetSchedulingAudit("task3")
+	if reasons := candidateReasons(audit[len(audit)-1]); reasons["worker1"] != RejectBusy {
+		t.Errorf("任务槽已满的拒绝原因不正确: %v", reasons)
+	}
+
+	// 完成一个任务后空出一个槽位
+	scheduler.CompleteTask("task1", true)
+	if worker.Running != 1 || worker.Status != "idle" {
+		t.Errorf("完成任务后应释放任务槽: running=%d status=%s", worker.Running, worker.Status)
+	}
+	scheduler.dispatch()
+	if third.WorkerID != "worker1" || worker.Running != 2 {
+		t.Errorf("任务3应使用空出的任务槽，实际为%s", third.WorkerID)
+	}
+}
+
+func TestReservedCapacitySlots(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "a1", ClusterID: "clusterA", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "b1", ClusterID: "clusterB", Status: "idle", Capacity: 3})
+	scheduler.SetReservedCapacity("clusterB", 2)
+
+	local := &Task{ID: "task1", ClusterID: "clusterA"}
+	overflow := &Task{ID: "task2", ClusterID: "clusterA"}
+	blocked := &Task{ID: "task3", ClusterID: "clusterA"}
+	if !scheduler.Schedule(local) || local.WorkerID != "a1" {
+		t.Fatalf("期望分配到本集群a1，实际为%s", local.WorkerID)
+	}
+	if !scheduler.Schedule(overflow) || overflow.WorkerID != "b1" {
+		t.Fatalf("b1的3个任务槽中有1个可供溢出，实际为%s", overflow.WorkerID)
+	}
+	if scheduler.Schedule(blocked) {
+		t.Errorf("溢出任务不应占用预留的任务槽，实际分配到%s", blocked.WorkerID)
+	}
+
+	// 本集群任务可以使用预留的任务槽
+	owned := &Task{ID: "task4", ClusterID: "clusterB"}
+	if !scheduler.Schedule(owned) || owned.WorkerID != "b1" {
+		t.Errorf("本集群任务应使用预留容量，实际为%s", owned.WorkerID)
+	}
+}
+
+func TestClusterUtilization(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 3})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle"})
+	scheduler.AddWorker(&Worker{ID: "worker3", ClusterID: "cluster2", Status: "offline", Capacity: 4})
+
+	for _, id := range []string{"task1", "task2", "task3"} {
+		scheduler.Schedule(&Task{ID: id, ClusterID: "cluster1", Failover: FailoverStrict})
+	}
+
+	stats := scheduler.GetClusterUtilization()
+	usage := stats["cluster1"]
+	// 未设置Capacity的节点按1个任务槽计算
+	if usage.Workers != 2 || usage.Online != 2 || usage.Capacity != 4 || usage.Running != 3 {
+		t.Errorf("cluster1的统计不正确: %+v", usage)
+	}
+	if usage.Utilization != 0.75 {
+		t.Errorf("期望使用率0.75，实际为%v", usage.Utilization)
+	}
+	if offline := stats["cluster2"]; offline.Workers != 1 || offline.Online != 0 || offline.Capacity != 0 || offline.Utilization != 0 {
+		t.Errorf("离线节点不应计入容量: %+v", offline)
+	}
+
+	// 同一节点的任务槽相邻，worker1先被占满，只剩worker2有空闲任务槽
+	if idle := scheduler.GetClusterStats()["cluster1"]; idle != 1 {
+		t.Errorf("期望cluster1有1个节点有空闲任务槽，实际%d个", idle)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// delayedTask 等待到期的任务
+type delayedTask struct {
+	task *Task
+	seq  uint64 // NotBefore相同时先提交的先到期
+}
+
+type delayHeap []*delayedTask
+
+func (h delayHeap) Len() int { return len(h) }
+func (h delayHeap) Less(i, j int) bool {
+	if !h[i].task.NotBefore.Equal(h[j].task.NotBefore) {
+		return h[i].task.NotBefore.Before(h[j].task.NotBefore)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h delayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(*delayedTask)) }
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// delayQueue 按NotBefore排序的延迟任务，到期后才进入等待队列
+type delayQueue struct {
+	mutex sync.Mutex
+	items delayHeap
+	seq   uint64
+}
+
+// push 加入延迟任务
+func (q *delayQueue) push(task *Task) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.seq++
+	heap.Push(&q.items, &delayedTask{task: task, seq: q.seq})
+}
+
+// popDue 按到期顺序取出now之前到期的任务
+func (q *delayQueue) popDue(now time.Time) []*Task {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var due []*Task
+	for len(q.items) > 0 && !q.items[0].task.NotBefore.After(now) {
+		due = append(due, heap.Pop(&q.items).(*delayedTask).task)
+	}
+	return due
+}
+
+// remove 移除任务，任务不在队列中时不做处理
+func (q *delayQueue) remove(taskID string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, item := range q.items {
+		if item.task.ID == taskID {
+			heap.Remove(&q.items, i)
+			return
+		}
+	}
+}
+
+// len 返回延迟任务数
+func (q *delayQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items)
+}
+
+// next 返回最早到期的时间
+func (q *delayQueue) next() (time.Time, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.items) == 0 {
+		return time.Time{}, false
+	}
+	return q.items[0].task.NotBefore, true
+}
+
+// snapshot 按到期顺序返回延迟任务
+func (q *delayQueue) snapshot() []*Task {
+	q.mutex.Lock()
+	items := make(delayHeap, len(q.items))
+	copy(items, q.items)
+	q.mutex.Unlock()
+
+	tasks := make([]*Task, 0, len(items))
+	for len(items) > 0 {
+		tasks = append(tasks, heap.Pop(&items).(*delayedTask).task)
+	}
+	return tasks
+}
+
+// isDelayed 任务是否还没有到NotBefore
+func isDelayed(task *Task, now time.Time) bool {
+	return task.NotBefore.After(now)
+}
+
+// readyAt 任务进入等待队列的时间，优先级老化从这一刻开始计算，
+// 延迟任务不会因为提前提交而获得更高的有效优先级
+func readyAt(task *Task) time.Time {
+	if task.NotBefore.After(task.CreatedAt) {
+		return task.NotBefore
+	}
+	return task.CreatedAt
+}
+
+// releaseDue 把到期的延迟任务转为pending并放入等待队列，返回放入的任务数
+func (ts *TaskScheduler) releaseDue(now time.Time) int {
+	due := ts.delayed.popDue(now)
+	if len(due) == 0 {
+		return 0
+	}
+	ts.taskMutex.Lock()
+	for _, task := range due {
+		task.Status = "pending"
+		ts.persistTask(task)
+	}
+	ts.taskMutex.Unlock()
+
+	for _, task := range due {
+		fmt.Printf("延迟任务 %s 已到期\n", task.ID)
+		ts.queue.push(task)
+	}
+	return len(due)
+}
+
+// nextDueTimer 返回在下一个延迟任务到期时触发的通道，没有延迟任务时返回nil（永不触发）。
+// 调用方需在不再等待时调用stop
+func (ts *TaskScheduler) nextDueTimer() (<-chan time.Time, func() bool) {
+	next, ok := ts.delayed.next()
+	if !ok {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(time.Until(next))
+	return timer.C, timer.Stop
+}
+
+// DelayedTasks 返回还没有到期的延迟任务，按到期时间排列
+func (ts *TaskScheduler) DelayedTasks() []*Task {
+	return ts.delayed.snapshot()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDelayedTaskReleasedWhenDue(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+
+	task := &Task{ID: "later", ClusterID: "cluster1", NotBefore: time.Now().Add(100 * time.Millisecond)}
+	scheduler.SubmitTask(task)
+	scheduler.SubmitTask(&Task{ID: "now", ClusterID: "cluster1", NotBefore: time.Now().Add(-time.Minute)})
+
+	go scheduler.Start()
+	defer scheduler.Stop()
+
+	waitForStatus(t, scheduler, "now", "running")
+	if status := scheduler.GetTaskStatus("later").Status; status != "delayed" {
+		t.Fatalf("未到期的任务应处于delayed状态，实际为%s", status)
+	}
+	if delayed := scheduler.DelayedTasks(); len(delayed) != 1 || delayed[0].ID != "later" {
+		t.Errorf("DelayedTasks应返回未到期的任务: %v", delayed)
+	}
+	if pending := scheduler.PendingTasks(); len(pending) != 0 {
+		t.Errorf("未到期的任务不应进入等待队列: %v", pending)
+	}
+
+	// 到期后调度循环由定时器唤醒，不等待每秒一次的重试
+	started := waitForStatus(t, scheduler, "later", "running").StartedAt
+	if started.Before(task.NotBefore) {
+		t.Errorf("任务在NotBefore之前开始: %v < %v", started, task.NotBefore)
+	}
+	if started.Sub(task.NotBefore) > 500*time.Millisecond {
+		t.Errorf("任务到期后应立即调度，延迟了%v", started.Sub(task.NotBefore))
+	}
+}
+
+func TestDelayedTaskOrderAndAging(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	now := time.Now()
+	scheduler.SubmitTask(&Task{ID: "second", ClusterID: "cluster1", Priority: 1, NotBefore: now.Add(2 * time.Hour)})
+	scheduler.SubmitTask(&Task{ID: "first", ClusterID: "cluster1", Priority: 1, NotBefore: now.Add(time.Hour)})
+	scheduler.SubmitTask(&Task{ID: "urgent", ClusterID: "cluster1", Priority: 3})
+
+	if n := scheduler.releaseDue(now.Add(30 * time.Minute)); n != 0 {
+		t.Fatalf("未到期时不应放入等待队列，实际%d个", n)
+	}
+	if n := scheduler.releaseDue(now.Add(3 * time.Hour)); n != 2 {
+		t.Fatalf("期望2个任务到期，实际%d个", n)
+	}
+	if task := scheduler.GetTaskStatus("first"); task.Status != "pending" {
+		t.Errorf("到期的任务应转为pending，实际为%s", task.Status)
+	}
+
+	// 优先级老化从到期时刻开始计算，提前一小时提交的低优先级任务不会排到urgent前面
+	pending := scheduler.PendingTasks()
+	order := []string{"urgent", "first", "second"}
+	for i, task := range pending {
+		if task.ID != order[i] {
+			t.Errorf("第%d个等待任务期望为%s，实际为%s", i+1, order[i], task.ID)
+		}
+	}
+}
+
+func TestRecoverDelayedTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	store, _ := NewFileStore(path)
+	scheduler := NewTaskScheduler()
+	scheduler.Recover(store)
+	notBefore := time.Now().Add(time.Hour)
+	scheduler.SubmitTask(&Task{ID: "nightly", ClusterID: "cluster1", NotBefore: notBefore})
+
+	store, _ = NewFileStore(path)
+	restarted := NewTaskScheduler()
+	if unfinished, _ := restarted.Recover(store); unfinished != 1 {
+		t.Fatalf("延迟任务应计入未完成任务，实际%d个", unfinished)
+	}
+	delayed := restarted.DelayedTasks()
+	if len(delayed) != 1 || delayed[0].Status != "delayed" || !delayed[0].NotBefore.Equal(notBefore) {
+		t.Fatalf("延迟任务应保留到期时间: %v", delayed)
+	}
+	if stats := restarted.GetQueueStats()[DefaultQueue]; stats.Delayed != 1 {
+		t.Errorf("队列统计应包含延迟任务: %+v", stats)
+	}
+
+	// 重启期间已到期的任务在下一次检查时进入等待队列，并写回存储
+	restarted.releaseDue(notBefore)
+	store, _ = NewFileStore(path)
+	tasks, _, _ := store.Load()
+	if len(tasks) != 1 || tasks[0].Status != "pending" {
+		t.Errorf("到期后的状态应持久化: %+v", tasks)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TaskEventType 任务状态变化的类型
+type TaskEventType string
+
+const (
+	EventSubmitted   TaskEventType = "submitted"   // 任务已提交（包括延迟任务）
+	EventAssigned    TaskEventType = "assigned"    // 任务已分配到工作节点
+	EventStarted     TaskEventType = "started"     // 节点运行时开始执行处理函数
+	EventCompleted   TaskEventType = "completed"   // 任务执行成功
+	EventFailed      TaskEventType = "failed"      // 任务执行失败，Task.Error为原因
+	EventRescheduled TaskEventType = "rescheduled" // 所在节点失联，任务回到等待队列
+	EventCancelled   TaskEventType = "cancelled"   // 任务被取消（CancelGroup）
+)
+
+// TaskEvent 一次任务状态变化，Task为变化后任务记录的副本
+type TaskEvent struct {
+	Type TaskEventType `json:"type"`
+	Time time.Time     `json:"time"`
+	Task Task          `json:"task"`
+}
+
+// TaskListener 接收任务事件。每个监听器按事件发生的顺序在自己的goroutine中依次收到事件，
+// 处理慢的监听器不会阻塞调度器和其他监听器，OnTaskEvent中可以调用调度器的方法
+type TaskListener interface {
+	OnTaskEvent(event TaskEvent)
+}
+
+// TaskListenerFunc 把函数用作TaskListener
+type TaskListenerFunc func(event TaskEvent)
+
+func (f TaskListenerFunc) OnTaskEvent(event TaskEvent) { f(event) }
+
+// listenerQueue 单个监听器的事件队列，有事件时才启动goroutine投递，投递完即退出
+type listenerQueue struct {
+	listener TaskListener
+	mutex    sync.Mutex
+	pending  []TaskEvent
+	running  bool
+}
+
+// enqueue 加入事件，没有正在投递的goroutine时启动一个
+func (q *listenerQueue) enqueue(event TaskEvent) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, event)
+	if !q.running {
+		q.running = true
+		go q.drain()
+	}
+}
+
+// drain 依次投递队列中的事件，直到队列为空
+func (q *listenerQueue) drain() {
+	for {
+		q.mutex.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mutex.Unlock()
+			return
+		}
+		event := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mutex.Unlock()
+
+		q.listener.OnTaskEvent(event)
+	}
+}
+
+// AddListener 注册任务事件监听器
+func (ts *TaskScheduler) AddListener(listener TaskListener) {
+	ts.listenerMutex.Lock()
+	defer ts.listenerMutex.Unlock()
+	ts.listeners = append(ts.listeners, &listenerQueue{listener: listener})
+}
+
+// emit 把任务当前状态的副本发给所有监听器，调用方需持有保护任务字段的锁
+func (ts *TaskScheduler) emit(eventType TaskEventType, task *Task) {
+	ts.listenerMutex.RLock()
+	defer ts.listenerMutex.RUnlock()
+	if len(ts.listeners) == 0 {
+		return
+	}
+	event := TaskEvent{Type: eventType, Time: time.Now(), Task: *task}
+	for _, queue := range ts.listeners {
+		queue.enqueue(event)
+	}
+}
+
+// WebhookListener 把任务事件以JSON POST到URL，非2xx响应或请求失败时重试
+type WebhookListener struct {
+	URL           string
+	Events        map[TaskEventType]bool // 只发送这些类型的事件，为空时发送全部
+	Client        *http.Client
+	MaxAttempts   int           // 每个事件最多发送的次数，<=0时为3
+	RetryInterval time.Duration // 第n次重试前等待n个RetryInterval，<=0时为1秒
+}
+
+// NewWebhookListener 创建发送到url的webhook，events为空时发送全部事件
+func NewWebhookListener(url string, events ...TaskEventType) *WebhookListener {
+	webhook := &WebhookListener{
+		URL:    url,
+		Events: make(map[TaskEventType]bool),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, event := range events {
+		webhook.Events[event] = true
+	}
+	return webhook
+}
+
+// OnTaskEvent 发送事件，重试用完后打印错误并丢弃
+func (w *WebhookListener) OnTaskEvent(event TaskEvent) {
+	if len(w.Events) > 0 && !w.Events[event.Type] {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("webhook事件编码失败: %v\n", err)
+		return
+	}
+
+	attempts := w.MaxAttempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	interval := w.RetryInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	for attempt := 1; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return
+		}
+		if attempt >= attempts {
+			break
+		}
+		time.Sleep(time.Duration(attempt) * interval)
+	}
+	fmt.Printf("webhook发送任务 %s 的%s事件失败: %v\n", event.Task.ID, event.Type, err)
+}
+
+// post 发送一次请求
+func (w *WebhookListener) post(body []byte) error {
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collectEvents 注册一个把事件写入通道的监听器
+func collectEvents(scheduler *TaskScheduler) chan TaskEvent {
+	events := make(chan TaskEvent, 100)
+	scheduler.AddListener(TaskListenerFunc(func(event TaskEvent) { events <- event }))
+	return events
+}
+
+// nextEvent 等待下一个事件
+func nextEvent(t *testing.T, events chan TaskEvent) TaskEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("等待任务事件超时")
+		return TaskEvent{}
+	}
+}
+
+func TestListenerReceivesTransitions(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.RegisterHandler("job", func(ctx context.Context, payload []byte) error {
+		if string(payload) == "bad" {
+			return errors.New("处理失败")
+		}
+		return nil
+	})
+	events := collectEvents(scheduler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.RunWorker(ctx, "worker1")
+	go scheduler.Start()
+	defer scheduler.Stop()
+
+	scheduler.SubmitTask(&Task{ID: "ok", ClusterID: "cluster1", Type: "job"})
+	expected := []TaskEventType{EventSubmitted, EventAssigned, EventStarted, EventCompleted}
+	for _, eventType := range expected {
+		event := nextEvent(t, events)
+		if event.Type != eventType || event.Task.ID != "ok" {
+			t.Fatalf("期望任务ok的%s事件，实际为%s %s", eventType, event.Task.ID, event.Type)
+		}
+	}
+
+	scheduler.SubmitTask(&Task{ID: "bad", ClusterID: "cluster1", Type: "job", Payload: []byte("bad")})
+	var last TaskEvent
+	for last.Type != EventFailed {
+		last = nextEvent(t, events)
+	}
+	// 事件携带变化后的完整任务记录
+	if last.Task.ID != "bad" || last.Task.Status != "failed" || last.Task.Error != "处理失败" || last.Task.WorkerID != "worker1" {
+		t.Errorf("失败事件的任务记录不正确: %+v", last.Task)
+	}
+}
+
+func TestListenerRescheduledAndIsolation(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+
+	// 阻塞的监听器不影响调度和其他监听器
+	release := make(chan struct{})
+	scheduler.AddListener(TaskListenerFunc(func(event TaskEvent) { <-release }))
+	defer close(release)
+	events := collectEvents(scheduler)
+
+	scheduler.SubmitTask(&Task{ID: "task1", ClusterID: "cluster1"})
+	scheduler.dispatch()
+	scheduler.workers["worker1"].LastHeartbeat = time.Now().Add(-time.Minute)
+	scheduler.checkHeartbeats()
+
+	var types []TaskEventType
+	for len(types) < 3 {
+		types = append(types, nextEvent(t, events).Type)
+	}
+	if types[0] != EventSubmitted || types[1] != EventAssigned || types[2] != EventRescheduled {
+		t.Errorf("事件顺序不正确: %v", types)
+	}
+}
+
+func TestWebhookListener(t *testing.T) {
+	var mutex sync.Mutex
+	var received []TaskEvent
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		// 第一次请求失败，验证重试
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event TaskEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received = append(received, event)
+	}))
+	defer server.Close()
+
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	webhook := NewWebhookListener(server.URL, EventCompleted, EventFailed)
+	webhook.RetryInterval = 10 * time.Millisecond
+	scheduler.AddListener(webhook)
+
+	scheduler.SubmitTask(&Task{ID: "task1", ClusterID: "cluster1", Queue: "tenant-a"})
+	scheduler.dispatch()
+	scheduler.CompleteTask("task1", true)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mutex.Lock()
+		done := len(received) > 0
+		mutex.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// 只发送订阅的completed事件，失败后重试一次
+	if len(received) != 1 || requests != 2 {
+		t.Fatalf("期望重试后收到1个事件，实际%d个事件、%d次请求", len(received), requests)
+	}
+	event := received[0]
+	if event.Type != EventCompleted || event.Task.ID != "task1" || event.Task.Status != "completed" || event.Task.Queue != "tenant-a" {
+		t.Errorf("webhook收到的事件不正确: %+v", event)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FailoverPolicy 本集群没有空闲节点时的跨集群调度策略
+type FailoverPolicy string
+
+const (
+	FailoverStrict      FailoverPolicy = "strict"       // 只在本集群调度
+	FailoverPreferLocal FailoverPolicy = "prefer-local" // 优先本集群，本集群满时溢出到其他集群（默认）
+	FailoverAny         FailoverPolicy = "any"          // 不区分集群，选择空闲容量最多的集群
+)
+
+// SetReservedCapacity 为集群预留n个任务槽（Capacity为1时即n个节点），其他集群溢出的任务不能占用这部分容量
+func (ts *TaskScheduler) SetReservedCapacity(clusterID string, n int) {
+	ts.workerMutex.Lock()
+	defer ts.workerMutex.Unlock()
+
+	if n <= 0 {
+		delete(ts.reserved, clusterID)
+		return
+	}
+	ts.reserved[clusterID] = n
+	fmt.Printf("集群 %s 预留容量: %d\n", clusterID, n)
+}
+
+// idleWorkers 返回集群内的空闲任务槽，每个槽对应所属的节点，同一节点的槽相邻。
+// 调用方需持有workerMutex
+func (ts *TaskScheduler) idleWorkers(clusterID string) []*Worker {
+	var idle []*Worker
+	for _, workerID := range ts.clusters[clusterID] {
+		worker := ts.workers[workerID]
+		for i := 0; i < freeSlots(worker); i++ {
+			idle = append(idle, worker)
+		}
+	}
+	return idle
+}
+
+// availableFor 返回集群中task可以使用的空闲任务槽，溢出任务不能使用预留容量
+func (ts *TaskScheduler) availableFor(task *Task, clusterID string) []*Worker {
+	idle := ts.idleWorkers(clusterID)
+	if clusterID == task.ClusterID {
+		return idle
+	}
+	spare := len(idle) - ts.reserved[clusterID]
+	if spare <= 0 {
+		return nil
+	}
+	return idle[:spare]
+}
+
+// candidateSlots 返回clusterIDs中task可以使用的空闲任务槽，已排除调度策略不接受的节点。
+// 亲和键已绑定在线节点时只返回该节点的槽。clusterIDs需已排序，调用方需持有workerMutex
+func (ts *TaskScheduler) candidateSlots(task *Task, clusterIDs []string) []*Worker {
+	bound := ts.boundWorker(task)
+	var slots []*Worker
+	for _, clusterID := range clusterIDs {
+		for _, worker := range ts.availableFor(task, clusterID) {
+			if (bound == nil || worker == bound) && ts.accepts(task, worker) {
+				slots = append(slots, worker)
+			}
+		}
+	}
+	return slots
+}
+
+// selectWorker 由调度策略从slots中选择节点
+func (ts *TaskScheduler) selectWorker(task *Task, slots []*Worker) *Worker {
+	if len(slots) == 0 {
+		return nil
+	}
+	return ts.strategy.Select(task, slots)
+}
+
+// findWorker 按任务的跨集群策略确定参与选择的集群，再由调度策略选择工作节点，
+// 集群ID排序保证结果确定。调用方需持有workerMutex
+func (ts *TaskScheduler) findWorker(task *Task) *Worker {
+	local := []string{task.ClusterID}
+	var remote, all []string
+	for clusterID := range ts.clusters {
+		all = append(all, clusterID)
+		if clusterID != task.ClusterID {
+			remote = append(remote, clusterID)
+		}
+	}
+	sort.Strings(remote)
+	sort.Strings(all)
+
+	switch task.Failover {
+	case FailoverStrict:
+		return ts.selectWorker(task, ts.candidateSlots(task, local))
+	case FailoverAny:
+		return ts.selectWorker(task, ts.candidateSlots(task, all))
+	default:
+		if worker := ts.selectWorker(task, ts.candidateSlots(task, local)); worker != nil {
+			return worker
+		}
+		return ts.selectWorker(task, ts.candidateSlots(task, remote))
+	}
+}
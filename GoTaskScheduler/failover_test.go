@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+)
+
+func newFailoverScheduler() *TaskScheduler {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "a1", ClusterID: "clusterA", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "b1", ClusterID: "clusterB", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "b2", ClusterID: "clusterB", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "c1", ClusterID: "clusterC", Status: "idle", Capacity: 1})
+	return scheduler
+}
+
+func TestFailoverStrict(t *testing.T) {
+	scheduler := newFailoverScheduler()
+
+	first := &Task{ID: "task1", ClusterID: "clusterA", Failover: FailoverStrict}
+	second := &Task{ID: "task2", ClusterID: "clusterA", Failover: FailoverStrict}
+
+	if !scheduler.Schedule(first) || first.WorkerID != "a1" {
+		t.Fatalf("期望任务1分配到a1，实际为%s", first.WorkerID)
+	}
+	if scheduler.Schedule(second) {
+		t.Errorf("strict策略不应溢出到其他集群，实际分配到%s", second.WorkerID)
+	}
+}
+
+func TestFailoverPreferLocal(t *testing.T) {
+	scheduler := newFailoverScheduler()
+
+	local := &Task{ID: "task1", ClusterID: "clusterC"}
+	if !scheduler.Schedule(local) || local.WorkerID != "c1" {
+		t.Fatalf("期望优先分配到本集群c1，实际为%s", local.WorkerID)
+	}
+
+	// 本集群已满，溢出到空闲容量最多的clusterB
+	overflow := &Task{ID: "task2", ClusterID: "clusterC", Failover: FailoverPreferLocal}
+	if !scheduler.Schedule(overflow) || overflow.WorkerID != "b1" {
+		t.Errorf("期望溢出到clusterB，实际为%s", overflow.WorkerID)
+	}
+}
+
+func TestFailoverAny(t *testing.T) {
+	scheduler := newFailoverScheduler()
+
+	task := &Task{ID: "task1", ClusterID: "clusterA", Failover: FailoverAny}
+	if !scheduler.Schedule(task) || task.WorkerID != "b1" {
+		t.Errorf("any策略应选择空闲容量最多的集群，实际为%s", task.WorkerID)
+	}
+}
+
+func TestReservedCapacity(t *testing.T) {
+	scheduler := newFailoverScheduler()
+	scheduler.SetReservedCapacity("clusterB", 1)
+
+	first := &Task{ID: "task1", ClusterID: "clusterA"}
+	second := &Task{ID: "task2", ClusterID: "clusterA"}
+	third := &Task{ID: "task3", ClusterID: "clusterA"}
+	for _, task := range []*Task{first, second, third} {
+		scheduler.Schedule(task)
+	}
+	if first.WorkerID != "a1" {
+		t.Errorf("期望任务1分配到a1，实际为%s", first.WorkerID)
+	}
+
+	// clusterB保留1个节点，溢出任务最多占用1个；之后只剩clusterC可用
+	used := map[string]int{}
+	for _, task := range []*Task{second, third} {
+		used[scheduler.workers[task.WorkerID].ClusterID]++
+	}
+	if used["clusterB"] != 1 || used["clusterC"] != 1 {
+		t.Errorf("溢出任务不应占用预留容量，实际分布%v", used)
+	}
+
+	fourth := &Task{ID: "task4", ClusterID: "clusterA"}
+	if scheduler.Schedule(fourth) {
+		t.Errorf("预留容量不应被溢出任务占用，实际分配到%s", fourth.WorkerID)
+	}
+
+	// 本集群任务可以使用预留容量
+	local := &Task{ID: "task5", ClusterID: "clusterB", Failover: FailoverStrict}
+	if !scheduler.Schedule(local) {
+		t.Error("本集群任务应能使用预留容量")
+	}
+
+	stats := scheduler.GetClusterStats()
+	if stats["clusterB"] != 0 {
+		t.Errorf("期望clusterB没有空闲节点，实际有%d个", stats["clusterB"])
+	}
+}
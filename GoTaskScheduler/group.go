@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TaskGroup 需要同时分配的一组任务（gang scheduling），例如分布式训练的各个分片：
+// 只有全部成员都能找到节点时才一起分配，否则整组继续等待
+type TaskGroup struct {
+	ID    string
+	Tasks []*Task
+}
+
+// GroupStatus 任务组的整体状态
+type GroupStatus struct {
+	ID     string
+	Status string         // pending, running, completed, failed, cancelled
+	Counts map[string]int // 任务状态 -> 成员数
+	Tasks  []Task         // 成员任务记录的副本，按提交顺序排列
+}
+
+// SubmitGroup 提交任务组。组内任务共用一个等待队列位置（按第一个成员的优先级和队列排序），
+// 不支持NotBefore。等待队列达到上限时返回ErrQueueFull
+func (ts *TaskScheduler) SubmitGroup(group *TaskGroup) error {
+	if group.ID == "" || len(group.Tasks) == 0 {
+		return fmt.Errorf("任务组需要ID和至少一个任务")
+	}
+	for _, task := range group.Tasks {
+		if !task.NotBefore.IsZero() {
+			return fmt.Errorf("任务组 %s 的任务 %s 设置了NotBefore，任务组不支持延迟调度", group.ID, task.ID)
+		}
+	}
+
+	ts.taskMutex.Lock()
+	defer ts.taskMutex.Unlock()
+	if _, exists := ts.groups[group.ID]; exists {
+		return fmt.Errorf("任务组 %s 已存在", group.ID)
+	}
+	if err := ts.checkBacklog(group.ID); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, task := range group.Tasks {
+		task.GroupID = group.ID
+		task.CreatedAt = now
+		task.Status = "pending"
+		ts.tasks[task.ID] = task
+		ts.persistTask(task)
+		ts.emit(EventSubmitted, task)
+	}
+	ts.groups[group.ID] = group
+	ts.queue.push(group.Tasks[0])
+	fmt.Printf("任务组已提交: %s (%d 个任务)\n", group.ID, len(group.Tasks))
+	return nil
+}
+
+// place 调度队列中取出的一项，返回分配的任务数。检查任务状态、选择节点和分配在同一次加锁内完成，
+// 出队后已被取消或已随任务组分配的任务不会再分配。整组都在等待的任务组成员按整组调度，
+// 成员单独重新调度（所在节点失联）时按普通任务调度
+func (ts *TaskScheduler) place(task *Task) int {
+	ts.taskMutex.Lock()
+	defer ts.taskMutex.Unlock()
+	ts.workerMutex.Lock()
+	defer ts.workerMutex.Unlock()
+	if task.Status != "pending" {
+		return 0
+	}
+	if group := ts.groups[task.GroupID]; group != nil {
+		if members := pendingMembers(group); len(members) == len(group.Tasks) {
+			return ts.scheduleGroup(group, members)
+		}
+	}
+	if ts.scheduleLocked(task) {
+		return 1
+	}
+	return 0
+}
+
+// isPending 任务是否仍在等待调度
+func (ts *TaskScheduler) isPending(task *Task) bool {
+	ts.taskMutex.RLock()
+	defer ts.taskMutex.RUnlock()
+	return task.Status == "pending"
+}
+
+// pendingMembers 返回组内等待中的成员，调用方需持有taskMutex
+func pendingMembers(group *TaskGroup) []*Task {
+	var members []*Task
+	for _, task := range group.Tasks {
+		if task.Status == "pending" {
+			members = append(members, task)
+		}
+	}
+	return members
+}
+
+// scheduleGroup 在一次加锁内为全部成员选择节点：依次为每个成员占用任务槽，
+// 任何成员找不到节点时释放已占用的槽，整组不分配。返回分配的任务数。
+// 调用方需持有taskMutex和workerMutex写锁
+func (ts *TaskScheduler) scheduleGroup(group *TaskGroup, members []*Task) int {
+	planned := make([]*Worker, 0, len(members))
+	for _, member := range members {
+		worker := ts.findWorker(member)
+		if worker == nil {
+			// 在释放之前记录，候选节点的判断包含前面成员占用的槽
+			ts.recordDecision(member, nil, false, ts.explainPlacement(member, nil))
+			for _, w := range planned {
+				releaseSlot(w)
+			}
+			for _, other := range members {
+				if other != member {
+					ts.recordGroupWait(other, group.ID, member.ID)
+				}
+			}
+			return 0
+		}
+		occupySlot(worker)
+		planned = append(planned, worker)
+	}
+
+	for i, member := range members {
+		// 释放为该成员预留的槽后立即分配，其他成员的槽仍被占用
+		releaseSlot(planned[i])
+		candidates := ts.explainPlacement(member, planned[i])
+		placed := ts.assignTask(member, planned[i])
+		ts.recordDecision(member, planned[i], placed, candidates)
+	}
+	fmt.Printf("任务组 %s 的 %d 个任务已同时分配\n", group.ID, len(members))
+	return len(members)
+}
+
+// GetGroupStatus 返回任务组的整体状态：有成员被取消时为cancelled，有成员失败时为failed，
+// 全部完成时为completed，全部等待时为pending，其余为running
+func (ts *TaskScheduler) GetGroupStatus(groupID string) (*GroupStatus, error) {
+	ts.taskMutex.RLock()
+	defer ts.taskMutex.RUnlock()
+	group, exists := ts.groups[groupID]
+	if !exists {
+		return nil, fmt.Errorf("任务组 %s 不存在", groupID)
+	}
+
+	status := &GroupStatus{ID: groupID, Counts: make(map[string]int)}
+	for _, task := range group.Tasks {
+		status.Counts[task.Status]++
+		status.Tasks = append(status.Tasks, *task)
+	}
+	total := len(group.Tasks)
+	switch {
+	case status.Counts["cancelled"] > 0:
+		status.Status = "cancelled"
+	case status.Counts["failed"] > 0:
+		status.Status = "failed"
+	case status.Counts["completed"] == total:
+		status.Status = "completed"
+	case status.Counts["pending"] == total:
+		status.Status = "pending"
+	default:
+		status.Status = "running"
+	}
+	return status, nil
+}
+
+// CancelGroup 取消任务组中所有未结束的任务：等待中的任务移出队列，运行中的任务释放节点，
+// 在本进程RunWorker中执行的处理函数的ctx被取消，之后返回的结果被忽略。返回取消的任务数
+func (ts *TaskScheduler) CancelGroup(groupID string) (int, error) {
+	ts.taskMutex.Lock()
+	defer ts.taskMutex.Unlock()
+	group, exists := ts.groups[groupID]
+	if !exists {
+		return 0, fmt.Errorf("任务组 %s 不存在", groupID)
+	}
+
+	ts.workerMutex.Lock()
+	cancelled := 0
+	for _, task := range group.Tasks {
+		if ts.cancelTask(task) {
+			cancelled++
+		}
+	}
+	ts.workerMutex.Unlock()
+
+	fmt.Printf("任务组 %s 已取消 %d 个任务\n", groupID, cancelled)
+	ts.queue.wake()
+	return cancelled, nil
+}
+
+// cancelTask 取消未结束的任务，已结束的任务不变。调用方需持有taskMutex和workerMutex
+func (ts *TaskScheduler) cancelTask(task *Task) bool {
+	switch task.Status {
+	case "pending", "delayed":
+		ts.queue.remove(task.ID)
+		ts.delayed.remove(task.ID)
+	case "running":
+		if worker, exists := ts.workers[task.WorkerID]; exists {
+			releaseSlot(worker)
+		}
+		delete(ts.inflight[task.WorkerID], task.ID)
+		if cancel, running := ts.cancels[task.ID]; running {
+			cancel()
+		}
+	default:
+		return false
+	}
+	now := time.Now()
+	clusterID := ""
+	if task.Status == "running" {
+		clusterID = ts.clusterOfWorker(task.WorkerID)
+	}
+	task.Status = "cancelled"
+	task.CompletedAt = &now
+	ts.persistTask(task)
+	ts.emit(EventCancelled, task)
+	ts.recordFinished(task, clusterID)
+	return true
+}
+
+// trackCancel 记录运行中任务的取消函数，返回的函数在任务结束时调用。
+// 任务在运行时接手之前已被取消时立即取消
+func (ts *TaskScheduler) trackCancel(task *Task, cancel context.CancelFunc) func() {
+	ts.taskMutex.RLock()
+	ts.workerMutex.Lock()
+	ts.cancels[task.ID] = cancel
+	if task.Status == "cancelled" {
+		cancel()
+	}
+	ts.workerMutex.Unlock()
+	ts.taskMutex.RUnlock()
+	return func() {
+		ts.workerMutex.Lock()
+		delete(ts.cancels, task.ID)
+		ts.workerMutex.Unlock()
+		cancel()
+	}
+}
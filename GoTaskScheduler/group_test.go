@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newGroup 创建n个分片任务组成的任务组
+func newGroup(id string, n int) *TaskGroup {
+	group := &TaskGroup{ID: id}
+	for i := 0; i < n; i++ {
+		group.Tasks = append(group.Tasks, &Task{ID: fmt.Sprintf("%s-shard%d", id, i), ClusterID: "cluster1", Failover: FailoverStrict, Type: "train"})
+	}
+	return group
+}
+
+func TestGroupAllOrNothing(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+
+	if err := scheduler.SubmitGroup(newGroup("job", 3)); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.dispatch()
+	status, _ := scheduler.GetGroupStatus("job")
+	if status.Status != "pending" || status.Counts["pending"] != 3 {
+		t.Fatalf("只有2个任务槽，3个成员的任务组不应部分分配: %+v", status.Counts)
+	}
+	if worker := scheduler.workers["worker1"]; worker.Running != 0 || worker.Status != "idle" {
+		t.Errorf("整组无法分配时应释放预占的任务槽: %+v", worker)
+	}
+	if explain := scheduler.ExplainTask("job-shard0"); !strings.Contains(explain, "整组等待") {
+		t.Errorf("审计应说明整组等待: %s", explain)
+	}
+
+	// 任务组等待时不阻塞普通任务
+	scheduler.SubmitTask(&Task{ID: "single", ClusterID: "cluster1"})
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("single"); task.Status != "running" {
+		t.Fatalf("普通任务应被调度，实际为%s", task.Status)
+	}
+
+	scheduler.CompleteTask("single", true)
+	scheduler.AddWorker(&Worker{ID: "worker3", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.dispatch()
+	status, _ = scheduler.GetGroupStatus("job")
+	if status.Status != "running" || status.Counts["running"] != 3 {
+		t.Fatalf("有3个任务槽时应整组分配: %+v", status.Counts)
+	}
+	for _, task := range status.Tasks {
+		scheduler.CompleteTask(task.ID, true)
+	}
+	if status, _ = scheduler.GetGroupStatus("job"); status.Status != "completed" {
+		t.Errorf("全部完成后任务组应为completed，实际为%s", status.Status)
+	}
+
+	if err := scheduler.SubmitGroup(newGroup("job", 1)); err == nil {
+		t.Error("重复的任务组ID应返回错误")
+	}
+}
+
+func TestGroupCancel(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	started := make(chan struct{}, 2)
+	stopped := make(chan error, 2)
+	scheduler.RegisterHandler("train", func(ctx context.Context, payload []byte) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	})
+	events := collectEvents(scheduler)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.RunWorker(ctx, "worker1")
+
+	scheduler.SubmitGroup(newGroup("running", 2))
+	scheduler.SubmitGroup(newGroup("waiting", 2))
+	scheduler.dispatch()
+	<-started
+	<-started
+
+	// 运行中的成员：取消处理函数的ctx并释放任务槽
+	if n, err := scheduler.CancelGroup("running"); err != nil || n != 2 {
+		t.Fatalf("期望取消2个任务，实际%d个: %v", n, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-stopped; err != context.Canceled {
+			t.Errorf("处理函数应收到取消，实际为%v", err)
+		}
+	}
+	status, _ := scheduler.GetGroupStatus("running")
+	if status.Status != "cancelled" || status.Counts["cancelled"] != 2 {
+		t.Errorf("任务组应为cancelled: %+v", status.Counts)
+	}
+
+	// 等待中的任务组取消后移出等待队列，不会再被调度
+	if n, _ := scheduler.CancelGroup("waiting"); n != 2 {
+		t.Fatalf("期望取消等待中的2个任务，实际%d个", n)
+	}
+	if pending := scheduler.PendingTasks(); len(pending) != 0 {
+		t.Errorf("取消的任务应移出等待队列: %v", pending)
+	}
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("waiting-shard0"); task.Status != "cancelled" {
+		t.Errorf("取消的任务不应被调度，实际为%s", task.Status)
+	}
+	if worker := scheduler.workers["worker1"]; worker.Running != 0 {
+		t.Errorf("取消后应释放任务槽，实际运行中%d个", worker.Running)
+	}
+
+	cancelled := 0
+	for cancelled < 4 {
+		if event := nextEvent(t, events); event.Type == EventCancelled {
+			cancelled++
+		}
+	}
+	if stats := scheduler.GetQueueStats()[DefaultQueue]; stats.Cancelled != 4 {
+		t.Errorf("队列统计应包含取消的任务: %+v", stats)
+	}
+}
+
+func TestRecoverGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	store, _ := NewFileStore(path)
+	scheduler := NewTaskScheduler()
+	scheduler.Recover(store)
+	scheduler.SubmitGroup(newGroup("job", 2))
+
+	store, _ = NewFileStore(path)
+	restarted := NewTaskScheduler()
+	restarted.Recover(store)
+	if pending := restarted.PendingTasks(); len(pending) != 1 || pending[0].ID != "job-shard0" {
+		t.Fatalf("整组等待的任务组只应占一个等待队列位置: %v", pending)
+	}
+
+	restarted.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	restarted.dispatch()
+	if status, _ := restarted.GetGroupStatus("job"); status.Status != "pending" {
+		t.Errorf("恢复后的任务组仍应整组调度，实际为%s", status.Status)
+	}
+	restarted.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	restarted.dispatch()
+	if status, _ := restarted.GetGroupStatus("job"); status.Counts["running"] != 2 {
+		t.Errorf("期望整组分配: %+v", status.Counts)
+	}
+}
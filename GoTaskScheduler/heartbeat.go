@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultHeartbeatTimeout 工作节点超过该时长没有心跳即视为失联
+const DefaultHeartbeatTimeout = 10 * time.Second
+
+// SetHeartbeatTimeout 设置心跳超时，<=0时恢复默认值
+func (ts *TaskScheduler) SetHeartbeatTimeout(timeout time.Duration) {
+	ts.workerMutex.Lock()
+	defer ts.workerMutex.Unlock()
+	if timeout <= 0 {
+		timeout = DefaultHeartbeatTimeout
+	}
+	ts.heartbeatTimeout = timeout
+}
+
+// heartbeatInterval 运行时发送心跳的间隔，超时时长内至少发送三次
+func (ts *TaskScheduler) heartbeatInterval() time.Duration {
+	ts.workerMutex.RLock()
+	defer ts.workerMutex.RUnlock()
+	return ts.heartbeatTimeout / 3
+}
+
+// Heartbeat 记录工作节点的心跳，离线的节点重新上线后恢复为空闲
+func (ts *TaskScheduler) Heartbeat(workerID string) error {
+	ts.workerMutex.Lock()
+	worker, exists := ts.workers[workerID]
+	if !exists {
+		ts.workerMutex.Unlock()
+		return fmt.Errorf("工作节点 %s 不存在", workerID)
+	}
+	worker.LastHeartbeat = time.Now()
+	rejoined := worker.Status == "offline"
+	if rejoined {
+		worker.Status = "idle"
+		ts.persistWorker(worker)
+	}
+	ts.workerMutex.Unlock()
+
+	if rejoined {
+		fmt.Printf("工作节点 %s 重新上线\n", workerID)
+		ts.queue.wake()
+	}
+	return nil
+}
+
+// checkHeartbeats 把心跳超时的节点标记为离线，其上已分配未完成的任务重新进入等待队列，
+// 保留原来的提交时间，重新调度时不会排到后面。返回重新调度的任务数
+func (ts *TaskScheduler) checkHeartbeats() int {
+	// 与CompleteTask相同的加锁顺序
+	ts.taskMutex.Lock()
+	ts.workerMutex.Lock()
+	now := time.Now()
+	var orphaned []*Task
+	for _, worker := range ts.workers {
+		if worker.Status == "offline" || now.Sub(worker.LastHeartbeat) <= ts.heartbeatTimeout {
+			continue
+		}
+		worker.Status = "offline"
+		worker.Running = 0
+		ts.persistWorker(worker)
+		fmt.Printf("工作节点 %s 心跳超时，标记为离线\n", worker.ID)
+		for _, task := range ts.inflight[worker.ID] {
+			task.Status = "pending"
+			task.StartedAt = nil
+			task.WorkerID = ""
+			task.Reschedules++
+			ts.persistTask(task)
+			ts.emit(EventRescheduled, task)
+			orphaned = append(orphaned, task)
+		}
+		delete(ts.inflight, worker.ID)
+		ts.unbindWorker(worker.ID)
+	}
+	ts.workerMutex.Unlock()
+	ts.taskMutex.Unlock()
+
+	// 按提交顺序放回，输出稳定
+	sort.Slice(orphaned, func(i, j int) bool { return readyAt(orphaned[i]).Before(readyAt(orphaned[j])) })
+	for _, task := range orphaned {
+		fmt.Printf("任务 %s 所在节点失联，重新调度\n", task.ID)
+		ts.queue.push(task)
+	}
+	return len(orphaned)
+}
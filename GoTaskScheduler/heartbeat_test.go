@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatTimeoutReschedulesTasks(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+
+	task := &Task{ID: "task1", ClusterID: "cluster1", Priority: 5}
+	scheduler.SubmitTask(task)
+	scheduler.dispatch()
+	if task.WorkerID != "worker1" {
+		t.Fatalf("期望分配到worker1，实际为%s", task.WorkerID)
+	}
+
+	// 心跳未超时时不做处理
+	if n := scheduler.checkHeartbeats(); n != 0 {
+		t.Fatalf("心跳正常时不应重新调度，实际%d个", n)
+	}
+
+	scheduler.workers["worker1"].LastHeartbeat = time.Now().Add(-time.Minute)
+	if n := scheduler.checkHeartbeats(); n != 1 {
+		t.Fatalf("期望重新调度1个任务，实际%d个", n)
+	}
+	if scheduler.workers["worker1"].Status != "offline" {
+		t.Errorf("心跳超时的节点应离线，实际状态%s", scheduler.workers["worker1"].Status)
+	}
+	if task.Status != "pending" || task.WorkerID != "" || task.Reschedules != 1 {
+		t.Errorf("任务应回到等待状态: %+v", task)
+	}
+
+	scheduler.dispatch()
+	if task.Status != "running" || task.WorkerID != "worker2" {
+		t.Errorf("任务应调度到健康的worker2，实际为%s", task.WorkerID)
+	}
+	audit := scheduler.GetSchedulingAudit("task1")
+	if reasons := candidateReasons(audit[len(audit)-1]); reasons["worker1"] != RejectOffline {
+		t.Errorf("离线节点的拒绝原因不正确: %v", reasons)
+	}
+}
+
+func TestHeartbeatRejoinIgnoresStaleResult(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+
+	task := &Task{ID: "task1", ClusterID: "cluster1"}
+	scheduler.SubmitTask(task)
+	scheduler.dispatch()
+	scheduler.workers["worker1"].LastHeartbeat = time.Now().Add(-time.Minute)
+	scheduler.checkHeartbeats()
+	scheduler.dispatch()
+
+	// 失联节点迟到的结果不影响已重新调度的任务
+	scheduler.finishTask("worker1", "task1", nil)
+	if task.Status != "running" || task.WorkerID != "worker2" {
+		t.Errorf("失联节点的结果应被忽略: %+v", task)
+	}
+	if scheduler.workers["worker1"].Status != "offline" {
+		t.Error("迟到的结果不应让离线节点恢复")
+	}
+
+	if err := scheduler.Heartbeat("worker1"); err != nil {
+		t.Fatal(err)
+	}
+	if scheduler.workers["worker1"].Status != "idle" {
+		t.Errorf("重新发送心跳的节点应恢复空闲，实际状态%s", scheduler.workers["worker1"].Status)
+	}
+	if err := scheduler.Heartbeat("none"); err == nil {
+		t.Error("不存在的节点应返回错误")
+	}
+
+	scheduler.finishTask("worker2", "task1", nil)
+	if task.Status != "completed" {
+		t.Errorf("当前节点的结果应完成任务，实际状态%s", task.Status)
+	}
+}
+
+func TestRunWorkerHeartbeatsAndFailover(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.SetHeartbeatTimeout(60 * time.Millisecond)
+	scheduler.AddWorker(&Worker{ID: "dead", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "live", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.RegisterHandler("noop", func(ctx context.Context, payload []byte) error { return nil })
+
+	// 任务先分配到没有运行时、不会发送心跳的节点
+	scheduler.SubmitTask(&Task{ID: "task1", ClusterID: "cluster1", Type: "noop"})
+	scheduler.dispatch()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.RunWorker(ctx, "live")
+	go scheduler.Start()
+	defer scheduler.Stop()
+
+	task := waitForStatus(t, scheduler, "task1", "completed")
+	scheduler.workerMutex.RLock()
+	defer scheduler.workerMutex.RUnlock()
+	if task.WorkerID != "live" || task.Reschedules != 1 {
+		t.Errorf("失联节点的任务应在live上完成: %+v", task)
+	}
+	if scheduler.workers["dead"].Status != "offline" || scheduler.workers["live"].Status != "idle" {
+		t.Errorf("运行时应保持节点在线: dead=%s live=%s", scheduler.workers["dead"].Status, scheduler.workers["live"].Status)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -11,20 +13,35 @@ type Task struct {
 	ID          string
 	Name        string
 	ClusterID   string
-	Status      string // pending, running, completed, failed
+	Status      string // delayed, pending, running, completed, failed, cancelled
 	Priority    int    // 1-10, 越高优先级越大
 	CreatedAt   time.Time
 	StartedAt   *time.Time
 	CompletedAt *time.Time
 	WorkerID    string
+	Failover    FailoverPolicy    // 跨集群调度策略，为空时等同prefer-local
+	Type        string            // 任务类型，对应RegisterHandler注册的处理函数
+	Payload     []byte            // 传给处理函数的参数
+	Timeout     time.Duration     // 处理函数的超时时间，为0时不限
+	Error       string            // 失败原因
+	Reschedules int               // 所在节点失联后被重新调度的次数
+	Labels      map[string]string // 要求的节点标签，AffinityStrategy只分配给标签匹配的节点
+	Queue       string            // 所属队列（租户），为空时为DefaultQueue
+	NotBefore   time.Time         // 最早开始调度的时间，为零值或已过去时立即进入等待队列
+	GroupID     string            // 所属任务组，由SubmitGroup设置
+	AffinityKey string            // 亲和键，相同键的任务分配到同一个节点，节点离线后重新绑定
 }
 
 // Worker 工作节点结构体
 type Worker struct {
 	ID        string
 	ClusterID string
-	Status    string // idle, busy
-	Capacity  int    // 同时处理任务数
+	Status    string // idle（有空闲任务槽）, busy（任务槽已满）, offline
+	Capacity  int    // 同时处理任务数，未设置时为1
+	Running   int    // 正在运行的任务数
+
+	LastHeartbeat time.Time         // 最近一次心跳，添加节点时视为一次心跳
+	Labels        map[string]string // 节点标签，如 {"gpu": "true", "zone": "a"}
 }
 
 // TaskScheduler 任务调度器
@@ -32,20 +49,60 @@ type TaskScheduler struct {
 	tasks       map[string]*Task
 	workers     map[string]*Worker
 	clusters    map[string][]string // clusterID -> workerIDs
-	taskQueue   chan *Task
+	reserved    map[string]int      // clusterID -> 溢出任务不可占用的任务槽数
+	queue       *taskQueue          // 等待调度的任务，按有效优先级排序
+	delayed     *delayQueue         // 还没有到NotBefore的任务
+	maxPending  int                 // 等待中任务数的上限，<=0时不限，受taskMutex保护
 	workerMutex sync.RWMutex
 	taskMutex   sync.RWMutex
 	stopChan    chan bool
+	audit       map[string][]*SchedulingDecision // taskID -> 调度决策记录
+	attempts    map[string]int                   // taskID -> 调度尝试次数
+	auditMutex  sync.Mutex
+
+	handlers     map[string]TaskHandler // 任务类型 -> 处理函数
+	handlerMutex sync.RWMutex
+	runtimes     map[string]*workerRuntime     // workerID -> 本进程中运行的节点，受workerMutex保护
+	inflight     map[string]map[string]*Task   // workerID -> 已分配未完成的任务，受workerMutex保护
+	cancels      map[string]context.CancelFunc // taskID -> 本进程中正在执行的任务的取消函数，受workerMutex保护
+	groups       map[string]*TaskGroup         // groupID -> 任务组，受taskMutex保护
+	sticky       map[string]string             // 亲和键 -> 绑定的workerID，受workerMutex保护
+
+	heartbeatTimeout time.Duration         // 超过该时长没有心跳的节点视为失联
+	strategy         SchedulingStrategy    // 节点选择策略，受workerMutex保护
+	quotas           map[string]QueueQuota // 队列名 -> 配额，受workerMutex保护
+
+	store TaskStore // 持久化存储，为nil时只保存在内存中
+
+	listeners     []*listenerQueue // 任务事件监听器
+	listenerMutex sync.RWMutex
+
+	history *taskHistory // 已结束任务的记录和累计计数
 }
 
 // NewTaskScheduler 创建任务调度器
 func NewTaskScheduler() *TaskScheduler {
 	return &TaskScheduler{
-		tasks:     make(map[string]*Task),
-		workers:   make(map[string]*Worker),
-		clusters:  make(map[string][]string),
-		taskQueue: make(chan *Task, 100),
-		stopChan:  make(chan bool),
+		tasks:    make(map[string]*Task),
+		workers:  make(map[string]*Worker),
+		clusters: make(map[string][]string),
+		reserved: make(map[string]int),
+		queue:    newTaskQueue(),
+		delayed:  &delayQueue{},
+		stopChan: make(chan bool),
+		audit:    make(map[string][]*SchedulingDecision),
+		attempts: make(map[string]int),
+		handlers: make(map[string]TaskHandler),
+		runtimes: make(map[string]*workerRuntime),
+		inflight: make(map[string]map[string]*Task),
+		cancels:  make(map[string]context.CancelFunc),
+		groups:   make(map[string]*TaskGroup),
+		sticky:   make(map[string]string),
+
+		heartbeatTimeout: DefaultHeartbeatTimeout,
+		strategy:         NewFirstIdleStrategy(),
+		quotas:           make(map[string]QueueQuota),
+		history:          newTaskHistory(),
 	}
 }
 
@@ -54,81 +111,106 @@ func (ts *TaskScheduler) AddWorker(worker *Worker) {
 	ts.workerMutex.Lock()
 	defer ts.workerMutex.Unlock()
 
+	worker.LastHeartbeat = time.Now()
 	ts.workers[worker.ID] = worker
 	ts.clusters[worker.ClusterID] = append(ts.clusters[worker.ClusterID], worker.ID)
+	ts.persistWorker(worker)
 	fmt.Printf("添加工作节点: %s (集群: %s)\n", worker.ID, worker.ClusterID)
+	ts.queue.wake()
 }
 
-// SubmitTask 提交任务
-func (ts *TaskScheduler) SubmitTask(task *Task) {
+// SubmitTask 提交任务，任务进入优先级队列等待调度。
+// 设置了未来的NotBefore时任务处于delayed状态，到期后才进入优先级队列。
+// 等待中的任务数达到SetMaxPending的上限时不接受任务，返回ErrQueueFull
+func (ts *TaskScheduler) SubmitTask(task *Task) error {
 	ts.taskMutex.Lock()
-	task.Status = "pending"
+	// 检查和入队都在taskMutex内完成，并发提交也不会超过上限
+	defer ts.taskMutex.Unlock()
+	if err := ts.checkBacklog(task.ID); err != nil {
+		return err
+	}
+
 	task.CreatedAt = time.Now()
+	delayed := isDelayed(task, task.CreatedAt)
+	if delayed {
+		task.Status = "delayed"
+	} else {
+		task.Status = "pending"
+	}
 	ts.tasks[task.ID] = task
-	ts.taskMutex.Unlock()
-
-	select {
-	case ts.taskQueue <- task:
-		fmt.Printf("任务已提交: %s\n", task.ID)
-	default:
-		fmt.Printf("任务队列已满，稍后重试: %s\n", task.ID)
+	ts.persistTask(task)
+	ts.emit(EventSubmitted, task)
+
+	if delayed {
+		ts.delayed.push(task)
+		// 唤醒调度循环，按最早的到期时间重新设置定时器
+		ts.queue.wake()
+		fmt.Printf("任务已提交: %s (优先级 %d，%s 后开始调度)\n", task.ID, task.Priority, task.NotBefore.Format(time.RFC3339))
+		return nil
 	}
+	ts.queue.push(task)
+	fmt.Printf("任务已提交: %s (优先级 %d)\n", task.ID, task.Priority)
+	return nil
 }
 
-// Schedule 调度任务到工作节点
+// Schedule 调度任务到工作节点。选择节点和分配在同时持有taskMutex和workerMutex写锁的一步内完成，
+// 并发调度的任务不会选中同一个空闲任务槽
 func (ts *TaskScheduler) Schedule(task *Task) bool {
-	ts.workerMutex.RLock()
-	defer ts.workerMutex.RUnlock()
-
-	// 优先在本集群内寻找空闲工作节点
-	clusterWorkers := ts.clusters[task.ClusterID]
-	for _, workerID := range clusterWorkers {
-		worker := ts.workers[workerID]
-		if worker.Status == "idle" {
-			return ts.assignTask(task, worker)
-		}
-	}
+	ts.taskMutex.Lock()
+	defer ts.taskMutex.Unlock()
+	ts.workerMutex.Lock()
+	defer ts.workerMutex.Unlock()
+	return ts.scheduleLocked(task)
+}
 
-	// 如果本集群没有空闲节点，在其他集群寻找
-	for clusterID, workerIDs := range ts.clusters {
-		if clusterID == task.ClusterID {
-			continue
-		}
-		for _, workerID := range workerIDs {
-			worker := ts.workers[workerID]
-			if worker.Status == "idle" {
-				return ts.assignTask(task, worker)
-			}
-		}
-	}
+// scheduleLocked 选择节点并分配任务，调用方需持有taskMutex和workerMutex写锁
+func (ts *TaskScheduler) scheduleLocked(task *Task) bool {
+	// 按任务的跨集群策略和调度策略选择节点，溢出任务不会占用其他集群的预留容量
+	worker := ts.findWorker(task)
 
-	return false // 没有找到合适的worker
+	// 在分配前记录每个候选节点的判断，分配会改变节点状态
+	candidates := ts.explainPlacement(task, worker)
+	placed := worker != nil && ts.assignTask(task, worker)
+	ts.recordDecision(task, worker, placed, candidates)
+	return placed
 }
 
-// assignTask 分配任务给工作节点
+// assignTask 分配任务给工作节点，调用方需持有taskMutex和workerMutex写锁：
+// 任务字段受taskMutex保护，节点的任务槽受workerMutex保护，两者在同一步内修改
 func (ts *TaskScheduler) assignTask(task *Task, worker *Worker) bool {
-	ts.workerMutex.RUnlock()
-	ts.workerMutex.Lock()
-	defer ts.workerMutex.Unlock()
-
-	// 双重检查worker状态
-	if worker.Status != "idle" {
+	// 双重检查worker的空闲任务槽
+	if freeSlots(worker) == 0 {
 		return false
 	}
 
 	// 分配任务
-	worker.Status = "busy"
+	occupySlot(worker)
 	now := time.Now()
 	task.Status = "running"
 	task.StartedAt = &now
 	task.WorkerID = worker.ID
 
+	if ts.inflight[worker.ID] == nil {
+		ts.inflight[worker.ID] = make(map[string]*Task)
+	}
+	ts.inflight[worker.ID][task.ID] = task
+	ts.bindAffinity(task, worker)
+	ts.persistTask(task)
+	ts.emit(EventAssigned, task)
+
 	fmt.Printf("任务 %s 已分配给工作节点 %s\n", task.ID, worker.ID)
+	ts.deliver(task, worker)
 	return true
 }
 
 // CompleteTask 完成任务
 func (ts *TaskScheduler) CompleteTask(taskID string, success bool) {
+	ts.completeTask(taskID, "", success, "")
+}
+
+// completeTask 完成任务并记录失败原因。workerID非空时只完成仍在该节点上运行的任务，
+// 节点失联后任务已被重新调度时，原节点迟到的结果被忽略
+func (ts *TaskScheduler) completeTask(taskID, workerID string, success bool, reason string) {
 	ts.taskMutex.Lock()
 	defer ts.taskMutex.Unlock()
 
@@ -136,23 +218,37 @@ func (ts *TaskScheduler) CompleteTask(taskID string, success bool) {
 	if !exists {
 		return
 	}
+	if workerID != "" && (task.Status != "running" || task.WorkerID != workerID) {
+		fmt.Printf("忽略工作节点 %s 上已重新调度或取消的任务结果: %s\n", workerID, taskID)
+		return
+	}
 
 	now := time.Now()
 	task.CompletedAt = &now
 	if success {
 		task.Status = "completed"
+		ts.persistTask(task)
+		ts.emit(EventCompleted, task)
 	} else {
 		task.Status = "failed"
+		task.Error = reason
+		ts.persistTask(task)
+		ts.emit(EventFailed, task)
 	}
 
-	// 释放工作节点
+	// 释放工作节点，已离线的节点保持离线
+	clusterID := ""
 	if task.WorkerID != "" {
 		ts.workerMutex.Lock()
 		if worker, exists := ts.workers[task.WorkerID]; exists {
-			worker.Status = "idle"
+			releaseSlot(worker)
 		}
+		delete(ts.inflight[task.WorkerID], taskID)
+		clusterID = ts.clusterOfWorker(task.WorkerID)
 		ts.workerMutex.Unlock()
+		ts.queue.wake()
 	}
+	ts.recordFinished(task, clusterID)
 
 	status := "成功"
 	if !success {
@@ -161,28 +257,28 @@ func (ts *TaskScheduler) CompleteTask(taskID string, success bool) {
 	fmt.Printf("任务 %s 执行%s\n", taskID, status)
 }
 
-// Start 启动调度器
+// Start 启动调度器。提交任务、添加节点、任务完成或延迟任务到期时立即调度，
+// 否则每隔retryInterval检查节点心跳并重试等待中的任务
 func (ts *TaskScheduler) Start() {
 	fmt.Println("任务调度器已启动")
 
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
 	for {
+		ts.releaseDue(time.Now())
+		ts.dispatch()
+		due, stopTimer := ts.nextDueTimer()
 		select {
-		case task := <-ts.taskQueue:
-			if !ts.Schedule(task) {
-				// 重新放回队列
-				go func() {
-					time.Sleep(1 * time.Second)
-					select {
-					case ts.taskQueue <- task:
-					default:
-						fmt.Printf("任务队列仍满: %s\n", task.ID)
-					}
-				}()
-			}
+		case <-ts.queue.notify:
+		case <-due:
+		case <-ticker.C:
+			ts.checkHeartbeats()
 		case <-ts.stopChan:
+			stopTimer()
 			fmt.Println("任务调度器已停止")
 			return
 		}
+		stopTimer()
 	}
 }
 
@@ -191,14 +287,19 @@ func (ts *TaskScheduler) Stop() {
 	close(ts.stopChan)
 }
 
-// GetTaskStatus 获取任务状态
+// GetTaskStatus 获取任务状态，返回任务记录的副本，任务不存在时返回nil
 func (ts *TaskScheduler) GetTaskStatus(taskID string) *Task {
 	ts.taskMutex.RLock()
 	defer ts.taskMutex.RUnlock()
-	return ts.tasks[taskID]
+	task, exists := ts.tasks[taskID]
+	if !exists {
+		return nil
+	}
+	snapshot := *task
+	return &snapshot
 }
 
-// GetClusterStats 获取集群统计信息
+// GetClusterStats 返回每个集群中还有空闲任务槽的节点数，任务槽的使用率见GetClusterUtilization
 func (ts *TaskScheduler) GetClusterStats() map[string]int {
 	ts.workerMutex.RLock()
 	defer ts.workerMutex.RUnlock()
@@ -209,7 +310,7 @@ func (ts *TaskScheduler) GetClusterStats() map[string]int {
 	}
 
 	for _, worker := range ts.workers {
-		if worker.Status == "idle" {
+		if freeSlots(worker) > 0 {
 			stats[worker.ClusterID]++
 		}
 	}
@@ -225,33 +326,44 @@ func main() {
 	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 1})
 	scheduler.AddWorker(&Worker{ID: "worker3", ClusterID: "cluster2", Status: "idle", Capacity: 1})
 
-	// 启动调度器
+	// 注册任务处理函数，payload为模拟执行的秒数
+	scheduler.RegisterHandler("simulate", func(ctx context.Context, payload []byte) error {
+		seconds, err := strconv.Atoi(string(payload))
+		if err != nil {
+			return err
+		}
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	// 启动调度器和本进程中的工作节点
+	ctx, cancel := context.WithCancel(context.Background())
 	go scheduler.Start()
+	for _, workerID := range []string{"worker1", "worker2", "worker3"} {
+		go scheduler.RunWorker(ctx, workerID)
+	}
 
 	// 提交一些任务
 	tasks := []*Task{
-		{ID: "task1", Name: "数据处理", ClusterID: "cluster1", Priority: 5},
-		{ID: "task2", Name: "文件备份", ClusterID: "cluster2", Priority: 3},
-		{ID: "task3", Name: "日志分析", ClusterID: "cluster1", Priority: 7},
-		{ID: "task4", Name: "系统监控", ClusterID: "cluster2", Priority: 2},
+		{ID: "task1", Name: "数据处理", ClusterID: "cluster1", Priority: 5, Type: "simulate", Payload: []byte("1")},
+		{ID: "task2", Name: "文件备份", ClusterID: "cluster2", Priority: 3, Type: "simulate", Payload: []byte("2")},
+		{ID: "task3", Name: "日志分析", ClusterID: "cluster1", Priority: 7, Type: "simulate", Payload: []byte("1")},
+		{ID: "task4", Name: "系统监控", ClusterID: "cluster2", Priority: 2, Type: "simulate", Payload: []byte("1")},
 	}
 
 	for _, task := range tasks {
-		scheduler.SubmitTask(task)
-	}
-
-	// 模拟任务执行
-	time.Sleep(2 * time.Second)
-
-	for _, task := range tasks {
-		go func(t *Task) {
-			time.Sleep(time.Duration(1+int(time.Now().Unix()%3)) * time.Second)
-			scheduler.CompleteTask(t.ID, true)
-		}(task)
+		if err := scheduler.SubmitTask(task); err != nil {
+			fmt.Println(err)
+		}
 	}
 
-	// 等待任务完成
+	// 等待任务执行完成
 	time.Sleep(5 * time.Second)
+	cancel()
 
 	// 显示统计信息
 	fmt.Println("\n=== 集群统计 ===")
@@ -260,5 +372,9 @@ func main() {
 		fmt.Printf("%s: %d 个空闲工作节点\n", cluster, idleWorkers)
 	}
 
+	// 查看调度决策
+	fmt.Println("\n=== 调度审计 ===")
+	fmt.Println(scheduler.ExplainTask("task3"))
+
 	scheduler.Stop()
 }
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHistoryLimit 默认保留的已结束任务记录数
+const DefaultHistoryLimit = 1000
+
+// TaskRecord 已结束任务的历史记录
+type TaskRecord struct {
+	ID          string
+	Type        string
+	Queue       string
+	ClusterID   string // 实际运行的集群，溢出任务为目标节点所在的集群，没有运行过时为空
+	WorkerID    string
+	GroupID     string
+	Status      string // completed, failed, cancelled
+	Error       string
+	Reschedules int
+	CompletedAt time.Time
+	WaitTime    time.Duration // 从进入等待队列到最后一次分配，没有运行过时为0
+	RunTime     time.Duration // 从最后一次分配到结束，没有运行过时为0
+}
+
+// DurationStats 一组耗时的统计，百分位数按最近排名法计算
+type DurationStats struct {
+	Count int
+	Mean  time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// TypeMetrics 一种任务类型的结束情况
+type TypeMetrics struct {
+	Completed   int
+	Failed      int
+	Cancelled   int
+	FailureRate float64 // Failed / (Completed + Failed)，取消的任务不计入
+	RunTime     DurationStats
+}
+
+// ClusterThroughput 一个集群结束的任务数和吞吐量
+type ClusterThroughput struct {
+	Completed int
+	Failed    int
+	PerMinute float64 // 每分钟结束的任务数（成功和失败）
+}
+
+// SchedulerMetrics 统计窗口内结束的任务的聚合指标
+type SchedulerMetrics struct {
+	Window   time.Duration // 统计窗口，为0时为全部保留的历史记录
+	Finished int
+	WaitTime DurationStats // 运行过的任务在等待队列中的时间
+	RunTime  DurationStats // 运行过的任务的执行时间
+	Types    map[string]TypeMetrics
+	Clusters map[string]ClusterThroughput
+}
+
+// finishKey 累计计数的维度
+type finishKey struct {
+	taskType  string
+	clusterID string
+	status    string
+}
+
+// finishTotals 启动以来的累计值，不受历史记录条数的限制
+type finishTotals struct {
+	count   int
+	waitSum time.Duration
+	runSum  time.Duration
+}
+
+// taskHistory 按结束顺序保留的任务记录和累计计数
+type taskHistory struct {
+	mutex   sync.Mutex
+	limit   int
+	records []TaskRecord
+	totals  map[finishKey]*finishTotals
+}
+
+func newTaskHistory() *taskHistory {
+	return &taskHistory{limit: DefaultHistoryLimit, totals: make(map[finishKey]*finishTotals)}
+}
+
+// add 加入一条记录，超过上限时丢弃最早的记录
+func (h *taskHistory) add(record TaskRecord) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	key := finishKey{record.Type, record.ClusterID, record.Status}
+	totals, exists := h.totals[key]
+	if !exists {
+		totals = &finishTotals{}
+		h.totals[key] = totals
+	}
+	totals.count++
+	totals.waitSum += record.WaitTime
+	totals.runSum += record.RunTime
+
+	h.records = append(h.records, record)
+	h.trim()
+}
+
+// trim 丢弃超过上限的最早记录，调用方需持有mutex
+func (h *taskHistory) trim() {
+	if excess := len(h.records) - h.limit; excess > 0 {
+		h.records = append([]TaskRecord(nil), h.records[excess:]...)
+	}
+}
+
+// since 返回在since之后结束的记录，since为零值时返回全部
+func (h *taskHistory) since(since time.Time) []TaskRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	start := sort.Search(len(h.records), func(i int) bool { return h.records[i].CompletedAt.After(since) })
+	return append([]TaskRecord(nil), h.records[start:]...)
+}
+
+// SetHistoryLimit 设置保留的已结束任务记录数，<=0时不保留记录，只累计计数
+func (ts *TaskScheduler) SetHistoryLimit(limit int) {
+	ts.history.mutex.Lock()
+	defer ts.history.mutex.Unlock()
+	ts.history.limit = max(limit, 0)
+	ts.history.trim()
+}
+
+// recordFinished 记录结束的任务，clusterID为任务实际运行的集群。调用方需持有taskMutex
+func (ts *TaskScheduler) recordFinished(task *Task, clusterID string) {
+	record := TaskRecord{
+		ID:          task.ID,
+		Type:        task.Type,
+		Queue:       queueOf(task),
+		ClusterID:   clusterID,
+		WorkerID:    task.WorkerID,
+		GroupID:     task.GroupID,
+		Status:      task.Status,
+		Error:       task.Error,
+		Reschedules: task.Reschedules,
+	}
+	if task.CompletedAt != nil {
+		record.CompletedAt = *task.CompletedAt
+	}
+	if task.StartedAt != nil {
+		record.WaitTime = max(task.StartedAt.Sub(readyAt(task)), 0)
+		record.RunTime = max(record.CompletedAt.Sub(*task.StartedAt), 0)
+	}
+	ts.history.add(record)
+}
+
+// clusterOfWorker 返回节点所在的集群，节点不存在时返回空。调用方需持有workerMutex
+func (ts *TaskScheduler) clusterOfWorker(workerID string) string {
+	if worker, exists := ts.workers[workerID]; exists {
+		return worker.ClusterID
+	}
+	return ""
+}
+
+// TaskHistory 返回保留的已结束任务记录，最近结束的在前，limit<=0时返回全部
+func (ts *TaskScheduler) TaskHistory(limit int) []TaskRecord {
+	records := ts.history.since(time.Time{})
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	return records
+}
+
+// GetMetrics 统计最近window内结束的任务，window<=0时统计全部保留的历史记录
+func (ts *TaskScheduler) GetMetrics(window time.Duration) SchedulerMetrics {
+	now := time.Now()
+	var records []TaskRecord
+	if window > 0 {
+		records = ts.history.since(now.Add(-window))
+	} else {
+		window = 0
+		records = ts.history.since(time.Time{})
+	}
+
+	metrics := SchedulerMetrics{
+		Window:   window,
+		Finished: len(records),
+		Types:    make(map[string]TypeMetrics),
+		Clusters: make(map[string]ClusterThroughput),
+	}
+	var waits, runs []time.Duration
+	runsByType := make(map[string][]time.Duration)
+	for _, record := range records {
+		types := metrics.Types[record.Type]
+		switch record.Status {
+		case "completed":
+			types.Completed++
+		case "failed":
+			types.Failed++
+		case "cancelled":
+			types.Cancelled++
+		}
+		metrics.Types[record.Type] = types
+
+		if record.ClusterID != "" && record.Status != "cancelled" {
+			cluster := metrics.Clusters[record.ClusterID]
+			if record.Status == "completed" {
+				cluster.Completed++
+			} else {
+				cluster.Failed++
+			}
+			metrics.Clusters[record.ClusterID] = cluster
+		}
+		if record.ClusterID != "" {
+			waits = append(waits, record.WaitTime)
+			runs = append(runs, record.RunTime)
+			runsByType[record.Type] = append(runsByType[record.Type], record.RunTime)
+		}
+	}
+
+	metrics.WaitTime = durationStats(waits)
+	metrics.RunTime = durationStats(runs)
+	for taskType, types := range metrics.Types {
+		if finished := types.Completed + types.Failed; finished > 0 {
+			types.FailureRate = float64(types.Failed) / float64(finished)
+		}
+		types.RunTime = durationStats(runsByType[taskType])
+		metrics.Types[taskType] = types
+	}
+
+	// 没有指定窗口时按最早一条记录到现在的时长计算吞吐量
+	span := window
+	if span == 0 && len(records) > 0 {
+		span = now.Sub(records[0].CompletedAt)
+	}
+	if minutes := span.Minutes(); minutes > 0 {
+		for clusterID, cluster := range metrics.Clusters {
+			cluster.PerMinute = float64(cluster.Completed+cluster.Failed) / minutes
+			metrics.Clusters[clusterID] = cluster
+		}
+	}
+	return metrics
+}
+
+// durationStats 计算一组耗时的统计
+func durationStats(durations []time.Duration) DurationStats {
+	if len(durations) == 0 {
+		return DurationStats{}
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	return DurationStats{
+		Count: len(sorted),
+		Mean:  sum / time.Duration(len(sorted)),
+		P50:   percentile(sorted, 0.5),
+		P90:   percentile(sorted, 0.9),
+		P99:   percentile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile 返回已排序耗时的p分位数（最近排名法）
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// MetricsHandler 返回以Prometheus文本格式输出指标的HTTP处理器，挂在 /metrics 供Prometheus抓取
+func (ts *TaskScheduler) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := ts.WritePrometheus(w); err != nil {
+			fmt.Printf("输出指标失败: %v\n", err)
+		}
+	})
+}
+
+// WritePrometheus 以Prometheus文本格式写出指标：
+//   - 当前各队列各状态的任务数和各集群的任务槽使用情况（gauge）
+//   - 启动以来按任务类型、集群和状态累计的结束任务数（counter）
+//   - 等待时间和按任务类型的执行时间（summary），分位数按保留的历史记录计算，_sum和_count为累计值
+func (ts *TaskScheduler) WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+
+	queues := ts.GetQueueStats()
+	writeHeader(&b, "taskscheduler_tasks", "gauge", "当前各队列各状态的任务数")
+	for _, name := range sortedKeys(queues) {
+		stats := queues[name]
+		for _, s := range []struct {
+			status string
+			count  int
+		}{
+			{"delayed", stats.Delayed}, {"pending", stats.Pending}, {"running", stats.Running},
+			{"completed", stats.Completed}, {"failed", stats.Failed}, {"cancelled", stats.Cancelled},
+		} {
+			writeSample(&b, "taskscheduler_tasks", labels("queue", name, "status", s.status), float64(s.count))
+		}
+	}
+
+	clusters := ts.GetClusterUtilization()
+	writeHeader(&b, "taskscheduler_cluster_slots", "gauge", "在线节点的任务槽总数")
+	for _, id := range sortedKeys(clusters) {
+		writeSample(&b, "taskscheduler_cluster_slots", labels("cluster", id), float64(clusters[id].Capacity))
+	}
+	writeHeader(&b, "taskscheduler_cluster_running", "gauge", "集群中正在运行的任务数")
+	for _, id := range sortedKeys(clusters) {
+		writeSample(&b, "taskscheduler_cluster_running", labels("cluster", id), float64(clusters[id].Running))
+	}
+
+	// 累计值在同一次加锁内读取，同一次输出中的计数和_sum一致
+	ts.history.mutex.Lock()
+	keys := make([]finishKey, 0, len(ts.history.totals))
+	totals := make(map[finishKey]finishTotals, len(ts.history.totals))
+	for key, value := range ts.history.totals {
+		keys = append(keys, key)
+		totals[key] = *value
+	}
+	ts.history.mutex.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.taskType != b.taskType {
+			return a.taskType < b.taskType
+		}
+		if a.clusterID != b.clusterID {
+			return a.clusterID < b.clusterID
+		}
+		return a.status < b.status
+	})
+
+	writeHeader(&b, "taskscheduler_tasks_finished_total", "counter", "启动以来结束的任务数")
+	var waitSum time.Duration
+	waitCount := 0
+	runSum := make(map[string]time.Duration)
+	runCount := make(map[string]int)
+	for _, key := range keys {
+		value := totals[key]
+		writeSample(&b, "taskscheduler_tasks_finished_total",
+			labels("type", key.taskType, "cluster", key.clusterID, "status", key.status), float64(value.count))
+		// 没有运行过的任务（集群为空）不计入耗时
+		if key.clusterID != "" {
+			waitSum += value.waitSum
+			waitCount += value.count
+			runSum[key.taskType] += value.runSum
+			runCount[key.taskType] += value.count
+		}
+	}
+
+	metrics := ts.GetMetrics(0)
+	writeHeader(&b, "taskscheduler_task_wait_seconds", "summary", "任务在等待队列中的时间")
+	writeSummary(&b, "taskscheduler_task_wait_seconds", nil, metrics.WaitTime, waitSum, waitCount)
+	writeHeader(&b, "taskscheduler_task_run_seconds", "summary", "按任务类型的执行时间")
+	for _, taskType := range sortedKeys(runCount) {
+		writeSummary(&b, "taskscheduler_task_run_seconds", []string{"type", taskType},
+			metrics.Types[taskType].RunTime, runSum[taskType], runCount[taskType])
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHeader 写出指标的HELP和TYPE行
+func writeHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample 写出一个样本，labels为已格式化的标签
+func writeSample(b *strings.Builder, name, labels string, value float64) {
+	fmt.Fprintf(b, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// writeSummary 写出summary的分位数、_sum和_count，pairs为额外的标签
+func writeSummary(b *strings.Builder, name string, pairs []string, stats DurationStats, sum time.Duration, count int) {
+	for _, q := range []struct {
+		quantile string
+		value    time.Duration
+	}{{"0.5", stats.P50}, {"0.9", stats.P90}, {"0.99", stats.P99}} {
+		writeSample(b, name, labels(append(append([]string(nil), pairs...), "quantile", q.quantile)...), q.value.Seconds())
+	}
+	writeSample(b, name+"_sum", labels(pairs...), sum.Seconds())
+	writeSample(b, name+"_count", labels(pairs...), float64(count))
+}
+
+// labels 把 name, value, ... 格式化为 {name="value",...}，没有标签时返回空字符串
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+"="+escapeLabel(pairs[i+1]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabel 按Prometheus文本格式转义标签值
+func escapeLabel(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// sortedKeys 返回排序后的map键，输出顺序稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskHistoryRetention(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.SetHistoryLimit(3)
+
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("task%d", i)
+		scheduler.SubmitTask(&Task{ID: id, ClusterID: "cluster1", Type: "job"})
+		scheduler.dispatch()
+		scheduler.CompleteTask(id, i%2 == 0)
+	}
+
+	history := scheduler.TaskHistory(0)
+	if len(history) != 3 || history[0].ID != "task4" || history[2].ID != "task2" {
+		t.Fatalf("应保留最近结束的3条记录，最近的在前: %+v", history)
+	}
+	record := history[1]
+	if record.Status != "failed" || record.ClusterID != "cluster1" || record.WorkerID != "worker1" {
+		t.Errorf("历史记录不正确: %+v", record)
+	}
+	if history := scheduler.TaskHistory(1); len(history) != 1 || history[0].ID != "task4" {
+		t.Errorf("limit应限制返回的记录数: %+v", history)
+	}
+
+	// 超出保留条数的任务仍计入累计计数
+	var out strings.Builder
+	scheduler.WritePrometheus(&out)
+	for _, line := range []string{
+		`taskscheduler_tasks_finished_total{type="job",cluster="cluster1",status="completed"} 3`,
+		`taskscheduler_tasks_finished_total{type="job",cluster="cluster1",status="failed"} 2`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("缺少累计计数 %s:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestMetricsPercentilesAndFailureRate(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	now := time.Now()
+	// 100个运行过的任务，执行时间为1..100秒，每4个失败1个
+	for i := 1; i <= 100; i++ {
+		status, clusterID := "completed", "cluster1"
+		if i%4 == 0 {
+			status = "failed"
+		}
+		if i > 60 {
+			clusterID = "cluster2"
+		}
+		scheduler.history.add(TaskRecord{
+			ID: fmt.Sprintf("task%d", i), Type: "train", ClusterID: clusterID, WorkerID: "worker", Status: status,
+			CompletedAt: now.Add(-time.Duration(100-i) * time.Second),
+			WaitTime:    time.Duration(i) * time.Millisecond, RunTime: time.Duration(i) * time.Second,
+		})
+	}
+	// 没有运行过就被取消的任务不计入耗时和失败率
+	scheduler.history.add(TaskRecord{ID: "cancelled", Type: "train", Status: "cancelled", CompletedAt: now})
+
+	metrics := scheduler.GetMetrics(0)
+	run := metrics.RunTime
+	if run.Count != 100 || run.P50 != 50*time.Second || run.P90 != 90*time.Second || run.P99 != 99*time.Second || run.Max != 100*time.Second {
+		t.Errorf("执行时间分位数不正确: %+v", run)
+	}
+	if metrics.WaitTime.P50 != 50*time.Millisecond || metrics.WaitTime.Mean != 50500*time.Microsecond {
+		t.Errorf("等待时间统计不正确: %+v", metrics.WaitTime)
+	}
+	train := metrics.Types["train"]
+	if train.Completed != 75 || train.Failed != 25 || train.Cancelled != 1 || train.FailureRate != 0.25 {
+		t.Errorf("按类型统计不正确: %+v", train)
+	}
+	if c1, c2 := metrics.Clusters["cluster1"], metrics.Clusters["cluster2"]; c1.Completed+c1.Failed != 60 || c2.Completed+c2.Failed != 40 {
+		t.Errorf("按集群统计不正确: %+v %+v", c1, c2)
+	}
+
+	// 最近10秒内结束的：task91..task100和取消的任务
+	recent := scheduler.GetMetrics(10 * time.Second)
+	if recent.Finished != 11 || recent.RunTime.Count != 10 || recent.RunTime.P50 != 95*time.Second {
+		t.Errorf("统计窗口不正确: finished=%d run=%+v", recent.Finished, recent.RunTime)
+	}
+	if perMinute := recent.Clusters["cluster2"].PerMinute; perMinute != 60 {
+		t.Errorf("10秒内cluster2结束10个任务，吞吐量应为每分钟60个，实际%v", perMinute)
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	scheduler.SubmitTask(&Task{ID: "done", ClusterID: "cluster1", Type: "job", Queue: "tenant-a"})
+	scheduler.SubmitTask(&Task{ID: "running", ClusterID: "cluster1", Type: "job", Queue: "tenant-a"})
+	scheduler.dispatch()
+	scheduler.CompleteTask("done", true)
+
+	server := httptest.NewServer(scheduler.MetricsHandler())
+	defer server.Close()
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type不正确: %s", contentType)
+	}
+
+	text := string(body)
+	for _, line := range []string{
+		"# TYPE taskscheduler_tasks gauge",
+		`taskscheduler_tasks{queue="tenant-a",status="running"} 1`,
+		`taskscheduler_tasks{queue="tenant-a",status="completed"} 1`,
+		`taskscheduler_cluster_slots{cluster="cluster1"} 2`,
+		`taskscheduler_cluster_running{cluster="cluster1"} 1`,
+		"# TYPE taskscheduler_task_wait_seconds summary",
+		`taskscheduler_task_wait_seconds_count 1`,
+		`taskscheduler_task_run_seconds_count{type="job"} 1`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("缺少 %s:\n%s", line, text)
+		}
+	}
+	if !strings.Contains(text, `taskscheduler_task_run_seconds{type="job",quantile="0.99"} `) {
+		t.Errorf("缺少执行时间的分位数:\n%s", text)
+	}
+
+	if got := labels("queue", "a\"b\\c\nd"); got != `{queue="a\"b\\c\nd"}` {
+		t.Errorf("标签值转义不正确: %s", got)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PriorityAgingInterval 任务每等待该时长，有效优先级提高一级，低优先级任务不会一直被插队
+const PriorityAgingInterval = 10 * time.Second
+
+// retryInterval 没有新任务和空闲节点时，等待中的任务重新调度的间隔
+const retryInterval = time.Second
+
+// ErrQueueFull 等待中的任务数达到SetMaxPending设置的上限，SubmitTask拒绝新任务。
+// 调用方可以用errors.Is判断后稍后重试或向上游返回繁忙
+var ErrQueueFull = errors.New("等待队列已满")
+
+// queuedTask 队列中的任务。有效优先级为 Priority + 等待时长/PriorityAgingInterval，
+// 两个任务的先后与当前时间无关，因此按固定的key排序即可：key越小越先调度
+type queuedTask struct {
+	task *Task
+	key  int64  // 进入队列的时间（readyAt）减去Priority个PriorityAgingInterval（纳秒）
+	seq  uint64 // key相同时先提交的先调度
+}
+
+type taskHeap []*queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+func (h taskHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+func (h taskHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*queuedTask)) }
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// taskQueue 按有效优先级排序的等待队列
+type taskQueue struct {
+	mutex  sync.Mutex
+	items  taskHeap
+	seq    uint64
+	taken  int           // popAll取出、还没有requeue的任务数，计入队列长度
+	notify chan struct{} // 有新任务或节点空出时唤醒调度循环
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{notify: make(chan struct{}, 1)}
+}
+
+// push 加入任务并唤醒调度循环
+func (q *taskQueue) push(task *Task) {
+	q.mutex.Lock()
+	q.seq++
+	key := readyAt(task).UnixNano() - int64(task.Priority)*int64(PriorityAgingInterval)
+	heap.Push(&q.items, &queuedTask{task: task, key: key, seq: q.seq})
+	q.mutex.Unlock()
+	q.wake()
+}
+
+// popAll 按有效优先级从高到低取出全部任务
+func (q *taskQueue) popAll() []*queuedTask {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	items := make([]*queuedTask, 0, len(q.items))
+	for len(q.items) > 0 {
+		items = append(items, heap.Pop(&q.items).(*queuedTask))
+	}
+	q.taken = len(items)
+	return items
+}
+
+// requeue 放回未能调度的任务，保留原来的顺序
+func (q *taskQueue) requeue(items []*queuedTask) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.taken = 0
+	for _, item := range items {
+		heap.Push(&q.items, item)
+	}
+}
+
+// snapshot 按调度顺序返回等待中的任务
+func (q *taskQueue) snapshot() []*Task {
+	q.mutex.Lock()
+	items := make(taskHeap, len(q.items))
+	copy(items, q.items)
+	q.mutex.Unlock()
+
+	tasks := make([]*Task, 0, len(items))
+	for len(items) > 0 {
+		tasks = append(tasks, heap.Pop(&items).(*queuedTask).task)
+	}
+	return tasks
+}
+
+// remove 移除任务，任务不在队列中时不做处理
+func (q *taskQueue) remove(taskID string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, item := range q.items {
+		if item.task.ID == taskID {
+			heap.Remove(&q.items, i)
+			return
+		}
+	}
+}
+
+// len 返回队列中的任务数，包括正在调度的任务
+func (q *taskQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.items) + q.taken
+}
+
+// wake 唤醒调度循环，已有未处理的唤醒时不重复发送
+func (q *taskQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 调度等待中的任务。同一队列（租户）内高优先级任务先获得空闲节点，队列之间按公平分享分配；
+// 排在前面的任务无法调度时继续尝试后面的任务，不会因为某个集群没有容量而阻塞其他集群
+func (ts *TaskScheduler) dispatch() {
+	ts.queue.requeue(ts.dispatchFair(ts.queue.popAll()))
+}
+
+// SetMaxPending 设置等待中（pending和delayed）任务数的上限，达到上限后SubmitTask返回ErrQueueFull，
+// <=0时不限。节点失联后重新调度的任务不受限制，已接受的任务不会因此丢失
+func (ts *TaskScheduler) SetMaxPending(n int) {
+	ts.taskMutex.Lock()
+	defer ts.taskMutex.Unlock()
+	ts.maxPending = n
+}
+
+// checkBacklog 等待中的任务数达到上限时返回ErrQueueFull，调用方需持有taskMutex
+func (ts *TaskScheduler) checkBacklog(id string) error {
+	if ts.maxPending <= 0 {
+		return nil
+	}
+	if n := ts.backlog(); n >= ts.maxPending {
+		return fmt.Errorf("%w: 已有 %d 个任务等待调度（上限 %d），拒绝 %s", ErrQueueFull, n, ts.maxPending, id)
+	}
+	return nil
+}
+
+// backlog 返回等待中（pending和delayed）的任务数
+func (ts *TaskScheduler) backlog() int {
+	return ts.queue.len() + ts.delayed.len()
+}
+
+// PendingTasks 返回等待调度的任务，按调度顺序排列
+func (ts *TaskScheduler) PendingTasks() []*Task {
+	return ts.queue.snapshot()
+}
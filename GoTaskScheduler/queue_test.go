@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pendingIDs(scheduler *TaskScheduler) []string {
+	var ids []string
+	for _, task := range scheduler.PendingTasks() {
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
+
+func TestPriorityDispatchOrder(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+
+	scheduler.SubmitTask(&Task{ID: "low", ClusterID: "cluster1", Priority: 2})
+	scheduler.SubmitTask(&Task{ID: "high", ClusterID: "cluster1", Priority: 9})
+	scheduler.SubmitTask(&Task{ID: "mid", ClusterID: "cluster1", Priority: 5})
+	scheduler.SubmitTask(&Task{ID: "mid2", ClusterID: "cluster1", Priority: 5})
+
+	scheduler.dispatch()
+	if status := scheduler.GetTaskStatus("high").Status; status != "running" {
+		t.Fatalf("高优先级任务应最先调度，实际状态%s", status)
+	}
+	if ids := pendingIDs(scheduler); len(ids) != 3 || ids[0] != "mid" || ids[1] != "mid2" || ids[2] != "low" {
+		t.Errorf("等待顺序不正确: %v", ids)
+	}
+
+	// 节点空出后按优先级继续，同优先级先提交的先调度
+	scheduler.CompleteTask("high", true)
+	scheduler.dispatch()
+	if status := scheduler.GetTaskStatus("mid").Status; status != "running" {
+		t.Errorf("期望mid接着运行，实际状态%s", status)
+	}
+	if ids := pendingIDs(scheduler); len(ids) != 2 || ids[0] != "mid2" {
+		t.Errorf("等待顺序不正确: %v", ids)
+	}
+}
+
+func TestPriorityAging(t *testing.T) {
+	queue := newTaskQueue()
+	now := time.Now()
+	// 等待了10个间隔的低优先级任务与刚提交的高优先级任务有效优先级相同，先提交的优先
+	queue.push(&Task{ID: "old-low", Priority: 1, CreatedAt: now.Add(-10 * PriorityAgingInterval)})
+	queue.push(&Task{ID: "new-high", Priority: 10, CreatedAt: now.Add(-time.Second)})
+	queue.push(&Task{ID: "older-low", Priority: 1, CreatedAt: now.Add(-20 * PriorityAgingInterval)})
+	queue.push(&Task{ID: "new-mid", Priority: 5, CreatedAt: now})
+
+	items := queue.popAll()
+	expected := []string{"older-low", "old-low", "new-high", "new-mid"}
+	for i, item := range items {
+		if item.task.ID != expected[i] {
+			t.Errorf("第%d个任务期望%s，实际%s", i, expected[i], item.task.ID)
+		}
+	}
+
+	// 放回后保持原来的顺序
+	queue.requeue(items[1:])
+	if tasks := queue.snapshot(); len(tasks) != 3 || tasks[0].ID != "old-low" || tasks[2].ID != "new-mid" {
+		t.Errorf("放回后的顺序不正确")
+	}
+}
+
+func TestDispatchSkipsBlockedTasks(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+
+	// 高优先级任务所在集群没有节点，不应阻塞其他集群的任务
+	scheduler.SubmitTask(&Task{ID: "blocked", ClusterID: "cluster2", Priority: 10, Failover: FailoverStrict})
+	scheduler.SubmitTask(&Task{ID: "runnable", ClusterID: "cluster1", Priority: 1})
+
+	go scheduler.Start()
+	defer scheduler.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	if status := scheduler.GetTaskStatus("runnable").Status; status != "running" {
+		t.Errorf("低优先级但可调度的任务应运行，实际状态%s", status)
+	}
+	if ids := pendingIDs(scheduler); len(ids) != 1 || ids[0] != "blocked" {
+		t.Errorf("无法调度的任务应留在队列中: %v", ids)
+	}
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.SetMaxPending(2)
+
+	scheduler.SubmitTask(&Task{ID: "task1", ClusterID: "cluster1"})
+	// 延迟任务也计入等待中的任务数
+	scheduler.SubmitTask(&Task{ID: "later", ClusterID: "cluster1", NotBefore: time.Now().Add(time.Hour)})
+	err := scheduler.SubmitTask(&Task{ID: "task2", ClusterID: "cluster1"})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("期望ErrQueueFull，实际为%v", err)
+	}
+	if scheduler.GetTaskStatus("task2") != nil {
+		t.Error("被拒绝的任务不应保存")
+	}
+
+	// task1调度后腾出位置
+	scheduler.dispatch()
+	if err := scheduler.SubmitTask(&Task{ID: "task2", ClusterID: "cluster1"}); err != nil {
+		t.Fatalf("有空位时应接受任务: %v", err)
+	}
+
+	// 节点失联后重新调度的任务不受上限限制，不会丢失
+	scheduler.workers["worker1"].LastHeartbeat = time.Now().Add(-time.Minute)
+	if n := scheduler.checkHeartbeats(); n != 1 {
+		t.Fatalf("期望重新调度1个任务，实际%d个", n)
+	}
+	if ids := pendingIDs(scheduler); len(ids) != 2 || scheduler.backlog() != 3 {
+		t.Errorf("重新调度的任务应回到等待队列: %v", ids)
+	}
+}
+
+func TestConcurrentSubmitRespectsLimit(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.SetMaxPending(10)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	accepted, rejected := 0, 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := scheduler.SubmitTask(&Task{ID: fmt.Sprintf("task%d", i), ClusterID: "cluster1"})
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err == nil {
+				accepted++
+			} else if errors.Is(err, ErrQueueFull) {
+				rejected++
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if accepted != 10 || rejected != 90 || len(scheduler.PendingTasks()) != 10 {
+		t.Errorf("期望接受10个、拒绝90个，实际接受%d个、拒绝%d个", accepted, rejected)
+	}
+
+	// 取消上限后不再拒绝
+	scheduler.SetMaxPending(0)
+	if err := scheduler.SubmitTask(&Task{ID: "extra", ClusterID: "cluster1"}); err != nil {
+		t.Errorf("不限上限时不应拒绝: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import "fmt"
+
+// DefaultQueue 没有指定Queue的任务所属的队列
+const DefaultQueue = "default"
+
+// QueueQuota 队列（租户）的配额
+type QueueQuota struct {
+	MaxRunning int // 同时运行的任务数上限，<=0时不限
+	Weight     int // 公平分享权重，<=0时为1。空闲任务槽优先分给 运行中任务数/Weight 最小的队列
+}
+
+// QueueStats 队列的任务统计
+type QueueStats struct {
+	QueueQuota
+	Delayed   int
+	Pending   int
+	Running   int
+	Completed int
+	Failed    int
+	Cancelled int
+}
+
+// queueOf 返回任务所属的队列
+func queueOf(task *Task) string {
+	if task.Queue == "" {
+		return DefaultQueue
+	}
+	return task.Queue
+}
+
+// weightOf 返回配额实际生效的权重
+func weightOf(quota QueueQuota) int {
+	if quota.Weight <= 0 {
+		return 1
+	}
+	return quota.Weight
+}
+
+// SetQueueQuota 设置队列的并发上限和公平分享权重，运行期间修改立即生效。
+// 调低上限不会中断已在运行的任务，只是在运行数降到上限以下之前不再调度该队列的任务
+func (ts *TaskScheduler) SetQueueQuota(queue string, quota QueueQuota) {
+	ts.workerMutex.Lock()
+	ts.quotas[queue] = quota
+	ts.workerMutex.Unlock()
+	fmt.Printf("队列 %s 配额: 并发上限 %d, 权重 %d\n", queue, quota.MaxRunning, weightOf(quota))
+	ts.queue.wake()
+}
+
+// quotaOf 返回队列的配额，未设置时不限并发、权重为1
+func (ts *TaskScheduler) quotaOf(queue string) QueueQuota {
+	ts.workerMutex.RLock()
+	defer ts.workerMutex.RUnlock()
+	return ts.quotas[queue]
+}
+
+// runningByQueue 统计每个队列正在运行的任务数
+func (ts *TaskScheduler) runningByQueue() map[string]int {
+	ts.workerMutex.RLock()
+	defer ts.workerMutex.RUnlock()
+	running := make(map[string]int)
+	for _, tasks := range ts.inflight {
+		for _, task := range tasks {
+			running[queueOf(task)]++
+		}
+	}
+	return running
+}
+
+// fairQueue dispatch中一个队列剩余的待调度任务
+type fairQueue struct {
+	name  string
+	quota QueueQuota
+	items []*queuedTask
+}
+
+// dispatchFair 按公平分享调度：每次从 运行中任务数/权重 最小的队列取出队首任务尝试调度，
+// 队列内部仍按有效优先级排序。达到并发上限的队列剩余任务全部继续等待。返回未能调度的任务
+func (ts *TaskScheduler) dispatchFair(items []*queuedTask) []*queuedTask {
+	running := ts.runningByQueue()
+	queues := make(map[string]*fairQueue)
+	var order []*fairQueue
+	for _, item := range items {
+		name := queueOf(item.task)
+		q, exists := queues[name]
+		if !exists {
+			q = &fairQueue{name: name, quota: ts.quotaOf(name)}
+			queues[name] = q
+			order = append(order, q)
+		}
+		q.items = append(q.items, item)
+	}
+
+	var waiting []*queuedTask
+	for {
+		// 份额相同时选择最高优先级任务排在更前面的队列
+		var next *fairQueue
+		for _, q := range order {
+			if len(q.items) == 0 {
+				continue
+			}
+			if next == nil || fairLess(q, next, running) {
+				next = q
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		if limit := next.quota.MaxRunning; limit > 0 && running[next.name] >= limit {
+			for _, item := range next.items {
+				ts.recordQuotaWait(item.task, next.name, limit)
+			}
+			waiting = append(waiting, next.items...)
+			next.items = nil
+			continue
+		}
+
+		item := next.items[0]
+		next.items = next.items[1:]
+		if !ts.isPending(item.task) {
+			// 本轮已随任务组一起分配，或已被取消
+			continue
+		}
+		if placed := ts.place(item.task); placed > 0 {
+			running[next.name] += placed
+		} else {
+			waiting = append(waiting, item)
+		}
+	}
+	return waiting
+}
+
+// fairLess a的份额是否小于b，交叉相乘比较 running/weight
+func fairLess(a, b *fairQueue, running map[string]int) bool {
+	return running[a.name]*weightOf(b.quota) < running[b.name]*weightOf(a.quota)
+}
+
+// GetQueueStats 返回每个队列的配额和任务统计，包括设置了配额但还没有任务的队列
+func (ts *TaskScheduler) GetQueueStats() map[string]QueueStats {
+	stats := make(map[string]QueueStats)
+	ts.workerMutex.RLock()
+	for name, quota := range ts.quotas {
+		stats[name] = QueueStats{QueueQuota: quota}
+	}
+	ts.workerMutex.RUnlock()
+
+	ts.taskMutex.RLock()
+	for _, task := range ts.tasks {
+		name := queueOf(task)
+		queue := stats[name]
+		switch task.Status {
+		case "delayed":
+			queue.Delayed++
+		case "pending":
+			queue.Pending++
+		case "running":
+			queue.Running++
+		case "completed":
+			queue.Completed++
+		case "failed":
+			queue.Failed++
+		case "cancelled":
+			queue.Cancelled++
+		}
+		stats[name] = queue
+	}
+	ts.taskMutex.RUnlock()
+	return stats
+}
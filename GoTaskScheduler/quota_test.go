@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// submitQueue 向队列提交n个任务
+func submitQueue(scheduler *TaskScheduler, queue string, n int) {
+	for i := 0; i < n; i++ {
+		scheduler.SubmitTask(&Task{ID: fmt.Sprintf("%s-%d", queue, i), ClusterID: "cluster1", Queue: queue, Priority: 5})
+	}
+}
+
+func TestFairShareAcrossQueues(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 4})
+
+	// 租户a先提交大量任务，租户b后提交的任务仍能分到一半的任务槽
+	submitQueue(scheduler, "a", 1000)
+	submitQueue(scheduler, "b", 5)
+	scheduler.dispatch()
+	if running := scheduler.runningByQueue(); running["a"] != 2 || running["b"] != 2 {
+		t.Fatalf("期望两个队列平分任务槽: %v", running)
+	}
+
+	// 按权重3:1分配
+	weighted := NewTaskScheduler()
+	weighted.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 8})
+	weighted.SetQueueQuota("a", QueueQuota{Weight: 1})
+	weighted.SetQueueQuota("b", QueueQuota{Weight: 3})
+	submitQueue(weighted, "a", 100)
+	submitQueue(weighted, "b", 100)
+	weighted.dispatch()
+	if running := weighted.runningByQueue(); running["a"] != 2 || running["b"] != 6 {
+		t.Errorf("期望按权重1:3分配: %v", running)
+	}
+}
+
+func TestQueueConcurrencyLimit(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 4})
+	scheduler.SetQueueQuota("a", QueueQuota{MaxRunning: 1})
+	submitQueue(scheduler, "a", 3)
+	scheduler.SubmitTask(&Task{ID: "plain", ClusterID: "cluster1"})
+	scheduler.dispatch()
+
+	if running := scheduler.runningByQueue(); running["a"] != 1 || running[DefaultQueue] != 1 {
+		t.Fatalf("队列a最多运行1个任务，默认队列不受影响: %v", running)
+	}
+	if explain := scheduler.ExplainTask("a-1"); !strings.Contains(explain, "并发上限 1") {
+		t.Errorf("审计应说明队列达到并发上限: %s", explain)
+	}
+
+	// 调高上限后立即生效
+	scheduler.SetQueueQuota("a", QueueQuota{MaxRunning: 3})
+	scheduler.dispatch()
+	if running := scheduler.runningByQueue(); running["a"] != 3 {
+		t.Errorf("调高上限后应调度队列a的全部任务: %v", running)
+	}
+
+	// 调低上限不中断运行中的任务，完成任务后也不再调度超出上限的任务
+	scheduler.SetQueueQuota("a", QueueQuota{MaxRunning: 1})
+	scheduler.SubmitTask(&Task{ID: "a-3", ClusterID: "cluster1", Queue: "a"})
+	scheduler.CompleteTask("a-0", true)
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a-3"); task.Status != "pending" {
+		t.Errorf("队列a仍有2个任务运行，超出上限1，a-3应等待，实际为%s", task.Status)
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	scheduler.SetQueueQuota("a", QueueQuota{MaxRunning: 5, Weight: 2})
+	scheduler.SetQueueQuota("empty", QueueQuota{Weight: 4})
+	submitQueue(scheduler, "a", 4)
+	scheduler.SubmitTask(&Task{ID: "plain", ClusterID: "cluster1"})
+	scheduler.dispatch()
+	scheduler.CompleteTask("a-0", true)
+	scheduler.CompleteTask("plain", false)
+
+	stats := scheduler.GetQueueStats()
+	a := stats["a"]
+	if a.MaxRunning != 5 || a.Weight != 2 || a.Pending != 3 || a.Running != 0 || a.Completed != 1 {
+		t.Errorf("队列a的统计不正确: %+v", a)
+	}
+	if plain := stats[DefaultQueue]; plain.Failed != 1 || plain.Pending != 0 {
+		t.Errorf("默认队列的统计不正确: %+v", plain)
+	}
+	if empty, exists := stats["empty"]; !exists || empty.Weight != 4 {
+		t.Errorf("设置了配额的空队列也应出现在统计中: %+v", stats)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TaskHandler 执行一种类型的任务，返回错误时任务记为failed。
+// ctx在任务超时、被取消或工作节点停止时取消，处理函数应及时返回
+type TaskHandler func(ctx context.Context, payload []byte) error
+
+// workerRuntime 在本进程中执行分配给某个工作节点的任务
+type workerRuntime struct {
+	assigned chan *Task
+}
+
+// RegisterHandler 注册任务类型的处理函数，重复注册时覆盖
+func (ts *TaskScheduler) RegisterHandler(taskType string, handler TaskHandler) {
+	ts.handlerMutex.Lock()
+	defer ts.handlerMutex.Unlock()
+	ts.handlers[taskType] = handler
+}
+
+// handlerFor 返回任务类型的处理函数
+func (ts *TaskScheduler) handlerFor(taskType string) (TaskHandler, bool) {
+	ts.handlerMutex.RLock()
+	defer ts.handlerMutex.RUnlock()
+	handler, exists := ts.handlers[taskType]
+	return handler, exists
+}
+
+// RunWorker 在本进程中作为工作节点运行：接收分配给workerID的任务（包括启动前已分配的任务），
+// 调用对应类型的处理函数，并根据返回值自动完成任务。阻塞到ctx取消，返回前等待正在执行的任务结束
+func (ts *TaskScheduler) RunWorker(ctx context.Context, workerID string) error {
+	ts.workerMutex.Lock()
+	worker, exists := ts.workers[workerID]
+	if !exists {
+		ts.workerMutex.Unlock()
+		return fmt.Errorf("工作节点 %s 不存在", workerID)
+	}
+	if _, running := ts.runtimes[workerID]; running {
+		ts.workerMutex.Unlock()
+		return fmt.Errorf("工作节点 %s 已在运行", workerID)
+	}
+	// 节点最多同时被分配Capacity个任务，缓冲区足够时分配不会阻塞
+	runtime := &workerRuntime{assigned: make(chan *Task, capacityOf(worker))}
+	ts.runtimes[workerID] = runtime
+	// 接管运行时启动前已分配给该节点、尚未完成的任务
+	var backlog []*Task
+	for _, task := range ts.inflight[workerID] {
+		backlog = append(backlog, task)
+	}
+	ts.workerMutex.Unlock()
+	fmt.Printf("工作节点 %s 开始执行任务\n", workerID)
+
+	var running sync.WaitGroup
+	defer func() {
+		ts.workerMutex.Lock()
+		delete(ts.runtimes, workerID)
+		ts.workerMutex.Unlock()
+		running.Wait()
+		fmt.Printf("工作节点 %s 停止执行任务\n", workerID)
+	}()
+
+	run := func(task *Task) {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			// 任务被取消时单独取消该任务的ctx
+			taskCtx, cancel := context.WithCancel(ctx)
+			defer ts.trackCancel(task, cancel)()
+			ts.taskMutex.RLock()
+			ts.emit(EventStarted, task)
+			ts.taskMutex.RUnlock()
+			ts.finishTask(workerID, task.ID, ts.execute(taskCtx, task))
+		}()
+	}
+	for _, task := range backlog {
+		run(task)
+	}
+	// 运行时代替节点发送心跳
+	heartbeat := time.NewTicker(ts.heartbeatInterval())
+	defer heartbeat.Stop()
+	for {
+		select {
+		case task := <-runtime.assigned:
+			run(task)
+		case <-heartbeat.C:
+			ts.Heartbeat(workerID)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// execute 调用任务类型的处理函数，处理函数panic时记为失败
+func (ts *TaskScheduler) execute(ctx context.Context, task *Task) (err error) {
+	handler, exists := ts.handlerFor(task.Type)
+	if !exists {
+		return fmt.Errorf("没有任务类型 %q 的处理函数", task.Type)
+	}
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("处理函数panic: %v", r)
+		}
+	}()
+	return handler(ctx, task.Payload)
+}
+
+// deliver 把刚分配的任务交给节点的运行时，节点没有运行时的任务需要调用方手动CompleteTask。
+// 调用方需持有workerMutex写锁
+func (ts *TaskScheduler) deliver(task *Task, worker *Worker) {
+	runtime, exists := ts.runtimes[worker.ID]
+	if !exists {
+		return
+	}
+	select {
+	case runtime.assigned <- task:
+	default:
+		// 分配数不超过Capacity时不会发生
+		fmt.Printf("工作节点 %s 的任务缓冲区已满: %s\n", worker.ID, task.ID)
+	}
+}
+
+// finishTask 根据处理结果完成节点上的任务并记录失败原因
+func (ts *TaskScheduler) finishTask(workerID, taskID string, err error) {
+	if err != nil {
+		fmt.Printf("任务 %s 失败: %v\n", taskID, err)
+		ts.completeTask(taskID, workerID, false, err.Error())
+		return
+	}
+	ts.completeTask(taskID, workerID, true, "")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForStatus 等待任务进入指定状态
+func waitForStatus(t *testing.T, scheduler *TaskScheduler, taskID, status string) *Task {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		scheduler.taskMutex.RLock()
+		task := scheduler.tasks[taskID]
+		current := task.Status
+		scheduler.taskMutex.RUnlock()
+		if current == status {
+			return task
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("等待任务%s进入%s状态超时", taskID, status)
+	return nil
+}
+
+func TestRunWorkerExecutesHandlers(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	payloads := make(chan string, 3)
+	scheduler.RegisterHandler("echo", func(ctx context.Context, payload []byte) error {
+		payloads <- string(payload)
+		if string(payload) == "bad" {
+			return errors.New("处理失败")
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Start()
+	defer scheduler.Stop()
+	go scheduler.RunWorker(ctx, "worker1")
+
+	scheduler.SubmitTask(&Task{ID: "ok", ClusterID: "cluster1", Type: "echo", Payload: []byte("hello")})
+	waitForStatus(t, scheduler, "ok", "completed")
+	if payload := <-payloads; payload != "hello" {
+		t.Errorf("处理函数收到的参数不正确: %s", payload)
+	}
+
+	scheduler.SubmitTask(&Task{ID: "bad", ClusterID: "cluster1", Type: "echo", Payload: []byte("bad")})
+	if task := waitForStatus(t, scheduler, "bad", "failed"); task.Error != "处理失败" {
+		t.Errorf("失败原因不正确: %s", task.Error)
+	}
+
+	scheduler.SubmitTask(&Task{ID: "unknown", ClusterID: "cluster1", Type: "missing"})
+	if task := waitForStatus(t, scheduler, "unknown", "failed"); !strings.Contains(task.Error, "missing") {
+		t.Errorf("没有处理函数时应记录原因: %s", task.Error)
+	}
+	if stats := scheduler.GetClusterStats(); stats["cluster1"] != 1 {
+		t.Errorf("任务结束后节点应空闲，实际空闲%d个", stats["cluster1"])
+	}
+}
+
+func TestRunWorkerTimeoutAndPanic(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.RegisterHandler("slow", func(ctx context.Context, payload []byte) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	scheduler.RegisterHandler("panic", func(ctx context.Context, payload []byte) error {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go scheduler.Start()
+	defer scheduler.Stop()
+	go scheduler.RunWorker(ctx, "worker1")
+
+	scheduler.SubmitTask(&Task{ID: "slow", ClusterID: "cluster1", Type: "slow", Timeout: 20 * time.Millisecond})
+	if task := waitForStatus(t, scheduler, "slow", "failed"); !strings.Contains(task.Error, "deadline") {
+		t.Errorf("超时的任务应记为失败: %s", task.Error)
+	}
+
+	scheduler.SubmitTask(&Task{ID: "panic", ClusterID: "cluster1", Type: "panic"})
+	if task := waitForStatus(t, scheduler, "panic", "failed"); !strings.Contains(task.Error, "boom") {
+		t.Errorf("panic的任务应记为失败: %s", task.Error)
+	}
+}
+
+func TestRunWorkerTakesOverAndStops(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	started := make(chan struct{})
+	scheduler.RegisterHandler("wait", func(ctx context.Context, payload []byte) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	// 运行时启动前已分配的任务由运行时接管
+	task := &Task{ID: "early", ClusterID: "cluster1", Type: "wait"}
+	scheduler.SubmitTask(task)
+	scheduler.dispatch()
+	if task.Status != "running" {
+		t.Fatalf("任务应已分配，实际状态%s", task.Status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- scheduler.RunWorker(ctx, "worker1") }()
+	<-started
+	if err := scheduler.RunWorker(ctx, "worker1"); err == nil {
+		t.Error("同一节点不能重复运行")
+	}
+	if err := scheduler.RunWorker(ctx, "none"); err == nil {
+		t.Error("不存在的节点应返回错误")
+	}
+
+	// 停止节点时取消正在执行的任务，等待其返回
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if status := scheduler.GetTaskStatus("early").Status; status != "failed" {
+		t.Errorf("节点停止时正在执行的任务应失败，实际状态%s", status)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// boundWorker 返回任务的亲和键当前绑定的在线节点，没有亲和键、没有绑定或绑定的节点已离线时返回nil。
+// 调用方需持有workerMutex
+func (ts *TaskScheduler) boundWorker(task *Task) *Worker {
+	if task.AffinityKey == "" {
+		return nil
+	}
+	worker, exists := ts.workers[ts.sticky[task.AffinityKey]]
+	if !exists || worker.Status == "offline" {
+		return nil
+	}
+	return worker
+}
+
+// bindAffinity 把任务的亲和键绑定到分配的节点，已绑定到该节点时不变。调用方需持有workerMutex写锁
+func (ts *TaskScheduler) bindAffinity(task *Task, worker *Worker) {
+	if task.AffinityKey == "" {
+		return
+	}
+	previous, bound := ts.sticky[task.AffinityKey]
+	if previous == worker.ID {
+		return
+	}
+	ts.sticky[task.AffinityKey] = worker.ID
+	if bound {
+		fmt.Printf("亲和键 %s 从工作节点 %s 迁移到 %s\n", task.AffinityKey, previous, worker.ID)
+	} else {
+		fmt.Printf("亲和键 %s 绑定到工作节点 %s\n", task.AffinityKey, worker.ID)
+	}
+}
+
+// unbindWorker 解除绑定在节点上的亲和键，这些键的下一个任务重新选择节点并绑定。
+// 调用方需持有workerMutex写锁
+func (ts *TaskScheduler) unbindWorker(workerID string) {
+	for key, boundID := range ts.sticky {
+		if boundID == workerID {
+			delete(ts.sticky, key)
+			fmt.Printf("亲和键 %s 所在的工作节点 %s 已离线，解除绑定\n", key, workerID)
+		}
+	}
+}
+
+// StickyBindings 返回亲和键到工作节点的绑定
+func (ts *TaskScheduler) StickyBindings() map[string]string {
+	ts.workerMutex.RLock()
+	defer ts.workerMutex.RUnlock()
+	bindings := make(map[string]string, len(ts.sticky))
+	for key, workerID := range ts.sticky {
+		bindings[key] = workerID
+	}
+	return bindings
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStickyKeyRoutesToSameWorker(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.SetStrategy(NewRoundRobinStrategy())
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+
+	// 轮询策略本会交替分配，相同亲和键的任务都落在第一次分配的节点上
+	scheduler.SubmitTask(&Task{ID: "a1", ClusterID: "cluster1", AffinityKey: "user-a"})
+	scheduler.SubmitTask(&Task{ID: "other", ClusterID: "cluster1"})
+	scheduler.SubmitTask(&Task{ID: "a2", ClusterID: "cluster1", AffinityKey: "user-a"})
+	scheduler.dispatch()
+	a1, a2 := scheduler.GetTaskStatus("a1"), scheduler.GetTaskStatus("a2")
+	if a1.WorkerID == "" || a2.WorkerID != a1.WorkerID {
+		t.Fatalf("相同亲和键的任务应分配到同一节点: a1=%s a2=%s", a1.WorkerID, a2.WorkerID)
+	}
+	if bindings := scheduler.StickyBindings(); bindings["user-a"] != a1.WorkerID {
+		t.Errorf("亲和键应绑定到 %s: %v", a1.WorkerID, bindings)
+	}
+
+	// 绑定的节点没有空闲任务槽时等待，不会分配到其他节点
+	scheduler.SubmitTask(&Task{ID: "a3", ClusterID: "cluster1", AffinityKey: "user-a"})
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a3"); task.Status != "pending" {
+		t.Fatalf("绑定的节点已满时任务应等待，实际分配到 %s", task.WorkerID)
+	}
+	if explain := scheduler.ExplainTask("a3"); !strings.Contains(explain, RejectSticky) || !strings.Contains(explain, "user-a") {
+		t.Errorf("审计应说明亲和键绑定在其他节点:\n%s", explain)
+	}
+
+	scheduler.CompleteTask("a1", true)
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a3"); task.Status != "running" || task.WorkerID != a1.WorkerID {
+		t.Errorf("绑定的节点有空闲任务槽后应分配到该节点: %s %s", task.Status, task.WorkerID)
+	}
+}
+
+func TestStickyRebalanceOnWorkerLoss(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+
+	scheduler.SubmitTask(&Task{ID: "a1", ClusterID: "cluster1", AffinityKey: "user-a"})
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a1"); task.WorkerID != "worker1" {
+		t.Fatalf("期望分配到worker1，实际为%s", task.WorkerID)
+	}
+
+	// worker1失联：解除绑定，重新调度的任务和之后的任务绑定到新节点
+	scheduler.workers["worker1"].LastHeartbeat = time.Now().Add(-time.Minute)
+	scheduler.checkHeartbeats()
+	if _, bound := scheduler.StickyBindings()["user-a"]; bound {
+		t.Fatal("节点离线后应解除亲和键的绑定")
+	}
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a1"); task.Status != "running" || task.WorkerID != "worker2" {
+		t.Fatalf("重新调度的任务应分配到worker2: %s %s", task.Status, task.WorkerID)
+	}
+
+	// 原节点重新上线后亲和键仍留在新节点上，不来回迁移
+	scheduler.Heartbeat("worker1")
+	scheduler.SubmitTask(&Task{ID: "a2", ClusterID: "cluster1", AffinityKey: "user-a"})
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a2"); task.WorkerID != "worker2" {
+		t.Errorf("亲和键应保持绑定在worker2，实际分配到%s", task.WorkerID)
+	}
+	if bindings := scheduler.StickyBindings(); bindings["user-a"] != "worker2" {
+		t.Errorf("绑定不正确: %v", bindings)
+	}
+}
+
+func TestRecoverStickyBindings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	store, _ := NewFileStore(path)
+	scheduler := NewTaskScheduler()
+	scheduler.Recover(store)
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	scheduler.SubmitTask(&Task{ID: "fill", ClusterID: "cluster1"})
+	scheduler.SubmitTask(&Task{ID: "fill2", ClusterID: "cluster1"})
+	scheduler.SubmitTask(&Task{ID: "a1", ClusterID: "cluster1", AffinityKey: "user-a"})
+	scheduler.dispatch()
+	if task := scheduler.GetTaskStatus("a1"); task.WorkerID != "worker2" {
+		t.Fatalf("期望分配到worker2，实际为%s", task.WorkerID)
+	}
+
+	store, _ = NewFileStore(path)
+	restarted := NewTaskScheduler()
+	restarted.Recover(store)
+	if bindings := restarted.StickyBindings(); bindings["user-a"] != "worker2" {
+		t.Fatalf("重启后应按运行中的任务恢复绑定: %v", bindings)
+	}
+	restarted.CompleteTask("fill", true)
+	restarted.SubmitTask(&Task{ID: "a2", ClusterID: "cluster1", AffinityKey: "user-a"})
+	restarted.dispatch()
+	if task := restarted.GetTaskStatus("a2"); task.WorkerID != "worker2" {
+		t.Errorf("重启后相同亲和键的任务应分配到worker2，实际为%s", task.WorkerID)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TaskStore 持久化任务（包括分配到的节点）和工作节点注册信息。调度器在状态变化时写入，
+// 重启后通过Recover恢复。Save方法在调度器持有锁时调用，实现需在返回前复制参数，
+// 不能保留指针。可以基于BoltDB、SQL等实现，本包提供基于JSON文件的FileStore
+type TaskStore interface {
+	SaveTask(task *Task) error
+	SaveWorker(worker *Worker) error
+	// Load 按首次保存的顺序返回全部任务和工作节点
+	Load() ([]*Task, []*Worker, error)
+}
+
+// storeFile FileStore的文件格式，按首次保存的顺序排列
+type storeFile struct {
+	Tasks   []json.RawMessage `json:"tasks"`
+	Workers []json.RawMessage `json:"workers"`
+}
+
+// FileStore 把任务和工作节点保存到一个JSON文件，每次写入都先写临时文件再改名，
+// 进程中途退出不会留下损坏的文件。适合任务量不大的单机部署
+type FileStore struct {
+	path    string
+	mutex   sync.Mutex
+	data    storeFile
+	tasks   map[string]int // taskID -> data.Tasks中的下标
+	workers map[string]int // workerID -> data.Workers中的下标
+}
+
+// NewFileStore 打开path处的存储文件，文件不存在时在第一次写入时创建
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{path: path, tasks: make(map[string]int), workers: make(map[string]int)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.data); err != nil {
+		return nil, fmt.Errorf("解析存储文件 %s 失败: %v", path, err)
+	}
+	for i, raw := range store.data.Tasks {
+		var entry struct{ ID string }
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("解析存储文件 %s 失败: %v", path, err)
+		}
+		store.tasks[entry.ID] = i
+	}
+	for i, raw := range store.data.Workers {
+		var entry struct{ ID string }
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			return nil, fmt.Errorf("解析存储文件 %s 失败: %v", path, err)
+		}
+		store.workers[entry.ID] = i
+	}
+	return store, nil
+}
+
+// SaveTask 保存任务的当前状态
+func (s *FileStore) SaveTask(task *Task) error {
+	raw, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Tasks = upsert(s.data.Tasks, s.tasks, task.ID, raw)
+	return s.flush()
+}
+
+// SaveWorker 保存工作节点的注册信息
+func (s *FileStore) SaveWorker(worker *Worker) error {
+	raw, err := json.Marshal(worker)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Workers = upsert(s.data.Workers, s.workers, worker.ID, raw)
+	return s.flush()
+}
+
+// Load 返回文件中保存的任务和工作节点
+func (s *FileStore) Load() ([]*Task, []*Worker, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tasks := make([]*Task, 0, len(s.data.Tasks))
+	for _, raw := range s.data.Tasks {
+		task := &Task{}
+		if err := json.Unmarshal(raw, task); err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	workers := make([]*Worker, 0, len(s.data.Workers))
+	for _, raw := range s.data.Workers {
+		worker := &Worker{}
+		if err := json.Unmarshal(raw, worker); err != nil {
+			return nil, nil, err
+		}
+		workers = append(workers, worker)
+	}
+	return tasks, workers, nil
+}
+
+// upsert 替换id对应的记录，不存在时追加到末尾
+func upsert(entries []json.RawMessage, index map[string]int, id string, raw json.RawMessage) []json.RawMessage {
+	if i, exists := index[id]; exists {
+		entries[i] = raw
+		return entries
+	}
+	index[id] = len(entries)
+	return append(entries, raw)
+}
+
+// flush 写入临时文件后改名，调用方需持有mutex
+func (s *FileStore) flush() error {
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// persistTask 保存任务状态，写入失败只打印错误，不影响调度
+func (ts *TaskScheduler) persistTask(task *Task) {
+	if ts.store == nil {
+		return
+	}
+	if err := ts.store.SaveTask(task); err != nil {
+		fmt.Printf("保存任务 %s 失败: %v\n", task.ID, err)
+	}
+}
+
+// persistWorker 保存工作节点，写入失败只打印错误，不影响调度
+func (ts *TaskScheduler) persistWorker(worker *Worker) {
+	if ts.store == nil {
+		return
+	}
+	if err := ts.store.SaveWorker(worker); err != nil {
+		fmt.Printf("保存工作节点 %s 失败: %v\n", worker.ID, err)
+	}
+}
+
+// Recover 使用store持久化调度器的状态，并恢复上次运行保存的工作节点和任务，
+// 应在Start、AddWorker和SubmitTask之前调用。返回恢复的未完成任务数：
+//   - 工作节点重新注册，离线的保持离线，其余视为刚收到心跳；没有重新连上的节点在心跳超时后离线
+//   - pending的任务按原来的提交时间和优先级重新进入等待队列，delayed的任务等到NotBefore后再进入
+//   - running的任务仍分配在原节点上，由节点的RunWorker接管或在节点失联后重新调度；
+//     原节点已离线或不存在时回到pending；亲和键按仍在运行的任务所在的节点重新绑定
+//   - completed、failed和cancelled的任务只恢复状态，供GetTaskStatus查询，并按结束时间放回任务历史
+//   - 任务组按成员的GroupID重建，整组都在等待的任务组仍整组调度
+func (ts *TaskScheduler) Recover(store TaskStore) (int, error) {
+	tasks, workers, err := store.Load()
+	if err != nil {
+		return 0, fmt.Errorf("加载持久化状态失败: %v", err)
+	}
+
+	ts.taskMutex.Lock()
+	ts.workerMutex.Lock()
+	ts.store = store
+	now := time.Now()
+	for _, worker := range workers {
+		if _, exists := ts.workers[worker.ID]; !exists {
+			ts.clusters[worker.ClusterID] = append(ts.clusters[worker.ClusterID], worker.ID)
+		}
+		worker.Running = 0
+		if worker.Status != "offline" {
+			worker.Status = "idle"
+		}
+		worker.LastHeartbeat = now
+		ts.workers[worker.ID] = worker
+	}
+
+	var pending, finished []*Task
+	unfinished := 0
+	for _, task := range tasks {
+		ts.tasks[task.ID] = task
+		if task.GroupID != "" {
+			group, exists := ts.groups[task.GroupID]
+			if !exists {
+				group = &TaskGroup{ID: task.GroupID}
+				ts.groups[task.GroupID] = group
+			}
+			group.Tasks = append(group.Tasks, task)
+		}
+		switch task.Status {
+		case "running":
+			worker, exists := ts.workers[task.WorkerID]
+			if exists && worker.Status != "offline" {
+				occupySlot(worker)
+				if ts.inflight[worker.ID] == nil {
+					ts.inflight[worker.ID] = make(map[string]*Task)
+				}
+				ts.inflight[worker.ID][task.ID] = task
+				if task.AffinityKey != "" {
+					ts.sticky[task.AffinityKey] = worker.ID
+				}
+				unfinished++
+				continue
+			}
+			task.Status = "pending"
+			task.StartedAt = nil
+			task.WorkerID = ""
+			task.Reschedules++
+			ts.persistTask(task)
+			ts.emit(EventRescheduled, task)
+			pending = append(pending, task)
+		case "pending":
+			pending = append(pending, task)
+		case "delayed":
+			// 到期时间不变，重启期间已到期的在调度循环开始时进入等待队列
+			ts.delayed.push(task)
+			unfinished++
+		case "completed", "failed", "cancelled":
+			finished = append(finished, task)
+		}
+	}
+	// 历史记录按结束顺序保存
+	sort.Slice(finished, func(i, j int) bool { return finished[i].CompletedAt.Before(*finished[j].CompletedAt) })
+	for _, task := range finished {
+		clusterID := ""
+		if task.StartedAt != nil {
+			clusterID = ts.clusterOfWorker(task.WorkerID)
+		}
+		ts.recordFinished(task, clusterID)
+	}
+	ts.workerMutex.Unlock()
+	ts.taskMutex.Unlock()
+
+	// 按进入队列的顺序放回，输出稳定
+	sort.Slice(pending, func(i, j int) bool { return readyAt(pending[i]).Before(readyAt(pending[j])) })
+	for _, task := range pending {
+		// 整组都在等待的任务组只放回第一个成员，调度时整组分配
+		if group := ts.groups[task.GroupID]; group != nil && task != group.Tasks[0] &&
+			len(pendingMembers(group)) == len(group.Tasks) {
+			continue
+		}
+		ts.queue.push(task)
+	}
+	unfinished += len(pending)
+	fmt.Printf("已恢复 %d 个工作节点、%d 个任务，其中 %d 个未完成\n", len(workers), len(tasks), unfinished)
+	return unfinished, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := &Task{ID: "task1", ClusterID: "cluster1", Status: "pending", Priority: 3, Type: "simulate", Payload: []byte("1"), Timeout: time.Second}
+	store.SaveTask(task)
+	store.SaveWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	store.SaveWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	// 保存后修改不影响已保存的内容，再次保存同一ID时替换原记录
+	task.Status = "running"
+	task.WorkerID = "worker1"
+	store.SaveTask(task)
+	task.Status = "completed"
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, workers, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Status != "running" || tasks[0].WorkerID != "worker1" {
+		t.Fatalf("任务的保存状态不正确: %+v", tasks)
+	}
+	if string(tasks[0].Payload) != "1" || tasks[0].Timeout != time.Second || tasks[0].Priority != 3 {
+		t.Errorf("任务字段没有完整保存: %+v", tasks[0])
+	}
+	if len(workers) != 2 || workers[0].ID != "worker2" || workers[1].ID != "worker1" || workers[0].Capacity != 2 {
+		t.Errorf("工作节点应按注册顺序保存: %+v", workers)
+	}
+}
+
+func TestRecoverRestoresBacklog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	store, _ := NewFileStore(path)
+	scheduler := NewTaskScheduler()
+	scheduler.Recover(store)
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	for _, id := range []string{"task1", "task2", "task3"} {
+		scheduler.SubmitTask(&Task{ID: id, ClusterID: "cluster1", Priority: 5})
+	}
+	scheduler.SubmitTask(&Task{ID: "task4", ClusterID: "cluster1", Priority: 9})
+	scheduler.dispatch()
+	scheduler.CompleteTask("task4", true)
+	scheduler.dispatch()
+
+	// 模拟重启：新的调度器从同一个文件恢复
+	store, _ = NewFileStore(path)
+	restarted := NewTaskScheduler()
+	unfinished, err := restarted.Recover(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unfinished != 3 {
+		t.Fatalf("期望恢复3个未完成任务，实际%d个", unfinished)
+	}
+	if task := restarted.GetTaskStatus("task4"); task.Status != "completed" {
+		t.Errorf("已完成的任务应保留状态，实际为%s", task.Status)
+	}
+	running := restarted.GetTaskStatus("task1")
+	worker := restarted.workers["worker1"]
+	if running.Status != "running" || running.WorkerID != "worker1" || worker.Running != 1 || worker.Status != "busy" {
+		t.Errorf("运行中的任务应保留在原节点上: %+v %+v", running, worker)
+	}
+	pending := restarted.PendingTasks()
+	if len(pending) != 2 || pending[0].ID != "task2" || pending[1].ID != "task3" {
+		t.Fatalf("等待中的任务应按原顺序恢复: %v", pending)
+	}
+
+	// 恢复后的调度器继续写入同一个存储
+	restarted.CompleteTask("task1", true)
+	restarted.dispatch()
+	if task := restarted.GetTaskStatus("task2"); task.Status != "running" {
+		t.Errorf("空出节点后应调度task2，实际状态%s", task.Status)
+	}
+	store, _ = NewFileStore(path)
+	tasks, _, _ := store.Load()
+	for _, task := range tasks {
+		if task.ID == "task1" && task.Status != "completed" {
+			t.Errorf("恢复后的状态变化应持久化，task1为%s", task.Status)
+		}
+	}
+}
+
+func TestRecoverRunningTasks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	store, _ := NewFileStore(path)
+	scheduler := NewTaskScheduler()
+	scheduler.Recover(store)
+	scheduler.AddWorker(&Worker{ID: "worker1", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "worker2", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "worker3", ClusterID: "cluster1", Status: "idle", Capacity: 1})
+	for _, id := range []string{"task1", "task2", "task3"} {
+		scheduler.SubmitTask(&Task{ID: id, ClusterID: "cluster1", Type: "echo"})
+		scheduler.dispatch()
+	}
+	// worker3在重启前已失联
+	scheduler.workers["worker3"].LastHeartbeat = time.Now().Add(-time.Minute)
+	scheduler.checkHeartbeats()
+	scheduler.CompleteTask("task1", true)
+	scheduler.dispatch()
+
+	store, _ = NewFileStore(path)
+	restarted := NewTaskScheduler()
+	restarted.Recover(store)
+	restarted.RegisterHandler("echo", func(ctx context.Context, payload []byte) error { return nil })
+	if task := restarted.GetTaskStatus("task3"); task.Status != "running" || task.WorkerID != "worker1" || task.Reschedules != 1 {
+		t.Fatalf("失联节点上的任务应已重新调度到worker1: %+v", task)
+	}
+	if worker := restarted.workers["worker3"]; worker.Status != "offline" {
+		t.Errorf("离线的节点恢复后应保持离线，实际为%s", worker.Status)
+	}
+
+	// worker1重新连上后接管恢复的任务
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go restarted.RunWorker(ctx, "worker1")
+	waitForStatus(t, restarted, "task3", "completed")
+
+	// 没有重新连上的节点心跳超时后，其任务重新调度到其他节点
+	restarted.workers["worker2"].LastHeartbeat = time.Now().Add(-time.Minute)
+	if n := restarted.checkHeartbeats(); n != 1 {
+		t.Fatalf("期望重新调度worker2上的1个任务，实际%d个", n)
+	}
+	restarted.dispatch()
+	if task := waitForStatus(t, restarted, "task2", "completed"); task.WorkerID != "worker1" {
+		t.Errorf("task2应在worker1上完成，实际为%s", task.WorkerID)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+// SchedulingStrategy 在任务可以使用的空闲任务槽中选择工作节点。跨集群策略（FailoverPolicy）
+// 先决定哪些集群参与选择，再由调度策略从中选出节点。Select在调度器持有workerMutex时调用，
+// 同一时刻只有一次调用，有状态的实现不需要额外加锁
+type SchedulingStrategy interface {
+	// Name 策略名称，记录在调度审计中
+	Name() string
+	// Select 从slots中选择节点。slots非空，每个空闲任务槽出现一次，按集群ID排序，
+	// 同一集群内按节点注册顺序排列，同一节点的槽相邻。返回nil表示不分配
+	Select(task *Task, slots []*Worker) *Worker
+}
+
+// workerFilter 由需要排除部分节点的调度策略实现，被排除的节点不参与选择，
+// 在调度审计中记为RejectAffinity
+type workerFilter interface {
+	Accepts(task *Task, worker *Worker) bool
+}
+
+// SetStrategy 设置调度器的节点选择策略，为nil时恢复默认的FirstIdleStrategy
+func (ts *TaskScheduler) SetStrategy(strategy SchedulingStrategy) {
+	ts.workerMutex.Lock()
+	defer ts.workerMutex.Unlock()
+	if strategy == nil {
+		strategy = NewFirstIdleStrategy()
+	}
+	ts.strategy = strategy
+}
+
+// accepts 调度策略是否允许节点运行该任务，调用方需持有workerMutex
+func (ts *TaskScheduler) accepts(task *Task, worker *Worker) bool {
+	filter, ok := ts.strategy.(workerFilter)
+	return !ok || filter.Accepts(task, worker)
+}
+
+// slotGroup 同一个节点或集群的空闲任务槽
+type slotGroup struct {
+	key    string
+	worker *Worker // 第一个槽所属的节点
+	slots  int
+}
+
+// groupSlots 按key合并相邻的任务槽，保持原来的顺序
+func groupSlots(slots []*Worker, key func(*Worker) string) []slotGroup {
+	var groups []slotGroup
+	for _, worker := range slots {
+		k := key(worker)
+		if n := len(groups); n > 0 && groups[n-1].key == k {
+			groups[n-1].slots++
+			continue
+		}
+		groups = append(groups, slotGroup{key: k, worker: worker, slots: 1})
+	}
+	return groups
+}
+
+func workerKey(worker *Worker) string  { return worker.ID }
+func clusterKey(worker *Worker) string { return worker.ClusterID }
+
+// FirstIdleStrategy 默认策略：选择空闲任务槽最多的集群（只有本集群参与时即本集群）中
+// 排在最前面的节点，节点按注册顺序依次填满
+type FirstIdleStrategy struct{}
+
+// NewFirstIdleStrategy 创建默认调度策略
+func NewFirstIdleStrategy() *FirstIdleStrategy {
+	return &FirstIdleStrategy{}
+}
+
+func (s *FirstIdleStrategy) Name() string { return "first-idle" }
+
+func (s *FirstIdleStrategy) Select(task *Task, slots []*Worker) *Worker {
+	var best slotGroup
+	for _, cluster := range groupSlots(slots, clusterKey) {
+		if cluster.slots > best.slots {
+			best = cluster
+		}
+	}
+	return best.worker
+}
+
+// LeastLoadedStrategy 选择任务槽使用率最低的节点，使用率相同时选择空闲槽更多的节点
+type LeastLoadedStrategy struct{}
+
+// NewLeastLoadedStrategy 创建最小负载调度策略
+func NewLeastLoadedStrategy() *LeastLoadedStrategy {
+	return &LeastLoadedStrategy{}
+}
+
+func (s *LeastLoadedStrategy) Name() string { return "least-loaded" }
+
+func (s *LeastLoadedStrategy) Select(task *Task, slots []*Worker) *Worker {
+	var best slotGroup
+	for _, group := range groupSlots(slots, workerKey) {
+		if best.worker == nil {
+			best = group
+			continue
+		}
+		// 比较 Running/Capacity，交叉相乘避免浮点数
+		load := group.worker.Running * capacityOf(best.worker)
+		bestLoad := best.worker.Running * capacityOf(group.worker)
+		if load < bestLoad || (load == bestLoad && group.slots > best.slots) {
+			best = group
+		}
+	}
+	return best.worker
+}
+
+// RoundRobinStrategy 轮流分配：选择最久没有被分配任务的节点，从未分配过的节点按排列顺序优先
+type RoundRobinStrategy struct {
+	seq    uint64
+	served map[string]uint64 // workerID -> 最近一次被选中的序号
+}
+
+// NewRoundRobinStrategy 创建轮询调度策略
+func NewRoundRobinStrategy() *RoundRobinStrategy {
+	return &RoundRobinStrategy{served: make(map[string]uint64)}
+}
+
+func (s *RoundRobinStrategy) Name() string { return "round-robin" }
+
+func (s *RoundRobinStrategy) Select(task *Task, slots []*Worker) *Worker {
+	var best *Worker
+	for _, group := range groupSlots(slots, workerKey) {
+		if best == nil || s.served[group.worker.ID] < s.served[best.ID] {
+			best = group.worker
+		}
+	}
+	s.seq++
+	s.served[best.ID] = s.seq
+	return best
+}
+
+// AffinityStrategy 只把任务分配给标签匹配的节点：任务的每个标签在节点上都有相同的值。
+// 没有标签的任务可以分配给任意节点。在匹配的节点中由Fallback选择，Fallback为nil时使用FirstIdleStrategy
+type AffinityStrategy struct {
+	Fallback SchedulingStrategy
+}
+
+// NewAffinityStrategy 创建标签亲和调度策略，fallback在匹配的节点中做最终选择
+func NewAffinityStrategy(fallback SchedulingStrategy) *AffinityStrategy {
+	return &AffinityStrategy{Fallback: fallback}
+}
+
+func (s *AffinityStrategy) Name() string { return "affinity/" + s.fallback().Name() }
+
+func (s *AffinityStrategy) fallback() SchedulingStrategy {
+	if s.Fallback == nil {
+		return NewFirstIdleStrategy()
+	}
+	return s.Fallback
+}
+
+// Accepts 节点的标签是否满足任务的全部标签
+func (s *AffinityStrategy) Accepts(task *Task, worker *Worker) bool {
+	for key, value := range task.Labels {
+		if label, exists := worker.Labels[key]; !exists || label != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *AffinityStrategy) Select(task *Task, slots []*Worker) *Worker {
+	var matched []*Worker
+	for _, worker := range slots {
+		if s.Accepts(task, worker) {
+			matched = append(matched, worker)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return s.fallback().Select(task, matched)
+}
+
+// WeightedClusterStrategy 按权重在集群之间分配任务（平滑加权轮询），集群内选择排在最前面的节点。
+// 未设置权重的集群权重为1，权重<=0的集群只在没有其他集群可用时使用。
+// 只有多个集群同时参与选择时权重才起作用，通常配合FailoverAny使用
+type WeightedClusterStrategy struct {
+	weights map[string]int
+	current map[string]int // 平滑加权轮询的当前值
+}
+
+// NewWeightedClusterStrategy 创建按集群权重调度的策略
+func NewWeightedClusterStrategy(weights map[string]int) *WeightedClusterStrategy {
+	copied := make(map[string]int, len(weights))
+	for clusterID, weight := range weights {
+		copied[clusterID] = weight
+	}
+	return &WeightedClusterStrategy{weights: copied, current: make(map[string]int)}
+}
+
+func (s *WeightedClusterStrategy) Name() string { return "weighted-cluster" }
+
+func (s *WeightedClusterStrategy) weight(clusterID string) int {
+	if weight, exists := s.weights[clusterID]; exists {
+		return weight
+	}
+	return 1
+}
+
+func (s *WeightedClusterStrategy) Select(task *Task, slots []*Worker) *Worker {
+	clusters := groupSlots(slots, clusterKey)
+	total := 0
+	var best *slotGroup
+	for i := range clusters {
+		cluster := &clusters[i]
+		weight := s.weight(cluster.key)
+		if weight <= 0 {
+			continue
+		}
+		s.current[cluster.key] += weight
+		total += weight
+		if best == nil || s.current[cluster.key] > s.current[best.key] {
+			best = cluster
+		}
+	}
+	if best == nil {
+		return clusters[0].worker
+	}
+	s.current[best.key] -= total
+	return best.worker
+}
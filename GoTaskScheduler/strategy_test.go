@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+)
+
+// placeAll 依次调度任务，返回每个任务分配到的节点
+func placeAll(scheduler *TaskScheduler, tasks ...*Task) []string {
+	placed := make([]string, len(tasks))
+	for i, task := range tasks {
+		scheduler.Schedule(task)
+		placed[i] = task.WorkerID
+	}
+	return placed
+}
+
+func TestLeastLoadedAndRoundRobin(t *testing.T) {
+	newScheduler := func(strategy SchedulingStrategy) *TaskScheduler {
+		scheduler := NewTaskScheduler()
+		scheduler.SetStrategy(strategy)
+		scheduler.AddWorker(&Worker{ID: "w1", ClusterID: "cluster1", Status: "idle", Capacity: 2})
+		scheduler.AddWorker(&Worker{ID: "w2", ClusterID: "cluster1", Status: "idle", Capacity: 4})
+		return scheduler
+	}
+	tasks := func() []*Task {
+		var tasks []*Task
+		for _, id := range []string{"t1", "t2", "t3", "t4"} {
+			tasks = append(tasks, &Task{ID: id, ClusterID: "cluster1"})
+		}
+		return tasks
+	}
+
+	// 默认策略依次填满节点
+	if placed := placeAll(newScheduler(nil), tasks()...); placed[0] != "w1" || placed[1] != "w1" || placed[2] != "w2" {
+		t.Errorf("first-idle应先填满w1: %v", placed)
+	}
+
+	// 使用率相同时选择空闲槽更多的w2，之后按使用率交替
+	leastLoaded := newScheduler(NewLeastLoadedStrategy())
+	expected := []string{"w2", "w1", "w2", "w2"}
+	for i, worker := range placeAll(leastLoaded, tasks()...) {
+		if worker != expected[i] {
+			t.Errorf("least-loaded第%d个任务期望分配到%s，实际为%s", i+1, expected[i], worker)
+		}
+	}
+
+	// 轮询：依次分配给最久没有分配过任务的节点，节点已满时跳过
+	roundRobin := newScheduler(NewRoundRobinStrategy())
+	placed := placeAll(roundRobin, tasks()...)
+	placed = append(placed, placeAll(roundRobin, &Task{ID: "t5", ClusterID: "cluster1"}, &Task{ID: "t6", ClusterID: "cluster1"})...)
+	expected = []string{"w1", "w2", "w1", "w2", "w2", "w2"}
+	for i, worker := range placed {
+		if worker != expected[i] {
+			t.Errorf("round-robin第%d个任务期望分配到%s，实际为%s", i+1, expected[i], worker)
+		}
+	}
+}
+
+func TestAffinityStrategy(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.SetStrategy(NewAffinityStrategy(NewLeastLoadedStrategy()))
+	scheduler.AddWorker(&Worker{ID: "a1", ClusterID: "clusterA", Status: "idle", Capacity: 1})
+	scheduler.AddWorker(&Worker{ID: "a2", ClusterID: "clusterA", Status: "idle", Capacity: 1, Labels: map[string]string{"gpu": "true", "zone": "a"}})
+	scheduler.AddWorker(&Worker{ID: "b1", ClusterID: "clusterB", Status: "idle", Capacity: 1, Labels: map[string]string{"gpu": "true"}})
+
+	gpu := &Task{ID: "task1", ClusterID: "clusterA", Labels: map[string]string{"gpu": "true"}}
+	if !scheduler.Schedule(gpu) || gpu.WorkerID != "a2" {
+		t.Fatalf("期望分配到本集群带gpu标签的a2，实际为%s", gpu.WorkerID)
+	}
+
+	// 本集群还有空闲节点但标签不匹配，prefer-local溢出到标签匹配的集群
+	overflow := &Task{ID: "task2", ClusterID: "clusterA", Labels: map[string]string{"gpu": "true"}}
+	if !scheduler.Schedule(overflow) || overflow.WorkerID != "b1" {
+		t.Fatalf("期望溢出到带gpu标签的b1，实际为%s", overflow.WorkerID)
+	}
+
+	// 没有匹配的节点时等待，审计中记录标签不匹配
+	zone := &Task{ID: "task3", ClusterID: "clusterA", Labels: map[string]string{"zone": "b"}}
+	if scheduler.Schedule(zone) {
+		t.Fatalf("没有zone=b的节点，不应分配到%s", zone.WorkerID)
+	}
+	audit := scheduler.GetSchedulingAudit("task3")
+	if reasons := candidateReasons(audit[0]); reasons["a1"] != RejectAffinity {
+		t.Errorf("标签不匹配的拒绝原因不正确: %v", reasons)
+	}
+
+	// 没有标签的任务可以分配给任意节点
+	plain := &Task{ID: "task4", ClusterID: "clusterA"}
+	if !scheduler.Schedule(plain) || plain.WorkerID != "a1" {
+		t.Errorf("没有标签的任务应分配到a1，实际为%s", plain.WorkerID)
+	}
+}
+
+func TestWeightedClusterStrategy(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	scheduler.SetStrategy(NewWeightedClusterStrategy(map[string]int{"clusterA": 3, "clusterB": 1, "clusterC": 0}))
+	scheduler.AddWorker(&Worker{ID: "a1", ClusterID: "clusterA", Status: "idle", Capacity: 10})
+	scheduler.AddWorker(&Worker{ID: "b1", ClusterID: "clusterB", Status: "idle", Capacity: 10})
+	scheduler.AddWorker(&Worker{ID: "c1", ClusterID: "clusterC", Status: "idle", Capacity: 1})
+
+	counts := make(map[string]int)
+	for i := 0; i < 8; i++ {
+		task := &Task{ID: string(rune('a' + i)), ClusterID: "clusterA", Failover: FailoverAny}
+		scheduler.Schedule(task)
+		counts[task.WorkerID]++
+	}
+	if counts["a1"] != 6 || counts["b1"] != 2 || counts["c1"] != 0 {
+		t.Errorf("期望按3:1分配且不使用权重为0的集群: %v", counts)
+	}
+
+	// 只剩权重为0的集群时仍然可以使用
+	scheduler.workers["a1"].Status = "offline"
+	scheduler.workers["b1"].Status = "offline"
+	last := &Task{ID: "last", ClusterID: "clusterA", Failover: FailoverAny}
+	if !scheduler.Schedule(last) || last.WorkerID != "c1" {
+		t.Errorf("期望分配到c1，实际为%s", last.WorkerID)
+	}
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -121,3 +125,120 @@ func TestClusterStats(t *testing.T) {
 		t.Errorf("期望cluster2有1个空闲工作节点，实际有%d个", stats["cluster2"])
 	}
 }
+
+func TestConcurrentScheduleSharesNoSlot(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	for i := 1; i <= 4; i++ {
+		scheduler.AddWorker(&Worker{ID: fmt.Sprintf("worker%d", i), ClusterID: "cluster1", Status: "idle", Capacity: 2})
+	}
+
+	// 50个任务同时争抢8个任务槽
+	start := make(chan struct{})
+	var placed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if scheduler.Schedule(&Task{ID: fmt.Sprintf("task%d", i), ClusterID: "cluster1", Failover: FailoverStrict}) {
+				placed.Add(1)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	if placed.Load() != 8 {
+		t.Errorf("期望恰好分配8个任务，实际%d个", placed.Load())
+	}
+	for id, worker := range scheduler.workers {
+		if worker.Running != 2 || len(scheduler.inflight[id]) != 2 || worker.Status != "busy" {
+			t.Errorf("节点 %s 的任务槽不一致: running=%d inflight=%d status=%s", id, worker.Running, len(scheduler.inflight[id]), worker.Status)
+		}
+	}
+}
+
+// TestSchedulerStress 并发提交、执行和查询，用 go test -race 运行时检查数据竞争
+func TestSchedulerStress(t *testing.T) {
+	scheduler := NewTaskScheduler()
+	var running, peak atomic.Int32
+	scheduler.RegisterHandler("job", func(ctx context.Context, payload []byte) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			current := peak.Load()
+			if n <= current || peak.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 1; i <= 4; i++ {
+		id := fmt.Sprintf("worker%d", i)
+		scheduler.AddWorker(&Worker{ID: id, ClusterID: fmt.Sprintf("cluster%d", i%2+1), Status: "idle", Capacity: 2})
+		go scheduler.RunWorker(ctx, id)
+	}
+	go scheduler.Start()
+	defer scheduler.Stop()
+
+	// 查询和心跳与调度同时进行
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			scheduler.GetTaskStatus("task0-0")
+			scheduler.GetClusterUtilization()
+			scheduler.GetQueueStats()
+			scheduler.GetMetrics(0)
+			scheduler.PendingTasks()
+			scheduler.Heartbeat("worker1")
+		}
+	}()
+
+	var submitters sync.WaitGroup
+	for s := 0; s < 8; s++ {
+		submitters.Add(1)
+		go func(s int) {
+			defer submitters.Done()
+			for i := 0; i < 25; i++ {
+				scheduler.SubmitTask(&Task{
+					ID: fmt.Sprintf("task%d-%d", s, i), ClusterID: fmt.Sprintf("cluster%d", i%2+1),
+					Type: "job", Priority: i % 10, Queue: fmt.Sprintf("tenant%d", s%3),
+				})
+			}
+		}(s)
+	}
+	submitters.Wait()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for scheduler.GetMetrics(0).Finished < 200 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(done)
+	readers.Wait()
+
+	metrics := scheduler.GetMetrics(0)
+	if completed := metrics.Types["job"].Completed; completed != 200 {
+		t.Fatalf("期望200个任务全部完成，实际%d个", completed)
+	}
+	if peak.Load() > 8 {
+		t.Errorf("同时执行的任务数%d超过了任务槽总数8", peak.Load())
+	}
+	for _, usage := range scheduler.GetClusterUtilization() {
+		if usage.Running != 0 {
+			t.Errorf("全部完成后不应有占用的任务槽: %+v", usage)
+		}
+	}
+}